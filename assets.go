@@ -0,0 +1,15 @@
+package main
+
+import (
+	"embed"
+
+	"tictactoe/server"
+)
+
+// The web UI, built into the binary so the server runs from any directory.
+// -assets-dir serves a checkout's copy instead.
+//
+//go:embed templates static
+var assets embed.FS
+
+func init() { server.Assets = assets }
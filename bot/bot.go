@@ -0,0 +1,379 @@
+// Package bot lets programs play games on a server: a Bot decides the
+// moves, and a Runner seats it in a game over the websocket like any other
+// player and takes it through the rounds.
+package bot
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"tictactoe/client"
+	"tictactoe/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// --- Bot Runner ---
+
+// The runner handles the choreography a player's client would: it takes
+// the seat it is assigned, follows the board through start_game, moves,
+// undos and skipped turns, answers pings, and at the end of each round asks
+// Rematch whether to play on, by rematch or, once a series is over, by
+// new_series. The Bot only hears about rounds starting and ending and is
+// asked for a move on its turn. Its methods are called one at a time from
+// a goroutine of the runner's, so it needs no locking of its own. A bot
+// that takes longer than MoveTimeout to move, or whose move the server
+// refuses, concedes the round; an answer that comes too late is dropped.
+// A bot still busy with a move it timed out on concedes every turn until
+// it returns.
+
+// DefaultMoveTimeout is how long a bot has to move if the Runner doesn't
+// say.
+const DefaultMoveTimeout = 10 * time.Second
+
+// ErrNoSeat is returned by Run when the game had no seat for the bot and
+// it was made a spectator.
+var ErrNoSeat = errors.New("bot: no seat free in the game")
+
+// State is the round as the bot sees it.
+type State struct {
+	Symbol string         // The bot's seat
+	Board  protocol.Board // Rows of "X", "O", "Δ" or ""
+	Turn   string         // Who is on turn
+	Score  protocol.Score
+
+	WinLength  int                     // Marks in a row that win; 0 for ultimate
+	Variant    string                  // "" for classic, otherwise as on start_game
+	LegalMoves []protocol.Cell         // The cells the bot may mark, if the game lists them
+	Ultimate   *protocol.UltimateBoard // Ultimate games only: which sub-boards are open
+}
+
+// Result is how a round ended.
+type Result struct {
+	Event  protocol.Event // win, draw, concede, timeout_win, flag_fall, forfeit or round_adjudicated
+	Winner string         // "" for a draw
+	Won    bool           // The winner is the bot
+	Board  protocol.Board
+	Score  protocol.Score
+}
+
+// Bot is a program that plays.
+type Bot interface {
+	// OnGameStart is called as each round starts, or when the runner
+	// first sees one that is under way.
+	OnGameStart(st State)
+	// OnYourTurn picks the cell to mark.
+	OnYourTurn(st State) (row, col int)
+	// OnGameEnd is called as each round ends.
+	OnGameEnd(res Result)
+}
+
+// Runner plays a Bot in one game.
+type Runner struct {
+	Bot         Bot
+	MoveTimeout time.Duration // DefaultMoveTimeout if 0
+
+	// Rematch decides, after each round, whether to play another; nil
+	// declines. Nobody waits for it, so it should be quick.
+	Rematch func(res Result) bool
+}
+
+// call is one Bot method for the worker to run.
+type call func()
+
+// turn is a move the bot was asked for, and the answer once it has one.
+type turn struct {
+	seq      int
+	row, col int
+}
+
+// runState is the runner's side of one Run.
+type runState struct {
+	r        *Runner
+	c        *client.Conn
+	calls    chan call
+	moves    chan turn
+	done     chan struct{}
+	st       State
+	playing  bool // A round is on and it's been announced to the bot
+	seq      int  // Turns asked for; an answer for an older one is stale
+	asked    bool // Waiting on the bot's answer to seq
+	thinking bool // OnYourTurn hasn't returned, whether or not it timed out
+	timer    *time.Timer
+}
+
+// Run plays the bot on c until the game closes, a rematch is declined or
+// ctx is done. c should be freshly dialled to the game's websocket; Run
+// doesn't close it.
+func (r *Runner) Run(ctx context.Context, c *client.Conn) error {
+	done := make(chan struct{})
+	defer close(done)
+	s := &runState{r: r, c: c, calls: make(chan call, 16), moves: make(chan turn), done: done}
+	go func() {
+		for {
+			select {
+			case f := <-s.calls:
+				f()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	msgs := make(chan protocol.OutboundMessage)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := c.Receive()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case msgs <- msg:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	s.timer = time.NewTimer(time.Hour)
+	s.stopTimer()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-recvErr:
+			var ce *websocket.CloseError
+			if errors.As(err, &ce) {
+				return nil // The server closed the game
+			}
+			return err
+		case msg := <-msgs:
+			if stop, err := s.handle(msg); stop || err != nil {
+				return err
+			}
+		case t := <-s.moves:
+			s.thinking = false
+			if t.seq == s.seq && s.asked {
+				s.asked = false
+				s.stopTimer()
+				if err := c.MakeMove(t.row, t.col); err != nil {
+					return err
+				}
+			}
+		case <-s.timer.C:
+			if s.asked {
+				s.asked = false
+				if err := s.concede(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// handle acts on one server message. stop is true once the bot is done
+// with the game.
+func (s *runState) handle(msg protocol.OutboundMessage) (stop bool, err error) {
+	if msg.Board != nil {
+		s.st.Board = *msg.Board
+	}
+	if msg.Score != nil {
+		s.st.Score = *msg.Score
+	}
+	switch msg.Event {
+	case protocol.EventPing:
+		return false, s.c.Send(protocol.InboundMessage{Event: protocol.EventPong, Nonce: msg.Nonce})
+	case protocol.EventPlayerAssignment:
+		s.st.Symbol = msg.Player
+	case protocol.EventSpectatorAssignment:
+		return true, ErrNoSeat
+	case protocol.EventStartGame, protocol.EventNewGame, protocol.EventStateSync:
+		if msg.Event != protocol.EventNewGame {
+			s.st.WinLength, s.st.Variant = msg.WinLength, msg.Variant
+		}
+		s.track(msg)
+		if msg.CurrentPlayer != "" && !s.playing {
+			s.playing = true
+			st := s.snapshot()
+			s.enqueue(func() { s.r.Bot.OnGameStart(st) })
+		}
+		return false, s.prompt()
+	case protocol.EventMove:
+		if msg.Board == nil {
+			s.st.Board.Apply(msg.Changes) // A delta move
+		}
+		s.track(msg)
+		return false, s.prompt()
+	case protocol.EventUndoApplied, protocol.EventTurnSkipped:
+		s.track(msg)
+		return false, s.prompt()
+	case protocol.EventInvalidMove:
+		return false, s.concede() // The bot's move was refused
+	case protocol.EventWin, protocol.EventDraw, protocol.EventConcede, protocol.EventTimeoutWin, protocol.EventFlagFall, protocol.EventForfeit, protocol.EventRoundAdjudicated:
+		return s.roundOver(msg)
+	case protocol.EventSeriesOver, protocol.EventSeriesAdjudicated, protocol.EventSeriesSummary:
+		return false, s.c.RequestNewSeries() // roundOver already decided to play on
+	case protocol.EventRematchDeclined:
+		return true, nil
+	}
+	return false, nil
+}
+
+// track notes who is on turn and what they may mark.
+func (s *runState) track(msg protocol.OutboundMessage) {
+	if msg.CurrentPlayer != "" {
+		s.st.Turn = msg.CurrentPlayer
+	}
+	s.st.LegalMoves = msg.LegalMoves
+	if msg.Ultimate != nil {
+		s.st.Ultimate = msg.Ultimate
+	}
+}
+
+// snapshot copies the state for the bot, so later messages can't change it
+// under it.
+func (s *runState) snapshot() State {
+	st := s.st
+	st.Board = make(protocol.Board, len(s.st.Board))
+	for i, row := range s.st.Board {
+		st.Board[i] = append([]string(nil), row...)
+	}
+	st.LegalMoves = append([]protocol.Cell(nil), s.st.LegalMoves...)
+	return st
+}
+
+// prompt asks the bot for a move if it's on turn in a round under way.
+func (s *runState) prompt() error {
+	if !s.playing || s.st.Turn != s.st.Symbol || s.st.Symbol == "" {
+		return nil
+	}
+	if s.asked {
+		return nil // Already thinking about this turn
+	}
+	if s.thinking {
+		return s.concede() // Still stuck on a turn it timed out on
+	}
+	s.seq++
+	seq, st := s.seq, s.snapshot()
+	queued := s.enqueue(func() {
+		row, col := s.r.Bot.OnYourTurn(st)
+		select {
+		case s.moves <- turn{seq: seq, row: row, col: col}:
+		case <-s.done:
+		}
+	})
+	if !queued {
+		return s.concede()
+	}
+	s.asked, s.thinking = true, true
+	timeout := s.r.MoveTimeout
+	if timeout <= 0 {
+		timeout = DefaultMoveTimeout
+	}
+	s.timer.Reset(timeout)
+	return nil
+}
+
+// enqueue hands f to the worker, unless it is so far behind that its queue
+// is full, in which case f is dropped and enqueue returns false.
+func (s *runState) enqueue(f call) bool {
+	select {
+	case s.calls <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+// stopTimer stops the move timer and clears a firing that hasn't been
+// read, so it can't count against the next turn.
+func (s *runState) stopTimer() {
+	if !s.timer.Stop() {
+		select {
+		case <-s.timer.C:
+		default:
+		}
+	}
+}
+
+// concede gives up the round the bot couldn't move in.
+func (s *runState) concede() error {
+	s.asked = false
+	s.stopTimer()
+	if !s.playing {
+		return nil
+	}
+	return s.c.Concede()
+}
+
+// roundOver tells the bot how the round went and answers for the rematch.
+func (s *runState) roundOver(msg protocol.OutboundMessage) (stop bool, err error) {
+	s.playing, s.asked = false, false
+	s.stopTimer()
+	res := Result{Event: msg.Event, Winner: msg.Player, Won: msg.Player != "" && msg.Player == s.st.Symbol, Board: s.snapshot().Board, Score: s.st.Score}
+	s.enqueue(func() { s.r.Bot.OnGameEnd(res) })
+	if s.r.Rematch == nil || !s.r.Rematch(res) {
+		return true, s.c.DeclineRematch()
+	}
+	return false, s.c.RequestRematch()
+}
+
+// bots are the Bots the bot subcommand can play, by name.
+var bots = map[string]func() Bot{
+	"random": func() Bot { return Random{} },
+}
+
+// Main runs the bot subcommand with command-line args: it joins a game as
+// a built-in bot and plays until a rematch is declined or the game closes.
+func Main(args []string) error {
+	fs := flag.NewFlagSet("bot", flag.ContinueOnError)
+	server := fs.String("server", "ws://localhost:8000", "server base URL")
+	game := fs.String("game", "", "game ID to join (required)")
+	name := fs.String("bot", "random", "bot to play: random")
+	timeout := fs.Duration("move-timeout", DefaultMoveTimeout, "longest the bot may take to move before it concedes the round")
+	rematch := fs.String("rematch", "always", "after a round: always play another, or never")
+	rounds := fs.Int("rounds", 0, "rounds to play before declining a rematch; 0 for no limit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	newBot, ok := bots[*name]
+	switch {
+	case *game == "":
+		return errors.New("-game is required")
+	case !ok:
+		return fmt.Errorf("unknown bot %q", *name)
+	case *rematch != "always" && *rematch != "never":
+		return errors.New("-rematch must be always or never")
+	}
+
+	played := 0
+	r := &Runner{
+		Bot:         newBot(),
+		MoveTimeout: *timeout,
+		Rematch: func(res Result) bool {
+			played++
+			outcome := "drawn"
+			switch {
+			case res.Won:
+				outcome = "won"
+			case res.Winner != "":
+				outcome = "lost"
+			}
+			fmt.Fprintf(os.Stdout, "round %d %s (%s)  X: %d  O: %d  draws: %d\n", played, outcome, res.Event, res.Score.X, res.Score.O, res.Score.Draws)
+			return *rematch == "always" && (*rounds == 0 || played < *rounds)
+		},
+	}
+	ctx := context.Background()
+	c, err := client.Dial(ctx, client.GameURL(*server, *game), nil)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return r.Run(ctx, c)
+}
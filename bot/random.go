@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"math/rand"
+
+	"tictactoe/protocol"
+)
+
+// Random is a Bot that marks a free cell picked at random: one of the
+// legal moves if the game lists them, and in ultimate one in a sub-board
+// it may play in.
+type Random struct{}
+
+func (Random) OnGameStart(State) {}
+
+func (Random) OnGameEnd(Result) {}
+
+func (Random) OnYourTurn(st State) (row, col int) {
+	cells := st.LegalMoves
+	if len(cells) == 0 {
+		cells = freeCells(st)
+	}
+	if len(cells) == 0 {
+		return 0, 0 // Nowhere to go; the server will refuse it
+	}
+	c := cells[rand.Intn(len(cells))]
+	return c.Row, c.Col
+}
+
+// freeCells are the empty cells of st's board, limited in ultimate to the
+// sub-boards still open and to the one the next move must go in, if any.
+func freeCells(st State) []protocol.Cell {
+	var out []protocol.Cell
+	for r, row := range st.Board {
+		for c, mark := range row {
+			if mark == "" && inPlay(st.Ultimate, len(st.Board), r, c) {
+				out = append(out, protocol.Cell{Row: r, Col: c})
+			}
+		}
+	}
+	return out
+}
+
+func inPlay(u *protocol.UltimateBoard, size, r, c int) bool {
+	if u == nil || len(u.SubBoards) == 0 {
+		return true
+	}
+	sub := size / len(u.SubBoards)
+	br, bc := r/sub, c/sub
+	if u.Next != nil && (u.Next[0] != br || u.Next[1] != bc) {
+		return false
+	}
+	return u.SubBoards[br][bc] == ""
+}
@@ -0,0 +1,59 @@
+// Package buildinfo holds the version stamped into the binary at build time:
+//
+//	go build -ldflags "-X tictactoe/buildinfo.Version=1.4.0 \
+//	    -X tictactoe/buildinfo.Commit=$(git rev-parse HEAD) \
+//	    -X tictactoe/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Unstamped builds report "dev", or the VCS revision Go recorded if any.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+
+	"tictactoe/protocol"
+)
+
+var (
+	Version = "dev"
+	Commit  = "dev"
+	Date    = "dev"
+)
+
+func init() {
+	if Commit != "dev" {
+		return
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			Commit = s.Value
+		case "vcs.time":
+			if Date == "dev" {
+				Date = s.Value
+			}
+		}
+	}
+}
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+	Protocols []int  `json:"protocol_versions"`
+}
+
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		Protocols: protocol.Versions,
+	}
+}
@@ -0,0 +1,127 @@
+// Package client is a small Go client for the game websocket, used by the
+// load simulator, the terminal client and other tooling.
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"tictactoe/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// Conn is one player's websocket connection to a game. Receive must only be
+// called from one goroutine at a time, and likewise for the send methods.
+type Conn struct {
+	ws    *websocket.Conn
+	codec protocol.Codec
+}
+
+// GameURL builds the websocket URL for gameID on server, which may be given
+// as ws://, wss://, http:// or https://.
+func GameURL(server, gameID string) string {
+	server = strings.TrimRight(server, "/")
+	switch {
+	case strings.HasPrefix(server, "http://"):
+		server = "ws://" + strings.TrimPrefix(server, "http://")
+	case strings.HasPrefix(server, "https://"):
+		server = "wss://" + strings.TrimPrefix(server, "https://")
+	}
+	return server + "/ws/" + url.PathEscape(gameID)
+}
+
+// Dial connects to the websocket at rawURL. The connection speaks
+// MessagePack if rawURL asks for it with ?enc=msgpack or the server agreed
+// to the "msgpack" subprotocol offered in header, and JSON otherwise; and
+// likewise wire version 2 for ?v=2 or an agreed "v2.json" or "v2.msgpack".
+// Either way Receive returns messages as OutboundMessage.
+func Dial(ctx context.Context, rawURL string, header http.Header) (*Conn, error) {
+	ws, _, err := websocket.DefaultDialer.DialContext(ctx, rawURL, header)
+	if err != nil {
+		return nil, err
+	}
+	version, enc, _ := protocol.ParseSubprotocol(ws.Subprotocol())
+	if u, err := url.Parse(rawURL); err == nil {
+		if q := u.Query().Get("enc"); q != "" {
+			enc = q
+		}
+		if q := u.Query().Get("v"); q != "" {
+			if v, ok := protocol.ParseVersion(q); ok {
+				version = v
+			}
+		}
+	}
+	codec, ok := protocol.CodecNamed(enc)
+	if !ok {
+		codec = protocol.JSON
+	}
+	if version == 0 {
+		version = protocol.V1
+	}
+	return &Conn{ws: ws, codec: protocol.ForVersion(codec, version)}, nil
+}
+
+// Receive blocks until the next server message arrives.
+func (c *Conn) Receive() (protocol.OutboundMessage, error) {
+	var msg protocol.OutboundMessage
+	_, data, err := c.ws.ReadMessage()
+	if err != nil {
+		return msg, err
+	}
+	err = c.codec.Unmarshal(data, &msg)
+	return msg, err
+}
+
+// SetReadDeadline bounds how long Receive may block.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+// Send writes an arbitrary inbound message.
+func (c *Conn) Send(msg protocol.InboundMessage) error {
+	data, err := c.codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	frame := websocket.TextMessage
+	if c.codec.Binary() {
+		frame = websocket.BinaryMessage
+	}
+	return c.ws.WriteMessage(frame, data)
+}
+
+func (c *Conn) MakeMove(row, col int) error {
+	return c.Send(protocol.InboundMessage{Event: protocol.EventMakeMove, Row: &row, Col: &col})
+}
+
+func (c *Conn) RequestRematch() error {
+	return c.Send(protocol.InboundMessage{Event: protocol.EventRematchRequest})
+}
+
+func (c *Conn) DeclineRematch() error {
+	return c.Send(protocol.InboundMessage{Event: protocol.EventRematchDecline})
+}
+
+func (c *Conn) RequestNewSeries() error {
+	return c.Send(protocol.InboundMessage{Event: protocol.EventNewSeries})
+}
+
+func (c *Conn) Concede() error {
+	return c.Send(protocol.InboundMessage{Event: protocol.EventConcede})
+}
+
+// ResendFrom asks for the broadcasts from state version v on again, after
+// a gap in the versions received.
+func (c *Conn) ResendFrom(v uint64) error {
+	return c.Send(protocol.InboundMessage{Event: protocol.EventResendFrom, StateVersion: v})
+}
+
+// Close sends a normal close frame and closes the connection.
+func (c *Conn) Close() error {
+	c.ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	return c.ws.Close()
+}
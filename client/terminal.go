@@ -0,0 +1,251 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"tictactoe/engine"
+	"tictactoe/local"
+	"tictactoe/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// --- Terminal Client ---
+
+// The client subcommand plays an online game from a terminal: it draws the
+// board after every update, takes moves as "row col" on the player's turn,
+// and asks y/n about a rematch when a round ends. It speaks the websocket
+// with the same protocol messages as the server and the simulator, so it
+// doubles as a quick check that a running server plays a full game.
+
+// terminal is one player's view of the game, fed by server messages and
+// the lines they type.
+type terminal struct {
+	c   *Conn
+	out io.Writer
+
+	symbol   string // Our seat, or "" while spectating or not yet seated
+	board    protocol.Board
+	turn     string
+	playing  bool // A round is on
+	deciding bool // The round is over and we haven't answered the rematch prompt
+}
+
+// Play runs the terminal client on c until the player quits or declines a
+// rematch, in runs out, or the server closes the connection.
+func Play(ctx context.Context, c *Conn, in io.Reader, out io.Writer) error {
+	t := &terminal{c: c, out: out}
+	done := make(chan struct{})
+	defer close(done)
+	msgs := make(chan protocol.OutboundMessage)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := c.Receive()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case msgs <- msg:
+			case <-done:
+				return
+			}
+		}
+	}()
+	lines := make(chan string)
+	go func() {
+		s := bufio.NewScanner(in)
+		for s.Scan() {
+			select {
+			case lines <- strings.TrimSpace(s.Text()):
+			case <-done:
+				return
+			}
+		}
+		close(lines)
+	}()
+
+	fmt.Fprintln(out, "Connected. Enter moves as \"row col\"; type q to quit.")
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-recvErr:
+			var ce *websocket.CloseError
+			if errors.As(err, &ce) {
+				fmt.Fprintf(out, "\nDisconnected: %s\n", closeReason(ce))
+				return nil
+			}
+			return err
+		case msg := <-msgs:
+			t.handle(msg)
+		case line, ok := <-lines:
+			if !ok {
+				return nil
+			}
+			if quit, err := t.input(line); quit || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func closeReason(ce *websocket.CloseError) string {
+	if ce.Text != "" {
+		return ce.Text
+	}
+	return fmt.Sprintf("code %d", ce.Code)
+}
+
+// handle updates the view for one server message and prompts if it's now
+// our move.
+func (t *terminal) handle(msg protocol.OutboundMessage) {
+	if msg.Error != "" {
+		fmt.Fprintln(t.out, msg.Error)
+		t.prompt()
+		return
+	}
+	if msg.Board != nil {
+		t.board = *msg.Board
+	}
+	switch msg.Event {
+	case protocol.EventPlayerAssignment:
+		t.symbol = msg.Player
+		fmt.Fprintf(t.out, "You are %s. Waiting for an opponent...\n", t.symbol)
+	case protocol.EventSpectatorAssignment:
+		fmt.Fprintln(t.out, "The game is full; you are watching.")
+	case protocol.EventStartGame, protocol.EventNewGame, protocol.EventStateSync:
+		t.turn, t.playing, t.deciding = msg.CurrentPlayer, msg.CurrentPlayer != "", false
+		t.show(msg.Score)
+	case protocol.EventMove:
+		if msg.Board == nil {
+			t.board.Apply(msg.Changes) // A delta move
+		}
+		t.turn = msg.CurrentPlayer
+		t.show(nil)
+	case protocol.EventWin, protocol.EventDraw, protocol.EventConcede, protocol.EventTimeoutWin, protocol.EventFlagFall, protocol.EventForfeit:
+		t.playing, t.deciding = false, true
+		t.show(nil)
+		switch {
+		case msg.Event == protocol.EventDraw:
+			fmt.Fprintln(t.out, "It's a draw!")
+		case msg.Player == t.symbol:
+			fmt.Fprintln(t.out, "You win!")
+		default:
+			fmt.Fprintf(t.out, "Player %s wins.\n", msg.Player)
+		}
+		printScore(t.out, msg.Score)
+	case protocol.EventOpponentLeft:
+		t.playing, t.deciding = false, false
+		fmt.Fprintln(t.out, "Your opponent left. Waiting for a new one...")
+	case protocol.EventRematchRequested:
+		if msg.Player != t.symbol {
+			fmt.Fprintf(t.out, "Player %s wants a rematch.\n", msg.Player)
+		}
+	case protocol.EventRematchDeclined:
+		t.deciding = false
+		fmt.Fprintln(t.out, "The rematch was declined.")
+	case protocol.EventInvalidMove:
+		fmt.Fprintln(t.out, message(msg))
+	default:
+		if text := message(msg); text != "" {
+			fmt.Fprintln(t.out, text)
+		}
+		return
+	}
+	t.prompt()
+}
+
+// message is msg's localized text, or its code if it has none.
+func message(msg protocol.OutboundMessage) string {
+	if msg.Message != "" {
+		return msg.Message
+	}
+	return msg.Code
+}
+
+func (t *terminal) show(score *protocol.Score) {
+	if t.board != nil {
+		fmt.Fprintln(t.out)
+		local.Render(t.out, engine.Board(t.board))
+	}
+	printScore(t.out, score)
+}
+
+func printScore(out io.Writer, score *protocol.Score) {
+	if score != nil {
+		fmt.Fprintf(out, "Score  X: %d  O: %d  Draws: %d\n", score.X, score.O, score.Draws)
+	}
+}
+
+func (t *terminal) prompt() {
+	switch {
+	case t.deciding:
+		fmt.Fprint(t.out, "Rematch? [y/n]: ")
+	case t.playing && t.turn == t.symbol:
+		fmt.Fprint(t.out, "Your move (row col): ")
+	case t.playing:
+		fmt.Fprintf(t.out, "Waiting for %s...\n", t.turn)
+	}
+}
+
+// input acts on one line the player typed. done is true once they have
+// quit or declined a rematch.
+func (t *terminal) input(line string) (done bool, err error) {
+	switch {
+	case strings.EqualFold(line, "q") || strings.EqualFold(line, "quit"):
+		return true, nil
+	case line == "":
+		return false, nil
+	case t.deciding:
+		switch strings.ToLower(line) {
+		case "y", "yes":
+			t.deciding = false
+			fmt.Fprintln(t.out, "Waiting for your opponent to agree...")
+			return false, t.c.RequestRematch()
+		case "n", "no":
+			return true, t.c.DeclineRematch()
+		}
+		t.prompt()
+	case t.playing && t.turn == t.symbol:
+		row, col, err := local.ParseMove(line, len(t.board))
+		if err != nil {
+			fmt.Fprintln(t.out, err)
+			t.prompt()
+			return false, nil
+		}
+		return false, t.c.MakeMove(row, col)
+	default:
+		fmt.Fprintln(t.out, "It's not your turn.")
+	}
+	return false, nil
+}
+
+// Main runs the client subcommand with command-line args.
+func Main(args []string) error {
+	fs := flag.NewFlagSet("client", flag.ContinueOnError)
+	server := fs.String("server", "ws://localhost:8000", "server base URL")
+	game := fs.String("game", "", "game ID to join (required)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *game == "" {
+		return errors.New("-game is required")
+	}
+
+	ctx := context.Background()
+	c, err := Dial(ctx, GameURL(*server, *game), nil)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return Play(ctx, c, os.Stdin, os.Stdout)
+}
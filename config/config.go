@@ -0,0 +1,499 @@
+// Package config holds the settings shared by the xo subcommands, read from
+// flags with environment-variable fallbacks.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Addr           string
+	WriteTimeout   time.Duration // Deadline for each outbound websocket write
+	SendQueueDepth int           // Outbound messages buffered per connection
+	ResendBuffer   int           // Latest broadcasts kept per game for resend_from; 0 answers every one with state_sync
+	ShutdownGrace  time.Duration // How long clients may keep playing after shutdown begins
+	GameTTL        time.Duration // Idle time after which a game is deleted
+	EmptyRetention time.Duration // How long a game outlives its last connection
+	ReconnectGrace time.Duration // How long a dropped player's seat is held
+	TurnReminder   time.Duration // Quiet time on a turn before the player is nudged; 0 disables
+	IdleNotice     time.Duration // Quiet time on a turn before the opponent is told; 0 disables
+	RatedAbort     string        // Agreed abort of a rated round past move 2: "deny" or "draw"
+	BasePath       string        // Path prefix every route is mounted under, for serving behind a reverse proxy
+	TokenSecret    string        // Key for seat tokens; must match across servers sharing games
+	Store          string        // Persistence backend: "memory", "sqlite" or "redis"
+	StoreDSN       string        // SQLite file path or Redis URL
+	RedisAddr      string        // Redis host:port shared with other instances for distributed mode; "" plays on this instance alone
+	Headless       bool          // Serve only the API: no HTML pages or static assets
+	AssetsDir      string        // Serve templates/ and static/ from here instead of the embedded copies
+	TemplatesDir   string        // Read the page templates from here instead of the assets' templates/
+
+	// Anti-bot challenge on anonymous game creation: "off", "pow" or "captcha"
+	Challenge        string
+	PowDifficulty    int // Leading zero bits required in the proof-of-work hash
+	CaptchaVerifyURL string
+	CaptchaSecret    string
+	TrustedNets      []*net.IPNet // Clients in these ranges skip the challenge and the per-IP limits
+
+	// Namespaces of games, by name; always includes DefaultTenant
+	Tenants        map[string]Tenant
+	DynamicTenants bool // Unlisted tenants are created on first use, without limits
+
+	// Websocket upgrader tuning
+	ReadBufferSize   int
+	WriteBufferSize  int
+	WriteBufferPool  bool          // Share write buffers between idle connections
+	HandshakeTimeout time.Duration // 0 leaves the handshake unbounded
+	Compression      bool          // Offer permessage-deflate to clients
+
+	// Ready checks, for games created with one
+	ReadyTimeout       time.Duration // How long players have to answer; 0 waits indefinitely
+	ReadyTimeoutPolicy string        // What a timeout does: "cancel" the round or "start" it anyway
+
+	SettingsTimeout time.Duration // How long the second player has to accept the first's settings; 0 waits indefinitely
+
+	StartCountdown time.Duration // Delay between game_starting and the round it announces; 0 starts at once
+
+	SuspiciousRejections int           // Wrong-turn, taken-cell and too-fast moves in a round before a connection is flagged; 0 disables
+	KickSuspicious       bool          // Close a flagged connection as if the host had kicked it
+	MinMoveInterval      time.Duration // Least time between one connection's accepted moves; 0 disables
+
+	NoShowGrace time.Duration // How long past its start a scheduled game waits before forfeiting
+
+	CorrespondenceTurn time.Duration // Default time per move in correspondence games
+
+	// Turn timer, for games that don't choose their own
+	TurnTimer   time.Duration // Time per move; 0 for no limit
+	TurnTimeout string        // What running out of time does: "forfeit" the round or "skip" the turn
+	TimeControl time.Duration // Each player's time for a whole round, chess style; 0 for none
+
+	// Computer opponent: each move waits a random time between the two
+	AIThinkMin time.Duration
+	AIThinkMax time.Duration
+
+	DiscordWebhook string // Where every game's result is posted, unless the game names its own
+	PublicURL      string // Scheme and host the server is reached at, for links in notifications
+
+	StrictGames bool          // Connections may only join games created through POST /games
+	LobbyTTL    time.Duration // How long a game created through POST /games waits for its first player
+
+	PingInterval time.Duration // Time between pings
+	PingTimeout  time.Duration // How long a connection may leave its pings unanswered before it is dropped
+
+	LogLevel  slog.Level // Least severe level logged
+	LogFormat string     // "text" or "json"
+
+	TokenTTL time.Duration // How long a seat token is valid; reconnecting issues a fresh one
+
+	MaxGames       int // Live games across all tenants; 0 for no limit
+	MaxConnections int // Open websockets; 0 for no limit
+
+	// Per client IP; see TrustedProxies for what the IP is
+	MaxConnsPerIP    int           // Open websockets; 0 for no limit
+	MaxGamesPerIP    int           // New games within GamesPerIPWindow; 0 for no limit
+	GamesPerIPWindow time.Duration // The window MaxGamesPerIP counts over
+	TrustedProxies   []*net.IPNet  // Peers whose X-Forwarded-For names the client; otherwise the peer is the client
+
+	AllowedOrigins  []string // Browser origins besides the server's own that may open websockets; "*." matches subdomains
+	AllowAllOrigins bool     // Skip the origin check altogether
+	TLSCert         string   // Certificate file; serving TLS needs TLSKey too
+	TLSKey          string
+
+	SecurityHeaders       bool   // Send nosniff, framing and referrer headers with every response
+	ContentSecurityPolicy string // Content-Security-Policy for the HTML pages; "" sends none
+	CSRF                  bool   // Require the double-submit token on browser requests that change state
+
+	// Inbound flood protection, per connection
+	InboundRate  int // Messages per second a client may send on average
+	InboundBurst int // Messages a client may send at once above InboundRate
+	FloodLimit   int // Messages refused in a row before the connection is closed
+}
+
+// DefaultCSP lets the web UI load its own scripts, styles and images, its
+// web font, and open websockets back to the server, and nothing else; no
+// other site may frame it.
+const DefaultCSP = "default-src 'self'; script-src 'self'; style-src 'self' https://fonts.googleapis.com; font-src https://fonts.gstatic.com; img-src 'self' data:; connect-src 'self' ws: wss:; frame-ancestors 'none'; base-uri 'self'; form-action 'self'"
+
+// DefaultTenant is the namespace of the legacy routes without /t/{tenant}.
+const DefaultTenant = "default"
+
+// Tenant holds the limits of one namespace of games.
+type Tenant struct {
+	MaxGames       int      // Live games at once; 0 for no limit
+	AllowedOrigins []string // Browser origins allowed to connect; empty allows any
+}
+
+// ValidTenantName reports whether name can be used in a /t/{tenant} path.
+func ValidTenantName(name string) bool {
+	if name == "" || len(name) > 32 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTenants reads a comma-separated list of tenants, each a name with
+// optional ;max_games=N and ;origins=a|b settings.
+func parseTenants(list string) (map[string]Tenant, error) {
+	tenants := map[string]Tenant{DefaultTenant: {}}
+	for _, item := range strings.Split(list, ",") {
+		fields := strings.Split(strings.TrimSpace(item), ";")
+		name := fields[0]
+		if name == "" {
+			continue
+		}
+		if !ValidTenantName(name) {
+			return nil, fmt.Errorf("invalid tenant name %q: use 1-32 lowercase letters, digits and dashes", name)
+		}
+		var t Tenant
+		for _, f := range fields[1:] {
+			key, value, _ := strings.Cut(f, "=")
+			switch key {
+			case "max_games":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("tenant %s: invalid max_games %q", name, value)
+				}
+				t.MaxGames = n
+			case "origins":
+				t.AllowedOrigins = strings.Split(value, "|")
+			default:
+				return nil, fmt.Errorf("tenant %s: unknown setting %q", name, key)
+			}
+		}
+		tenants[name] = t
+	}
+	return tenants, nil
+}
+
+// Default returns the configuration used when no flags or env vars are set.
+func Default() Config {
+	return Config{
+		Addr:           ":8000",
+		WriteTimeout:   5 * time.Second,
+		SendQueueDepth: 32,
+		ResendBuffer:   32,
+		ShutdownGrace:  10 * time.Second,
+		GameTTL:        24 * time.Hour,
+		LobbyTTL:       time.Hour,
+		PingInterval:   5 * time.Second,
+		PingTimeout:    15 * time.Second,
+		EmptyRetention: 10 * time.Minute,
+		ReconnectGrace: 30 * time.Second,
+		TurnReminder:   20 * time.Second,
+		IdleNotice:     45 * time.Second,
+		AIThinkMin:     200 * time.Millisecond,
+		AIThinkMax:     600 * time.Millisecond,
+		RatedAbort:     "deny",
+		Store:          "memory",
+		Tenants:        map[string]Tenant{DefaultTenant: {}},
+		Challenge:      "off",
+		PowDifficulty:  20,
+
+		SecurityHeaders:       true,
+		ContentSecurityPolicy: DefaultCSP,
+		CSRF:                  true,
+
+		ReadBufferSize:   1024,
+		WriteBufferSize:  1024,
+		WriteBufferPool:  true,
+		HandshakeTimeout: 10 * time.Second,
+
+		ReadyTimeout:       time.Minute,
+		ReadyTimeoutPolicy: "cancel",
+
+		SettingsTimeout: 30 * time.Second,
+
+		StartCountdown: 3 * time.Second,
+
+		SuspiciousRejections: 20,
+
+		NoShowGrace: 5 * time.Minute,
+
+		CorrespondenceTurn: 72 * time.Hour,
+
+		TurnTimeout: "forfeit",
+
+		InboundRate:  10,
+		InboundBurst: 20,
+		FloodLimit:   50,
+
+		MaxConnsPerIP:    0,
+		MaxGamesPerIP:    0,
+		GamesPerIPWindow: 10 * time.Minute,
+
+		LogFormat: "text",
+
+		TokenTTL: 30 * 24 * time.Hour,
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func envBool(key string, fallback bool) bool {
+	if v, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func parseNets(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			if strings.Contains(item, ":") {
+				item += "/128"
+			} else {
+				item += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted IP %q: %v", item, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Load parses args for the named subcommand, falling back to environment
+// variables and then to Default. It returns the positional arguments left
+// after the flags.
+func Load(name string, args []string) (Config, []string, error) {
+	c := Default()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	var trusted, proxies, tenants string
+	fs.StringVar(&c.Addr, "addr", envOr("ADDR", c.Addr), "listen address")
+	port := fs.String("port", envOr("PORT", ""), "listen port, replacing the one in -addr")
+	origins := fs.String("allowed-origins", envOr("ALLOWED_ORIGINS", ""), "comma-separated browser origins besides this server's own that may open websockets, e.g. https://example.com,https://*.example.com")
+	fs.BoolVar(&c.AllowAllOrigins, "insecure-allow-all-origins", envBool("INSECURE_ALLOW_ALL_ORIGINS", false), "accept websockets from pages on any site")
+	fs.BoolVar(&c.SecurityHeaders, "security-headers", envBool("SECURITY_HEADERS", c.SecurityHeaders), "send X-Content-Type-Options, X-Frame-Options and Referrer-Policy with every response")
+	fs.StringVar(&c.ContentSecurityPolicy, "csp", envOr("CSP", c.ContentSecurityPolicy), "Content-Security-Policy for the web UI's pages; empty for none")
+	fs.BoolVar(&c.CSRF, "csrf", envBool("CSRF", c.CSRF), "refuse browser POST, PUT, PATCH and DELETE requests without the page's CSRF token")
+	fs.StringVar(&c.TLSCert, "tls-cert", envOr("TLS_CERT", ""), "certificate file for serving HTTPS")
+	fs.StringVar(&c.TLSKey, "tls-key", envOr("TLS_KEY", ""), "private key file for serving HTTPS")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", envDuration("WRITE_TIMEOUT", c.WriteTimeout), "deadline for each websocket write")
+	fs.IntVar(&c.SendQueueDepth, "send-queue", envInt("SEND_QUEUE", c.SendQueueDepth), "outbound messages buffered per connection before the overflow policy applies")
+	fs.IntVar(&c.ResendBuffer, "resend-buffer", envInt("RESEND_BUFFER", c.ResendBuffer), "latest broadcasts kept per game for clients that missed some to ask for again (0 sends a state_sync instead)")
+	fs.DurationVar(&c.ShutdownGrace, "shutdown-grace", envDuration("SHUTDOWN_GRACE", c.ShutdownGrace), "how long clients are warned before sockets are closed on shutdown")
+	fs.DurationVar(&c.GameTTL, "game-ttl", envDuration("GAME_TTL", c.GameTTL), "idle time after which a game is deleted")
+	fs.DurationVar(&c.EmptyRetention, "empty-retention", envDuration("EMPTY_RETENTION", c.EmptyRetention), "how long a game with nobody connected keeps its seats, board and score")
+	fs.DurationVar(&c.ReconnectGrace, "reconnect-grace", envDuration("RECONNECT_GRACE", c.ReconnectGrace), "how long a disconnected player's seat is held for them")
+	fs.DurationVar(&c.TurnReminder, "turn-reminder", envDuration("TURN_REMINDER", c.TurnReminder), "quiet time on a turn before reminding the player to move (0 disables)")
+	fs.DurationVar(&c.IdleNotice, "idle-notice", envDuration("IDLE_NOTICE", c.IdleNotice), "quiet time on a turn before telling the opponent the player is idle (0 disables)")
+	fs.StringVar(&c.RatedAbort, "rated-abort", envOr("RATED_ABORT", c.RatedAbort), "agreed abort of a rated round after move 2: deny or draw")
+	fs.StringVar(&c.BasePath, "base-path", envOr("BASE_PATH", ""), "path prefix to mount every route under, e.g. /xo, for a reverse proxy that passes it through")
+	fs.StringVar(&c.TokenSecret, "token-secret", envOr("TOKEN_SECRET", ""), "key for signing seat tokens (random per process if unset)")
+	fs.DurationVar(&c.TokenTTL, "token-ttl", envDuration("TOKEN_TTL", c.TokenTTL), "how long a seat token is valid after it is issued")
+	fs.StringVar(&c.Store, "store", envOr("STORE", c.Store), "persistence backend: memory, sqlite or redis")
+	fs.StringVar(&c.StoreDSN, "store-dsn", envOr("STORE_DSN", ""), "SQLite database file or Redis URL (default xo.db or redis://localhost:6379/0)")
+	fs.StringVar(&c.RedisAddr, "redis-addr", envOr("REDIS_ADDR", ""), "Redis host:port to share games with other instances through; off if unset")
+	fs.BoolVar(&c.Headless, "headless", envBool("HEADLESS", false), "serve only the websocket and REST API, without the web UI")
+	fs.StringVar(&c.AssetsDir, "assets-dir", envOr("ASSETS_DIR", ""), "serve the web UI's templates/ and static/ from this directory, re-reading templates on every page, instead of the copies built in")
+	fs.StringVar(&c.TemplatesDir, "templates-dir", envOr("TEMPLATES_DIR", ""), "read the web UI's page templates from this directory, re-reading them on every page, instead of the assets' templates/")
+	fs.StringVar(&tenants, "tenants", envOr("TENANTS", ""), "comma-separated tenants served under /t/{tenant}, e.g. club;max_games=100;origins=https://club.example")
+	fs.BoolVar(&c.DynamicTenants, "dynamic-tenants", envBool("DYNAMIC_TENANTS", false), "create unlisted tenants on first use")
+	fs.StringVar(&c.Challenge, "challenge", envOr("CHALLENGE", c.Challenge), "challenge on anonymous game creation: off, pow or captcha")
+	fs.IntVar(&c.PowDifficulty, "pow-difficulty", envInt("POW_DIFFICULTY", c.PowDifficulty), "leading zero bits required for proof-of-work")
+	fs.StringVar(&c.CaptchaVerifyURL, "captcha-verify-url", envOr("CAPTCHA_VERIFY_URL", ""), "CAPTCHA provider siteverify endpoint")
+	fs.StringVar(&c.CaptchaSecret, "captcha-secret", envOr("CAPTCHA_SECRET", ""), "CAPTCHA provider secret key")
+	fs.StringVar(&trusted, "trusted-ips", envOr("TRUSTED_IPS", ""), "comma-separated IPs/CIDRs that skip the challenge and the per-IP limits")
+	fs.IntVar(&c.ReadBufferSize, "ws-read-buffer", envInt("WS_READ_BUFFER", c.ReadBufferSize), "websocket read buffer size in bytes")
+	fs.IntVar(&c.WriteBufferSize, "ws-write-buffer", envInt("WS_WRITE_BUFFER", c.WriteBufferSize), "websocket write buffer size in bytes")
+	fs.BoolVar(&c.WriteBufferPool, "ws-buffer-pool", envBool("WS_BUFFER_POOL", c.WriteBufferPool), "share websocket write buffers between connections")
+	fs.DurationVar(&c.HandshakeTimeout, "ws-handshake-timeout", envDuration("WS_HANDSHAKE_TIMEOUT", c.HandshakeTimeout), "deadline for the websocket upgrade handshake (0 for none)")
+	fs.BoolVar(&c.Compression, "ws-compression", envBool("WS_COMPRESSION", c.Compression), "negotiate permessage-deflate compression")
+	fs.DurationVar(&c.ReadyTimeout, "ready-timeout", envDuration("READY_TIMEOUT", c.ReadyTimeout), "how long players have to answer a ready check (0 waits indefinitely)")
+	fs.StringVar(&c.ReadyTimeoutPolicy, "ready-timeout-policy", envOr("READY_TIMEOUT_POLICY", c.ReadyTimeoutPolicy), "what an unanswered ready check does: cancel or start")
+	fs.DurationVar(&c.SettingsTimeout, "settings-timeout", envDuration("SETTINGS_TIMEOUT", c.SettingsTimeout), "how long the second player has to accept a configured game's settings before it starts anyway (0 waits indefinitely)")
+	fs.DurationVar(&c.StartCountdown, "start-countdown", envDuration("START_COUNTDOWN", c.StartCountdown), "countdown announced with game_starting before each round begins (0 starts at once)")
+	fs.IntVar(&c.SuspiciousRejections, "suspicious-rejections", envInt("SUSPICIOUS_REJECTIONS", c.SuspiciousRejections), "wrong-turn, taken-cell and too-fast moves one connection may send in a round before it is flagged as suspicious (0 disables)")
+	fs.BoolVar(&c.KickSuspicious, "kick-suspicious", envBool("KICK_SUSPICIOUS", false), "close a connection flagged as suspicious")
+	fs.DurationVar(&c.MinMoveInterval, "min-move-interval", envDuration("MIN_MOVE_INTERVAL", 0), "refuse a move that comes sooner than this after the same connection's last, e.g. 50ms (0 disables; leave it off for bots and the load simulator)")
+	fs.DurationVar(&c.NoShowGrace, "no-show-grace", envDuration("NO_SHOW_GRACE", c.NoShowGrace), "default time past its start a scheduled game waits for a player before forfeiting")
+	fs.StringVar(&c.DiscordWebhook, "discord-webhook", envOr("DISCORD_WEBHOOK", ""), "Discord webhook URL to post match results to")
+	fs.StringVar(&c.PublicURL, "public-url", envOr("PUBLIC_URL", ""), "scheme and host the server is reached at, e.g. https://xo.example.com, for links in notifications")
+	fs.DurationVar(&c.CorrespondenceTurn, "correspondence-turn", envDuration("CORRESPONDENCE_TURN", c.CorrespondenceTurn), "default time per move in correspondence games before the player forfeits")
+	fs.DurationVar(&c.TurnTimer, "turn-timer", envDuration("TURN_TIMER", 0), "default time per move before the turn times out (0 for no limit)")
+	fs.DurationVar(&c.TimeControl, "time-control", envDuration("TIME_CONTROL", 0), "default time each player has for a whole round before their flag falls (0 for none)")
+	fs.DurationVar(&c.AIThinkMin, "ai-think-min", envDuration("AI_THINK_MIN", c.AIThinkMin), "shortest time the computer opponent takes before moving")
+	fs.DurationVar(&c.AIThinkMax, "ai-think-max", envDuration("AI_THINK_MAX", c.AIThinkMax), "longest time the computer opponent takes before moving")
+	fs.StringVar(&c.TurnTimeout, "turn-timeout", envOr("TURN_TIMEOUT", c.TurnTimeout), "default for a timed-out turn: forfeit the round or skip the turn")
+	fs.DurationVar(&c.LobbyTTL, "lobby-ttl", envDuration("LOBBY_TTL", c.LobbyTTL), "how long a created game waits for its first player before it is deleted")
+	fs.DurationVar(&c.PingInterval, "ping-interval", envDuration("PING_INTERVAL", c.PingInterval), "time between pings to each connection")
+	fs.DurationVar(&c.PingTimeout, "ping-timeout", envDuration("PING_TIMEOUT", c.PingTimeout), "how long a connection may leave its pings unanswered, a ping every -ping-interval, before it is dropped")
+	fs.IntVar(&c.InboundRate, "inbound-rate", envInt("INBOUND_RATE", c.InboundRate), "websocket messages per second a client may send on average")
+	fs.IntVar(&c.InboundBurst, "inbound-burst", envInt("INBOUND_BURST", c.InboundBurst), "websocket messages a client may send at once above -inbound-rate")
+	logLevel := fs.String("log-level", envOr("LOG_LEVEL", "info"), "least severe log level written: debug, info, warn or error")
+	fs.StringVar(&c.LogFormat, "log-format", envOr("LOG_FORMAT", c.LogFormat), "log line format: text or json")
+	fs.IntVar(&c.MaxGames, "max-games", envInt("MAX_GAMES", c.MaxGames), "live games at once across all tenants (0 for no limit)")
+	fs.IntVar(&c.MaxConnections, "max-connections", envInt("MAX_CONNECTIONS", c.MaxConnections), "open websocket connections at once (0 for no limit)")
+	fs.IntVar(&c.MaxConnsPerIP, "max-conns-per-ip", envInt("MAX_CONNS_PER_IP", c.MaxConnsPerIP), "open websocket connections at once from one client IP (0 for no limit)")
+	fs.IntVar(&c.MaxGamesPerIP, "max-games-per-ip", envInt("MAX_GAMES_PER_IP", c.MaxGamesPerIP), "new games one client IP may create within -games-per-ip-window (0 for no limit)")
+	fs.DurationVar(&c.GamesPerIPWindow, "games-per-ip-window", envDuration("GAMES_PER_IP_WINDOW", c.GamesPerIPWindow), "the window -max-games-per-ip counts over")
+	fs.StringVar(&proxies, "trusted-proxy", envOr("TRUSTED_PROXY", ""), "comma-separated IPs/CIDRs of reverse proxies whose X-Forwarded-For names the client for the per-IP limits")
+	fs.IntVar(&c.FloodLimit, "flood-limit", envInt("FLOOD_LIMIT", c.FloodLimit), "rate-limited messages in a row before the connection is closed")
+	fs.BoolVar(&c.StrictGames, "strict-games", envBool("STRICT_GAMES", false), "refuse websocket connections to game IDs that weren't created through POST /games")
+	if err := fs.Parse(args); err != nil {
+		return c, nil, err
+	}
+
+	c.BasePath = strings.TrimRight(c.BasePath, "/")
+	c.PublicURL = strings.TrimRight(c.PublicURL, "/")
+	if c.BasePath != "" && (!strings.HasPrefix(c.BasePath, "/") || strings.ContainsAny(c.BasePath, "{}?#")) {
+		return c, nil, fmt.Errorf("invalid -base-path %q: want a path such as /xo", c.BasePath)
+	}
+	if c.ReadBufferSize < 0 || c.WriteBufferSize < 0 {
+		return c, nil, fmt.Errorf("websocket buffer sizes can't be negative")
+	}
+	if c.ResendBuffer < 0 {
+		return c, nil, fmt.Errorf("resend buffer can't be negative")
+	}
+	var err error
+	if c.TrustedNets, err = parseNets(trusted); err != nil {
+		return c, nil, err
+	}
+	if c.TrustedProxies, err = parseNets(proxies); err != nil {
+		return c, nil, err
+	}
+	if c.Tenants, err = parseTenants(tenants); err != nil {
+		return c, nil, err
+	}
+	if c.RatedAbort != "deny" && c.RatedAbort != "draw" {
+		return c, nil, fmt.Errorf("unknown rated abort policy %q", c.RatedAbort)
+	}
+	if c.ReadyTimeoutPolicy != "cancel" && c.ReadyTimeoutPolicy != "start" {
+		return c, nil, fmt.Errorf("unknown ready timeout policy %q", c.ReadyTimeoutPolicy)
+	}
+	if c.CorrespondenceTurn <= 0 {
+		return c, nil, fmt.Errorf("correspondence turn must be positive")
+	}
+	if c.StartCountdown < 0 {
+		return c, nil, fmt.Errorf("start countdown can't be negative")
+	}
+	if c.SuspiciousRejections < 0 || c.MinMoveInterval < 0 {
+		return c, nil, fmt.Errorf("suspicious rejections and min move interval can't be negative")
+	}
+	if c.TurnReminder < 0 || c.IdleNotice < 0 {
+		return c, nil, fmt.Errorf("turn reminder and idle notice can't be negative")
+	}
+	if c.TurnTimer < 0 {
+		return c, nil, fmt.Errorf("turn timer can't be negative")
+	}
+	if c.TimeControl < 0 {
+		return c, nil, fmt.Errorf("time control can't be negative")
+	}
+	if c.AIThinkMin < 0 || c.AIThinkMax < c.AIThinkMin {
+		return c, nil, fmt.Errorf("ai think times must satisfy 0 <= min <= max")
+	}
+	if c.TurnTimeout != "forfeit" && c.TurnTimeout != "skip" {
+		return c, nil, fmt.Errorf("unknown turn timeout policy %q", c.TurnTimeout)
+	}
+	if c.LobbyTTL <= 0 {
+		return c, nil, fmt.Errorf("lobby TTL must be positive")
+	}
+	if c.PingInterval <= 0 {
+		return c, nil, fmt.Errorf("ping interval must be positive")
+	}
+	if c.PingTimeout < c.PingInterval {
+		return c, nil, fmt.Errorf("ping timeout must be at least the ping interval")
+	}
+	if err := c.LogLevel.UnmarshalText([]byte(*logLevel)); err != nil {
+		return c, nil, fmt.Errorf("unknown log level %q", *logLevel)
+	}
+	if *port != "" {
+		host, _, err := net.SplitHostPort(c.Addr)
+		if err != nil {
+			return c, nil, fmt.Errorf("invalid -addr %q: %v", c.Addr, err)
+		}
+		c.Addr = net.JoinHostPort(host, *port)
+	}
+	for _, item := range strings.Split(*origins, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		u, err := url.Parse(item)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			return c, nil, fmt.Errorf("invalid allowed origin %q: want scheme://host[:port]", item)
+		}
+		c.AllowedOrigins = append(c.AllowedOrigins, item)
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return c, nil, fmt.Errorf("-tls-cert and -tls-key must be given together")
+	}
+	if c.MaxGames < 0 || c.MaxConnections < 0 {
+		return c, nil, fmt.Errorf("-max-games and -max-connections can't be negative")
+	}
+	if c.MaxConnsPerIP < 0 || c.MaxGamesPerIP < 0 {
+		return c, nil, fmt.Errorf("-max-conns-per-ip and -max-games-per-ip can't be negative")
+	}
+	if c.MaxGamesPerIP > 0 && c.GamesPerIPWindow <= 0 {
+		return c, nil, fmt.Errorf("-games-per-ip-window must be positive")
+	}
+	if c.TokenTTL <= 0 {
+		return c, nil, fmt.Errorf("-token-ttl must be positive")
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		return c, nil, fmt.Errorf("unknown log format %q", c.LogFormat)
+	}
+	if c.InboundRate <= 0 || c.InboundBurst <= 0 || c.FloodLimit <= 0 {
+		return c, nil, fmt.Errorf("inbound rate, burst and flood limit must be positive")
+	}
+	switch c.Store {
+	case "memory":
+	case "sqlite":
+		if c.StoreDSN == "" {
+			c.StoreDSN = "xo.db"
+		}
+	case "redis":
+		if c.StoreDSN == "" {
+			c.StoreDSN = "redis://localhost:6379/0"
+		}
+	default:
+		return c, nil, fmt.Errorf("unknown store %q", c.Store)
+	}
+	switch c.Challenge {
+	case "off", "pow":
+	case "captcha":
+		if c.CaptchaVerifyURL == "" || c.CaptchaSecret == "" {
+			return c, nil, fmt.Errorf("-challenge=captcha requires -captcha-verify-url and -captcha-secret")
+		}
+	default:
+		return c, nil, fmt.Errorf("unknown challenge mode %q", c.Challenge)
+	}
+	return c, fs.Args(), nil
+}
@@ -0,0 +1,192 @@
+// Package discord posts match results to Discord webhooks. Payloads follow
+// Discord's embed schema, including its length limits, and are delivered on
+// a background queue so a slow or failing webhook never holds up a game.
+package discord
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Limits from Discord's embed documentation. Longer values are rejected
+// with 400, so they are truncated instead.
+const (
+	maxTitle       = 256
+	maxDescription = 4096
+	maxFields      = 25
+	maxFieldName   = 256
+	maxFieldValue  = 1024
+	maxFooter      = 2048
+	maxEmbedTotal  = 6000
+)
+
+// Color is the embed's accent, 0xRRGGBB.
+const Color = 0x5865F2
+
+// Payload is the body of a webhook execution.
+type Payload struct {
+	Username string  `json:"username,omitempty"`
+	Content  string  `json:"content,omitempty"`
+	Embeds   []Embed `json:"embeds,omitempty"`
+}
+
+type Embed struct {
+	Title       string     `json:"title,omitempty"`
+	Description string     `json:"description,omitempty"`
+	URL         string     `json:"url,omitempty"`
+	Color       int        `json:"color,omitempty"`
+	Timestamp   *time.Time `json:"timestamp,omitempty"` // Sent as ISO 8601, as Discord expects
+	Fields      []Field    `json:"fields,omitempty"`
+	Footer      *Footer    `json:"footer,omitempty"`
+}
+
+type Field struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type Footer struct {
+	Text string `json:"text"`
+}
+
+// Result is one finished match, as the server knows it.
+type Result struct {
+	GameID   string
+	X, O     string // Player names; empty for anonymous
+	ScoreX   int
+	ScoreO   int
+	Draws    int
+	Rounds   int
+	Duration time.Duration
+	Ended    string    // How the match ended, in words
+	URL      string    // Replay link; empty if the server has no public URL
+	At       time.Time // When it ended
+}
+
+// ResultPayload builds the embed announcing r.
+func ResultPayload(r Result) Payload {
+	title := fmt.Sprintf("%s vs %s", player(r.X, "X"), player(r.O, "O"))
+	desc := fmt.Sprintf("Final score **%d – %d**", r.ScoreX, r.ScoreO)
+	if r.Draws > 0 {
+		desc += fmt.Sprintf(" (%d drawn)", r.Draws)
+	}
+	switch {
+	case r.ScoreX > r.ScoreO:
+		desc += ", " + player(r.X, "X") + " wins"
+	case r.ScoreO > r.ScoreX:
+		desc += ", " + player(r.O, "O") + " wins"
+	default:
+		desc += ", a tie"
+	}
+	at := r.At.UTC()
+	e := Embed{
+		Title:       title,
+		Description: desc,
+		URL:         r.URL,
+		Color:       Color,
+		Timestamp:   &at,
+		Fields: []Field{
+			{Name: "Rounds", Value: fmt.Sprint(r.Rounds), Inline: true},
+			{Name: "Duration", Value: duration(r.Duration), Inline: true},
+			{Name: "Ended", Value: r.Ended, Inline: true},
+		},
+		Footer: &Footer{Text: "Game " + r.GameID},
+	}
+	if r.URL != "" {
+		e.Fields = append(e.Fields, Field{Name: "Replay", Value: r.URL})
+	}
+	return Payload{Username: "Tic-Tac-Toe", Embeds: []Embed{fit(e)}}
+}
+
+// TestPayload is a harmless message for checking a webhook works.
+func TestPayload(at time.Time) Payload {
+	at = at.UTC()
+	return Payload{Username: "Tic-Tac-Toe", Embeds: []Embed{{
+		Title:       "Webhook test",
+		Description: "Match results will be posted here.",
+		Color:       Color,
+		Timestamp:   &at,
+	}}}
+}
+
+func player(name, symbol string) string {
+	if name == "" {
+		return "Player " + symbol
+	}
+	return name + " (" + symbol + ")"
+}
+
+func duration(d time.Duration) string {
+	if d <= 0 {
+		return "unknown"
+	}
+	d = d.Round(time.Second)
+	if d < time.Minute {
+		return d.String()
+	}
+	return d.Round(time.Minute).String()
+}
+
+// fit truncates e to Discord's per-field and total limits. Markdown isn't
+// escaped: names are the players' own and at worst render oddly.
+func fit(e Embed) Embed {
+	e.Title = truncate(e.Title, maxTitle)
+	e.Description = truncate(e.Description, maxDescription)
+	if len(e.Fields) > maxFields {
+		e.Fields = e.Fields[:maxFields]
+	}
+	for i := range e.Fields {
+		e.Fields[i].Name = truncate(e.Fields[i].Name, maxFieldName)
+		e.Fields[i].Value = truncate(e.Fields[i].Value, maxFieldValue)
+	}
+	if e.Footer != nil {
+		e.Footer.Text = truncate(e.Footer.Text, maxFooter)
+	}
+	// Only the description can realistically push the total over
+	if over := size(e) - maxEmbedTotal; over > 0 {
+		e.Description = truncate(e.Description, len([]rune(e.Description))-over)
+	}
+	return e
+}
+
+// size counts the characters Discord includes in the total limit.
+func size(e Embed) int {
+	n := len([]rune(e.Title)) + len([]rune(e.Description))
+	for _, f := range e.Fields {
+		n += len([]rune(f.Name)) + len([]rune(f.Value))
+	}
+	if e.Footer != nil {
+		n += len([]rune(e.Footer.Text))
+	}
+	return n
+}
+
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	if max < 1 {
+		return ""
+	}
+	return string(r[:max-1]) + "…"
+}
+
+// ValidWebhookURL reports whether u is a Discord webhook, the only kind of
+// URL players may attach to a game. Anything else could aim the server's
+// requests at hosts it shouldn't talk to.
+func ValidWebhookURL(u string) bool {
+	p, err := url.Parse(u)
+	if err != nil || p.Scheme != "https" || p.User != nil || p.Port() != "" {
+		return false
+	}
+	switch p.Hostname() {
+	case "discord.com", "discordapp.com", "canary.discord.com", "ptb.discord.com":
+	default:
+		return false
+	}
+	return strings.HasPrefix(p.Path, "/api/webhooks/")
+}
@@ -0,0 +1,120 @@
+package discord
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The payload is Discord's webhook body: one embed with its title,
+// description, colour, ISO 8601 timestamp, inline fields and footer, and
+// nothing Discord doesn't know.
+func TestResultPayloadShape(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 30, 0, 0, time.FixedZone("CET", 3600))
+	p := ResultPayload(Result{
+		GameID: "g1", X: "ann", ScoreX: 2, ScoreO: 1, Draws: 1, Rounds: 4,
+		Duration: 7*time.Minute + 20*time.Second, Ended: "best of 3 decided",
+		URL: "https://xo.example.com/replay/g1", At: at,
+	})
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	json.Unmarshal(b, &got)
+	want := map[string]interface{}{
+		"username": "Tic-Tac-Toe",
+		"embeds": []interface{}{map[string]interface{}{
+			"title":       "ann (X) vs Player O",
+			"description": "Final score **2 – 1** (1 drawn), ann (X) wins",
+			"url":         "https://xo.example.com/replay/g1",
+			"color":       float64(0x5865F2),
+			"timestamp":   "2026-03-01T11:30:00Z",
+			"fields": []interface{}{
+				map[string]interface{}{"name": "Rounds", "value": "4", "inline": true},
+				map[string]interface{}{"name": "Duration", "value": "7m0s", "inline": true},
+				map[string]interface{}{"name": "Ended", "value": "best of 3 decided", "inline": true},
+				map[string]interface{}{"name": "Replay", "value": "https://xo.example.com/replay/g1"},
+			},
+			"footer": map[string]interface{}{"text": "Game g1"},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("payload\n%s\nwant\n%v", b, want)
+	}
+}
+
+func TestResultPayloadWithinLimits(t *testing.T) {
+	long := strings.Repeat("é", 5000)
+	e := ResultPayload(Result{GameID: long, X: long, O: long, Ended: long}).Embeds[0]
+	if n := len([]rune(e.Title)); n > maxTitle {
+		t.Errorf("title of %d characters, over %d", n, maxTitle)
+	}
+	for _, f := range e.Fields {
+		if n := len([]rune(f.Value)); n > maxFieldValue {
+			t.Errorf("field %s of %d characters, over %d", f.Name, n, maxFieldValue)
+		}
+	}
+	if n := size(e); n > maxEmbedTotal {
+		t.Errorf("embed of %d characters, over %d", n, maxEmbedTotal)
+	}
+	if !strings.HasSuffix(e.Title, "…") {
+		t.Errorf("truncated title %q doesn't end in an ellipsis", e.Title)
+	}
+}
+
+func TestValidWebhookURL(t *testing.T) {
+	for u, want := range map[string]bool{
+		"https://discord.com/api/webhooks/1/abc":       true,
+		"https://canary.discord.com/api/webhooks/1/a":  true,
+		"http://discord.com/api/webhooks/1/abc":        false,
+		"https://discord.com:8443/api/webhooks/1/abc":  false,
+		"https://user@discord.com/api/webhooks/1/abc":  false,
+		"https://discord.com/api/channels/1":           false,
+		"https://discord.com.evil.test/api/webhooks/1": false,
+		"https://169.254.169.254/api/webhooks/1":       false,
+	} {
+		if got := ValidWebhookURL(u); got != want {
+			t.Errorf("ValidWebhookURL(%q) = %v, want %v", u, got, want)
+		}
+	}
+}
+
+// Deliver posts the payload as JSON and reads a 429's wait from its body
+// when the header has none.
+func TestDeliver(t *testing.T) {
+	var got Payload
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type %q, want application/json", ct)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+		if status == http.StatusTooManyRequests {
+			w.Write([]byte(`{"retry_after":1.5}`))
+		}
+	}))
+	defer srv.Close()
+	n := &Notifier{client: srv.Client()}
+	p := TestPayload(time.Now())
+
+	if _, err := n.Deliver(srv.URL, p); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if len(got.Embeds) != 1 || got.Embeds[0].Title != p.Embeds[0].Title {
+		t.Errorf("posted %+v, want %+v", got, p)
+	}
+	status = http.StatusTooManyRequests
+	if wait, err := n.Deliver(srv.URL, p); err == nil || wait != 1500*time.Millisecond {
+		t.Errorf("Deliver rate limited = %v, %v; want 1.5s and an error", wait, err)
+	}
+	status = http.StatusBadRequest
+	if wait, err := n.Deliver(srv.URL, p); err == nil || wait >= 0 {
+		t.Errorf("Deliver refused = %v, %v; want a negative wait, as retrying can't help", wait, err)
+	}
+}
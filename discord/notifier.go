@@ -0,0 +1,118 @@
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	queueDepth   = 100
+	maxAttempts  = 5
+	firstBackoff = time.Second
+	maxBackoff   = time.Minute
+)
+
+type delivery struct {
+	url     string
+	payload Payload
+}
+
+// Notifier delivers payloads in the background, one at a time, retrying
+// rate limits, server errors and network failures with exponential backoff.
+// Failures are logged and otherwise dropped.
+type Notifier struct {
+	client *http.Client
+	queue  chan delivery
+}
+
+// NewNotifier starts a notifier's delivery goroutine.
+func NewNotifier(client *http.Client) *Notifier {
+	n := &Notifier{client: client, queue: make(chan delivery, queueDepth)}
+	go n.run()
+	return n
+}
+
+// Post queues p for delivery to url without blocking. When the queue is
+// full the payload is dropped, so a webhook outage can't back up games.
+func (n *Notifier) Post(url string, p Payload) {
+	select {
+	case n.queue <- delivery{url, p}:
+	default:
+		log.Printf("Discord queue full, dropping notification")
+	}
+}
+
+func (n *Notifier) run() {
+	for d := range n.queue {
+		backoff := firstBackoff
+		for attempt := 1; ; attempt++ {
+			wait, err := n.Deliver(d.url, d.payload)
+			if err == nil {
+				break
+			}
+			if wait < 0 || attempt == maxAttempts {
+				log.Printf("Discord notification failed after %d attempts: %v", attempt, err)
+				break
+			}
+			if wait == 0 {
+				wait = backoff
+				backoff *= 2
+			}
+			if wait > maxBackoff {
+				wait = maxBackoff
+			}
+			time.Sleep(wait)
+		}
+	}
+}
+
+// Deliver makes one attempt to post p to url. On failure, wait is how long
+// to back off before retrying: the webhook's own retry_after when rate
+// limited, 0 for the default backoff, or negative when retrying can't help.
+func (n *Notifier) Deliver(url string, p Payload) (wait time.Duration, err error) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return -1, err
+	}
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	reply, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	switch {
+	case resp.StatusCode < 300:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return retryAfter(resp, reply), fmt.Errorf("rate limited")
+	case resp.StatusCode >= 500:
+		return 0, fmt.Errorf("webhook returned %s", resp.Status)
+	default:
+		return -1, fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(reply))
+	}
+}
+
+// retryAfter reads a 429's wait from the Retry-After header or the body's
+// retry_after, both in (possibly fractional) seconds.
+func retryAfter(resp *http.Response, body []byte) time.Duration {
+	secs, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64)
+	if err != nil {
+		var b struct {
+			RetryAfter float64 `json:"retry_after"`
+		}
+		if json.Unmarshal(body, &b) != nil {
+			return 0
+		}
+		secs = b.RetryAfter
+	}
+	if secs <= 0 {
+		return 0
+	}
+	return time.Duration(secs * float64(time.Second))
+}
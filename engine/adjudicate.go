@@ -0,0 +1,72 @@
+package engine
+
+// Adjudication decides a round or series that ran out of time before it
+// was settled, from where it stands rather than from how it might end.
+
+// OpenLines counts, for each symbol on b, the runs of k cells along a row,
+// column or diagonal holding that symbol's marks and otherwise only empty
+// cells: the lines it could still complete. A run with no mark in it yet
+// counts for no one, and one with two symbols in it for neither.
+func OpenLines(b Board, k int) map[string]int {
+	open := make(map[string]int)
+	for r := range b {
+		for c := range b[r] {
+			for _, d := range runDirections {
+				end := Cell{r + d.Row*(k-1), c + d.Col*(k-1)}
+				if !b.InBounds(end.Row, end.Col) {
+					continue
+				}
+				owner, blocked := "", false
+				for i := 0; i < k && !blocked; i++ {
+					mark := b[r+d.Row*i][c+d.Col*i]
+					switch {
+					case mark == "":
+					case owner == "":
+						owner = mark
+					case mark != owner:
+						blocked = true
+					}
+				}
+				if owner != "" && !blocked {
+					open[owner]++
+				}
+			}
+		}
+	}
+	return open
+}
+
+// Leader is the symbol with the highest count, or "" if the highest is
+// shared or there are no counts above zero.
+func Leader(counts map[string]int) string {
+	leader, best, tied := "", 0, false
+	for symbol, n := range counts {
+		switch {
+		case n > best:
+			leader, best, tied = symbol, n, false
+		case n == best && n > 0:
+			tied = true
+		}
+	}
+	if tied {
+		return ""
+	}
+	return leader
+}
+
+// Adjudicate decides an unfinished round on b, won by k in a row: the
+// symbol with more open lines than anyone else wins, and otherwise it is a
+// draw, "". An ultimate board is judged on its meta-board, three in a row.
+// Misère and wild rounds are always drawn, since an open line there is as
+// much a danger as a chance. The optional win conditions play no part.
+func Adjudicate(b Board, k int, conds []WinCondition) string {
+	if IsMisere(conds) || IsWild(conds) {
+		return ""
+	}
+	if !IsUltimate(conds) {
+		return Leader(OpenLines(b, k))
+	}
+	open := OpenLines(MetaBoard(b), subSize)
+	delete(open, "draw") // A drawn sub-board blocks its lines for everyone
+	return Leader(open)
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOpenLines(t *testing.T) {
+	b := board(
+		"X..",
+		".O.",
+		"...",
+	)
+	// The diagonal they share counts for neither: X keeps its row and
+	// column, O its row, column and the other diagonal.
+	if got, want := OpenLines(b, 3), map[string]int{"X": 2, "O": 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("OpenLines = %v, want %v", got, want)
+	}
+	if got := OpenLines(NewBoard(3), 3); len(got) != 0 {
+		t.Errorf("OpenLines on an empty board = %v, want none", got)
+	}
+}
+
+// ultimateOf is an empty ultimate board with the sub-boards in won taken
+// by their symbol's top row, and those in drawn filled without a line.
+func ultimateOf(won map[Cell]string, drawn ...Cell) Board {
+	b := NewBoard(UltimateSize)
+	for s, symbol := range won {
+		for i := 0; i < subSize; i++ {
+			b[s.Row*subSize][s.Col*subSize+i] = symbol
+		}
+	}
+	full := board("XOX", "XOO", "OXX")
+	for _, s := range drawn {
+		for r := 0; r < subSize; r++ {
+			for c := 0; c < subSize; c++ {
+				b[s.Row*subSize+r][s.Col*subSize+c] = full[r][c]
+			}
+		}
+	}
+	return b
+}
+
+func TestAdjudicate(t *testing.T) {
+	lead := board("...", ".X.", "...")
+	tests := []struct {
+		name   string
+		board  Board
+		k      int
+		conds  []WinCondition
+		winner string
+	}{
+		{"empty board", NewBoard(3), 3, nil, ""},
+		{"the centre alone", lead, 3, nil, "X"},
+		{"O in the centre, X in a corner", board("X..", ".O.", "..."), 3, nil, "O"},
+		{"opposite corners", board("X..", "...", "..O"), 3, nil, ""},
+		{"full board", board("XOX", "XOO", "OXX"), 3, nil, ""},
+		{"three in a row on four by four", board("X...", ".O..", "....", "...."), 3, nil, "O"},
+		{"misère", lead, 3, []WinCondition{Lines, Misere}, ""},
+		{"wild", lead, 3, []WinCondition{Lines, Wild}, ""},
+		{"ultimate, level", ultimateOf(map[Cell]string{{0, 0}: "X", {2, 2}: "O"}), 3, []WinCondition{Ultimate}, ""},
+		{"ultimate, a drawn sub-board blocks X", ultimateOf(map[Cell]string{{0, 0}: "X", {2, 2}: "O"}, Cell{0, 1}), 3, []WinCondition{Ultimate}, "O"},
+		{"ultimate, judged on the meta-board", ultimateOf(map[Cell]string{{1, 1}: "X"}), 3, []WinCondition{Ultimate}, "X"},
+	}
+	for _, tt := range tests {
+		if got := Adjudicate(tt.board, tt.k, tt.conds); got != tt.winner {
+			t.Errorf("%s: Adjudicate = %q, want %q", tt.name, got, tt.winner)
+		}
+	}
+}
+
+func TestLeader(t *testing.T) {
+	tests := []struct {
+		counts map[string]int
+		want   string
+	}{
+		{nil, ""},
+		{map[string]int{"X": 0, "O": 0}, ""},
+		{map[string]int{"X": 2, "O": 1}, "X"},
+		{map[string]int{"X": 2, "O": 2}, ""},
+		{map[string]int{"X": 1, "O": 3, "draw": 3}, ""},
+	}
+	for _, tt := range tests {
+		if got := Leader(tt.counts); got != tt.want {
+			t.Errorf("Leader(%v) = %q, want %q", tt.counts, got, tt.want)
+		}
+	}
+}
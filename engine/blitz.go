@@ -0,0 +1,40 @@
+package engine
+
+// Blitz tic-tac-toe keeps only each player's last BlitzMarks marks on the
+// board: marking a fourth clears the oldest of theirs first, so the board
+// never fills and a round can't be drawn. The mark cleared is gone before
+// the new one is judged, so a line it was part of no longer counts. It is
+// won by three in a row and, like misère and wild, carried in a game's
+// conditions as a marker alongside Lines.
+
+const (
+	BlitzName  = "blitz"
+	BlitzMarks = 3
+)
+
+var Blitz = WinCondition{Name: BlitzName, Check: noPattern}
+
+// IsBlitz reports whether conds play blitz.
+func IsBlitz(conds []WinCondition) bool {
+	return hasCondition(conds, BlitzName)
+}
+
+// Fading is the cell of placed, a player's marks this round in the order
+// they made them, that their next mark clears under conds, or false if it
+// clears none.
+func Fading(placed []Cell, conds []WinCondition) (Cell, bool) {
+	if !IsBlitz(conds) || len(placed) < BlitzMarks {
+		return Cell{}, false
+	}
+	return placed[len(placed)-BlitzMarks], true
+}
+
+// Fade clears from b the mark Fading names, ahead of the player's next one,
+// and returns it.
+func Fade(b Board, placed []Cell, conds []WinCondition) (Cell, bool) {
+	c, ok := Fading(placed, conds)
+	if ok {
+		b[c.Row][c.Col] = ""
+	}
+	return c, ok
+}
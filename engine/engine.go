@@ -0,0 +1,355 @@
+// Package engine implements the tic-tac-toe rules with no I/O, so every
+// front end (websocket server, terminal modes, tooling) plays the same game.
+package engine
+
+import "errors"
+
+// Boards are square, DefaultSize on a side unless a game chooses another
+// size from MinSize to MaxSize.
+const (
+	DefaultSize = 3
+	MinSize     = 3
+	MaxSize     = 10
+)
+
+// Board holds "", "X" or "O" per cell, indexed [row][col], or Third in a
+// three-player game.
+type Board [][]string
+
+// NewBoard returns an empty n×n board.
+func NewBoard(n int) Board {
+	b := make(Board, n)
+	for r := range b {
+		b[r] = make([]string, n)
+	}
+	return b
+}
+
+// Size is the number of rows (and columns).
+func (b Board) Size() int {
+	return len(b)
+}
+
+// InBounds reports whether (row, col) is on the board.
+func (b Board) InBounds(row, col int) bool {
+	return row >= 0 && row < len(b) && col >= 0 && col < len(b)
+}
+
+// Clone returns a copy that later moves on b don't touch.
+func (b Board) Clone() Board {
+	out := make(Board, len(b))
+	for r := range b {
+		out[r] = append([]string(nil), b[r]...)
+	}
+	return out
+}
+
+// Equal reports whether b and o are the same size with the same marks.
+func (b Board) Equal(o Board) bool {
+	if len(b) != len(o) {
+		return false
+	}
+	for r := range b {
+		if len(b[r]) != len(o[r]) {
+			return false
+		}
+		for c := range b[r] {
+			if b[r][c] != o[r][c] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ValidSize reports whether a game may be played on an n×n board.
+func ValidSize(n int) bool {
+	return n >= MinSize && n <= MaxSize
+}
+
+// ValidWinLength reports whether k in a row can win on an n×n board.
+func ValidWinLength(n, k int) bool {
+	return k >= MinSize && k <= n
+}
+
+var (
+	ErrOutOfBounds  = errors.New("out_of_bounds")
+	ErrCellOccupied = errors.New("cell_occupied")
+	ErrNotYourTurn  = errors.New("not_your_turn")
+	ErrRoundOver    = errors.New("round_over")
+)
+
+// Other returns the opponent of symbol.
+func Other(symbol string) string {
+	if symbol == "X" {
+		return "O"
+	}
+	return "X"
+}
+
+// Third is the symbol of the third player in a three-player game, who
+// moves after O.
+const Third = "Δ"
+
+// Symbols lists the symbols of an n-player game in turn order: X and O, and
+// Third when n is 3.
+func Symbols(n int) []string {
+	if n == 3 {
+		return []string{"X", "O", Third}
+	}
+	return []string{"X", "O"}
+}
+
+// IsSymbol reports whether s is a player's symbol in an n-player game.
+func IsSymbol(s string, n int) bool {
+	for _, symbol := range Symbols(n) {
+		if s == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns who moves after symbol in an n-player game. With two players
+// it is Other.
+func Next(symbol string, n int) string {
+	symbols := Symbols(n)
+	for i, s := range symbols {
+		if s == symbol {
+			return symbols[(i+1)%len(symbols)]
+		}
+	}
+	return symbols[0]
+}
+
+func CheckWin(board Board, player string) bool {
+	for r := range board {
+		for c := range board[r] {
+			if board[r][c] == player && checkLines(board, Cell{r, c}) != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func CheckDraw(board Board) bool {
+	for _, row := range board {
+		for _, cell := range row {
+			if cell == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+type Outcome int
+
+const (
+	Continue Outcome = iota // Round goes on with the other player to move
+	Won                     // Mover completed a line; see Victor for whose round it is
+	Drawn                   // Board filled with no winner
+)
+
+type Score struct {
+	X, O  int
+	Third int // Rounds won by Third in a three-player match
+	Draws int
+}
+
+// Add counts a round won by symbol.
+func (s *Score) Add(symbol string) {
+	switch symbol {
+	case "X":
+		s.X++
+	case "O":
+		s.O++
+	case Third:
+		s.Third++
+	}
+}
+
+// Match is a series of rounds between X and O with a running score, or
+// with Third too when Players is 3. Round 1 starts with StartingPlayer, X
+// unless set otherwise, and StarterPolicy picks who starts each round
+// after that.
+type Match struct {
+	Board          Board
+	CurrentPlayer  string
+	StartingPlayer string
+	Score          Score
+	Over           bool // Current round has been won or drawn
+
+	Conditions []WinCondition // Ways to win; nil for the standard lines only
+	Win        Win            // How the current round was won, once Over by a win
+	Winner     string         // Who the current round's win counts for, once Over by a win; "" for a draw
+
+	Last    *Cell // The current round's latest mark, which ultimate's next move depends on
+	Removed *Cell // Blitz only: the mark the latest move faded out, if it did
+
+	Placed map[string][]Cell // Blitz only: each player's marks this round, oldest first
+
+	Players int // 3 for a three-player match; 0 or 2 for X and O
+
+	StarterPolicy string // One of the Starter policies; "" alternates
+}
+
+func NewMatch() *Match {
+	return NewMatchSize(DefaultSize)
+}
+
+// NewUltimateMatch is NewMatch under ultimate's rules.
+func NewUltimateMatch() *Match {
+	m := NewMatchSize(UltimateSize)
+	m.Conditions = []WinCondition{Ultimate}
+	return m
+}
+
+// NewMatchSize is NewMatch on an n×n board.
+func NewMatchSize(n int) *Match {
+	return &Match{Board: NewBoard(n), CurrentPlayer: "X", StartingPlayer: "X"}
+}
+
+// Move places symbol at (row, col), updating the turn, round state and score.
+func (m *Match) Move(symbol string, row, col int) (Outcome, error) {
+	return m.Play(symbol, "", row, col)
+}
+
+// MoveError is why symbol may not mark (row, col) now, or nil if it may:
+// ErrRoundOver, ErrNotYourTurn, ErrOutOfBounds, ErrCellOccupied or, under
+// ultimate, the sub-board the move must be played in. It checks what Play
+// does before the mark itself, which MarkFor checks.
+func (m *Match) MoveError(symbol string, row, col int) error {
+	switch {
+	case m.Over:
+		return ErrRoundOver
+	case symbol != m.CurrentPlayer:
+		return ErrNotYourTurn
+	case !m.Board.InBounds(row, col):
+		return ErrOutOfBounds
+	case m.Board[row][col] != "":
+		return ErrCellOccupied
+	}
+	if IsUltimate(m.Conditions) {
+		return UltimateMoveError(m.Board, m.Last, row, col)
+	}
+	return nil
+}
+
+// Play is Move with the player marking mark, as wild allows; "" is their
+// own symbol.
+func (m *Match) Play(symbol, mark string, row, col int) (Outcome, error) {
+	if err := m.MoveError(symbol, row, col); err != nil {
+		return Continue, err
+	}
+	mark, err := MarkFor(symbol, mark, m.Conditions)
+	if err != nil {
+		return Continue, err
+	}
+
+	m.Last = &Cell{row, col}
+	m.Removed = nil
+	if IsBlitz(m.Conditions) {
+		if c, ok := Fade(m.Board, m.Placed[symbol], m.Conditions); ok {
+			m.Removed = &c
+		}
+		if m.Placed == nil {
+			m.Placed = make(map[string][]Cell)
+		}
+		m.Placed[symbol] = append(m.Placed[symbol], Cell{row, col})
+	}
+	outcome, win := Place(m.Board, mark, row, col, m.Conditions)
+	switch outcome {
+	case Won:
+		m.Over = true
+		m.Win = win
+		m.Winner = Victor(symbol, mark, m.Conditions)
+		m.Score.Add(m.Winner)
+	case Drawn:
+		m.Over = true
+		m.Score.Draws++
+	default:
+		m.CurrentPlayer = Next(symbol, m.Players)
+	}
+	return outcome, nil
+}
+
+// Place marks symbol at (row, col) and judges the result under conds: Won
+// with how, Drawn, or Continue. It is the rule Match.Move and the server
+// both play by, and checks nothing about whose turn it is, whether the cell
+// is free or, for ultimate, which sub-board is due; callers validate the
+// move first.
+func Place(b Board, symbol string, row, col int, conds []WinCondition) (Outcome, Win) {
+	b[row][col] = symbol
+	if win, ok := FindWin(b, Cell{row, col}, conds); ok {
+		return Won, win
+	}
+	if RoundDrawn(b, conds) {
+		return Drawn, Win{}
+	}
+	return Continue, Win{}
+}
+
+// Award ends the round off the board, as running out of time, conceding
+// or adjudication do: the round counts for winner, or as a draw for "".
+func (m *Match) Award(winner string) {
+	m.Over = true
+	m.Winner = winner
+	if winner == "" {
+		m.Score.Draws++
+	} else {
+		m.Score.Add(winner)
+	}
+}
+
+// Pass hands the turn to the opponent without a mark, for a player who ran
+// out of time.
+func (m *Match) Pass(symbol string) error {
+	switch {
+	case m.Over:
+		return ErrRoundOver
+	case symbol != m.CurrentPlayer:
+		return ErrNotYourTurn
+	}
+	m.CurrentPlayer = Next(symbol, m.Players)
+	return nil
+}
+
+// Starter policies: who starts the round after one that has ended.
+const (
+	StarterAlternate = "alternate" // The player after last round's starter
+	StarterLoser     = "loser_starts"
+	StarterWinner    = "winner_starts"
+	StarterAlwaysX   = "always_x"
+)
+
+// NextStarter is who starts the round after one started by starter that
+// result, a symbol or "" for a draw, won. After a draw, loser_starts and
+// winner_starts alternate instead, and so does an unknown policy.
+func NextStarter(policy, starter, result string, players int) string {
+	won := IsSymbol(result, players)
+	switch {
+	case policy == StarterAlwaysX:
+		return "X"
+	case policy == StarterLoser && won:
+		return Next(result, players)
+	case policy == StarterWinner && won:
+		return result
+	}
+	return Next(starter, players)
+}
+
+// NextRound clears the board and hands the first move to the next starter
+// under StarterPolicy.
+func (m *Match) NextRound() {
+	m.StartingPlayer = NextStarter(m.StarterPolicy, m.StartingPlayer, m.Winner, m.Players)
+	m.Board = NewBoard(m.Board.Size())
+	m.CurrentPlayer = m.StartingPlayer
+	m.Over = false
+	m.Win = Win{}
+	m.Winner = ""
+	m.Last = nil
+	m.Removed = nil
+	m.Placed = nil
+}
@@ -0,0 +1,256 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+// play has whoever is on turn mark each cell in order, failing the test on
+// a rejected move, and returns the last outcome.
+func play(t *testing.T, m *Match, cells ...Cell) Outcome {
+	t.Helper()
+	var outcome Outcome
+	for _, c := range cells {
+		var err error
+		if outcome, err = m.Move(m.CurrentPlayer, c.Row, c.Col); err != nil {
+			t.Fatalf("%s at %v: %v", m.CurrentPlayer, c, err)
+		}
+	}
+	return outcome
+}
+
+func TestMoveRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  []Cell // Played first, alternating from X
+		symbol string
+		cell   Cell
+		want   error
+	}{
+		{"out of turn at the start", nil, "O", Cell{0, 0}, ErrNotYourTurn},
+		{"out of turn after a move", []Cell{{0, 0}}, "X", Cell{1, 1}, ErrNotYourTurn},
+		{"occupied by the opponent", []Cell{{1, 1}}, "O", Cell{1, 1}, ErrCellOccupied},
+		{"occupied by the mover", []Cell{{1, 1}, {0, 0}}, "X", Cell{1, 1}, ErrCellOccupied},
+		{"negative row", nil, "X", Cell{-1, 0}, ErrOutOfBounds},
+		{"column off the board", nil, "X", Cell{0, 3}, ErrOutOfBounds},
+		{"after a win", []Cell{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {0, 2}}, "O", Cell{2, 2}, ErrRoundOver},
+		{"after a draw", []Cell{{0, 0}, {0, 1}, {0, 2}, {1, 1}, {1, 0}, {1, 2}, {2, 1}, {2, 0}, {2, 2}}, "O", Cell{0, 0}, ErrRoundOver},
+		{"a symbol not in the match", nil, "Q", Cell{0, 0}, ErrNotYourTurn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMatch()
+			play(t, m, tt.setup...)
+			before, turn, score := m.Board.Clone(), m.CurrentPlayer, m.Score
+
+			if err := m.MoveError(tt.symbol, tt.cell.Row, tt.cell.Col); !errors.Is(err, tt.want) {
+				t.Errorf("MoveError = %v, want %v", err, tt.want)
+			}
+			outcome, err := m.Move(tt.symbol, tt.cell.Row, tt.cell.Col)
+			if !errors.Is(err, tt.want) || outcome != Continue {
+				t.Errorf("Move = %v, %v; want Continue, %v", outcome, err, tt.want)
+			}
+			if !m.Board.Equal(before) || m.CurrentPlayer != turn || m.Score != score {
+				t.Error("a rejected move changed the match")
+			}
+		})
+	}
+}
+
+func TestRoundEnd(t *testing.T) {
+	tests := []struct {
+		name   string
+		moves  []Cell
+		want   Outcome
+		winner string
+		score  Score
+		line   []Cell
+	}{
+		{"a win with the last free cell is a win, not a draw",
+			// X O O / O X X / O X X, the ninth mark completing the diagonal
+			[]Cell{{0, 0}, {0, 2}, {1, 1}, {0, 1}, {2, 1}, {1, 0}, {1, 2}, {2, 0}, {2, 2}},
+			Won, "X", Score{X: 1}, []Cell{{0, 0}, {1, 1}, {2, 2}}},
+		{"draw on a full board", []Cell{{1, 1}, {0, 0}, {0, 2}, {2, 0}, {1, 0}, {1, 2}, {0, 1}, {2, 1}, {2, 2}},
+			Drawn, "", Score{Draws: 1}, nil},
+		{"early win for O", []Cell{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {2, 2}, {1, 2}},
+			Won, "O", Score{O: 1}, []Cell{{1, 0}, {1, 1}, {1, 2}}},
+		{"not over yet", []Cell{{0, 0}, {1, 1}}, Continue, "", Score{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMatch()
+			got := play(t, m, tt.moves...)
+			if got != tt.want {
+				t.Fatalf("outcome = %v, want %v", got, tt.want)
+			}
+			if m.Over != (tt.want != Continue) {
+				t.Errorf("Over = %v", m.Over)
+			}
+			if m.Winner != tt.winner || m.Score != tt.score {
+				t.Errorf("Winner %q, Score %+v; want %q, %+v", m.Winner, m.Score, tt.winner, tt.score)
+			}
+			if tt.line != nil && (m.Win.Condition != Lines.Name || !cellsEqual(m.Win.Cells, tt.line)) {
+				t.Errorf("Win = %+v, want the line %v", m.Win, tt.line)
+			}
+		})
+	}
+}
+
+func cellsEqual(a, b []Cell) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTurnsAlternate(t *testing.T) {
+	m := NewMatch()
+	for i, c := range []Cell{{0, 0}, {1, 1}, {2, 2}, {0, 2}} {
+		want := []string{"X", "O"}[i%2]
+		if m.CurrentPlayer != want {
+			t.Fatalf("move %d: %s on turn, want %s", i+1, m.CurrentPlayer, want)
+		}
+		play(t, m, c)
+	}
+
+	three := NewMatchSize(4)
+	three.Players = 3
+	for i, c := range []Cell{{0, 0}, {0, 1}, {0, 2}, {1, 0}, {1, 1}, {1, 2}} {
+		want := Symbols(3)[i%3]
+		if three.CurrentPlayer != want {
+			t.Fatalf("three players, move %d: %s on turn, want %s", i+1, three.CurrentPlayer, want)
+		}
+		play(t, three, c)
+	}
+}
+
+func TestPass(t *testing.T) {
+	m := NewMatch()
+	if err := m.Pass("O"); !errors.Is(err, ErrNotYourTurn) {
+		t.Errorf("Pass out of turn = %v, want ErrNotYourTurn", err)
+	}
+	if err := m.Pass("X"); err != nil || m.CurrentPlayer != "O" {
+		t.Errorf("Pass(X) = %v with %s on turn; want O", err, m.CurrentPlayer)
+	}
+	m.Award("O")
+	if err := m.Pass("O"); !errors.Is(err, ErrRoundOver) {
+		t.Errorf("Pass after the round = %v, want ErrRoundOver", err)
+	}
+}
+
+func TestAward(t *testing.T) {
+	m := NewMatch()
+	m.Award("O")
+	m.NextRound()
+	m.Award("")
+	if !m.Over || m.Score != (Score{O: 1, Draws: 1}) {
+		t.Errorf("after Award(O) and Award(\"\"): Over %v, Score %+v", m.Over, m.Score)
+	}
+}
+
+// alternationRounds is enough rounds for any pattern to show.
+const alternationRounds = 20
+
+func TestNextRoundAlternates(t *testing.T) {
+	for _, players := range []int{2, 3} {
+		m := NewMatch()
+		m.Players = players
+		symbols := Symbols(players)
+		for round := 0; round < alternationRounds; round++ {
+			want := symbols[round%len(symbols)]
+			if m.StartingPlayer != want || m.CurrentPlayer != want {
+				t.Fatalf("%d players, round %d: %s starts with %s on turn, want %s", players, round+1, m.StartingPlayer, m.CurrentPlayer, want)
+			}
+			// The starter wins every other round and draws the rest, which
+			// alternation doesn't care about.
+			if round%2 == 0 {
+				m.Award(m.StartingPlayer)
+			} else {
+				m.Award("")
+			}
+			m.NextRound()
+			if m.Over || m.Winner != "" || m.Last != nil || !m.Board.Equal(NewBoard(DefaultSize)) {
+				t.Fatalf("round %d didn't start fresh", round+2)
+			}
+		}
+	}
+}
+
+func TestNextRoundPolicies(t *testing.T) {
+	tests := []struct {
+		policy  string
+		results []string // Who wins each round, "" for a draw
+		want    []string // Who starts rounds 2 on
+	}{
+		{StarterAlternate, []string{"X", "X", "O", ""}, []string{"O", "X", "O", "X"}},
+		{StarterLoser, []string{"X", "X", "O", ""}, []string{"O", "O", "X", "O"}},
+		{StarterWinner, []string{"O", "O", "X", "", ""}, []string{"O", "O", "X", "O", "X"}},
+		{StarterAlwaysX, []string{"O", "", "X"}, []string{"X", "X", "X"}},
+		{"unknown", []string{"X", "O"}, []string{"O", "X"}},
+	}
+	for _, tt := range tests {
+		m := NewMatch()
+		m.StarterPolicy = tt.policy
+		for i, winner := range tt.results {
+			m.Award(winner)
+			m.NextRound()
+			if m.StartingPlayer != tt.want[i] {
+				t.Errorf("%s: round %d starts with %s, want %s", tt.policy, i+2, m.StartingPlayer, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestNextStarter(t *testing.T) {
+	tests := []struct {
+		policy, starter, result string
+		players                 int
+		want                    string
+	}{
+		{StarterAlternate, "X", "X", 2, "O"},
+		{StarterAlternate, "O", "", 2, "X"},
+		{StarterAlternate, Third, "O", 3, "X"},
+		{StarterLoser, "X", "X", 2, "O"},
+		{StarterLoser, "X", "O", 2, "X"},
+		{StarterLoser, "X", "", 2, "O"},
+		{StarterLoser, "X", "O", 3, Third},
+		{StarterWinner, "X", "O", 2, "O"},
+		{StarterWinner, "O", "", 2, "X"},
+		{StarterAlwaysX, "X", "X", 2, "X"},
+		{StarterAlwaysX, "O", "", 3, "X"},
+		{"", "X", "X", 2, "O"},
+	}
+	for _, tt := range tests {
+		if got := NextStarter(tt.policy, tt.starter, tt.result, tt.players); got != tt.want {
+			t.Errorf("NextStarter(%q, %s, %q, %d) = %s, want %s", tt.policy, tt.starter, tt.result, tt.players, got, tt.want)
+		}
+	}
+}
+
+func TestScoreOverManyRounds(t *testing.T) {
+	m := NewMatch()
+	xWins := []Cell{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {0, 2}}
+	draw := []Cell{{1, 1}, {0, 0}, {0, 2}, {2, 0}, {1, 0}, {1, 2}, {0, 1}, {2, 1}, {2, 2}}
+	var want Score
+	for round := 0; round < alternationRounds; round++ {
+		if round%3 == 2 {
+			play(t, m, draw...)
+			want.Draws++
+		} else {
+			play(t, m, xWins...)
+			want.Add(m.Winner) // Whoever started and so played the top row
+		}
+		m.NextRound()
+	}
+	if m.Score != want {
+		t.Errorf("Score = %+v, want %+v", m.Score, want)
+	}
+	if m.Score.X == 0 || m.Score.O == 0 {
+		t.Errorf("Score = %+v: with alternating starters both should have won", m.Score)
+	}
+}
@@ -0,0 +1,46 @@
+package engine
+
+// LegalMoves lists the cells the player on turn may mark on b, in
+// row-major order, given the mark at last (nil before the first) and the
+// round's conditions: every free cell, narrowed to the sub-board due next
+// in ultimate. It doesn't know whether the round is over; callers that
+// haven't checked get the free cells of a finished board.
+func LegalMoves(b Board, last *Cell, conds []WinCondition) []Cell {
+	ultimate := IsUltimate(conds)
+	var cells []Cell
+	for r := range b {
+		for c := range b[r] {
+			if b[r][c] != "" || (ultimate && UltimateMoveError(b, last, r, c) != nil) {
+				continue
+			}
+			cells = append(cells, Cell{r, c})
+		}
+	}
+	return cells
+}
+
+// Hint suggests one of cells on an n×n board: a centre cell if there is
+// one free (the middle one, or one of the middle four on an even board),
+// then a corner, then an edge or any other cell, taking the first of its
+// kind in cells. It reports false when cells is empty.
+func Hint(cells []Cell, n int) (Cell, bool) {
+	best, bestRank := Cell{}, -1
+	for _, c := range cells {
+		rank := 2
+		switch {
+		case centre(c.Row, n) && centre(c.Col, n):
+			rank = 0
+		case (c.Row == 0 || c.Row == n-1) && (c.Col == 0 || c.Col == n-1):
+			rank = 1
+		}
+		if bestRank < 0 || rank < bestRank {
+			best, bestRank = c, rank
+		}
+	}
+	return best, bestRank >= 0
+}
+
+// centre reports whether i is a middle row or column of n.
+func centre(i, n int) bool {
+	return i == n/2 || (n%2 == 0 && i == n/2-1)
+}
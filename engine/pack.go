@@ -0,0 +1,47 @@
+package engine
+
+import "errors"
+
+var ErrBadPacking = errors.New("bad_board_packing")
+
+// PackedLen is the length of a packed n×n board: 2 bits per cell.
+func PackedLen(n int) int {
+	return (n*n + 3) / 4
+}
+
+var cellCodes = map[string]byte{"": 0, "X": 1, "O": 2, Third: 3}
+
+// Pack encodes the board in row-major order, 2 bits per cell (0 empty,
+// 1 X, 2 O, 3 Third), four cells to a byte starting from the low bits.
+func Pack(board Board) []byte {
+	n := board.Size()
+	out := make([]byte, PackedLen(n))
+	for i := 0; i < n*n; i++ {
+		out[i/4] |= cellCodes[board[i/n][i%n]] << (2 * (i % 4))
+	}
+	return out
+}
+
+// Unpack reverses Pack for an n×n board. It rejects the wrong length and
+// stray bits past the last cell, so every board has exactly one packing.
+func Unpack(b []byte, n int) (Board, error) {
+	if len(b) != PackedLen(n) {
+		return nil, ErrBadPacking
+	}
+	board := NewBoard(n)
+	for i := 0; i < len(b)*4; i++ {
+		code := b[i/4] >> (2 * (i % 4)) & 3
+		switch {
+		case i >= n*n && code != 0:
+			return nil, ErrBadPacking
+		case i >= n*n:
+		case code == 1:
+			board[i/n][i%n] = "X"
+		case code == 2:
+			board[i/n][i%n] = "O"
+		case code == 3:
+			board[i/n][i%n] = Third
+		}
+	}
+	return board, nil
+}
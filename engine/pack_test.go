@@ -0,0 +1,43 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Every board of every size survives a round trip through Pack, and every
+// packing Unpack accepts is the one Pack makes of the board it reads. data
+// is taken two bits a cell as the canonical board's marks.
+func FuzzPackUnpack(f *testing.F) {
+	for n := MinSize; n <= MaxSize; n++ {
+		f.Add(uint8(n), make([]byte, PackedLen(n)))
+		f.Add(uint8(n), bytes.Repeat([]byte{0xe4}, PackedLen(n))) // Every mark in turn
+	}
+	f.Add(uint8(3), []byte{0xff, 0xff, 0xff}) // Stray bits past the last cell
+	f.Fuzz(func(t *testing.T, size uint8, data []byte) {
+		n := int(size)
+		if !ValidSize(n) {
+			return
+		}
+		marks := []string{"", "X", "O", Third}
+		b := NewBoard(n)
+		for i := 0; i < n*n && i/4 < len(data); i++ {
+			b[i/n][i%n] = marks[data[i/4]>>(2*(i%4))&3]
+		}
+		packed := Pack(b)
+		if len(packed) != PackedLen(n) {
+			t.Fatalf("Pack of a %d×%d board is %d bytes, want %d", n, n, len(packed), PackedLen(n))
+		}
+		got, err := Unpack(packed, n)
+		if err != nil {
+			t.Fatalf("Unpack(Pack(%v)): %v", b, err)
+		}
+		if !got.Equal(b) {
+			t.Fatalf("round trip gave %v, want %v", got, b)
+		}
+
+		if board, err := Unpack(data, n); err == nil && !bytes.Equal(Pack(board), data) {
+			t.Fatalf("Unpack accepted %x, which Pack makes %x", data, Pack(board))
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package engine
+
+import "errors"
+
+// Ultimate tic-tac-toe plays on a 9×9 board read as a 3×3 grid of 3×3
+// sub-boards. The cell a move takes within its sub-board names the
+// sub-board the opponent must play in next, unless that one is already
+// decided (won or full), in which case they may play in any open one.
+// Winning a sub-board claims its square on the meta-board, and three
+// squares in a line there win the round.
+//
+// The variant is a rule set in its own right rather than an optional
+// condition: Ultimate replaces Lines in a game's conditions, and games,
+// records and replays carry it by name like any other condition.
+
+const (
+	Classic      = "classic"
+	UltimateName = "ultimate"
+	UltimateSize = 9
+	subSize      = 3
+)
+
+var (
+	ErrWrongSubBoard   = errors.New("wrong_sub_board")
+	ErrSubBoardDecided = errors.New("sub_board_decided")
+)
+
+// Ultimate wins a round with three sub-boards in a line on the meta-board.
+// Its cells are the winning line of each of those sub-boards.
+var Ultimate = WinCondition{Name: UltimateName, Check: checkUltimate}
+
+// IsUltimate reports whether conds are ultimate's.
+func IsUltimate(conds []WinCondition) bool {
+	return len(conds) == 1 && conds[0].Name == UltimateName
+}
+
+// Variant names the rules conds make up: UltimateName, MisereName,
+// WildName, BlitzName or Classic.
+func Variant(conds []WinCondition) string {
+	switch {
+	case IsUltimate(conds):
+		return UltimateName
+	case IsMisere(conds):
+		return MisereName
+	case IsWild(conds):
+		return WildName
+	case IsBlitz(conds):
+		return BlitzName
+	}
+	return Classic
+}
+
+// SubBoardOf is the [row, col] of the sub-board holding c on the meta-board.
+func SubBoardOf(c Cell) Cell {
+	return Cell{c.Row / subSize, c.Col / subSize}
+}
+
+// subBoard copies sub-board s of b out as a 3×3 board of its own.
+func subBoard(b Board, s Cell) Board {
+	out := NewBoard(subSize)
+	for r := range out {
+		for c := range out[r] {
+			out[r][c] = b[s.Row*subSize+r][s.Col*subSize+c]
+		}
+	}
+	return out
+}
+
+// SubBoardResult is sub-board s's state: "X" or "O" once won, "draw" once
+// full without a line, or "" while open.
+func SubBoardResult(b Board, s Cell) string {
+	sub := subBoard(b, s)
+	if winner, _, ok := Winner(sub, nil); ok {
+		return winner
+	}
+	if CheckDraw(sub) {
+		return "draw"
+	}
+	return ""
+}
+
+// MetaBoard is the 3×3 board of every sub-board's SubBoardResult.
+func MetaBoard(b Board) Board {
+	meta := NewBoard(subSize)
+	for r := range meta {
+		for c := range meta[r] {
+			meta[r][c] = SubBoardResult(b, Cell{r, c})
+		}
+	}
+	return meta
+}
+
+// NextSubBoard is the sub-board the move after last must be played in. It
+// reports false when any open sub-board will do: at the start of a round,
+// or when last sent the opponent to one already decided.
+func NextSubBoard(b Board, last *Cell) (Cell, bool) {
+	if last == nil {
+		return Cell{}, false
+	}
+	target := Cell{last.Row % subSize, last.Col % subSize}
+	if SubBoardResult(b, target) != "" {
+		return Cell{}, false
+	}
+	return target, true
+}
+
+// UltimateMoveError reports why (row, col) can't be played after last
+// under ultimate's placement rule, or nil if it can. It doesn't check
+// bounds, turn or whether the cell itself is free.
+func UltimateMoveError(b Board, last *Cell, row, col int) error {
+	s := SubBoardOf(Cell{row, col})
+	if next, forced := NextSubBoard(b, last); forced && s != next {
+		return ErrWrongSubBoard
+	}
+	if SubBoardResult(b, s) != "" {
+		return ErrSubBoardDecided
+	}
+	return nil
+}
+
+// checkUltimate wins when the last move took its sub-board and that square
+// completes a line on the meta-board.
+func checkUltimate(b Board, last Cell) []Cell {
+	if b.Size() != UltimateSize {
+		return nil
+	}
+	s := SubBoardOf(last)
+	meta := MetaBoard(b)
+	if meta[s.Row][s.Col] != b[last.Row][last.Col] {
+		return nil
+	}
+	line := checkLines(meta, s)
+	if line == nil {
+		return nil
+	}
+	var cells []Cell
+	for _, sq := range line {
+		_, win, _ := Winner(subBoard(b, sq), nil)
+		for _, c := range win.Cells {
+			cells = append(cells, Cell{sq.Row*subSize + c.Row, sq.Col*subSize + c.Col})
+		}
+	}
+	return cells
+}
+
+// RoundDrawn reports whether a round played under conds is over without a
+// winner, once no move is left: a full board, or for ultimate, every
+// sub-board decided. Callers check for a win first.
+func RoundDrawn(b Board, conds []WinCondition) bool {
+	if !IsUltimate(conds) {
+		return CheckDraw(b)
+	}
+	for _, row := range MetaBoard(b) {
+		for _, square := range row {
+			if square == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
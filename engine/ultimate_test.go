@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+// wonTopLeft is an ultimate board with X holding the top-left sub-board's
+// top row and O two cells elsewhere.
+var wonTopLeft = []string{
+	"XXX......",
+	".........",
+	".........",
+	"...O.....",
+	".........",
+	"......O..",
+	".........",
+	".........",
+	".........",
+}
+
+func TestUltimatePlacement(t *testing.T) {
+	b := board(wonTopLeft...)
+	tests := []struct {
+		name     string
+		last     *Cell
+		row, col int
+		want     error
+	}{
+		{"any sub-board at the start", nil, 4, 4, nil},
+		{"sent to the top middle, plays there", &Cell{0, 4}, 1, 4, nil},
+		{"sent to the top middle, plays elsewhere", &Cell{0, 4}, 6, 6, ErrWrongSubBoard},
+		{"sent to a won board, plays an open one", &Cell{3, 3}, 8, 8, nil},
+		{"sent to a won board, plays in it", &Cell{3, 3}, 1, 1, ErrSubBoardDecided},
+		{"free choice doesn't reopen a won board", nil, 2, 2, ErrSubBoardDecided},
+	}
+	for _, tt := range tests {
+		if err := UltimateMoveError(b, tt.last, tt.row, tt.col); !errors.Is(err, tt.want) {
+			t.Errorf("%s: UltimateMoveError = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if _, forced := NextSubBoard(b, &Cell{3, 3}); forced {
+		t.Error("NextSubBoard forced a move into a won sub-board")
+	}
+	if s, forced := NextSubBoard(b, &Cell{5, 6}); !forced || s != (Cell{2, 0}) {
+		t.Errorf("NextSubBoard after (5, 6) = %v, %v; want the bottom-left, forced", s, forced)
+	}
+}
+
+// Three sub-boards in a line on the meta-board win the round, with each
+// one's winning line as the win's cells.
+func TestUltimateWin(t *testing.T) {
+	b := board(
+		"XXX.O.XXX",
+		"O..O...O.",
+		"..O.O....",
+		"...O.....",
+		".........",
+		".........",
+		".........",
+		".........",
+		"......XXX",
+	)
+	b[0][3], b[0][4], b[0][5] = "", "", ""
+	outcome, win := Place(b, "X", 0, 3, []WinCondition{Ultimate})
+	if outcome != Continue {
+		t.Fatalf("one cell of the middle sub-board: %v, want the round to go on", outcome)
+	}
+	b[0][4] = "X"
+	outcome, win = Place(b, "X", 0, 5, []WinCondition{Ultimate})
+	if outcome != Won || win.Condition != UltimateName || len(win.Cells) != 9 {
+		t.Fatalf("top row of sub-boards: %v %+v, want Won with nine cells", outcome, win)
+	}
+	meta := MetaBoard(b)
+	if meta[0][0] != "X" || meta[0][1] != "X" || meta[0][2] != "X" || meta[2][2] != "X" {
+		t.Errorf("meta-board %v, want X across the top and in the corner", meta)
+	}
+}
+
+// A round is drawn once every sub-board is decided without a line on the
+// meta-board, though cells are left.
+func TestUltimateDrawn(t *testing.T) {
+	b := NewBoard(UltimateSize)
+	owners := [3][3]string{{"X", "O", "X"}, {"X", "O", "O"}, {"O", "X", ""}}
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 3; c++ {
+			if o := owners[r][c]; o != "" {
+				for i := 0; i < 3; i++ {
+					b[r*3][c*3+i] = o
+				}
+			}
+		}
+	}
+	if RoundDrawn(b, []WinCondition{Ultimate}) {
+		t.Fatal("drawn with a sub-board open")
+	}
+	full := board("XOX", "XOO", "OXX")
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 3; c++ {
+			b[6+r][6+c] = full[r][c]
+		}
+	}
+	if !RoundDrawn(b, []WinCondition{Ultimate}) {
+		t.Errorf("not drawn with every sub-board decided: %v", MetaBoard(b))
+	}
+}
@@ -0,0 +1,87 @@
+package engine
+
+import "errors"
+
+// Misère and wild tic-tac-toe keep the board and the patterns that end a
+// round but change who a completed one counts for. In misère, whoever
+// completes a pattern loses it. In wild, each player marks either X or O on
+// their turn, and whoever completes a pattern of either symbol wins it.
+// Like Ultimate, each is carried in a game's conditions by name: a
+// condition that never wins by itself sits alongside Lines and marks the
+// rule set. Both are two-player only.
+
+const (
+	MisereName = "misere"
+	WildName   = "wild"
+)
+
+var ErrInvalidMark = errors.New("invalid_mark")
+
+var (
+	Misere = WinCondition{Name: MisereName, Check: noPattern}
+	Wild   = WinCondition{Name: WildName, Check: noPattern}
+)
+
+// variants are the marker conditions ParseWinConditions accepts by name.
+var variants = map[string]WinCondition{
+	MisereName: Misere,
+	WildName:   Wild,
+	BlitzName:  Blitz,
+}
+
+func noPattern(Board, Cell) []Cell { return nil }
+
+func hasCondition(conds []WinCondition, name string) bool {
+	for _, c := range conds {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsMisere reports whether conds play misère.
+func IsMisere(conds []WinCondition) bool {
+	return hasCondition(conds, MisereName)
+}
+
+// IsWild reports whether conds play wild.
+func IsWild(conds []WinCondition) bool {
+	return hasCondition(conds, WildName)
+}
+
+// Victor is who wins a round under conds when mover's move completed a
+// pattern of symbol's marks: the mover in wild, the mover's opponent in
+// misère, and otherwise symbol, which is the mover's own.
+func Victor(mover, symbol string, conds []WinCondition) string {
+	switch {
+	case IsMisere(conds):
+		return Other(mover)
+	case IsWild(conds):
+		return mover
+	}
+	return symbol
+}
+
+// Marks lists the symbols player may mark on their turn under conds: X or
+// O in wild, and otherwise only their own.
+func Marks(player string, conds []WinCondition) []string {
+	if IsWild(conds) {
+		return []string{"X", "O"}
+	}
+	return []string{player}
+}
+
+// MarkFor is the symbol player marks when asking for mark, "" meaning
+// their own, or ErrInvalidMark if conds don't let them mark it.
+func MarkFor(player, mark string, conds []WinCondition) (string, error) {
+	if mark == "" {
+		return player, nil
+	}
+	for _, m := range Marks(player, conds) {
+		if m == mark {
+			return mark, nil
+		}
+	}
+	return "", ErrInvalidMark
+}
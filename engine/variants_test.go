@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+)
+
+// In misère whoever completes a line loses the round; in wild whoever
+// completes one wins it, whichever symbol the line is of.
+func TestVariantWinner(t *testing.T) {
+	tests := []struct {
+		name   string
+		conds  []WinCondition
+		moves  [][3]string // Mover, mark and cell as "rc", in turn from X
+		winner string
+	}{
+		{"misère: X completes a row", []WinCondition{Lines, Misere},
+			[][3]string{{"X", "", "00"}, {"O", "", "10"}, {"X", "", "01"}, {"O", "", "11"}, {"X", "", "02"}}, "O"},
+		{"misère: O completes a column", []WinCondition{Lines, Misere},
+			[][3]string{{"X", "", "01"}, {"O", "", "00"}, {"X", "", "02"}, {"O", "", "10"}, {"X", "", "11"}, {"O", "", "20"}}, "X"},
+		{"wild: X completes a line of O", []WinCondition{Lines, Wild},
+			[][3]string{{"X", "O", "00"}, {"O", "X", "22"}, {"X", "O", "01"}, {"O", "X", "21"}, {"X", "O", "02"}}, "X"},
+		{"wild: O completes a line of X", []WinCondition{Lines, Wild},
+			[][3]string{{"X", "X", "00"}, {"O", "O", "22"}, {"X", "X", "01"}, {"O", "X", "02"}}, "O"},
+		{"standard: the line's symbol wins", nil,
+			[][3]string{{"X", "", "00"}, {"O", "", "10"}, {"X", "", "01"}, {"O", "", "11"}, {"X", "", "02"}}, "X"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMatch()
+			m.Conditions = tt.conds
+			var outcome Outcome
+			for i, mv := range tt.moves {
+				var err error
+				if outcome, err = m.Play(mv[0], mv[1], int(mv[2][0]-'0'), int(mv[2][1]-'0')); err != nil {
+					t.Fatalf("move %d %v: %v", i+1, mv, err)
+				}
+				if i < len(tt.moves)-1 && outcome != Continue {
+					t.Fatalf("move %d %v ended the round", i+1, mv)
+				}
+			}
+			if outcome != Won || m.Winner != tt.winner {
+				t.Errorf("round %v won by %q, want won by %s", outcome, m.Winner, tt.winner)
+			}
+			var want Score
+			want.Add(tt.winner)
+			if m.Score != want {
+				t.Errorf("score %+v, want %+v", m.Score, want)
+			}
+		})
+	}
+}
+
+// Only wild lets a player mark the other symbol, and no rule lets them
+// mark a third.
+func TestVariantMarks(t *testing.T) {
+	tests := []struct {
+		name  string
+		conds []WinCondition
+		mark  string
+		want  error
+	}{
+		{"standard, own mark", nil, "X", nil},
+		{"standard, other mark", nil, "O", ErrInvalidMark},
+		{"misère, other mark", []WinCondition{Lines, Misere}, "O", ErrInvalidMark},
+		{"wild, own mark", []WinCondition{Lines, Wild}, "X", nil},
+		{"wild, other mark", []WinCondition{Lines, Wild}, "O", nil},
+		{"wild, a third mark", []WinCondition{Lines, Wild}, Third, ErrInvalidMark},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMatch()
+			m.Conditions = tt.conds
+			_, err := m.Play("X", tt.mark, 1, 1)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Play = %v, want %v", err, tt.want)
+			}
+			if err != nil && (m.Board[1][1] != "" || m.CurrentPlayer != "X") {
+				t.Error("a refused mark changed the match")
+			}
+			if err == nil && m.Board[1][1] != tt.mark {
+				t.Errorf("cell holds %q, want %s", m.Board[1][1], tt.mark)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package engine
+
+import (
+	"errors"
+	"sort"
+)
+
+var ErrUnknownWinCondition = errors.New("unknown_win_condition")
+
+type Cell struct {
+	Row, Col int
+}
+
+// WinCondition is one way to win a round. Check looks at the board just
+// after the move at last and returns the cells of a pattern completed by
+// that move's symbol, or nil.
+type WinCondition struct {
+	Name  string
+	Check func(b Board, last Cell) []Cell
+}
+
+// Win says which condition ended a round and the cells that satisfied it.
+type Win struct {
+	Condition string
+	Cells     []Cell
+}
+
+// Lines is the standard rule, a full row, column or diagonal. Every game
+// plays with it, or with KInARow on a larger board; the other conditions
+// are added alongside.
+var Lines = WinCondition{Name: "line", Check: checkLines}
+
+// KInARow is the line rule won by k in a row, column or diagonal rather
+// than a full line, for boards larger than k.
+func KInARow(k int) WinCondition {
+	return WinCondition{Name: Lines.Name, Check: func(b Board, last Cell) []Cell { return checkRun(b, last, k) }}
+}
+
+// WithWinLength returns conds with the line rule won by k in a row. A k of
+// 0, or the board's size, keeps full lines.
+func WithWinLength(conds []WinCondition, k int) []WinCondition {
+	if k == 0 {
+		return conds
+	}
+	if conds == nil {
+		return []WinCondition{KInARow(k)}
+	}
+	out := append([]WinCondition(nil), conds...)
+	for i, c := range out {
+		if c.Name == Lines.Name {
+			out[i] = KInARow(k)
+		}
+	}
+	return out
+}
+
+// WinConditions are the optional conditions games can opt in to, by name.
+var WinConditions = map[string]WinCondition{
+	"corners": {Name: "corners", Check: checkCorners},
+	"square":  {Name: "square", Check: checkSquare},
+}
+
+// ParseWinConditions returns Lines followed by the named optional
+// conditions, ignoring repeats. The name "ultimate" stands alone for that
+// variant's rules, in place of Lines; "misere", "wild" and "blitz" are
+// taken alongside the others for theirs.
+func ParseWinConditions(names []string) ([]WinCondition, error) {
+	if len(names) == 1 && names[0] == UltimateName {
+		return []WinCondition{Ultimate}, nil
+	}
+	out := []WinCondition{Lines}
+	seen := map[string]bool{Lines.Name: true}
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		c, ok := WinConditions[name]
+		if !ok {
+			c, ok = variants[name]
+		}
+		if !ok {
+			return nil, ErrUnknownWinCondition
+		}
+		seen[name] = true
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// ConditionNames lists the names of the optional conditions in conds, in
+// order, for storing alongside a game.
+func ConditionNames(conds []WinCondition) []string {
+	var out []string
+	for _, c := range conds {
+		if c.Name != Lines.Name {
+			out = append(out, c.Name)
+		}
+	}
+	return out
+}
+
+// OptionalConditions lists the names accepted by ParseWinConditions.
+func OptionalConditions() []string {
+	out := make([]string, 0, len(WinConditions))
+	for name := range WinConditions {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Directions a straight line of cells can run in, as LineKind names them.
+const (
+	LineRow      = "row"
+	LineCol      = "col"
+	LineDiag     = "diag"      // Top left to bottom right
+	LineAntiDiag = "anti-diag" // Top right to bottom left
+)
+
+// LineKind is the direction cells run in, if they are two or more in a
+// straight line, and "" for any other pattern, such as corners or square.
+func LineKind(cells []Cell) string {
+	if len(cells) < 2 {
+		return ""
+	}
+	same := func(key func(Cell) int) bool {
+		for _, c := range cells[1:] {
+			if key(c) != key(cells[0]) {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case same(func(c Cell) int { return c.Row }):
+		return LineRow
+	case same(func(c Cell) int { return c.Col }):
+		return LineCol
+	case same(func(c Cell) int { return c.Row - c.Col }):
+		return LineDiag
+	case same(func(c Cell) int { return c.Row + c.Col }):
+		return LineAntiDiag
+	}
+	return ""
+}
+
+// FindWin checks conds in order against the move at last. A nil conds
+// means the standard rule only.
+func FindWin(b Board, last Cell, conds []WinCondition) (Win, bool) {
+	if conds == nil {
+		conds = []WinCondition{Lines}
+	}
+	for _, c := range conds {
+		if cells := c.Check(b, last); cells != nil {
+			return Win{Condition: c.Name, Cells: cells}, true
+		}
+	}
+	return Win{}, false
+}
+
+// Winner finds a completed pattern anywhere on the board, for positions
+// whose last move isn't known. It returns the winning symbol and pattern.
+func Winner(b Board, conds []WinCondition) (string, Win, bool) {
+	for r := range b {
+		for c := range b[r] {
+			if b[r][c] == "" {
+				continue
+			}
+			if win, ok := FindWin(b, Cell{r, c}, conds); ok {
+				return b[r][c], win, true
+			}
+		}
+	}
+	return "", Win{}, false
+}
+
+// allOf returns cells if every one holds symbol, else nil.
+func allOf(b Board, symbol string, cells []Cell) []Cell {
+	if symbol == "" {
+		return nil
+	}
+	for _, c := range cells {
+		if b[c.Row][c.Col] != symbol {
+			return nil
+		}
+	}
+	return cells
+}
+
+func checkLines(b Board, last Cell) []Cell {
+	return checkRun(b, last, b.Size())
+}
+
+// runDirections are the four ways a line can run: along a row, down a
+// column, and both diagonals.
+var runDirections = []Cell{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+
+// checkRun wins with k or more of the last move's symbol in a row through
+// it, returning the whole run.
+func checkRun(b Board, last Cell, k int) []Cell {
+	if runs := WinningLines(b, last, k); runs != nil {
+		return runs[0]
+	}
+	return nil
+}
+
+// WinningLines returns every run of k or more of the last move's symbol
+// through it, in runDirections order: one for most wins, two or more when
+// the move completes several lines at once.
+func WinningLines(b Board, last Cell, k int) [][]Cell {
+	symbol := b[last.Row][last.Col]
+	if symbol == "" {
+		return nil
+	}
+	var out [][]Cell
+	for _, d := range runDirections {
+		start := last
+		for b.InBounds(start.Row-d.Row, start.Col-d.Col) && b[start.Row-d.Row][start.Col-d.Col] == symbol {
+			start = Cell{start.Row - d.Row, start.Col - d.Col}
+		}
+		var run []Cell
+		for c := start; b.InBounds(c.Row, c.Col) && b[c.Row][c.Col] == symbol; c = (Cell{c.Row + d.Row, c.Col + d.Col}) {
+			run = append(run, c)
+		}
+		if len(run) >= k {
+			out = append(out, run)
+		}
+	}
+	return out
+}
+
+// checkCorners wins with all four corners.
+func checkCorners(b Board, last Cell) []Cell {
+	n := b.Size()
+	corners := []Cell{{0, 0}, {0, n - 1}, {n - 1, 0}, {n - 1, n - 1}}
+	for _, c := range corners {
+		if c == last {
+			return allOf(b, b[last.Row][last.Col], corners)
+		}
+	}
+	return nil
+}
+
+// checkSquare wins with any 2x2 block containing the last move.
+func checkSquare(b Board, last Cell) []Cell {
+	for r := last.Row - 1; r <= last.Row; r++ {
+		for c := last.Col - 1; c <= last.Col; c++ {
+			if r < 0 || c < 0 || r+1 >= b.Size() || c+1 >= b.Size() {
+				continue
+			}
+			block := []Cell{{r, c}, {r, c + 1}, {r + 1, c}, {r + 1, c + 1}}
+			if allOf(b, b[last.Row][last.Col], block) != nil {
+				return block
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// board reads rows such as "XO." into a Board, "." for an empty cell.
+func board(rows ...string) Board {
+	b := NewBoard(len(rows))
+	for r, row := range rows {
+		for c, mark := range strings.Split(row, "") {
+			if mark != "." {
+				b[r][c] = mark
+			}
+		}
+	}
+	return b
+}
+
+func TestValidSize(t *testing.T) {
+	for n := 0; n <= MaxSize+1; n++ {
+		if got, want := ValidSize(n), n >= 3 && n <= 10; got != want {
+			t.Errorf("ValidSize(%d) = %v, want %v", n, got, want)
+		}
+	}
+}
+
+func TestValidWinLength(t *testing.T) {
+	tests := []struct {
+		n, k int
+		want bool
+	}{
+		{3, 3, true},
+		{3, 2, false},
+		{3, 4, false}, // K > N could never be won
+		{5, 3, true},
+		{5, 5, true},
+		{5, 6, false},
+		{10, 10, true},
+		{10, 11, false},
+	}
+	for _, tt := range tests {
+		if got := ValidWinLength(tt.n, tt.k); got != tt.want {
+			t.Errorf("ValidWinLength(%d, %d) = %v, want %v", tt.n, tt.k, got, tt.want)
+		}
+	}
+}
+
+func TestKInARow(t *testing.T) {
+	tests := []struct {
+		name  string
+		board Board
+		last  Cell
+		k     int
+		want  []Cell // nil for no win
+	}{
+		{"row of 3 on 5x5", board(
+			".....",
+			".XXX.",
+			".....",
+			".....",
+			"....."), Cell{1, 2}, 3, []Cell{{1, 1}, {1, 2}, {1, 3}}},
+		{"two short of a full row", board(
+			".....",
+			".XXX.",
+			".....",
+			".....",
+			"....."), Cell{1, 3}, 5, nil},
+		{"a run longer than k wins whole", board(
+			"XXXX.",
+			".....",
+			".....",
+			".....",
+			"....."), Cell{0, 1}, 3, []Cell{{0, 0}, {0, 1}, {0, 2}, {0, 3}}},
+		{"broken run", board(
+			"XX.XX",
+			".....",
+			".....",
+			".....",
+			"....."), Cell{0, 4}, 3, nil},
+		{"column against the bottom edge", board(
+			".....",
+			".....",
+			"....O",
+			"....O",
+			"....O"), Cell{4, 4}, 3, []Cell{{2, 4}, {3, 4}, {4, 4}}},
+		{"diagonal off the main one", board(
+			".....",
+			".....",
+			"X....",
+			".X...",
+			"..X.."), Cell{3, 1}, 3, []Cell{{2, 0}, {3, 1}, {4, 2}}},
+		{"anti-diagonal from the top edge", board(
+			"..O..",
+			".O...",
+			"O....",
+			".....",
+			"....."), Cell{0, 2}, 3, []Cell{{0, 2}, {1, 1}, {2, 0}}},
+		{"anti-diagonal into the bottom right corner", board(
+			".....",
+			".....",
+			"....X",
+			"...X.",
+			"..X.."), Cell{4, 2}, 3, []Cell{{2, 4}, {3, 3}, {4, 2}}},
+		{"anti-diagonal too short at the corner", board(
+			".....",
+			".....",
+			".....",
+			"....X",
+			"...X."), Cell{3, 4}, 3, nil},
+		{"marks wrapping round the edge don't count", board(
+			"....X",
+			"X....",
+			".X...",
+			".....",
+			"....."), Cell{1, 0}, 3, nil},
+		{"K greater than N never wins", board(
+			"XXX",
+			"...",
+			"..."), Cell{0, 0}, 4, nil},
+		{"another symbol breaks the run", board(
+			"XXOXX",
+			".....",
+			".....",
+			".....",
+			"....."), Cell{0, 1}, 3, nil},
+		{"empty last cell", board(
+			".....",
+			".....",
+			".....",
+			".....",
+			"....."), Cell{2, 2}, 3, nil},
+	}
+	for _, tt := range tests {
+		got := KInARow(tt.k).Check(tt.board, tt.last)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: KInARow(%d) = %v, want %v", tt.name, tt.k, got, tt.want)
+		}
+	}
+}
+
+func TestFullLinesOnLargerBoards(t *testing.T) {
+	for n := MinSize; n <= MaxSize; n++ {
+		b := NewBoard(n)
+		for i := 0; i < n; i++ {
+			b[i][n-1-i] = "O"
+		}
+		for i := 0; i < n-1; i++ {
+			if win, ok := FindWin(b, Cell{i, n - 1 - i}, nil); !ok || len(win.Cells) != n {
+				t.Errorf("%dx%d anti-diagonal: FindWin = %+v, %v; want all %d cells", n, n, win, ok, n)
+			}
+		}
+		b[n-1][0] = ""
+		if _, ok := FindWin(b, Cell{0, n - 1}, nil); ok {
+			t.Errorf("%dx%d: anti-diagonal one short of full won", n, n)
+		}
+	}
+}
+
+func TestWithWinLength(t *testing.T) {
+	if got := WithWinLength(nil, 0); got != nil {
+		t.Errorf("WithWinLength(nil, 0) = %v, want nil for full lines", got)
+	}
+	conds, err := ParseWinConditions([]string{"corners"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := WithWinLength(conds, 4)
+	if len(got) != 2 || got[0].Name != Lines.Name || got[1].Name != "corners" {
+		t.Fatalf("WithWinLength(corners, 4) = %v, want line then corners", ConditionNames(got))
+	}
+	b := board(
+		"XXXX.",
+		".....",
+		".....",
+		".....",
+		".....")
+	if win, ok := FindWin(b, Cell{0, 3}, got); !ok || len(win.Cells) != 4 {
+		t.Errorf("four in a row under WithWinLength(4) = %+v, %v; want a win", win, ok)
+	}
+	if _, ok := FindWin(b, Cell{0, 3}, conds); ok {
+		t.Error("WithWinLength changed the conditions it was given")
+	}
+}
+
+func TestWinningLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		board Board
+		last  Cell
+		k     int
+		want  [][]Cell
+		kinds []string
+	}{
+		{"row", board(
+			"XXX",
+			"OO.",
+			"..."), Cell{0, 2}, 3, [][]Cell{{{0, 0}, {0, 1}, {0, 2}}}, []string{LineRow}},
+		{"column", board(
+			"OX.",
+			"OX.",
+			"O.X"), Cell{1, 0}, 3, [][]Cell{{{0, 0}, {1, 0}, {2, 0}}}, []string{LineCol}},
+		{"diagonal", board(
+			"XO.",
+			"OX.",
+			"..X"), Cell{2, 2}, 3, [][]Cell{{{0, 0}, {1, 1}, {2, 2}}}, []string{LineDiag}},
+		{"anti-diagonal", board(
+			"XXO",
+			"XO.",
+			"O.."), Cell{1, 1}, 3, [][]Cell{{{0, 2}, {1, 1}, {2, 0}}}, []string{LineAntiDiag}},
+		{"double line through the last move", board(
+			"XXX",
+			"OXO",
+			"OXO"), Cell{0, 1}, 3, [][]Cell{
+			{{0, 0}, {0, 1}, {0, 2}},
+			{{0, 1}, {1, 1}, {2, 1}},
+		}, []string{LineRow, LineCol}},
+		{"both diagonals through the centre", board(
+			"XOX",
+			"OXO",
+			"XOX"), Cell{1, 1}, 3, [][]Cell{
+			{{0, 0}, {1, 1}, {2, 2}},
+			{{0, 2}, {1, 1}, {2, 0}},
+		}, []string{LineDiag, LineAntiDiag}},
+		{"a line not through the last move isn't listed", board(
+			"XXX",
+			"OO.",
+			"..X"), Cell{2, 2}, 3, nil, nil},
+		{"k in a row on a larger board", board(
+			"....",
+			".OOO",
+			".O..",
+			"O..."), Cell{1, 2}, 3, [][]Cell{
+			{{1, 1}, {1, 2}, {1, 3}},
+			{{1, 2}, {2, 1}, {3, 0}},
+		}, []string{LineRow, LineAntiDiag}},
+		{"no line", board(
+			"XO.",
+			"...",
+			"..."), Cell{0, 0}, 3, nil, nil},
+	}
+	for _, tt := range tests {
+		got := WinningLines(tt.board, tt.last, tt.k)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: WinningLines = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i, line := range got {
+			if kind := LineKind(line); kind != tt.kinds[i] {
+				t.Errorf("%s: LineKind(%v) = %q, want %q", tt.name, line, kind, tt.kinds[i])
+			}
+		}
+	}
+}
+
+func TestLineKind(t *testing.T) {
+	tests := []struct {
+		cells []Cell
+		want  string
+	}{
+		{nil, ""},
+		{[]Cell{{1, 1}}, ""},
+		{[]Cell{{0, 0}, {0, 2}, {2, 0}, {2, 2}}, ""}, // Corners
+		{[]Cell{{0, 0}, {0, 1}, {1, 0}, {1, 1}}, ""}, // Square
+		{[]Cell{{2, 0}, {2, 1}}, LineRow},
+		{[]Cell{{0, 3}, {1, 3}, {2, 3}}, LineCol},
+		{[]Cell{{1, 0}, {2, 1}, {3, 2}}, LineDiag},
+		{[]Cell{{0, 3}, {1, 2}, {2, 1}, {3, 0}}, LineAntiDiag},
+	}
+	for _, tt := range tests {
+		if got := LineKind(tt.cells); got != tt.want {
+			t.Errorf("LineKind(%v) = %q, want %q", tt.cells, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Package i18n holds the server's message catalogs and picks a locale for
+// each client. Catalogs are embedded JSON files keyed by stable message
+// codes; English is the fallback for unknown locales and missing keys.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default is the locale used when negotiation finds no supported match.
+const Default = "en"
+
+//go:embed locales/*.json
+var files embed.FS
+
+var catalogs = mustLoad()
+
+func mustLoad() map[string]map[string]string {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	out := make(map[string]map[string]string, len(entries))
+	for _, e := range entries {
+		data, err := files.ReadFile(path.Join("locales", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var catalog map[string]string
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic("i18n: " + e.Name() + ": " + err.Error())
+		}
+		out[strings.TrimSuffix(e.Name(), ".json")] = catalog
+	}
+	if _, ok := out[Default]; !ok {
+		panic("i18n: missing default catalog " + Default)
+	}
+	return out
+}
+
+// Locales lists the available catalogs in sorted order.
+func Locales() []string {
+	out := make([]string, 0, len(catalogs))
+	for l := range catalogs {
+		out = append(out, l)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Supported reports whether a catalog exists for locale.
+func Supported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// T returns the message for code in locale, falling back to English and
+// finally to the code itself.
+func T(locale, code string) string {
+	if msg, ok := catalogs[locale][code]; ok {
+		return msg
+	}
+	if msg, ok := catalogs[Default][code]; ok {
+		return msg
+	}
+	return code
+}
+
+// Match maps a language tag such as "de-AT" to a supported locale, trying
+// the full tag before its primary subtag. It returns "" when neither exists.
+func Match(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if Supported(tag) {
+		return tag
+	}
+	if i := strings.IndexAny(tag, "-_"); i > 0 && Supported(tag[:i]) {
+		return tag[:i]
+	}
+	return ""
+}
+
+// Negotiate picks the best supported locale from an Accept-Language header,
+// honoring q-values, and returns Default when nothing matches.
+func Negotiate(header string) string {
+	return Resolve(Preferred(header), "")
+}
+
+// Preferred is Negotiate without the fallback: it returns "" when the
+// header names no supported locale.
+func Preferred(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+		if l := Match(fields[0]); l != "" {
+			best, bestQ = l, q
+		}
+	}
+	return best
+}
+
+// Resolve picks the locale for a participant: the one their connection
+// asked for, else the game's, else Default. Empty means not set.
+func Resolve(connection, game string) string {
+	if connection != "" {
+		return connection
+	}
+	if game != "" {
+		return game
+	}
+	return Default
+}
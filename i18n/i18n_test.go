@@ -0,0 +1,106 @@
+package i18n
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header, want string
+	}{
+		{"", "en"},
+		{"de", "de"},
+		{"DE", "de"},
+		{"de-AT", "de"},
+		{"de_CH", "de"},
+		{"fr", "en"},
+		{"fr, de;q=0.5", "de"},
+		{"en;q=0.4, de;q=0.8", "de"},
+		{"de;q=0.8, en;q=0.9", "en"},
+		{"de;q=0.9, en;q=0.9", "de"}, // A tie goes to the first listed
+		{"de;q=0, en;q=0.1", "en"},
+		{"de;q=0", "en"},
+		{"de;q=oops", "de"}, // An unreadable q counts as 1
+		{"*", "en"},
+		{" de-DE ; q=0.7 , fr;q=0.9", "de"},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.header); got != tt.want {
+			t.Errorf("Negotiate(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestPreferredHasNoFallback(t *testing.T) {
+	for _, header := range []string{"", "fr", "fr-FR, it;q=0.5"} {
+		if got := Preferred(header); got != "" {
+			t.Errorf("Preferred(%q) = %q, want none", header, got)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		tag, want string
+	}{
+		{"en", "en"},
+		{" En-GB ", "en"},
+		{"de-AT", "de"},
+		{"-de", ""},
+		{"xx", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.tag); got != tt.want {
+			t.Errorf("Match(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		connection, game, want string
+	}{
+		{"de", "en", "de"},
+		{"", "de", "de"},
+		{"", "", Default},
+	}
+	for _, tt := range tests {
+		if got := Resolve(tt.connection, tt.game); got != tt.want {
+			t.Errorf("Resolve(%q, %q) = %q, want %q", tt.connection, tt.game, got, tt.want)
+		}
+	}
+}
+
+func TestTFallback(t *testing.T) {
+	catalogs[Default]["test_only_in_english"] = "English only"
+	t.Cleanup(func() { delete(catalogs[Default], "test_only_in_english") })
+
+	tests := []struct {
+		locale, code, want string
+	}{
+		{"de", "game_not_found", "Spiel nicht gefunden."},
+		{"de", "test_only_in_english", "English only"},
+		{"xx", "game_not_found", "Game not found."},
+		{"", "game_not_found", "Game not found."},
+		{"de", "no_such_code", "no_such_code"},
+	}
+	for _, tt := range tests {
+		if got := T(tt.locale, tt.code); got != tt.want {
+			t.Errorf("T(%q, %q) = %q, want %q", tt.locale, tt.code, got, tt.want)
+		}
+	}
+}
+
+// Every catalog translates only codes English has, so a typo in a key
+// can't go unnoticed behind the fallback.
+func TestCatalogsMatchDefault(t *testing.T) {
+	for _, locale := range Locales() {
+		for code, msg := range catalogs[locale] {
+			if _, ok := catalogs[Default][code]; !ok {
+				t.Errorf("%s has %q, which %s doesn't", locale, code, Default)
+			}
+			if msg == "" {
+				t.Errorf("%s has an empty message for %q", locale, code)
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Package local implements the offline hot-seat mode: two people share one
+// terminal and take turns entering moves, with no server involved.
+package local
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"tictactoe/engine"
+)
+
+// errQuit is returned when a player types "q" at any prompt.
+var errQuit = errors.New("quit")
+
+// Render draws the board with 1-based row and column labels.
+func Render(w io.Writer, b engine.Board) {
+	n := b.Size()
+	header := "    "
+	for c := 0; c < n; c++ {
+		header += fmt.Sprintf(" %-3d", c+1)
+	}
+	fmt.Fprintln(w, strings.TrimRight(header, " "))
+	for r := 0; r < n; r++ {
+		cells := make([]string, n)
+		for c := 0; c < n; c++ {
+			cells[c] = b[r][c]
+			if cells[c] == "" {
+				cells[c] = " "
+			}
+		}
+		fmt.Fprintf(w, " %2d  %s\n", r+1, strings.Join(cells, " | "))
+		if r < n-1 {
+			fmt.Fprintln(w, "    "+strings.Repeat("---+", n-1)+"---")
+		}
+	}
+}
+
+// ParseMove reads "row col" (1-based, separated by a space or comma) into
+// 0-based coordinates on an n×n board.
+func ParseMove(line string, n int) (row, col int, err error) {
+	fields := strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == ',' || r == '\t' })
+	if len(fields) != 2 {
+		return 0, 0, errors.New("enter a move as \"row col\", e.g. \"2 3\"")
+	}
+	row, err1 := strconv.Atoi(fields[0])
+	col, err2 := strconv.Atoi(fields[1])
+	if err1 != nil || err2 != nil || row < 1 || row > n || col < 1 || col > n {
+		return 0, 0, fmt.Errorf("row and column must be numbers from 1 to %d", n)
+	}
+	return row - 1, col - 1, nil
+}
+
+type session struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+func (s *session) prompt(text string) (string, error) {
+	fmt.Fprint(s.out, text)
+	if !s.in.Scan() {
+		if err := s.in.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	line := strings.TrimSpace(s.in.Text())
+	if strings.EqualFold(line, "q") || strings.EqualFold(line, "quit") {
+		return "", errQuit
+	}
+	return line, nil
+}
+
+func describe(err error) string {
+	switch {
+	case errors.Is(err, engine.ErrCellOccupied):
+		return "That cell is already taken."
+	case errors.Is(err, engine.ErrOutOfBounds):
+		return "That cell is off the board."
+	}
+	return err.Error()
+}
+
+// playRound prompts alternately until the round is won or drawn.
+func (s *session) playRound(m *engine.Match) error {
+	for {
+		Render(s.out, m.Board)
+		line, err := s.prompt(fmt.Sprintf("Player %s, your move (row col): ", m.CurrentPlayer))
+		if err != nil {
+			return err
+		}
+		row, col, err := ParseMove(line, m.Board.Size())
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+			continue
+		}
+		mover := m.CurrentPlayer
+		outcome, err := m.Move(mover, row, col)
+		if err != nil {
+			fmt.Fprintln(s.out, describe(err))
+			continue
+		}
+		switch outcome {
+		case engine.Won:
+			Render(s.out, m.Board)
+			fmt.Fprintf(s.out, "Player %s wins!\n", mover)
+			return nil
+		case engine.Drawn:
+			Render(s.out, m.Board)
+			fmt.Fprintln(s.out, "It's a draw!")
+			return nil
+		}
+	}
+}
+
+// Play runs rounds on in/out until the players decline a rematch, quit, or
+// input ends. Starters alternate between rounds like the online game.
+func Play(in io.Reader, out io.Writer) error {
+	s := &session{in: bufio.NewScanner(in), out: out}
+	m := engine.NewMatch()
+	fmt.Fprintln(out, "Tic-Tac-Toe hot seat. Enter moves as \"row col\"; type q to quit.")
+	for {
+		fmt.Fprintf(out, "\nScore  X: %d  O: %d  Draws: %d  (%s starts)\n", m.Score.X, m.Score.O, m.Score.Draws, m.StartingPlayer)
+		if err := s.playRound(m); err != nil {
+			return finish(out, m, err)
+		}
+		fmt.Fprintf(out, "Score  X: %d  O: %d  Draws: %d\n", m.Score.X, m.Score.O, m.Score.Draws)
+		for {
+			answer, err := s.prompt("Rematch? [y/n]: ")
+			if err != nil {
+				return finish(out, m, err)
+			}
+			switch strings.ToLower(answer) {
+			case "y", "yes":
+				m.NextRound()
+			case "n", "no":
+				return finish(out, m, nil)
+			default:
+				continue
+			}
+			break
+		}
+	}
+}
+
+func finish(out io.Writer, m *engine.Match, err error) error {
+	if errors.Is(err, errQuit) || errors.Is(err, io.EOF) {
+		err = nil
+	}
+	if err == nil {
+		fmt.Fprintf(out, "\nFinal score  X: %d  O: %d  Draws: %d\n", m.Score.X, m.Score.O, m.Score.Draws)
+	}
+	return err
+}
+
+// Main runs the local subcommand with command-line args.
+func Main(args []string) error {
+	fs := flag.NewFlagSet("local", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return Play(os.Stdin, os.Stdout)
+}
@@ -0,0 +1,91 @@
+package local
+
+import (
+	"strings"
+	"testing"
+
+	"tictactoe/engine"
+)
+
+func TestParseMove(t *testing.T) {
+	tests := []struct {
+		line     string
+		row, col int
+		ok       bool
+	}{
+		{"1 1", 0, 0, true},
+		{"2,3", 1, 2, true},
+		{" 3\t2 ", 2, 1, true},
+		{"3, 3", 2, 2, true},
+		{"0 1", 0, 0, false},
+		{"4 1", 0, 0, false},
+		{"1", 0, 0, false},
+		{"1 2 3", 0, 0, false},
+		{"a b", 0, 0, false},
+	}
+	for _, tt := range tests {
+		row, col, err := ParseMove(tt.line, 3)
+		if (err == nil) != tt.ok || (tt.ok && (row != tt.row || col != tt.col)) {
+			t.Errorf("ParseMove(%q) = %d, %d, %v; want %d, %d, ok %v", tt.line, row, col, err, tt.row, tt.col, tt.ok)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	b := engine.NewBoard(3)
+	b[0][0], b[1][1], b[2][2] = "X", "O", "X"
+	var out strings.Builder
+	Render(&out, b)
+	want := "     1   2   3\n" +
+		"  1  X |   |  \n" +
+		"    ---+---+---\n" +
+		"  2    | O |  \n" +
+		"    ---+---+---\n" +
+		"  3    |   | X\n"
+	if out.String() != want {
+		t.Errorf("Render:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+// Two rounds at one terminal: X wins the first past a few bad entries,
+// O starts the rematch, which is drawn, and the players stop there.
+func TestPlay(t *testing.T) {
+	input := strings.Join([]string{
+		"1 1", "1 1", "9 9", "hello", "2 1", "1 2", "2 2", "1 3", // X wins the top row
+		"y",
+		"1 1", "1 2", "1 3", "2 2", "2 1", "2 3", "3 2", "3 1", "3 3", // O starts; drawn
+		"n",
+	}, "\n") + "\n"
+	var out strings.Builder
+	if err := Play(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Play: %v", err)
+	}
+	for _, want := range []string{
+		"That cell is already taken.",
+		"row and column must be numbers from 1 to 3",
+		"enter a move as",
+		"Player X wins!",
+		"(O starts)",
+		"Player O, your move",
+		"It's a draw!",
+		"Final score  X: 1  O: 0  Draws: 1",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+}
+
+// Quitting mid-round, or input running out, ends the session cleanly with
+// the score so far.
+func TestPlayQuit(t *testing.T) {
+	for name, input := range map[string]string{"q": "1 1\nq\n", "end of input": "1 1\n"} {
+		var out strings.Builder
+		if err := Play(strings.NewReader(input), &out); err != nil {
+			t.Errorf("%s: Play = %v, want nil", name, err)
+		}
+		if !strings.Contains(out.String(), "Final score  X: 0  O: 0  Draws: 0") {
+			t.Errorf("%s: no final score in:\n%s", name, out.String())
+		}
+	}
+}
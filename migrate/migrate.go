@@ -0,0 +1,32 @@
+// Package migrate implements the migrate subcommand, which brings the
+// configured store's schema up to date.
+package migrate
+
+import (
+	"fmt"
+
+	"tictactoe/config"
+	"tictactoe/server"
+)
+
+// Main runs the migrate subcommand with command-line args.
+func Main(args []string) error {
+	c, _, err := config.Load("migrate", args)
+	if err != nil {
+		return err
+	}
+	s, err := server.NewStore(c)
+	if err != nil {
+		return err
+	}
+	m, ok := s.(server.Migrator)
+	if !ok {
+		fmt.Println("store has no schema to migrate")
+		return nil
+	}
+	if err := m.Migrate(); err != nil {
+		return err
+	}
+	fmt.Println("migrations applied")
+	return nil
+}
@@ -0,0 +1,51 @@
+package protocol
+
+// Close codes the server puts in the close frame when it ends a connection,
+// from the 4000-4999 range websockets leave to applications. The frame's
+// reason says more: the error code for a refused join, otherwise a short
+// phrase such as "game aborted". A connection that has simply run its
+// course, a replay played out or a quick match found, ends with 1000
+// normal closure instead, and one dropped for breaking the server's
+// policy, by being banned or falling too far behind on messages, with
+// 1008 policy violation and "banned" or "slow consumer" as the reason.
+// Reconnectable tells a client whether to dial again on its own.
+const (
+	// Refused on joining; none of these is worth redialing as is.
+	CloseGameFull = 4000 // Both seats and the audience are taken
+	CloseRefused  = 4001 // Any other refusal; the reason is the error code
+
+	// Dropped for the connection's own doing.
+	CloseProtocolError = 4002 // A message the server can't take, such as one over the size limit
+	CloseRateLimited   = 4003 // Flooding; reconnect, but back off first
+	// 4004 was bans, which close with 1008 now
+
+	// Dropped for the link's health; reconnecting picks up the seat.
+	CloseIdleTimeout = 4005 // Nothing heard from the client for too long
+	// 4006 was slow consumers, which close with 1008 now
+
+	// The game is over for everyone.
+	CloseGameEnded  = 4007 // Aborted, forfeited, expired or deleted; the reason says which
+	CloseGameClosed = 4008 // An admin closed it
+
+	// The server is going away; reconnect, with a backoff, once it is back.
+	CloseShutdown = 4009
+
+	// The same client joined the seat on another connection, which has it
+	// now. Reconnecting would only take it back, tab against tab.
+	CloseSuperseded = 4010
+
+	// The game's host kicked the connection out, or banned it for the rest
+	// of the game's life.
+	CloseKicked = 4011
+)
+
+// Reconnectable reports whether a client dropped with code may reconnect
+// on its own. A rate-limited one should wait a while first, and all of
+// them should back off if the next attempt fails too.
+func Reconnectable(code int) bool {
+	switch code {
+	case CloseRateLimited, CloseIdleTimeout, CloseShutdown:
+		return true
+	}
+	return false
+}
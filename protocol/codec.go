@@ -0,0 +1,428 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// A Codec is a wire encoding for the game websocket. JSON is what a client
+// gets unless it asks for MsgPack, with ?enc=msgpack or the "msgpack"
+// subprotocol; the messages are the same either way. ForVersion wraps
+// either for a later wire version.
+type Codec interface {
+	// Name is the encoding's ?enc= value and subprotocol.
+	Name() string
+	// Binary reports whether frames go out as binary rather than text.
+	Binary() bool
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	JSON    Codec = jsonCodec{}
+	MsgPack Codec = msgpackCodec{}
+)
+
+// CodecNamed looks up an encoding by Name; "" is JSON.
+func CodecNamed(name string) (Codec, bool) {
+	switch name {
+	case "", JSON.Name():
+		return JSON, true
+	case MsgPack.Name():
+		return MsgPack, true
+	}
+	return nil, false
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                       { return "json" }
+func (jsonCodec) Binary() bool                       { return false }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// msgpackCodec is MessagePack with the JSON encoding's field names and
+// values, except that a board goes out as one byte per cell in row-major
+// order (0 empty, 1 X, 2 O, 3 Δ, as engine.Pack codes them) and
+// board_packed as raw bytes. It goes by way of JSON, so the struct tags
+// stay the one description of the wire format.
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+func (msgpackCodec) Binary() bool { return true }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var tree any
+	if err := d.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return appendMsgpack(nil, compact("", tree))
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	tree, rest, err := readMsgpack(data, 0)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("msgpack: %d bytes after the value", len(rest))
+	}
+	data, err = json.Marshal(expand("", tree))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+var (
+	cellMarks = []string{"", "X", "O", "Δ"}
+	cellCodes = map[string]byte{"": 0, "X": 1, "O": 2, "Δ": 3}
+)
+
+// compact swaps the boards in a decoded JSON value, the one under key, for
+// their compact forms.
+func compact(key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = compact(k, e)
+		}
+	case []any:
+		if key == "board" {
+			if cells, ok := boardCells(v); ok {
+				return cells
+			}
+		}
+		for i, e := range v {
+			v[i] = compact("", e)
+		}
+	case string:
+		if key == "board_packed" {
+			if b, err := base64.StdEncoding.DecodeString(v); err == nil {
+				return b
+			}
+		}
+	}
+	return v
+}
+
+// boardCells is rows, a square board of marks, one byte per cell.
+func boardCells(rows []any) ([]byte, bool) {
+	cells := make([]byte, 0, len(rows)*len(rows))
+	for _, row := range rows {
+		row, ok := row.([]any)
+		if !ok || len(row) != len(rows) {
+			return nil, false
+		}
+		for _, mark := range row {
+			s, _ := mark.(string)
+			code, ok := cellCodes[s]
+			if !ok {
+				return nil, false
+			}
+			cells = append(cells, code)
+		}
+	}
+	return cells, true
+}
+
+// expand undoes compact, so the JSON struct tags can read the value.
+func expand(key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = expand(k, e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = expand("", e)
+		}
+	case []byte:
+		n := int(math.Sqrt(float64(len(v))))
+		if key == "board" && n*n == len(v) {
+			rows := make([]any, n)
+			for r := range rows {
+				row := make([]any, n)
+				for c := range row {
+					if code := v[r*n+c]; int(code) < len(cellMarks) {
+						row[c] = cellMarks[code]
+					}
+				}
+				rows[r] = row
+			}
+			return rows
+		}
+	}
+	return v // bin other than a board goes back as base64, as []byte fields expect
+}
+
+// appendMsgpack appends v, a decoded JSON value or bytes, to b.
+func appendMsgpack(b []byte, v any) ([]byte, error) {
+	var err error
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendInt(b, i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendUint(append(b, 0xcb), math.Float64bits(f), 8), nil
+	case string:
+		switch n := len(v); {
+		case n < 32:
+			b = append(b, 0xa0|byte(n))
+		case n <= math.MaxUint8:
+			b = append(b, 0xd9, byte(n))
+		case n <= math.MaxUint16:
+			b = appendUint(append(b, 0xda), uint64(n), 2)
+		default:
+			b = appendUint(append(b, 0xdb), uint64(n), 4)
+		}
+		return append(b, v...), nil
+	case []byte:
+		switch n := len(v); {
+		case n <= math.MaxUint8:
+			b = append(b, 0xc4, byte(n))
+		case n <= math.MaxUint16:
+			b = appendUint(append(b, 0xc5), uint64(n), 2)
+		default:
+			b = appendUint(append(b, 0xc6), uint64(n), 4)
+		}
+		return append(b, v...), nil
+	case []any:
+		b = appendHeader(b, len(v), 0x90, 0xdc)
+		for _, e := range v {
+			if b, err = appendMsgpack(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = appendHeader(b, len(v), 0x80, 0xde)
+		for _, k := range keys {
+			if b, err = appendMsgpack(b, k); err != nil {
+				return nil, err
+			}
+			if b, err = appendMsgpack(b, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("msgpack: can't encode %T", v)
+}
+
+// appendHeader appends an array or map header for n elements: fix is the
+// fixarray or fixmap prefix, wide the 16-bit form, and wide+1 the 32-bit.
+func appendHeader(b []byte, n int, fix, wide byte) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return appendUint(append(b, wide), uint64(n), 2)
+	}
+	return appendUint(append(b, wide+1), uint64(n), 4)
+}
+
+func appendInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i < 128:
+		return append(b, byte(i))
+	case i < 0 && i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(b, 0xd0, byte(i))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return appendUint(append(b, 0xd1), uint64(i), 2)
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return appendUint(append(b, 0xd2), uint64(i), 4)
+	}
+	return appendUint(append(b, 0xd3), uint64(i), 8)
+}
+
+// appendUint appends the low size bytes of u, big-endian.
+func appendUint(b []byte, u uint64, size int) []byte {
+	for i := size - 1; i >= 0; i-- {
+		b = append(b, byte(u>>(8*i)))
+	}
+	return b
+}
+
+// maxMsgpackDepth bounds nesting, so a hostile frame can't exhaust the
+// stack.
+const maxMsgpackDepth = 32
+
+var errMsgpackShort = errors.New("msgpack: unexpected end of data")
+
+// readMsgpack reads one value off the front of b, nested depth deep, as
+// appendMsgpack would take it: numbers as json.Number, bin as []byte.
+func readMsgpack(b []byte, depth int) (any, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, errMsgpackShort
+	}
+	if depth > maxMsgpackDepth {
+		return nil, nil, errors.New("msgpack: nested too deep")
+	}
+	t, b := b[0], b[1:]
+	switch {
+	case t < 0x80:
+		return json.Number(fmt.Sprint(t)), b, nil
+	case t >= 0xe0:
+		return json.Number(fmt.Sprint(int8(t))), b, nil
+	case t&0xf0 == 0x80:
+		return readMap(b, int(t&0x0f), depth)
+	case t&0xf0 == 0x90:
+		return readArray(b, int(t&0x0f), depth)
+	case t&0xe0 == 0xa0:
+		return readString(b, int(t&0x1f))
+	}
+	switch t {
+	case 0xc0:
+		return nil, b, nil
+	case 0xc2, 0xc3:
+		return t == 0xc3, b, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, b, err := readUint(b, 1<<(t-0xc4))
+		if err != nil {
+			return nil, nil, err
+		}
+		if uint64(len(b)) < n {
+			return nil, nil, errMsgpackShort
+		}
+		return append([]byte(nil), b[:n]...), b[n:], nil
+	case 0xca:
+		u, b, err := readUint(b, 4)
+		if err != nil {
+			return nil, nil, err
+		}
+		return floatNumber(float64(math.Float32frombits(uint32(u))), b)
+	case 0xcb:
+		u, b, err := readUint(b, 8)
+		if err != nil {
+			return nil, nil, err
+		}
+		return floatNumber(math.Float64frombits(u), b)
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, b, err := readUint(b, 1<<(t-0xcc))
+		if err != nil {
+			return nil, nil, err
+		}
+		return json.Number(fmt.Sprint(u)), b, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (t - 0xd0)
+		u, b, err := readUint(b, size)
+		if err != nil {
+			return nil, nil, err
+		}
+		shift := 64 - 8*size
+		return json.Number(fmt.Sprint(int64(u<<shift) >> shift)), b, nil
+	case 0xd9, 0xda, 0xdb:
+		n, b, err := readUint(b, 1<<(t-0xd9))
+		if err != nil {
+			return nil, nil, err
+		}
+		return readString(b, int(min(n, uint64(len(b)+1))))
+	case 0xdc, 0xdd:
+		n, b, err := readUint(b, 2<<(t-0xdc))
+		if err != nil {
+			return nil, nil, err
+		}
+		return readArray(b, int(min(n, uint64(len(b)+1))), depth)
+	case 0xde, 0xdf:
+		n, b, err := readUint(b, 2<<(t-0xde))
+		if err != nil {
+			return nil, nil, err
+		}
+		return readMap(b, int(min(n, uint64(len(b)+1))), depth)
+	}
+	return nil, nil, fmt.Errorf("msgpack: unsupported type 0x%02x", t)
+}
+
+func readUint(b []byte, size int) (uint64, []byte, error) {
+	if len(b) < size {
+		return 0, nil, errMsgpackShort
+	}
+	var u uint64
+	for _, c := range b[:size] {
+		u = u<<8 | uint64(c)
+	}
+	return u, b[size:], nil
+}
+
+func readString(b []byte, n int) (any, []byte, error) {
+	if len(b) < n {
+		return nil, nil, errMsgpackShort
+	}
+	return string(b[:n]), b[n:], nil
+}
+
+// readArray reads n elements. Every element takes at least a byte, so
+// callers cap n at len(b)+1 and a bogus length fails without allocating.
+func readArray(b []byte, n, depth int) (any, []byte, error) {
+	if n > len(b) {
+		return nil, nil, errMsgpackShort
+	}
+	out := make([]any, n)
+	for i := range out {
+		var err error
+		if out[i], b, err = readMsgpack(b, depth+1); err != nil {
+			return nil, nil, err
+		}
+	}
+	return out, b, nil
+}
+
+func readMap(b []byte, n, depth int) (any, []byte, error) {
+	if 2*n > len(b) {
+		return nil, nil, errMsgpackShort
+	}
+	out := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		k, rest, err := readMsgpack(b, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, nil, errors.New("msgpack: map key is not a string")
+		}
+		if out[key], b, err = readMsgpack(rest, depth+1); err != nil {
+			return nil, nil, err
+		}
+	}
+	return out, b, nil
+}
+
+// floatNumber is f as a json.Number; JSON has no NaN or infinities.
+func floatNumber(f float64, b []byte) (any, []byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, nil, errors.New("msgpack: number out of range")
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), b, nil
+}
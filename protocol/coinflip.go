@@ -0,0 +1,42 @@
+package protocol
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// A coin_flip game commits to its coin, a random nonce in hex, before the
+// second player joins: CoinCommitment is the SHA-256 of the nonce's bytes,
+// in hex. The flip reveals the nonce, and the starter is read off it: its
+// first eight bytes as a big-endian number, modulo the number of seats,
+// picks from X, O and Δ in that order. VerifyCoinFlip is the check a
+// client makes on coin_flip.
+
+// CoinCommitment is the commitment to nonce, or "" if nonce isn't hex.
+func CoinCommitment(nonce string) string {
+	b, err := hex.DecodeString(nonce)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// CoinStarter is which of symbols the coin nonce picks to start, or "" if
+// nonce is shorter than eight bytes or isn't hex.
+func CoinStarter(nonce string, symbols []string) string {
+	b, err := hex.DecodeString(nonce)
+	if err != nil || len(b) < 8 || len(symbols) == 0 {
+		return ""
+	}
+	return symbols[binary.BigEndian.Uint64(b)%uint64(len(symbols))]
+}
+
+// VerifyCoinFlip reports whether nonce matches commitment and picks
+// starter from symbols.
+func VerifyCoinFlip(commitment, nonce, starter string, symbols []string) bool {
+	want := CoinCommitment(nonce)
+	return want != "" && subtle.ConstantTimeCompare([]byte(want), []byte(commitment)) == 1 && CoinStarter(nonce, symbols) == starter
+}
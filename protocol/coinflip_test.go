@@ -0,0 +1,62 @@
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+const zeroNonce = "0000000000000000"
+
+func TestCoinCommitment(t *testing.T) {
+	// SHA-256 of eight zero bytes
+	if got, want := CoinCommitment(zeroNonce), "af5570f5a1810b7af78caf4bc70a660f0df51e42baf91d4de5b2328de0e83dfc"; got != want {
+		t.Errorf("CoinCommitment(%s) = %s, want %s", zeroNonce, got, want)
+	}
+	if got := CoinCommitment("not hex"); got != "" {
+		t.Errorf("CoinCommitment of a nonce that isn't hex = %q, want none", got)
+	}
+}
+
+func TestCoinStarter(t *testing.T) {
+	two, three := []string{"X", "O"}, []string{"X", "O", "Δ"}
+	tests := []struct {
+		nonce   string
+		symbols []string
+		want    string
+	}{
+		{zeroNonce, two, "X"},
+		{"0000000000000001", two, "O"},
+		{"0000000000000002", two, "X"},
+		{"0000000000000002", three, "Δ"},
+		{"ffffffffffffffff", three, "X"}, // 2⁶⁴-1 is a multiple of 3
+		{"0000000000000001ff", two, "O"}, // Only the first eight bytes count
+		{"00000000000001", two, ""},      // Seven bytes
+		{"zz00000000000000", two, ""},
+		{zeroNonce, nil, ""},
+	}
+	for _, tt := range tests {
+		if got := CoinStarter(tt.nonce, tt.symbols); got != tt.want {
+			t.Errorf("CoinStarter(%s, %v) = %q, want %q", tt.nonce, tt.symbols, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyCoinFlip(t *testing.T) {
+	symbols := []string{"X", "O"}
+	nonce := "0123456789abcdef"
+	commitment, starter := CoinCommitment(nonce), CoinStarter(nonce, symbols)
+	if !VerifyCoinFlip(commitment, nonce, starter, symbols) {
+		t.Fatalf("an honest flip of %s, starting %s, didn't verify", nonce, starter)
+	}
+	other := map[string]string{"X": "O", "O": "X"}[starter]
+	for name, ok := range map[string]bool{
+		"another starter":          VerifyCoinFlip(commitment, nonce, other, symbols),
+		"another nonce":            VerifyCoinFlip(commitment, "0123456789abcdee", starter, symbols),
+		"a commitment in capitals": VerifyCoinFlip(strings.ToUpper(commitment), nonce, starter, symbols),
+		"a nonce that isn't hex":   VerifyCoinFlip("", "not hex", "", symbols),
+	} {
+		if ok {
+			t.Errorf("verified with %s", name)
+		}
+	}
+}
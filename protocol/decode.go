@@ -0,0 +1,48 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrMalformed          = errors.New("malformed message")
+	ErrUnsupportedVersion = errors.New("unsupported protocol version")
+)
+
+// Decode parses and validates one inbound websocket frame. A message
+// without "v" is read as the oldest version in Versions. Errors wrap
+// ErrMalformed for anything that isn't a JSON object of the right shape,
+// ErrUnsupportedVersion, or whatever Validate found.
+func Decode(data []byte) (InboundMessage, error) {
+	return DecodeAs(JSON, data)
+}
+
+// DecodeAs is Decode for a frame in encoding c.
+func DecodeAs(c Codec, data []byte) (InboundMessage, error) {
+	var m InboundMessage
+	if err := c.Unmarshal(data, &m); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return InboundMessage{}, fmt.Errorf("%w: %s must be %s, not %s", ErrMalformed, typeErr.Field, typeErr.Type, typeErr.Value)
+		}
+		return InboundMessage{}, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if m.V == 0 {
+		m.V = Versions[0]
+	}
+	if !speaks(m.V) {
+		return m, fmt.Errorf("%w %d", ErrUnsupportedVersion, m.V)
+	}
+	return m, m.Validate()
+}
+
+func speaks(v int) bool {
+	for _, known := range Versions {
+		if v == known {
+			return true
+		}
+	}
+	return false
+}
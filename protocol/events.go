@@ -0,0 +1,270 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// MaxBoardSize is the most rows and columns a game's board can have. A move
+// inside it may still be off a smaller game's board; the server checks that.
+const MaxBoardSize = 10
+
+// Board is the grid as sent on the wire; rows of "", "X" or "O".
+type Board [][]string
+
+// NewBoard copies b for a message, so later moves can't change what a
+// queued message says.
+func NewBoard(b [][]string) *Board {
+	c := make(Board, len(b))
+	for r := range b {
+		c[r] = append([]string(nil), b[r]...)
+	}
+	return &c
+}
+
+// CellChange is one cell a delta move changed, and its value now: a mark,
+// or "" where one was cleared.
+type CellChange struct {
+	Row   int    `json:"row"`
+	Col   int    `json:"col"`
+	Value string `json:"value"`
+}
+
+// Changes lists the cells where to differs from b, row by row. ok is false
+// if the boards aren't the same size, which only the full board can say.
+func (b Board) Changes(to Board) (changes []CellChange, ok bool) {
+	if len(b) != len(to) {
+		return nil, false
+	}
+	for r := range b {
+		if len(b[r]) != len(to[r]) {
+			return nil, false
+		}
+		for c := range b[r] {
+			if b[r][c] != to[r][c] {
+				changes = append(changes, CellChange{Row: r, Col: c, Value: to[r][c]})
+			}
+		}
+	}
+	return changes, true
+}
+
+// Apply sets the changed cells on b. It reports false, changing nothing, if
+// a cell is off the board, and the client should ask for a state_sync.
+func (b Board) Apply(changes []CellChange) bool {
+	for _, ch := range changes {
+		if ch.Row < 0 || ch.Row >= len(b) || ch.Col < 0 || ch.Col >= len(b[ch.Row]) {
+			return false
+		}
+	}
+	for _, ch := range changes {
+		b[ch.Row][ch.Col] = ch.Value
+	}
+	return true
+}
+
+// Event names the kind of a websocket message.
+type Event string
+
+// Inbound events, sent by clients.
+const (
+	EventMakeMove       Event = "make_move"
+	EventRematchRequest Event = "rematch_request"
+	EventRematchDecline Event = "rematch_decline" // Turns down the pending rematch offer
+	EventAbortRequest   Event = "abort_request"
+	EventAbortAccept    Event = "abort_accept"
+	EventTimeSync       Event = "time_sync" // Also the reply
+	EventReady          Event = "ready"     // Answers a ready_check
+	EventClaimSeat      Event = "claim_seat"
+	EventConfirmMove    Event = "confirm_move" // Commits the move_pending under ?confirm_moves=1
+	EventCancelMove     Event = "cancel_move"
+	EventChat           Event = "chat" // Also relayed, with From, to everyone in the game
+
+	EventNewSeries Event = "new_series" // Starts the next best-of series after series_over
+
+	EventUndoRequest Event = "undo_request" // Asks to take back the sender's last move
+	EventUndoAccept  Event = "undo_accept"
+	EventUndoDecline Event = "undo_decline"
+
+	EventSwapRequest Event = "swap_request" // Asks the opponent to trade symbols, before a round's first move or after its end
+	EventSwapAccept  Event = "swap_accept"
+	EventSwapDecline Event = "swap_decline"
+
+	EventConcede Event = "concede" // Gives up the round; also broadcast, with Player the winner
+
+	EventConfigure      Event = "configure"       // Sets the game's options while the first player waits alone
+	EventAcceptSettings Event = "accept_settings" // The second player agrees to them
+
+	EventSyncRequest Event = "sync"         // Asks for a state_sync, to the sender only
+	EventHintRequest Event = "hint_request" // Asks for a hint, once per turn, to the sender only
+	EventResendFrom  Event = "resend_from"  // Asks for the broadcasts from StateVersion on again, to the sender only
+	EventPong        Event = "pong"         // Answers a ping with its Nonce
+
+	EventKick Event = "kick" // The host removes Target, a seat's symbol or a spectator's ID; Ban keeps them out
+
+	// Ephemeral, relayed to the other players only while the round is on
+	EventCursor Event = "cursor" // The cell, Row and Col, the player is hovering over
+	EventEmote  Event = "emote"  // One of Emotes, in Emote
+)
+
+// Emotes are the emote values a client may send.
+var Emotes = []string{"thumbs_up", "clap", "laugh", "wow", "thinking", "sad", "angry", "wave"}
+
+// Outbound events, sent by the server. Errors carry no event, only Error
+// and Code.
+const (
+	EventPlayerAssignment Event = "player_assignment"
+	EventStartGame        Event = "start_game"
+	EventMove             Event = "move"
+	EventWin              Event = "win"
+	EventDraw             Event = "draw"
+	EventNewGame          Event = "new_game"
+	EventSync             Event = "sync"
+	EventStateSync        Event = "state_sync" // Answers sync with everything needed to rebuild the UI
+	EventHint             Event = "hint"       // Answers hint_request with a suggested Row and Col
+	EventOpponentLeft     Event = "opponent_left"
+	EventOpponentAFK      Event = "opponent_afk"
+	EventOpponentIdle     Event = "opponent_idle"   // To the others: Player has been quiet on their turn for a while
+	EventOpponentActive   Event = "opponent_active" // To the others: the idle Player moved
+	EventResumed          Event = "resumed"
+	EventRematchRequested Event = "rematch_requested" // Player offered a rematch; the first request does
+	EventRematchDeclined  Event = "rematch_declined"  // Player's rematch offer was turned down
+	EventAbortRequested   Event = "abort_requested"
+	EventGameAborted      Event = "game_aborted"
+	EventTurnReminder     Event = "your_turn_reminder"
+	EventGameExpiring     Event = "game_expiring"
+	EventGameExpired      Event = "game_expired" // Last message before the server closes an idle game's sockets
+	EventGameClosed       Event = "game_closed"  // Last message before an admin tears the game down
+	EventServerShutdown   Event = "server_shutdown"
+	EventSuperseded       Event = "superseded"          // Last message to a connection whose seat its client took up on another
+	EventKicked           Event = "kicked"              // Last message to a connection the host kicked; Code is kicked, banned_from_game or kicked_suspicious
+	EventHostChanged      Event = "host_changed"        // The host left; From is the player who may kick now
+	EventSuspicious       Event = "suspicious_activity" // To the others: Player's connection keeps sending moves it can't make
+	EventLatency          Event = "latency"             // Every player's smoothed round trip, in Latency
+	EventPing             Event = "ping"                // Answer with a pong carrying Nonce; it measures the round trip
+	EventReadyCheck       Event = "ready_check"
+	EventOpponentReady    Event = "opponent_ready"
+	EventReadyCancelled   Event = "ready_check_cancelled"
+
+	EventSpectatorAssignment Event = "spectator_assignment"
+	EventSeatOpen            Event = "seat_open" // To spectators, when a seat can be claimed
+	EventOpponentJoined      Event = "opponent_joined"
+	EventSpectatorCount      Event = "spectator_count" // When someone starts or stops watching
+
+	EventGameScheduled Event = "game_scheduled" // To early arrivals; Deadline is the start time
+	EventCountdown     Event = "countdown"
+	EventGameStarting  Event = "game_starting" // The round begins at StartsAt; moves before then are too_early
+	EventForfeit       Event = "forfeit"       // The game ended by forfeit; Player is the winner and Code says why
+
+	EventMovePending   Event = "move_pending"   // To the mover only; Row and Col await confirm_move
+	EventMoveCancelled Event = "move_cancelled" // To the mover only; the pending move was discarded
+	EventInvalidMove   Event = "invalid_move"   // To the mover only; Code says why the make_move was refused
+
+	EventTurnTimer   Event = "turn_timer"   // A turn started; Player has until Deadline to move
+	EventTimeoutWin  Event = "timeout_win"  // Player won the round because the opponent ran out of time
+	EventFlagFall    Event = "flag_fall"    // Player won the round because the opponent's time control ran out
+	EventTurnSkipped Event = "turn_skipped" // Player ran out of time and the turn passed to CurrentPlayer
+
+	EventLobbyUpdate Event = "lobby_update" // On the lobby socket only: the tenant's joinable public games
+
+	// On the quick match socket only
+	EventQueued     Event = "queued"      // Waiting in the queue for an opponent
+	EventMatchFound Event = "match_found" // GameID's seat Player is held for Token; join at ReconnectURL
+
+	EventSeriesOver         Event = "series_over"          // Player won the best-of series; play waits for new_series
+	EventRoundAdjudicated   Event = "round_adjudicated"    // The round's deadline passed; Player won it from the position, or no one for a draw. Code says which
+	EventSeriesAdjudicated  Event = "series_adjudicated"   // The series' deadline passed; Player leads on score, or no one if level. Play waits for new_series
+	EventNewSeriesRequested Event = "new_series_requested" // Player asked for the next series
+	EventSeriesSummary      Event = "series_summary"       // A max_rounds series played its last round; Result is the winner or "tied". Play waits for new_series
+	EventCoinFlip           Event = "coin_flip"            // The coin picked Player to start round 1; CoinNonce reveals the coin CoinCommitment committed to
+
+	EventUndoRequested Event = "undo_requested" // Player asked to take back their last move
+	EventUndoDeclined  Event = "undo_declined"  // Player's undo was refused
+	EventUndoApplied   Event = "undo_applied"   // The board after the undo, with Player on turn
+
+	EventSwapRequested Event = "swap_requested" // Player offered to trade symbols
+	EventSwapDeclined  Event = "swap_declined"  // Player's offer was turned down, or lapsed; Code says which
+	EventSeatsSwapped  Event = "seats_swapped"  // The players traded symbols: Names and Score as they now stand. A player_assignment follows for each
+
+	EventSettings Event = "settings" // The options Player set; with Code settings_offered, waiting on accept_settings
+
+	// On the daily puzzle socket only
+	EventPuzzle       Event = "puzzle"        // The position, with Player to play for Goal in MovesLeft moves
+	EventPuzzleFailed Event = "puzzle_failed" // The move left the line: the Refutation to it, and the Solution that kept it
+	EventPuzzleSolved Event = "puzzle_solved" // The Goal was reached
+)
+
+var (
+	ErrUnknownEvent = errors.New("unknown event")
+	ErrOffBoard     = errors.New("off the board") // A make_move cell outside the grid
+)
+
+// Validate checks that the event is one clients may send and that the
+// fields it needs are present and in range.
+func (m InboundMessage) Validate() error {
+	switch m.Event {
+	case EventMakeMove:
+		if m.Row == nil || m.Col == nil {
+			return errors.New("make_move needs row and col")
+		}
+		if *m.Row < 0 || *m.Row >= MaxBoardSize || *m.Col < 0 || *m.Col >= MaxBoardSize {
+			return fmt.Errorf("cell (%d, %d) is %w", *m.Row, *m.Col, ErrOffBoard)
+		}
+	case EventTimeSync:
+		if m.ClientTS == 0 {
+			return errors.New("time_sync needs client_ts")
+		}
+	case EventChat:
+		if m.Text == "" {
+			return errors.New("chat needs text")
+		}
+	case EventCursor:
+		if m.Row == nil || m.Col == nil {
+			return errors.New("cursor needs row and col")
+		}
+		if *m.Row < 0 || *m.Row >= MaxBoardSize || *m.Col < 0 || *m.Col >= MaxBoardSize {
+			return fmt.Errorf("cursor cell (%d, %d) is off the board", *m.Row, *m.Col)
+		}
+	case EventEmote:
+		if !slices.Contains(Emotes, m.Emote) {
+			return fmt.Errorf("unknown emote %q", m.Emote)
+		}
+	case EventKick:
+		if m.Target == "" {
+			return errors.New("kick needs target")
+		}
+	case EventConfigure:
+		if m.Settings == nil {
+			return errors.New("configure needs settings")
+		}
+	case EventResendFrom:
+		if m.StateVersion == 0 {
+			return errors.New("resend_from needs state_version")
+		}
+	case EventPong:
+		if m.Nonce == "" {
+			return errors.New("pong needs nonce")
+		}
+	case EventRematchRequest, EventRematchDecline, EventAbortRequest, EventAbortAccept, EventReady, EventClaimSeat, EventConfirmMove, EventCancelMove, EventNewSeries, EventUndoRequest, EventUndoAccept, EventUndoDecline, EventSwapRequest, EventSwapAccept, EventSwapDecline, EventConcede, EventAcceptSettings, EventSyncRequest, EventHintRequest:
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownEvent, m.Event)
+	}
+	return nil
+}
+
+// BoardState is an event carrying the full round state.
+func BoardState(e Event, board [][]string, current string, score *Score) OutboundMessage {
+	return OutboundMessage{Event: e, Board: NewBoard(board), CurrentPlayer: current, Score: score}
+}
+
+// Notice is an event whose only content is a localizable code.
+func Notice(e Event, code string) OutboundMessage {
+	return OutboundMessage{Event: e, Code: code}
+}
+
+// Failure is an error reply. The server localizes Error from Code; detail
+// is for developers and stays in English.
+func Failure(code, detail string) OutboundMessage {
+	return OutboundMessage{Error: code, Code: code, Detail: detail}
+}
@@ -0,0 +1,186 @@
+package protocol
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func intp(i int) *int { return &i }
+
+// declaredEvents reads the Event constants events.go declares in the const
+// block whose doc comment starts with heading, so a new event can't be
+// added without the tests below noticing.
+func declaredEvents(t *testing.T, heading string) []Event {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "events.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []Event
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST || gen.Doc == nil || !strings.HasPrefix(gen.Doc.Text(), heading) {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			for _, v := range spec.(*ast.ValueSpec).Values {
+				lit, ok := v.(*ast.BasicLit)
+				if !ok {
+					continue
+				}
+				s, err := strconv.Unquote(lit.Value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				out = append(out, Event(s))
+			}
+		}
+	}
+	if len(out) == 0 {
+		t.Fatalf("no events under %q in events.go", heading)
+	}
+	return out
+}
+
+// validInbound is a smallest message that passes Validate for each
+// inbound event.
+var validInbound = map[Event]InboundMessage{
+	EventMakeMove:       {Event: EventMakeMove, Row: intp(0), Col: intp(0)},
+	EventRematchRequest: {Event: EventRematchRequest},
+	EventRematchDecline: {Event: EventRematchDecline},
+	EventAbortRequest:   {Event: EventAbortRequest},
+	EventAbortAccept:    {Event: EventAbortAccept},
+	EventTimeSync:       {Event: EventTimeSync, ClientTS: 1},
+	EventReady:          {Event: EventReady},
+	EventClaimSeat:      {Event: EventClaimSeat},
+	EventConfirmMove:    {Event: EventConfirmMove},
+	EventCancelMove:     {Event: EventCancelMove},
+	EventChat:           {Event: EventChat, Text: "hi"},
+	EventNewSeries:      {Event: EventNewSeries},
+	EventUndoRequest:    {Event: EventUndoRequest},
+	EventUndoAccept:     {Event: EventUndoAccept},
+	EventUndoDecline:    {Event: EventUndoDecline},
+	EventSwapRequest:    {Event: EventSwapRequest},
+	EventSwapAccept:     {Event: EventSwapAccept},
+	EventSwapDecline:    {Event: EventSwapDecline},
+	EventConcede:        {Event: EventConcede},
+	EventConfigure:      {Event: EventConfigure, Settings: &Settings{}},
+	EventAcceptSettings: {Event: EventAcceptSettings},
+	EventSyncRequest:    {Event: EventSyncRequest},
+	EventHintRequest:    {Event: EventHintRequest},
+	EventResendFrom:     {Event: EventResendFrom, StateVersion: 1},
+	EventPong:           {Event: EventPong, Nonce: "n"},
+	EventKick:           {Event: EventKick, Target: "O"},
+	EventCursor:         {Event: EventCursor, Row: intp(MaxBoardSize - 1), Col: intp(0)},
+	EventEmote:          {Event: EventEmote, Emote: Emotes[0]},
+}
+
+func TestValidateAcceptsEveryInboundEvent(t *testing.T) {
+	for _, e := range declaredEvents(t, "Inbound events") {
+		m, ok := validInbound[e]
+		if !ok {
+			t.Errorf("no valid %s message in validInbound", e)
+			continue
+		}
+		if err := m.Validate(); err != nil {
+			t.Errorf("Validate(%+v) = %v", m, err)
+		}
+	}
+	for _, emote := range Emotes {
+		if err := (InboundMessage{Event: EventEmote, Emote: emote}).Validate(); err != nil {
+			t.Errorf("emote %q: %v", emote, err)
+		}
+	}
+}
+
+func TestValidateRejectsOutboundEvents(t *testing.T) {
+	for _, e := range declaredEvents(t, "Outbound events") {
+		if _, inbound := validInbound[e]; inbound {
+			continue // Named the same both ways, like sync and time_sync
+		}
+		err := InboundMessage{Event: e}.Validate()
+		if !errors.Is(err, ErrUnknownEvent) {
+			t.Errorf("Validate(%s) = %v, want ErrUnknownEvent", e, err)
+		}
+	}
+	for _, e := range []Event{"", "MAKE_MOVE", "make_move ", "no_such_event"} {
+		if err := (InboundMessage{Event: e}).Validate(); !errors.Is(err, ErrUnknownEvent) {
+			t.Errorf("Validate(%q) = %v, want ErrUnknownEvent", e, err)
+		}
+	}
+}
+
+func TestValidateRejectsMissingOrBadFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      InboundMessage
+		offBoard bool
+	}{
+		{"make_move without row or col", InboundMessage{Event: EventMakeMove}, false},
+		{"make_move without col", InboundMessage{Event: EventMakeMove, Row: intp(0)}, false},
+		{"make_move without row", InboundMessage{Event: EventMakeMove, Col: intp(0)}, false},
+		{"make_move negative row", InboundMessage{Event: EventMakeMove, Row: intp(-1), Col: intp(0)}, true},
+		{"make_move negative col", InboundMessage{Event: EventMakeMove, Row: intp(0), Col: intp(-1)}, true},
+		{"make_move row past the largest board", InboundMessage{Event: EventMakeMove, Row: intp(MaxBoardSize), Col: intp(0)}, true},
+		{"make_move col past the largest board", InboundMessage{Event: EventMakeMove, Row: intp(0), Col: intp(MaxBoardSize)}, true},
+		{"time_sync without client_ts", InboundMessage{Event: EventTimeSync}, false},
+		{"chat without text", InboundMessage{Event: EventChat}, false},
+		{"cursor without row", InboundMessage{Event: EventCursor, Col: intp(0)}, false},
+		{"cursor off the board", InboundMessage{Event: EventCursor, Row: intp(0), Col: intp(MaxBoardSize)}, false},
+		{"cursor negative", InboundMessage{Event: EventCursor, Row: intp(-1), Col: intp(0)}, false},
+		{"emote missing", InboundMessage{Event: EventEmote}, false},
+		{"emote unknown", InboundMessage{Event: EventEmote, Emote: "dance"}, false},
+		{"kick without target", InboundMessage{Event: EventKick}, false},
+		{"configure without settings", InboundMessage{Event: EventConfigure}, false},
+		{"resend_from without state_version", InboundMessage{Event: EventResendFrom}, false},
+		{"pong without nonce", InboundMessage{Event: EventPong}, false},
+	}
+	for _, tt := range tests {
+		err := tt.msg.Validate()
+		if err == nil {
+			t.Errorf("%s: Validate passed", tt.name)
+			continue
+		}
+		if errors.Is(err, ErrOffBoard) != tt.offBoard {
+			t.Errorf("%s: Validate = %v; ErrOffBoard %v, want %v", tt.name, err, !tt.offBoard, tt.offBoard)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   string
+		wantErr error // nil for a valid frame; otherwise what it must wrap, or errAny
+		wantV   int
+	}{
+		{"no version reads as the oldest", `{"event":"make_move","row":1,"col":2}`, nil, Versions[0]},
+		{"v2", `{"v":2,"event":"chat","text":"hi"}`, nil, V2},
+		{"unsupported version", `{"v":99,"event":"chat","text":"hi"}`, ErrUnsupportedVersion, 99},
+		{"not JSON", `make_move`, ErrMalformed, 0},
+		{"not an object", `["make_move"]`, ErrMalformed, 0},
+		{"row as a string", `{"event":"make_move","row":"1","col":2}`, ErrMalformed, 0},
+		{"unknown event", `{"event":"nope"}`, ErrUnknownEvent, Versions[0]},
+		{"off the board", `{"event":"make_move","row":10,"col":0}`, ErrOffBoard, Versions[0]},
+		{"missing field", `{"event":"pong"}`, errAny, Versions[0]},
+	}
+	for _, tt := range tests {
+		m, err := Decode([]byte(tt.frame))
+		switch {
+		case tt.wantErr == nil && err != nil:
+			t.Errorf("%s: Decode = %v", tt.name, err)
+		case tt.wantErr == errAny && err == nil, tt.wantErr != nil && tt.wantErr != errAny && !errors.Is(err, tt.wantErr):
+			t.Errorf("%s: Decode = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if tt.wantV != 0 && m.V != tt.wantV {
+			t.Errorf("%s: V = %d, want %d", tt.name, m.V, tt.wantV)
+		}
+	}
+}
+
+var errAny = errors.New("any error")
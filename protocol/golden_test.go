@@ -0,0 +1,154 @@
+package protocol
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// The golden files pin what each codec and wire version puts on the wire,
+// byte for byte, so a change to a struct tag or to the MessagePack
+// encoder shows up as a diff to review rather than as broken clients.
+// After a deliberate change, regenerate them with
+//
+//	go test ./protocol -run TestGolden -update
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenMessages cover every shape the codecs treat differently: a full
+// board, a delta move without one, the win cues, a packed board, an error
+// and a message with no round state at all.
+var goldenMessages = []struct {
+	name string
+	msg  OutboundMessage
+}{
+	{"start_game", OutboundMessage{
+		Event:         EventStartGame,
+		Board:         NewBoard([][]string{{"", "", ""}, {"", "", ""}, {"", "", ""}}),
+		CurrentPlayer: "X",
+		Score:         &Score{X: 1, O: 2, Draws: 1},
+		Participants:  []Participant{{ID: "p1", Role: "player", Symbol: "X", Name: "Ann", Host: true}, {ID: "p2", Role: "player", Symbol: "O"}},
+		Names:         map[string]string{"X": "Ann", "O": "Bob"},
+		Size:          3,
+		Spectators:    intp(0),
+		StateVersion:  1,
+	}},
+	{"move_delta", OutboundMessage{
+		Event:        EventMove,
+		Player:       "X",
+		Row:          intp(1),
+		Col:          intp(1),
+		Symbol:       "X",
+		Seq:          2,
+		Changes:      []CellChange{{Row: 1, Col: 1, Value: "X"}},
+		MoveNumber:   1,
+		LastMove:     &LastMove{Row: 1, Col: 1, Player: "X", MoveNumber: 1},
+		StateVersion: 2,
+	}},
+	{"win", OutboundMessage{
+		Event:         EventWin,
+		Player:        "X",
+		Board:         NewBoard([][]string{{"X", "O", ""}, {"", "X", "O"}, {"", "", "X"}}),
+		CurrentPlayer: "O",
+		Score:         &Score{X: 2, O: 2, Draws: 1},
+		Win:           &Win{Condition: "line", Cells: [][2]int{{0, 0}, {1, 1}, {2, 2}}},
+		WinningLine:   [][][2]int{{{0, 0}, {1, 1}, {2, 2}}},
+		WinType:       "diag",
+		LastMove:      &LastMove{Row: 2, Col: 2, Player: "X", MoveNumber: 5},
+		RoundStats:    &RoundSummary{Round: 4, Result: "X", DurationMS: 12000, Moves: 5},
+		StateVersion:  7,
+	}},
+	{"packed", OutboundMessage{
+		Event:         EventStateSync,
+		BoardPacked:   []byte{0x90, 0x24, 0x01},
+		CurrentPlayer: "O",
+		Score:         &Score{X: 0, O: 0, Third: 1},
+		StateVersion:  3,
+	}},
+	{"error", OutboundMessage{
+		Error:   "not_your_turn",
+		Code:    "not_your_turn",
+		Message: "It's not your turn.",
+	}},
+	{"notice", OutboundMessage{Event: EventOpponentLeft, Code: "opponent_left", Player: "O"}},
+}
+
+var goldenCodecs = []struct {
+	codec Codec
+	ext   string
+}{
+	{JSON, "json"},
+	{MsgPack, "msgpack"},
+}
+
+func TestGolden(t *testing.T) {
+	for _, enc := range goldenCodecs {
+		for _, v := range []int{V1, V2} {
+			c := ForVersion(enc.codec, v)
+			for _, tt := range goldenMessages {
+				name := tt.name + ".v" + strconv.Itoa(v) + "." + enc.ext
+				t.Run(name, func(t *testing.T) {
+					got, err := c.Marshal(tt.msg)
+					if err != nil {
+						t.Fatal(err)
+					}
+					path := filepath.Join("testdata", name)
+					if *update {
+						if err := os.WriteFile(path, got, 0o644); err != nil {
+							t.Fatal(err)
+						}
+					}
+					want, err := os.ReadFile(path)
+					if err != nil {
+						t.Fatalf("%v; run with -update to create it", err)
+					}
+					if !bytes.Equal(got, want) {
+						t.Errorf("encoding changed:\n got %q\nwant %q", got, want)
+					}
+
+					// And what the file holds reads back as the message
+					var back OutboundMessage
+					if err := c.Unmarshal(want, &back); err != nil {
+						t.Fatal(err)
+					}
+					if !reflect.DeepEqual(back, tt.msg) {
+						t.Errorf("decoded %+v, want %+v", back, tt.msg)
+					}
+				})
+			}
+		}
+	}
+}
+
+// TestGoldenInbound checks that a client's make_move decodes the same in
+// both encodings; inbound messages don't change between versions.
+func TestGoldenInbound(t *testing.T) {
+	want := InboundMessage{V: V2, Event: EventMakeMove, Row: intp(2), Col: intp(0)}
+	for _, enc := range goldenCodecs {
+		path := filepath.Join("testdata", "make_move."+enc.ext)
+		if *update {
+			data, err := enc.codec.Marshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%v; run with -update to create it", err)
+		}
+		var got InboundMessage
+		if err := enc.codec.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: %v", enc.ext, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: decoded %+v, want %+v", enc.ext, got, want)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+// Package protocol defines the messages exchanged over the game websocket,
+// in JSON or MessagePack (see Codec). Both the server and the Go client use these types so the wire
+// format can't drift between them.
+package protocol
+
+import (
+	"time"
+
+	"tictactoe/rating"
+)
+
+// Versions lists the websocket protocol versions this build speaks; see
+// version.go for how they differ.
+var Versions = []int{V1, V2}
+
+// Score counts the rounds each symbol has won, and the drawn ones. Wins
+// are read and counted by symbol through Of and Add. The third player's
+// wins go out as "Δ" once there are any, so a two-player score is just X,
+// O and draws.
+type Score struct {
+	X     int `json:"X"`
+	O     int `json:"O"`
+	Third int `json:"Δ,omitempty"`
+	Draws int `json:"draws"`
+}
+
+// Add counts a round won by symbol.
+func (s *Score) Add(symbol string) {
+	switch symbol {
+	case "X":
+		s.X++
+	case "O":
+		s.O++
+	case "Δ":
+		s.Third++
+	}
+}
+
+// Of is the number of rounds symbol has won.
+func (s Score) Of(symbol string) int {
+	switch symbol {
+	case "X":
+		return s.X
+	case "O":
+		return s.O
+	case "Δ":
+		return s.Third
+	}
+	return 0
+}
+
+// Participant identifies a connection in messages it originated. ID is
+// stable for the life of the connection, unlike the symbol it sits in.
+type Participant struct {
+	ID     string `json:"id"`
+	Role   string `json:"role"`
+	Symbol string `json:"symbol,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Host   bool   `json:"host,omitempty"` // The player who may kick others; see kick
+}
+
+// Win describes how a round was won: the condition's name ("line",
+// "corners", ...) and the [row, col] cells that satisfied it.
+type Win struct {
+	Condition string   `json:"condition"`
+	Cells     [][2]int `json:"cells"`
+}
+
+// UltimateBoard is the sub-board view of an ultimate game's board:
+// SubBoards holds "X" or "O" for a won sub-board, "draw" for a full one and
+// "" for one still open, and Next is the [row, col] of the sub-board the
+// next move must be played in, absent when any open one will do.
+type UltimateBoard struct {
+	SubBoards [][]string `json:"sub_boards"`
+	Next      *[2]int    `json:"next_board,omitempty"`
+}
+
+// RoundSummary is how one finished round went, for a history strip.
+type RoundSummary struct {
+	Round      int    `json:"round"`
+	Result     string `json:"result"` // Winning symbol, or "draw"
+	DurationMS int64  `json:"duration_ms"`
+	Moves      int    `json:"moves"`
+}
+
+// LastMove is the latest mark on the board: where, who played it and
+// which of the round's moves it was, counting skipped turns.
+type LastMove struct {
+	Row        int    `json:"row"`
+	Col        int    `json:"col"`
+	Player     string `json:"player"`
+	MoveNumber int    `json:"move_number"`
+}
+
+// Cell is one square of the board.
+type Cell struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+// OpeningStat is how the rounds opened on one cell have gone: how many
+// there were, and how many of them the player who opened won and drew.
+type OpeningStat struct {
+	Row     int     `json:"row"`
+	Col     int     `json:"col"`
+	Rounds  int     `json:"rounds"`
+	Wins    int     `json:"wins"`
+	Draws   int     `json:"draws"`
+	WinRate float64 `json:"win_rate"` // Wins over Rounds
+}
+
+// Settings are the options a game's first player sets with configure
+// before anyone else joins. Absent fields are left as they were.
+type Settings struct {
+	First     string `json:"first,omitempty"`      // Who starts round 1, "X" or "O"
+	TurnTimer *int   `json:"turn_timer,omitempty"` // Seconds per move; 0 for no limit
+	BestOf    *int   `json:"best_of,omitempty"`    // Rounds in a series, 3, 5, 7 and so on; 0 for none
+	Size      int    `json:"size,omitempty"`       // Rows and columns
+}
+
+type InboundMessage struct {
+	V        int    `json:"v,omitempty"` // Protocol version the client speaks; see Versions
+	Event    Event  `json:"event"`
+	Row      *int   `json:"row,omitempty"`
+	Col      *int   `json:"col,omitempty"`
+	Mark     string `json:"mark,omitempty"`      // make_move in a wild game: "X" or "O"; the player's own if empty
+	ClientTS int64  `json:"client_ts,omitempty"` // time_sync: client clock, echoed back unchanged
+	Reset    bool   `json:"reset,omitempty"`     // abort_request: start a fresh match instead of closing the game
+
+	Text  string `json:"text,omitempty"`  // chat: the message
+	Emote string `json:"emote,omitempty"` // emote: one of Emotes
+
+	Settings *Settings `json:"settings,omitempty"` // configure: the options to set
+
+	Target string `json:"target,omitempty"` // kick: the seat's symbol or the spectator's participant ID
+	Ban    bool   `json:"ban,omitempty"`    // kick: also keep them out for the rest of the game
+
+	StateVersion uint64 `json:"state_version,omitempty"` // resend_from: the first version the client is missing
+
+	Nonce string `json:"nonce,omitempty"` // pong: the ping's nonce, echoed back unchanged
+}
+
+type OutboundMessage struct {
+	Event          Event          `json:"event"`
+	Player         string         `json:"player,omitempty"`
+	Board          *Board         `json:"board,omitempty"` // Only on events that carry round state
+	CurrentPlayer  string         `json:"current_player,omitempty"`
+	Score          *Score         `json:"score,omitempty"`
+	Error          string         `json:"error,omitempty"`
+	Token          string         `json:"token,omitempty"`
+	ReconnectURL   string         `json:"reconnect_url,omitempty"`
+	ReconnectGrace int            `json:"reconnect_grace,omitempty"` // Seconds a dropped seat is held for its token
+	ExpiresAt      *time.Time     `json:"expires_at,omitempty"`
+	Latency        map[string]int `json:"latency,omitempty"`      // Round trip in ms by symbol, for players that have answered a ping
+	Deadline       *time.Time     `json:"deadline,omitempty"`     // Absolute server time, e.g. when a server_shutdown takes effect
+	StartsAt       *time.Time     `json:"starts_at,omitempty"`    // game_starting and state_sync during one: when the round begins, in server time
+	ClientTS       int64          `json:"client_ts,omitempty"`    // time_sync: the client's timestamp, echoed
+	ServerTS       int64          `json:"server_ts,omitempty"`    // time_sync: server clock in Unix milliseconds on receipt; ping: when it was sent
+	Nonce          string         `json:"nonce,omitempty"`        // ping: to echo back in the pong
+	Detail         string         `json:"detail,omitempty"`       // Developer-facing explanation of an Error, not localized
+	Code           string         `json:"code,omitempty"`         // Machine-readable reason, stable across locales
+	Message        string         `json:"message,omitempty"`      // Localized text for Code
+	ServerInfo     string         `json:"server_info,omitempty"`  // Server version, on the first message only
+	From           *Participant   `json:"from,omitempty"`         // Originator of a player action
+	Participants   []Participant  `json:"participants,omitempty"` // Everyone connected, on sync and start_game
+	Locale         string         `json:"locale,omitempty"`       // Game-wide language set by the creator, on start_game
+	Spectators     *int           `json:"spectators,omitempty"`   // How many are watching, on events that carry the board and on spectator_count
+	BestOf         int            `json:"best_of,omitempty"`      // Rounds in the game's series, on start_game and series_over; absent if it has none
+
+	Names map[string]string `json:"names,omitempty"` // Display name by symbol, on round announcements and results
+
+	StarterPolicy string `json:"starter_policy,omitempty"` // Who starts each round after the first, on start_game and new_game
+
+	GameID string `json:"game_id,omitempty"` // The game a match_found seats the client in
+
+	// Win conditions: the optional ones in play, the board size and the
+	// marks in a row that win, on start_game, and the pattern that ended the
+	// round, on win. WinningLine lists every pattern the winning move
+	// completed, as [row, col] pairs: two for a move finishing a row and a
+	// diagonal at once. WinType is the direction Win's line runs in, "row",
+	// "col", "diag" or "anti-diag", and absent for a pattern that isn't a
+	// line.
+	WinConditions []string   `json:"win_conditions,omitempty"`
+	Size          int        `json:"size,omitempty"`
+	WinLength     int        `json:"win_length,omitempty"`
+	Win           *Win       `json:"win,omitempty"`
+	WinningLine   [][][2]int `json:"winning_line,omitempty"`
+	WinType       string     `json:"win_type,omitempty"`
+
+	// The variant, on start_game, for any but classic; and in ultimate
+	// games the sub-board view next to every Board.
+	Variant  string         `json:"variant,omitempty"`
+	Ultimate *UltimateBoard `json:"ultimate,omitempty"`
+
+	Difficulty string `json:"difficulty,omitempty"` // The computer's level, on start_game against it
+
+	// Rated games only, keyed by symbol
+	Ratings     map[string]int           `json:"ratings,omitempty"`      // Current at round start, updated on win/draw
+	Stakes      map[string]rating.Stakes `json:"stakes,omitempty"`       // What each player stands to gain or lose this round
+	RatingDelta map[string]int           `json:"rating_delta,omitempty"` // Change applied by this result
+
+	// Delta updates: a move's cell, and the board version it produces.
+	// Connections opened with ?deltas=1 get moves without Board when they
+	// already hold version Seq-1, with Changes instead: every cell the
+	// move changed, a cleared one included, so applying them in Seq order
+	// with Board.Apply gives the server's board. Anything else, and every
+	// event but move, carries the full board.
+	Row     *int         `json:"row,omitempty"`
+	Col     *int         `json:"col,omitempty"`
+	Symbol  string       `json:"symbol,omitempty"` // The mark placed; in wild, Player is who placed it
+	Seq     uint64       `json:"seq,omitempty"`
+	Changes []CellChange `json:"changes,omitempty"`
+
+	MoveNumber int `json:"move_number,omitempty"` // Moves played this round, on move and undo_applied
+
+	// Cues for the UI: the mark just played, on move, win, draw and
+	// state_sync, and the round just ended, on every event that ends one
+	// and on a state_sync between rounds.
+	LastMove   *LastMove     `json:"last_move,omitempty"`
+	RoundStats *RoundSummary `json:"round_stats,omitempty"`
+
+	// Board packed by engine.Pack, in place of Board for connections opened
+	// with ?board=packed. Base64 in JSON, raw bytes in MessagePack.
+	BoardPacked []byte `json:"board_packed,omitempty"`
+
+	Text  string `json:"text,omitempty"`  // chat: the message, as relayed after cleanup
+	Emote string `json:"emote,omitempty"` // emote: as relayed
+
+	Settings *Settings `json:"settings,omitempty"` // The game's options, on settings, start_game and new_game
+
+	// Time control only: milliseconds left on each player's clock by
+	// symbol, on round announcements, move, turn_skipped and flag_fall. The
+	// clock of CurrentPlayer is the one running.
+	Clocks map[string]int64 `json:"clocks,omitempty"`
+
+	// Resync: the game's state version, bumped on every broadcast and
+	// carried by each, so a client can drop messages older than the
+	// state_sync it asked for, and spot a gap to ask resend_from about.
+	// Resent marks a broadcast sent again for resend_from. state_sync also
+	// carries the round's status, "waiting", "in_progress" or "finished",
+	// and who has asked for a rematch.
+	StateVersion    uint64   `json:"state_version,omitempty"`
+	Resent          bool     `json:"resent,omitempty"`
+	Status          string   `json:"status,omitempty"`
+	RematchRequests []string `json:"rematch_requests,omitempty"`
+
+	// Games created with "legal_moves" only: the cells the player on turn
+	// may mark, on round announcements, move, turn_skipped and
+	// undo_applied while the round is in play.
+	LegalMoves []Cell `json:"legal_moves,omitempty"`
+
+	// Games created with round_deadline or series_deadline only: when the
+	// round, and the series, will be adjudicated, on round announcements
+	// while they run, and on state_sync the milliseconds left on each
+	RoundDeadline     *time.Time `json:"round_deadline,omitempty"`
+	SeriesDeadline    *time.Time `json:"series_deadline,omitempty"`
+	RoundRemainingMS  int64      `json:"round_remaining_ms,omitempty"`
+	SeriesRemainingMS int64      `json:"series_remaining_ms,omitempty"`
+
+	// Blitz games only: the cell the move's mark cleared, on move, and
+	// the cell of each player's that their next mark will clear, by
+	// symbol, on move, undo_applied and round announcements
+	Removed *Cell           `json:"removed,omitempty"`
+	Fading  map[string]Cell `json:"fading,omitempty"`
+
+	// How the game's recent rounds on this board size opened, one entry
+	// per cell opened on, on start_game; absent for a game created with
+	// hide_openings or before any round has finished
+	OpeningStats []OpeningStat `json:"opening_stats,omitempty"`
+
+	// The latest finished rounds of the series, oldest first, on
+	// start_game, new_game, win and draw, and all of them on series_summary
+	Rounds []RoundSummary `json:"rounds,omitempty"`
+
+	// Games with max_rounds only: the rounds the series plays and how many
+	// are finished, on start_game, new_game, state_sync and series_summary.
+	// series_summary adds how long the series took, and its Result: the
+	// winning symbol, also in Player, or "tied".
+	MaxRounds        int    `json:"max_rounds,omitempty"`
+	RoundsPlayed     *int   `json:"rounds_played,omitempty"`
+	SeriesDurationMS int64  `json:"series_duration_ms,omitempty"`
+	Result           string `json:"result,omitempty"`
+
+	// Games with coin_flip only: the commitment to the coin, on
+	// player_assignment until the flip and on coin_flip, and the coin
+	// itself on coin_flip. See coinflip.go
+	CoinCommitment string `json:"coin_commitment,omitempty"`
+	CoinNonce      string `json:"coin_nonce,omitempty"`
+
+	// The daily puzzle socket only: the puzzle's date, "win" or "draw",
+	// and the player's moves left to reach it, on puzzle and move; on
+	// puzzle_failed, the opponent's reply to the wrong move, absent if the
+	// move ended the game, and a move that would have kept the line
+	Date       string `json:"date,omitempty"`
+	Goal       string `json:"goal,omitempty"`
+	MovesLeft  int    `json:"moves_left,omitempty"`
+	Refutation *Cell  `json:"refutation,omitempty"`
+	Solution   *Cell  `json:"solution,omitempty"`
+}
@@ -0,0 +1,153 @@
+package protocol
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Wire versions of the server's messages. Version 1 is what clients have
+// always had, and stays byte for byte what OutboundMessage's tags say.
+// Version 2 settles what version 1 leaves to the reader:
+//
+//   - score is always there: {"x", "o", "third", "draws"}, every count
+//     present, or null on a message that carries no score
+//   - board and current_player are always there too, null when the
+//     message carries no round state, so a delta move's missing board
+//     reads as absent rather than forgotten
+//   - every message says "v": 2
+//
+// Every other field is as in version 1, omitted when it doesn't apply.
+// A client asks for version 2 with ?v=2 or by offering the subprotocol
+// "v2.json" or "v2.msgpack"; see SubprotocolFor. Inbound messages are the
+// same in both, so a version only changes how messages are encoded, and
+// ForVersion wraps a Codec to do it.
+const (
+	V1 = 1
+	V2 = 2
+)
+
+// ScoreV2 is Score in version 2: lower-case keys, all of them present.
+type ScoreV2 struct {
+	X     int `json:"x"`
+	O     int `json:"o"`
+	Third int `json:"third"`
+	Draws int `json:"draws"`
+}
+
+// outboundV2 is an OutboundMessage as version 2 puts it. Its fields hide
+// the embedded message's fields of the same names.
+type outboundV2 struct {
+	V int `json:"v"`
+	OutboundMessage
+	Board         *Board   `json:"board"`
+	CurrentPlayer *string  `json:"current_player"`
+	Score         *ScoreV2 `json:"score"`
+}
+
+func toV2(m OutboundMessage) outboundV2 {
+	w := outboundV2{V: V2, OutboundMessage: m, Board: m.Board}
+	if m.CurrentPlayer != "" {
+		w.CurrentPlayer = &m.CurrentPlayer
+	}
+	if s := m.Score; s != nil {
+		w.Score = &ScoreV2{X: s.X, O: s.O, Third: s.Third, Draws: s.Draws}
+	}
+	return w
+}
+
+func (w outboundV2) message() OutboundMessage {
+	m := w.OutboundMessage
+	m.Board = w.Board
+	m.CurrentPlayer = ""
+	if w.CurrentPlayer != nil {
+		m.CurrentPlayer = *w.CurrentPlayer
+	}
+	m.Score = nil
+	if s := w.Score; s != nil {
+		m.Score = &Score{X: s.X, O: s.O, Third: s.Third, Draws: s.Draws}
+	}
+	return m
+}
+
+// ForVersion is c encoding outbound messages in wire version v, which must
+// be one of Versions. For V1 it is c itself.
+func ForVersion(c Codec, v int) Codec {
+	if v == V1 {
+		return c
+	}
+	return versionedCodec{c, v}
+}
+
+// VersionOf is the wire version c encodes outbound messages in.
+func VersionOf(c Codec) int {
+	if vc, ok := c.(versionedCodec); ok {
+		return vc.v
+	}
+	return V1
+}
+
+// versionedCodec converts OutboundMessages, going out or coming in, to and
+// from a later wire version. Everything else passes through untouched.
+type versionedCodec struct {
+	Codec
+	v int
+}
+
+func (c versionedCodec) Marshal(v any) ([]byte, error) {
+	switch m := v.(type) {
+	case OutboundMessage:
+		v = toV2(m)
+	case *OutboundMessage:
+		v = toV2(*m)
+	}
+	return c.Codec.Marshal(v)
+}
+
+func (c versionedCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(*OutboundMessage)
+	if !ok {
+		return c.Codec.Unmarshal(data, v)
+	}
+	var w outboundV2
+	if err := c.Codec.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	*m = w.message()
+	return nil
+}
+
+// ParseVersion reads a ?v= value; "" is V1.
+func ParseVersion(s string) (int, bool) {
+	if s == "" {
+		return V1, true
+	}
+	v, err := strconv.Atoi(s)
+	return v, err == nil && speaks(v)
+}
+
+// ParseSubprotocol splits a game websocket subprotocol into its wire
+// version and encoding name: "msgpack" is version 1 in MessagePack,
+// "v2.json" version 2 in JSON. ok is false for anything else.
+func ParseSubprotocol(p string) (version int, enc string, ok bool) {
+	version, enc = V1, p
+	if rest, found := strings.CutPrefix(p, "v"); found {
+		n, name, dotted := strings.Cut(rest, ".")
+		v, err := strconv.Atoi(n)
+		if !dotted || err != nil || !speaks(v) {
+			return 0, "", false
+		}
+		version, enc = v, name
+	}
+	if _, known := CodecNamed(enc); !known || enc == "" {
+		return 0, "", false
+	}
+	return version, enc, true
+}
+
+// SubprotocolFor is the subprotocol that asks for version v in encoding c.
+func SubprotocolFor(c Codec, v int) string {
+	if v == V1 {
+		return c.Name()
+	}
+	return "v" + strconv.Itoa(v) + "." + c.Name()
+}
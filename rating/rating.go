@@ -0,0 +1,46 @@
+// Package rating implements the Elo rating used for rated games. Previews
+// and applied updates both go through Delta, so what a player is shown at
+// the start of a round is exactly what they get at the end.
+package rating
+
+import "math"
+
+const (
+	Initial = 1200 // Rating of a player with no rated games
+	K       = 32   // Maximum change from a single round
+)
+
+// Result is a round's outcome from one player's point of view.
+type Result float64
+
+const (
+	Loss Result = 0
+	Draw Result = 0.5
+	Win  Result = 1
+)
+
+// Expected is the probability-like score a player rated r is expected to
+// take against an opponent rated opp.
+func Expected(r, opp int) float64 {
+	return 1 / (1 + math.Pow(10, float64(opp-r)/400))
+}
+
+// Delta is the change to a player rated r after result against opp.
+func Delta(r, opp int, result Result) int {
+	return int(math.Round(K * (float64(result) - Expected(r, opp))))
+}
+
+// Stakes is what a player rated r stands to gain or lose against opp.
+type Stakes struct {
+	Win  int `json:"win"`
+	Draw int `json:"draw"`
+	Loss int `json:"loss"`
+}
+
+func Preview(r, opp int) Stakes {
+	return Stakes{
+		Win:  Delta(r, opp, Win),
+		Draw: Delta(r, opp, Draw),
+		Loss: Delta(r, opp, Loss),
+	}
+}
@@ -0,0 +1,68 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExpected(t *testing.T) {
+	tests := []struct {
+		r, opp int
+		want   float64
+	}{
+		{1200, 1200, 0.5},
+		{1600, 1200, 0.909091}, // 400 points ahead: ten to one
+		{1200, 1600, 0.090909},
+		{1400, 1200, 0.759747},
+		{1500, 1450, 0.571463},
+		{1000, 2000, 0.003152},
+	}
+	for _, tt := range tests {
+		if got := Expected(tt.r, tt.opp); math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("Expected(%d, %d) = %.6f, want %.6f", tt.r, tt.opp, got, tt.want)
+		}
+		if sum := Expected(tt.r, tt.opp) + Expected(tt.opp, tt.r); math.Abs(sum-1) > 1e-12 {
+			t.Errorf("Expected(%d, %d) and its reverse sum to %v, want 1", tt.r, tt.opp, sum)
+		}
+	}
+}
+
+func TestDelta(t *testing.T) {
+	tests := []struct {
+		r, opp          int
+		win, draw, loss int
+	}{
+		{1200, 1200, 16, 0, -16},
+		{1600, 1200, 3, -13, -29},
+		{1200, 1600, 29, 13, -3},
+		{1400, 1200, 8, -8, -24},
+		{1200, 1400, 24, 8, -8},
+		{1500, 1450, 14, -2, -18},
+		{1000, 2000, 32, 16, 0}, // A loss this lopsided rounds to nothing
+		{2000, 1000, 0, -16, -32},
+	}
+	for _, tt := range tests {
+		got := [3]int{Delta(tt.r, tt.opp, Win), Delta(tt.r, tt.opp, Draw), Delta(tt.r, tt.opp, Loss)}
+		if want := [3]int{tt.win, tt.draw, tt.loss}; got != want {
+			t.Errorf("Delta(%d, %d) win, draw, loss = %v, want %v", tt.r, tt.opp, got, want)
+		}
+		if s, want := Preview(tt.r, tt.opp), (Stakes{tt.win, tt.draw, tt.loss}); s != want {
+			t.Errorf("Preview(%d, %d) = %+v, want %+v, the same as Delta", tt.r, tt.opp, s, want)
+		}
+	}
+}
+
+func TestDeltaBounds(t *testing.T) {
+	for r := 800; r <= 2400; r += 100 {
+		for opp := 800; opp <= 2400; opp += 100 {
+			win, draw, loss := Delta(r, opp, Win), Delta(r, opp, Draw), Delta(r, opp, Loss)
+			if win < 0 || win > K || loss > 0 || loss < -K || win < draw || draw < loss {
+				t.Errorf("Delta(%d, %d) = %d, %d, %d: out of order or past K", r, opp, win, draw, loss)
+			}
+			// What one player gains the other loses, give or take rounding
+			if sum := win + Delta(opp, r, Loss); sum < -1 || sum > 1 {
+				t.Errorf("Delta(%d, %d, Win) + Delta(%d, %d, Loss) = %d, want about 0", r, opp, opp, r, sum)
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"tictactoe/engine"
+	"tictactoe/local"
+
+	"golang.org/x/term"
+)
+
+// keys delivers one control key at a time: single keystrokes on a terminal,
+// or the first character of each line when input is piped.
+type keys interface {
+	next() (byte, error)
+}
+
+type rawKeys struct{ r io.Reader }
+
+func (k rawKeys) next() (byte, error) {
+	var b [1]byte
+	_, err := k.r.Read(b[:])
+	return b[0], err
+}
+
+type lineKeys struct{ s *bufio.Scanner }
+
+func (k lineKeys) next() (byte, error) {
+	if !k.s.Scan() {
+		return 0, io.EOF
+	}
+	if line := k.s.Text(); line != "" {
+		return line[0], nil
+	}
+	return ' ', nil
+}
+
+// Player steps through a replay file, validating each move as it goes.
+type Player struct {
+	Out   io.Writer
+	Delay time.Duration // Pause between moves in auto-play
+	Auto  bool          // Start in auto-play instead of waiting for keys
+	NL    string        // Line ending; "\r\n" while the terminal is raw
+}
+
+func (p *Player) printf(format string, args ...interface{}) {
+	fmt.Fprintf(p.Out, format, args...)
+}
+
+func (p *Player) render(b engine.Board) {
+	var buf bytes.Buffer
+	local.Render(&buf, b)
+	io.WriteString(p.Out, strings.ReplaceAll(buf.String(), "\n", p.NL))
+}
+
+// Play shows every move of f. It stops at the first illegal move and returns
+// its *MoveError.
+func (p *Player) Play(f *File, in keys) error {
+	p.printf("Replay of %q: %d round(s). space = next move, a = auto-play, q = quit%s", f.GameID, len(f.Rounds), p.NL)
+	size, wins, err := f.Rules()
+	if err != nil {
+		return err
+	}
+	for ri, round := range f.Rounds {
+		m, err := Start(round, size, f.Players, wins)
+		if err != nil {
+			return fmt.Errorf("round %d: %w", ri+1, err)
+		}
+		p.printf("%s--- Round %d, %s starts ---%s", p.NL, ri+1, round.Starter, p.NL)
+		for mi, mv := range round.Moves {
+			if err := p.wait(in); err != nil {
+				return err
+			}
+			outcome, err := Apply(m, mv)
+			if err != nil {
+				moveErr := &MoveError{Round: ri, Move: mi, Err: err}
+				p.printf("!! %v (%s at row %d, col %d)%s", moveErr, mv.Player, mv.Row+1, mv.Col+1, p.NL)
+				return moveErr
+			}
+			if mv.Skipped {
+				p.printf("%sMove %d: %s ran out of time, turn skipped%s", p.NL, mi+1, mv.Player, p.NL)
+				continue
+			}
+			if mv.Mark != "" {
+				p.printf("%sMove %d: %s marks %s at row %d, col %d%s", p.NL, mi+1, mv.Player, mv.Mark, mv.Row+1, mv.Col+1, p.NL)
+			} else {
+				p.printf("%sMove %d: %s at row %d, col %d%s", p.NL, mi+1, mv.Player, mv.Row+1, mv.Col+1, p.NL)
+			}
+			p.render(m.Board)
+			switch outcome {
+			case engine.Won:
+				p.printf("Player %s wins the round.%s", engine.Victor(mv.Player, mv.Symbol(), wins), p.NL)
+			case engine.Drawn:
+				p.printf("The round is a draw.%s", p.NL)
+			}
+		}
+		if round.Timeout {
+			p.printf("%s ran out of time; player %s wins the round.%s", engine.Other(round.Result), round.Result, p.NL)
+		}
+		if round.Conceded {
+			p.printf("%s conceded; player %s wins the round.%s", engine.Other(round.Result), round.Result, p.NL)
+		}
+		if round.Adjudicated {
+			if round.Result == "draw" {
+				p.printf("Time ran out; the round is adjudicated a draw.%s", p.NL)
+			} else {
+				p.printf("Time ran out; player %s wins the round on adjudication.%s", round.Result, p.NL)
+			}
+		}
+	}
+	p.printf("%sEnd of replay.%s", p.NL, p.NL)
+	return nil
+}
+
+var errQuit = errors.New("quit")
+
+func (p *Player) wait(in keys) error {
+	if p.Auto {
+		time.Sleep(p.Delay)
+		return nil
+	}
+	for {
+		k, err := in.next()
+		if err != nil {
+			return err
+		}
+		switch k {
+		case ' ', '\r', '\n':
+			return nil
+		case 'a', 'A':
+			p.Auto = true
+			return nil
+		case 'q', 'Q', 3: // 3 is Ctrl-C in raw mode
+			return errQuit
+		}
+	}
+}
+
+// Main runs the replay subcommand: xo replay [-auto] [-delay d] <file>.
+func Main(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	auto := fs.Bool("auto", false, "play back automatically without waiting for keys")
+	delay := fs.Duration("delay", 700*time.Millisecond, "pause between moves in auto-play")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: xo replay [-auto] [-delay 700ms] <file>")
+	}
+
+	fh, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	f, err := Parse(fh)
+	if err != nil {
+		return err
+	}
+
+	p := &Player{Out: os.Stdout, Delay: *delay, Auto: *auto, NL: "\n"}
+	var in keys = lineKeys{bufio.NewScanner(os.Stdin)}
+	if fd := int(os.Stdin.Fd()); !*auto && term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err == nil {
+			defer term.Restore(fd, state)
+			in = rawKeys{os.Stdin}
+			p.NL = "\r\n"
+		}
+	}
+
+	err = p.Play(f, in)
+	if errors.Is(err, errQuit) || errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,208 @@
+// Package replay defines the versioned replay file format and validates
+// replay files by playing every move through the engine.
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"tictactoe/engine"
+)
+
+// Version is the newest replay format this build reads and writes.
+const Version = 1
+
+type Move struct {
+	Player  string `json:"player"`
+	Row     int    `json:"row"`
+	Col     int    `json:"col"`
+	Skipped bool   `json:"skipped,omitempty"` // Ran out of time; the turn passed with no mark, and Row and Col are unused
+	Mark    string `json:"mark,omitempty"`    // The symbol marked in a wild game, if not the player's own
+
+	At *time.Time `json:"at,omitempty"` // When the server accepted the move; absent in older files
+}
+
+type Round struct {
+	Starter string `json:"starter"`
+	Moves   []Move `json:"moves"`
+	Result  string `json:"result,omitempty"`  // "X", "O", engine.Third, "draw", or empty if unfinished
+	Timeout bool   `json:"timeout,omitempty"` // Result was decided by the other player running out of time
+
+	Conceded bool `json:"conceded,omitempty"` // Result was decided by the other player giving up
+
+	Adjudicated bool `json:"adjudicated,omitempty"` // Result was decided from the position when the round's deadline passed
+
+	StartedAt *time.Time `json:"started_at,omitempty"` // When play began; absent in older files
+}
+
+type File struct {
+	Version    int       `json:"version"`
+	GameID     string    `json:"game_id,omitempty"`
+	RecordedAt time.Time `json:"recorded_at,omitempty"`
+	Rounds     []Round   `json:"rounds"`
+
+	WinConditions []string `json:"win_conditions,omitempty"` // Optional conditions besides lines; see engine.WinConditions
+
+	Size      int `json:"size,omitempty"`       // Rows and columns; 0 for engine.DefaultSize
+	WinLength int `json:"win_length,omitempty"` // Marks in a row that win; 0 for a full line
+
+	Players int `json:"players,omitempty"` // 3 for a three-player game; 0 for X and O
+}
+
+// Rules returns the board size and win conditions f's rounds were played
+// with, rejecting a size or win length no game could have.
+func (f *File) Rules() (int, []engine.WinCondition, error) {
+	size := f.Size
+	if size == 0 {
+		size = engine.DefaultSize
+	}
+	if !engine.ValidSize(size) {
+		return 0, nil, fmt.Errorf("invalid board size %d", f.Size)
+	}
+	if f.WinLength != 0 && !engine.ValidWinLength(size, f.WinLength) {
+		return 0, nil, fmt.Errorf("invalid win length %d for a %dx%d board", f.WinLength, size, size)
+	}
+	wins, err := engine.ParseWinConditions(f.WinConditions)
+	if err != nil {
+		return 0, nil, fmt.Errorf("win conditions: %w", err)
+	}
+	if engine.IsUltimate(wins) && (size != engine.UltimateSize || f.WinLength != 0) {
+		return 0, nil, fmt.Errorf("ultimate is played on a %dx%d board with no win length", engine.UltimateSize, engine.UltimateSize)
+	}
+	if engine.IsBlitz(wins) && (len(f.WinConditions) > 1 || (f.WinLength == 0 && size != engine.BlitzMarks) || (f.WinLength != 0 && f.WinLength != engine.BlitzMarks)) {
+		return 0, nil, fmt.Errorf("blitz is won by %d in a row only", engine.BlitzMarks)
+	}
+	if f.Players != 0 && f.Players != 2 && (f.Players != 3 || engine.Variant(wins) != engine.Classic) {
+		return 0, nil, fmt.Errorf("invalid player count %d", f.Players)
+	}
+	return size, engine.WithWinLength(wins, f.WinLength), nil
+}
+
+// MoveError reports the first move in a file that the engine rejects.
+type MoveError struct {
+	Round, Move int // 0-based indexes into File.Rounds and Round.Moves
+	Err         error
+}
+
+func (e *MoveError) Error() string {
+	return fmt.Sprintf("round %d, move %d: illegal move: %v", e.Round+1, e.Move+1, e.Err)
+}
+
+func (e *MoveError) Unwrap() error { return e.Err }
+
+// Parse decodes a replay file, rejecting corrupt JSON and unsupported
+// versions. It does not check move legality; see Validate.
+func Parse(r io.Reader) (*File, error) {
+	var f File
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("corrupt replay file: %w", err)
+	}
+	switch {
+	case f.Version == 0:
+		return nil, errors.New("corrupt replay file: missing version")
+	case f.Version > Version:
+		return nil, fmt.Errorf("replay file version %d is newer than the supported version %d", f.Version, Version)
+	}
+	return &f, nil
+}
+
+// Encode writes f in the current format version.
+func Encode(w io.Writer, f *File) error {
+	f.Version = Version
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(f)
+}
+
+// Start returns a match positioned at the beginning of round, played by
+// players (0 for X and O) on a size×size board with wins (nil for the
+// standard lines only).
+func Start(round Round, size, players int, wins []engine.WinCondition) (*engine.Match, error) {
+	if !engine.IsSymbol(round.Starter, players) {
+		return nil, fmt.Errorf("invalid starter %q", round.Starter)
+	}
+	m := engine.NewMatchSize(size)
+	m.CurrentPlayer, m.StartingPlayer, m.Conditions, m.Players = round.Starter, round.Starter, wins, players
+	return m, nil
+}
+
+// Apply plays mv on m: a mark, or a pass for a skipped turn.
+func Apply(m *engine.Match, mv Move) (engine.Outcome, error) {
+	if mv.Skipped {
+		return engine.Continue, m.Pass(mv.Player)
+	}
+	return m.Play(mv.Player, mv.Mark, mv.Row, mv.Col)
+}
+
+// Symbol is the symbol mv marked: its Mark, or else its player's own.
+func (mv Move) Symbol() string {
+	if mv.Mark != "" {
+		return mv.Mark
+	}
+	return mv.Player
+}
+
+// Validate replays every round through the engine and returns a *MoveError
+// for the first illegal move, or an error if a recorded result disagrees
+// with the position. It returns the score the file implies.
+func Validate(f *File) (engine.Score, error) {
+	var score engine.Score
+	size, wins, err := f.Rules()
+	if err != nil {
+		return score, err
+	}
+	for ri, round := range f.Rounds {
+		m, err := Start(round, size, f.Players, wins)
+		if err != nil {
+			return score, fmt.Errorf("round %d: %w", ri+1, err)
+		}
+		result := ""
+		for mi, mv := range round.Moves {
+			outcome, err := Apply(m, mv)
+			if err != nil {
+				return score, &MoveError{Round: ri, Move: mi, Err: err}
+			}
+			switch outcome {
+			case engine.Won:
+				result = engine.Victor(mv.Player, mv.Symbol(), wins)
+			case engine.Drawn:
+				result = "draw"
+			}
+		}
+		if round.Timeout && round.Conceded {
+			return score, fmt.Errorf("round %d: won both on time and by concession", ri+1)
+		}
+		if round.Adjudicated {
+			if result != "" || round.Timeout || round.Conceded || round.Result == "" {
+				return score, fmt.Errorf("round %d: an adjudicated round needs a result, an undecided board and no other ending", ri+1)
+			}
+			result = round.Result
+		}
+		if round.Timeout {
+			if result != "" || (round.Result != "X" && round.Result != "O") {
+				return score, fmt.Errorf("round %d: a round won on time needs a winner and an undecided board", ri+1)
+			}
+			result = round.Result
+		}
+		if round.Conceded {
+			if result != "" || (round.Result != "X" && round.Result != "O") {
+				return score, fmt.Errorf("round %d: a conceded round needs a winner and an undecided board", ri+1)
+			}
+			result = round.Result
+		}
+		if round.Result != "" && round.Result != result {
+			return score, fmt.Errorf("round %d: recorded result %q but the moves give %q", ri+1, round.Result, result)
+		}
+		if result == "draw" {
+			score.Draws++
+		} else {
+			score.Add(result)
+		}
+	}
+	return score, nil
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"time"
+
+	"tictactoe/protocol"
+)
+
+// --- Mutual Abort ---
+
+// abortRequest is a pending proposal to void the match.
+type abortRequest struct {
+	By    string // Symbol of the proposer
+	Reset bool   // Keep the game open with a fresh match instead of deleting it
+}
+
+// resetMatch zeroes the score and history and starts round 1 again with
+// the game's first player. Runs on the game's loop.
+func (game *Game) resetMatch() {
+	game.journal.state("match_reset", "")
+	game.Score = Score{}
+	game.StartingPlayerForRound = game.FirstPlayer
+	game.Round = 1
+	game.History = nil
+	game.RoundResults = nil
+	game.SeriesRounds, game.SeriesStartedAt = 0, time.Time{}
+	game.clearSeriesDeadline()
+	game.forgetSent()
+	resetGameBoard(game, game.FirstPlayer)
+}
+
+// abortAllowed applies the rated-game rule: once both players have moved,
+// an abort is refused, or settled as a draw under -rated-abort=draw.
+// Runs on the game's loop.
+func (game *Game) abortAllowed() bool {
+	if _, _, rated := game.ratedPlayers(); !rated || len(game.Moves) <= 2 {
+		return true
+	}
+	return cfg.RatedAbort == "draw"
+}
+
+// handleAbort runs abort_request and abort_accept. Either player proposes;
+// the other accepts, or proposes too. Runs on the game's loop.
+func (game *Game) handleAbort(p *Player, msg InboundMessage) {
+	if game.ThreePlayer {
+		p.send(localize(p.locale(), protocol.Failure("two_player_only", "")))
+		return
+	}
+	if !game.abortAllowed() {
+		p.send(localize(p.locale(), protocol.Failure("abort_not_allowed", "")))
+		return
+	}
+	pending := game.Abort
+	switch {
+	case msg.Event == protocol.EventAbortRequest && (pending == nil || pending.By == p.Symbol):
+		game.Abort = &abortRequest{By: p.Symbol, Reset: msg.Reset}
+		broadcast(game, OutboundMessage{Event: protocol.EventAbortRequested, Player: p.Symbol, From: p.participant()})
+		return
+	case pending == nil || pending.By == p.Symbol:
+		return // Nothing to accept
+	}
+
+	// Agreed. A rated round past its first moves settles as a draw.
+	if _, _, rated := game.ratedPlayers(); rated && len(game.Moves) > 2 {
+		game.withRatingUpdate(OutboundMessage{}, "")
+	}
+	game.Abort = nil
+	game.cancelReminder()
+	game.stopTurnTimer()
+	game.stopClock()
+	if !game.Correspondence { // There an absent player keeps their seat in the fresh match
+		for symbol := range game.Reserved {
+			delete(game.Reserved, symbol)
+			delete(game.HeldUntil, symbol)
+		}
+	}
+
+	if pending.Reset {
+		game.resetMatch()
+		msg := protocol.BoardState(protocol.EventGameAborted, game.Board, game.CurrentPlayer, &game.Score)
+		msg.Code = "game_aborted"
+		broadcast(game, game.withStakes(msg))
+		game.armReminder()
+		game.armTurnTimer()
+		game.runClock()
+		return
+	}
+
+	game.logger().Info("game aborted by agreement")
+	broadcast(game, protocol.Notice(protocol.EventGameAborted, "game_aborted"))
+	removeGame(game, endAborted)
+	for _, pl := range game.connections() {
+		pl.closeAfterFlush(protocol.CloseGameEnded, "game aborted")
+	}
+}
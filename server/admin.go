@@ -0,0 +1,273 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// --- Admin API ---
+
+// adminToken guards every /admin route. When ADMIN_TOKEN is unset the
+// admin API rejects all requests.
+var adminToken = os.Getenv("ADMIN_TOKEN")
+
+func isAdminRequest(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdminRequest(r) {
+			writeError(w, r, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// adminIdentity names the operator behind an admin request for the audit
+// log. The bearer token is shared, so operators identify themselves with
+// X-Admin-User.
+func adminIdentity(r *http.Request) string {
+	if user := strings.TrimSpace(r.Header.Get("X-Admin-User")); user != "" {
+		return user
+	}
+	return "admin"
+}
+
+// audit records an admin intervention, logging rather than failing the
+// request if the store is unavailable.
+func audit(r *http.Request, action, gameID, detail string) {
+	entry := AuditEntry{
+		At:     time.Now().UTC(),
+		Admin:  adminIdentity(r),
+		Action: action,
+		GameID: gameID,
+		Detail: detail,
+	}
+	if err := store.AppendAudit(entry); err != nil {
+		slog.Error("writing audit entry", "entry", entry, "err", err)
+	}
+}
+
+func listAudit(w http.ResponseWriter, r *http.Request) {
+	entries, err := store.ListAudit()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+type resetRequest struct {
+	Action string `json:"action"` // reset_round, reset_match or set_turn
+	Player string `json:"player"` // New CurrentPlayer for set_turn
+}
+
+// resetGame unwedges a stuck game and pushes the corrected state to its
+// players.
+func resetGame(w http.ResponseWriter, r *http.Request) {
+	key := requestGameKey(r)
+	var req resetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body")
+		return
+	}
+
+	gamesMutex.RLock()
+	game, exists := games[key]
+	gamesMutex.RUnlock()
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "game_not_found")
+		return
+	}
+
+	var st GameState
+	code := ""
+	game.do(func() {
+		switch req.Action {
+		case "reset_round":
+			resetGameBoard(game, game.StartingPlayerForRound)
+			broadcast(game, protocol.BoardState(protocol.EventNewGame, game.Board, game.CurrentPlayer, &game.Score))
+		case "reset_match":
+			game.resetMatch()
+			broadcast(game, protocol.BoardState(protocol.EventNewGame, game.Board, game.CurrentPlayer, &game.Score))
+		case "set_turn":
+			if !game.isSymbol(req.Player) {
+				code = "invalid_player"
+				return
+			}
+			game.CurrentPlayer = req.Player
+			msg := protocol.BoardState(protocol.EventSync, game.Board, game.CurrentPlayer, &game.Score)
+			msg.Participants = game.participants()
+			broadcast(game, msg)
+		default:
+			code = "unknown_action"
+			return
+		}
+		game.armReminder()
+		game.armTurnTimer()
+		game.runClock()
+		if game.Correspondence {
+			game.turnTaken(time.Now())
+		}
+		st = game.exportState()
+	})
+	if code != "" {
+		writeError(w, r, http.StatusBadRequest, code)
+		return
+	}
+
+	detail := req.Action
+	if req.Action == "set_turn" {
+		detail += " " + req.Player
+	}
+	audit(r, "game_reset", key.ID, detail)
+	writeJSON(w, http.StatusOK, st)
+}
+
+type gameSummary struct {
+	ID            string          `json:"id"`
+	Round         int             `json:"round"`
+	Score         Score           `json:"score"`
+	Rated         bool            `json:"rated"`
+	ExpiresAt     time.Time       `json:"expires_at"`
+	Players       []playerSummary `json:"players"`
+	Watchers      int             `json:"watchers"`
+	StartsAt      *time.Time      `json:"starts_at,omitempty"` // Scheduled games that haven't started
+	Board         engine.Board    `json:"board"`
+	CurrentPlayer string          `json:"current_player"`
+	LastActivity  *time.Time      `json:"last_activity,omitempty"` // Omitted for a restored game not yet played
+	Held          []string        `json:"held,omitempty"`          // Seats reserved for a player who dropped
+
+	Correspondence bool       `json:"correspondence,omitempty"`
+	TurnDeadline   *time.Time `json:"turn_deadline,omitempty"` // Correspondence games with a turn running
+}
+
+type playerSummary struct {
+	Symbol     string `json:"symbol"`
+	Name       string `json:"name,omitempty"`
+	IP         string `json:"ip"`
+	Identity   string `json:"identity,omitempty"`
+	Connection string `json:"connection"`           // "alive", or "quiet" while a ping goes unanswered
+	LatencyMS  int    `json:"latency_ms,omitempty"` // Omitted until the first pong
+
+	Rejections map[string]int `json:"rejections,omitempty"` // Refused make_moves by code
+	Suspicious bool           `json:"suspicious,omitempty"` // Flagged by the move sanity checks
+}
+
+// listGames lists every live game of the tenant with its players for
+// support. Each game's loop runs only its own summary, so a long list
+// doesn't hold up play.
+func listGames(w http.ResponseWriter, r *http.Request) {
+	out := []gameSummary{}
+	tenant := requestTenant(r)
+	for _, game := range liveGames() {
+		if game.Tenant != tenant {
+			continue
+		}
+		game.do(func() { out = append(out, game.summary()) })
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	writeJSON(w, http.StatusOK, out)
+}
+
+// getGameSummary is listGames for a single game.
+func getGameSummary(w http.ResponseWriter, r *http.Request) {
+	gamesMutex.RLock()
+	game, exists := games[requestGameKey(r)]
+	gamesMutex.RUnlock()
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "game_not_found")
+		return
+	}
+	var g gameSummary
+	game.do(func() { g = game.summary() })
+	writeJSON(w, http.StatusOK, g)
+}
+
+// summary describes the game for support. Runs on the game's loop.
+func (game *Game) summary() gameSummary {
+	g := gameSummary{
+		ID:            game.ID,
+		Round:         game.Round,
+		Score:         game.Score,
+		Rated:         game.Rated,
+		ExpiresAt:     game.ExpiresAt.UTC(),
+		Players:       []playerSummary{},
+		Watchers:      len(game.Watchers),
+		Board:         game.Board.Clone(),
+		CurrentPlayer: game.CurrentPlayer,
+	}
+	if game.scheduled() {
+		startsAt := game.StartsAt.UTC()
+		g.StartsAt = &startsAt
+	}
+	if !game.LastActivity.IsZero() {
+		last := game.LastActivity.UTC()
+		g.LastActivity = &last
+	}
+	for symbol := range game.Reserved {
+		g.Held = append(g.Held, symbol)
+	}
+	sort.Strings(g.Held)
+	if game.Correspondence {
+		g.Correspondence = true
+		if !game.TurnDeadline.IsZero() {
+			deadline := game.TurnDeadline.UTC()
+			g.TurnDeadline = &deadline
+		}
+	}
+	for _, p := range game.Players {
+		connection := "alive"
+		if p.health.Load() == healthQuiet {
+			connection = "quiet"
+		}
+		g.Players = append(g.Players, playerSummary{
+			Symbol:     p.Symbol,
+			Name:       p.Name,
+			IP:         p.IP,
+			Identity:   p.Identity,
+			Connection: connection,
+			LatencyMS:  p.latencyMS(),
+			Rejections: maps.Clone(p.rejections),
+			Suspicious: p.suspicious,
+		})
+	}
+	return g
+}
+
+// closeGame tears a stuck game down: every connection is told and closed,
+// held seats are released and the game is deleted, as if it had expired.
+func closeGame(w http.ResponseWriter, r *http.Request) {
+	key := requestGameKey(r)
+	gamesMutex.RLock()
+	game, exists := games[key]
+	gamesMutex.RUnlock()
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "game_not_found")
+		return
+	}
+
+	game.do(func() {
+		for _, p := range game.connections() {
+			p.send(localize(p.locale(), protocol.Notice(protocol.EventGameClosed, "game_closed_by_admin")))
+			p.closeAfterFlush(protocol.CloseGameClosed, "game closed")
+		}
+		removeGame(game, endClosed)
+	})
+
+	audit(r, "game_closed", key.ID, "")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// --- Computer Opponent ---
+
+// A player who joins an empty game with ?mode=ai gets the computer as O.
+// The computer holds its seat without a connection, moves through
+// makeMove like anyone else, and accepts every rematch. ?difficulty= sets
+// how well it plays: easy picks any free cell, medium takes a win or
+// blocks one and otherwise picks any, and hard, the default, searches the
+// whole game and never loses. In misère and wild it plays by their rules:
+// medium looks for wins only in wild and otherwise picks any cell, and hard
+// searches both marks in wild. It waits between -ai-think-min and
+// -ai-think-max before each move, off the game's loop, so its reply
+// doesn't land before the client has drawn the player's own move.
+
+const (
+	aiEasy   = "easy"
+	aiMedium = "medium"
+	aiHard   = "hard"
+)
+
+// validDifficulty reports whether d is a level the computer plays at, or
+// "" for the default.
+func validDifficulty(d string) bool {
+	return d == "" || d == aiEasy || d == aiMedium || d == aiHard
+}
+
+// aiThinkTime is how long the computer waits before its next move.
+func aiThinkTime() time.Duration {
+	spread := cfg.AIThinkMax - cfg.AIThinkMin
+	if spread <= 0 {
+		return cfg.AIThinkMin
+	}
+	return cfg.AIThinkMin + time.Duration(rand.Int63n(int64(spread)+1))
+}
+
+// aiPreference is the order the computer tries cells in, and so breaks
+// ties: centre, corners, then edges. The full search only suits the default
+// board, so the computer plays nothing larger.
+var aiPreference = []engine.Cell{
+	{Row: 1, Col: 1},
+	{Row: 0, Col: 0}, {Row: 0, Col: 2}, {Row: 2, Col: 0}, {Row: 2, Col: 2},
+	{Row: 0, Col: 1}, {Row: 1, Col: 0}, {Row: 1, Col: 2}, {Row: 2, Col: 1},
+}
+
+// chooseAIMove picks symbol's move on board under the standard rule. It
+// returns -1, -1 if the board is full.
+func chooseAIMove(board engine.Board, symbol string) (int, int) {
+	row, col, _ := chooseMove(board, symbol, nil)
+	return row, col
+}
+
+// aiMove picks symbol's move on board under conds at difficulty: the cell
+// and the symbol to mark there. It returns -1, -1 if the board is full.
+func aiMove(board engine.Board, symbol string, conds []engine.WinCondition, difficulty string) (int, int, string) {
+	switch difficulty {
+	case aiEasy:
+		return randomMove(board, symbol, conds)
+	case aiMedium:
+		if engine.IsMisere(conds) {
+			return randomMove(board, symbol, conds) // Finishing a line only loses
+		}
+		if c, mark, ok := finishingMove(board, symbol, conds); ok {
+			return c.Row, c.Col, mark
+		}
+		if c, _, ok := finishingMove(board, engine.Other(symbol), conds); ok {
+			return c.Row, c.Col, symbol // Block it
+		}
+		return randomMove(board, symbol, conds)
+	}
+	return chooseMove(board, symbol, conds)
+}
+
+// randomMove picks any free cell on board and any mark symbol may make
+// there, or -1, -1 if there is none.
+func randomMove(board engine.Board, symbol string, conds []engine.WinCondition) (int, int, string) {
+	var free []engine.Cell
+	for _, c := range aiPreference {
+		if board[c.Row][c.Col] == "" {
+			free = append(free, c)
+		}
+	}
+	if len(free) == 0 {
+		return -1, -1, ""
+	}
+	c := free[rand.Intn(len(free))]
+	marks := engine.Marks(symbol, conds)
+	return c.Row, c.Col, marks[rand.Intn(len(marks))]
+}
+
+// finishingMove finds a free cell and mark that complete a pattern for
+// symbol on board under conds.
+func finishingMove(board engine.Board, symbol string, conds []engine.WinCondition) (engine.Cell, string, bool) {
+	b := board.Clone()
+	for _, c := range aiPreference {
+		if b[c.Row][c.Col] != "" {
+			continue
+		}
+		for _, mark := range engine.Marks(symbol, conds) {
+			b[c.Row][c.Col] = mark
+			_, won := engine.FindWin(b, c, conds)
+			b[c.Row][c.Col] = ""
+			if won {
+				return c, mark, true
+			}
+		}
+	}
+	return engine.Cell{}, "", false
+}
+
+// chooseMove plays perfectly under conds: a full minimax search that
+// prefers quicker wins and slower losses, so it takes an immediate win
+// and blocks an immediate threat. It returns -1, -1 if the board is full.
+func chooseMove(board engine.Board, symbol string, conds []engine.WinCondition) (int, int, string) {
+	b := board.Clone()
+	best, bestMark, bestScore := engine.Cell{Row: -1, Col: -1}, "", math.MinInt
+	for _, c := range aiPreference {
+		if b[c.Row][c.Col] != "" {
+			continue
+		}
+		for _, mark := range engine.Marks(symbol, conds) {
+			b[c.Row][c.Col] = mark
+			score := -negamax(b, c, engine.Other(symbol), conds, 1, math.MinInt+1, math.MaxInt)
+			b[c.Row][c.Col] = ""
+			if score > bestScore {
+				best, bestMark, bestScore = c, mark, score
+			}
+		}
+	}
+	return best.Row, best.Col, bestMark
+}
+
+// negamax scores the position for toMove after the opponent's move at last,
+// depth moves into the search: positive if toMove wins, negative if it
+// loses, 0 for a draw.
+func negamax(b engine.Board, last engine.Cell, toMove string, conds []engine.WinCondition, depth, alpha, beta int) int {
+	if _, won := engine.FindWin(b, last, conds); won {
+		if engine.IsMisere(conds) {
+			return 10 - depth // The opponent just lost; sooner is better
+		}
+		return depth - 10 // The opponent just won; sooner is worse
+	}
+	if engine.CheckDraw(b) {
+		return 0
+	}
+	best := math.MinInt + 1
+	for _, c := range aiPreference {
+		if b[c.Row][c.Col] != "" {
+			continue
+		}
+		for _, mark := range engine.Marks(toMove, conds) {
+			b[c.Row][c.Col] = mark
+			score := -negamax(b, c, engine.Other(toMove), conds, depth+1, -beta, -alpha)
+			b[c.Row][c.Col] = ""
+			if score > best {
+				best = score
+			}
+			if best > alpha {
+				alpha = best
+			}
+			if alpha >= beta {
+				return best
+			}
+		}
+	}
+	return best
+}
+
+// armAI schedules the computer's move if it's on turn. A timer that fires
+// after play moved on finds makeMove refusing the move. Runs on the game's
+// loop.
+func (game *Game) armAI() {
+	if game.AI == "" || game.CurrentPlayer != game.AI || !game.canPlay() || game.paused() || game.roundOver() {
+		return
+	}
+	game.aiGen++
+	gen := game.aiGen
+	time.AfterFunc(aiThinkTime(), func() {
+		game.do(func() {
+			if game.aiGen != gen || game.closed {
+				return
+			}
+			game.journal.timer("ai_move")
+			if row, col, mark := aiMove(game.Board, game.AI, game.WinConditions, game.AIDifficulty); row >= 0 {
+				game.makeMove(game.AI, mark, row, col)
+			}
+		})
+	})
+}
+
+// aiParticipant is how the computer appears in participant lists. Runs
+// on the game's loop.
+func (game *Game) aiParticipant() protocol.Participant {
+	return protocol.Participant{ID: "ai", Role: string(RoleAI), Symbol: game.AI, Name: "Computer"}
+}
+
+// playAI gives the computer the O seat of a game nobody has joined yet, for
+// ?mode=ai, to play at difficulty ("" for aiHard). Games already under
+// way, correspondence and scheduled games, blitz games and games on a
+// larger board are played between people only. Runs on the game's loop.
+func (game *Game) playAI(difficulty string) {
+	if game.AI != "" || len(game.Players) > 0 || len(game.Reserved) > 0 || len(game.Moves) > 0 || game.Round > 1 || game.Correspondence || game.scheduled() || game.Board.Size() != engine.DefaultSize || game.blitz() {
+		return
+	}
+	if difficulty == "" {
+		difficulty = aiHard
+	}
+	game.AI, game.AIDifficulty = "O", difficulty
+}
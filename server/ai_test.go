@@ -0,0 +1,99 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"tictactoe/engine"
+)
+
+// boardOf reads rows such as "XO." into a board, "." for an empty cell.
+func boardOf(rows ...string) engine.Board {
+	b := engine.NewBoard(len(rows))
+	for r, row := range rows {
+		for c, mark := range strings.Split(row, "") {
+			if mark != "." {
+				b[r][c] = mark
+			}
+		}
+	}
+	return b
+}
+
+func TestChooseAIMove(t *testing.T) {
+	tests := []struct {
+		name     string
+		board    engine.Board
+		symbol   string
+		row, col int
+	}{
+		{"takes a win in a row", boardOf("OO.", "XX.", "X.."), "O", 0, 2},
+		{"takes a win on a diagonal", boardOf("OX.", "XO.", "X.."), "O", 2, 2},
+		{"takes a win over a block", boardOf("XX.", "OO.", "X.."), "O", 1, 2},
+		{"blocks a row", boardOf("XX.", ".O.", "..."), "O", 0, 2},
+		{"blocks a column", boardOf("X..", "XO.", "..."), "O", 2, 0},
+		{"blocks as X", boardOf("OX.", ".O.", "X.."), "X", 2, 2},
+		{"full board", boardOf("XOX", "XOO", "OXX"), "O", -1, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := tt.board.Clone()
+			row, col := chooseAIMove(tt.board, tt.symbol)
+			if row != tt.row || col != tt.col {
+				t.Errorf("chooseAIMove = %d, %d; want %d, %d", row, col, tt.row, tt.col)
+			}
+			if !tt.board.Equal(before) {
+				t.Error("chooseAIMove changed the board it was given")
+			}
+		})
+	}
+}
+
+// The hard computer, moving first or second, draws or wins against every
+// sequence of replies the opponent could make.
+func TestHardNeverLoses(t *testing.T) {
+	for _, ai := range []string{"X", "O"} {
+		games := 0
+		var play func(b engine.Board, toMove string)
+		play = func(b engine.Board, toMove string) {
+			if engine.CheckWin(b, engine.Other(ai)) {
+				t.Fatalf("hard %s lost:\n%v", ai, b)
+			}
+			if engine.CheckWin(b, ai) || engine.CheckDraw(b) {
+				games++
+				return
+			}
+			if toMove == ai {
+				row, col, mark := aiMove(b, ai, nil, aiHard)
+				next := b.Clone()
+				next[row][col] = mark
+				play(next, engine.Other(ai))
+				return
+			}
+			for _, c := range aiPreference {
+				if b[c.Row][c.Col] == "" {
+					next := b.Clone()
+					next[c.Row][c.Col] = toMove
+					play(next, ai)
+				}
+			}
+		}
+		play(engine.NewBoard(3), "X")
+		if games == 0 {
+			t.Errorf("no games played with hard as %s", ai)
+		}
+	}
+}
+
+func BenchmarkChooseMove(b *testing.B) {
+	for name, board := range map[string]engine.Board{
+		"empty":      engine.NewBoard(3),
+		"one placed": boardOf("X..", "...", "..."),
+	} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				chooseMove(board, "O", nil)
+			}
+		})
+	}
+}
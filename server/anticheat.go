@@ -0,0 +1,81 @@
+package server
+
+import (
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// --- Move Sanity Checks ---
+
+// An honest client rarely has a make_move refused: it knows whose turn it
+// is and which cells are taken. One that keeps sending moves for the wrong
+// turn or onto marked cells is more likely modified or replaying old
+// traffic, so every connection counts its refused moves by code, shown in
+// the admin game summary and in xo_moves_rejected_total. Once a connection
+// has cfg.SuspiciousRejections wrong-turn, taken-cell or too-fast refusals
+// in one round it is flagged: logged, counted in xo_suspicious_flags_total,
+// and the other players hear suspicious_activity with Player its symbol.
+// With -kick-suspicious it is also closed as a host's kick would close it,
+// with kicked_suspicious for the code.
+// With -min-move-interval, a move arriving sooner than that after the same
+// connection's last accepted one is refused with too_fast.
+
+// strikeCodes are the refusals that count towards a flag.
+var strikeCodes = map[string]bool{
+	engine.ErrNotYourTurn.Error():  true,
+	engine.ErrCellOccupied.Error(): true,
+	"too_fast":                     true,
+}
+
+// moveThrottle is too_fast if p's move comes sooner than cfg.MinMoveInterval
+// after its last accepted one, or "". Runs on the game's loop.
+func (game *Game) moveThrottle(p *Player) string {
+	if cfg.MinMoveInterval > 0 && !p.lastMoveAt.IsZero() && game.clock.Now().Sub(p.lastMoveAt) < cfg.MinMoveInterval {
+		return "too_fast"
+	}
+	return ""
+}
+
+// moveAccepted notes the time of p's accepted move. Runs on the game's
+// loop.
+func (game *Game) moveAccepted(p *Player) {
+	p.lastMoveAt = game.clock.Now()
+}
+
+// moveRejected counts p's refused move and flags p once the round's strikes
+// reach the threshold. Runs on the game's loop.
+func (game *Game) moveRejected(p *Player, code string) {
+	metrics.MovesRejected.Add(1)
+	if p.rejections == nil {
+		p.rejections = make(map[string]int)
+	}
+	p.rejections[code]++
+	if !strikeCodes[code] || cfg.SuspiciousRejections <= 0 {
+		return
+	}
+	if p.strikeRound != game.Round {
+		p.strikeRound, p.strikes = game.Round, 0
+	}
+	p.strikes++
+	if p.strikes == cfg.SuspiciousRejections {
+		game.flagSuspicious(p)
+	}
+}
+
+// flagSuspicious tells the others about p and, with -kick-suspicious,
+// closes it. Runs on the game's loop.
+func (game *Game) flagSuspicious(p *Player) {
+	p.suspicious = true
+	metrics.SuspiciousFlags.Add(1)
+	p.logger().Warn("suspicious move activity", "round", game.Round, "rejections", p.rejections)
+	for _, other := range game.connections() {
+		if other != p {
+			msg := protocol.Notice(protocol.EventSuspicious, "suspicious_activity")
+			msg.Player = p.Symbol
+			other.send(localize(other.locale(), msg))
+		}
+	}
+	if cfg.KickSuspicious && !p.kicked {
+		game.remove(p, "kicked_suspicious")
+	}
+}
@@ -0,0 +1,358 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// --- Ban List ---
+
+type Ban struct {
+	ID        string     `json:"id"`
+	IP        string     `json:"ip,omitempty"`       // Single address or CIDR block
+	Identity  string     `json:"identity,omitempty"` // Client-supplied player identity
+	Reason    string     `json:"reason,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func (b Ban) expired(now time.Time) bool {
+	return b.ExpiresAt != nil && !now.Before(*b.ExpiresAt)
+}
+
+type cidrBan struct {
+	network *net.IPNet
+	id      string
+}
+
+// banList indexes bans for cheap lookups on every connection: exact IPs and
+// identities are map hits, only CIDR blocks need a scan. A key can be
+// covered by several bans at once, say a permanent one and a temporary one
+// added later, so each index holds the set of ban IDs on its key and
+// removing or expiring one ban leaves the others in force.
+type banList struct {
+	mu         sync.RWMutex
+	byID       map[string]Ban
+	ips        map[string]map[string]bool
+	networks   []cidrBan
+	identities map[string]map[string]bool
+}
+
+var bans = newBanList()
+
+func newBanList() *banList {
+	return &banList{
+		byID:       make(map[string]Ban),
+		ips:        make(map[string]map[string]bool),
+		identities: make(map[string]map[string]bool),
+	}
+}
+
+// canonicalIP spells ip the way net.IP does, so "::ffff:10.0.0.1" and
+// "10.0.0.1", or differently abbreviated IPv6 addresses, share one key.
+// Anything that doesn't parse is returned as is.
+func canonicalIP(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil {
+		return parsed.String()
+	}
+	return ip
+}
+
+func addToSet(index map[string]map[string]bool, key, id string) {
+	if index[key] == nil {
+		index[key] = make(map[string]bool)
+	}
+	index[key][id] = true
+}
+
+func removeFromSet(index map[string]map[string]bool, key, id string) {
+	delete(index[key], id)
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+func (l *banList) Add(b Ban) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.byID[b.ID]; ok {
+		l.remove(b.ID)
+	}
+	l.byID[b.ID] = b
+	if b.IP != "" {
+		if _, network, err := net.ParseCIDR(b.IP); err == nil {
+			l.networks = append(l.networks, cidrBan{network: network, id: b.ID})
+		} else {
+			addToSet(l.ips, canonicalIP(b.IP), b.ID)
+		}
+	}
+	if b.Identity != "" {
+		addToSet(l.identities, b.Identity, b.ID)
+	}
+}
+
+func (l *banList) Remove(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.remove(id)
+}
+
+// remove drops ban id from byID and every index. Caller must hold l.mu.
+func (l *banList) remove(id string) bool {
+	b, ok := l.byID[id]
+	if !ok {
+		return false
+	}
+	delete(l.byID, id)
+	if b.IP != "" {
+		removeFromSet(l.ips, canonicalIP(b.IP), id)
+	}
+	if b.Identity != "" {
+		removeFromSet(l.identities, b.Identity, id)
+	}
+	for i, n := range l.networks {
+		if n.id == id {
+			l.networks = append(l.networks[:i], l.networks[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Evict drops the bans expired by now and returns their IDs.
+func (l *banList) Evict(now time.Time) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var evicted []string
+	for id, b := range l.byID {
+		if b.expired(now) {
+			evicted = append(evicted, id)
+		}
+	}
+	for _, id := range evicted {
+		l.remove(id)
+	}
+	return evicted
+}
+
+func (l *banList) List() []Ban {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	now := time.Now()
+	out := make([]Ban, 0, len(l.byID))
+	for _, b := range l.byID {
+		if !b.expired(now) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// Lookup returns the active ban covering ip or identity, if any.
+func (l *banList) Lookup(ip, identity string) (Ban, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	now := time.Now()
+	active := func(ids map[string]bool) (Ban, bool) {
+		for id := range ids {
+			if b, ok := l.byID[id]; ok && !b.expired(now) {
+				return b, true
+			}
+		}
+		return Ban{}, false
+	}
+
+	if b, ok := active(l.ips[canonicalIP(ip)]); ok {
+		return b, true
+	}
+	if identity != "" {
+		if b, ok := active(l.identities[identity]); ok {
+			return b, true
+		}
+	}
+	if parsed := net.ParseIP(ip); parsed != nil {
+		for _, n := range l.networks {
+			if n.network.Contains(parsed) {
+				if b, ok := l.byID[n.id]; ok && !b.expired(now) {
+					return b, true
+				}
+			}
+		}
+	}
+	return Ban{}, false
+}
+
+// evictBans forgets the bans that have run out, in memory and in the
+// store. The sweeper calls it.
+func evictBans(now time.Time) {
+	for _, id := range bans.Evict(now) {
+		if err := store.DeleteBan(id); err != nil {
+			slog.Error("deleting expired ban", "ban_id", id, "err", err)
+		}
+	}
+}
+
+// loadBans seeds the in-memory ban list from the configured store.
+func loadBans() {
+	stored, err := store.ListBans()
+	if err != nil {
+		slog.Error("loading bans", "err", err)
+		return
+	}
+	now := time.Now()
+	for _, b := range stored {
+		if !b.expired(now) {
+			bans.Add(b)
+		}
+	}
+}
+
+func requestIdentity(r *http.Request) string {
+	if id := r.URL.Query().Get("client_id"); id != "" {
+		return id
+	}
+	return r.Header.Get("X-Client-ID")
+}
+
+// rejectBanned refuses requests from banned IPs or identities with 403
+// before the wrapped handler runs.
+func rejectBanned(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, banned := bans.Lookup(limitIP(r), requestIdentity(r)); banned {
+			writeError(w, r, http.StatusForbidden, "banned")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// disconnectBanned closes every live socket covered by the ban with a
+// policy-violation close frame; the read loops then run normal cleanup.
+func disconnectBanned(b Ban) {
+	list := newBanList()
+	list.Add(b)
+	msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "banned")
+
+	for _, game := range liveGames() {
+		game.do(func() {
+			for _, p := range game.connections() {
+				if _, hit := list.Lookup(p.IP, p.Identity); hit {
+					p.Conn.WriteClose(msg)
+					p.drop()
+				}
+			}
+		})
+	}
+
+	var hits []*websocket.Conn
+	sideSockets.Lock()
+	for s := range sideSockets.set {
+		if _, hit := list.Lookup(s.ip, s.identity); hit {
+			hits = append(hits, s.ws)
+		}
+	}
+	sideSockets.Unlock()
+	for _, ws := range hits {
+		ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		ws.Close() // Its handler's read fails, and the handler returns
+	}
+}
+
+// sideSocket is an open websocket with no seat in a game: one waiting in
+// the quick match queue, watching the lobby or playing a puzzle. Game
+// connections are found through their games; these are kept in
+// sideSockets so a ban reaches them too.
+type sideSocket struct {
+	ws       *websocket.Conn
+	ip       string
+	identity string
+}
+
+var sideSockets = struct {
+	sync.Mutex
+	set map[*sideSocket]struct{}
+}{set: make(map[*sideSocket]struct{})}
+
+// trackSocket adds ws, opened by r, to sideSockets until the returned
+// function is called.
+func trackSocket(ws *websocket.Conn, r *http.Request) (untrack func()) {
+	s := &sideSocket{ws: ws, ip: limitIP(r), identity: requestIdentity(r)}
+	sideSockets.Lock()
+	sideSockets.set[s] = struct{}{}
+	sideSockets.Unlock()
+	return func() {
+		sideSockets.Lock()
+		delete(sideSockets.set, s)
+		sideSockets.Unlock()
+	}
+}
+
+type banRequest struct {
+	IP        string     `json:"ip"`
+	Identity  string     `json:"identity"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func createBan(w http.ResponseWriter, r *http.Request) {
+	var req banRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body")
+		return
+	}
+	req.IP = strings.TrimSpace(req.IP)
+	req.Identity = strings.TrimSpace(req.Identity)
+	if req.IP == "" && req.Identity == "" {
+		writeError(w, r, http.StatusBadRequest, "ban_target_required")
+		return
+	}
+	if req.IP != "" {
+		if net.ParseIP(req.IP) != nil {
+			req.IP = canonicalIP(req.IP)
+		} else if _, _, err := net.ParseCIDR(req.IP); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid_ip")
+			return
+		}
+	}
+
+	b := Ban{
+		ID:        newID(),
+		IP:        req.IP,
+		Identity:  req.Identity,
+		Reason:    req.Reason,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := store.SaveBan(b); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+	bans.Add(b)
+	disconnectBanned(b)
+
+	writeJSON(w, http.StatusCreated, b)
+}
+
+func deleteBan(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["ban_id"]
+	if !bans.Remove(id) {
+		writeError(w, r, http.StatusNotFound, "ban_not_found")
+		return
+	}
+	if err := store.DeleteBan(id); err != nil {
+		slog.Error("deleting ban", "ban_id", id, "err", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listBans(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, bans.List())
+}
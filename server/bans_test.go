@@ -0,0 +1,192 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tictactoe/config"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestBanListKeepsOverlappingBans(t *testing.T) {
+	l := newBanList()
+	soon := time.Now().Add(time.Hour)
+	l.Add(Ban{ID: "permanent", IP: "10.0.0.1", Identity: "alice"})
+	l.Add(Ban{ID: "temporary", IP: "10.0.0.1", Identity: "alice", ExpiresAt: &soon})
+
+	if !l.Remove("temporary") {
+		t.Fatal("Remove(temporary) = false")
+	}
+	if b, ok := l.Lookup("10.0.0.1", ""); !ok || b.ID != "permanent" {
+		t.Errorf("Lookup by IP after removing the temporary ban = %+v, %v; want permanent", b, ok)
+	}
+	if b, ok := l.Lookup("192.0.2.1", "alice"); !ok || b.ID != "permanent" {
+		t.Errorf("Lookup by identity after removing the temporary ban = %+v, %v; want permanent", b, ok)
+	}
+}
+
+func TestBanListExpiredBanDoesNotHidePermanent(t *testing.T) {
+	l := newBanList()
+	past := time.Now().Add(-time.Minute)
+	l.Add(Ban{ID: "permanent", IP: "10.0.0.1"})
+	l.Add(Ban{ID: "expired", IP: "10.0.0.1", ExpiresAt: &past})
+
+	if b, ok := l.Lookup("10.0.0.1", ""); !ok || b.ID != "permanent" {
+		t.Errorf("Lookup = %+v, %v; want permanent", b, ok)
+	}
+}
+
+func TestBanListCanonicalizesIPs(t *testing.T) {
+	tests := []struct {
+		banned, lookup string
+	}{
+		{"10.0.0.1", "::ffff:10.0.0.1"},
+		{"::ffff:10.0.0.1", "10.0.0.1"},
+		{"2001:db8:0:0::1", "2001:db8::1"},
+		{"2001:DB8::1", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		l := newBanList()
+		l.Add(Ban{ID: "b", IP: tt.banned})
+		if _, ok := l.Lookup(tt.lookup, ""); !ok {
+			t.Errorf("ban on %q doesn't cover %q", tt.banned, tt.lookup)
+		}
+		if !l.Remove("b") {
+			t.Fatalf("Remove after banning %q = false", tt.banned)
+		}
+		if len(l.ips) != 0 {
+			t.Errorf("ips index after Remove = %v, want empty", l.ips)
+		}
+	}
+}
+
+func TestBanListCIDR(t *testing.T) {
+	l := newBanList()
+	l.Add(Ban{ID: "net", IP: "10.1.0.0/16"})
+	if _, ok := l.Lookup("10.1.2.3", ""); !ok {
+		t.Error("10.1.2.3 not covered by 10.1.0.0/16")
+	}
+	if _, ok := l.Lookup("10.2.0.1", ""); ok {
+		t.Error("10.2.0.1 covered by 10.1.0.0/16")
+	}
+}
+
+func TestBanListEvict(t *testing.T) {
+	l := newBanList()
+	now := time.Now()
+	past, future := now.Add(-time.Second), now.Add(time.Hour)
+	l.Add(Ban{ID: "gone-ip", IP: "10.0.0.1", ExpiresAt: &past})
+	l.Add(Ban{ID: "gone-net", IP: "10.2.0.0/16", ExpiresAt: &past})
+	l.Add(Ban{ID: "gone-identity", Identity: "bob", ExpiresAt: &past})
+	l.Add(Ban{ID: "kept", IP: "10.0.0.2", Identity: "carol", ExpiresAt: &future})
+
+	evicted := l.Evict(now)
+	if len(evicted) != 3 {
+		t.Errorf("Evict = %v, want the three expired bans", evicted)
+	}
+	if len(l.byID) != 1 || len(l.ips) != 1 || len(l.identities) != 1 || len(l.networks) != 0 {
+		t.Errorf("after Evict: byID %v, ips %v, identities %v, networks %v; want only kept", l.byID, l.ips, l.identities, l.networks)
+	}
+	if _, ok := l.Lookup("10.0.0.2", ""); !ok {
+		t.Error("kept ban no longer found")
+	}
+}
+
+// A banned address is refused on every socket route before the upgrade.
+func TestBannedRefusedOnSockets(t *testing.T) {
+	bans.Add(Ban{ID: "test-sockets", IP: "192.0.2.1"})
+	t.Cleanup(func() { bans.Remove("test-sockets") })
+	router := NewRouter()
+	for _, path := range []string{"/ws/" + unusedGameID(), "/ws/quickmatch", "/ws/puzzle/2026-01-01", "/lobby/ws"} {
+		r := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s from a banned address: %d, want 403", path, w.Code)
+		}
+	}
+}
+
+// Behind a trusted proxy the ban is checked against the client it
+// forwarded for, not the proxy.
+func TestBannedBehindProxy(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("192.0.2.0/24")
+	withConfig(t, func(c *config.Config) { c.TrustedProxies = []*net.IPNet{proxies} })
+	bans.Add(Ban{ID: "test-proxy", IP: "198.51.100.20"})
+	t.Cleanup(func() { bans.Remove("test-proxy") })
+	h := rejectBanned(func(w http.ResponseWriter, r *http.Request) {})
+	for forwarded, want := range map[string]int{"198.51.100.20": http.StatusForbidden, "198.51.100.21": http.StatusOK} {
+		r := httptest.NewRequest("GET", "/ws/quickmatch", nil)
+		r.Header.Set("X-Forwarded-For", forwarded)
+		w := httptest.NewRecorder()
+		h(w, r)
+		if w.Code != want {
+			t.Errorf("forwarded for %s: %d, want %d", forwarded, w.Code, want)
+		}
+	}
+}
+
+// A ban closes the sockets that have no game too: one waiting for a quick
+// match, one watching the lobby and one playing a puzzle.
+func TestBanClosesSideSockets(t *testing.T) {
+	withConfig(t, func(c *config.Config) { c.MaxConnsPerIP = 0 })
+	srv := httptest.NewServer(NewRouter())
+	t.Cleanup(srv.Close)
+	base := "ws" + strings.TrimPrefix(srv.URL, "http")
+	closed := map[string]chan error{}
+	for _, path := range []string{"/ws/quickmatch?client_id=ban-side-sockets", "/lobby/ws", "/ws/puzzle/2026-01-01"} {
+		ws, _, err := websocket.DefaultDialer.Dial(base+path, nil)
+		if err != nil {
+			t.Fatalf("dial %s: %v", path, err)
+		}
+		t.Cleanup(func() { ws.Close() })
+		if _, _, err := ws.ReadMessage(); err != nil {
+			t.Fatalf("%s: %v before the ban", path, err)
+		}
+		done := make(chan error, 1)
+		go func() {
+			for {
+				if _, _, err := ws.ReadMessage(); err != nil {
+					done <- err
+					return
+				}
+			}
+		}()
+		closed[path] = done
+	}
+
+	b := Ban{ID: "test-side-sockets", IP: "127.0.0.1"}
+	bans.Add(b)
+	t.Cleanup(func() { bans.Remove(b.ID) })
+	disconnectBanned(b)
+	for path, done := range closed {
+		select {
+		case err := <-done:
+			if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+				t.Errorf("%s closed with %v, want 1008", path, err)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s still open after the ban", path)
+		}
+	}
+	left := func() (n int) {
+		sideSockets.Lock()
+		defer sideSockets.Unlock()
+		for s := range sideSockets.set {
+			if s.ip == b.IP {
+				n++
+			}
+		}
+		return n
+	}
+	for deadline := time.Now().Add(time.Second); left() > 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d closed sockets still tracked", left())
+		}
+	}
+}
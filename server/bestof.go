@@ -0,0 +1,112 @@
+package server
+
+import (
+	"time"
+
+	"tictactoe/protocol"
+)
+
+// --- Best-of-N Series ---
+
+// A game created with best_of plays a series: the first player to
+// TargetWins rounds takes it, announced with series_over. Moves and
+// rematches are refused from then until both players send new_series,
+// which starts over at 0-0. Within a series, rounds follow each other by
+// rematch as in any game. Without best_of the score runs on indefinitely.
+
+// maxBestOf is the longest series a game can be created with.
+const maxBestOf = 99
+
+// validBestOf reports whether a series of n rounds is allowed: odd, so it
+// can't end level.
+func validBestOf(n int) bool {
+	return n >= 3 && n <= maxBestOf && n%2 == 1
+}
+
+// bestOf is the series length, or 0 for a game without one. Runs on
+// the game's loop.
+func (game *Game) bestOf() int {
+	if game.TargetWins == 0 {
+		return 0
+	}
+	return 2*game.TargetWins - 1
+}
+
+// seriesWinner is the symbol that has won the series, or "" while it is
+// undecided or the game has none. Runs on the game's loop.
+func (game *Game) seriesWinner() string {
+	if game.TargetWins == 0 {
+		return ""
+	}
+	for _, symbol := range game.symbols() {
+		if game.Score.Of(symbol) >= game.TargetWins {
+			return symbol
+		}
+	}
+	return ""
+}
+
+// seriesOver reports whether play waits on a new_series: the series is won,
+// was adjudicated when its deadline passed, or has played its max_rounds.
+// Runs on the game's loop.
+func (game *Game) seriesOver() bool {
+	return game.seriesWinner() != "" || game.SeriesAdjudicated != "" || game.roundsUp()
+}
+
+// checkSeries announces series_over if the round just won decided the
+// series, or series_summary if it was the last of a round-limited one.
+// Runs on the game's loop.
+func (game *Game) checkSeries() {
+	if game.roundsUp() {
+		game.summarizeSeries()
+		return
+	}
+	winner := game.seriesWinner()
+	if winner == "" {
+		return
+	}
+	game.logger().Info("series won", "winner", winner, "best_of", game.bestOf(), "score_x", game.Score.X, "score_o", game.Score.O)
+	game.journal.state("series_over", winner)
+	game.RematchRequests = make(map[string]bool)
+	broadcast(game, OutboundMessage{
+		Event:  protocol.EventSeriesOver,
+		Player: winner,
+		Score:  &game.Score,
+		BestOf: game.bestOf(),
+		Code:   "series_over",
+		Names:  game.playerNames(),
+	})
+}
+
+// handleNewSeries records p's new_series and, once both players (or the
+// player and the computer) have asked, resets the score and starts the
+// next series with the other player first. Runs on the game's loop.
+func (game *Game) handleNewSeries(p *Player) {
+	if !game.seriesOver() {
+		p.send(localize(p.locale(), protocol.Failure("series_not_over", "")))
+		return
+	}
+	game.NewSeriesRequests[p.Symbol] = true
+	if len(game.NewSeriesRequests) == 1 {
+		broadcast(game, OutboundMessage{Event: protocol.EventNewSeriesRequested, Player: p.Symbol, From: p.participant()})
+	}
+	if game.AI != "" {
+		game.NewSeriesRequests[game.AI] = true
+	}
+	if len(game.NewSeriesRequests) < 2 {
+		return
+	}
+
+	game.logger().Info("new series", "best_of", game.bestOf())
+	game.journal.state("series_started", "")
+	nextStarter := game.nextStarter()
+	game.archiveRound()
+	game.Score = Score{}
+	game.RoundResults = nil
+	game.SeriesRounds, game.SeriesStartedAt = 0, time.Time{}
+	game.clearSeriesDeadline()
+	game.forgetSent()
+	game.StartingPlayerForRound = nextStarter
+	resetGameBoard(game, nextStarter)
+	game.startRound(protocol.EventNewGame)
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"tictactoe/engine"
+	"tictactoe/protocol"
+	"tictactoe/replay"
+)
+
+// --- Blitz ---
+
+// A game created with "variant": "blitz" keeps only each player's last
+// three marks on the board; see engine/blitz.go. The fourth clears the
+// oldest before it is judged, so a line broken that way doesn't win. The
+// move event says which cell a mark cleared as removed, and every move,
+// undo_applied and round announcement, state_sync included, gives as
+// fading the cell each player's next mark will clear. Which marks are
+// whose, and in what order, comes from game.Moves, so a new round and an
+// undo both start from the right place. Blitz is won by three in a row on
+// any board, and the computer doesn't play it.
+
+// blitz reports whether the game plays blitz. Runs on the game's loop.
+func (game *Game) blitz() bool {
+	return engine.IsBlitz(game.WinConditions)
+}
+
+// placed is the cells symbol marked this round, oldest first, including
+// any since cleared.
+func placed(moves []replay.Move, symbol string) []engine.Cell {
+	var out []engine.Cell
+	for _, mv := range moves {
+		if !mv.Skipped && mv.Player == symbol {
+			out = append(out, engine.Cell{Row: mv.Row, Col: mv.Col})
+		}
+	}
+	return out
+}
+
+// fading is, by symbol, the cell each player's next mark clears, or nil
+// outside blitz. Runs on the game's loop.
+func (game *Game) fading() map[string]protocol.Cell {
+	if !game.blitz() {
+		return nil
+	}
+	out := make(map[string]protocol.Cell)
+	for _, symbol := range game.symbols() {
+		if c, ok := engine.Fading(placed(game.Moves, symbol), game.WinConditions); ok {
+			out[symbol] = protocol.Cell{Row: c.Row, Col: c.Col}
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// replayBoard redraws the board from the round's moves, clearing marks as
+// blitz did when they were made. Runs on the game's loop.
+func (game *Game) replayBoard() {
+	game.Board = engine.NewBoard(game.Board.Size())
+	for i, mv := range game.Moves {
+		if mv.Skipped {
+			continue
+		}
+		engine.Fade(game.Board, placed(game.Moves[:i], mv.Player), game.WinConditions)
+		game.Board[mv.Row][mv.Col] = mv.Symbol()
+	}
+}
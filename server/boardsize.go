@@ -0,0 +1,50 @@
+package server
+
+import (
+	"fmt"
+
+	"tictactoe/engine"
+)
+
+// --- Board Size ---
+
+// A game can be created on any board from engine.MinSize to engine.MaxSize
+// on a side, won by WinLength in a row instead of a full line. Games that
+// don't ask play the classic 3x3 board, so older clients never see anything
+// else. The computer only plays the classic board; see playAI.
+
+// boardRules checks a requested size and win length, either 0 for the
+// default, and returns the size and the WinLength to store.
+func boardRules(size, winLength int) (int, int, error) {
+	if size == 0 {
+		size = engine.DefaultSize
+	}
+	if !engine.ValidSize(size) {
+		return 0, 0, fmt.Errorf("size must be from %d to %d", engine.MinSize, engine.MaxSize)
+	}
+	if winLength == 0 || winLength == size {
+		return size, 0, nil
+	}
+	if !engine.ValidWinLength(size, winLength) {
+		return 0, 0, fmt.Errorf("win_length must be from %d to the size, %d", engine.MinSize, size)
+	}
+	return size, winLength, nil
+}
+
+// recordedSize is the board size as kept in records and replays: 0 for the
+// default board, so those stay as they were. Runs on the game's loop.
+func (game *Game) recordedSize() int {
+	if n := game.Board.Size(); n != engine.DefaultSize {
+		return n
+	}
+	return 0
+}
+
+// winLength is how many marks in a row win a round. Runs on the game's
+// loop.
+func (game *Game) winLength() int {
+	if game.WinLength != 0 {
+		return game.WinLength
+	}
+	return game.Board.Size()
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// --- Anti-Bot Challenge ---
+
+// With -challenge on, creating a game takes a solved proof of work or a
+// CAPTCHA token: in the body of POST /games, or in the URL of a join that
+// would create the game it names. Joining a game that already exists
+// doesn't, so a challenge passed once covers both players.
+
+const challengeTTL = 2 * time.Minute
+
+// maxChallenges caps the nonces outstanding at once, so a client can't fill
+// memory by fetching /challenge without ever solving one.
+const maxChallenges = 10000
+
+type PowSolution struct {
+	Nonce    string `json:"nonce"`
+	Solution string `json:"solution"`
+}
+
+// powChallenges holds issued nonces until they are solved or expire. Each
+// nonce can be redeemed once. Every nonce lives for challengeTTL, so order,
+// the nonces by when they were issued, is also the order they expire in:
+// expiring them only ever looks at its front.
+type powChallenges struct {
+	mu     sync.Mutex
+	issued map[string]time.Time
+	order  []string
+}
+
+var challenges = newPowChallenges()
+
+func newPowChallenges() *powChallenges {
+	return &powChallenges{issued: make(map[string]time.Time)}
+}
+
+// Issue hands out a new nonce, or reports false while maxChallenges are
+// outstanding.
+func (c *powChallenges) Issue() (string, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.expire(now)
+	if len(c.issued) >= maxChallenges {
+		return "", time.Time{}, false
+	}
+	nonce := newID()
+	exp := now.Add(challengeTTL)
+	c.issued[nonce] = exp
+	c.order = append(c.order, nonce)
+	return nonce, exp, true
+}
+
+// Redeem consumes nonce, reporting whether it was issued and unexpired.
+func (c *powChallenges) Redeem(nonce string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	exp, ok := c.issued[nonce]
+	delete(c.issued, nonce)
+	return ok && time.Now().Before(exp)
+}
+
+// expire drops the nonces expired by now, and those already redeemed from
+// the front of order. Caller must hold c.mu.
+func (c *powChallenges) expire(now time.Time) {
+	i := 0
+	for ; i < len(c.order); i++ {
+		exp, ok := c.issued[c.order[i]]
+		if ok && now.Before(exp) {
+			break
+		}
+		delete(c.issued, c.order[i])
+	}
+	c.order = c.order[i:]
+}
+
+// Sweep expires nonces nobody asked about since they ran out. The sweeper
+// calls it.
+func (c *powChallenges) Sweep(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(now)
+}
+
+// socketChallenge reads a challenge answer from a websocket URL, which has
+// no body to carry one: ?nonce= and ?solution= for pow, ?captcha_token= for
+// captcha.
+func socketChallenge(r *http.Request) (*PowSolution, string) {
+	q := r.URL.Query()
+	var pow *PowSolution
+	if nonce := q.Get("nonce"); nonce != "" {
+		pow = &PowSolution{Nonce: nonce, Solution: q.Get("solution")}
+	}
+	return pow, q.Get("captcha_token")
+}
+
+// leadingZeroBits counts the zero bits at the start of sha256(nonce+solution).
+func leadingZeroBits(nonce, solution string) int {
+	sum := sha256.Sum256([]byte(nonce + solution))
+	n := 0
+	for _, b := range sum {
+		if b == 0 {
+			n += 8
+			continue
+		}
+		n += bits.LeadingZeros8(b)
+		break
+	}
+	return n
+}
+
+func verifyPow(sol *PowSolution) bool {
+	if sol == nil || sol.Nonce == "" {
+		return false
+	}
+	if leadingZeroBits(sol.Nonce, sol.Solution) < cfg.PowDifficulty {
+		return false
+	}
+	return challenges.Redeem(sol.Nonce)
+}
+
+var captchaClient = &http.Client{Timeout: 5 * time.Second}
+
+// verifyCaptcha checks a token with a siteverify-style provider endpoint
+// (reCAPTCHA, hCaptcha and Turnstile all share this shape).
+func verifyCaptcha(token, remoteIP string) bool {
+	if token == "" {
+		return false
+	}
+	resp, err := captchaClient.PostForm(cfg.CaptchaVerifyURL, url.Values{
+		"secret":   {cfg.CaptchaSecret},
+		"response": {token},
+		"remoteip": {remoteIP},
+	})
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false
+	}
+	return result.Success
+}
+
+// challengeRequired reports whether r must pass the configured challenge:
+// admins, seated players and trusted networks are exempt.
+func challengeRequired(r *http.Request) bool {
+	if cfg.Challenge == "off" {
+		return false
+	}
+	if inNets(limitIP(r), cfg.TrustedNets) {
+		return false
+	}
+	if isAdminRequest(r) || playerByToken(r.Header.Get("X-Player-Token")) != nil {
+		return false
+	}
+	return true
+}
+
+func passChallenge(r *http.Request, pow *PowSolution, captchaToken string) bool {
+	switch cfg.Challenge {
+	case "pow":
+		return verifyPow(pow)
+	case "captcha":
+		return verifyCaptcha(captchaToken, limitIP(r))
+	}
+	return true
+}
+
+func issueChallenge(w http.ResponseWriter, r *http.Request) {
+	if cfg.Challenge != "pow" {
+		writeError(w, r, http.StatusNotFound, "challenge_disabled")
+		return
+	}
+	nonce, exp, ok := challenges.Issue()
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(challengeTTL.Seconds())))
+		writeError(w, r, http.StatusServiceUnavailable, "too_many_challenges")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"nonce":      nonce,
+		"difficulty": cfg.PowDifficulty,
+		"algorithm":  "sha256(nonce+solution) with leading zero bits",
+		"expires_at": exp.UTC(),
+	})
+}
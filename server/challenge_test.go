@@ -0,0 +1,154 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"tictactoe/config"
+)
+
+func TestPowChallengesCap(t *testing.T) {
+	c := newPowChallenges()
+	for i := 0; i < maxChallenges; i++ {
+		if _, _, ok := c.Issue(); !ok {
+			t.Fatalf("Issue #%d refused below the cap", i+1)
+		}
+	}
+	if _, _, ok := c.Issue(); ok {
+		t.Fatal("Issue beyond maxChallenges succeeded")
+	}
+}
+
+func TestPowChallengesExpire(t *testing.T) {
+	c := newPowChallenges()
+	first, _, _ := c.Issue()
+	second, _, _ := c.Issue()
+	if !c.Redeem(first) {
+		t.Fatal("Redeem(first) = false")
+	}
+	if c.Redeem(first) {
+		t.Error("a nonce was redeemed twice")
+	}
+
+	c.Sweep(time.Now().Add(challengeTTL))
+	if len(c.issued) != 0 || len(c.order) != 0 {
+		t.Errorf("after Sweep past the TTL: %d issued, %d in order; want none", len(c.issued), len(c.order))
+	}
+	if c.Redeem(second) {
+		t.Error("an expired nonce was redeemed")
+	}
+}
+
+// solvePow finds a solution for nonce at cfg.PowDifficulty.
+func solvePow(t *testing.T, nonce string) string {
+	t.Helper()
+	for i := 0; i < 1<<20; i++ {
+		if s := fmt.Sprint(i); leadingZeroBits(nonce, s) >= cfg.PowDifficulty {
+			return s
+		}
+	}
+	t.Fatal("no solution found")
+	return ""
+}
+
+func TestImplicitCreationNeedsChallenge(t *testing.T) {
+	withConfig(t, func(c *config.Config) {
+		c.Challenge = "pow"
+		c.PowDifficulty = 4
+	})
+	key := gameKey{Tenant: config.DefaultTenant, ID: "challenge-" + newID()}
+	join := func(query url.Values) (*Game, string) {
+		r := httptest.NewRequest("GET", "/ws/"+key.ID+"?"+query.Encode(), nil)
+		var game *Game
+		code := onGame(key, r, func(g *Game, _ bool) { game = g })
+		return game, code
+	}
+
+	if _, code := join(nil); code != "challenge_failed" {
+		t.Fatalf("join without a solution: code %q, want challenge_failed", code)
+	}
+	if _, code := join(url.Values{"nonce": {"made-up"}, "solution": {"0"}}); code != "challenge_failed" {
+		t.Fatalf("join with an unissued nonce: code %q, want challenge_failed", code)
+	}
+
+	nonce, _, _ := challenges.Issue()
+	game, code := join(url.Values{"nonce": {nonce}, "solution": {solvePow(t, nonce)}})
+	if code != "" {
+		t.Fatalf("join with a solution: code %q", code)
+	}
+	defer game.do(func() { removeGame(game, endClosed) })
+
+	if _, code := join(nil); code != "" {
+		t.Errorf("joining the existing game without a solution: code %q, want none", code)
+	}
+}
+
+// A client in a trusted network skips the challenge behind a trusted proxy
+// too, and a forwarded address from anyone else is not taken at its word.
+func TestTrustedNetBehindProxy(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("192.0.2.0/24")
+	_, trusted, _ := net.ParseCIDR("203.0.113.0/24")
+	withConfig(t, func(c *config.Config) {
+		c.Challenge = "pow"
+		c.TrustedNets = []*net.IPNet{trusted}
+	})
+	r := httptest.NewRequest("POST", "/games", nil)
+	r.Header.Set("X-Forwarded-For", "203.0.113.9")
+	if !challengeRequired(r) {
+		t.Error("trusted a forwarded address from a peer that isn't a proxy")
+	}
+	cfg.TrustedProxies = []*net.IPNet{proxies}
+	if challengeRequired(r) {
+		t.Error("challenged a trusted client behind a trusted proxy")
+	}
+	r.Header.Set("X-Forwarded-For", "198.51.100.9")
+	if !challengeRequired(r) {
+		t.Error("skipped the challenge for an untrusted client behind a trusted proxy")
+	}
+}
+
+// A game refused for its settings leaves the solution sent with it
+// unredeemed, for the corrected request to use.
+func TestBadBodyKeepsSolution(t *testing.T) {
+	withConfig(t, func(c *config.Config) {
+		c.Challenge = "pow"
+		c.PowDifficulty = 4
+	})
+	untracked(t, "192.0.2.1") // httptest's client
+	t.Cleanup(func() { flush(t) })
+	nonce, _, _ := challenges.Issue()
+	solution := solvePow(t, nonce)
+	create := func(size int) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"size":%d,"challenge":{"nonce":%q,"solution":%q}}`, size, nonce, solution)
+		w := httptest.NewRecorder()
+		createGame(w, httptest.NewRequest("POST", "/games", strings.NewReader(body)))
+		return w
+	}
+	if w := create(99); w.Code != http.StatusBadRequest {
+		t.Fatalf("a size of 99: %d, want 400", w.Code)
+	}
+	w := create(3)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("the same solution with a good body: %d %s, want 201", w.Code, w.Body)
+	}
+	var resp struct {
+		GameID string `json:"game_id"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	gamesMutex.RLock()
+	game := games[gameKey{config.DefaultTenant, resp.GameID}]
+	gamesMutex.RUnlock()
+	if game != nil {
+		game.do(func() { removeGame(game, endClosed) })
+	}
+	if w := create(3); w.Code != http.StatusForbidden {
+		t.Errorf("a solution used twice: %d, want 403", w.Code)
+	}
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"tictactoe/protocol"
+)
+
+// --- Chat ---
+
+// Players talk over the game's websocket. Each line is cleaned of control
+// characters, relayed to everyone in the game, sender included, and kept in
+// the chat buffer for abuse reports. Spectators read along but can't send.
+
+const chatMaxText = 500 // Max runes per chat message
+
+// maxInboundSize bounds every inbound websocket message. A full-length chat
+// message fits even with every rune escaped.
+const maxInboundSize = 8 << 10
+
+// chatLimiter throttles chat per connection, keyed by Player.ID.
+var chatLimiter = newWindowLimiter(5, 5*time.Second)
+
+// cleanChat strips control characters other than newlines and surrounding
+// whitespace from a chat message.
+func cleanChat(text string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' {
+			return -1
+		}
+		return r
+	}, text))
+}
+
+// handleChat relays p's message to the game. Runs on the game's loop.
+func (game *Game) handleChat(p *Player, text string) {
+	text = cleanChat(text)
+	switch {
+	case text == "":
+		return
+	case utf8.RuneCountInString(text) > chatMaxText:
+		p.send(localize(p.locale(), protocol.Failure("chat_too_long", "")))
+		return
+	case !chatLimiter.Allow(p.ID):
+		p.send(localize(p.locale(), protocol.Failure("chat_rate_limited", "")))
+		return
+	}
+	game.recordChat(ChatMessage{Player: p.Symbol, Text: text, SentAt: time.Now().UTC()})
+	broadcast(game, OutboundMessage{Event: protocol.EventChat, Player: p.Symbol, From: p.participant(), Text: text})
+}
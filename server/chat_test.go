@@ -0,0 +1,47 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"tictactoe/protocol"
+)
+
+// A player may chat five times in five seconds; the sixth line is refused,
+// and once the first has left the window another goes through.
+func TestChatRateLimit(t *testing.T) {
+	quickGames(t)
+	clock := newFakeClock()
+	old := chatLimiter
+	chatLimiter = newWindowLimiter(5, 5*time.Second)
+	chatLimiter.clock = clock
+	t.Cleanup(func() { chatLimiter = old })
+	id := unusedGameID()
+	x, xc := joinFake(t, id, "")
+	_, oc := joinFake(t, id, "")
+	xc.expect(t, protocol.EventStartGame)
+	oc.expect(t, protocol.EventStartGame)
+	chat := func() {
+		x.receive([]byte(`{"event":"chat","text":"hi"}`), newFlood(), gameRequest(id, ""))
+	}
+	refused := func(which string) {
+		t.Helper()
+		if msg := xc.expect(t, ""); msg.Code != "chat_rate_limited" { // Errors carry no event
+			t.Errorf("%s refused with %q, want chat_rate_limited", which, msg.Code)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		chat()
+		oc.expect(t, protocol.EventChat)
+		clock.Advance(time.Second / 2)
+	}
+	chat()
+	refused("the sixth line")
+
+	clock.Advance(2500 * time.Millisecond) // The first line is 5s old
+	chat()
+	oc.expect(t, protocol.EventChat)
+	chat()
+	refused("a line past the window's allowance")
+}
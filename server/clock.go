@@ -0,0 +1,182 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// --- Time Control ---
+
+// A game with a TimeControl gives each player that much time for the whole
+// round, chess style. The clock of the player on turn runs until they move
+// or their turn is skipped, and a player whose clock runs out loses the
+// round (flag_fall, a point to the opponent). Round announcements, moves
+// and skipped turns carry both clocks, so clients can count down between
+// messages. The clocks stop between rounds and are full again for each new
+// one. A player who drops or goes quiet keeps their clock running, so the
+// reconnect grace comes out of their own time; the one left waiting has
+// theirs stopped, since they can't move until play resumes. A TurnTimer can run
+// alongside, and whichever runs out first decides. Time control is for two
+// players in real time, never for correspondence or three-player games.
+
+// clock is where time control reads the time and sets its timers, so a
+// fake one can stand in for the real one.
+type clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) clockTimer
+}
+
+// clockTimer is a timer set by a clock.
+type clockTimer interface {
+	Stop() bool
+}
+
+// systemClock is the real clock. Its readings carry the monotonic clock, so
+// the time charged to a player is immune to the wall clock being set.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) clockTimer {
+	return time.AfterFunc(d, f)
+}
+
+// timeLeft is what remains on symbol's clock now. Runs on the game's
+// loop.
+func (game *Game) timeLeft(symbol string) time.Duration {
+	left, ok := game.clockLeft[symbol]
+	if !ok {
+		left = game.TimeControl
+	}
+	if symbol == game.clockOn {
+		left -= game.clock.Now().Sub(game.clockSince)
+	}
+	return max(left, 0)
+}
+
+// clocks is every player's time left in milliseconds, for a message, or nil
+// without time control. Runs on the game's loop.
+func (game *Game) clocks() map[string]int64 {
+	if !game.timeControlled() {
+		return nil
+	}
+	out := make(map[string]int64)
+	for _, symbol := range game.symbols() {
+		out[symbol] = game.timeLeft(symbol).Milliseconds()
+	}
+	return out
+}
+
+// timeControlled reports whether the game plays with time control. Runs
+// on the game's loop.
+func (game *Game) timeControlled() bool {
+	return game.TimeControl > 0 && !game.Correspondence && !game.ThreePlayer
+}
+
+// runClock stops whichever clock is running and starts the one of the
+// player on turn, if the round is in play. Runs on the game's loop.
+func (game *Game) runClock() {
+	game.stopClock()
+	if !game.timeControlled() || !game.canPlay() || game.Ready != nil || game.scheduled() || game.starting() || game.roundOver() {
+		return
+	}
+	game.clockOn, game.clockSince = game.CurrentPlayer, game.clock.Now()
+	gen := game.clockGen
+	game.flagTimer = game.clock.AfterFunc(game.timeLeft(game.clockOn), func() {
+		game.do(func() {
+			if game.clockGen != gen || game.closed {
+				return
+			}
+			game.flagTimer = nil
+			game.journal.timer("flag")
+			game.flagFall()
+		})
+	})
+}
+
+// stopClock stops the running clock, keeping the time left on it, and
+// cancels its flag, including one that already fell and is waiting its
+// turn on the loop. Runs on the game's loop.
+func (game *Game) stopClock() {
+	if game.flagTimer != nil {
+		game.flagTimer.Stop()
+		game.flagTimer = nil
+	}
+	game.clockGen++
+	if game.clockOn != "" {
+		game.clockLeft[game.clockOn] = game.timeLeft(game.clockOn)
+		game.clockOn = ""
+	}
+}
+
+// resetClocks stops the clocks and fills them for a new round. Runs on
+// the game's loop.
+func (game *Game) resetClocks() {
+	game.stopClock()
+	game.clockLeft = make(map[string]time.Duration)
+}
+
+// outOfTime reports whether symbol's clock has run out, though its flag
+// may not have been seen to fall yet. Runs on the game's loop.
+func (game *Game) outOfTime(symbol string) bool {
+	return game.timeControlled() && symbol == game.clockOn && game.timeLeft(symbol) == 0
+}
+
+// flagFall ends the round for the player whose clock ran out, giving it to
+// their opponent. Runs on the game's loop.
+func (game *Game) flagFall() {
+	late := game.clockOn
+	game.stopClock()
+	for _, p := range game.Players {
+		p.pending = nil // Too late to confirm
+	}
+	game.logger().Info("flag fell, round forfeited", "player", late)
+	winner := engine.Other(late)
+	game.TimeoutWinner = winner
+	game.award(winner)
+	game.cancelReminder()
+	game.stopTurnTimer()
+	game.recordResult(winner)
+	broadcast(game, game.withRatingUpdate(OutboundMessage{
+		Event:  protocol.EventFlagFall,
+		Player: winner,
+		Board:  protocol.NewBoard(game.Board),
+		Score:  &game.Score,
+		Code:   "flag_fall",
+		Names:  game.playerNames(),
+		Clocks: game.clocks(),
+
+		RoundStats: game.roundStats(),
+	}, winner))
+	game.stats.rounds++
+	game.checkSeries()
+}
+
+// leaveClock keeps the clock running for a player who drops or goes quiet
+// on their own turn, and stops it for the one left waiting on theirs.
+// Runs on the game's loop.
+func (game *Game) leaveClock(p *Player) {
+	if game.clockOn != "" && game.clockOn != p.Symbol {
+		game.stopClock()
+	}
+}
+
+// timeControlRules is the time control req asks for, -time-control if it
+// doesn't say.
+func timeControlRules(req createGameRequest) (time.Duration, error) {
+	if req.TimeControl == nil {
+		return cfg.TimeControl, nil
+	}
+	switch seconds := *req.TimeControl; {
+	case seconds < 0:
+		return 0, fmt.Errorf("time_control can't be negative")
+	case seconds > 0 && req.Correspondence:
+		return 0, fmt.Errorf("a correspondence game can't have a time control")
+	case seconds > 0 && req.Players == 3:
+		return 0, fmt.Errorf("a three-player game can't have a time control")
+	}
+	return time.Duration(*req.TimeControl) * time.Second, nil
+}
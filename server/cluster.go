@@ -0,0 +1,506 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"tictactoe/protocol"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+// --- Distributed Mode ---
+
+// With -redis-addr, instances behind one load balancer share games: X can
+// connect to one and O to another. Each game is hosted by a single
+// instance, the one that claimed it first under clusterHost, and lives in
+// its memory as it would without Redis, so every move still goes through
+// that one game's loop. A websocket that lands on another instance is
+// relayed: its frames and pongs are published to the host's channel, and
+// the host sends what the player would get back over the relaying
+// instance's channel, through a relayConn standing in for the websocket.
+// Pings run end to end, so either side going away shows up as missed pongs
+// at the host or, at the relay, as a host gone silent. The host renews its
+// claims while the game is live and releases them when it is removed. What
+// isn't relayed only sees the games hosted where it lands: the REST
+// endpoints, event streams (refused with game_elsewhere) and quick match.
+// A host that dies takes its games with it, as a restart would without a
+// shared store, and seat tokens only check out elsewhere with a shared
+// -token-secret.
+
+const (
+	clusterHost     = "xo:host:"     // Followed by tenant|game ID; the ID of the instance hosting it
+	clusterInstance = "xo:instance:" // Followed by an instance ID; the channel that instance listens on
+)
+
+// hostTTL is how long a host's claim on a game outlasts its last renewal.
+// Claims are renewed three times as often.
+const hostTTL = 15 * time.Second
+
+// relayInbox bounds the envelopes waiting for one relayed connection, on
+// either side. One that overflows is dropped, as a slow consumer is.
+const relayInbox = 64
+
+// Envelope kinds. The first four go to the host, the rest to the relay.
+const (
+	relayJoin       = "join"        // A client connected; opens the connection
+	relayFrame      = "frame"       // One message from the client
+	relayPong       = "pong"        // The client answered a ping
+	relayLeave      = "leave"       // The client went away
+	relayMessage    = "message"     // One OutboundMessage for the client, as JSON
+	relayPing       = "ping"        // Ping the client with this stamp
+	relayCloseFrame = "close_frame" // Send the client this close frame
+	relayClose      = "close"       // Close the client's websocket
+)
+
+// relayEnvelope is one message between a relaying instance and a host.
+type relayEnvelope struct {
+	Kind string `json:"kind"`
+	Conn string `json:"conn"` // The relayed connection's ID, minted by the relay
+	Data []byte `json:"data,omitempty"`
+
+	// On join: where to reply and the request the client connected with
+	From   string      `json:"from,omitempty"`
+	Tenant string      `json:"tenant,omitempty"`
+	GameID string      `json:"game_id,omitempty"`
+	URL    string      `json:"url,omitempty"`
+	Host   string      `json:"host,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Remote string      `json:"remote,omitempty"`
+	Enc    string      `json:"enc,omitempty"` // The client's encoding, if not JSON
+	V      int         `json:"v,omitempty"`   // The client's wire version, if not protocol.V1
+}
+
+// cluster is this instance's part in distributed mode; nil without it.
+var cluster *clusterNode
+
+type clusterNode struct {
+	rdb *redis.Client
+
+	mu      sync.Mutex
+	hosted  map[string]*relayConn     // Connections relayed to games here, by ID
+	relayed map[string]*relayedSocket // Websockets here relayed elsewhere, by ID
+}
+
+// claimScript claims KEYS[1] for ARGV[1] for ARGV[2] milliseconds, or
+// renews the claim if ARGV[1] already holds it, and returns the holder.
+var claimScript = redis.NewScript(`
+local holder = redis.call("GET", KEYS[1])
+if not holder or holder == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return ARGV[1]
+end
+return holder`)
+
+// releaseScript deletes KEYS[1] if ARGV[1] holds it.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// startCluster joins the instances sharing the Redis server at addr. It
+// fails if Redis doesn't answer, rather than quietly playing alone.
+func startCluster(addr string) error {
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		return fmt.Errorf("distributed mode: redis at %s: %w", addr, err)
+	}
+	sub := rdb.Subscribe(ctx, clusterInstance+instanceID)
+	if _, err := sub.Receive(ctx); err != nil {
+		rdb.Close()
+		return fmt.Errorf("distributed mode: subscribing at %s: %w", addr, err)
+	}
+	cluster = &clusterNode{
+		rdb:     rdb,
+		hosted:  make(map[string]*relayConn),
+		relayed: make(map[string]*relayedSocket),
+	}
+	go cluster.listen(sub.Channel())
+	go cluster.renewClaims()
+	slog.Info("distributed mode", "redis", addr, "instance", instanceID)
+	return nil
+}
+
+func hostKey(key gameKey) string {
+	return clusterHost + key.Tenant + "|" + key.ID
+}
+
+// claim claims the game under key for this instance unless another hosts
+// it, and returns the host's instance ID.
+func (c *clusterNode) claim(key gameKey) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return claimScript.Run(ctx, c.rdb, []string{hostKey(key)}, instanceID, hostTTL.Milliseconds()).Text()
+}
+
+// release gives up this instance's claim on the game under key.
+func (c *clusterNode) release(key gameKey) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := releaseScript.Run(ctx, c.rdb, []string{hostKey(key)}, instanceID).Err(); err != nil {
+		slog.Warn("distributed mode: releasing game", "tenant", key.Tenant, "game_id", key.ID, "err", err)
+	}
+}
+
+// renewClaims keeps this instance's claims on its live games.
+func (c *clusterNode) renewClaims() {
+	ticker := time.NewTicker(hostTTL / 3)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, game := range liveGames() {
+			c.claimGame(game.key())
+		}
+	}
+}
+
+// claimGame claims a game this instance holds, warning if another
+// instance got there first: it is then played in two places at once.
+func (c *clusterNode) claimGame(key gameKey) {
+	host, err := c.claim(key)
+	switch {
+	case err != nil:
+		slog.Warn("distributed mode: claiming game", "tenant", key.Tenant, "game_id", key.ID, "err", err)
+	case host != instanceID:
+		slog.Warn("distributed mode: game is hosted by another instance too", "tenant", key.Tenant, "game_id", key.ID, "host", host)
+	}
+}
+
+// routeGame reports which instance hosts the game under key and whether
+// that is another one, claiming it for this one if none does. Without
+// distributed mode, or if Redis can't say, it is this one.
+func routeGame(key gameKey) (host string, remote bool) {
+	if cluster == nil {
+		return instanceID, false
+	}
+	host, err := cluster.claim(key)
+	if err != nil {
+		slog.Warn("distributed mode: can't look up game host, playing it here", "tenant", key.Tenant, "game_id", key.ID, "err", err)
+		return instanceID, false
+	}
+	return host, host != instanceID
+}
+
+// publish sends env to the instance with ID to.
+func (c *clusterNode) publish(to string, env relayEnvelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return c.rdb.Publish(ctx, clusterInstance+to, data).Err()
+}
+
+// listen hands each envelope sent to this instance to its connection. A
+// join registers its connection before the next envelope is read, so the
+// frames right behind it find it.
+func (c *clusterNode) listen(ch <-chan *redis.Message) {
+	for m := range ch {
+		var env relayEnvelope
+		if err := json.Unmarshal([]byte(m.Payload), &env); err != nil {
+			slog.Warn("distributed mode: bad envelope", "err", err)
+			continue
+		}
+		c.mu.Lock()
+		switch env.Kind {
+		case relayJoin:
+			codec, ok := protocol.CodecNamed(env.Enc)
+			if !ok {
+				codec = protocol.JSON
+			}
+			if env.V != 0 {
+				codec = protocol.ForVersion(codec, env.V)
+			}
+			rc := &relayConn{node: c, id: env.Conn, relay: env.From, codec: codec, inbox: make(chan relayEnvelope, relayInbox), done: make(chan struct{})}
+			c.hosted[env.Conn] = rc
+			go c.host(rc, env)
+		case relayFrame, relayPong, relayLeave:
+			if rc := c.hosted[env.Conn]; rc != nil {
+				rc.deliver(env)
+			}
+		default:
+			if s := c.relayed[env.Conn]; s != nil {
+				s.deliver(env)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// --- Relayed Connections: Host Side ---
+
+// relayConn is a conn to a websocket held by another instance.
+type relayConn struct {
+	node  *clusterNode
+	id    string
+	relay string // ID of the instance holding the websocket
+	codec protocol.Codec
+	inbox chan relayEnvelope
+
+	mu     sync.Mutex // Guards closed
+	closed bool
+	done   chan struct{} // Closed by Close; ends host
+}
+
+// deliver queues env for host, dropping the connection if it is too far
+// behind. Caller must hold the node's mu.
+func (rc *relayConn) deliver(env relayEnvelope) {
+	select {
+	case rc.inbox <- env:
+	default:
+		slog.Warn("distributed mode: relayed connection backed up, dropping it", "conn", rc.id)
+		go rc.Close()
+	}
+}
+
+// send publishes one envelope for the websocket, unless the conn is
+// closed.
+func (rc *relayConn) send(kind string, data []byte) error {
+	rc.mu.Lock()
+	closed := rc.closed
+	rc.mu.Unlock()
+	if closed {
+		return net.ErrClosed
+	}
+	return rc.node.publish(rc.relay, relayEnvelope{Kind: kind, Conn: rc.id, Data: data})
+}
+
+// Write is bounded by redisTimeout; the relay bounds the write to the
+// client itself by cfg.WriteTimeout.
+func (rc *relayConn) Write(msg OutboundMessage) error {
+	data, err := rc.codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return rc.send(relayMessage, data)
+}
+
+func (rc *relayConn) Codec() protocol.Codec {
+	return rc.codec
+}
+
+func (rc *relayConn) WriteClose(frame []byte) {
+	rc.send(relayCloseFrame, frame)
+}
+
+// Ping has the relay ping the client; its pong comes back as a pong
+// envelope.
+func (rc *relayConn) Ping(stamp string) error {
+	return rc.send(relayPing, []byte(stamp))
+}
+
+// SetReadDeadline does nothing: the relay keeps the read deadline on the
+// websocket.
+func (rc *relayConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func (rc *relayConn) Close() error {
+	rc.mu.Lock()
+	if rc.closed {
+		rc.mu.Unlock()
+		return nil
+	}
+	rc.closed = true
+	close(rc.done)
+	rc.mu.Unlock()
+	return rc.node.publish(rc.relay, relayEnvelope{Kind: relayClose, Conn: rc.id})
+}
+
+// host seats the relayed connection rc as join would a websocket opened
+// with env's request here, then feeds it the client's messages until
+// either side ends it.
+func (c *clusterNode) host(rc *relayConn, env relayEnvelope) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.hosted, rc.id)
+		c.mu.Unlock()
+	}()
+	r, err := http.NewRequest(http.MethodGet, env.URL, nil)
+	if err != nil {
+		slog.Warn("distributed mode: bad join", "conn", rc.id, "err", err)
+		rc.Close()
+		return
+	}
+	r.Host, r.Header, r.RemoteAddr = env.Host, env.Header, env.Remote
+	r = mux.SetURLVars(r, map[string]string{"tenant": env.Tenant, "game_id": env.GameID})
+	wsHandlers.Add(1)
+	defer wsHandlers.Done()
+
+	player := join(rc, r, declaredLocale(r))
+	if player == nil {
+		return
+	}
+	defer player.leave()
+	fl := newFlood()
+	for {
+		select {
+		case env := <-rc.inbox:
+			switch env.Kind {
+			case relayFrame:
+				player.receive(env.Data, fl, r)
+			case relayPong:
+				player.handlePong(string(env.Data))
+			case relayLeave:
+				return
+			}
+		case <-rc.done:
+			return
+		}
+	}
+}
+
+// --- Relayed Connections: Relay Side ---
+
+// relayedSocket is a websocket here whose game is hosted elsewhere.
+type relayedSocket struct {
+	ws    *websocket.Conn
+	codec protocol.Codec
+	inbox chan relayEnvelope
+}
+
+// deliver queues env for the websocket, closing it if it is too far
+// behind. Caller must hold the node's mu.
+func (s *relayedSocket) deliver(env relayEnvelope) {
+	select {
+	case s.inbox <- env:
+	default:
+		go func() {
+			s.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "slow consumer"), time.Now().Add(time.Second))
+			s.ws.Close()
+		}()
+	}
+}
+
+// relay carries ws, opened with r for the game under key and speaking
+// codec, to and from the game's host until either end closes it.
+func (c *clusterNode) relay(ws *websocket.Conn, r *http.Request, key gameKey, host string, codec protocol.Codec) {
+	id := newID()[:12]
+	s := &relayedSocket{ws: ws, codec: codec, inbox: make(chan relayEnvelope, relayInbox)}
+	c.mu.Lock()
+	c.relayed[id] = s
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.relayed, id)
+		c.mu.Unlock()
+		ws.Close()
+	}()
+
+	header := r.Header.Clone()
+	if r.TLS != nil {
+		header.Set("X-Forwarded-Proto", "https") // So the host hands out wss:// URLs
+	}
+	joined := relayEnvelope{
+		Kind:   relayJoin,
+		Conn:   id,
+		From:   instanceID,
+		Tenant: key.Tenant,
+		GameID: key.ID,
+		URL:    r.URL.RequestURI(),
+		Host:   r.Host,
+		Header: header,
+		Remote: r.RemoteAddr,
+	}
+	if codec.Name() != protocol.JSON.Name() {
+		joined.Enc = codec.Name()
+	}
+	if v := protocol.VersionOf(codec); v != protocol.V1 {
+		joined.V = v
+	}
+	if err := c.publish(host, joined); err != nil {
+		slog.Warn("distributed mode: can't reach game host", "game_id", key.ID, "host", host, "err", err)
+		ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(protocol.CloseShutdown, "game host unreachable"), time.Now().Add(time.Second))
+		return
+	}
+	slog.Info("connection relayed", "tenant", key.Tenant, "game_id", key.ID, "host", host, "conn", id)
+
+	done := make(chan struct{})
+	defer close(done)
+	go s.forward(done)
+
+	ws.SetReadLimit(maxInboundSize)
+	ws.SetReadDeadline(time.Now().Add(readTimeout()))
+	ws.SetPongHandler(func(stamp string) error {
+		ws.SetReadDeadline(time.Now().Add(readTimeout()))
+		return c.publish(host, relayEnvelope{Kind: relayPong, Conn: id, Data: []byte(stamp)})
+	})
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			if frame := readCloseFrame(err); frame != nil {
+				ws.WriteControl(websocket.CloseMessage, frame, time.Now().Add(time.Second))
+			}
+			break
+		}
+		ws.SetReadDeadline(time.Now().Add(readTimeout()))
+		if err := c.publish(host, relayEnvelope{Kind: relayFrame, Conn: id, Data: data}); err != nil {
+			slog.Warn("distributed mode: relaying to game host", "game_id", key.ID, "host", host, "err", err)
+			break
+		}
+	}
+	c.publish(host, relayEnvelope{Kind: relayLeave, Conn: id})
+}
+
+// forward writes what the host sends to the websocket until done is
+// closed or the host closes it. A host that sends nothing, pings
+// included, for readTimeout is taken to be gone.
+func (s *relayedSocket) forward(done <-chan struct{}) {
+	silence := time.NewTimer(readTimeout())
+	defer silence.Stop()
+	for {
+		select {
+		case env := <-s.inbox:
+			if !silence.Stop() {
+				<-silence.C
+			}
+			silence.Reset(readTimeout())
+			var err error
+			switch env.Kind {
+			case relayMessage:
+				s.ws.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+				err = s.ws.WriteMessage(frameType(s.codec), env.Data)
+			case relayPing:
+				err = s.ws.WriteControl(websocket.PingMessage, env.Data, time.Now().Add(cfg.WriteTimeout))
+			case relayCloseFrame:
+				s.ws.WriteControl(websocket.CloseMessage, env.Data, time.Now().Add(time.Second))
+			case relayClose:
+				s.ws.Close()
+				return
+			}
+			if err != nil {
+				s.ws.Close()
+				return
+			}
+		case <-silence.C:
+			slog.Warn("distributed mode: game host went silent, closing relayed connection")
+			s.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(protocol.CloseShutdown, "game host gone"), time.Now().Add(time.Second))
+			s.ws.Close()
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+// closeRelayed closes every websocket this instance relays, for shutdown.
+func (c *clusterNode) closeRelayed() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.relayed {
+		s.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(protocol.CloseShutdown, "server shutdown"), time.Now().Add(time.Second))
+		s.ws.Close()
+	}
+}
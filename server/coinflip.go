@@ -0,0 +1,59 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"tictactoe/protocol"
+)
+
+// --- Coin Flip ---
+
+// A game created with coin_flip has a coin decide who starts round 1,
+// instead of first. The coin is a random nonce drawn when the game is
+// created. Its commitment comes back from POST /games and on every
+// player_assignment until the flip, so each player holds it before the
+// second one joins. Once every seat is taken, coin_flip announces the
+// starter in Player and reveals the nonce, which a client can check
+// against the commitment with protocol.VerifyCoinFlip. The flipped
+// starter becomes the game's FirstPlayer, and the starter policy takes
+// over from there for the rounds after.
+
+// newCoinNonce draws a coin, in hex.
+func newCoinNonce() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// coinPending is the commitment to announce, while the game still has a
+// coin to flip. Runs on the game's loop.
+func (game *Game) coinPending() string {
+	if !game.CoinFlip || game.CoinFlipped {
+		return ""
+	}
+	return protocol.CoinCommitment(game.coinNonce)
+}
+
+// flipCoin flips the game's coin, if it has one still to flip, and makes
+// the result round 1's starter. Runs on the game's loop, before the round
+// is announced.
+func (game *Game) flipCoin() {
+	commitment := game.coinPending()
+	if commitment == "" || game.Round != 1 || len(game.Moves) > 0 {
+		return
+	}
+	starter := protocol.CoinStarter(game.coinNonce, game.symbols())
+	game.CoinFlipped = true
+	game.FirstPlayer, game.StartingPlayerForRound, game.CurrentPlayer = starter, starter, starter
+	game.logger().Info("coin flipped", "starter", starter)
+	game.journal.state("coin_flip", starter)
+	broadcast(game, OutboundMessage{
+		Event:          protocol.EventCoinFlip,
+		Player:         starter,
+		Code:           "coin_flip",
+		CoinCommitment: commitment,
+		CoinNonce:      game.coinNonce,
+	})
+	game.persist()
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"time"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// --- Conceding ---
+
+// A player may give up the round in play instead of leaving the game. The
+// point goes to the opponent and the round ends as if it were won, so the
+// usual rematch_request starts the next one.
+
+// concedeError is the error code saying why p can't concede now, or "" if
+// it can. A second concede racing the first finds the round already over.
+// Runs on the game's loop.
+func (game *Game) concedeError(p *Player) string {
+	if game.ThreePlayer {
+		return "two_player_only"
+	}
+	switch game.roundStatus() {
+	case statusWaiting:
+		return "game_not_started"
+	case statusFinished:
+		return "round_over"
+	}
+	return ""
+}
+
+// handleConcede ends the round in the opponent's favour. Runs on the game's
+// loop.
+func (game *Game) handleConcede(p *Player) {
+	if code := game.concedeError(p); code != "" {
+		rejectMove(p, code)
+		return
+	}
+	p.logger().Info("round conceded", "round", game.Round)
+	winner := engine.Other(p.Symbol)
+	game.Conceded = p.Symbol
+	game.award(winner)
+	for _, pl := range game.Players {
+		pl.pending = nil // The round is over
+	}
+	game.Undo = nil
+	game.cancelReminder()
+	game.stopTurnTimer()
+	game.stopClock()
+	game.recordResult(winner)
+	broadcast(game, game.withRatingUpdate(OutboundMessage{
+		Event:  protocol.EventConcede,
+		Player: winner,
+		Board:  protocol.NewBoard(game.Board),
+		Score:  &game.Score,
+		From:   p.participant(),
+		Code:   "conceded",
+		Names:  game.playerNames(),
+
+		RoundStats: game.roundStats(),
+	}, winner))
+	game.stats.rounds++
+	game.checkSeries()
+	if game.Correspondence {
+		game.turnTaken(time.Now()) // Clears the deadline
+	} else {
+		game.persist()
+	}
+}
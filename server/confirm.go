@@ -0,0 +1,50 @@
+package server
+
+import (
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// --- Move Confirmation ---
+
+// With ?confirm_moves=1 a make_move only proposes the move. The mark is
+// shown to the mover alone until confirm_move commits it through makeMove;
+// the board, history and opponent know nothing of it before then. The
+// turn's clocks keep running meanwhile. A pending move lives on the
+// connection, so a disconnect discards it.
+
+// proposeMove holds player's move marking mark at row, col for
+// confirmation, replacing any move already pending. Invalid moves are
+// ignored, as in makeMove. Runs on the game's loop.
+func (game *Game) proposeMove(player *Player, mark string, row, col int) {
+	if !game.canMove(player.Symbol, row, col) {
+		return
+	}
+	player.pending, player.pendingMark = &engine.Cell{Row: row, Col: col}, mark
+	player.send(OutboundMessage{Event: protocol.EventMovePending, Row: &row, Col: &col, Symbol: mark})
+}
+
+// confirmMove commits player's pending move. One that is no longer legal,
+// say because the game paused, is discarded with move_cancelled. Runs
+// on the game's loop.
+func (game *Game) confirmMove(player *Player) {
+	cell := player.pending
+	if cell == nil {
+		return // Nothing to confirm
+	}
+	player.pending = nil
+	if !game.canMove(player.Symbol, cell.Row, cell.Col) {
+		player.send(localize(player.locale(), protocol.Notice(protocol.EventMoveCancelled, "move_cancelled")))
+		return
+	}
+	game.makeMove(player.Symbol, player.pendingMark, cell.Row, cell.Col)
+}
+
+// cancelMove discards player's pending move. Runs on the game's loop.
+func (game *Game) cancelMove(player *Player) {
+	if player.pending == nil {
+		return
+	}
+	player.pending = nil
+	player.send(localize(player.locale(), protocol.Notice(protocol.EventMoveCancelled, "move_cancelled")))
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// --- Correspondence Games ---
+
+// A correspondence game is played a move at a time over days. Players come
+// and go as they please: a seat stays reserved for its token after a
+// disconnect, and the game lives in the store so a restart doesn't lose it.
+// The player on turn forfeits once TurnDeadline passes. A player needn't
+// connect at all to move: POST /games/{game_id}/move with their seat token,
+// row and col, and in wild the mark, plays it as make_move would and
+// answers with the state GET /games/{game_id}/state serves. Whoever is
+// connected gets the move as usual; whoever isn't sees it on their next
+// poll or move. Like a websocket seat, the game is kept past cfg.GameTTL
+// for its turn window and never deleted for sitting empty.
+
+// durable reports whether the game is kept in the store between moves
+// rather than only snapshotted on shutdown. Runs on the game's loop.
+func (game *Game) durable() bool {
+	return game.Correspondence || game.scheduled()
+}
+
+// persist saves a durable game's current state. Runs on the game's
+// loop.
+func (game *Game) persist() {
+	if !game.durable() || game.closed {
+		return
+	}
+	st, log := game.exportState(), game.logger()
+	game.storeLater(func() {
+		if err := store.SaveSnapshot(st); err != nil {
+			log.Error("saving game", "err", err)
+		}
+	})
+}
+
+// canPlay reports whether moves may be made: every player connected, one
+// against the computer, or in a correspondence game, both seats taken
+// whether or not anyone is online. Runs on the game's loop.
+func (game *Game) canPlay() bool {
+	return len(game.Players) == game.seats() || (game.AI != "" && len(game.Players) == 1) || (game.Correspondence && len(game.openSeats()) == 0)
+}
+
+// keepSeat reserves a correspondence player's seat for their token until
+// the game ends, instead of holding it for cfg.ReconnectGrace. Runs on
+// the game's loop.
+func (game *Game) keepSeat(p *Player) {
+	game.Reserved[p.Symbol] = p.Token
+	if len(game.Players) == 0 {
+		game.markEmpty(time.Now())
+	}
+	game.persist()
+}
+
+// welcomeCorrespondence starts the game once both seats are first taken,
+// and otherwise brings a returning player up to date without disturbing
+// their opponent beyond an opponent_joined. Runs on the game's loop.
+func (game *Game) welcomeCorrespondence(p *Player) {
+	if len(game.openSeats()) > 0 {
+		return // Still waiting for the second player
+	}
+	if game.TurnDeadline.IsZero() && len(game.Moves) == 0 && game.Round == 1 {
+		game.beginRound(protocol.EventStartGame)
+		game.turnTaken(time.Now())
+		return
+	}
+	p.send(game.roundMessage(protocol.EventStartGame))
+	for _, other := range game.Players {
+		if other != p {
+			other.send(localize(other.locale(), OutboundMessage{Event: protocol.EventOpponentJoined, From: p.participant(), Code: "opponent_back"}))
+		}
+	}
+	game.remindTurn(p)
+}
+
+// turnTaken restarts the turn clock after the board changed: a fresh
+// TurnWindow for the player now on turn, or no clock once the round is
+// over. Runs on the game's loop.
+func (game *Game) turnTaken(now time.Time) {
+	game.TurnDeadline = time.Time{}
+	game.deadlineWarned = false
+	if !game.roundOver() {
+		game.TurnDeadline = now.Add(game.TurnWindow)
+	}
+	game.persist()
+}
+
+// remindTurn tells p it's their move and when it's due, if it is. Runs
+// on the game's loop.
+func (game *Game) remindTurn(p *Player) {
+	if p.Symbol != game.CurrentPlayer || game.TurnDeadline.IsZero() {
+		return
+	}
+	deadline := game.TurnDeadline.UTC()
+	p.send(localize(p.locale(), OutboundMessage{Event: protocol.EventTurnReminder, Player: p.Symbol, Deadline: &deadline, Code: "your_turn_reminder"}))
+}
+
+// checkTurnDeadline forfeits the game for the player on turn once their
+// deadline has passed, reporting whether it did. Short of that, it reminds
+// them once when a quarter of the window is left. Runs on the game's
+// loop.
+func (game *Game) checkTurnDeadline(now time.Time) bool {
+	if !game.Correspondence || game.TurnDeadline.IsZero() {
+		return false
+	}
+	if !now.Before(game.TurnDeadline) {
+		game.logger().Info("correspondence game forfeited, turn ran out", "loser", game.CurrentPlayer)
+		game.forfeit(engine.Other(game.CurrentPlayer), "turn_timeout_forfeit", endTimeout)
+		return true
+	}
+	if !game.deadlineWarned && !now.Before(game.TurnDeadline.Add(-game.TurnWindow/4)) {
+		game.deadlineWarned = true
+		for _, p := range game.Players {
+			game.remindTurn(p)
+		}
+	}
+	return false
+}
+
+type myGame struct {
+	GameID         string     `json:"game_id"`
+	Symbol         string     `json:"symbol"`
+	Correspondence bool       `json:"correspondence"`
+	YourTurn       bool       `json:"your_turn"`
+	TurnDeadline   *time.Time `json:"turn_deadline,omitempty"`
+	OpponentOnline bool       `json:"opponent_online"`
+	WSURL          string     `json:"ws_url"`
+}
+
+// listMyGames lists the tenant's live games holding a seat for the
+// caller's client ID, those where it is their move first, soonest deadline
+// first.
+func listMyGames(w http.ResponseWriter, r *http.Request) {
+	identity := requestIdentity(r)
+	if identity == "" {
+		writeError(w, r, http.StatusBadRequest, "identity_required")
+		return
+	}
+	out := []myGame{}
+	tenant := requestTenant(r)
+	for _, game := range liveGames() {
+		if game.Tenant != tenant {
+			continue
+		}
+		game.do(func() {
+			for symbol, owner := range game.SeatOwners {
+				if owner != identity {
+					continue
+				}
+				g := myGame{
+					GameID:         game.ID,
+					Symbol:         symbol,
+					Correspondence: game.Correspondence,
+					YourTurn:       game.CurrentPlayer == symbol && game.canPlay() && !game.roundOver() && !game.scheduled(),
+					WSURL:          cfg.BasePath + tenantPrefix(tenant) + "/ws/" + game.ID,
+				}
+				if g.YourTurn && !game.TurnDeadline.IsZero() {
+					deadline := game.TurnDeadline.UTC()
+					g.TurnDeadline = &deadline
+				}
+				for _, p := range game.Players {
+					g.OpponentOnline = g.OpponentOnline || p.Symbol != symbol
+				}
+				out = append(out, g)
+			}
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.YourTurn != b.YourTurn {
+			return a.YourTurn
+		}
+		if (a.TurnDeadline == nil) != (b.TurnDeadline == nil) {
+			return a.TurnDeadline != nil
+		}
+		if a.TurnDeadline != nil && !a.TurnDeadline.Equal(*b.TurnDeadline) {
+			return a.TurnDeadline.Before(*b.TurnDeadline)
+		}
+		return a.GameID < b.GameID
+	})
+	writeJSON(w, http.StatusOK, out)
+}
+
+type moveRequest struct {
+	Token string `json:"token"`
+	Row   *int   `json:"row"`
+	Col   *int   `json:"col"`
+	Mark  string `json:"mark,omitempty"` // Wild games only
+}
+
+// postMove plays a correspondence move sent over HTTP for the seat its
+// token is for.
+func postMove(w http.ResponseWriter, r *http.Request) {
+	var req moveRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxInboundSize)).Decode(&req); err != nil || req.Row == nil || req.Col == nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body")
+		return
+	}
+	gamesMutex.RLock()
+	game, exists := games[requestGameKey(r)]
+	gamesMutex.RUnlock()
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "game_not_found")
+		return
+	}
+
+	var view stateView
+	status, code := http.StatusConflict, ""
+	game.do(func() {
+		if !game.Correspondence {
+			code = "not_correspondence"
+			return
+		}
+		symbol, err := verifySeatToken(game, req.Token)
+		if err != nil {
+			status, code = http.StatusUnauthorized, err.Error()
+			return
+		}
+		mark := ""
+		code = "not_started_yet"
+		if !game.scheduled() {
+			mark, code = game.checkMove(symbol, req.Mark, *req.Row, *req.Col)
+		}
+		entry := journalEntry{Kind: journalInbound, What: string(protocol.EventMakeMove), Who: symbol, Detail: "ok over http"}
+		if code != "" {
+			entry.Detail = code + " over http"
+			game.journal.add(entry)
+			metrics.MovesRejected.Add(1)
+			return
+		}
+		game.journal.add(entry)
+		game.touch()
+		game.makeMove(symbol, mark, *req.Row, *req.Col)
+		game.turnTaken(time.Now())
+		view = game.stateView()
+	})
+	if code != "" {
+		writeError(w, r, status, code)
+		return
+	}
+	writeJSON(w, http.StatusOK, view)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"time"
+
+	"tictactoe/protocol"
+)
+
+// --- Start Countdown ---
+
+// A fresh round doesn't start the moment the last seat fills or the
+// rematch is agreed: game_starting goes out first with starts_at, the
+// server time cfg.StartCountdown from now, and start_game or new_game
+// follows at that time, so that every client has drawn the board before
+// the starter can move. Until then a make_move is refused with too_early
+// and the round counts as waiting. A player leaving calls it off; the
+// countdown starts over when the seat is filled again. Games against the
+// computer, correspondence games and rounds restored part-played start at
+// once, as does everything with -start-countdown=0. It runs on game.clock.
+
+// starting reports whether a countdown is running. Runs on the game's
+// loop.
+func (game *Game) starting() bool {
+	return !game.StartingAt.IsZero()
+}
+
+// countDown starts the countdown to the round event announces, unless the
+// round should start at once. It reports whether the round is being held
+// back, including by a countdown already running. Runs on the game's
+// loop.
+func (game *Game) countDown(event protocol.Event) bool {
+	if game.starting() {
+		return true
+	}
+	if cfg.StartCountdown <= 0 || game.AI != "" || game.Correspondence || len(game.Moves) > 0 || game.roundOver() {
+		return false
+	}
+	startsAt := game.clock.Now().Add(cfg.StartCountdown).UTC()
+	game.StartingAt = startsAt
+	broadcast(game, OutboundMessage{Event: protocol.EventGameStarting, StartsAt: &startsAt, Code: "game_starting"})
+	gen := game.countdownGen
+	game.countdownTimer = game.clock.AfterFunc(cfg.StartCountdown, func() {
+		game.do(func() {
+			if game.countdownGen != gen || game.closed {
+				return
+			}
+			game.countdownTimer = nil
+			game.journal.timer("start_countdown")
+			game.StartingAt = time.Time{}
+			game.openRound(event)
+		})
+	})
+	return true
+}
+
+// cancelCountdown calls off a running countdown, including one whose timer
+// already fired and is waiting its turn on the loop. Runs on the game's loop.
+func (game *Game) cancelCountdown() {
+	if game.countdownTimer != nil {
+		game.countdownTimer.Stop()
+		game.countdownTimer = nil
+	}
+	game.countdownGen++
+	game.StartingAt = time.Time{}
+}
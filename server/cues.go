@@ -0,0 +1,64 @@
+package server
+
+import (
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// --- UI Cues ---
+
+// A frontend that plays a sound or an animation per event shouldn't have
+// to diff boards to find out what happened, which goes wrong after a
+// missed message. So move, win and draw say in last_move which cell was
+// just played, by whom and as which move of the round; win says in
+// win_type which way its line runs; and every event that ends a round
+// carries its round_stats, the summary also kept in rounds. state_sync
+// repeats whichever of them still hold, so a client that resyncs mid-round
+// or between rounds can show the same cue.
+
+// lastMove is the round's latest mark, or nil before the first. Runs
+// on the game's loop.
+func (game *Game) lastMove() *protocol.LastMove {
+	for i := len(game.Moves) - 1; i >= 0; i-- {
+		if mv := game.Moves[i]; !mv.Skipped {
+			return &protocol.LastMove{Row: mv.Row, Col: mv.Col, Player: mv.Player, MoveNumber: i + 1}
+		}
+	}
+	return nil
+}
+
+// roundStats is the summary of the round just ended, or nil while it is
+// still being played. recordResult must have counted it. Runs on the game's
+// loop.
+func (game *Game) roundStats() *protocol.RoundSummary {
+	if !game.roundOver() || len(game.RoundResults) == 0 {
+		return nil
+	}
+	s := game.RoundResults[len(game.RoundResults)-1]
+	if s.Round != game.Round {
+		return nil
+	}
+	return &s
+}
+
+// winCues fills in msg's win, winning_line and win_type for win, completed
+// by the move at last. Runs on the game's loop.
+func (game *Game) winCues(msg *OutboundMessage, win engine.Win, last engine.Cell) {
+	msg.Win = winMessage(win)
+	msg.WinningLine = game.winningLines(win, last)
+	msg.WinType = engine.LineKind(win.Cells)
+}
+
+// syncCues adds the cues that still hold to a state_sync. A round won on
+// the board gets its win again. Runs on the game's loop.
+func (game *Game) syncCues(msg *OutboundMessage) {
+	msg.LastMove = game.lastMove()
+	msg.RoundStats = game.roundStats()
+	last := game.lastMark()
+	if msg.RoundStats == nil || last == nil || game.TimeoutWinner != "" || game.Conceded != "" || game.Adjudicated != "" {
+		return
+	}
+	if win, ok := engine.FindWin(game.Board, *last, game.WinConditions); ok {
+		game.winCues(msg, win, *last)
+	}
+}
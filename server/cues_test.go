@@ -0,0 +1,156 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+	"tictactoe/replay"
+)
+
+// cueGame is a game in round 1 with moves played on its board.
+func cueGame(moves ...replay.Move) *Game {
+	game := newGame(unusedGameID())
+	for _, mv := range moves {
+		if !mv.Skipped {
+			game.Board[mv.Row][mv.Col] = mv.Player
+		}
+	}
+	game.Moves = moves
+	return game
+}
+
+func markAt(player string, row, col int) replay.Move {
+	return replay.Move{Player: player, Row: row, Col: col}
+}
+
+func skippedTurn(player string) replay.Move {
+	return replay.Move{Player: player, Skipped: true}
+}
+
+func TestLastMove(t *testing.T) {
+	tests := []struct {
+		name  string
+		moves []replay.Move
+		want  *protocol.LastMove
+	}{
+		{"no moves", nil, nil},
+		{"only a skipped turn", []replay.Move{skippedTurn("X")}, nil},
+		{"one mark", []replay.Move{markAt("X", 1, 1)}, &protocol.LastMove{Row: 1, Col: 1, Player: "X", MoveNumber: 1}},
+		{"after a skipped turn", []replay.Move{markAt("X", 0, 0), skippedTurn("O"), markAt("X", 2, 2)}, &protocol.LastMove{Row: 2, Col: 2, Player: "X", MoveNumber: 3}},
+		{"before a skipped turn", []replay.Move{markAt("X", 0, 0), markAt("O", 0, 1), skippedTurn("X")}, &protocol.LastMove{Row: 0, Col: 1, Player: "O", MoveNumber: 2}},
+	}
+	for _, tt := range tests {
+		if got := cueGame(tt.moves...).lastMove(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: lastMove = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// xWinsTopRow has X complete the top row.
+var xWinsTopRow = []replay.Move{markAt("X", 0, 0), markAt("O", 1, 0), markAt("X", 0, 1), markAt("O", 1, 1), markAt("X", 0, 2)}
+
+func TestRoundStats(t *testing.T) {
+	summary := protocol.RoundSummary{Round: 1, Result: "X", DurationMS: 9000, Moves: 5}
+
+	game := cueGame(xWinsTopRow[:4]...)
+	game.RoundResults = []protocol.RoundSummary{summary}
+	if got := game.roundStats(); got != nil {
+		t.Errorf("mid-round: roundStats = %+v, want nil", got)
+	}
+
+	game = cueGame(xWinsTopRow...)
+	if got := game.roundStats(); got != nil {
+		t.Errorf("over but not yet counted: roundStats = %+v, want nil", got)
+	}
+	game.RoundResults = []protocol.RoundSummary{{Round: 1, Result: "O"}, summary}
+	if got := game.roundStats(); got == nil || *got != summary {
+		t.Errorf("roundStats = %+v, want the latest summary %+v", got, summary)
+	}
+
+	// A summary from another round isn't this one's
+	game.Round = 2
+	if got := game.roundStats(); got != nil {
+		t.Errorf("round 1's summary in round 2: roundStats = %+v, want nil", got)
+	}
+}
+
+func TestWinCues(t *testing.T) {
+	tests := []struct {
+		name  string
+		cells []engine.Cell
+		kind  string
+	}{
+		{"row", []engine.Cell{{Row: 2, Col: 0}, {Row: 2, Col: 1}, {Row: 2, Col: 2}}, engine.LineRow},
+		{"column", []engine.Cell{{Row: 0, Col: 1}, {Row: 1, Col: 1}, {Row: 2, Col: 1}}, engine.LineCol},
+		{"diagonal", []engine.Cell{{Row: 0, Col: 0}, {Row: 1, Col: 1}, {Row: 2, Col: 2}}, engine.LineDiag},
+		{"anti-diagonal", []engine.Cell{{Row: 0, Col: 2}, {Row: 1, Col: 1}, {Row: 2, Col: 0}}, engine.LineAntiDiag},
+	}
+	for _, tt := range tests {
+		game := newGame(unusedGameID())
+		for _, c := range tt.cells {
+			game.Board[c.Row][c.Col] = "X"
+		}
+		last := tt.cells[len(tt.cells)-1]
+		win, ok := engine.FindWin(game.Board, last, nil)
+		if !ok {
+			t.Fatalf("%s: no win found", tt.name)
+		}
+		var msg OutboundMessage
+		game.winCues(&msg, win, last)
+		if !reflect.DeepEqual(msg.Win, winMessage(win)) {
+			t.Errorf("%s: win = %+v, want %+v", tt.name, msg.Win, winMessage(win))
+		}
+		if want := [][][2]int{cellPairs(tt.cells)}; !reflect.DeepEqual(msg.WinningLine, want) {
+			t.Errorf("%s: winning_line = %v, want %v", tt.name, msg.WinningLine, want)
+		}
+		if msg.WinType != tt.kind {
+			t.Errorf("%s: win_type = %q, want %q", tt.name, msg.WinType, tt.kind)
+		}
+	}
+}
+
+func TestSyncCues(t *testing.T) {
+	summary := protocol.RoundSummary{Round: 1, Result: "X", Moves: 5}
+	over := func() *Game {
+		game := cueGame(xWinsTopRow...)
+		game.RoundResults = []protocol.RoundSummary{summary}
+		return game
+	}
+
+	var msg OutboundMessage
+	over().syncCues(&msg)
+	if msg.LastMove == nil || msg.LastMove.MoveNumber != 5 || msg.RoundStats == nil || *msg.RoundStats != summary {
+		t.Errorf("won on the board: last_move %+v, round_stats %+v", msg.LastMove, msg.RoundStats)
+	}
+	if msg.Win == nil || msg.WinType != engine.LineRow || len(msg.WinningLine) != 1 {
+		t.Errorf("won on the board: win %+v, win_type %q, winning_line %v; want the top row", msg.Win, msg.WinType, msg.WinningLine)
+	}
+
+	// Mid-round there is only the last move
+	msg = OutboundMessage{}
+	cueGame(xWinsTopRow[:4]...).syncCues(&msg)
+	if msg.LastMove == nil || msg.RoundStats != nil || msg.Win != nil || msg.WinType != "" {
+		t.Errorf("mid-round: %+v", msg)
+	}
+
+	// A round decided off the board gets no win cues even with a line on it
+	ended := map[string]func(*Game){
+		"timeout":     func(g *Game) { g.TimeoutWinner = "X" },
+		"concession":  func(g *Game) { g.Conceded = "O" },
+		"adjudicated": func(g *Game) { g.Adjudicated = "X" },
+	}
+	for name, end := range ended {
+		game := over()
+		end(game)
+		msg := OutboundMessage{}
+		game.syncCues(&msg)
+		if msg.RoundStats == nil || msg.LastMove == nil {
+			t.Errorf("%s: round_stats %+v, last_move %+v; want both", name, msg.RoundStats, msg.LastMove)
+		}
+		if msg.Win != nil || msg.WinningLine != nil || msg.WinType != "" {
+			t.Errorf("%s: win cues %+v %v %q, want none", name, msg.Win, msg.WinningLine, msg.WinType)
+		}
+	}
+}
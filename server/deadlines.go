@@ -0,0 +1,199 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// --- Round and Series Deadlines ---
+
+// For tournament play a game can be created with round_deadline, the most
+// a whole round may take, and with best_of, series_deadline, the most the
+// series may. Each clock starts when its round, or the series' first
+// round, opens, is announced as round_deadline and series_deadline on
+// start_game and new_game, and comes with the time left on state_sync.
+// When a round's time is up it is decided where it stands, by
+// engine.Adjudicate: whoever has more lines still open wins it, and
+// otherwise it is drawn. round_adjudicated says which, with Code the
+// reason, and the round then counts like any other. When the series' time
+// is up the score decides it: series_adjudicated names the leader, or no
+// one if level, and play waits on new_series as after series_over. The
+// clocks keep running while a player is away. Both run on game.clock.
+
+// deadlineRules are the round and series limits req asks for.
+func deadlineRules(req createGameRequest) (round, series time.Duration, err error) {
+	switch {
+	case req.RoundDeadline < 0 || req.SeriesDeadline < 0:
+		return 0, 0, fmt.Errorf("round_deadline and series_deadline can't be negative")
+	case (req.RoundDeadline > 0 || req.SeriesDeadline > 0) && req.Correspondence:
+		return 0, 0, fmt.Errorf("a correspondence game can't have deadlines")
+	case req.SeriesDeadline > 0 && req.BestOf == 0:
+		return 0, 0, fmt.Errorf("series_deadline needs best_of")
+	}
+	return time.Duration(req.RoundDeadline) * time.Second, time.Duration(req.SeriesDeadline) * time.Second, nil
+}
+
+// startDeadlines sets the deadlines of a round that is opening, unless
+// they are already running. Runs on the game's loop.
+func (game *Game) startDeadlines() {
+	now := game.clock.Now()
+	if game.RoundTimeLimit > 0 && game.RoundDeadline.IsZero() {
+		game.RoundDeadline = now.Add(game.RoundTimeLimit).UTC()
+	}
+	if game.SeriesTimeLimit > 0 && game.SeriesDeadline.IsZero() {
+		game.SeriesDeadline = now.Add(game.SeriesTimeLimit).UTC()
+	}
+	game.armDeadlines()
+}
+
+// armDeadlines (re)starts the timers for the deadlines set, firing at once
+// for any already past, as after a restart. Runs on the game's loop.
+func (game *Game) armDeadlines() {
+	game.stopDeadlines()
+	gen := game.deadlineGen
+	arm := func(at time.Time, name string, expire func()) clockTimer {
+		if at.IsZero() {
+			return nil
+		}
+		return game.clock.AfterFunc(max(at.Sub(game.clock.Now()), 0), func() {
+			game.do(func() {
+				if game.deadlineGen != gen || game.closed {
+					return
+				}
+				game.journal.timer(name)
+				expire()
+			})
+		})
+	}
+	game.roundDeadlineTimer = arm(game.RoundDeadline, "round_deadline", game.adjudicateRound)
+	game.seriesDeadlineTimer = arm(game.SeriesDeadline, "series_deadline", game.adjudicateSeries)
+}
+
+// stopDeadlines cancels both timers, including any that already fired and
+// are waiting their turn on the loop. The deadlines themselves stay. Runs
+// on the game's loop.
+func (game *Game) stopDeadlines() {
+	for _, t := range []clockTimer{game.roundDeadlineTimer, game.seriesDeadlineTimer} {
+		if t != nil {
+			t.Stop()
+		}
+	}
+	game.roundDeadlineTimer, game.seriesDeadlineTimer = nil, nil
+	game.deadlineGen++
+}
+
+// clearRoundDeadline forgets the round's deadline for the next round. The
+// series timer carries on. Runs on the game's loop.
+func (game *Game) clearRoundDeadline() {
+	game.RoundDeadline = time.Time{}
+	game.Adjudicated = ""
+	game.armDeadlines()
+}
+
+// clearSeriesDeadline forgets the series' deadline for the next series.
+// Runs on the game's loop.
+func (game *Game) clearSeriesDeadline() {
+	game.SeriesDeadline = time.Time{}
+	game.SeriesAdjudicated = ""
+	game.armDeadlines()
+}
+
+// deadlines fills in msg's deadlines, and with remaining the time left on
+// each. Runs on the game's loop.
+func (game *Game) deadlines(msg *OutboundMessage, remaining bool) {
+	now := game.clock.Now()
+	if !game.RoundDeadline.IsZero() && !game.roundOver() {
+		at := game.RoundDeadline
+		msg.RoundDeadline = &at
+		if remaining {
+			msg.RoundRemainingMS = max(at.Sub(now), 0).Milliseconds()
+		}
+	}
+	if !game.SeriesDeadline.IsZero() && !game.seriesOver() {
+		at := game.SeriesDeadline
+		msg.SeriesDeadline = &at
+		if remaining {
+			msg.SeriesRemainingMS = max(at.Sub(now), 0).Milliseconds()
+		}
+	}
+}
+
+// adjudicateRound decides the round whose time ran out, if it is still
+// open. Runs on the game's loop.
+func (game *Game) adjudicateRound() {
+	game.roundDeadlineTimer = nil
+	if game.roundOver() || game.seriesOver() {
+		return
+	}
+	winner := engine.Adjudicate(game.Board, game.winLength(), game.WinConditions)
+	code := "round_adjudicated_win"
+	if winner == "" {
+		code = "round_adjudicated_draw"
+		game.Adjudicated = "draw"
+	} else {
+		game.Adjudicated = winner
+	}
+	game.award(winner)
+	for _, p := range game.Players {
+		p.pending = nil // Too late to confirm
+	}
+	game.logger().Info("round deadline passed, round adjudicated", "round", game.Round, "winner", winner)
+	game.cancelReminder()
+	game.stopTurnTimer()
+	game.stopClock()
+	game.recordResult(winner)
+	broadcast(game, game.withRatingUpdate(OutboundMessage{
+		Event:  protocol.EventRoundAdjudicated,
+		Player: winner,
+		Board:  protocol.NewBoard(game.Board),
+		Score:  &game.Score,
+		Code:   code,
+		Names:  game.playerNames(),
+		Rounds: game.recentRounds(),
+
+		RoundStats: game.roundStats(),
+	}, winner))
+	game.stats.rounds++
+	game.checkSeries()
+}
+
+// adjudicateSeries decides the series whose time ran out on the score, if
+// it is still undecided. A round in play stops where it is, unfinished and
+// uncounted. Runs on the game's loop.
+func (game *Game) adjudicateSeries() {
+	game.seriesDeadlineTimer = nil
+	if game.seriesOver() {
+		return
+	}
+	wins := make(map[string]int)
+	for _, symbol := range game.symbols() {
+		wins[symbol] = game.Score.Of(symbol)
+	}
+	winner := engine.Leader(wins)
+	code := "series_adjudicated_win"
+	game.SeriesAdjudicated = winner
+	if winner == "" {
+		code = "series_adjudicated_draw"
+		game.SeriesAdjudicated = "draw"
+	}
+	game.logger().Info("series deadline passed, series adjudicated", "winner", winner, "score_x", game.Score.X, "score_o", game.Score.O)
+	game.journal.state("series_over", game.SeriesAdjudicated)
+	for _, p := range game.Players {
+		p.pending = nil
+	}
+	game.cancelReminder()
+	game.stopTurnTimer()
+	game.stopClock()
+	game.RematchRequests = make(map[string]bool)
+	broadcast(game, OutboundMessage{
+		Event:  protocol.EventSeriesAdjudicated,
+		Player: winner,
+		Score:  &game.Score,
+		BestOf: game.bestOf(),
+		Code:   code,
+		Names:  game.playerNames(),
+	})
+}
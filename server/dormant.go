@@ -0,0 +1,49 @@
+package server
+
+import "time"
+
+// --- Dormant Games ---
+
+// A game isn't deleted the moment its last player leaves, since both
+// players dropping at once is usually one bad network rather than the end
+// of the match. It goes dormant instead: EmptySince marks when, it drops
+// out of the lobby, and every seat still held for a departed player is
+// kept for them until cfg.EmptyRetention has passed. Whoever comes back
+// with their token in that window gets their seat, board and score back,
+// and the game is active again. After it, the sweeper deletes the game. A
+// player who was kicked doesn't get a seat held. xo_dormant_games counts
+// the games waiting this way.
+
+// goDormant tombstones the game p just left as its last player, holding
+// the seats of everyone who left until the retention window closes.
+// Runs on the game's loop.
+func (game *Game) goDormant(p *Player) {
+	now := time.Now()
+	game.markEmpty(now)
+	until := now.Add(cfg.EmptyRetention)
+	if !p.kicked {
+		game.holdSeatUntil(p.Symbol, p.Token, p.Identity, until)
+	}
+	for symbol, held := range game.HeldUntil {
+		if held.Before(until) {
+			game.holdSeatUntil(symbol, game.Reserved[symbol], game.SeatOwners[symbol], until)
+		}
+	}
+}
+
+// markEmpty records that the last player left at now. Runs on the game's
+// loop.
+func (game *Game) markEmpty(now time.Time) {
+	if game.EmptySince.IsZero() {
+		metrics.DormantGames.Add(1)
+	}
+	game.EmptySince = now
+}
+
+// markOccupied records that a player is back. Runs on the game's loop.
+func (game *Game) markOccupied() {
+	if !game.EmptySince.IsZero() {
+		metrics.DormantGames.Add(-1)
+		game.EmptySince = time.Time{}
+	}
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Engagement Analytics ---
+
+// How a match ended, for Engagement.Ended.
+const (
+	endLeft    = "left"    // Everyone left and the game was deleted
+	endExpired = "expired" // Idle past -game-ttl
+	endAborted = "aborted" // Players agreed to abort
+	endNoShow  = "no_show" // A scheduled game's player never arrived
+	endTimeout = "timeout" // A correspondence player let their turn run out
+	endClosed  = "closed"  // An admin tore the game down
+)
+
+const engagementRollupInterval = 5 * time.Minute
+
+// Engagement counts finished matches: games that reached start_game, tallied
+// when the game is deleted. It counts daily puzzles played to the end too,
+// on the day they were played.
+type Engagement struct {
+	Matches           int            `json:"matches"`
+	Rounds            int            `json:"rounds"` // Rounds completed across those matches
+	RematchOffers     int            `json:"rematch_offers"`
+	RematchesAccepted int            `json:"rematches_accepted"`
+	Ended             map[string]int `json:"ended"` // Matches by how they ended
+	PuzzlesSolved     int            `json:"puzzles_solved"`
+	PuzzlesFailed     int            `json:"puzzles_failed"`
+}
+
+func (e *Engagement) add(o Engagement) {
+	e.Matches += o.Matches
+	e.Rounds += o.Rounds
+	e.RematchOffers += o.RematchOffers
+	e.RematchesAccepted += o.RematchesAccepted
+	e.PuzzlesSolved += o.PuzzlesSolved
+	e.PuzzlesFailed += o.PuzzlesFailed
+	if e.Ended == nil {
+		e.Ended = make(map[string]int)
+	}
+	for reason, n := range o.Ended {
+		e.Ended[reason] += n
+	}
+}
+
+// EngagementDay is one instance's running totals for a UTC day and tenant.
+// Each instance upserts only its own row, so repeated rollups and several
+// instances sharing a store never double count.
+type EngagementDay struct {
+	Day      string `json:"day"` // YYYY-MM-DD, UTC
+	Tenant   string `json:"tenant"`
+	Instance string `json:"instance"`
+	Engagement
+}
+
+// matchStats are a game's counters, kept until the game is deleted.
+type matchStats struct {
+	started           bool
+	rounds            int
+	rematchOffers     int
+	rematchesAccepted int
+}
+
+var (
+	engagementMu sync.Mutex
+	engagement   = make(map[[2]string]*Engagement) // This instance's totals by (day, tenant)
+	instanceID   = newID()[:12]
+)
+
+// recordMatchEnd tallies a deleted game. Runs on the game's loop.
+func recordMatchEnd(game *Game, reason string, now time.Time) {
+	st := game.stats
+	if !st.started {
+		return
+	}
+	key := [2]string{now.UTC().Format("2006-01-02"), game.Tenant}
+	engagementMu.Lock()
+	defer engagementMu.Unlock()
+	e := engagement[key]
+	if e == nil {
+		e = &Engagement{}
+		engagement[key] = e
+	}
+	e.add(Engagement{
+		Matches:           1,
+		Rounds:            st.rounds,
+		RematchOffers:     st.rematchOffers,
+		RematchesAccepted: st.rematchesAccepted,
+		Ended:             map[string]int{reason: 1},
+	})
+}
+
+// recordPuzzle tallies a daily puzzle solved, or failed, for tenant.
+func recordPuzzle(tenant string, solved bool, now time.Time) {
+	key := [2]string{now.UTC().Format("2006-01-02"), tenant}
+	engagementMu.Lock()
+	defer engagementMu.Unlock()
+	e := engagement[key]
+	if e == nil {
+		e = &Engagement{}
+		engagement[key] = e
+	}
+	if solved {
+		e.PuzzlesSolved++
+	} else {
+		e.PuzzlesFailed++
+	}
+}
+
+// rollupEngagement writes this instance's totals to the store, dropping
+// days that are already written and over.
+func rollupEngagement(now time.Time) {
+	today := now.UTC().Format("2006-01-02")
+	engagementMu.Lock()
+	rows := make([]EngagementDay, 0, len(engagement))
+	for key, e := range engagement {
+		row := EngagementDay{Day: key[0], Tenant: key[1], Instance: instanceID}
+		row.add(*e)
+		rows = append(rows, row)
+	}
+	engagementMu.Unlock()
+
+	for _, row := range rows {
+		if err := store.SaveEngagement(row); err != nil {
+			slog.Error("saving engagement", "day", row.Day, "err", err)
+			continue
+		}
+		if row.Day < today {
+			engagementMu.Lock()
+			delete(engagement, [2]string{row.Day, row.Tenant})
+			engagementMu.Unlock()
+		}
+	}
+}
+
+func runEngagementRollup() {
+	go func() {
+		for now := range time.Tick(engagementRollupInterval) {
+			rollupEngagement(now)
+		}
+	}()
+}
+
+type engagementSummary struct {
+	Engagement
+	RoundsPerMatch    float64 `json:"rounds_per_match"`
+	RematchAcceptance float64 `json:"rematch_acceptance"` // Accepted rematches per offer
+}
+
+func summarize(e Engagement) engagementSummary {
+	s := engagementSummary{Engagement: e}
+	if e.Ended == nil {
+		s.Ended = map[string]int{}
+	}
+	if e.Matches > 0 {
+		s.RoundsPerMatch = float64(e.Rounds) / float64(e.Matches)
+	}
+	if e.RematchOffers > 0 {
+		s.RematchAcceptance = float64(e.RematchesAccepted) / float64(e.RematchOffers)
+	}
+	return s
+}
+
+type engagementDaySummary struct {
+	Day string `json:"day"`
+	engagementSummary
+}
+
+// parseWindow reads a window such as "30d", or any Go duration of at least
+// a day, as a whole number of days.
+func parseWindow(v string) (int, error) {
+	if v == "" {
+		return 30, nil
+	}
+	if n, err := strconv.Atoi(strings.TrimSuffix(v, "d")); err == nil && strings.HasSuffix(v, "d") && n > 0 {
+		return n, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 24*time.Hour {
+		return int(d / (24 * time.Hour)), nil
+	}
+	return 0, fmt.Errorf("window must be a number of days such as 30d")
+}
+
+// getEngagement serves GET /stats/engagement?window=30d: the tenant's
+// finished matches per UTC day, summed over every instance, and in total.
+func getEngagement(w http.ResponseWriter, r *http.Request) {
+	days, err := parseWindow(r.URL.Query().Get("window"))
+	if err != nil || days > 366 {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_window", "window must be between 1d and 366d")
+		return
+	}
+	now := time.Now()
+	rollupEngagement(now)
+	since := now.UTC().AddDate(0, 0, -(days - 1)).Format("2006-01-02")
+	rows, err := store.ListEngagement(since)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+
+	tenant := requestTenant(r)
+	byDay := make(map[string]*Engagement)
+	var total Engagement
+	for _, row := range rows {
+		if row.Tenant != tenant {
+			continue
+		}
+		if byDay[row.Day] == nil {
+			byDay[row.Day] = &Engagement{}
+		}
+		byDay[row.Day].add(row.Engagement)
+		total.add(row.Engagement)
+	}
+	out := struct {
+		WindowDays int                    `json:"window_days"`
+		Total      engagementSummary      `json:"total"`
+		Days       []engagementDaySummary `json:"days"`
+	}{WindowDays: days, Total: summarize(total), Days: []engagementDaySummary{}}
+	for day, e := range byDay {
+		out.Days = append(out.Days, engagementDaySummary{Day: day, engagementSummary: summarize(*e)})
+	}
+	sort.Slice(out.Days, func(i, j int) bool { return out.Days[i].Day < out.Days[j].Day })
+	writeJSON(w, http.StatusOK, out)
+}
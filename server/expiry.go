@@ -0,0 +1,135 @@
+package server
+
+import (
+	"time"
+
+	"tictactoe/protocol"
+)
+
+// --- Game Expiry ---
+
+// expiryWarnings are the lead times, most distant first, at which players
+// get a game_expiring event. A warning is skipped when the TTL itself is no
+// longer than its lead, so short-lived games expire quietly.
+var expiryWarnings = []time.Duration{24 * time.Hour, time.Hour}
+
+const sweepInterval = time.Minute
+
+// touch records activity, pushing back expiry and re-arming the warnings.
+// A scheduled game lasts at least cfg.GameTTL past its start, and a
+// correspondence game gets its turn window on top. Runs on the game's
+// loop.
+func (game *Game) touch() {
+	game.LastActivity = time.Now()
+	game.ExpiresAt = game.LastActivity.Add(cfg.GameTTL)
+	if game.Correspondence {
+		game.ExpiresAt = game.ExpiresAt.Add(game.TurnWindow)
+	}
+	if game.scheduled() && game.ExpiresAt.Before(game.StartsAt.Add(cfg.GameTTL)) {
+		game.ExpiresAt = game.StartsAt.Add(cfg.GameTTL)
+	}
+	game.WarningsSent = 0
+}
+
+// removeGame drops the game from the registry, ends any watch streams and
+// tallies the match as ended for reason. Runs on the game's loop, and so
+// without gamesMutex held.
+func removeGame(game *Game, reason string) {
+	gamesMutex.Lock()
+	if games[game.key()] == game {
+		delete(games, game.key())
+		metrics.Games.Add(-1)
+		if !game.EmptySince.IsZero() {
+			metrics.DormantGames.Add(-1)
+		}
+	}
+	gamesMutex.Unlock()
+	if cluster != nil {
+		go cluster.release(game.key())
+	}
+	game.closed = true
+	game.stopLoop()
+	game.journal.state("game_deleted", reason)
+	if reason == endClosed {
+		game.logger().Warn("game deleted", "reason", reason, "journal", game.journal.logTail())
+	} else {
+		game.logger().Info("game deleted", "reason", reason)
+	}
+	if game.durable() {
+		game.stopSchedule()
+		key, log := game.key(), game.logger()
+		game.storeLater(func() {
+			if err := store.DeleteSnapshot(key.Tenant, key.ID); err != nil {
+				log.Error("deleting game snapshot", "err", err)
+			}
+		})
+	}
+	for symbol := range game.Reserved {
+		game.releaseSeat(symbol)
+	}
+	recordMatchEnd(game, reason, time.Now())
+	notifyResult(game, reason, time.Now())
+	for w := range game.Watchers {
+		game.unwatch(w)
+	}
+	game.lobbyChanged()
+}
+
+// sweep deletes games left empty past cfg.EmptyRetention, expires idle
+// games, forfeits correspondence turns that ran out and sends any warnings
+// that have come due. It is the only place games are deleted for lack of
+// players; a correspondence game is expected to sit empty.
+func sweep(now time.Time) {
+	for _, game := range liveGames() {
+		game.do(func() {
+			if game.checkTurnDeadline(now) {
+				return
+			}
+			if len(game.Players) == 0 && !game.durable() && !game.EmptySince.IsZero() && now.Sub(game.EmptySince) >= cfg.EmptyRetention {
+				game.logger().Info("game empty past retention", "retention", cfg.EmptyRetention)
+				removeGame(game, endLeft)
+				for _, s := range game.Spectators {
+					s.closeAfterFlush(protocol.CloseGameEnded, "game deleted")
+				}
+				return
+			}
+			if !now.Before(game.ExpiresAt) {
+				game.logger().Info("game expired", "ttl", cfg.GameTTL)
+				for _, p := range game.connections() {
+					p.send(localize(p.locale(), protocol.Notice(protocol.EventGameExpired, "game_expired")))
+					p.closeAfterFlush(protocol.CloseGameEnded, "game expired")
+				}
+				removeGame(game, endExpired)
+				return
+			}
+
+			// Only the most urgent due warning is sent, so a sweep that finds
+			// both due doesn't announce 24h and 1h at once.
+			due := -1
+			for i, lead := range expiryWarnings {
+				if lead < cfg.GameTTL && !now.Before(game.ExpiresAt.Add(-lead)) {
+					due = i
+				}
+			}
+			if due >= game.WarningsSent {
+				expiresAt := game.ExpiresAt.UTC()
+				broadcast(game, OutboundMessage{Event: protocol.EventGameExpiring, ExpiresAt: &expiresAt, Code: "game_expiring"})
+				game.WarningsSent = due + 1
+			}
+		})
+	}
+}
+
+func runSweeper() {
+	go func() {
+		for now := range time.Tick(sweepInterval) {
+			sweep(now)
+			pruneIPs(now)
+			for _, l := range []*windowLimiter{chatLimiter, emoteLimiter, passwordLimiter, reportLimiter} {
+				l.Prune(now)
+			}
+			evictBans(now)
+			challenges.Sweep(now)
+		}
+	}()
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+	"tictactoe/replay"
+)
+
+// --- Result Export ---
+
+// GET /games/{game_id}/export shares one finished round: as JSON with its
+// moves, final board and winning pattern (format=json, the default), as an
+// ASCII board with the winning cells bracketed (format=txt), or as a PNG
+// image with them highlighted (format=png). It takes the latest finished
+// round of a live game, or of a game's stored record once it is over;
+// ?round=N picks another of the recorded rounds. A round still in play
+// isn't finished, so it can't be exported.
+
+// exportPixels is roughly the width of an exported PNG; boards larger than
+// 6×6 get smaller cells to fit.
+const exportPixels = 480
+
+type exportRound struct {
+	GameID string `json:"game_id"`
+	replayRound
+	Size  int           `json:"size"`
+	Board engine.Board  `json:"board"`
+	Win   *protocol.Win `json:"win,omitempty"`
+}
+
+// exportResult serves the export.
+func exportResult(w http.ResponseWriter, r *http.Request) {
+	key := requestGameKey(r)
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = "json"
+	case "json", "txt", "png":
+	default:
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_format", "format is json, txt or png")
+		return
+	}
+	g, ok := loadRecordedGame(w, r, key)
+	if !ok {
+		return
+	}
+	n := -1
+	if v := r.URL.Query().Get("round"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < g.first || i >= g.first+len(g.rounds) || g.rounds[i-g.first].Result == "" {
+			writeErrorDetail(w, r, http.StatusNotFound, "round_not_found", "no finished round "+v)
+			return
+		}
+		n = i
+	} else {
+		for i := len(g.rounds) - 1; i >= 0; i-- {
+			if g.rounds[i].Result != "" {
+				n = g.first + i
+				break
+			}
+		}
+	}
+	if n < 0 {
+		writeErrorDetail(w, r, http.StatusNotFound, "round_not_found", "no round has finished yet")
+		return
+	}
+	round := g.rounds[n-g.first]
+	m, err := replay.Start(round, g.size, g.players, g.wins)
+	if err == nil {
+		for _, mv := range round.Moves {
+			if _, err = replay.Apply(m, mv); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		writeErrorDetail(w, r, http.StatusUnprocessableEntity, "invalid_state", err.Error())
+		return
+	}
+	out := exportRound{GameID: key.ID, replayRound: newReplayRound(n, round), Size: g.size, Board: m.Board}
+	if end, ok := replayResult(round, m.Board, g.wins); ok {
+		out.Win = end.Win
+	}
+
+	switch format {
+	case "json":
+		writeJSON(w, http.StatusOK, out)
+	case "txt":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writeResultText(w, out)
+	case "png":
+		w.Header().Set("Content-Type", "image/png")
+		png.Encode(w, resultImage(out.Board, out.Win, engine.IsUltimate(g.wins)))
+	}
+}
+
+// resultLine says how a round ended, for a person.
+func resultLine(round replayRound) string {
+	switch {
+	case round.Adjudicated && round.Result == "draw":
+		return "draw on adjudication"
+	case round.Adjudicated:
+		return round.Result + " wins on adjudication"
+	case round.Result == "draw":
+		return "draw"
+	case round.Timeout:
+		return round.Result + " wins on time"
+	case round.Conceded:
+		return round.Result + " wins by concession"
+	}
+	return round.Result + " wins"
+}
+
+// writeResultText writes out as an ASCII board, winning cells in brackets,
+// followed by its moves.
+func writeResultText(w io.Writer, out exportRound) {
+	fmt.Fprintf(w, "Game %s, round %d: %s\n\n", out.GameID, out.Round, resultLine(out.replayRound))
+	winning := make(map[[2]int]bool)
+	if out.Win != nil {
+		for _, c := range out.Win.Cells {
+			winning[c] = true
+		}
+	}
+	n := out.Board.Size()
+	for r := 0; r < n; r++ {
+		if r > 0 {
+			fmt.Fprintln(w, strings.Repeat("---+", n-1)+"---")
+		}
+		cells := make([]string, n)
+		for c := 0; c < n; c++ {
+			mark := out.Board[r][c]
+			if mark == "" {
+				mark = " "
+			}
+			if winning[[2]int{r, c}] {
+				cells[c] = "[" + mark + "]"
+			} else {
+				cells[c] = " " + mark + " "
+			}
+		}
+		fmt.Fprintln(w, strings.Join(cells, "|"))
+	}
+	fmt.Fprintln(w)
+	for i, mv := range out.Moves {
+		switch {
+		case mv.Skipped:
+			fmt.Fprintf(w, "%d. %s skipped\n", i+1, mv.Player)
+		case mv.Mark != "":
+			fmt.Fprintf(w, "%d. %s marks %s at row %d, col %d\n", i+1, mv.Player, mv.Mark, mv.Row+1, mv.Col+1)
+		default:
+			fmt.Fprintf(w, "%d. %s row %d, col %d\n", i+1, mv.Player, mv.Row+1, mv.Col+1)
+		}
+	}
+}
+
+var (
+	exportBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	exportHighlight  = color.RGBA{0xff, 0xe0, 0x82, 0xff}
+	exportGrid       = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	exportMarks      = map[string]color.RGBA{
+		"X":          {0xd3, 0x2f, 0x2f, 0xff},
+		"O":          {0x19, 0x76, 0xd2, 0xff},
+		engine.Third: {0x38, 0x8e, 0x3c, 0xff},
+	}
+)
+
+// resultImage draws b, with win's cells highlighted and, on an ultimate
+// board, the sub-boards ruled off.
+func resultImage(b engine.Board, win *protocol.Win, ultimate bool) image.Image {
+	n := b.Size()
+	cell := min(exportPixels/n, 80)
+	img := image.NewRGBA(image.Rect(0, 0, n*cell, n*cell))
+	draw.Draw(img, img.Bounds(), image.NewUniform(exportBackground), image.Point{}, draw.Src)
+	if win != nil {
+		for _, c := range win.Cells {
+			fillRect(img, image.Rect(c[1]*cell, c[0]*cell, (c[1]+1)*cell, (c[0]+1)*cell), exportHighlight)
+		}
+	}
+	for i := 1; i < n; i++ {
+		width := 1
+		if ultimate && i%(n/3) == 0 {
+			width = 3
+		}
+		fillRect(img, image.Rect(i*cell-width, 0, i*cell+width, n*cell), exportGrid)
+		fillRect(img, image.Rect(0, i*cell-width, n*cell, i*cell+width), exportGrid)
+	}
+	stroke := max(cell/10, 2)
+	for r := range b {
+		for c, mark := range b[r] {
+			col, ok := exportMarks[mark]
+			if !ok {
+				continue
+			}
+			x0, y0, pad := c*cell, r*cell, cell/5
+			switch mark {
+			case "X":
+				drawLine(img, x0+pad, y0+pad, x0+cell-pad, y0+cell-pad, stroke, col)
+				drawLine(img, x0+cell-pad, y0+pad, x0+pad, y0+cell-pad, stroke, col)
+			case "O":
+				drawRing(img, x0+cell/2, y0+cell/2, cell/2-pad, stroke, col)
+			default:
+				top, left, right := image.Pt(x0+cell/2, y0+pad), image.Pt(x0+pad, y0+cell-pad), image.Pt(x0+cell-pad, y0+cell-pad)
+				drawLine(img, top.X, top.Y, left.X, left.Y, stroke, col)
+				drawLine(img, left.X, left.Y, right.X, right.Y, stroke, col)
+				drawLine(img, right.X, right.Y, top.X, top.Y, stroke, col)
+			}
+		}
+	}
+	return img
+}
+
+func fillRect(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// drawLine draws a line width pixels thick from (x0, y0) to (x1, y1).
+func drawLine(img *image.RGBA, x0, y0, x1, y1, width int, c color.RGBA) {
+	steps := max(abs(x1-x0), abs(y1-y0), 1)
+	for i := 0; i <= steps; i++ {
+		x := x0 + (x1-x0)*i/steps
+		y := y0 + (y1-y0)*i/steps
+		fillRect(img, image.Rect(x-width/2, y-width/2, x+width-width/2, y+width-width/2), c)
+	}
+}
+
+// drawRing draws a circle of radius around (cx, cy), width pixels thick.
+func drawRing(img *image.RGBA, cx, cy, radius, width int, c color.RGBA) {
+	outer, inner := (radius+width/2)*(radius+width/2), (radius-width/2)*(radius-width/2)
+	for y := cy - radius - width; y <= cy+radius+width; y++ {
+		for x := cx - radius - width; x <= cx+radius+width; x++ {
+			if d := (x-cx)*(x-cx) + (y-cy)*(y-cy); d <= outer && d >= inner {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
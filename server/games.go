@@ -0,0 +1,554 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"tictactoe/discord"
+	"tictactoe/engine"
+	"tictactoe/i18n"
+	"tictactoe/local"
+	"tictactoe/protocol"
+	"tictactoe/replay"
+)
+
+// --- Game REST API ---
+
+const gameIDAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newGameID draws each character uniformly from gameIDAlphabet; a byte
+// taken modulo its length would favour the first few.
+func newGameID() string {
+	n := big.NewInt(int64(len(gameIDAlphabet)))
+	b := make([]byte, 6)
+	for i := range b {
+		c, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			panic(err) // crypto/rand doesn't fail on supported platforms
+		}
+		b[i] = gameIDAlphabet[c.Int64()]
+	}
+	return string(b)
+}
+
+// liveGames snapshots the registry so callers can send each game a command
+// without holding gamesMutex (removeGame takes gamesMutex on the loop).
+func liveGames() []*Game {
+	gamesMutex.RLock()
+	defer gamesMutex.RUnlock()
+	out := make([]*Game, 0, len(games))
+	for _, g := range games {
+		out = append(out, g)
+	}
+	return out
+}
+
+// registerGame adds game to the registry under its key, starts reading its
+// openings and, in distributed mode, claims it for this instance. Caller
+// must hold gamesMutex.
+func registerGame(game *Game) {
+	games[game.key()] = game
+	game.loadOpenings()
+	metrics.Games.Add(1)
+	if !game.EmptySince.IsZero() {
+		metrics.DormantGames.Add(1) // Restored with no one connected yet
+	}
+	if cluster != nil {
+		cluster.claimGame(game.key())
+	}
+}
+
+// playerByToken finds the seated player holding token in any live game.
+func playerByToken(token string) *Player {
+	if token == "" {
+		return nil
+	}
+	for _, game := range liveGames() {
+		var found *Player
+		game.do(func() {
+			for _, p := range game.Players {
+				if p.Token == token {
+					found = p
+				}
+			}
+		})
+		if found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+type createGameRequest struct {
+	Challenge    *PowSolution `json:"challenge"`
+	CaptchaToken string       `json:"captcha_token"`
+	Rated        bool         `json:"rated"`
+	Locale       string       `json:"locale"` // Game-wide language for system messages
+
+	WinConditions []string `json:"win_conditions"` // Optional ways to win besides lines
+	ReadyCheck    bool     `json:"ready_check"`    // Ask both players to confirm before each round
+
+	StartsAt    *time.Time `json:"starts_at"`     // Schedule the first round for this time
+	NoShowGrace int        `json:"no_show_grace"` // Seconds past starts_at to wait for a player; 0 for the server default
+
+	Correspondence bool `json:"correspondence"` // Play a move at a time over days; see correspondence.go
+	TurnWindow     int  `json:"turn_window"`    // Seconds per move in a correspondence game; 0 for the server default
+
+	DiscordWebhook string `json:"discord_webhook"` // Post the result here instead of to -discord-webhook
+
+	First string `json:"first"` // Who moves first in round 1, "X" or "O"; X by default
+
+	TurnTimer   *int   `json:"turn_timer"`   // Seconds per move, 0 for no limit; -turn-timer if unset
+	TurnTimeout string `json:"turn_timeout"` // "forfeit" or "skip"; -turn-timeout if unset
+	TimeControl *int   `json:"time_control"` // Seconds each player has for a whole round, 0 for none; -time-control if unset. See clock.go
+
+	Size      int `json:"size"`       // Rows and columns, 3 to 10; 3 if unset
+	WinLength int `json:"win_length"` // Marks in a row that win, 3 to size; a full line if unset
+
+	Variant string `json:"variant"` // "classic", "ultimate", "misere", "wild" or "blitz"; see ultimate.go, variants.go and blitz.go
+
+	Public bool `json:"public"`  // List the game in GET /lobby while it waits for an opponent
+	BestOf int  `json:"best_of"` // Play a series of this many rounds, 3, 5, 7 and so on; 0 for no series
+
+	MaxRounds int `json:"max_rounds"` // Play a series of exactly this many rounds, 1 to 100, in place of best_of; 0 for no limit. See maxrounds.go
+
+	RoundDeadline  int `json:"round_deadline"`  // Seconds a whole round may take before it is adjudicated; 0 for no limit. See deadlines.go
+	SeriesDeadline int `json:"series_deadline"` // Seconds the best_of series may take before the score decides it; 0 for no limit
+
+	StarterPolicy string `json:"starter_policy"` // Who starts each round after the first; alternate if unset
+
+	Password          string `json:"password"`           // Needed to take a seat; see private.go
+	SpectatorPassword string `json:"spectator_password"` // Needed to watch
+
+	Players int `json:"players"` // 2, or 3 for X, O and Δ; see threeplayer.go
+
+	LegalMoves bool `json:"legal_moves"` // List the cells the player on turn may mark with every turn; see hints.go
+
+	HideOpenings bool `json:"hide_openings"` // Leave the game's opening stats out of start_game and GET /games/{game_id}/openings; see openings.go
+
+	CoinFlip bool `json:"coin_flip"` // A coin picks who starts round 1, in place of first; see coinflip.go
+
+	HeadToHead bool `json:"head_to_head"` // Score the named players' lifetime record across games; see headtohead.go
+}
+
+func createGame(w http.ResponseWriter, r *http.Request) {
+	var req createGameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, http.StatusBadRequest, "invalid_body")
+		return
+	}
+	locale := ""
+	if req.Locale != "" {
+		if locale = i18n.Match(req.Locale); locale == "" {
+			writeErrorDetail(w, r, http.StatusBadRequest, "unsupported_locale", "available: "+strings.Join(i18n.Locales(), ", "))
+			return
+		}
+	}
+
+	wins, err := engine.ParseWinConditions(req.WinConditions)
+	if err != nil {
+		writeErrorDetail(w, r, http.StatusBadRequest, "unknown_win_condition", "available: "+strings.Join(engine.OptionalConditions(), ", "))
+		return
+	}
+
+	grace := cfg.NoShowGrace
+	if req.StartsAt != nil {
+		if now := time.Now(); !req.StartsAt.After(now) || req.StartsAt.Sub(now) > maxScheduleAhead {
+			writeErrorDetail(w, r, http.StatusBadRequest, "invalid_starts_at", "starts_at must be in the future and within 90 days")
+			return
+		}
+		if req.NoShowGrace < 0 {
+			writeErrorDetail(w, r, http.StatusBadRequest, "invalid_starts_at", "no_show_grace can't be negative")
+			return
+		}
+		if req.NoShowGrace > 0 {
+			grace = time.Duration(req.NoShowGrace) * time.Second
+		}
+	}
+
+	window := cfg.CorrespondenceTurn
+	if req.Correspondence {
+		switch {
+		case req.StartsAt != nil || req.ReadyCheck:
+			writeErrorDetail(w, r, http.StatusBadRequest, "invalid_correspondence", "a correspondence game can't be scheduled or ready-checked")
+			return
+		case req.TurnWindow < 0:
+			writeErrorDetail(w, r, http.StatusBadRequest, "invalid_correspondence", "turn_window can't be negative")
+			return
+		case req.TurnWindow > 0:
+			window = time.Duration(req.TurnWindow) * time.Second
+		}
+	}
+
+	if req.DiscordWebhook != "" && !discord.ValidWebhookURL(req.DiscordWebhook) {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_webhook", "discord_webhook must be an https://discord.com/api/webhooks/ URL")
+		return
+	}
+
+	timer, timeout := cfg.TurnTimer, cfg.TurnTimeout
+	if req.TurnTimer != nil {
+		if *req.TurnTimer < 0 {
+			writeErrorDetail(w, r, http.StatusBadRequest, "invalid_turn_timer", "turn_timer can't be negative")
+			return
+		}
+		timer = time.Duration(*req.TurnTimer) * time.Second
+	}
+	if req.TurnTimeout != "" {
+		if !validTurnTimeout(req.TurnTimeout) {
+			writeErrorDetail(w, r, http.StatusBadRequest, "invalid_turn_timer", "turn_timeout must be forfeit or skip")
+			return
+		}
+		timeout = req.TurnTimeout
+	}
+
+	if err := playerRules(&req); err != nil {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_players", err.Error())
+		return
+	}
+	if req.Players == 3 && req.TurnTimeout == "" {
+		timeout = timeoutSkip
+	}
+	timeControl, err := timeControlRules(req)
+	if err != nil {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_time_control", err.Error())
+		return
+	}
+
+	size, winLength, err := boardRules(req.Size, req.WinLength)
+	if err != nil {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_board_size", err.Error())
+		return
+	}
+	size, wins, err = variantRules(req, size, wins)
+	if err != nil {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_variant", err.Error())
+		return
+	}
+
+	if req.BestOf != 0 && !validBestOf(req.BestOf) {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_best_of", fmt.Sprintf("best_of must be odd, from 3 to %d", maxBestOf))
+		return
+	}
+
+	if err := maxRoundsRules(req); err != nil {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_max_rounds", err.Error())
+		return
+	}
+
+	roundLimit, seriesLimit, err := deadlineRules(req)
+	if err != nil {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_deadline", err.Error())
+		return
+	}
+
+	if req.StarterPolicy != "" && !validStarterPolicy(req.StarterPolicy) {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_starter_policy", "starter_policy must be alternate, loser_starts, winner_starts or always_x")
+		return
+	}
+
+	if !validPassword(req.Password) || !validPassword(req.SpectatorPassword) {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_password", fmt.Sprintf("passwords can be at most %d characters", maxPasswordLen))
+		return
+	}
+
+	if req.HeadToHead && (req.BestOf != 0 || req.MaxRounds != 0 || req.Players == 3) {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_head_to_head", "a head_to_head game is for two players, without best_of or max_rounds")
+		return
+	}
+
+	if req.CoinFlip && req.First != "" {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_first", "a game with coin_flip can't have first")
+		return
+	}
+
+	first := "X"
+	if req.First != "" {
+		if !engine.IsSymbol(req.First, req.Players) {
+			writeErrorDetail(w, r, http.StatusBadRequest, "invalid_first", "first must be "+symbolChoices(engine.Symbols(req.Players)))
+			return
+		}
+		first = req.First
+	}
+
+	// Last, so a request refused for its body doesn't use up its solution
+	if challengeRequired(r) && !passChallenge(r, req.Challenge, req.CaptchaToken) {
+		writeError(w, r, http.StatusForbidden, "challenge_failed")
+		return
+	}
+
+	tenant := requestTenant(r)
+	gamesMutex.Lock()
+	if code := gameLimitCode(tenant); code != "" {
+		gamesMutex.Unlock()
+		writeError(w, r, http.StatusServiceUnavailable, code)
+		return
+	}
+	if retry, ok := allowIPGame(r, limitIP(r), time.Now()); !ok {
+		gamesMutex.Unlock()
+		writeTooManyGames(w, r, retry)
+		return
+	}
+	id := newGameID()
+	for games[gameKey{tenant, id}] != nil {
+		id = newGameID()
+	}
+	game := newGame(id)
+	game.Tenant = tenant
+	game.Rated = req.Rated
+	game.Public = req.Public
+	game.TargetWins = (req.BestOf + 1) / 2
+	game.MaxRounds = req.MaxRounds
+	game.StarterPolicy = req.StarterPolicy
+	game.Locale = locale
+	game.Board = engine.NewBoard(size)
+	game.WinLength = winLength
+	game.WinConditions = engine.WithWinLength(wins, winLength)
+	game.ReadyCheck = req.ReadyCheck
+	game.ThreePlayer = req.Players == 3
+	game.DiscordWebhook = req.DiscordWebhook
+	game.FirstPlayer = first
+	game.TurnTimer = timer
+	game.TurnTimeout = timeout
+	game.TimeControl = timeControl
+	game.ShowLegalMoves = req.LegalMoves
+	game.HideOpenings = req.HideOpenings
+	if req.CoinFlip {
+		game.CoinFlip, game.coinNonce = true, newCoinNonce()
+	}
+	game.HeadToHead = req.HeadToHead
+	game.RoundTimeLimit, game.SeriesTimeLimit = roundLimit, seriesLimit
+	game.StartingPlayerForRound = first
+	game.CurrentPlayer = first
+	if req.Password != "" {
+		game.PasswordHash = hashPassword(req.Password)
+	}
+	if req.SpectatorPassword != "" {
+		game.SpectatorPasswordHash = hashPassword(req.SpectatorPassword)
+	}
+	game.ExpiresAt = time.Now().Add(cfg.LobbyTTL) // Until someone joins; the first touch extends it
+	if req.StartsAt != nil {
+		game.StartsAt = *req.StartsAt
+		game.NoShowGrace = grace
+		game.touch()
+	}
+	if req.Correspondence {
+		game.Correspondence = true
+		game.TurnWindow = window
+		game.touch()
+	}
+	registerGame(game)
+	gamesMutex.Unlock()
+	game.logger().Info("game created", "via", "api")
+
+	resp := map[string]string{"game_id": id, "ws_url": cfg.BasePath + tenantPrefix(tenant) + "/ws/" + id}
+	game.do(func() {
+		game.persist()
+		game.armSchedule()
+	})
+	if req.StartsAt != nil {
+		resp["starts_at"] = req.StartsAt.UTC().Format(time.RFC3339Nano)
+	}
+	if game.CoinFlip {
+		resp["coin_commitment"] = protocol.CoinCommitment(game.coinNonce)
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// importGame loads a replay file into a new finished game record. Every
+// move is checked by the engine before anything is stored.
+func importGame(w http.ResponseWriter, r *http.Request) {
+	f, err := replay.Parse(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_replay", err.Error())
+		return
+	}
+	score, err := replay.Validate(f)
+	if err != nil {
+		code := "invalid_replay"
+		var moveErr *replay.MoveError
+		if errors.As(err, &moveErr) {
+			code = "illegal_move"
+		}
+		writeErrorDetail(w, r, http.StatusUnprocessableEntity, code, err.Error())
+		return
+	}
+
+	tenant, id := requestTenant(r), newGameID()
+	for {
+		_, taken, err := store.LoadGameRecord(tenant, id)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal_error")
+			return
+		}
+		gamesMutex.RLock()
+		live := games[gameKey{tenant, id}] != nil
+		gamesMutex.RUnlock()
+		if !taken && !live {
+			break
+		}
+		id = newGameID()
+	}
+
+	rec := GameRecord{
+		ID:         id,
+		Rounds:     f.Rounds,
+		Score:      Score{X: score.X, O: score.O, Third: score.Third, Draws: score.Draws},
+		Imported:   true,
+		FinishedAt: time.Now().UTC(),
+
+		Tenant:        tenant,
+		WinConditions: f.WinConditions,
+
+		Size:      f.Size,
+		WinLength: f.WinLength,
+
+		Players: f.Players,
+	}
+	if err := store.SaveGameRecord(rec); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"game_id": id, "rounds": len(rec.Rounds), "score": rec.Score})
+}
+
+type boardView struct {
+	Board         engine.Board `json:"board"`
+	CurrentPlayer string       `json:"current_player"`
+	Score         Score        `json:"score"`
+}
+
+// getBoard serves the bare board for polling displays. The ETag changes
+// only when something is broadcast, so an unchanged game answers 304, and
+// differs between the JSON and ?format=txt bodies. A private game's board
+// needs a password or seat token; see mayView.
+func getBoard(w http.ResponseWriter, r *http.Request) {
+	gamesMutex.RLock()
+	game, exists := games[requestGameKey(r)]
+	gamesMutex.RUnlock()
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "game_not_found")
+		return
+	}
+
+	text, format := r.URL.Query().Get("format") == "txt", ""
+	if text {
+		format = "-txt" // The same version, another body
+	}
+	var view boardView
+	var etag, code string
+	game.do(func() {
+		if code = game.mayView(limitIP(r), r.URL.Query()); code != "" {
+			return
+		}
+		view = boardView{Board: game.Board.Clone(), CurrentPlayer: game.CurrentPlayer, Score: game.Score}
+		etag = fmt.Sprintf(`"%s-%d%s"`, game.Nonce[:8], game.Seq, format)
+	})
+	if code != "" {
+		writeError(w, r, viewStatus(code), code)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if match := r.Header.Get("If-None-Match"); match != "" && (match == etag || match == "*") {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if text {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		local.Render(w, view.Board)
+		fmt.Fprintf(w, "\n  Turn: %s    X %d - %d O, %d drawn\n", view.CurrentPlayer, view.Score.X, view.Score.O, view.Score.Draws)
+		return
+	}
+	writeJSON(w, http.StatusOK, view)
+}
+
+// Round statuses, the lifecycle moves, undos and concessions are gated on.
+// Also reported by GET /games/{game_id}/state.
+const (
+	statusWaiting    = "waiting"
+	statusInProgress = "in_progress"
+	statusFinished   = "finished"
+)
+
+type stateView struct {
+	GameID        string            `json:"game_id"`
+	Version       uint64            `json:"version"` // Bumped on every broadcast; also in the ETag
+	Round         int               `json:"round"`
+	Status        string            `json:"status"`
+	Board         engine.Board      `json:"board"`
+	CurrentPlayer string            `json:"current_player"`
+	Score         Score             `json:"score"`
+	Names         map[string]string `json:"names"`
+}
+
+// stateView is the game's state for a polling client. Runs on the game's
+// loop.
+func (game *Game) stateView() stateView {
+	return stateView{
+		GameID:        game.ID,
+		Version:       game.Seq,
+		Round:         game.Round,
+		Status:        game.roundStatus(),
+		Board:         game.Board.Clone(),
+		CurrentPlayer: game.CurrentPlayer,
+		Score:         game.Score,
+		Names:         game.playerNames(),
+	}
+}
+
+// roundStatus is where the current round stands: finished once it has a
+// result, waiting while it can't be played yet, otherwise in progress. It
+// is derived from the game rather than stored, so no transition can be
+// missed. Runs on the game's loop.
+func (game *Game) roundStatus() string {
+	switch {
+	case game.roundOver():
+		return statusFinished
+	case !game.canPlay() || game.Ready != nil || game.scheduled() || game.starting():
+		return statusWaiting
+	}
+	return statusInProgress
+}
+
+// getGameState serves what a client without a websocket needs to follow
+// the game by polling, with the same ETag and passwords as getBoard.
+func getGameState(w http.ResponseWriter, r *http.Request) {
+	gamesMutex.RLock()
+	game, exists := games[requestGameKey(r)]
+	gamesMutex.RUnlock()
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "game_not_found")
+		return
+	}
+
+	var view stateView
+	var etag, code string
+	game.do(func() {
+		if code = game.mayView(limitIP(r), r.URL.Query()); code != "" {
+			return
+		}
+		view = game.stateView()
+		etag = fmt.Sprintf(`"%s-%d"`, game.Nonce[:8], game.Seq)
+	})
+	if code != "" {
+		writeError(w, r, viewStatus(code), code)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if match := r.Header.Get("If-None-Match"); match != "" && (match == etag || match == "*") {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, view)
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tictactoe/protocol"
+)
+
+// A private game's board and state are served only to a request with one
+// of its passwords or a seat token; any other game's, to anyone.
+func TestPrivateBoardNeedsPassword(t *testing.T) {
+	id := unusedGameID()
+	game := newGame(id)
+	gamesMutex.Lock()
+	registerGame(game)
+	gamesMutex.Unlock()
+	t.Cleanup(func() { game.do(func() { removeGame(game, endClosed) }) })
+	router := NewRouter()
+	get := func(path string) (int, string) {
+		r := httptest.NewRequest("GET", path, nil)
+		passwordLimiter.Forget(game.Nonce + "|" + clientIP(r))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		var body map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&body)
+		code, _ := body["error_code"].(string)
+		return w.Code, code
+	}
+	if status, code := get("/games/" + id + "/board"); status != http.StatusOK {
+		t.Errorf("GET a public game's board: %d %s, want 200", status, code)
+	}
+
+	var token string
+	game.do(func() {
+		game.PasswordHash = hashPassword("sesame")
+		game.SpectatorPasswordHash = hashPassword("popcorn")
+		token = issueSeatToken(game, "X")
+	})
+	for _, path := range []string{"/games/" + id + "/board", "/games/" + id + "/state"} {
+		for query, want := range map[string]int{
+			"":                  http.StatusForbidden,
+			"?password=guess":   http.StatusForbidden,
+			"?token=forged":     http.StatusForbidden,
+			"?password=sesame":  http.StatusOK,
+			"?password=popcorn": http.StatusOK,
+			"?token=" + token:   http.StatusOK,
+		} {
+			status, code := get(path + query)
+			if status != want {
+				t.Errorf("GET %s%s: %d %s, want %d", path, query, status, code, want)
+			} else if want == http.StatusForbidden && code != "wrong_password" {
+				t.Errorf("GET %s%s: refused with %q, want wrong_password", path, query, code)
+			}
+		}
+	}
+
+	// Three wrong guesses from one IP lock it out
+	r := httptest.NewRequest("GET", "/games/"+id+"/board?password=guess", nil)
+	key := game.Nonce + "|" + clientIP(r)
+	passwordLimiter.Forget(key)
+	t.Cleanup(func() { passwordLimiter.Forget(key) })
+	for i := 0; i < 3; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/games/"+id+"/board?password=sesame", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("right password after three wrong ones: %d, want 429 too_many_attempts", w.Code)
+	}
+}
+
+// The text board has an ETag of its own, so a cached JSON body is never
+// taken for it, though both change with the same broadcasts.
+func TestBoardETagPerFormat(t *testing.T) {
+	quickGames(t)
+	id := unusedGameID()
+	x, xc := joinFake(t, id, "")
+	_, oc := joinFake(t, id, "")
+	xc.expect(t, protocol.EventStartGame)
+	oc.expect(t, protocol.EventStartGame)
+	router := NewRouter()
+	get := func(query, match string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/games/"+id+"/board"+query, nil)
+		if match != "" {
+			r.Header.Set("If-None-Match", match)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	jsonTag, textTag := get("", "").Header().Get("ETag"), get("?format=txt", "").Header().Get("ETag")
+	if jsonTag == "" || jsonTag == textTag {
+		t.Fatalf("ETags %s for JSON and %s for text, want two different ones", jsonTag, textTag)
+	}
+	if w := get("?format=txt", jsonTag); w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("text board with the JSON ETag: %d %s, want the text body", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w := get("?format=txt", textTag); w.Code != http.StatusNotModified {
+		t.Errorf("text board with its own ETag: %d, want 304", w.Code)
+	}
+
+	x.receive([]byte(`{"event":"make_move","row":1,"col":1}`), newFlood(), gameRequest(id, ""))
+	xc.expect(t, protocol.EventMove)
+	if w := get("?format=txt", textTag); w.Code != http.StatusOK {
+		t.Errorf("text board after a move: %d, want 200 with a new ETag", w.Code)
+	}
+}
+
+// Game IDs use every character of the alphabet about equally often, and
+// only those.
+func TestNewGameIDUniform(t *testing.T) {
+	const ids = 20000
+	counts := make(map[rune]int)
+	for i := 0; i < ids; i++ {
+		id := newGameID()
+		if len(id) != 6 {
+			t.Fatalf("ID %q isn't six characters", id)
+		}
+		for _, c := range id {
+			if !strings.ContainsRune(gameIDAlphabet, c) {
+				t.Fatalf("ID %q has %q, which isn't in the alphabet", id, c)
+			}
+			counts[c]++
+		}
+	}
+	want := float64(ids*6) / float64(len(gameIDAlphabet))
+	for _, c := range gameIDAlphabet {
+		if n := float64(counts[c]); n < want*0.85 || n > want*1.15 {
+			t.Errorf("%q came up %.0f times, want about %.0f", c, n, want)
+		}
+	}
+}
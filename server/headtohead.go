@@ -0,0 +1,221 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// --- Head to Head ---
+
+// Friends who start a fresh game every time still want their running
+// score. A game created with head_to_head keeps one per pair of player
+// names, whatever the game ID: once both seats are taken by players who
+// gave different names, start_game carries the pair's lifetime record as
+// the score, and every round after is added to it in the store. The pair
+// is the two names sorted, so it doesn't matter who sits where, and
+// stored under their hash. Each round is a single atomic update, and
+// never a read and a write back from the game, so two games between the
+// same pair at once both count. A round only counts while the seats hold
+// the pair the score was seeded for; anyone else who takes a seat plays
+// on without touching the record. GET /head2head?a=&b= serves a pair's
+// record, beside /leaderboard and /players/{name}.
+//
+// The seeded score is the record, not a series, so a head_to_head game
+// can't have best_of or max_rounds, and it is for two players only.
+
+// HeadToHead is the record between two named players, A and B in sorted
+// order. Passed to AddHeadToHead, it is what to add.
+type HeadToHead struct {
+	Tenant     string    `json:"tenant"`
+	A          string    `json:"a"`
+	B          string    `json:"b"`
+	AWins      int       `json:"a_wins"`
+	BWins      int       `json:"b_wins"`
+	Draws      int       `json:"draws"`
+	LastPlayed time.Time `json:"last_played"`
+}
+
+// add counts o's rounds too.
+func (h *HeadToHead) add(o HeadToHead) {
+	h.AWins += o.AWins
+	h.BWins += o.BWins
+	h.Draws += o.Draws
+	if o.LastPlayed.After(h.LastPlayed) {
+		h.LastPlayed = o.LastPlayed
+	}
+}
+
+// headToHeadPair is a and b in the order their record keeps them.
+func headToHeadPair(a, b string) (string, string) {
+	if b < a {
+		return b, a
+	}
+	return a, b
+}
+
+// headToHeadKey is what the store keeps a pair's record under: the hash
+// of the sorted names.
+func headToHeadKey(a, b string) string {
+	a, b = headToHeadPair(a, b)
+	sum := sha256.Sum256([]byte(a + "\x00" + b))
+	return hex.EncodeToString(sum[:16])
+}
+
+// headToHeadNames are the names in the X and O seats, if both are taken by
+// players who gave different names. Runs on the game's loop.
+func (game *Game) headToHeadNames() (x, o string, ok bool) {
+	x, o = game.SeatNames["X"], game.SeatNames["O"]
+	return x, o, x != "" && o != "" && x != o && game.AI == ""
+}
+
+// headToHeadRead is a pair's record as join read it.
+type headToHeadRead struct {
+	Pair   [2]string // Sorted
+	Record HeadToHead
+}
+
+// headToHeadCandidate is the pair whose record join should read for a
+// newcomer named name: the two seated names if both are, or else the one
+// seated name and the newcomer's. Nothing, once the game is seeded. Runs
+// on the game's loop.
+func (game *Game) headToHeadCandidate(name string) (a, b string) {
+	if !game.HeadToHead || game.HeadToHeadPair[0] != "" || game.AI != "" {
+		return "", ""
+	}
+	x, o := game.SeatNames["X"], game.SeatNames["O"]
+	switch {
+	case x != "" && o != "":
+		a, b = x, o
+	case x != "":
+		a, b = x, name
+	default:
+		a, b = o, name
+	}
+	if a == "" || b == "" || a == b {
+		return "", ""
+	}
+	return headToHeadPair(a, b)
+}
+
+// readHeadToHead reads the record between a and b, or nil if it can't.
+func readHeadToHead(tenant, a, b string) *headToHeadRead {
+	h, _, err := store.LoadHeadToHead(tenant, a, b)
+	if err != nil {
+		slog.Error("loading head to head", "tenant", tenant, "err", err)
+		return nil
+	}
+	a, b = headToHeadPair(a, b)
+	return &headToHeadRead{Pair: [2]string{a, b}, Record: h}
+}
+
+// seedHeadToHead sets the score to the seated pair's record as the game
+// first starts, before any round is played. It is the record join read as
+// the seats filled; if join didn't read this pair's, the record is read on
+// the store queue instead and added to the score when it comes, on top of
+// any rounds played meanwhile, which the read can't yet include. Runs
+// on the game's loop.
+func (game *Game) seedHeadToHead() {
+	if !game.HeadToHead || game.HeadToHeadPair[0] != "" || game.Round != 1 || len(game.Moves) > 0 || game.Score != (Score{}) {
+		return
+	}
+	x, o, ok := game.headToHeadNames()
+	if !ok {
+		return
+	}
+	a, b := headToHeadPair(x, o)
+	game.HeadToHeadPair = [2]string{a, b}
+	if seed := game.headToHeadSeed; seed != nil && seed.Pair == game.HeadToHeadPair {
+		game.headToHeadSeed = nil
+		game.addHeadToHead(seed.Record)
+		return
+	}
+	tenant, pair := game.Tenant, game.HeadToHeadPair
+	game.storeLater(func() {
+		seed := readHeadToHead(tenant, pair[0], pair[1])
+		game.do(func() {
+			if seed != nil && !game.closed && game.HeadToHeadPair == pair {
+				game.addHeadToHead(seed.Record)
+			}
+		})
+	})
+}
+
+// addHeadToHead adds the pair's record h to the score. Runs on the game's
+// loop.
+func (game *Game) addHeadToHead(h HeadToHead) {
+	x, o := game.SeatNames["X"], game.SeatNames["O"]
+	game.Score.X += h.wins(x)
+	game.Score.O += h.wins(o)
+	game.Score.Draws += h.Draws
+	game.logger().Info("head to head seeded", "x", x, "o", o, "score_x", game.Score.X, "score_o", game.Score.O, "draws", game.Score.Draws)
+}
+
+// wins are name's wins in the record.
+func (h HeadToHead) wins(name string) int {
+	if name == h.A {
+		return h.AWins
+	}
+	if name == h.B {
+		return h.BWins
+	}
+	return 0
+}
+
+// recordHeadToHead adds the round winner took ("" for a draw) to the
+// pair's record, if the seats still hold the pair. Runs on the game's
+// loop.
+func (game *Game) recordHeadToHead(winner string, at time.Time) {
+	if !game.HeadToHead || game.HeadToHeadPair[0] == "" {
+		return
+	}
+	x, o, ok := game.headToHeadNames()
+	if a, b := headToHeadPair(x, o); !ok || [2]string{a, b} != game.HeadToHeadPair {
+		return
+	}
+	delta := HeadToHead{Tenant: game.Tenant, A: game.HeadToHeadPair[0], B: game.HeadToHeadPair[1], LastPlayed: at}
+	switch game.SeatNames[winner] {
+	case "":
+		delta.Draws = 1
+	case delta.A:
+		delta.AWins = 1
+	default:
+		delta.BWins = 1
+	}
+	log := game.logger()
+	game.storeLater(func() {
+		if err := store.AddHeadToHead(delta); err != nil {
+			log.Error("saving head to head", "err", err)
+		}
+	})
+}
+
+// getHeadToHead serves GET /head2head?a=Alice&b=Bob: the pair's lifetime
+// record, with a's and b's wins as the query names them.
+func getHeadToHead(w http.ResponseWriter, r *http.Request) {
+	a, b := displayName(r.URL.Query().Get("a")), displayName(r.URL.Query().Get("b"))
+	if a == "" || b == "" || a == b {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_head_to_head", "a and b must be two different player names")
+		return
+	}
+	h, ok, err := store.LoadHeadToHead(requestTenant(r), a, b)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "head_to_head_not_found")
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		A          string    `json:"a"`
+		B          string    `json:"b"`
+		AWins      int       `json:"a_wins"`
+		BWins      int       `json:"b_wins"`
+		Draws      int       `json:"draws"`
+		Rounds     int       `json:"rounds"`
+		LastPlayed time.Time `json:"last_played"`
+	}{a, b, h.wins(a), h.wins(b), h.Draws, h.AWins + h.BWins + h.Draws, h.LastPlayed})
+}
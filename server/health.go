@@ -0,0 +1,103 @@
+package server
+
+import (
+	"time"
+
+	"tictactoe/protocol"
+)
+
+// --- Connection Health & AFK Pause ---
+
+// A connection that has let a ping go unanswered for a full
+// cfg.PingInterval is quiet: still open, but probably a backgrounded tab.
+// The game pauses until it is heard from again. Once it has left
+// cfg.PingTimeout's worth of pings unanswered it is declared dead and goes
+// the way of any disconnect. A peer gone without a trace, such as a half-open TCP
+// connection, also trips the read deadline, so the handler's cleanup runs
+// even if the write pump is stuck.
+const (
+	healthAlive int32 = iota
+	healthQuiet
+)
+
+// maxMissedPongs is how many pings in a row a connection may leave
+// unanswered.
+func maxMissedPongs() int32 {
+	return int32(cfg.PingTimeout / cfg.PingInterval)
+}
+
+// readTimeout is how long a connection may go without sending anything,
+// pongs included, before its read fails.
+func readTimeout() time.Duration {
+	return cfg.PingTimeout + cfg.PingInterval
+}
+
+// checkHeartbeat runs on the write pump before each ping. It returns false
+// once the connection should be dropped.
+func (p *Player) checkHeartbeat() bool {
+	missed := p.unanswered.Load()
+	if missed >= maxMissedPongs() {
+		p.logger().Warn("missed pongs, dropping connection", "missed", missed, "latency_ms", p.latencyMS())
+		metrics.PingTimeouts.Add(1)
+		return false
+	}
+	if missed > 0 && p.health.CompareAndSwap(healthAlive, healthQuiet) {
+		p.game.playerQuiet(p)
+	}
+	return true
+}
+
+// heard records that the client is responsive, via a pong or any message,
+// resuming the game if it had gone quiet and pushing back the read
+// deadline. It runs on the read goroutine, never on the game's loop.
+func (p *Player) heard() {
+	p.unanswered.Store(0)
+	p.Conn.SetReadDeadline(time.Now().Add(readTimeout()))
+	if p.health.CompareAndSwap(healthQuiet, healthAlive) {
+		p.game.playerBack(p)
+	}
+}
+
+// playerQuiet pauses the game for p. A correspondence game never pauses;
+// its turn deadline keeps running either way.
+func (game *Game) playerQuiet(p *Player) {
+	game.do(func() {
+		if game.Correspondence {
+			return
+		}
+		game.AFK[p.Symbol] = true
+		game.cancelReminder()
+		game.stopTurnTimer()
+		game.leaveClock(p)
+		broadcast(game, OutboundMessage{Event: protocol.EventOpponentAFK, Player: p.Symbol, Code: "opponent_afk"})
+	})
+}
+
+func (game *Game) playerBack(p *Player) {
+	game.do(func() {
+		if !game.AFK[p.Symbol] {
+			return
+		}
+		delete(game.AFK, p.Symbol)
+		if len(game.AFK) == 0 {
+			broadcast(game, protocol.BoardState(protocol.EventResumed, game.Board, game.CurrentPlayer, nil))
+			game.armReminder()
+			game.armTurnTimer()
+			game.runClock()
+			game.armAI()
+		}
+	})
+}
+
+// paused reports whether play is frozen waiting on a quiet player. Runs
+// on the game's loop.
+func (game *Game) paused() bool {
+	return len(game.AFK) > 0
+}
+
+// roundOver reports whether the current board is already won or drawn, or
+// was stopped unfinished by the series' deadline. Runs on the game's
+// loop.
+func (game *Game) roundOver() bool {
+	return game.result() != "" || game.SeriesAdjudicated != ""
+}
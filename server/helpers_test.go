@@ -0,0 +1,239 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tictactoe/config"
+	"tictactoe/protocol"
+
+	"github.com/gorilla/mux"
+)
+
+// TestMain keeps the server's logs out of test output.
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// withConfig runs the rest of the test with cfg changed by edit, putting
+// the old one back when it ends.
+func withConfig(t *testing.T, edit func(c *config.Config)) {
+	t.Helper()
+	old := cfg
+	t.Cleanup(func() { cfg = old })
+	edit(&cfg)
+}
+
+// quickGames has rounds start at once, for tests that play them.
+func quickGames(t *testing.T) {
+	withConfig(t, func(c *config.Config) { c.StartCountdown = 0 })
+}
+
+// fakeConn is a conn that keeps what the server writes to it. Once broken,
+// every write fails, as on a dead socket. Once stalled, every write hangs
+// for stallTimeout and then fails, as to a client that stopped reading
+// would once its write deadline passed.
+type fakeConn struct {
+	msgs      chan OutboundMessage
+	broken    atomic.Bool
+	stalled   atomic.Bool
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu     sync.Mutex
+	frames [][]byte // Close frames, in order
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{msgs: make(chan OutboundMessage, 256), closed: make(chan struct{})}
+}
+
+var (
+	errBroken  = errors.New("broken pipe")
+	errTimeout = errors.New("i/o timeout")
+)
+
+// stallTimeout stands in for cfg.WriteTimeout on a stalled fakeConn.
+const stallTimeout = 300 * time.Millisecond
+
+func (c *fakeConn) Write(msg OutboundMessage) error {
+	if c.broken.Load() {
+		return errBroken
+	}
+	if c.stalled.Load() {
+		select {
+		case <-time.After(stallTimeout):
+			return errTimeout
+		case <-c.closed:
+			return errBroken
+		}
+	}
+	select {
+	case c.msgs <- msg:
+	default:
+		return errors.New("fakeConn: test isn't reading")
+	}
+	return nil
+}
+
+func (c *fakeConn) Codec() protocol.Codec { return protocol.JSON }
+
+func (c *fakeConn) WriteClose(frame []byte) {
+	c.mu.Lock()
+	c.frames = append(c.frames, frame)
+	c.mu.Unlock()
+}
+
+func (c *fakeConn) Ping(string) error {
+	if c.broken.Load() {
+		return errBroken
+	}
+	return nil
+}
+
+func (c *fakeConn) SetReadDeadline(time.Time) error { return nil }
+
+func (c *fakeConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+// expect reads c's messages until one for event arrives, failing the test
+// if none does in time.
+func (c *fakeConn) expect(t testing.TB, event protocol.Event) OutboundMessage {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case msg := <-c.msgs:
+			if msg.Event == event {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("no %s arrived", event)
+			return OutboundMessage{}
+		}
+	}
+}
+
+// gameRequest is the request a client joining gameID would make, with the
+// route's variables set as the router would.
+func gameRequest(gameID, query string) *http.Request {
+	r := httptest.NewRequest("GET", "/ws/"+gameID+"?"+query, nil)
+	return mux.SetURLVars(r, map[string]string{"game_id": gameID})
+}
+
+// joinFake joins gameID over a fakeConn, in the locale query asks for as the
+// websocket handler would. Like the handler's read loop, it has the player
+// leave once the connection is closed.
+func joinFake(t testing.TB, gameID, query string) (*Player, *fakeConn) {
+	t.Helper()
+	c := newFakeConn()
+	r := gameRequest(gameID, query)
+	p := join(c, r, declaredLocale(r))
+	if p == nil {
+		t.Fatalf("join %s?%s refused", gameID, query)
+	}
+	left := make(chan struct{})
+	go func() {
+		<-c.closed
+		p.leave()
+		close(left)
+	}()
+	t.Cleanup(func() {
+		c.Close()
+		<-left
+	})
+	return p, c
+}
+
+// unusedGameID is a game ID no other test plays in.
+func unusedGameID() string {
+	return "test-" + newID()
+}
+
+// responsive fails the test if game's loop doesn't run a command within a
+// second, as when one of its commands is stuck.
+func responsive(t *testing.T, game *Game) {
+	t.Helper()
+	ran := make(chan struct{})
+	go game.do(func() { close(ran) })
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("the game's loop is stuck")
+	}
+}
+
+// fakeClock is a clock that stands still until the test moves it on. Its
+// timers fire, on the goroutine that moves it, once it passes them.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	at    time.Time
+	f     func()
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1_700_000_000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) clockTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock on by d, firing the timers it passes.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due, left []*fakeTimer
+	for _, t := range c.timers {
+		if t.at.After(c.now) {
+			left = append(left, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	c.timers = left
+	c.mu.Unlock()
+	for _, t := range due {
+		t.f()
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// --- Legal Moves and Hints ---
+
+// A game created with "legal_moves" lists the cells the player on turn may
+// mark on every message that hands out a turn: round announcements, move,
+// turn_skipped and undo_applied. It is off by default to spare clients the
+// bytes. Either way a player on turn may send hint_request, once per turn,
+// and get a hint with one suggested cell back: the centre if it is free,
+// then a corner, then anything. Rated games give no hints. Both come from
+// engine.LegalMoves on the current board, so they hold after rematches,
+// undos and skipped turns alike.
+
+// legalCells is every cell the player on turn may mark. Runs on the game's
+// loop.
+func (game *Game) legalCells() []engine.Cell {
+	return engine.LegalMoves(game.Board, game.lastMark(), game.WinConditions)
+}
+
+// legalMoves is legalCells for a message, or nil unless the game lists
+// them and the round is in play. Runs on the game's loop.
+func (game *Game) legalMoves() []protocol.Cell {
+	if !game.ShowLegalMoves || game.roundStatus() != statusInProgress {
+		return nil
+	}
+	cells := game.legalCells()
+	out := make([]protocol.Cell, len(cells))
+	for i, c := range cells {
+		out[i] = protocol.Cell{Row: c.Row, Col: c.Col}
+	}
+	return out
+}
+
+// handleHint answers p's hint_request. Runs on the game's loop.
+func (game *Game) handleHint(p *Player) {
+	code := ""
+	switch status := game.roundStatus(); {
+	case game.Rated:
+		code = "hints_disabled"
+	case status == statusWaiting:
+		code = "game_not_started"
+	case status == statusFinished:
+		code = engine.ErrRoundOver.Error()
+	case game.CurrentPlayer != p.Symbol:
+		code = engine.ErrNotYourTurn.Error()
+	case p.hintSeq == game.BoardSeq:
+		code = "hint_limit"
+	}
+	if code != "" {
+		p.send(localize(p.locale(), protocol.Failure(code, "")))
+		return
+	}
+	c, ok := engine.Hint(game.legalCells(), game.Board.Size())
+	if !ok {
+		return // No cell to suggest; the round ends on the board
+	}
+	p.hintSeq = game.BoardSeq
+	p.send(OutboundMessage{Event: protocol.EventHint, Player: p.Symbol, Row: &c.Row, Col: &c.Col})
+}
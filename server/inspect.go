@@ -0,0 +1,156 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"tictactoe/engine"
+	"tictactoe/replay"
+)
+
+// --- Time-Travel Inspection ---
+
+// positionView is a game as it stood after a given move of a given round.
+type positionView struct {
+	Round         int          `json:"round"`
+	Move          int          `json:"move"` // Moves applied; 0 is the empty board
+	Moves         int          `json:"moves"`
+	Board         engine.Board `json:"board"`
+	CurrentPlayer string       `json:"current_player,omitempty"` // Whose turn it was next; empty once the round was over
+	Result        string       `json:"result,omitempty"`
+	LastMove      *replay.Move `json:"last_move,omitempty"`    // The recorded move that produced this position
+	Illegal       *illegalMove `json:"illegal_move,omitempty"` // First recorded move in the round the engine rejects
+}
+
+// illegalMove flags a recorded move the engine refuses, which means a past
+// server bug or a tampered record.
+type illegalMove struct {
+	Move  int         `json:"move"` // 1-based
+	Entry replay.Move `json:"entry"`
+	Error string      `json:"error"`
+}
+
+// position replays round through the engine up to move (1-based; 0 for the
+// empty board) on a size×size board among players (0 for X and O). A position past an illegal move can't
+// be reached, so the view stops before it; the illegal move is reported even
+// if it comes later.
+func position(round replay.Round, size, players int, wins []engine.WinCondition, move int) (positionView, error) {
+	m, err := replay.Start(round, size, players, wins)
+	if err != nil {
+		return positionView{}, err
+	}
+	view := positionView{Moves: len(round.Moves), Board: m.Board.Clone(), CurrentPlayer: round.Starter}
+	for i, mv := range round.Moves {
+		if _, err := replay.Apply(m, mv); err != nil {
+			view.Illegal = &illegalMove{Move: i + 1, Entry: mv, Error: err.Error()}
+			break
+		}
+		if i < move {
+			view.Move = i + 1
+			view.Board = m.Board.Clone()
+			view.CurrentPlayer = m.CurrentPlayer
+			view.LastMove = &round.Moves[i]
+		}
+	}
+	view.Result = roundResult(view.Board, wins, lastMover(round.Moves[:view.Move]))
+	if round.Timeout && view.Illegal == nil && view.Move == len(round.Moves) {
+		view.Result = round.Result
+	}
+	if view.Result != "" {
+		view.CurrentPlayer = ""
+	}
+	return view, nil
+}
+
+// recordedGame is every round of a game kept so far, with the rules they
+// were played under.
+type recordedGame struct {
+	rounds []replay.Round // The live game's include the round in play
+	first  int            // Round number of rounds[0]
+	size   int
+	wins   []engine.WinCondition
+
+	players int // 3 for a three-player game; 0 for X and O
+}
+
+// loadRecordedGame finds the rounds of key's game, live or from its record.
+// If there are none it writes the error response and returns false.
+func loadRecordedGame(w http.ResponseWriter, r *http.Request, key gameKey) (recordedGame, bool) {
+	g := recordedGame{first: 1, size: engine.DefaultSize}
+
+	gamesMutex.RLock()
+	game, exists := games[key]
+	gamesMutex.RUnlock()
+	if exists {
+		game.do(func() {
+			g.rounds = append(append([]replay.Round(nil), game.History...), game.currentRound())
+			g.first = game.Round - len(game.History)
+			g.size, g.wins = game.Board.Size(), game.WinConditions
+			g.players = game.recordedPlayers()
+		})
+		return g, true
+	}
+	rec, ok, err := store.LoadGameRecord(key.Tenant, key.ID)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return g, false
+	}
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "game_not_found")
+		return g, false
+	}
+	g.rounds = rec.Rounds
+	f := replay.File{Size: rec.Size, WinLength: rec.WinLength, WinConditions: rec.WinConditions, Players: rec.Players}
+	g.players = rec.Players
+	if g.size, g.wins, err = f.Rules(); err != nil {
+		writeErrorDetail(w, r, http.StatusUnprocessableEntity, "invalid_state", err.Error())
+		return g, false
+	}
+	return g, true
+}
+
+// gameAt serves GET /admin/games/{id}/at?round=R&move=N: the board after
+// move N of round R, replayed from the recorded history. round defaults to
+// the current one and move to the last.
+func gameAt(w http.ResponseWriter, r *http.Request) {
+	g, ok := loadRecordedGame(w, r, requestGameKey(r))
+	if !ok {
+		return
+	}
+	rounds, first, size, wins := g.rounds, g.first, g.size, g.wins
+
+	q := r.URL.Query()
+	roundNo := first + len(rounds) - 1
+	if v := q.Get("round"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < first || n >= first+len(rounds) {
+			writeErrorDetail(w, r, http.StatusNotFound, "position_not_found",
+				"recorded rounds are "+strconv.Itoa(first)+" to "+strconv.Itoa(first+len(rounds)-1))
+			return
+		}
+		roundNo = n
+	}
+	if len(rounds) == 0 {
+		writeError(w, r, http.StatusNotFound, "position_not_found")
+		return
+	}
+	round := rounds[roundNo-first]
+	move := len(round.Moves)
+	if v := q.Get("move"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > len(round.Moves) {
+			writeErrorDetail(w, r, http.StatusNotFound, "position_not_found",
+				"round "+strconv.Itoa(roundNo)+" has "+strconv.Itoa(len(round.Moves))+" moves")
+			return
+		}
+		move = n
+	}
+
+	view, err := position(round, size, g.players, wins, move)
+	if err != nil {
+		writeErrorDetail(w, r, http.StatusUnprocessableEntity, "invalid_state", err.Error())
+		return
+	}
+	view.Round = roundNo
+	writeJSON(w, http.StatusOK, view)
+}
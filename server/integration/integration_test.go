@@ -0,0 +1,416 @@
+// Package integration plays games against the real router over real
+// websockets, the way a browser would, end to end.
+package integration
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tictactoe/client"
+	"tictactoe/config"
+	"tictactoe/protocol"
+	"tictactoe/server"
+
+	"github.com/gorilla/websocket"
+)
+
+// wait bounds every expectation, so a hung game fails fast.
+const wait = 800 * time.Millisecond
+
+// grace is the seat hold the tests run with.
+const grace = 200 * time.Millisecond
+
+var srv *httptest.Server
+
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	c := config.Default()
+	c.Headless = true
+	c.StartCountdown = 0
+	c.ReconnectGrace = grace
+	c.EmptyRetention = time.Minute
+	c.PingInterval = time.Second
+	c.PingTimeout = 5 * time.Second
+	c.MaxConnsPerIP, c.MaxGamesPerIP = 0, 0
+	if err := server.Configure(c); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	srv = httptest.NewServer(server.NewRouter())
+	code := m.Run()
+	srv.Close()
+	os.Exit(code)
+}
+
+var gameCount atomic.Int64
+
+func newGameID() string {
+	return "it-" + strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatInt(gameCount.Add(1), 10)
+}
+
+// player is one client's connection, read on its own goroutine so pings
+// are answered while the test isn't looking.
+type player struct {
+	ws     *websocket.Conn
+	msgs   chan protocol.OutboundMessage
+	done   chan struct{}
+	err    error // Why reading stopped; set before done closes
+	symbol string
+	token  string
+}
+
+// dial opens a websocket to gameID with query, failing the test if the
+// handshake does.
+func dial(t *testing.T, gameID string, query url.Values) *player {
+	t.Helper()
+	u := client.GameURL(srv.URL, gameID)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	d := websocket.Dialer{HandshakeTimeout: wait}
+	ws, resp, err := d.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", u, err)
+	}
+	resp.Body.Close()
+	p := &player{ws: ws, msgs: make(chan protocol.OutboundMessage, 256), done: make(chan struct{})}
+	go p.read()
+	t.Cleanup(func() { ws.Close() })
+	return p
+}
+
+func (p *player) read() {
+	defer close(p.done)
+	for {
+		var msg protocol.OutboundMessage
+		if err := p.ws.ReadJSON(&msg); err != nil {
+			p.err = err
+			return
+		}
+		p.msgs <- msg
+	}
+}
+
+// join dials gameID and expects its seat, remembering the symbol and
+// token it was given.
+func join(t *testing.T, gameID string, query url.Values) *player {
+	t.Helper()
+	p := dial(t, gameID, query)
+	msg := expectEvent(t, p, protocol.EventPlayerAssignment)
+	if msg.Player == "" || msg.Token == "" {
+		t.Fatalf("player_assignment %+v has no seat or token", msg)
+	}
+	p.symbol, p.token = msg.Player, msg.Token
+	return p
+}
+
+// pair seats two players in a fresh game and waits for its first round,
+// returning them starter first.
+func pair(t *testing.T) (first, second *player, gameID string) {
+	t.Helper()
+	gameID = newGameID()
+	a := join(t, gameID, nil)
+	b := join(t, gameID, nil)
+	start := expectEvent(t, a, protocol.EventStartGame)
+	expectEvent(t, b, protocol.EventStartGame)
+	if start.CurrentPlayer == b.symbol {
+		return b, a, gameID
+	}
+	return a, b, gameID
+}
+
+// send writes msg to the server.
+func (p *player) send(t *testing.T, msg protocol.InboundMessage) {
+	t.Helper()
+	if err := p.ws.WriteJSON(msg); err != nil {
+		t.Fatalf("send %s: %v", msg.Event, err)
+	}
+}
+
+func (p *player) move(t *testing.T, row, col int) {
+	t.Helper()
+	p.send(t, protocol.InboundMessage{Event: protocol.EventMakeMove, Row: &row, Col: &col})
+}
+
+// expectEvent returns p's next event e, skipping whatever else arrives
+// first, and fails the test if none comes within wait or the connection
+// closes.
+func expectEvent(t *testing.T, p *player, e protocol.Event) protocol.OutboundMessage {
+	t.Helper()
+	deadline := time.After(wait)
+	for {
+		select {
+		case msg := <-p.msgs:
+			if msg.Event == e {
+				return msg
+			}
+		case <-p.done:
+			t.Fatalf("closed waiting for %s: %v", e, p.err)
+		case <-deadline:
+			t.Fatalf("no %s within %v", e, wait)
+		}
+	}
+}
+
+// expectError returns p's next error reply, failing unless its code is
+// code.
+func expectError(t *testing.T, p *player, code string) protocol.OutboundMessage {
+	t.Helper()
+	deadline := time.After(wait)
+	for {
+		select {
+		case msg := <-p.msgs:
+			if msg.Code == "" || msg.Error == "" {
+				continue
+			}
+			if msg.Code != code {
+				t.Fatalf("error %q (%s), want %q", msg.Code, msg.Error, code)
+			}
+			return msg
+		case <-p.done:
+			t.Fatalf("closed waiting for %s: %v", code, p.err)
+		case <-deadline:
+			t.Fatalf("no %s error within %v", code, wait)
+		}
+	}
+}
+
+// expectClose waits for the server to close p's connection with code and
+// reason.
+func expectClose(t *testing.T, p *player, code int, reason string) {
+	t.Helper()
+	select {
+	case <-p.done:
+	case <-time.After(wait):
+		t.Fatalf("still open; want close %d", code)
+	}
+	var ce *websocket.CloseError
+	if !errors.As(p.err, &ce) {
+		t.Fatalf("read ended with %v, want close %d", p.err, code)
+	}
+	if ce.Code != code || ce.Text != reason {
+		t.Errorf("closed %d %q, want %d %q", ce.Code, ce.Text, code, reason)
+	}
+}
+
+// playMoves plays cells in turn, first and second alternating from first,
+// and checks both see every move but the last, whose outcome is the
+// caller's to expect.
+func playMoves(t *testing.T, first, second *player, cells ...[2]int) {
+	t.Helper()
+	mover, other := first, second
+	for i, cell := range cells {
+		mover.move(t, cell[0], cell[1])
+		if i < len(cells)-1 {
+			for _, p := range []*player{mover, other} {
+				msg := expectEvent(t, p, protocol.EventMove)
+				if msg.Symbol != mover.symbol || *msg.Row != cell[0] || *msg.Col != cell[1] {
+					t.Fatalf("move %d seen as %s at %d,%d, want %s at %v", i+1, msg.Symbol, *msg.Row, *msg.Col, mover.symbol, cell)
+				}
+			}
+		}
+		mover, other = other, mover
+	}
+}
+
+// metric reads name's value from /metrics.
+func metric(t *testing.T, name string) int64 {
+	t.Helper()
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(body), "\n") {
+		if v, ok := strings.CutPrefix(line, name+" "); ok {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return n
+		}
+	}
+	t.Fatalf("no %s in /metrics", name)
+	return 0
+}
+
+// eventually polls check until it holds, failing after wait.
+func eventually(t *testing.T, what string, check func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(wait)
+	for !check() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: not within %v", what, wait)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// A diagonal for the starter, and a full board without a line.
+var (
+	starterWins = [][2]int{{0, 0}, {0, 1}, {1, 1}, {0, 2}, {2, 2}}
+	drawn       = [][2]int{{0, 0}, {0, 1}, {0, 2}, {1, 1}, {2, 1}, {1, 2}, {1, 0}, {2, 0}, {2, 2}}
+)
+
+func TestJoinAndWin(t *testing.T) {
+	first, second, _ := pair(t)
+	if first.symbol == second.symbol {
+		t.Fatalf("both players seated as %s", first.symbol)
+	}
+	playMoves(t, first, second, starterWins...)
+	for _, p := range []*player{first, second} {
+		win := expectEvent(t, p, protocol.EventWin)
+		if win.Player != first.symbol || win.WinType != "diag" {
+			t.Errorf("win %+v, want %s on the diagonal", win, first.symbol)
+		}
+		if win.Score == nil || win.Score.X+win.Score.O != 1 {
+			t.Errorf("score %+v after %s's first win", win.Score, first.symbol)
+		}
+	}
+}
+
+func TestDraw(t *testing.T) {
+	first, second, _ := pair(t)
+	playMoves(t, first, second, drawn...)
+	for _, p := range []*player{first, second} {
+		draw := expectEvent(t, p, protocol.EventDraw)
+		if draw.Score == nil || draw.Score.Draws != 1 {
+			t.Errorf("score %+v after a draw", draw.Score)
+		}
+	}
+}
+
+func TestOutOfTurnMoveRefused(t *testing.T) {
+	first, second, _ := pair(t)
+	second.move(t, 1, 1)
+	expectError(t, second, "not_your_turn")
+
+	// The refusal changed nothing: the starter still moves, into that cell
+	first.move(t, 1, 1)
+	for _, p := range []*player{first, second} {
+		if msg := expectEvent(t, p, protocol.EventMove); msg.Symbol != first.symbol {
+			t.Errorf("move by %s, want %s", msg.Symbol, first.symbol)
+		}
+	}
+}
+
+func TestRematchAlternatesStarter(t *testing.T) {
+	first, second, _ := pair(t)
+	starters := []string{first.symbol}
+	for round := 0; round < 2; round++ {
+		playMoves(t, first, second, drawn...)
+		expectEvent(t, first, protocol.EventDraw)
+		expectEvent(t, second, protocol.EventDraw)
+
+		first.send(t, protocol.InboundMessage{Event: protocol.EventRematchRequest})
+		expectEvent(t, second, protocol.EventRematchRequested)
+		second.send(t, protocol.InboundMessage{Event: protocol.EventRematchRequest})
+		next := expectEvent(t, first, protocol.EventNewGame)
+		expectEvent(t, second, protocol.EventNewGame)
+		starters = append(starters, next.CurrentPlayer)
+		if next.CurrentPlayer == second.symbol {
+			first, second = second, first
+		}
+	}
+	if starters[0] == starters[1] || starters[1] == starters[2] {
+		t.Errorf("rounds started by %v, want them to alternate", starters)
+	}
+}
+
+func TestThirdClientWatches(t *testing.T) {
+	first, second, gameID := pair(t)
+	third := dial(t, gameID, nil)
+	if msg := expectEvent(t, third, protocol.EventSpectatorAssignment); msg.Token != "" {
+		t.Errorf("spectator given seat token %q", msg.Token)
+	}
+
+	// It sees the game but can't play in it
+	playMoves(t, first, second, starterWins[:2]...)
+	expectEvent(t, third, protocol.EventMove)
+	third.move(t, 2, 2)
+	expectError(t, third, "forbidden")
+}
+
+func TestReconnectWithToken(t *testing.T) {
+	first, second, gameID := pair(t)
+	playMoves(t, first, second, starterWins[:2]...)
+	expectEvent(t, first, protocol.EventMove)
+	expectEvent(t, second, protocol.EventMove)
+
+	first.ws.Close()
+	expectEvent(t, second, protocol.EventOpponentLeft)
+	back := join(t, gameID, url.Values{"token": {first.token}})
+	if back.symbol != first.symbol {
+		t.Fatalf("reconnected as %s, want %s", back.symbol, first.symbol)
+	}
+	resume := expectEvent(t, back, protocol.EventStartGame)
+	if resume.Board == nil || (*resume.Board)[0][0] != first.symbol || (*resume.Board)[0][1] != second.symbol {
+		t.Errorf("resumed board %v, want the two moves played", resume.Board)
+	}
+	expectEvent(t, second, protocol.EventStartGame)
+
+	// And plays on where it left off
+	playMoves(t, back, second, starterWins[2:]...)
+	if win := expectEvent(t, second, protocol.EventWin); win.Player != back.symbol {
+		t.Errorf("won by %s, want %s", win.Player, back.symbol)
+	}
+}
+
+func TestCloseCodes(t *testing.T) {
+	first, _, gameID := pair(t)
+
+	// A token the game never issued is refused rather than seated as new
+	forged := dial(t, gameID, url.Values{"token": {first.token + "x"}})
+	expectError(t, forged, "token_invalid")
+	expectClose(t, forged, protocol.CloseRefused, "token_invalid")
+
+	badSymbol := dial(t, newGameID(), url.Values{"symbol": {"Q"}})
+	expectClose(t, badSymbol, protocol.CloseRefused, "invalid_symbol")
+}
+
+func TestOpponentLeftAndCleanup(t *testing.T) {
+	before := metric(t, "xo_dormant_games")
+	first, second, gameID := pair(t)
+	first.ws.Close()
+	expectEvent(t, second, protocol.EventOpponentLeft)
+
+	// Within the grace the seat is held: a newcomer can only watch
+	newcomer := dial(t, gameID, nil)
+	expectEvent(t, newcomer, protocol.EventSpectatorAssignment)
+	newcomer.ws.Close()
+
+	// After it the seat is free again
+	time.Sleep(grace + 50*time.Millisecond)
+	taker := join(t, gameID, nil)
+	if taker.symbol != first.symbol {
+		t.Errorf("newcomer seated as %s, want the released %s", taker.symbol, first.symbol)
+	}
+
+	// The last one out leaves the game dormant rather than gone
+	second.ws.Close()
+	taker.ws.Close()
+	eventually(t, "game dormant", func() bool { return metric(t, "xo_dormant_games") == before+1 })
+	resp, err := http.Get(srv.URL + "/games/" + gameID + "/state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("dormant game's state: %d, want 200", resp.StatusCode)
+	}
+}
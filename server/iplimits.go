@@ -0,0 +1,227 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Per-IP Limits ---
+
+// One client opening thousands of websockets to made-up game IDs fills
+// memory long before -max-games or -max-connections protect anyone else,
+// so each client IP gets its own share: -max-conns-per-ip open websockets
+// at once, and -max-games-per-ip new games, made by joining an unknown ID
+// or by POST /games, within -games-per-ip-window. A connection over the
+// limit is refused with a 429 before it is upgraded. A join that would
+// create one game too many has already been upgraded, so it is closed with
+// CloseRateLimited instead; both are refused as rate_limited. Admin
+// requests and -trusted-ips skip both limits, and a limit set to 0, as both
+// are by default, doesn't track anything.
+//
+// The client IP is the peer address, unless the peer is one of
+// -trusted-proxy: then it is the last address in X-Forwarded-For that isn't
+// another trusted proxy, since everything before that is the client's to
+// forge. An IP is forgotten as soon as it has no connection open and no
+// game in the window; the sweeper clears what the window left behind.
+// GET /admin/ips lists the IPs tracked, and /metrics counts them.
+
+// ipUsage is what one client IP holds against its limits.
+type ipUsage struct {
+	Conns int
+	Games []time.Time // Created within the window, oldest first
+}
+
+var ipLimits = struct {
+	sync.Mutex
+	ips map[string]*ipUsage
+}{ips: make(map[string]*ipUsage)}
+
+// limitIP is the client IP r is held to: the per-IP limits go by it, and
+// so do bans, trusted networks and the game password lockout.
+func limitIP(r *http.Request) string {
+	peer := clientIP(r)
+	if !trustedProxy(peer) {
+		return peer
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break // Nothing before a hop we can't read is to be trusted
+		}
+		if !trustedProxy(ip.String()) {
+			return ip.String()
+		}
+	}
+	return peer
+}
+
+func trustedProxy(ip string) bool {
+	return inNets(ip, cfg.TrustedProxies)
+}
+
+func inNets(ip string, nets []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipExempt reports whether r skips the per-IP limits.
+func ipExempt(r *http.Request, ip string) bool {
+	return inNets(ip, cfg.TrustedNets) || isAdminRequest(r)
+}
+
+// acquireIPConn takes one of ip's connection slots, reporting false if it
+// has none left. A slot taken must be given back with releaseIPConn.
+func acquireIPConn(ip string) bool {
+	ipLimits.Lock()
+	defer ipLimits.Unlock()
+	u := ipLimits.ips[ip]
+	if u == nil {
+		u = &ipUsage{}
+		ipLimits.ips[ip] = u
+	}
+	if u.Conns >= cfg.MaxConnsPerIP {
+		metrics.IPConnsRefused.Add(1)
+		return false
+	}
+	u.Conns++
+	return true
+}
+
+func releaseIPConn(ip string) {
+	ipLimits.Lock()
+	defer ipLimits.Unlock()
+	if u := ipLimits.ips[ip]; u != nil {
+		u.Conns--
+		forgetIdleIP(ip, u, time.Now())
+	}
+}
+
+// allowIPGame counts a new game for ip at now, or reports false with how
+// long until it may create another.
+func allowIPGame(r *http.Request, ip string, now time.Time) (time.Duration, bool) {
+	if cfg.MaxGamesPerIP == 0 || ipExempt(r, ip) {
+		return 0, true
+	}
+	ipLimits.Lock()
+	defer ipLimits.Unlock()
+	u := ipLimits.ips[ip]
+	if u == nil {
+		u = &ipUsage{}
+		ipLimits.ips[ip] = u
+	}
+	u.Games = recentGames(u.Games, now)
+	if len(u.Games) >= cfg.MaxGamesPerIP {
+		metrics.IPGamesRefused.Add(1)
+		return u.Games[0].Add(cfg.GamesPerIPWindow).Sub(now), false
+	}
+	u.Games = append(u.Games, now)
+	return 0, true
+}
+
+// recentGames drops the games from before the window ending at now.
+func recentGames(games []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(games) && now.Sub(games[i]) >= cfg.GamesPerIPWindow {
+		i++
+	}
+	return games[i:]
+}
+
+// forgetIdleIP deletes ip's entry if it holds nothing against the limits.
+// Caller must hold ipLimits.
+func forgetIdleIP(ip string, u *ipUsage, now time.Time) {
+	u.Games = recentGames(u.Games, now)
+	if u.Conns <= 0 && len(u.Games) == 0 {
+		delete(ipLimits.ips, ip)
+	}
+}
+
+// pruneIPs forgets the IPs whose games have all left the window. The
+// sweeper calls it.
+func pruneIPs(now time.Time) {
+	ipLimits.Lock()
+	defer ipLimits.Unlock()
+	for ip, u := range ipLimits.ips {
+		forgetIdleIP(ip, u, now)
+	}
+}
+
+func trackedIPs() int64 {
+	ipLimits.Lock()
+	defer ipLimits.Unlock()
+	return int64(len(ipLimits.ips))
+}
+
+// limitIPConnections refuses a websocket beyond cfg.MaxConnsPerIP from
+// the client's IP with a 429 before upgrading it, holding the slot until
+// the handler returns as limitConnections does.
+func limitIPConnections(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := limitIP(r)
+		if cfg.MaxConnsPerIP == 0 || ipExempt(r, ip) {
+			next(w, r)
+			return
+		}
+		if !acquireIPConn(ip) {
+			writeError(w, r, http.StatusTooManyRequests, "too_many_connections")
+			return
+		}
+		defer releaseIPConn(ip)
+		next(w, r)
+	}
+}
+
+// writeTooManyGames refuses a POST /games over the client's allowance.
+func writeTooManyGames(w http.ResponseWriter, r *http.Request, retry time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+	writeError(w, r, http.StatusTooManyRequests, "rate_limited")
+}
+
+// GET /admin/ips: the client IPs holding connections or recent games,
+// busiest first.
+func listIPs(w http.ResponseWriter, r *http.Request) {
+	type ipRow struct {
+		IP          string `json:"ip"`
+		Connections int    `json:"connections"`
+		Games       int    `json:"games"` // Created within the window
+	}
+	now := time.Now()
+	ipLimits.Lock()
+	rows := make([]ipRow, 0, len(ipLimits.ips))
+	for ip, u := range ipLimits.ips {
+		u.Games = recentGames(u.Games, now)
+		rows = append(rows, ipRow{ip, u.Conns, len(u.Games)})
+	}
+	ipLimits.Unlock()
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.Connections != b.Connections {
+			return a.Connections > b.Connections
+		}
+		if a.Games != b.Games {
+			return a.Games > b.Games
+		}
+		return a.IP < b.IP
+	})
+	writeJSON(w, http.StatusOK, struct {
+		MaxConnsPerIP    int     `json:"max_conns_per_ip"`
+		MaxGamesPerIP    int     `json:"max_games_per_ip"`
+		GamesPerIPWindow float64 `json:"games_per_ip_window_seconds"`
+		IPs              []ipRow `json:"ips"`
+	}{cfg.MaxConnsPerIP, cfg.MaxGamesPerIP, cfg.GamesPerIPWindow.Seconds(), rows})
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tictactoe/config"
+	"tictactoe/protocol"
+)
+
+// untracked clears what ipLimits holds for ips, now and when the test
+// ends, since the table outlives every test.
+func untracked(t *testing.T, ips ...string) {
+	forget := func() {
+		ipLimits.Lock()
+		defer ipLimits.Unlock()
+		for _, ip := range ips {
+			delete(ipLimits.ips, ip)
+		}
+	}
+	forget()
+	t.Cleanup(forget)
+}
+
+// tracked is what ipLimits holds for ip, if anything.
+func tracked(ip string) (ipUsage, bool) {
+	ipLimits.Lock()
+	defer ipLimits.Unlock()
+	u, ok := ipLimits.ips[ip]
+	if !ok {
+		return ipUsage{}, false
+	}
+	return ipUsage{Conns: u.Conns, Games: append([]time.Time(nil), u.Games...)}, true
+}
+
+func TestIPConnSlots(t *testing.T) {
+	withConfig(t, func(c *config.Config) { c.MaxConnsPerIP = 2 })
+	const ip = "198.51.100.1"
+	untracked(t, ip)
+	refused := metrics.IPConnsRefused.Load()
+
+	if !acquireIPConn(ip) || !acquireIPConn(ip) {
+		t.Fatal("refused a slot under the limit")
+	}
+	if acquireIPConn(ip) {
+		t.Fatal("took a third slot with a limit of 2")
+	}
+	if n := metrics.IPConnsRefused.Load() - refused; n != 1 {
+		t.Errorf("counted %d refusals, want 1", n)
+	}
+	releaseIPConn(ip)
+	if !acquireIPConn(ip) {
+		t.Fatal("a released slot can't be taken again")
+	}
+	if u, _ := tracked(ip); u.Conns != 2 {
+		t.Errorf("%d connections tracked, want 2", u.Conns)
+	}
+
+	releaseIPConn(ip)
+	releaseIPConn(ip)
+	if u, ok := tracked(ip); ok {
+		t.Errorf("an IP with nothing open is still tracked: %+v", u)
+	}
+}
+
+func TestIPGameWindow(t *testing.T) {
+	withConfig(t, func(c *config.Config) {
+		c.MaxGamesPerIP = 2
+		c.GamesPerIPWindow = time.Minute
+	})
+	const ip = "198.51.100.2"
+	untracked(t, ip)
+	r := httptest.NewRequest("POST", "/games", nil)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if _, ok := allowIPGame(r, ip, now.Add(time.Duration(i)*time.Second)); !ok {
+			t.Fatalf("game %d refused under the limit", i+1)
+		}
+	}
+	retry, ok := allowIPGame(r, ip, now.Add(2*time.Second))
+	if ok {
+		t.Fatal("a third game within the window was allowed")
+	}
+	if retry != 58*time.Second {
+		t.Errorf("retry after %v, want 58s, when the first game leaves the window", retry)
+	}
+	if _, ok := allowIPGame(r, ip, now.Add(time.Minute+time.Second)); !ok {
+		t.Error("refused once both games had left the window")
+	}
+	if u, _ := tracked(ip); len(u.Games) != 1 {
+		t.Errorf("%d games tracked, want only the newest", len(u.Games))
+	}
+}
+
+func TestIPLimitsSkipped(t *testing.T) {
+	_, trusted, _ := net.ParseCIDR("203.0.113.0/24")
+	withConfig(t, func(c *config.Config) {
+		c.MaxGamesPerIP = 1
+		c.TrustedNets = []*net.IPNet{trusted}
+	})
+	untracked(t, "203.0.113.9", "198.51.100.3")
+	r := httptest.NewRequest("POST", "/games", nil)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, ok := allowIPGame(r, "203.0.113.9", now); !ok {
+			t.Fatal("a trusted IP was limited")
+		}
+	}
+	if _, ok := tracked("203.0.113.9"); ok {
+		t.Error("a trusted IP is tracked")
+	}
+
+	cfg.MaxGamesPerIP = 0
+	for i := 0; i < 3; i++ {
+		if _, ok := allowIPGame(r, "198.51.100.3", now); !ok {
+			t.Fatal("limited with the limit off")
+		}
+	}
+	if _, ok := tracked("198.51.100.3"); ok {
+		t.Error("an IP is tracked with the limit off")
+	}
+}
+
+func TestPruneIPs(t *testing.T) {
+	withConfig(t, func(c *config.Config) {
+		c.MaxConnsPerIP = 5
+		c.MaxGamesPerIP = 5
+		c.GamesPerIPWindow = time.Minute
+	})
+	const idle, open = "198.51.100.5", "198.51.100.6"
+	untracked(t, idle, open)
+	r := httptest.NewRequest("POST", "/games", nil)
+	now := time.Now()
+	allowIPGame(r, idle, now)
+	allowIPGame(r, open, now)
+	if !acquireIPConn(open) {
+		t.Fatal("refused a slot")
+	}
+
+	pruneIPs(now.Add(30 * time.Second))
+	if _, ok := tracked(idle); !ok {
+		t.Error("forgot an IP whose game is still in the window")
+	}
+	pruneIPs(now.Add(time.Minute))
+	if _, ok := tracked(idle); ok {
+		t.Error("kept an IP with no game in the window and nothing open")
+	}
+	u, ok := tracked(open)
+	if !ok || u.Conns != 1 || len(u.Games) != 0 {
+		t.Errorf("IP with a connection open: %+v, %v; want it kept with its game dropped", u, ok)
+	}
+}
+
+// A websocket over the limit is refused before its handler runs, and a
+// connection's slot is given back when it ends.
+func TestLimitIPConnections(t *testing.T) {
+	withConfig(t, func(c *config.Config) { c.MaxConnsPerIP = 1 })
+	untracked(t, "198.51.100.7")
+	entered, release := make(chan struct{}, 1), make(chan struct{})
+	h := limitIPConnections(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})
+	request := func() *http.Request {
+		r := httptest.NewRequest("GET", "/ws/g", nil)
+		r.RemoteAddr = "198.51.100.7:4000"
+		return r
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h(httptest.NewRecorder(), request())
+		close(done)
+	}()
+	<-entered
+
+	w := httptest.NewRecorder()
+	h(w, request())
+	var body map[string]string
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusTooManyRequests || body["error_code"] != "too_many_connections" {
+		t.Errorf("second connection: %d %v, want 429 too_many_connections", w.Code, body)
+	}
+
+	close(release) // The first client disconnects
+	<-done
+	if u, ok := tracked("198.51.100.7"); ok {
+		t.Errorf("slot still held after the disconnect: %+v", u)
+	}
+	w = httptest.NewRecorder()
+	h(w, request())
+	if w.Code != http.StatusOK {
+		t.Errorf("connection after the disconnect: %d, want it let through", w.Code)
+	}
+}
+
+// A join that would create a game over the limit has been upgraded
+// already, so it is closed with CloseRateLimited.
+func TestJoinOverGameLimit(t *testing.T) {
+	withConfig(t, func(c *config.Config) {
+		c.MaxGamesPerIP = 1
+		c.GamesPerIPWindow = time.Minute
+	})
+	untracked(t, "198.51.100.8")
+	id := unusedGameID()
+	r := gameRequest(id, "")
+	r.RemoteAddr = "198.51.100.8:4000"
+	if _, ok := allowIPGame(r, "198.51.100.8", time.Now()); !ok {
+		t.Fatal("first game refused")
+	}
+
+	c := newFakeConn()
+	if p := join(c, r, ""); p != nil {
+		t.Fatal("joined a game over the limit")
+	}
+	if msg := <-c.msgs; msg.Code != "rate_limited" {
+		t.Errorf("refused with %+v, want rate_limited", msg)
+	}
+	if len(c.frames) != 1 || binary.BigEndian.Uint16(c.frames[0]) != protocol.CloseRateLimited || string(c.frames[0][2:]) != "rate_limited" {
+		t.Errorf("close frames %q, want CloseRateLimited with rate_limited", c.frames)
+	}
+	gamesMutex.RLock()
+	_, created := games[gameKey{config.DefaultTenant, id}]
+	gamesMutex.RUnlock()
+	if created {
+		t.Error("the game was created anyway")
+	}
+}
+
+// GET /admin/ips is served once, for the whole server, rather than per
+// tenant.
+func TestListIPsRoute(t *testing.T) {
+	old := adminToken
+	adminToken = "test-admin"
+	t.Cleanup(func() { adminToken = old })
+	router := NewRouter()
+	for path, want := range map[string]int{"/admin/ips": http.StatusOK, "/t/acme/admin/ips": http.StatusNotFound} {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Authorization", "Bearer test-admin")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Errorf("GET %s: %d, want %d", path, w.Code, want)
+		}
+	}
+}
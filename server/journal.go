@@ -0,0 +1,133 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Event Journal ---
+
+// Every game keeps a journal of its last journalSize happenings for
+// support to read when a game got stuck: joins and leaves, each inbound
+// message with how it was handled, each broadcast, timers firing, and
+// rounds and series starting and ending. GET
+// /admin/games/{game_id}/journal serves it, oldest first. An entry is a
+// summary of a few short strings, never a board or a whole message, and
+// goes into a ring allocated with the game, so journaling costs a copy. The
+// journal has its own lock, so any goroutine can write to it. When an
+// admin tears a game down, or a write to one of its connections fails, the
+// log line carries the journal's last journalLogTail entries.
+
+const (
+	journalSize    = 200
+	journalLogTail = 20
+)
+
+// Kinds of journal entry.
+const (
+	journalJoin      = "join"
+	journalLeave     = "leave"
+	journalInbound   = "inbound"   // What is the event, Detail how it was handled
+	journalBroadcast = "broadcast" // What is the event
+	journalTimer     = "timer"     // What is the timer that fired
+	journalState     = "state"     // What is the transition
+)
+
+type journalEntry struct {
+	At           time.Time `json:"at"`
+	Kind         string    `json:"kind"`
+	What         string    `json:"what"`
+	Who          string    `json:"who,omitempty"`    // The seat's symbol, or a spectator's participant ID
+	Detail       string    `json:"detail,omitempty"` // An outcome code, a result or a reason
+	StateVersion uint64    `json:"state_version,omitempty"`
+}
+
+func (e journalEntry) String() string {
+	s := e.At.Format("15:04:05.000") + " " + e.Kind + " " + e.What
+	if e.Who != "" {
+		s += " by " + e.Who
+	}
+	if e.Detail != "" {
+		s += ": " + e.Detail
+	}
+	if e.StateVersion != 0 {
+		s += fmt.Sprintf(" (v%d)", e.StateVersion)
+	}
+	return s
+}
+
+// journal is a fixed ring of entries; the zero value is ready to use.
+type journal struct {
+	mu      sync.Mutex
+	entries [journalSize]journalEntry
+	total   uint64 // Entries ever added; the next goes at total % journalSize
+}
+
+// add records e, stamped now, over the oldest entry once the ring is full.
+func (j *journal) add(e journalEntry) {
+	e.At = time.Now().UTC()
+	j.mu.Lock()
+	j.entries[j.total%journalSize] = e
+	j.total++
+	j.mu.Unlock()
+}
+
+// tail is the latest n entries, oldest first, and how many were ever added.
+func (j *journal) tail(n int) ([]journalEntry, uint64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	n = int(min(uint64(n), j.total, journalSize))
+	out := make([]journalEntry, n)
+	for i := range out {
+		out[i] = j.entries[(j.total-uint64(n)+uint64(i))%journalSize]
+	}
+	return out, j.total
+}
+
+// logTail is the latest entries, one per line, for a log attribute.
+func (j *journal) logTail() string {
+	entries, _ := j.tail(journalLogTail)
+	lines := make([]string, len(entries))
+	for i, e := range entries {
+		lines[i] = e.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (j *journal) timer(name string) {
+	j.add(journalEntry{Kind: journalTimer, What: name})
+}
+
+func (j *journal) state(what, detail string) {
+	j.add(journalEntry{Kind: journalState, What: what, Detail: detail})
+}
+
+// journalName is how p appears in journal entries.
+func (p *Player) journalName() string {
+	if symbol := p.seatNow().Symbol; symbol != "" {
+		return symbol
+	}
+	return p.ID
+}
+
+type journalView struct {
+	GameID  string         `json:"game_id"`
+	Total   uint64         `json:"total"` // Entries ever recorded; only the latest are kept
+	Entries []journalEntry `json:"entries"`
+}
+
+// getJournal serves a game's journal.
+func getJournal(w http.ResponseWriter, r *http.Request) {
+	gamesMutex.RLock()
+	game, exists := games[requestGameKey(r)]
+	gamesMutex.RUnlock()
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "game_not_found")
+		return
+	}
+	entries, total := game.journal.tail(journalSize)
+	writeJSON(w, http.StatusOK, journalView{GameID: game.ID, Total: total, Entries: entries})
+}
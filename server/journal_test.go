@@ -0,0 +1,36 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Once the ring is full each entry goes over the oldest, and tail still
+// reads the latest, oldest first.
+func TestJournalWraps(t *testing.T) {
+	var j journal
+	if entries, total := j.tail(journalSize); len(entries) != 0 || total != 0 {
+		t.Fatalf("empty journal: %d entries of %d, want none", len(entries), total)
+	}
+	for i := 0; i < journalSize+5; i++ {
+		j.add(journalEntry{Kind: journalInbound, What: strconv.Itoa(i)})
+	}
+
+	entries, total := j.tail(journalSize + 10)
+	if total != journalSize+5 || len(entries) != journalSize {
+		t.Fatalf("tail after %d adds: %d entries of %d, want the %d kept", journalSize+5, len(entries), total, journalSize)
+	}
+	for i, e := range entries {
+		if want := strconv.Itoa(i + 5); e.What != want {
+			t.Fatalf("entry %d is %s, want %s", i, e.What, want)
+		}
+	}
+	if entries, _ := j.tail(3); len(entries) != 3 || entries[0].What != strconv.Itoa(journalSize+2) || entries[2].What != strconv.Itoa(journalSize+4) {
+		t.Errorf("tail(3) = %v, want the last three in order", entries)
+	}
+	lines := strings.Split(j.logTail(), "\n")
+	if len(lines) != journalLogTail || !strings.Contains(lines[len(lines)-1], " inbound "+strconv.Itoa(journalSize+4)) {
+		t.Errorf("logTail ends %q in %d lines, want the latest entry in %d", lines[len(lines)-1], len(lines), journalLogTail)
+	}
+}
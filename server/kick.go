@@ -0,0 +1,97 @@
+package server
+
+import "tictactoe/protocol"
+
+// --- Kicks ---
+
+// The first player to take a seat is the game's host, and the host may send
+// kick to remove a disruptive opponent or spectator: target is the seat's
+// symbol or the spectator's participant ID. The target hears kicked and is
+// closed with CloseKicked. A kicked player leaves as any player would, with
+// opponent_left and the seat open to whoever comes next, except that the
+// seat isn't held for them and their token stops working. With ban, the
+// target's address and client ID are also kept out of the game for the
+// rest of its life, in memory only. When the host leaves, the first
+// remaining player becomes host and everyone hears host_changed. Anyone
+// else sending kick gets forbidden.
+
+// assignHost makes p the host if the game has none. Runs on the game's
+// loop.
+func (game *Game) assignHost(p *Player) {
+	if game.Host == "" {
+		game.Host = p.Symbol
+	}
+}
+
+// passHost hands the host role on from p, who is leaving, to the first
+// remaining player, or leaves it for the next to sit down. Runs on the game's
+// loop.
+func (game *Game) passHost(p *Player) {
+	if game.Host != p.Symbol {
+		return
+	}
+	game.Host = ""
+	if len(game.Players) == 0 {
+		return
+	}
+	next := game.Players[0]
+	game.Host = next.Symbol
+	broadcast(game, OutboundMessage{Event: protocol.EventHostChanged, Player: next.Symbol, From: next.participant(), Code: "host_changed"})
+}
+
+// handleKick runs p's kick of target, banning them too if ban is set.
+// Runs on the game's loop.
+func (game *Game) handleKick(p *Player, target string, ban bool) {
+	if p.Symbol != game.Host {
+		p.send(localize(p.locale(), protocol.Failure("forbidden", "only the game's host can kick")))
+		return
+	}
+	var victim *Player
+	for _, other := range game.connections() {
+		if other != p && (other.Role == RolePlayer && other.Symbol == target || other.Role == RoleSpectator && other.ID == target) {
+			victim = other
+			break
+		}
+	}
+	if victim == nil {
+		p.send(localize(p.locale(), protocol.Failure("target_not_found", "")))
+		return
+	}
+	game.kick(victim, ban)
+}
+
+// kick closes victim's connection, with a ban if ban is set. Its leave
+// then frees the seat. Runs on the game's loop.
+func (game *Game) kick(victim *Player, ban bool) {
+	code := "kicked"
+	if ban {
+		code = "banned_from_game"
+		if game.KickBans == nil {
+			game.KickBans = make(map[string]bool)
+		}
+		game.KickBans["ip:"+victim.IP] = true
+		if victim.Identity != "" {
+			game.KickBans["id:"+victim.Identity] = true
+		}
+	}
+	victim.logger().Info("participant kicked", "ban", ban)
+	game.remove(victim, code)
+}
+
+// remove closes victim's connection with CloseKicked, telling it code: its
+// seat isn't held for it and its token stops working. Runs on the game's
+// loop.
+func (game *Game) remove(victim *Player, code string) {
+	victim.kicked = true
+	if victim.Role == RolePlayer {
+		game.SeatEpochs[victim.Symbol]++ // Their token no longer reclaims the seat
+	}
+	victim.send(localize(victim.locale(), protocol.Notice(protocol.EventKicked, code)))
+	victim.closeAfterFlush(protocol.CloseKicked, code)
+}
+
+// kickBanned reports whether the host banned ip or identity from the game.
+// Runs on the game's loop.
+func (game *Game) kickBanned(ip, identity string) bool {
+	return game.KickBans["ip:"+ip] || identity != "" && game.KickBans["id:"+identity]
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"tictactoe/protocol"
+)
+
+// --- Latency ---
+
+// Every cfg.PingInterval each connection gets a websocket ping and, for
+// clients that can't see those, such as a browser's script or an event
+// stream, a ping event with the same stamp as its nonce, to answer with a
+// pong. Whichever answer comes back first is the round trip, folded into a
+// moving average, and every latencyInterval the game broadcasts each
+// player's as latency for the UIs to show. The samples also feed the
+// xo_rtt_* metrics. Any answer, or any message at all, counts as the
+// connection being alive; see health.go.
+
+const (
+	latencyInterval = 10 * time.Second
+	rttSmoothing    = 0.3 // Weight of the newest pong in the moving average
+)
+
+// ping sends a ping, both ways, stamped with the send time; the pong
+// echoes it back. It runs on the write pump.
+func (p *Player) ping() error {
+	now := time.Now()
+	stamp := strconv.FormatInt(now.UnixNano(), 10)
+	p.pingSent.Store(now.UnixNano())
+	p.unanswered.Add(1)
+	if err := p.Conn.Ping(stamp); err != nil {
+		return err
+	}
+	p.send(OutboundMessage{Event: protocol.EventPing, Nonce: stamp, ServerTS: now.UnixMilli()})
+	return nil
+}
+
+// handlePong folds the round trip of an echoed ping into the player's
+// moving average, if it is the first answer to the latest. It runs on the
+// read goroutine.
+func (p *Player) handlePong(data string) error {
+	sent, err := strconv.ParseInt(data, 10, 64)
+	if err != nil || !p.pingSent.CompareAndSwap(sent, 0) {
+		p.heard()
+		return nil // Not our latest ping, or already answered
+	}
+	sample := time.Since(time.Unix(0, sent))
+	metrics.RTTSamples.Add(1)
+	metrics.RTTMicros.Add(sample.Microseconds())
+	if prev := time.Duration(p.rtt.Load()); prev > 0 {
+		sample = time.Duration(rttSmoothing*float64(sample) + (1-rttSmoothing)*float64(prev))
+	}
+	if sample <= 0 {
+		sample = 1
+	}
+	p.rtt.Store(int64(sample))
+	p.heard()
+	return nil
+}
+
+// latencyMS is the player's smoothed round trip in whole milliseconds,
+// rounded up so a measured connection never reads 0, or 0 before the first
+// pong.
+func (p *Player) latencyMS() int {
+	rtt := time.Duration(p.rtt.Load())
+	if rtt <= 0 {
+		return 0
+	}
+	return int((rtt + time.Millisecond - 1) / time.Millisecond)
+}
+
+// latencies maps symbol to round trip in milliseconds for players that
+// have answered a ping. Runs on the game's loop.
+func (game *Game) latencies() map[string]int {
+	out := make(map[string]int)
+	for _, p := range game.Players {
+		if ms := p.latencyMS(); ms > 0 {
+			out[p.Symbol] = ms
+		}
+	}
+	return out
+}
+
+func runLatencyReporter() {
+	go func() {
+		for range time.Tick(latencyInterval) {
+			for _, game := range liveGames() {
+				game.do(func() {
+					if l := game.latencies(); len(l) > 0 {
+						broadcast(game, OutboundMessage{Event: protocol.EventLatency, Latency: l})
+					}
+				})
+			}
+		}
+	}()
+}
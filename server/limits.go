@@ -0,0 +1,45 @@
+package server
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// --- Capacity Limits ---
+
+// -max-games caps the live games across all tenants and -max-connections
+// the open websockets, so a small host sheds load with server_full instead
+// of running out of memory. Games and connections already in place are
+// never affected; only new ones are refused.
+
+// openConns counts the websocket handlers holding a connection slot.
+var openConns atomic.Int64
+
+// gameLimitCode is the error code refusing a new game in tenant, or "" if
+// it may be created. Caller must hold gamesMutex.
+func gameLimitCode(tenant string) string {
+	if cfg.MaxGames > 0 && len(games) >= cfg.MaxGames {
+		return "server_full"
+	}
+	if tenantFull(tenant) {
+		return "tenant_full"
+	}
+	return ""
+}
+
+// limitConnections refuses a websocket beyond cfg.MaxConnections with a 503
+// before upgrading it, and one beyond the client IP's share with a 429;
+// see iplimits.go. The slot is held until the handler returns, which for
+// every websocket route is when the connection closes.
+func limitConnections(next http.HandlerFunc) http.HandlerFunc {
+	next = limitIPConnections(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := openConns.Add(1)
+		defer openConns.Add(-1)
+		if cfg.MaxConnections > 0 && n > int64(cfg.MaxConnections) {
+			writeError(w, r, http.StatusServiceUnavailable, "server_full")
+			return
+		}
+		next(w, r)
+	}
+}
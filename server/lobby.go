@@ -0,0 +1,246 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"tictactoe/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// --- Public Lobby ---
+
+// A game created with "public" is listed in its tenant's lobby while one
+// player waits in it for an opponent. Games are private unless created that
+// way, so a game made by opening a /ws/ URL never shows up for strangers.
+// GET /lobby lists the waiting games, and /lobby/ws pushes the list again as
+// a lobby_update whenever it may have changed.
+
+// lobbyMax caps the listing, newest games first.
+const lobbyMax = 100
+
+type lobbyGame struct {
+	GameID    string    `json:"game_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name,omitempty"` // The waiting player's display name, if they gave one
+	Symbol    string    `json:"symbol"`         // Seat the waiting player holds
+	Size      int       `json:"size"`
+	WSURL     string    `json:"ws_url"`
+	Private   bool      `json:"private,omitempty"` // Joining needs the game's password
+}
+
+type lobbyUpdate struct {
+	Event protocol.Event `json:"event"`
+	Games []lobbyGame    `json:"games"`
+}
+
+// lobbySub is one lobby socket, fed its tenant's listing.
+type lobbySub struct {
+	tenant  string
+	updates chan []lobbyGame
+}
+
+var lobby = struct {
+	sync.Mutex
+	subs  map[*lobbySub]struct{}
+	dirty map[string]bool // Tenants whose listing changed since the last push
+	wake  chan struct{}
+}{
+	subs:  make(map[*lobbySub]struct{}),
+	dirty: make(map[string]bool),
+	wake:  make(chan struct{}, 1),
+}
+
+// listLobby serves GET /lobby.
+func listLobby(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, lobbyListing(requestTenant(r)))
+}
+
+// lobbyListing is tenant's public games with one player waiting, newest
+// first. It sends each game a command in turn, so it must not run on any
+// game's loop.
+func lobbyListing(tenant string) []lobbyGame {
+	out := []lobbyGame{}
+	for _, game := range liveGames() {
+		if game.Tenant != tenant {
+			continue
+		}
+		game.do(func() {
+			if game.Public && !game.closed && len(game.Players) > 0 && len(game.openSeats()) > 0 {
+				p := game.Players[0]
+				out = append(out, lobbyGame{
+					GameID:    game.ID,
+					CreatedAt: game.CreatedAt.UTC(),
+					Name:      p.Name,
+					Symbol:    p.Symbol,
+					Size:      game.Board.Size(),
+					WSURL:     cfg.BasePath + tenantPrefix(tenant) + "/ws/" + game.ID,
+					Private:   game.private(),
+				})
+			}
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].GameID < out[j].GameID
+	})
+	if len(out) > lobbyMax {
+		out = out[:lobbyMax]
+	}
+	return out
+}
+
+// lobbyChanged marks the game's tenant for a lobby_update if the game is
+// public. The push happens on runLobby's goroutine, since building the
+// listing waits on every game's loop. Runs on the game's loop.
+func (game *Game) lobbyChanged() {
+	if !game.Public {
+		return
+	}
+	lobby.Lock()
+	lobby.dirty[game.Tenant] = true
+	lobby.Unlock()
+	select {
+	case lobby.wake <- struct{}{}:
+	default: // A push is already due and will see this change
+	}
+}
+
+// runLobby pushes fresh listings to the lobby sockets of every tenant
+// marked by lobbyChanged.
+func runLobby() {
+	go func() {
+		for range lobby.wake {
+			lobby.Lock()
+			var tenants []string
+			for tenant := range lobby.dirty {
+				tenants = append(tenants, tenant)
+			}
+			lobby.dirty = make(map[string]bool)
+			lobby.Unlock()
+
+			for _, tenant := range tenants {
+				if !lobbyWatched(tenant) {
+					continue
+				}
+				listing := lobbyListing(tenant)
+				lobby.Lock()
+				for sub := range lobby.subs {
+					if sub.tenant != tenant {
+						continue
+					}
+					select {
+					case sub.updates <- listing:
+					default:
+						// Behind by a whole queue of listings; it reconnects for a fresh one
+						delete(lobby.subs, sub)
+						close(sub.updates)
+					}
+				}
+				lobby.Unlock()
+			}
+		}
+	}()
+}
+
+// lobbyWatched reports whether anyone has tenant's lobby open.
+func lobbyWatched(tenant string) bool {
+	lobby.Lock()
+	defer lobby.Unlock()
+	for sub := range lobby.subs {
+		if sub.tenant == tenant {
+			return true
+		}
+	}
+	return false
+}
+
+func unsubscribeLobby(sub *lobbySub) {
+	lobby.Lock()
+	defer lobby.Unlock()
+	if _, ok := lobby.subs[sub]; ok {
+		delete(lobby.subs, sub)
+		close(sub.updates)
+	}
+}
+
+// closeLobby ends every lobby socket, for shutdown.
+func closeLobby() {
+	lobby.Lock()
+	defer lobby.Unlock()
+	for sub := range lobby.subs {
+		delete(lobby.subs, sub)
+		close(sub.updates)
+	}
+}
+
+// lobbySocket serves /lobby/ws: the tenant's listing on connect, then again
+// on every change. Anything the client sends is ignored.
+func lobbySocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Warn("websocket upgrade failed", "path", r.URL.Path, "remote", logRemote(r), "err", err)
+		metrics.UpgradeFailures.Add(1)
+		return
+	}
+	defer ws.Close()
+	defer trackSocket(ws, r)()
+	metrics.Connections.Add(1)
+	defer metrics.Connections.Add(-1)
+
+	sub := &lobbySub{tenant: requestTenant(r), updates: make(chan []lobbyGame, cfg.SendQueueDepth)}
+	lobby.Lock()
+	lobby.subs[sub] = struct{}{}
+	lobby.Unlock()
+	defer unsubscribeLobby(sub)
+
+	ws.SetReadLimit(maxInboundSize)
+	ws.SetReadDeadline(time.Now().Add(readTimeout()))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(readTimeout()))
+	})
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(games []lobbyGame) error {
+		ws.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+		return ws.WriteJSON(lobbyUpdate{Event: protocol.EventLobbyUpdate, Games: games})
+	}
+	if err := write(lobbyListing(sub.tenant)); err != nil {
+		return
+	}
+	ticker := time.NewTicker(cfg.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case games, ok := <-sub.updates:
+			if !ok {
+				msg := websocket.FormatCloseMessage(protocol.CloseShutdown, "lobby closed")
+				ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+				return
+			}
+			if err := write(games); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(cfg.WriteTimeout)); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
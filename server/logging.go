@@ -0,0 +1,37 @@
+package server
+
+import (
+	"log/slog"
+	"os"
+
+	"tictactoe/config"
+)
+
+// --- Logging ---
+
+// Log lines are a short message plus attributes. Anything about a game
+// carries its game_id, and anything about a connection also its player_id,
+// symbol and remote address, so one game's story can be filtered out of a
+// busy server's log.
+
+// setupLogging installs the process logger for c's -log-level and
+// -log-format. The standard log package writes through it too.
+func setupLogging(c config.Config) {
+	opts := &slog.HandlerOptions{Level: c.LogLevel}
+	var h slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	if c.LogFormat == "json" {
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+// logger is the game's logger. ID and Tenant are fixed once the game is
+// registered, so it needs no lock.
+func (game *Game) logger() *slog.Logger {
+	return slog.With("game_id", game.ID, "tenant", game.Tenant)
+}
+
+// logger is p's logger: its game's, plus the connection.
+func (p *Player) logger() *slog.Logger {
+	return p.game.logger().With("player_id", p.ID, "symbol", p.seatNow().Symbol, "remote", p.Remote)
+}
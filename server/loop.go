@@ -0,0 +1,92 @@
+package server
+
+import "sync"
+
+// --- Game Loop ---
+
+// Each game's state belongs to one goroutine, its loop, which runs the
+// commands sent to it one at a time, in the order they arrive: joins and
+// leaves, moves and every other inbound event, timers as they fire, admin
+// actions and the REST handlers' reads. Nothing else touches the state,
+// so a command sees it as the last one left it and needs no lock. A
+// command only works in memory: messages go on each player's send queue
+// and out through that player's write pump (see outbox.go), and store
+// writes go on the game's own queue (see storewrites.go), so neither a
+// slow client nor a slow store holds up the commands behind it.
+//
+// A command must not send a command of its own to the same game, which
+// would wait on itself, and nothing may send one while holding
+// gamesMutex, which commands take. Functions documented "Runs on the
+// game's loop" are only ever called from a command.
+//
+// The loop starts with the first command and ends once the game is
+// deleted. Commands sent after that, by a connection still on its way out
+// or a timer that fired as the game went, run on the sender's goroutine
+// instead, still one at a time.
+
+// gameLoop is the goroutine that runs a game's commands. The zero value is
+// ready to use.
+type gameLoop struct {
+	once     sync.Once
+	commands chan func()
+	stop     chan struct{} // Closed by stopLoop
+	done     chan struct{} // Closed once the loop has run its last command
+	after    sync.Mutex    // Serializes the commands that come after
+}
+
+// start makes the loop's channels and runs it, the first time only.
+func (l *gameLoop) start() {
+	l.once.Do(func() {
+		l.commands = make(chan func())
+		l.stop = make(chan struct{})
+		l.done = make(chan struct{})
+		go l.run()
+	})
+}
+
+func (l *gameLoop) run() {
+	defer close(l.done)
+	for {
+		select {
+		case cmd := <-l.commands:
+			cmd()
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// do runs fn on the game's loop and waits for it to finish. A panic in fn
+// is raised again in the caller, as though fn had run there, and the loop
+// carries on.
+func (game *Game) do(fn func()) {
+	l := &game.loop
+	l.start()
+	ran := make(chan interface{}, 1)
+	cmd := func() {
+		defer func() { ran <- recover() }()
+		fn()
+	}
+	select {
+	case l.commands <- cmd:
+		if p := <-ran; p != nil {
+			panic(p)
+		}
+	case <-l.done:
+		l.after.Lock()
+		defer l.after.Unlock()
+		fn()
+	}
+}
+
+// stopLoop ends the game's loop once the command running now returns.
+// Runs on the game's loop.
+func (game *Game) stopLoop() {
+	l := &game.loop
+	l.start()
+	select {
+	case <-l.stop:
+	default:
+		close(l.stop)
+	}
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tictactoe/config"
+	"tictactoe/protocol"
+)
+
+// A panic in a command reaches the caller, and the loop goes on to the
+// next one. Once the loop has stopped, commands still run, one at a time.
+func TestGameLoop(t *testing.T) {
+	game := newGame(unusedGameID())
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("recovered %v, want the command's panic", p)
+			}
+		}()
+		game.do(func() { panic("boom") })
+	}()
+	responsive(t, game)
+
+	game.do(game.stopLoop)
+	select {
+	case <-game.loop.done:
+	case <-time.After(time.Second):
+		t.Fatal("the loop didn't stop")
+	}
+	var wg sync.WaitGroup
+	n := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			game.do(func() { n++ })
+		}()
+	}
+	wg.Wait()
+	if n != 100 {
+		t.Errorf("%d commands ran after the loop stopped, want 100", n)
+	}
+}
+
+// Clients joining one game, moving and leaving all at once, with nothing
+// held for the ones that leave, never leave it in a state it can't reach
+// one command at a time. Run with -race, this is also where a field read
+// off the game's loop shows up.
+func TestInterleavedJoinLeaveMove(t *testing.T) {
+	withConfig(t, func(c *config.Config) {
+		c.StartCountdown = 0
+		c.ReconnectGrace = 0
+	})
+	id := unusedGameID()
+	key := gameKey{config.DefaultTenant, id}
+	check := func(game *Game) {
+		if len(game.Players) > 2 {
+			t.Errorf("%d players seated", len(game.Players))
+		}
+		seen := map[string]bool{}
+		for _, p := range game.Players {
+			if p.Role != RolePlayer || !game.isSymbol(p.Symbol) || seen[p.Symbol] {
+				t.Errorf("seated %s as %q alongside %v", p.Role, p.Symbol, seen)
+			}
+			seen[p.Symbol] = true
+		}
+		marks := map[string]int{}
+		for _, row := range game.Board {
+			for _, cell := range row {
+				if cell != "" {
+					marks[cell]++
+				}
+			}
+		}
+		if d := marks["X"] - marks["O"]; d < -1 || d > 1 || marks["X"]+marks["O"] != len(game.Moves) {
+			t.Errorf("board with %v marks after %d moves", marks, len(game.Moves))
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for j := 0; j < 25; j++ {
+				c := newFakeConn()
+				go func() {
+					for {
+						select {
+						case <-c.msgs:
+						case <-c.closed:
+							return
+						}
+					}
+				}()
+				p := join(c, gameRequest(id, ""), "")
+				if p == nil {
+					c.Close()
+					continue
+				}
+				for k := rng.Intn(4); k > 0; k-- {
+					move := fmt.Sprintf(`{"event":"make_move","row":%d,"col":%d}`, rng.Intn(3), rng.Intn(3))
+					p.receive([]byte(move), newFlood(), gameRequest(id, ""))
+				}
+				c.Close()
+				p.leave()
+			}
+		}(int64(i))
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for {
+		gamesMutex.RLock()
+		game := games[key]
+		gamesMutex.RUnlock()
+		if game != nil {
+			game.do(func() { check(game) })
+		}
+		select {
+		case <-done:
+			if game != nil {
+				game.do(func() {
+					if len(game.Players) != 0 {
+						t.Errorf("%d players still seated once everyone left", len(game.Players))
+					}
+				})
+			}
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// drawnRound is a full round that no one wins, as cells for the starter and
+// the other player in turn.
+var drawnRound = [9][2]int{{0, 0}, {0, 1}, {0, 2}, {1, 1}, {1, 0}, {1, 2}, {2, 1}, {2, 0}, {2, 2}}
+
+// benchTable is a game with both seats taken, for a benchmark to play in.
+type benchTable struct {
+	id      string
+	players map[string]*Player
+	conns   map[string]*fakeConn
+	starter string
+}
+
+func newBenchTable(b *testing.B) *benchTable {
+	id := unusedGameID()
+	x, xc := joinFake(b, id, "")
+	o, oc := joinFake(b, id, "")
+	start := xc.expect(b, protocol.EventStartGame)
+	oc.expect(b, protocol.EventStartGame)
+	return &benchTable{
+		id:      id,
+		players: map[string]*Player{x.Symbol: x, o.Symbol: o},
+		conns:   map[string]*fakeConn{x.Symbol: xc, o.Symbol: oc},
+		starter: start.CurrentPlayer,
+	}
+}
+
+// playRound plays a drawn round, or as many of its moves as budget allows,
+// timing each from the mover's make_move to the opponent's move. It
+// starts the next round with a rematch if it played the whole one.
+func (tb *benchTable) playRound(b *testing.B, budget *atomic.Int64, latency *atomic.Int64) bool {
+	symbols := []string{tb.starter, "X"}
+	if tb.starter == "X" {
+		symbols[1] = "O"
+	}
+	for i, cell := range drawnRound {
+		if budget.Add(-1) < 0 {
+			return false
+		}
+		mover, other := symbols[i%2], symbols[(i+1)%2]
+		event := protocol.EventMove
+		if i == len(drawnRound)-1 {
+			event = protocol.EventDraw // The last move is sent as the result
+		}
+		start := time.Now()
+		tb.players[mover].receive([]byte(fmt.Sprintf(`{"event":"make_move","row":%d,"col":%d}`, cell[0], cell[1])), newFlood(), gameRequest(tb.id, ""))
+		tb.conns[other].expect(b, event)
+		latency.Add(int64(time.Since(start)))
+		tb.conns[mover].expect(b, event)
+	}
+	for _, p := range tb.players {
+		p.receive([]byte(`{"event":"rematch_request"}`), newFlood(), gameRequest(tb.id, ""))
+	}
+	for _, c := range tb.conns {
+		tb.starter = c.expect(b, protocol.EventNewGame).CurrentPlayer
+	}
+	return true
+}
+
+// BenchmarkMove times moves played in concurrent games, each from the
+// make_move arriving to the opponent being sent the move. ns/op is the
+// throughput over every game; latency-ns is the mean time for one move.
+func BenchmarkMove(b *testing.B) {
+	for _, n := range []int{1, 16, 256} {
+		b.Run(fmt.Sprintf("games=%d", n), func(b *testing.B) {
+			old := cfg
+			cfg.StartCountdown = 0
+			b.Cleanup(func() { cfg = old })
+			tables := make([]*benchTable, n)
+			for i := range tables {
+				tables[i] = newBenchTable(b)
+			}
+			var budget, latency atomic.Int64
+			budget.Store(int64(b.N))
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			for _, tb := range tables {
+				wg.Add(1)
+				go func(tb *benchTable) {
+					defer wg.Done()
+					for tb.playRound(b, &budget, &latency) {
+					}
+				}(tb)
+			}
+			wg.Wait()
+			b.StopTimer()
+			b.ReportMetric(float64(latency.Load())/float64(b.N), "latency-ns")
+		})
+	}
+}
+
+// A seat changing hands on the loop, as swap_seats does, doesn't race with
+// what reads the player's symbol off it: the journal entry and log lines
+// for a message refused before it reaches the loop.
+func TestSeatChangeOffLoop(t *testing.T) {
+	quickGames(t)
+	id := unusedGameID()
+	x, xc := joinFake(t, id, "")
+	_, oc := joinFake(t, id, "")
+	xc.expect(t, protocol.EventStartGame)
+	oc.expect(t, protocol.EventStartGame)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			x.game.do(x.game.swapSeats)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		x.receive([]byte(`{"event":"no_such_event"}`), newFlood(), gameRequest(id, ""))
+	}
+	<-done
+}
+
+// A spectator that claims a seat shows up under its new symbol in what
+// reads its seat off the loop.
+func TestSeatCopyFollowsClaim(t *testing.T) {
+	withConfig(t, func(c *config.Config) {
+		c.StartCountdown = 0
+		c.ReconnectGrace = 0 // Opens the seat as soon as O leaves
+	})
+	id := unusedGameID()
+	_, xc := joinFake(t, id, "")
+	o, oc := joinFake(t, id, "")
+	s, _ := joinFake(t, id, "spectate=1")
+	if got := s.seatNow(); got != (seatCopy{Role: RoleSpectator}) {
+		t.Fatalf("spectator's seat %+v, want an audience spot", got)
+	}
+	symbol := o.Symbol
+	oc.Close()
+	xc.expect(t, protocol.EventOpponentLeft)
+
+	s.receive([]byte(`{"event":"claim_seat"}`), newFlood(), gameRequest(id, "spectate=1"))
+	if got := s.seatNow(); got != (seatCopy{Symbol: symbol, Role: RolePlayer}) {
+		t.Errorf("seat after claim_seat %+v, want %s as a player", got, symbol)
+	}
+	if name := s.journalName(); name != symbol {
+		t.Errorf("journaled as %q, want %s", name, symbol)
+	}
+}
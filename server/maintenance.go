@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+)
+
+// --- Maintenance Mode ---
+
+// maintenance stops new games from starting while existing ones, including
+// their rematches, play on, so a deploy can wait for the server to empty.
+var maintenance atomic.Bool
+
+// rejectMaintenance refuses game creation and imports in maintenance mode.
+func rejectMaintenance(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if maintenance.Load() {
+			writeError(w, r, http.StatusServiceUnavailable, "maintenance")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// rejectMaintenanceJoin lets a websocket through in maintenance mode only if
+// it reclaims a seat in a game that already exists.
+func rejectMaintenanceJoin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if maintenance.Load() && !holdsSeat(requestGameKey(r), r.URL.Query().Get("token")) {
+			writeError(w, r, http.StatusServiceUnavailable, "maintenance")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// holdsSeat reports whether token belongs to a seated or reserved player of
+// the game.
+func holdsSeat(key gameKey, token string) bool {
+	if token == "" {
+		return false
+	}
+	gamesMutex.RLock()
+	game, exists := games[key]
+	gamesMutex.RUnlock()
+	if !exists {
+		return false
+	}
+	holds := false
+	game.do(func() {
+		for _, t := range game.Reserved {
+			if t == token {
+				holds = true
+				return
+			}
+		}
+		_, err := verifySeatToken(game, token)
+		holds = err == nil
+	})
+	return holds
+}
+
+func setMaintenance(on bool) {
+	if maintenance.Swap(on) != on {
+		slog.Info("maintenance mode", "enabled", on)
+	}
+}
+
+// toggleMaintenanceOnSignal flips maintenance mode on every SIGUSR1.
+func toggleMaintenanceOnSignal() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGUSR1)
+	go func() {
+		for range sig {
+			setMaintenance(!maintenance.Load())
+		}
+	}()
+}
+
+type maintenanceStatus struct {
+	Enabled bool `json:"enabled"`
+	Games   int  `json:"games"`   // Live games still in progress
+	Players int  `json:"players"` // Connected players across them
+}
+
+func currentMaintenance() maintenanceStatus {
+	st := maintenanceStatus{Enabled: maintenance.Load()}
+	for _, game := range liveGames() {
+		game.do(func() {
+			st.Games++
+			st.Players += len(game.Players)
+		})
+	}
+	return st
+}
+
+func getMaintenance(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, currentMaintenance())
+}
+
+// postMaintenance sets maintenance mode from {"enabled": bool}, or toggles
+// it when the body is empty.
+func postMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, r, http.StatusBadRequest, "invalid_body")
+		return
+	}
+	on := !maintenance.Load()
+	if req.Enabled != nil {
+		on = *req.Enabled
+	}
+	setMaintenance(on)
+	audit(r, "maintenance", "", strconv.FormatBool(on))
+	writeJSON(w, http.StatusOK, currentMaintenance())
+}
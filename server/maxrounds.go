@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// --- Round-Limited Series ---
+
+// A game created with max_rounds plays a series of exactly that many
+// rounds, wins and draws alike, rather than one decided by a win count as
+// with best_of. Rounds follow each other by rematch as usual. Once the last
+// has finished, series_summary gives the final score, every round's
+// result, how long the series took and who won it, or "tied" if no one
+// leads; from then moves and rematches are refused until both players send
+// new_series. The count of rounds played is kept with the game's state and
+// comes with start_game, new_game and state_sync.
+
+// maxMaxRounds is the longest round-limited series a game can be created
+// with.
+const maxMaxRounds = 100
+
+// maxRoundsRules checks req's max_rounds.
+func maxRoundsRules(req createGameRequest) error {
+	switch {
+	case req.MaxRounds < 0 || req.MaxRounds > maxMaxRounds:
+		return fmt.Errorf("max_rounds must be from 1 to %d", maxMaxRounds)
+	case req.MaxRounds > 0 && req.BestOf > 0:
+		return fmt.Errorf("a game can't have both max_rounds and best_of")
+	}
+	return nil
+}
+
+// roundsUp reports whether a round-limited series has played all its
+// rounds. Runs on the game's loop.
+func (game *Game) roundsUp() bool {
+	return game.MaxRounds > 0 && game.SeriesRounds >= game.MaxRounds
+}
+
+// roundLimit fills in msg's round limit and the rounds played, for a game
+// that has one. Runs on the game's loop.
+func (game *Game) roundLimit(msg *OutboundMessage) {
+	if game.MaxRounds == 0 {
+		return
+	}
+	played := game.SeriesRounds
+	msg.MaxRounds, msg.RoundsPlayed = game.MaxRounds, &played
+}
+
+// summarizeSeries announces series_summary for a round-limited series
+// that just played its last round. Runs on the game's loop.
+func (game *Game) summarizeSeries() {
+	wins := make(map[string]int)
+	for _, symbol := range game.symbols() {
+		wins[symbol] = game.Score.Of(symbol)
+	}
+	winner := engine.Leader(wins)
+	result := winner
+	if result == "" {
+		result = "tied"
+	}
+	msg := OutboundMessage{
+		Event:  protocol.EventSeriesSummary,
+		Player: winner,
+		Result: result,
+		Score:  &game.Score,
+		Code:   "series_summary",
+		Names:  game.playerNames(),
+		Rounds: game.RoundResults,
+	}
+	if !game.SeriesStartedAt.IsZero() {
+		msg.SeriesDurationMS = time.Since(game.SeriesStartedAt).Milliseconds()
+	}
+	game.roundLimit(&msg)
+	game.logger().Info("series finished", "result", result, "max_rounds", game.MaxRounds, "score_x", game.Score.X, "score_o", game.Score.O)
+	game.journal.state("series_over", result)
+	game.RematchRequests = make(map[string]bool)
+	broadcast(game, msg)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// --- Metrics ---
+
+// The counters are bumped where things happen, so a scrape never has to
+// take gamesMutex or wait on any game's loop.
+var metrics struct {
+	OutboundDropped   atomic.Int64
+	OutboundCoalesced atomic.Int64
+	SlowConsumers     atomic.Int64
+
+	Games           atomic.Int64
+	Connections     atomic.Int64
+	Moves           atomic.Int64
+	WinsX           atomic.Int64
+	WinsO           atomic.Int64
+	WinsThird       atomic.Int64
+	Draws           atomic.Int64
+	Rematches       atomic.Int64
+	WriteErrors     atomic.Int64
+	UpgradeFailures atomic.Int64
+	RateLimited     atomic.Int64
+	MovesRejected   atomic.Int64
+	SuspiciousFlags atomic.Int64
+	Resent          atomic.Int64
+	RTTSamples      atomic.Int64
+	RTTMicros       atomic.Int64
+	PingTimeouts    atomic.Int64
+	DormantGames    atomic.Int64
+	IPConnsRefused  atomic.Int64
+	IPGamesRefused  atomic.Int64
+}
+
+type metricDesc struct {
+	name, help, kind string
+	value            func() int64
+}
+
+func metricDescs() []metricDesc {
+	return []metricDesc{
+		{"xo_outbound_dropped_total", "Outbound messages dropped by the send queue overflow policy.", "counter", metrics.OutboundDropped.Load},
+		{"xo_outbound_coalesced_total", "Outbound board states superseded by a newer one while queued.", "counter", metrics.OutboundCoalesced.Load},
+		{"xo_slow_consumer_disconnects_total", "Connections closed because their send queue overflowed.", "counter", metrics.SlowConsumers.Load},
+		{"xo_active_games", "Games currently in the registry.", "gauge", metrics.Games.Load},
+		{"xo_dormant_games", "Games in the registry with nobody connected, kept for -empty-retention in case a player returns.", "gauge", metrics.DormantGames.Load},
+		{"xo_empty_retention_seconds", "How long a dormant game is kept before it is deleted, -empty-retention.", "gauge", func() int64 { return int64(cfg.EmptyRetention / time.Second) }},
+		{"xo_active_connections", "Open websocket connections, game and lobby.", "gauge", metrics.Connections.Load},
+		{"xo_moves_total", "Moves made.", "counter", metrics.Moves.Load},
+		{"xo_wins_x_total", "Rounds won by X, on the board or on time.", "counter", metrics.WinsX.Load},
+		{"xo_wins_o_total", "Rounds won by O, on the board or on time.", "counter", metrics.WinsO.Load},
+		{"xo_wins_third_total", "Rounds won by the third player of a three-player game.", "counter", metrics.WinsThird.Load},
+		{"xo_draws_total", "Rounds drawn.", "counter", metrics.Draws.Load},
+		{"xo_rematches_total", "Rematches agreed by both players.", "counter", metrics.Rematches.Load},
+		{"xo_broadcast_errors_total", "Failed writes to a connection, each dropping it.", "counter", metrics.WriteErrors.Load},
+		{"xo_ws_upgrade_failures_total", "Websocket upgrade requests that failed.", "counter", metrics.UpgradeFailures.Load},
+		{"xo_rate_limited_total", "Inbound websocket messages refused for exceeding the rate limit.", "counter", metrics.RateLimited.Load},
+		{"xo_moves_rejected_total", "make_move messages refused, for any reason.", "counter", metrics.MovesRejected.Load},
+		{"xo_suspicious_flags_total", "Connections flagged for too many wrong-turn, taken-cell or too-fast moves in a round.", "counter", metrics.SuspiciousFlags.Load},
+		{"xo_messages_resent_total", "Broadcasts sent again to a connection for resend_from.", "counter", metrics.Resent.Load},
+		{"xo_rtt_samples_total", "Ping round trips measured.", "counter", metrics.RTTSamples.Load},
+		{"xo_rtt_microseconds_total", "Sum of the ping round trips measured, in microseconds.", "counter", metrics.RTTMicros.Load},
+		{"xo_tracked_ips", "Client IPs holding connections or recent games against the per-IP limits.", "gauge", trackedIPs},
+		{"xo_ip_connections_refused_total", "Websockets refused for exceeding -max-conns-per-ip.", "counter", metrics.IPConnsRefused.Load},
+		{"xo_ip_games_refused_total", "New games refused for exceeding -max-games-per-ip.", "counter", metrics.IPGamesRefused.Load},
+		{"xo_ping_timeout_disconnects_total", "Connections dropped for leaving their pings unanswered past -ping-timeout.", "counter", metrics.PingTimeouts.Load},
+	}
+}
+
+// serveMetrics writes the metrics in the Prometheus text exposition format.
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range metricDescs() {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", m.name, m.help, m.name, m.kind, m.name, m.value())
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrape is GET /metrics as name → value, failing the test on any line
+// out of the text exposition format: each sample preceded by its HELP and
+// TYPE, counters named _total, and no name twice.
+func scrape(t *testing.T) map[string]int64 {
+	t.Helper()
+	w := httptest.NewRecorder()
+	NewRouter().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4" {
+		t.Errorf("Content-Type %q, want text/plain; version=0.0.4", ct)
+	}
+	name := regexp.MustCompile(`^xo_[a-z0-9_]+$`)
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	if len(lines)%3 != 0 {
+		t.Fatalf("%d lines, want HELP, TYPE and a sample for each metric", len(lines))
+	}
+	values := map[string]int64{}
+	for i := 0; i < len(lines); i += 3 {
+		help, typ, sample := strings.Fields(lines[i]), strings.Fields(lines[i+1]), strings.Fields(lines[i+2])
+		if len(help) < 4 || help[0] != "#" || help[1] != "HELP" || !name.MatchString(help[2]) {
+			t.Fatalf("line %d %q isn't a HELP line", i+1, lines[i])
+		}
+		m := help[2]
+		if len(typ) != 4 || typ[0] != "#" || typ[1] != "TYPE" || typ[2] != m || (typ[3] != "counter" && typ[3] != "gauge") {
+			t.Errorf("line %d %q isn't %s's TYPE", i+2, lines[i+1], m)
+		}
+		if (typ[3] == "counter") != strings.HasSuffix(m, "_total") {
+			t.Errorf("%s is a %s; only counters end in _total", m, typ[3])
+		}
+		if len(sample) != 2 || sample[0] != m {
+			t.Fatalf("line %d %q isn't %s's sample", i+3, lines[i+2], m)
+		}
+		v, err := strconv.ParseInt(sample[1], 10, 64)
+		if err != nil {
+			t.Errorf("%s = %q, not an integer", m, sample[1])
+		}
+		if _, dup := values[m]; dup {
+			t.Errorf("%s listed twice", m)
+		}
+		values[m] = v
+	}
+	return values
+}
+
+func TestMetricsFormat(t *testing.T) {
+	before := scrape(t)
+	if len(before) != len(metricDescs()) {
+		t.Errorf("%d metrics scraped, want %d", len(before), len(metricDescs()))
+	}
+	metrics.Moves.Add(1)
+	if after := scrape(t); after["xo_moves_total"] < before["xo_moves_total"]+1 {
+		t.Errorf("xo_moves_total %d after a move, was %d", after["xo_moves_total"], before["xo_moves_total"])
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"tictactoe/discord"
+	"tictactoe/engine"
+	"tictactoe/replay"
+)
+
+// --- Result Notifications ---
+
+var notifier *discord.Notifier
+
+// endedText describes each match end reason in a notification.
+var endedText = map[string]string{
+	endLeft:    "Everyone left",
+	endExpired: "Expired while idle",
+	endAborted: "Aborted by agreement",
+	endNoShow:  "Forfeit, a player didn't show up",
+	endTimeout: "Forfeit, a turn ran out of time",
+}
+
+// webhook is where the game's result goes, and which setting named it.
+// Runs on the game's loop.
+func (game *Game) webhook() (url, source string) {
+	if game.DiscordWebhook != "" {
+		return game.DiscordWebhook, "game"
+	}
+	return cfg.DiscordWebhook, "server"
+}
+
+// rounds is the match so far: the history plus the current round, if it
+// has any moves. Runs on the game's loop.
+func (game *Game) rounds() []replay.Round {
+	out := append([]replay.Round(nil), game.History...)
+	if len(game.Moves) > 0 || game.TimeoutWinner != "" || game.Conceded != "" {
+		out = append(out, game.currentRound())
+	}
+	return out
+}
+
+// notifyResult posts a deleted game's result to its webhook, keeping a
+// record so the replay link in the post still works. Games that never
+// started aren't announced. Runs on the game's loop.
+func notifyResult(game *Game, reason string, now time.Time) {
+	url, _ := game.webhook()
+	if url == "" || game.StartedAt.IsZero() {
+		return
+	}
+	rounds := game.rounds()
+	rec := GameRecord{
+		ID:            game.ID,
+		Rounds:        rounds,
+		Score:         game.Score,
+		FinishedAt:    now.UTC(),
+		Tenant:        game.Tenant,
+		WinConditions: engine.ConditionNames(game.WinConditions),
+
+		Size:      game.recordedSize(),
+		WinLength: game.WinLength,
+
+		Players: game.recordedPlayers(),
+	}
+	log := game.logger()
+	completed := len(game.History)
+	if game.roundOver() {
+		completed++
+	}
+	res := discord.Result{
+		GameID:   game.ID,
+		X:        game.SeatNames["X"],
+		O:        game.SeatNames["O"],
+		ScoreX:   game.Score.X,
+		ScoreO:   game.Score.O,
+		Draws:    game.Score.Draws,
+		Rounds:   completed,
+		Duration: now.Sub(game.StartedAt),
+		Ended:    endedText[reason],
+		At:       now,
+	}
+	if cfg.PublicURL != "" {
+		res.URL = cfg.PublicURL + cfg.BasePath + tenantPrefix(game.Tenant) + "/games/" + game.ID + "/replay"
+	}
+	// The record goes first, so the replay link works once the post is up
+	game.storeLater(func() {
+		if err := store.SaveGameRecord(rec); err != nil {
+			log.Error("saving game record", "err", err)
+		}
+		notifier.Post(url, discord.ResultPayload(res))
+	})
+}
+
+// getReplay serves a game as a replay file: a live one as it stands, or a
+// finished one from its record.
+func getReplay(w http.ResponseWriter, r *http.Request) {
+	key := requestGameKey(r)
+	f := replay.File{Version: replay.Version, GameID: key.ID, RecordedAt: time.Now().UTC()}
+
+	gamesMutex.RLock()
+	game, exists := games[key]
+	gamesMutex.RUnlock()
+	if exists {
+		game.do(func() {
+			f.Rounds = game.rounds()
+			f.WinConditions = engine.ConditionNames(game.WinConditions)
+			f.Size, f.WinLength = game.recordedSize(), game.WinLength
+			f.Players = game.recordedPlayers()
+		})
+	} else {
+		rec, ok, err := store.LoadGameRecord(key.Tenant, key.ID)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal_error")
+			return
+		}
+		if !ok {
+			writeError(w, r, http.StatusNotFound, "game_not_found")
+			return
+		}
+		f.Rounds = rec.Rounds
+		f.WinConditions = rec.WinConditions
+		f.Size, f.WinLength = rec.Size, rec.WinLength
+		f.Players = rec.Players
+		f.RecordedAt = rec.FinishedAt
+	}
+	if f.Rounds == nil {
+		f.Rounds = []replay.Round{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	replay.Encode(w, &f)
+}
+
+type discordTestRequest struct {
+	URL    string `json:"url"`     // Webhook to try; defaults to the game's, then -discord-webhook
+	GameID string `json:"game_id"` // Try this game's webhook
+}
+
+// testDiscord posts a test message to a webhook once, synchronously, and
+// reports what Discord said.
+func testDiscord(w http.ResponseWriter, r *http.Request) {
+	var req discordTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, http.StatusBadRequest, "invalid_body")
+		return
+	}
+	url, source := req.URL, "request"
+	switch {
+	case url != "":
+		if !discord.ValidWebhookURL(url) {
+			writeError(w, r, http.StatusBadRequest, "invalid_webhook")
+			return
+		}
+	case req.GameID != "":
+		gamesMutex.RLock()
+		game, exists := games[gameKey{requestTenant(r), req.GameID}]
+		gamesMutex.RUnlock()
+		if !exists {
+			writeError(w, r, http.StatusNotFound, "game_not_found")
+			return
+		}
+		game.do(func() {
+			url, source = game.webhook()
+		})
+	default:
+		url, source = cfg.DiscordWebhook, "server"
+	}
+	if url == "" {
+		writeError(w, r, http.StatusNotFound, "webhook_not_configured")
+		return
+	}
+
+	audit(r, "discord_test", req.GameID, source)
+	if _, err := notifier.Deliver(url, discord.TestPayload(time.Now())); err != nil {
+		writeErrorDetail(w, r, http.StatusBadGateway, "webhook_failed", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "delivered", "source": source})
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+
+	"tictactoe/protocol"
+)
+
+// --- Opening Book ---
+
+// A game learns how its rounds tend to open: for each cell, how often the
+// first mark went there and how often the player who put it there went on
+// to win. Only finished rounds count, and only the game ID's latest
+// openingWindow of them, so an old habit fades out. They are read back
+// from the stored round results as the game is created, so they carry
+// across restarts and across the games played under the same ID, and then
+// kept up to date as rounds finish. start_game carries them as
+// opening_stats, for the board size in play, so a client can draw a
+// heatmap before the first move, and GET /games/{game_id}/openings serves
+// them for a live game. A game created with hide_openings does neither,
+// for players who would rather not be told.
+
+// openingWindow is how many of the latest rounds with an opening count.
+const openingWindow = 500
+
+// opening is how one finished round opened.
+type opening struct {
+	Size   int
+	Cell   [2]int
+	Opener string // Who made the first mark
+	Winner string // "" for a draw
+}
+
+func openingOf(res RoundResult) (opening, bool) {
+	if res.FirstMove == nil || res.Starter == "" {
+		return opening{}, false
+	}
+	return opening{Size: res.Board.Size(), Cell: *res.FirstMove, Opener: res.Starter, Winner: res.Winner}, true
+}
+
+// loadOpenings reads the game ID's openings from the store as the game is
+// registered, unless onGame already read them. The read waits its turn
+// on the game's store queue, not on the loop, and the rounds finished
+// while it does are kept after it. Caller must be registering the game.
+func (game *Game) loadOpenings() {
+	if game.openingsLoaded || game.HideOpenings {
+		return
+	}
+	key, log := game.key(), game.logger()
+	game.storeLater(func() {
+		results, err := store.ListRoundResults(key.Tenant, key.ID)
+		if err != nil {
+			log.Error("loading openings", "err", err)
+			return
+		}
+		game.do(func() {
+			game.addStoredOpenings(results)
+		})
+	})
+}
+
+// addStoredOpenings puts the openings of stored round results before the
+// ones the game has noted itself. Runs on the game's loop, or while the
+// game is being created.
+func (game *Game) addStoredOpenings(results []RoundResult) {
+	var stored []opening
+	for _, res := range results {
+		if o, ok := openingOf(res); ok {
+			stored = append(stored, o)
+		}
+	}
+	game.openings = trimOpenings(append(stored, game.openings...))
+	game.openingsLoaded = true
+}
+
+// noteOpening adds the round res records to the openings. Runs on the game's
+// loop.
+func (game *Game) noteOpening(res RoundResult) {
+	if o, ok := openingOf(res); ok {
+		game.openings = trimOpenings(append(game.openings, o))
+	}
+}
+
+// trimOpenings drops the oldest openings past openingWindow.
+func trimOpenings(openings []opening) []opening {
+	if len(openings) > openingWindow {
+		return openings[len(openings)-openingWindow:]
+	}
+	return openings
+}
+
+// openingStats are the openings on the current board size, by row and
+// then column, and how many rounds they cover; nil for a game with
+// hide_openings. Runs on the game's loop.
+func (game *Game) openingStats() ([]protocol.OpeningStat, int) {
+	if game.HideOpenings {
+		return nil, 0
+	}
+	size, rounds := game.Board.Size(), 0
+	byCell := make(map[[2]int]*protocol.OpeningStat)
+	for _, o := range game.openings {
+		if o.Size != size {
+			continue
+		}
+		st := byCell[o.Cell]
+		if st == nil {
+			st = &protocol.OpeningStat{Row: o.Cell[0], Col: o.Cell[1]}
+			byCell[o.Cell] = st
+		}
+		st.Rounds++
+		rounds++
+		switch o.Winner {
+		case "":
+			st.Draws++
+		case o.Opener:
+			st.Wins++
+		}
+	}
+	out := make([]protocol.OpeningStat, 0, len(byCell))
+	for _, st := range byCell {
+		st.WinRate = float64(st.Wins) / float64(st.Rounds)
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Row != out[j].Row {
+			return out[i].Row < out[j].Row
+		}
+		return out[i].Col < out[j].Col
+	})
+	return out, rounds
+}
+
+type openingsView struct {
+	GameID   string                 `json:"game_id"`
+	Size     int                    `json:"size"`   // The board size the openings were played on
+	Rounds   int                    `json:"rounds"` // Rounds counted
+	Openings []protocol.OpeningStat `json:"openings"`
+}
+
+// getOpenings serves GET /games/{game_id}/openings.
+func getOpenings(w http.ResponseWriter, r *http.Request) {
+	gamesMutex.RLock()
+	game, exists := games[requestGameKey(r)]
+	gamesMutex.RUnlock()
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "game_not_found")
+		return
+	}
+	var view openingsView
+	hidden := false
+	game.do(func() {
+		if hidden = game.HideOpenings; hidden {
+			return
+		}
+		openings, rounds := game.openingStats()
+		view = openingsView{GameID: game.ID, Size: game.Board.Size(), Rounds: rounds, Openings: openings}
+	})
+	if hidden {
+		writeError(w, r, http.StatusForbidden, "openings_hidden")
+		return
+	}
+	writeJSON(w, http.StatusOK, view)
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// --- Origin Checks ---
+
+// Browsers send the page's origin with every websocket handshake, and
+// nothing stops another site's page from opening one to us. Unless
+// -insecure-allow-all-origins is set, a handshake with an Origin header must
+// come from this server's own host or match -allowed-origins, or the
+// tenant's own origins. Clients that send no Origin, which browsers always
+// do, are not browsers and pass.
+
+// checkOrigin is the upgrader's CheckOrigin.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || cfg.AllowAllOrigins {
+		return true
+	}
+	if t, ok := lookupTenant(requestTenant(r)); ok && originAllowed(t.AllowedOrigins, origin) {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	if originAllowed(cfg.AllowedOrigins, origin) {
+		return true
+	}
+	slog.Debug("websocket origin rejected", "origin", origin, "path", r.URL.Path, "remote", logRemote(r))
+	return false
+}
+
+// originAllowed reports whether origin matches any of patterns.
+func originAllowed(patterns []string, origin string) bool {
+	for _, p := range patterns {
+		if originMatches(p, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// originMatches reports whether origin, as a browser sends it, matches
+// pattern: a scheme and host, with an optional port, where a host of
+// "*.example.com" stands for any subdomain of example.com but not
+// example.com itself. Schemes and ports must agree, a missing port meaning
+// the scheme's default.
+func originMatches(pattern, origin string) bool {
+	p, err := url.Parse(pattern)
+	if err != nil {
+		return false
+	}
+	o, err := url.Parse(origin)
+	if err != nil || o.Host == "" {
+		return false
+	}
+	if !strings.EqualFold(p.Scheme, o.Scheme) || originPort(p) != originPort(o) {
+		return false
+	}
+	host, want := strings.ToLower(o.Hostname()), strings.ToLower(p.Hostname())
+	if suffix, ok := strings.CutPrefix(want, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == want
+}
+
+// originPort is u's port, or its scheme's default.
+func originPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if strings.EqualFold(u.Scheme, "https") {
+		return "443"
+	}
+	return "80"
+}
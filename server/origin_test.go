@@ -0,0 +1,58 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"tictactoe/config"
+)
+
+func TestOriginMatches(t *testing.T) {
+	tests := []struct {
+		pattern, origin string
+		want            bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "https://EXAMPLE.com", true},
+		{"https://example.com", "https://example.com:443", true},
+		{"http://example.com", "http://example.com:80", true},
+		{"https://example.com:8443", "https://example.com:8443", true},
+		{"https://example.com:8443", "https://example.com", false},
+		{"https://example.com", "https://example.com:8443", false},
+		{"https://example.com", "http://example.com", false},
+		{"http://example.com", "https://example.com", false},
+		{"http://example.com:443", "https://example.com", false},
+		{"https://*.example.com", "https://app.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://badexample.com", false},
+		{"https://*.example.com", "https://example.com.evil.test", false},
+		{"https://*.example.com", "http://app.example.com", false},
+		{"https://example.com", "https://other.com", false},
+		{"https://example.com", "null", false},
+	}
+	for _, tt := range tests {
+		if got := originMatches(tt.pattern, tt.origin); got != tt.want {
+			t.Errorf("originMatches(%q, %q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	withConfig(t, func(c *config.Config) { c.AllowedOrigins = []string{"https://*.example.com"} })
+	for origin, want := range map[string]bool{
+		"":                        true, // Not a browser
+		"https://play.test":       true, // The request's own host
+		"https://app.example.com": true,
+		"https://example.com":     false,
+		"https://evil.test":       false,
+	} {
+		r := httptest.NewRequest("GET", "http://play.test/ws/g", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if got := checkOrigin(r); got != want {
+			t.Errorf("checkOrigin with Origin %q = %v, want %v", origin, got, want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// --- Outbound Queue & Write Pump ---
+
+type msgClass int
+
+const (
+	classCritical  msgClass = iota // Never dropped; overflow disconnects the client
+	classBoard                     // Board states; a newer one supersedes a queued one
+	classEphemeral                 // Ticks and indicators; dropped silently on overflow
+)
+
+func classify(event protocol.Event) msgClass {
+	switch event {
+	case protocol.EventMove:
+		return classBoard
+	case protocol.EventLatency, protocol.EventCursor, protocol.EventEmote:
+		return classEphemeral
+	}
+	return classCritical
+}
+
+// sendQueue is a bounded per-connection outbound queue. It is a slice rather
+// than a channel so overflow can coalesce or evict already-queued messages.
+type sendQueue struct {
+	mu    sync.Mutex
+	items []OutboundMessage
+	depth int
+	wake  chan struct{}
+	final []byte // Close frame to send once items are flushed, if closing
+}
+
+func newSendQueue(depth int) *sendQueue {
+	if depth < 1 {
+		depth = 1
+	}
+	return &sendQueue{items: make([]OutboundMessage, 0, depth), depth: depth, wake: make(chan struct{}, 1)}
+}
+
+// push queues msg, applying the overflow policy when the queue is full. It
+// returns false if the message could not be queued without dropping a
+// critical event, meaning the consumer is too slow to keep.
+func (q *sendQueue) push(msg OutboundMessage) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) >= q.depth {
+		class := classify(msg.Event)
+		switch {
+		case class == classEphemeral:
+			metrics.OutboundDropped.Add(1)
+			return true
+		case class == classBoard && classify(q.items[len(q.items)-1].Event) == classBoard:
+			// Consecutive board states: only the newest matters
+			q.items[len(q.items)-1] = msg
+			metrics.OutboundCoalesced.Add(1)
+			return true
+		case !q.evictEphemeral():
+			return false
+		}
+	}
+	q.items = append(q.items, msg)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// evictEphemeral removes the oldest queued ephemeral message to make room.
+// Caller must hold q.mu.
+func (q *sendQueue) evictEphemeral() bool {
+	for i, m := range q.items {
+		if classify(m.Event) == classEphemeral {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			metrics.OutboundDropped.Add(1)
+			return true
+		}
+	}
+	return false
+}
+
+func (q *sendQueue) drain() (msgs []OutboundMessage, final []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := q.items
+	q.items = make([]OutboundMessage, 0, q.depth)
+	return out, q.final
+}
+
+// close queues a close frame behind everything already queued.
+func (q *sendQueue) close(frame []byte) {
+	q.mu.Lock()
+	q.final = frame
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// send queues a message for the player's write pump. A client that can't
+// keep up is disconnected rather than losing a critical event.
+func (p *Player) send(msg OutboundMessage) {
+	if p.dead.Load() {
+		return
+	}
+	if !p.queue.push(msg) {
+		p.logger().Warn("slow consumer, disconnecting")
+		metrics.SlowConsumers.Add(1)
+		closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "slow consumer")
+		p.Conn.WriteClose(closeMsg)
+		p.drop()
+	}
+}
+
+// closeAfterFlush sends a close frame once the messages already queued for
+// the player have been written, then drops the connection.
+func (p *Player) closeAfterFlush(code int, reason string) {
+	p.queue.close(websocket.FormatCloseMessage(code, reason))
+}
+
+// heldBoard is the board a delta-mode client holds: the last one written
+// to it, whole or as changes, and its version.
+type heldBoard struct {
+	seq   uint64
+	board protocol.Board
+}
+
+// asDelta swaps the board of a move that applies directly on top of the
+// board version last written to a delta-mode client for the cells it
+// changed. After a gap, such as a coalesced move, the full board goes out
+// instead.
+func asDelta(msg OutboundMessage, held *heldBoard) OutboundMessage {
+	if msg.Board == nil {
+		return msg
+	}
+	if msg.Event == protocol.EventMove && held.board != nil && msg.Seq == held.seq+1 {
+		if changes, ok := held.board.Changes(*msg.Board); ok {
+			msg.Changes = changes
+			held.seq, held.board = msg.Seq, *msg.Board
+			msg.Board = nil
+			return msg
+		}
+	}
+	held.seq, held.board = msg.Seq, *msg.Board
+	return msg
+}
+
+// asPacked swaps the board for its packed form.
+func asPacked(msg OutboundMessage) OutboundMessage {
+	if msg.Board != nil {
+		msg.BoardPacked = engine.Pack(engine.Board(*msg.Board))
+		msg.Board = nil
+	}
+	return msg
+}
+
+// writePump is the only goroutine that writes data frames to the player's
+// connection, and pings it every interval. It exits when the player's
+// context is done.
+func (p *Player) writePump(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var held heldBoard // In delta mode
+	for {
+		select {
+		case <-p.queue.wake:
+		case <-ticker.C:
+			if !p.checkHeartbeat() {
+				p.Conn.WriteClose(websocket.FormatCloseMessage(protocol.CloseIdleTimeout, "missed pongs"))
+				p.drop()
+				return
+			}
+			if err := p.ping(); err != nil {
+				p.logger().Warn("ping failed, dropping connection", "err", err)
+				p.drop()
+				return
+			}
+			continue
+		case <-p.ctx.Done():
+			return
+		}
+		msgs, final := p.queue.drain()
+		for _, msg := range msgs {
+			if p.Deltas {
+				msg = asDelta(msg, &held)
+			}
+			if p.Packed {
+				msg = asPacked(msg)
+			}
+			if err := p.Conn.Write(msg); err != nil {
+				// A failed or timed-out write leaves the connection unusable
+				p.game.journal.add(journalEntry{Kind: journalLeave, What: "write_failed", Who: p.journalName(), Detail: err.Error()})
+				p.logger().Warn("write failed, dropping connection", "err", err, "journal", p.game.journal.logTail())
+				metrics.WriteErrors.Add(1)
+				p.drop()
+				p.leave() // Without waiting for the read loop to notice
+				return
+			}
+		}
+		if final != nil {
+			p.Conn.WriteClose(final)
+			p.drop()
+			return
+		}
+	}
+}
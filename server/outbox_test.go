@@ -0,0 +1,311 @@
+package server
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tictactoe/config"
+	"tictactoe/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// A connection whose writes fail is dropped on the first broadcast that
+// reaches it, and its opponent is told, without waiting for a read to fail.
+func TestFailedWriteRemovesPlayer(t *testing.T) {
+	quickGames(t)
+	id := unusedGameID()
+	x, xc := joinFake(t, id, "")
+	o, oc := joinFake(t, id, "")
+	xc.expect(t, protocol.EventStartGame)
+	oc.expect(t, protocol.EventStartGame)
+
+	oc.broken.Store(true)
+	x.receive([]byte(`{"event":"make_move","row":1,"col":1}`), newFlood(), gameRequest(id, ""))
+
+	xc.expect(t, protocol.EventOpponentLeft)
+	select {
+	case <-oc.closed:
+	case <-time.After(time.Second):
+		t.Fatal("the broken connection wasn't closed")
+	}
+	if !o.dead.Load() {
+		t.Error("the broken player isn't marked dead")
+	}
+	game := x.game
+	game.do(func() {
+		if len(game.Players) != 1 || game.Players[0] != x {
+			t.Errorf("players after the failed write: %v, want only X", game.Players)
+		}
+		if _, held := game.HeldUntil[o.Symbol]; !held {
+			t.Errorf("%s's seat isn't held for a reconnect", o.Symbol)
+		}
+	})
+}
+
+// A failed write removes the player even if its read loop is stuck and
+// never gets to leave, and the read loop leaving late changes nothing.
+func TestFailedWriteWithoutReadLoop(t *testing.T) {
+	quickGames(t)
+	id := unusedGameID()
+	x, xc := joinFake(t, id, "")
+	oc := newFakeConn()
+	o := join(oc, gameRequest(id, ""), "") // Nothing reads for it, or leaves
+	if o == nil {
+		t.Fatal("second join refused")
+	}
+	xc.expect(t, protocol.EventStartGame)
+	oc.expect(t, protocol.EventStartGame)
+
+	oc.broken.Store(true)
+	x.receive([]byte(`{"event":"make_move","row":1,"col":1}`), newFlood(), gameRequest(id, ""))
+	xc.expect(t, protocol.EventOpponentLeft)
+
+	o.leave() // The read loop, getting there at last
+	game := x.game
+	game.do(func() {
+		if len(game.Players) != 1 || game.Players[0] != x {
+			t.Errorf("players after the failed write: %v, want only X", game.Players)
+		}
+	})
+	select {
+	case msg := <-xc.msgs:
+		if msg.Event == protocol.EventOpponentLeft {
+			t.Error("opponent_left sent twice")
+		}
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// A client that stops reading holds up only its own write pump: its
+// opponent's moves, and its own, go through at once while its socket
+// hangs, and it is dropped when the write deadline passes.
+func TestStalledClientDoesNotHoldUpOpponent(t *testing.T) {
+	quickGames(t)
+	id := unusedGameID()
+	x, xc := joinFake(t, id, "")
+	o, oc := joinFake(t, id, "")
+	xc.expect(t, protocol.EventStartGame)
+	oc.expect(t, protocol.EventStartGame)
+	oc.stalled.Store(true)
+
+	moves := []struct {
+		p    *Player
+		move string
+	}{
+		{x, `{"event":"make_move","row":1,"col":1}`},
+		{o, `{"event":"make_move","row":0,"col":0}`},
+		{x, `{"event":"make_move","row":2,"col":2}`},
+	}
+	start := time.Now()
+	for _, m := range moves {
+		m.p.receive([]byte(m.move), newFlood(), gameRequest(id, ""))
+		if msg := xc.expect(t, protocol.EventMove); msg.Symbol != m.p.Symbol {
+			t.Fatalf("move by %s, want %s", msg.Symbol, m.p.Symbol)
+		}
+	}
+	if waited := time.Since(start); waited >= stallTimeout {
+		t.Errorf("three moves took %v with O stalled; they waited on its writes", waited)
+	}
+	responsive(t, x.game) // While O's write hangs
+
+	xc.expect(t, protocol.EventOpponentLeft)
+	if !o.dead.Load() {
+		t.Error("the stalled player isn't marked dead")
+	}
+}
+
+// A client too far behind to take a critical message is disconnected as a
+// slow consumer, leaving the game as any other drop would.
+func TestSlowConsumerDropped(t *testing.T) {
+	quickGames(t)
+	id := unusedGameID()
+	x, xc := joinFake(t, id, "")
+	o, oc := joinFake(t, id, "")
+	xc.expect(t, protocol.EventStartGame)
+	oc.expect(t, protocol.EventStartGame)
+	oc.stalled.Store(true)
+
+	game := x.game
+	game.do(func() {
+		for i := 0; i <= cfg.SendQueueDepth+1; i++ {
+			o.send(protocol.Notice(protocol.EventOpponentAFK, "opponent_afk"))
+		}
+	})
+	select {
+	case <-oc.closed:
+	case <-time.After(time.Second):
+		t.Fatal("the slow consumer wasn't closed")
+	}
+	oc.mu.Lock()
+	frames := oc.frames
+	oc.mu.Unlock()
+	if len(frames) == 0 || binary.BigEndian.Uint16(frames[0]) != websocket.ClosePolicyViolation || string(frames[0][2:]) != "slow consumer" {
+		t.Errorf("close frames %q, want one with 1008 policy violation", frames)
+	}
+
+	xc.expect(t, protocol.EventOpponentLeft)
+	game.do(func() {
+		if len(game.Players) != 1 || game.Players[0] != x {
+			t.Errorf("players after the drop: %v, want only X", game.Players)
+		}
+		if _, held := game.HeldUntil[o.Symbol]; !held {
+			t.Errorf("%s's seat isn't held for a reconnect", o.Symbol)
+		}
+	})
+}
+
+// A delta-mode client that applies every change it is sent to the board it
+// holds has the server's board after each message, whatever the queue
+// coalesced away in between. Random games are pushed through a real
+// sendQueue, drained at random as a write pump would be.
+func TestDeltasRebuildBoard(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var deltas, fulls int
+	coalesced := metrics.OutboundCoalesced.Load()
+	for game := 0; game < 200; game++ {
+		q := newSendQueue(4)
+		var held heldBoard
+		var client protocol.Board
+		boards := make(map[uint64]protocol.Board) // The server's board at each Seq
+		var seq uint64
+		board := emptyBoard(3)
+
+		deliver := func() {
+			msgs, _ := q.drain()
+			for _, msg := range msgs {
+				msg = asDelta(msg, &held)
+				switch {
+				case msg.Board != nil:
+					client = *protocol.NewBoard(*msg.Board)
+					fulls++
+				case msg.Changes != nil:
+					if client == nil || !client.Apply(msg.Changes) {
+						t.Fatalf("game %d: changes %v don't apply to %v", game, msg.Changes, client)
+					}
+					deltas++
+				default:
+					continue
+				}
+				if want := boards[msg.Seq]; !reflect.DeepEqual(client, want) {
+					t.Fatalf("game %d: client holds %v at seq %d, want %v", game, client, msg.Seq, want)
+				}
+			}
+		}
+
+		for step := 0; step < 60; step++ {
+			var msg OutboundMessage
+			switch n := rng.Intn(10); {
+			case n < 7: // A move, sometimes clearing a cell as a fading mark does
+				r, c := rng.Intn(len(board)), rng.Intn(len(board))
+				board[r][c] = []string{"X", "O", ""}[rng.Intn(3)]
+				seq++
+				msg = OutboundMessage{Event: protocol.EventMove, Board: protocol.NewBoard(board), Seq: seq}
+			case n < 8: // A new round, sometimes on another size of board
+				board = emptyBoard(3 + rng.Intn(2))
+				seq++
+				msg = OutboundMessage{Event: protocol.EventNewGame, Board: protocol.NewBoard(board), Seq: seq}
+			default:
+				msg = protocol.Notice(protocol.EventOpponentAFK, "opponent_afk")
+			}
+			if msg.Board != nil {
+				boards[seq] = *protocol.NewBoard(board)
+			}
+			if queued := len(q.items); queued == q.depth && (classify(msg.Event) != classBoard || classify(q.items[queued-1].Event) != classBoard) {
+				deliver() // Only board states coalesce; anything else would drop the client
+			}
+			if !q.push(msg) {
+				t.Fatalf("game %d: queue refused %s", game, msg.Event)
+			}
+			if rng.Intn(4) == 0 {
+				deliver()
+			}
+		}
+		deliver()
+		if !reflect.DeepEqual(client, boards[seq]) {
+			t.Fatalf("game %d: client ends with %v, want %v", game, client, boards[seq])
+		}
+	}
+	if coalesced = metrics.OutboundCoalesced.Load() - coalesced; deltas == 0 || fulls == 0 || coalesced == 0 {
+		t.Fatalf("%d deltas, %d full boards and %d coalesced moves; the test should exercise all three", deltas, fulls, coalesced)
+	}
+}
+
+func emptyBoard(size int) protocol.Board {
+	b := make(protocol.Board, size)
+	for r := range b {
+		b[r] = make([]string, size)
+	}
+	return b
+}
+
+// overlapConn is a fakeConn that counts data writes made while another is
+// in flight, which gorilla/websocket forbids. Control frames may overlap.
+type overlapConn struct {
+	*fakeConn
+	writing  atomic.Bool
+	overlaps atomic.Int64
+}
+
+func (c *overlapConn) Write(msg OutboundMessage) error {
+	if !c.writing.CompareAndSwap(false, true) {
+		c.overlaps.Add(1)
+		return c.fakeConn.Write(msg)
+	}
+	defer c.writing.Store(false)
+	time.Sleep(10 * time.Microsecond) // Widens the window for an overlap
+	return c.fakeConn.Write(msg)
+}
+
+// Messages sent to a player from many goroutines at once, on the game's
+// loop and off it, reach its connection one write at a time.
+func TestSendsNeverOverlap(t *testing.T) {
+	quickGames(t)
+	withConfig(t, func(c *config.Config) { c.SendQueueDepth = 1024 }) // Holds all 400
+	t.Cleanup(func() { flush(t) })                                    // The game going dormant once both leave
+	id := unusedGameID()
+	x, xc := joinFake(t, id, "")
+	oc := &overlapConn{fakeConn: newFakeConn()}
+	o := join(oc, gameRequest(id, ""), "")
+	if o == nil {
+		t.Fatal("second join refused")
+	}
+	t.Cleanup(o.leave)
+	go func() {
+		for {
+			select {
+			case <-oc.msgs:
+			case <-oc.closed:
+				return
+			}
+		}
+	}()
+	xc.expect(t, protocol.EventStartGame)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if i%2 == 0 {
+					o.send(protocol.Notice(protocol.EventOpponentIdle, "opponent_idle"))
+				} else {
+					x.game.do(func() { broadcast(x.game, protocol.Notice(protocol.EventOpponentActive, "opponent_active")) })
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := oc.overlaps.Load(); n != 0 {
+		t.Errorf("%d writes overlapped another", n)
+	}
+	if o.dead.Load() {
+		t.Error("the player was dropped")
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"bytes"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"tictactoe/config"
+)
+
+// --- HTML Pages ---
+
+// Renderer serves the server's own HTML pages. In headless mode there are
+// none, and handlers don't need to check which mode they're in.
+type Renderer interface {
+	Render(w http.ResponseWriter, r *http.Request, name string, data interface{})
+}
+
+type templateRenderer struct {
+	t *template.Template
+}
+
+// Render executes the page into a buffer first, so a template that fails
+// halfway answers with a clean 500 rather than half a page.
+func (p templateRenderer) Render(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	var buf bytes.Buffer
+	if err := p.t.ExecuteTemplate(&buf, name, data); err != nil {
+		slog.Error("rendering page", "page", name, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// pageTemplates is the pattern the page templates match in their fs.FS.
+const pageTemplates = "*.html"
+
+// liveRenderer parses the templates afresh for every page, so edits under
+// -assets-dir or -templates-dir show on reload.
+type liveRenderer struct {
+	fsys fs.FS // The templates directory itself
+}
+
+// check reports whether the templates on disk still parse.
+func (p liveRenderer) check() error {
+	_, err := template.ParseFS(p.fsys, pageTemplates)
+	return err
+}
+
+func (p liveRenderer) Render(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	t, err := template.ParseFS(p.fsys, pageTemplates)
+	if err != nil {
+		slog.Error("parsing templates", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+	templateRenderer{t}.Render(w, r, name, data)
+}
+
+// headlessRenderer answers every page with a JSON 404.
+type headlessRenderer struct{}
+
+func (headlessRenderer) Render(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	writeError(w, r, http.StatusNotFound, "not_found")
+}
+
+// unavailableRenderer answers every page with a JSON 503: the web UI was
+// wanted but its assets couldn't be loaded.
+type unavailableRenderer struct{}
+
+func (unavailableRenderer) Render(w http.ResponseWriter, r *http.Request, name string, data interface{}) {
+	writeError(w, r, http.StatusServiceUnavailable, "web_ui_unavailable")
+}
+
+// Assets holds the web UI's templates/ and static/ trees. The main package
+// sets it to the copy embedded in the binary.
+var Assets fs.FS
+
+var (
+	pages       Renderer = headlessRenderer{}
+	staticFiles fs.FS    // Served under /static/
+	headless    = true   // No pages or static routes
+)
+
+// loadPages picks the web UI unless headless is requested: c.AssetsDir if
+// set, reparsed on every page, otherwise Assets, with the templates from
+// c.TemplatesDir instead if that is set, also reparsed. Missing or broken
+// assets don't stop the server: the websocket and the API carry on, with
+// a warning logged and the pages answering 503.
+func loadPages(c config.Config) (Renderer, fs.FS, bool) {
+	if c.Headless {
+		return headlessRenderer{}, nil, true
+	}
+	fsys, source := Assets, "embedded assets"
+	if c.AssetsDir != "" {
+		fsys, source = os.DirFS(c.AssetsDir), c.AssetsDir
+	}
+	if fsys == nil {
+		slog.Warn("no web UI assets, serving the API only")
+		return unavailableRenderer{}, nil, true
+	}
+	templates, err := fs.Sub(fsys, "templates")
+	if c.TemplatesDir != "" {
+		templates, err = os.DirFS(c.TemplatesDir), nil
+	}
+	var t *template.Template
+	if err == nil {
+		t, err = template.ParseFS(templates, pageTemplates)
+	}
+	if err != nil {
+		slog.Warn("no web UI templates, serving the API only", "err", err)
+		return unavailableRenderer{}, nil, true
+	}
+	static, err := fs.Sub(fsys, "static")
+	if err != nil {
+		slog.Warn("no web UI static files, serving the API only", "err", err)
+		return unavailableRenderer{}, nil, true
+	}
+	slog.Info("serving the web UI", "source", source, "templates", c.TemplatesDir)
+	if c.AssetsDir != "" || c.TemplatesDir != "" {
+		return liveRenderer{templates}, static, false
+	}
+	return templateRenderer{t}, static, false
+}
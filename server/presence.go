@@ -0,0 +1,123 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// --- Cursors & Emotes ---
+
+// A player's cursor, the cell they hover over, and emotes, one of
+// protocol.Emotes, are relayed to the other players so the UI can show
+// what they're up to. They are ephemeral: never stored, never echoed to
+// the sender, and dropped without a word from spectators, outside a round
+// in play, or past their limits. Cursors go out at most once per
+// cursorInterval, only the newest of those in between; emotes are capped
+// by emoteLimiter. They change nothing, so the game's loop only looks up
+// who to send them to, and they bypass the connection's flood control: a
+// hovering mouse shouldn't use up the budget for moves.
+
+// cursorInterval is the least time between two cursor events relayed for
+// one player.
+const cursorInterval = 100 * time.Millisecond
+
+// emoteLimiter throttles emotes per connection, keyed by Player.ID.
+var emoteLimiter = newWindowLimiter(3, 5*time.Second)
+
+// cursorRelay coalesces one player's cursor events: the first in a while
+// goes out at once, and the newest of those arriving within cursorInterval
+// of it follows when the interval ends.
+type cursorRelay struct {
+	mu      sync.Mutex
+	sent    time.Time    // When one last went out
+	pending *engine.Cell // Newest one held back, if any; a timer sends it
+}
+
+// relayPresence handles p's cursor or emote event.
+func (p *Player) relayPresence(msg protocol.InboundMessage) {
+	switch msg.Event {
+	case protocol.EventCursor:
+		p.moveCursor(engine.Cell{Row: *msg.Row, Col: *msg.Col})
+	case protocol.EventEmote:
+		if emoteLimiter.Allow(p.ID) {
+			p.relayToOpponents(OutboundMessage{Event: protocol.EventEmote, Emote: msg.Emote}, nil)
+		}
+	}
+}
+
+// moveCursor relays cell as p's cursor now, or holds it until
+// cursorInterval has passed since the last one went out.
+func (p *Player) moveCursor(cell engine.Cell) {
+	c := &p.cursor
+	c.mu.Lock()
+	now := p.game.clock.Now()
+	if wait := cursorInterval - now.Sub(c.sent); wait > 0 {
+		if c.pending == nil {
+			p.game.clock.AfterFunc(wait, p.flushCursor)
+		}
+		c.pending = &cell
+		c.mu.Unlock()
+		return
+	}
+	c.sent = now
+	c.mu.Unlock()
+	p.relayCursor(cell)
+}
+
+// flushCursor relays the cursor moveCursor held back.
+func (p *Player) flushCursor() {
+	c := &p.cursor
+	c.mu.Lock()
+	cell := c.pending
+	c.pending, c.sent = nil, p.game.clock.Now()
+	c.mu.Unlock()
+	if cell != nil && p.ctx.Err() == nil {
+		p.relayCursor(*cell)
+	}
+}
+
+func (p *Player) relayCursor(cell engine.Cell) {
+	p.relayToOpponents(OutboundMessage{Event: protocol.EventCursor, Row: &cell.Row, Col: &cell.Col}, &cell)
+}
+
+// relayToOpponents sends msg, from p, to the other players in p's game, if
+// p is still seated, the round is in play and cell, if given, is on the
+// board. Only the lookup runs on the game's loop.
+func (p *Player) relayToOpponents(msg OutboundMessage, cell *engine.Cell) {
+	game := p.game
+	var to []*Player
+	game.do(func() {
+		if p.Role != RolePlayer || !game.inPlay() || (cell != nil && !game.onBoard(*cell)) {
+			return
+		}
+		to = make([]*Player, 0, len(game.Players)-1)
+		for _, other := range game.Players {
+			if other != p {
+				to = append(to, other)
+			}
+		}
+		if len(to) == len(game.Players) {
+			to = nil // p has left its seat
+		}
+		msg.Player = p.Symbol
+	})
+	for _, other := range to {
+		other.send(msg)
+	}
+}
+
+// inPlay reports whether every seat is taken and the round is under way.
+// Runs on the game's loop.
+func (game *Game) inPlay() bool {
+	return len(game.Players) == game.seats() && !game.paused() && game.Ready == nil && !game.scheduled() && !game.roundOver()
+}
+
+// onBoard reports whether cell is on the game's board. Runs on the game's
+// loop.
+func (game *Game) onBoard(cell engine.Cell) bool {
+	n := game.Board.Size()
+	return cell.Row >= 0 && cell.Row < n && cell.Col >= 0 && cell.Col < n
+}
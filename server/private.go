@@ -0,0 +1,124 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// --- Private Games ---
+
+// A game created with a password seats only connections that present it
+// with ?password=, or the first connection when it creates the game. A
+// spectator password, if set, limits watching the same way; either
+// password admits a spectator. A returning player with a valid seat token
+// needs neither. Polling a game's board or state over REST takes either
+// password, or a seat token, with ?password= or ?token=, whenever one of
+// the two is set. The game keeps a salted hash, never the password itself.
+// Three wrong passwords from one IP within a minute lock that IP out of the
+// game until the oldest ages out.
+
+const maxPasswordLen = 128
+
+var passwordLimiter = newWindowLimiter(3, time.Minute)
+
+// hashPassword returns "<salt>$<sha256(salt+password)>", both base64.
+func hashPassword(password string) string {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	return encodePasswordHash(salt, password)
+}
+
+func encodePasswordHash(salt []byte, password string) string {
+	sum := sha256.Sum256(append(append([]byte(nil), salt...), password...))
+	enc := base64.RawStdEncoding
+	return enc.EncodeToString(salt) + "$" + enc.EncodeToString(sum[:])
+}
+
+// checkPassword reports whether password matches hash.
+func checkPassword(hash, password string) bool {
+	saltText, _, ok := strings.Cut(hash, "$")
+	if !ok {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(saltText)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(encodePasswordHash(salt, password)), []byte(hash)) == 1
+}
+
+// validPassword reports whether password can be set on a game.
+func validPassword(password string) bool {
+	return utf8.RuneCountInString(password) <= maxPasswordLen
+}
+
+// private reports whether seats need a password. Runs on the game's
+// loop.
+func (game *Game) private() bool {
+	return game.PasswordHash != ""
+}
+
+// admit checks the password a new connection from ip presented for a seat,
+// or to watch if spectating. It returns "" to let it in, wrong_password, or
+// too_many_attempts while ip is locked out. Runs on the game's loop.
+func (game *Game) admit(ip, password string, spectating bool) string {
+	if !game.private() && (!spectating || game.SpectatorPasswordHash == "") {
+		return ""
+	}
+	key := game.Nonce + "|" + ip
+	if passwordLimiter.Full(key) {
+		return "too_many_attempts"
+	}
+	if game.private() && checkPassword(game.PasswordHash, password) {
+		return ""
+	}
+	if spectating && (game.SpectatorPasswordHash == "" || checkPassword(game.SpectatorPasswordHash, password)) {
+		return ""
+	}
+	passwordLimiter.Allow(key) // Counts the failure
+	game.logger().Info("wrong game password", "remote", ip, "spectating", spectating)
+	return "wrong_password"
+}
+
+// mayView checks what a REST request from ip for the game's board or state
+// presented in query: a seat token, or either of the game's passwords if
+// it has any. It returns "" to serve it, wrong_password, or
+// too_many_attempts while ip is locked out. Runs on the game's loop.
+func (game *Game) mayView(ip string, query url.Values) string {
+	if !game.private() && game.SpectatorPasswordHash == "" {
+		return ""
+	}
+	if token := query.Get("token"); token != "" {
+		if _, err := verifySeatToken(game, token); err == nil {
+			return ""
+		}
+	}
+	key := game.Nonce + "|" + ip
+	if passwordLimiter.Full(key) {
+		return "too_many_attempts"
+	}
+	password := query.Get("password")
+	for _, hash := range []string{game.PasswordHash, game.SpectatorPasswordHash} {
+		if hash != "" && checkPassword(hash, password) {
+			return ""
+		}
+	}
+	passwordLimiter.Allow(key) // Counts the failure
+	game.logger().Info("wrong game password", "remote", ip, "via", "rest")
+	return "wrong_password"
+}
+
+// viewStatus is the HTTP status for a mayView code.
+func viewStatus(code string) int {
+	if code == "too_many_attempts" {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusForbidden
+}
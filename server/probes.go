@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+
+	"tictactoe/buildinfo"
+)
+
+// --- Health Probes ---
+
+// /healthz answers as long as the process can serve HTTP at all. /readyz
+// also runs the checks that decide whether a load balancer should send it
+// new players, and fails from the moment shutdown begins so games already
+// here can finish while newcomers go elsewhere. Both list what they found.
+
+const checkOK = "ok"
+
+type probeResult struct {
+	Status  string            `json:"status"`
+	Version string            `json:"version"`
+	Checks  map[string]string `json:"checks,omitempty"` // Check name to "ok" or why it failed
+}
+
+func liveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, probeResult{Status: checkOK, Version: buildinfo.Version})
+}
+
+// readiness reports whether a load balancer should send this server new
+// players.
+func readiness(w http.ResponseWriter, r *http.Request) {
+	checks := readinessChecks()
+	res, status := probeResult{Status: "ready", Version: buildinfo.Version, Checks: checks}, http.StatusOK
+	for _, result := range checks {
+		if result != checkOK {
+			res.Status, status = "not_ready", http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, status, res)
+}
+
+// readinessChecks runs every readiness check. A server serving the API
+// only, by request or for want of assets, has no templates to check.
+func readinessChecks() map[string]string {
+	checks := map[string]string{
+		"shutdown":    checkOK,
+		"maintenance": checkOK,
+		"store":       checkOK,
+	}
+	if draining.Load() {
+		checks["shutdown"] = "draining"
+	}
+	if maintenance.Load() {
+		checks["maintenance"] = "enabled"
+	}
+	if !headless {
+		checks["templates"] = checkOK
+		if live, ok := pages.(liveRenderer); ok {
+			if err := live.check(); err != nil {
+				checks["templates"] = err.Error()
+			}
+		}
+	}
+	if p, ok := store.(Pinger); ok {
+		if err := p.Ping(); err != nil {
+			checks["store"] = err.Error()
+		}
+	}
+	return checks
+}
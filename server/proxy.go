@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// --- Reverse Proxies ---
+
+// Behind a reverse proxy the connection comes from the proxy, so what the
+// client itself used is in the headers the proxy adds. X-Forwarded-Proto
+// says whether it reached us over TLS, for the URLs we hand back, and
+// X-Forwarded-For who it is, for the logs. Bans and limits keep going by
+// the peer address: the headers are the client's to forge when there is
+// no proxy. The per-IP limits, told which peers are proxies with
+// -trusted-proxy, are the exception; see iplimits.go. Mounting under the
+// proxy's path prefix is cfg.BasePath's job (see NewRouter).
+
+// requestScheme is "https" if r reached us, or the proxy in front of us,
+// over TLS, "http" otherwise.
+func requestScheme(r *http.Request) string {
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	if r.TLS != nil || strings.EqualFold(strings.TrimSpace(proto), "https") {
+		return "https"
+	}
+	return "http"
+}
+
+// logRemote is who sent r, for logs: the client a proxy forwarded for
+// when X-Forwarded-For names one, the peer address otherwise.
+func logRemote(r *http.Request) string {
+	first, _, _ := strings.Cut(r.Header.Get("X-Forwarded-For"), ",")
+	if ip := net.ParseIP(strings.TrimSpace(first)); ip != nil {
+		return ip.String()
+	}
+	return clientIP(r)
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// --- Daily Puzzle ---
+
+// Each UTC day has a puzzle: a position on the classic board where the
+// player on turn, X or O as the puzzle says, can force a win, or failing
+// that a draw, in the given number of their own moves. GET /puzzle shows
+// the day's, or ?date='s, and /ws/puzzle/{date} plays it against the
+// server. The position is the same for everyone on the day: it is drawn
+// from a generator seeded with the date, by playing a few random moves
+// from the empty board that leave no line and a free cell, so the counts
+// of X and O are those of a real game. The hard computer's search scores
+// every move, and only a position with a forced win in two moves or more
+// is taken, or after puzzleTries without one, a forced draw with a losing
+// move to avoid.
+//
+// On the socket the player's every move must keep the best result in the
+// moves left, as the search sees it; the server answers each with the
+// opponent's best reply as a move. One that doesn't gets puzzle_failed,
+// with the reply that refutes it and a move that would have kept the line,
+// and the socket closes. Reaching the end of the line gets puzzle_solved.
+// Solves and failures are counted by UTC day under GET /stats/engagement.
+
+const (
+	puzzleTries    = 1000
+	puzzleIdle     = 10 * time.Minute // How long the socket waits for a move
+	puzzleGoalWin  = "win"
+	puzzleGoalDraw = "draw"
+)
+
+// puzzle is one day's position.
+type puzzle struct {
+	Date   string       `json:"date"` // YYYY-MM-DD, UTC
+	Board  engine.Board `json:"board"`
+	Player string       `json:"player"` // Who is on turn, and plays the puzzle
+	Goal   string       `json:"goal"`   // "win" or "draw"
+	Moves  int          `json:"moves"`  // The player's moves to reach it against the best defence
+}
+
+// parsePuzzleDate reads a puzzle's date, "" for today's. Only dates up to
+// today have a puzzle.
+func parsePuzzleDate(v string, now time.Time) (string, bool) {
+	today := now.UTC().Format(time.DateOnly)
+	if v == "" {
+		return today, true
+	}
+	d, err := time.Parse(time.DateOnly, v)
+	if err != nil || d.Format(time.DateOnly) > today {
+		return "", false
+	}
+	return d.Format(time.DateOnly), true
+}
+
+// puzzleFor is date's puzzle.
+func puzzleFor(date string) puzzle {
+	h := fnv.New64a()
+	h.Write([]byte(date))
+	rng := rand.New(rand.NewSource(int64(h.Sum64())))
+	var fallback *puzzle
+	for i := 0; i < puzzleTries; i++ {
+		b, player, ok := randomPosition(rng)
+		if !ok || !legalPosition(b) {
+			continue
+		}
+		p := puzzle{Date: date, Board: b, Player: player}
+		best, _ := puzzleScores(b, player)
+		switch {
+		case best > 0:
+			p.Goal, p.Moves = puzzleGoalWin, winMoves(best)
+			if p.Moves >= 2 {
+				return p
+			}
+		case best == 0 && fallback == nil && hasLosingMove(b, player):
+			p.Goal, p.Moves = puzzleGoalDraw, (len(freeCells(b))+1)/2
+			fallback = &p
+		}
+	}
+	if fallback != nil {
+		return *fallback
+	}
+	// Never reached in practice; X to play on an empty board draws
+	return puzzle{Date: date, Board: engine.NewBoard(engine.DefaultSize), Player: "X", Goal: puzzleGoalDraw, Moves: 5}
+}
+
+// randomPosition plays two to five random moves on an empty classic
+// board, X first, and returns it with who is on turn. ok is false if a
+// move completed a line.
+func randomPosition(rng *rand.Rand) (b engine.Board, player string, ok bool) {
+	b = engine.NewBoard(engine.DefaultSize)
+	player = "X"
+	plies := 2 + rng.Intn(4)
+	for i := 0; i < plies; i++ {
+		free := freeCells(b)
+		c := free[rng.Intn(len(free))]
+		b[c.Row][c.Col] = player
+		if _, won := engine.FindWin(b, c, nil); won {
+			return b, player, false
+		}
+		player = engine.Other(player)
+	}
+	return b, player, true
+}
+
+// legalPosition reports whether b could come up in a classic game still
+// under way: X has as many marks as O or one more, neither has a line and
+// a cell is free.
+func legalPosition(b engine.Board) bool {
+	if b.Size() != engine.DefaultSize {
+		return false
+	}
+	x, o := 0, 0
+	for r, row := range b {
+		for c, mark := range row {
+			switch mark {
+			case "X":
+				x++
+			case "O":
+				o++
+			case "":
+				continue
+			default:
+				return false
+			}
+			if _, won := engine.FindWin(b, engine.Cell{Row: r, Col: c}, nil); won {
+				return false
+			}
+		}
+	}
+	return (x == o || x == o+1) && x+o < len(b)*len(b)
+}
+
+func freeCells(b engine.Board) []engine.Cell {
+	var out []engine.Cell
+	for _, c := range aiPreference {
+		if b[c.Row][c.Col] == "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// puzzleScores scores each of player's moves on b by the hard computer's
+// search, as chooseMove does, and returns the best score with them.
+func puzzleScores(b engine.Board, player string) (int, map[engine.Cell]int) {
+	b = b.Clone()
+	best, scores := math.MinInt, make(map[engine.Cell]int)
+	for _, c := range freeCells(b) {
+		b[c.Row][c.Col] = player
+		score := -negamax(b, c, engine.Other(player), nil, 1, math.MinInt+1, math.MaxInt)
+		b[c.Row][c.Col] = ""
+		scores[c] = score
+		best = max(best, score)
+	}
+	return best, scores
+}
+
+// winMoves is how many of its own moves the player needs for a win the
+// search scores best: a win on its kth move from here scores 11-2k.
+func winMoves(best int) int {
+	return (11 - best) / 2
+}
+
+func hasLosingMove(b engine.Board, player string) bool {
+	_, scores := puzzleScores(b, player)
+	for _, s := range scores {
+		if s < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// GET /puzzle?date=YYYY-MM-DD: the day's puzzle, today's by default.
+func getPuzzle(w http.ResponseWriter, r *http.Request) {
+	date, ok := parsePuzzleDate(r.URL.Query().Get("date"), time.Now())
+	if !ok {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_puzzle_date", "date must be YYYY-MM-DD and no later than today, in UTC")
+		return
+	}
+	p := puzzleFor(date)
+	writeJSON(w, http.StatusOK, struct {
+		puzzle
+		WSURL string `json:"ws_url"`
+	}{p, cfg.BasePath + tenantPrefix(requestTenant(r)) + "/ws/puzzle/" + date})
+}
+
+// puzzleSocket plays the puzzle for the date in the path.
+func puzzleSocket(w http.ResponseWriter, r *http.Request) {
+	date, ok := parsePuzzleDate(mux.Vars(r)["date"], time.Now())
+	if !ok || mux.Vars(r)["date"] == "" {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_puzzle_date", "date must be YYYY-MM-DD and no later than today, in UTC")
+		return
+	}
+	locale := declaredLocale(r)
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		metrics.UpgradeFailures.Add(1)
+		return
+	}
+	defer ws.Close()
+	defer trackSocket(ws, r)()
+	ws.SetReadLimit(maxInboundSize)
+
+	p := puzzleFor(date)
+	b := p.Board.Clone()
+	start := protocol.BoardState(protocol.EventPuzzle, b, p.Player, nil)
+	start.Player, start.Goal, start.MovesLeft, start.Date = p.Player, p.Goal, p.Moves, p.Date
+	if err := writeJSONDeadline(ws, start); err != nil {
+		return
+	}
+	left := p.Moves
+	for {
+		ws.SetReadDeadline(time.Now().Add(puzzleIdle))
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		msg, err := protocol.DecodeAs(protocol.JSON, data)
+		switch {
+		case errors.Is(err, protocol.ErrOffBoard):
+			puzzleReject(ws, locale, "out_of_bounds")
+			continue
+		case errors.Is(err, protocol.ErrUnknownEvent):
+			writeJSONDeadline(ws, localize(locale, protocol.Failure("unknown_event", err.Error())))
+			continue
+		case err != nil:
+			writeJSONDeadline(ws, localize(locale, protocol.Failure("protocol_error", err.Error())))
+			continue
+		case msg.Event != protocol.EventMakeMove:
+			continue // Nothing else means anything here
+		}
+		c := engine.Cell{Row: *msg.Row, Col: *msg.Col}
+		if c.Row >= b.Size() || c.Col >= b.Size() {
+			puzzleReject(ws, locale, "out_of_bounds")
+			continue
+		}
+		if b[c.Row][c.Col] != "" {
+			puzzleReject(ws, locale, "cell_occupied")
+			continue
+		}
+
+		best, scores := puzzleScores(b, p.Player)
+		if scores[c] != best {
+			puzzleFailed(ws, locale, p, b, c, scores, best)
+			recordPuzzle(requestTenant(r), false, time.Now())
+			return
+		}
+		b[c.Row][c.Col] = p.Player
+		left--
+		if _, won := engine.FindWin(b, c, nil); won || engine.CheckDraw(b) {
+			puzzleSolved(ws, locale, p, b)
+			recordPuzzle(requestTenant(r), true, time.Now())
+			return
+		}
+		opp := engine.Other(p.Player)
+		row, col, _ := chooseMove(b, opp, nil)
+		b[row][col] = opp
+		if engine.CheckDraw(b) {
+			puzzleSolved(ws, locale, p, b) // The defence filled the board
+			recordPuzzle(requestTenant(r), true, time.Now())
+			return
+		}
+		reply := protocol.BoardState(protocol.EventMove, b, p.Player, nil)
+		reply.Row, reply.Col, reply.Symbol, reply.MovesLeft = &row, &col, opp, left
+		if err := writeJSONDeadline(ws, reply); err != nil {
+			return
+		}
+	}
+}
+
+func puzzleReject(ws *websocket.Conn, locale, code string) {
+	msg := protocol.Failure(code, "")
+	msg.Event = protocol.EventInvalidMove
+	writeJSONDeadline(ws, localize(locale, msg))
+}
+
+// puzzleFailed tells the player that c, on b, lost the line: the reply
+// that refutes it, and a move that would have kept it.
+func puzzleFailed(ws *websocket.Conn, locale string, p puzzle, b engine.Board, c engine.Cell, scores map[engine.Cell]int, best int) {
+	var solution engine.Cell
+	for _, fc := range freeCells(b) {
+		if scores[fc] == best {
+			solution = fc
+			break
+		}
+	}
+	after := b.Clone()
+	after[c.Row][c.Col] = p.Player
+	msg := protocol.BoardState(protocol.EventPuzzleFailed, after, "", nil)
+	msg.Code, msg.Player, msg.Date = "puzzle_failed", p.Player, p.Date
+	msg.Solution = &protocol.Cell{Row: solution.Row, Col: solution.Col}
+	if _, won := engine.FindWin(after, c, nil); !won && !engine.CheckDraw(after) {
+		row, col, _ := chooseMove(after, engine.Other(p.Player), nil)
+		msg.Refutation = &protocol.Cell{Row: row, Col: col}
+	}
+	writeJSONDeadline(ws, localize(locale, msg))
+	ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(protocol.CloseGameEnded, "puzzle failed"))
+}
+
+func puzzleSolved(ws *websocket.Conn, locale string, p puzzle, b engine.Board) {
+	msg := protocol.BoardState(protocol.EventPuzzleSolved, b, "", nil)
+	msg.Code, msg.Player, msg.Goal, msg.Date = "puzzle_solved", p.Player, p.Goal, p.Date
+	writeJSONDeadline(ws, localize(locale, msg))
+	ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(protocol.CloseGameEnded, "puzzle solved"))
+}
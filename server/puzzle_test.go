@@ -0,0 +1,189 @@
+package server
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestLegalPosition(t *testing.T) {
+	tests := []struct {
+		board engine.Board
+		want  bool
+	}{
+		{boardOf("...", "...", "..."), true},
+		{boardOf("X..", "...", "..."), true},
+		{boardOf("X..", ".O.", "..."), true},
+		{boardOf("O..", "...", "..."), false},            // O moved first
+		{boardOf("XX.", "X..", "..."), false},            // X moved three times running
+		{boardOf("XXX", "OO.", "..."), false},            // X already won
+		{boardOf("XOX", "XOO", "OXX"), false},            // No cell free
+		{boardOf("X...", "....", "....", "...."), false}, // Not the classic board
+		{engine.Board{{"Δ", "", ""}, {"", "", ""}, {"", "", ""}}, false},
+	}
+	for _, tt := range tests {
+		if got := legalPosition(tt.board); got != tt.want {
+			t.Errorf("legalPosition(%v) = %v, want %v", tt.board, got, tt.want)
+		}
+	}
+}
+
+func TestParsePuzzleDate(t *testing.T) {
+	now := time.Date(2026, 3, 14, 23, 30, 0, 0, time.FixedZone("", -5*3600)) // Already the 15th in UTC
+	for v, want := range map[string]string{
+		"":           "2026-03-15",
+		"2026-03-15": "2026-03-15",
+		"2020-02-29": "2020-02-29",
+		"2026-03-16": "",
+		"2026-02-30": "",
+		"15.03.2026": "",
+	} {
+		got, ok := parsePuzzleDate(v, now)
+		if ok != (want != "") || got != want {
+			t.Errorf("parsePuzzleDate(%q) = %q, %v; want %q", v, got, ok, want)
+		}
+	}
+}
+
+// A day's puzzle is the same each time, a position a real game could
+// reach with the player on turn, and has the goal and length the search
+// gives it.
+func TestPuzzleFor(t *testing.T) {
+	for day := 1; day <= 10; day++ {
+		date := time.Date(2026, 1, day, 0, 0, 0, 0, time.UTC).Format(time.DateOnly)
+		p := puzzleFor(date)
+		if again := puzzleFor(date); !reflect.DeepEqual(p, again) {
+			t.Fatalf("%s: two different puzzles, %+v and %+v", date, p, again)
+		}
+		if !legalPosition(p.Board) {
+			t.Errorf("%s: position %v can't come up in a game", date, p.Board)
+		}
+		marks := 9 - len(freeCells(p.Board))
+		if want := map[bool]string{true: "X", false: "O"}[marks%2 == 0]; p.Player != want {
+			t.Errorf("%s: %s to play after %d marks", date, p.Player, marks)
+		}
+		best, _ := puzzleScores(p.Board, p.Player)
+		switch p.Goal {
+		case puzzleGoalWin:
+			if best <= 0 || winMoves(best) != p.Moves || p.Moves < 2 {
+				t.Errorf("%s: a win in %d, scored %d", date, p.Moves, best)
+			}
+		case puzzleGoalDraw:
+			if best != 0 || !hasLosingMove(p.Board, p.Player) {
+				t.Errorf("%s: a draw scored %d, or with no move to avoid", date, best)
+			}
+		default:
+			t.Errorf("%s: goal %q", date, p.Goal)
+		}
+	}
+}
+
+// On the socket a move onto a mark or off the board is refused and the
+// puzzle goes on; the best moves solve it; and a move that gives up the
+// result fails it, with a move that would have kept it.
+func TestPuzzleSocket(t *testing.T) {
+	srv := httptest.NewServer(NewRouter())
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		// Until both handlers are done with cfg
+		for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+			sideSockets.Lock()
+			n := len(sideSockets.set)
+			sideSockets.Unlock()
+			if n == 0 || time.Now().After(deadline) {
+				return
+			}
+		}
+	})
+	dial := func(date string) *websocket.Conn {
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws/puzzle/"+date, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ws.Close() })
+		if msg := readPuzzle(t, ws); msg.Event != protocol.EventPuzzle {
+			t.Fatalf("opened with %s, want puzzle", msg.Event)
+		}
+		return ws
+	}
+	move := func(ws *websocket.Conn, c engine.Cell) OutboundMessage {
+		ws.WriteJSON(map[string]interface{}{"event": "make_move", "row": c.Row, "col": c.Col})
+		return readPuzzle(t, ws)
+	}
+
+	const date = "2026-01-01"
+	p := puzzleFor(date)
+	ws := dial(date)
+	var taken engine.Cell
+	for _, c := range aiPreference {
+		if p.Board[c.Row][c.Col] != "" {
+			taken = c
+			break
+		}
+	}
+	if msg := move(ws, taken); msg.Event != protocol.EventInvalidMove || msg.Code != "cell_occupied" {
+		t.Errorf("move onto a mark: %s %s, want invalid_move cell_occupied", msg.Event, msg.Code)
+	}
+	if msg := move(ws, engine.Cell{Row: 0, Col: 3}); msg.Event != protocol.EventInvalidMove || msg.Code != "out_of_bounds" {
+		t.Errorf("move off the board: %s %s, want invalid_move out_of_bounds", msg.Event, msg.Code)
+	}
+	b := p.Board.Clone()
+	for i := 0; ; i++ {
+		if i == 5 {
+			t.Fatal("not solved in five moves")
+		}
+		best, scores := puzzleScores(b, p.Player)
+		var c engine.Cell
+		for _, c = range freeCells(b) {
+			if scores[c] == best {
+				break
+			}
+		}
+		b[c.Row][c.Col] = p.Player
+		msg := move(ws, c)
+		if msg.Event == protocol.EventPuzzleSolved {
+			break
+		}
+		if msg.Event != protocol.EventMove || msg.Row == nil || b[*msg.Row][*msg.Col] != "" {
+			t.Fatalf("best move %v answered with %+v", c, msg)
+		}
+		b[*msg.Row][*msg.Col] = msg.Symbol
+	}
+
+	// The first day with a move that gives up the result straight away
+	for day := 1; ; day++ {
+		date := time.Date(2026, 1, day, 0, 0, 0, 0, time.UTC).Format(time.DateOnly)
+		p := puzzleFor(date)
+		best, scores := puzzleScores(p.Board, p.Player)
+		for _, c := range freeCells(p.Board) {
+			if scores[c] == best {
+				continue
+			}
+			msg := move(dial(date), c)
+			if msg.Event != protocol.EventPuzzleFailed || msg.Solution == nil {
+				t.Fatalf("%s: losing move %v answered with %+v", date, c, msg)
+			}
+			if s := (engine.Cell{Row: msg.Solution.Row, Col: msg.Solution.Col}); scores[s] != best {
+				t.Errorf("%s: solution %v scores %d, want the best, %d", date, s, scores[s], best)
+			}
+			return
+		}
+	}
+}
+
+func readPuzzle(t *testing.T, ws *websocket.Conn) OutboundMessage {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg OutboundMessage
+	if err := ws.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
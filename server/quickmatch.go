@@ -0,0 +1,224 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"tictactoe/i18n"
+	"tictactoe/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// --- Quick Match ---
+
+// Clients connecting to /ws/quickmatch wait in a first-come queue, one per
+// tenant. As soon as two are waiting the server creates a game for them,
+// holds a seat for each and sends both a match_found with the game ID and a
+// reconnect URL carrying their seat token; from there they play as if they
+// had joined the game themselves. The first to arrive plays X. A client
+// that leaves before it is matched drops out of the queue, and a client ID
+// already waiting can't queue a second time.
+
+// quickMatchGrace is how long a matched seat waits for its player.
+const quickMatchGrace = 30 * time.Second
+
+// matchTicket is one client's place in the queue.
+type matchTicket struct {
+	identity string           // Client ID, if the client sent one
+	found    chan matchResult // Receives the match; closed on shutdown
+}
+
+// matchResult is what a matched client needs to take its seat, or the
+// error code if the game couldn't be created.
+type matchResult struct {
+	game   *Game
+	symbol string
+	token  string
+	code   string
+}
+
+// matchQueue pairs waiting clients in arrival order. It has its own lock
+// and never touches the games registry.
+type matchQueue struct {
+	mu      sync.Mutex
+	waiting map[string][]*matchTicket // By tenant, oldest first
+}
+
+var quickMatch = &matchQueue{waiting: make(map[string][]*matchTicket)}
+
+// join pairs t with the longest-waiting client of tenant, removing and
+// returning it, or queues t if nobody is waiting. It fails if t's client
+// ID is already queued.
+func (q *matchQueue) join(tenant string, t *matchTicket) (opponent *matchTicket, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	waiting := q.waiting[tenant]
+	for _, w := range waiting {
+		if t.identity != "" && w.identity == t.identity {
+			return nil, false
+		}
+	}
+	if len(waiting) == 0 {
+		q.waiting[tenant] = append(waiting, t)
+		return nil, true
+	}
+	opponent = waiting[0]
+	q.waiting[tenant] = waiting[1:]
+	if len(q.waiting[tenant]) == 0 {
+		delete(q.waiting, tenant)
+	}
+	return opponent, true
+}
+
+// leave takes t out of tenant's queue, if it is still waiting.
+func (q *matchQueue) leave(tenant string, t *matchTicket) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	waiting := q.waiting[tenant]
+	for i, w := range waiting {
+		if w == t {
+			q.waiting[tenant] = append(waiting[:i:i], waiting[i+1:]...)
+			break
+		}
+	}
+	if len(q.waiting[tenant]) == 0 {
+		delete(q.waiting, tenant)
+	}
+}
+
+// close empties the queue, closing every waiting ticket's channel.
+func (q *matchQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for tenant, waiting := range q.waiting {
+		for _, t := range waiting {
+			close(t.found)
+		}
+		delete(q.waiting, tenant)
+	}
+}
+
+// startMatch creates a tenant game for two queued clients and holds its
+// seats for them, returning X's result and O's.
+func startMatch(tenant string) (x, o matchResult) {
+	gamesMutex.Lock()
+	if code := gameLimitCode(tenant); code != "" {
+		gamesMutex.Unlock()
+		return matchResult{code: code}, matchResult{code: code}
+	}
+	id := newGameID()
+	for games[gameKey{tenant, id}] != nil {
+		id = newGameID()
+	}
+	game := newGame(id)
+	game.Tenant = tenant
+	game.ExpiresAt = time.Now().Add(cfg.LobbyTTL)
+	registerGame(game)
+	gamesMutex.Unlock()
+
+	game.do(func() {
+		until := time.Now().Add(quickMatchGrace)
+		seat := func(symbol string) matchResult {
+			token := issueSeatToken(game, symbol)
+			game.Reserved[symbol] = token
+			game.HeldUntil[symbol] = until
+			game.releaseAt(symbol, token, until)
+			return matchResult{game: game, symbol: symbol, token: token}
+		}
+		game.logger().Info("game created", "via", "quickmatch")
+		x, o = seat("X"), seat("O")
+	})
+	return x, o
+}
+
+// quickMatchSocket serves /ws/quickmatch: a queued notice, then a
+// match_found once an opponent turns up, after which the server closes the
+// socket. Anything the client sends is ignored.
+func quickMatchSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Warn("websocket upgrade failed", "path", r.URL.Path, "remote", logRemote(r), "err", err)
+		metrics.UpgradeFailures.Add(1)
+		return
+	}
+	defer ws.Close()
+	defer trackSocket(ws, r)()
+	metrics.Connections.Add(1)
+	defer metrics.Connections.Add(-1)
+
+	locale := i18n.Resolve(declaredLocale(r), "")
+	tenant := requestTenant(r)
+	t := &matchTicket{identity: requestIdentity(r), found: make(chan matchResult, 1)}
+	opponent, ok := quickMatch.join(tenant, t)
+	if !ok {
+		writeJSONDeadline(ws, localize(locale, protocol.Failure("already_queued", "")))
+		return
+	}
+	if opponent != nil {
+		x, o := startMatch(tenant)
+		opponent.found <- x
+		sendMatch(ws, r, locale, o)
+		return
+	}
+	defer quickMatch.leave(tenant, t)
+
+	if writeJSONDeadline(ws, localize(locale, protocol.Notice(protocol.EventQueued, "waiting_for_opponent"))) != nil {
+		return
+	}
+	ws.SetReadLimit(maxInboundSize)
+	ws.SetReadDeadline(time.Now().Add(readTimeout()))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(readTimeout()))
+	})
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(cfg.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case res, ok := <-t.found:
+			if !ok {
+				msg := websocket.FormatCloseMessage(protocol.CloseShutdown, "server shutdown")
+				ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+				return
+			}
+			sendMatch(ws, r, locale, res)
+			return
+		case <-ticker.C:
+			if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(cfg.WriteTimeout)); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
+
+// sendMatch tells the client where its seat is, or why there is none, and
+// closes the quick match socket.
+func sendMatch(ws *websocket.Conn, r *http.Request, locale string, res matchResult) {
+	if res.code != "" {
+		writeJSONDeadline(ws, localize(locale, protocol.Failure(res.code, "")))
+		return
+	}
+	writeJSONDeadline(ws, OutboundMessage{
+		Event:        protocol.EventMatchFound,
+		GameID:       res.game.ID,
+		Player:       res.symbol,
+		Token:        res.token,
+		ReconnectURL: reconnectURL(r, res.game, res.token),
+	})
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "matched")
+	ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"tictactoe/rating"
+)
+
+const (
+	leaderboardDefault = 10
+	leaderboardMax     = 100
+)
+
+// --- Rated Games ---
+
+// ratedPlayers returns the seated X and O players if this round counts
+// towards ratings: the game is rated and both seats belong to distinct known
+// identities. Runs on the game's loop.
+func (game *Game) ratedPlayers() (x, o *Player, ok bool) {
+	if !game.Rated {
+		return nil, nil, false
+	}
+	for _, p := range game.Players {
+		switch p.Symbol {
+		case "X":
+			x = p
+		case "O":
+			o = p
+		}
+	}
+	if x == nil || o == nil || x.Identity == "" || o.Identity == "" || x.Identity == o.Identity {
+		return nil, nil, false
+	}
+	return x, o, true
+}
+
+// currentRecord is identity's standing in tenant, or a fresh one at
+// rating.Initial if they have none yet or it can't be loaded.
+func currentRecord(tenant, identity string) PlayerRecord {
+	rec, ok, err := store.LoadPlayer(tenant, identity)
+	if err != nil {
+		slog.Error("loading player", "tenant", tenant, "identity", identity, "err", err)
+	}
+	if err != nil || !ok {
+		return PlayerRecord{Identity: identity, Rating: rating.Initial}
+	}
+	return rec
+}
+
+// standing is p's record as the game holds it: read by join before it
+// sent its command, and kept up to date with the rounds rated since. Runs
+// on the game's loop.
+func (p *Player) standing() PlayerRecord {
+	if p.record == nil {
+		return PlayerRecord{Identity: p.Identity, Rating: rating.Initial}
+	}
+	return *p.record
+}
+
+// withStakes adds current ratings and each player's win/draw/loss stakes to
+// a round-start message. Runs on the game's loop.
+func (game *Game) withStakes(msg OutboundMessage) OutboundMessage {
+	x, o, ok := game.ratedPlayers()
+	if !ok {
+		return msg
+	}
+	rx, ro := x.standing().Rating, o.standing().Rating
+	msg.Ratings = map[string]int{"X": rx, "O": ro}
+	msg.Stakes = map[string]rating.Stakes{"X": rating.Preview(rx, ro), "O": rating.Preview(ro, rx)}
+	return msg
+}
+
+// withRatingUpdate applies the finished round to both players' records and
+// adds the rating deltas and new ratings to the result message. winner is ""
+// for a draw. A round is only ever rated once, and both records are saved
+// together or not at all. The deltas come from the ratings the game holds;
+// the save, on the store queue, applies them to the records as stored
+// then, which may have moved on with a round rated in another game.
+// Runs on the game's loop.
+func (game *Game) withRatingUpdate(msg OutboundMessage, winner string) OutboundMessage {
+	x, o, ok := game.ratedPlayers()
+	if !ok || game.RatedRound == game.Round {
+		return msg
+	}
+	game.RatedRound = game.Round
+	resultX := rating.Draw
+	switch winner {
+	case "X":
+		resultX = rating.Win
+	case "O":
+		resultX = rating.Loss
+	}
+	recX, recO := x.standing(), o.standing()
+	rx, ro := recX.Rating, recO.Rating
+	dx, do := rating.Delta(rx, ro, resultX), rating.Delta(ro, rx, rating.Win-resultX)
+	recX.record(x.Name, dx, resultX)
+	recO.record(o.Name, do, rating.Win-resultX)
+	x.record, o.record = &recX, &recO
+
+	tenant, idX, idO, nameX, nameO, log := game.Tenant, x.Identity, o.Identity, x.Name, o.Name, game.logger()
+	game.storeLater(func() {
+		recX, recO := currentRecord(tenant, idX), currentRecord(tenant, idO)
+		recX.record(nameX, dx, resultX)
+		recO.record(nameO, do, rating.Win-resultX)
+		if err := store.SavePlayers(tenant, recX, recO); err != nil {
+			log.Error("saving ratings", "x", idX, "o", idO, "err", err)
+		}
+	})
+	msg.RatingDelta = map[string]int{"X": dx, "O": do}
+	msg.Ratings = map[string]int{"X": rx + dx, "O": ro + do}
+	return msg
+}
+
+// record counts one rated round ending in result, played under name, and
+// moves the rating by delta.
+func (rec *PlayerRecord) record(name string, delta int, result rating.Result) {
+	if name != "" {
+		rec.Name = name
+	}
+	rec.Rating += delta
+	rec.Games++
+	switch result {
+	case rating.Win:
+		rec.Wins++
+	case rating.Loss:
+		rec.Losses++
+	default:
+		rec.Draws++
+	}
+}
+
+// public is rec as the leaderboard shows it, without the identity.
+func (rec PlayerRecord) public() PlayerRecord {
+	rec.Identity = ""
+	return rec
+}
+
+// getLeaderboard lists the tenant's top rated players, limit of them
+// (default 10).
+func getLeaderboard(w http.ResponseWriter, r *http.Request) {
+	limit := leaderboardDefault
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > leaderboardMax {
+			writeErrorDetail(w, r, http.StatusBadRequest, "invalid_limit", "limit must be 1 to "+strconv.Itoa(leaderboardMax))
+			return
+		}
+		limit = n
+	}
+	top, err := store.ListTopPlayers(requestTenant(r), limit)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+	for i := range top {
+		top[i] = top[i].public()
+	}
+	writeJSON(w, http.StatusOK, top)
+}
+
+// getPlayer returns the record of the latest player rated under the name
+// in the tenant.
+func getPlayer(w http.ResponseWriter, r *http.Request) {
+	rec, ok, err := store.FindPlayer(requestTenant(r), mux.Vars(r)["name"])
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "player_not_found")
+		return
+	}
+	writeJSON(w, http.StatusOK, rec.public())
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"tictactoe/config"
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// Each tenant has its own leaderboard and its own players by name.
+func TestRatingsPerTenant(t *testing.T) {
+	withConfig(t, func(c *config.Config) { c.DynamicTenants = true })
+	old := store
+	store = newMemoryStore()
+	t.Cleanup(func() { store = old })
+	must(t, store.SavePlayers(config.DefaultTenant, PlayerRecord{Identity: "id-a", Name: "ann", Rating: 1300, Games: 1, Wins: 1}))
+	must(t, store.SavePlayers("acme", PlayerRecord{Identity: "id-b", Name: "ann", Rating: 1100, Games: 1, Losses: 1}))
+	router := NewRouter()
+	get := func(path string, v interface{}) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		json.NewDecoder(w.Body).Decode(v)
+		return w.Code
+	}
+
+	for path, want := range map[string]int{"/leaderboard": 1300, "/t/acme/leaderboard": 1100} {
+		var top []PlayerRecord
+		if code := get(path, &top); code != http.StatusOK || len(top) != 1 || top[0].Rating != want {
+			t.Errorf("GET %s: %d %+v, want only the player rated %d", path, code, top, want)
+		}
+	}
+	for path, want := range map[string]int{"/players/ann": 1300, "/t/acme/players/ann": 1100} {
+		var rec PlayerRecord
+		if code := get(path, &rec); code != http.StatusOK || rec.Rating != want || rec.Identity != "" {
+			t.Errorf("GET %s: %d %+v, want the tenant's ann, rated %d, without an identity", path, code, rec, want)
+		}
+	}
+	var body map[string]string
+	if code := get("/t/other/players/ann", &body); code != http.StatusNotFound {
+		t.Errorf("GET /t/other/players/ann: %d, want 404 from a tenant nobody was rated in", code)
+	}
+}
+
+// The stakes start_game shows are the deltas the result applies: a win
+// for the starter moves both ratings by what each was told it would.
+func TestStakesMatchAppliedDelta(t *testing.T) {
+	quickGames(t)
+	old := store
+	store = newMemoryStore()
+	t.Cleanup(func() {
+		flush(t)
+		store = old
+	})
+	must(t, store.SavePlayers(config.DefaultTenant,
+		PlayerRecord{Identity: "id-stakes-x", Rating: 1400},
+		PlayerRecord{Identity: "id-stakes-o", Rating: 1200}))
+	id := unusedGameID()
+	game := newGame(id)
+	game.Rated = true
+	gamesMutex.Lock()
+	registerGame(game)
+	gamesMutex.Unlock()
+	x, xc := joinFake(t, id, "client_id=id-stakes-x")
+	o, oc := joinFake(t, id, "client_id=id-stakes-o")
+	start := xc.expect(t, protocol.EventStartGame)
+	oc.expect(t, protocol.EventStartGame)
+	if want := (map[string]int{x.Symbol: 1400, o.Symbol: 1200}); !reflect.DeepEqual(start.Ratings, want) {
+		t.Fatalf("start_game ratings %v, want %v", start.Ratings, want)
+	}
+
+	players := map[string]*Player{x.Symbol: x, o.Symbol: o}
+	first, second := players[start.CurrentPlayer], players[engine.Other(start.CurrentPlayer)]
+	for i, cell := range [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {0, 2}} {
+		p := first
+		if i%2 == 1 {
+			p = second
+		}
+		p.receive([]byte(fmt.Sprintf(`{"event":"make_move","row":%d,"col":%d}`, cell[0], cell[1])), newFlood(), gameRequest(id, ""))
+	}
+	win := xc.expect(t, protocol.EventWin)
+	want := map[string]int{first.Symbol: start.Stakes[first.Symbol].Win, second.Symbol: start.Stakes[second.Symbol].Loss}
+	if !reflect.DeepEqual(win.RatingDelta, want) {
+		t.Errorf("applied deltas %v, want the stakes shown, %v", win.RatingDelta, want)
+	}
+	for symbol, r := range start.Ratings {
+		if win.Ratings[symbol] != r+want[symbol] {
+			t.Errorf("%s rated %d after the round, want %d%+d", symbol, win.Ratings[symbol], r, want[symbol])
+		}
+	}
+}
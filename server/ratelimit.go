@@ -0,0 +1,72 @@
+package server
+
+import (
+	"time"
+
+	"tictactoe/protocol"
+)
+
+// --- Inbound Rate Limiting ---
+
+// Every connection may send cfg.InboundRate messages a second, with bursts
+// of up to cfg.InboundBurst. Messages beyond that are refused unread, the
+// first of a run with a rate_limited warning; a client that keeps going for
+// cfg.FloodLimit messages in a row is disconnected.
+
+// tokenBucket holds up to burst tokens, refilled at rate a second. It is not
+// safe for concurrent use; each read loop owns its own.
+type tokenBucket struct {
+	rate, burst float64
+	tokens      float64
+	last        time.Time
+}
+
+func newTokenBucket(rate, burst int) *tokenBucket {
+	return &tokenBucket{rate: float64(rate), burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Allow takes a token if one is left at now, reporting whether it did.
+func (b *tokenBucket) Allow(now time.Time) bool {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// flood tracks a connection's refused messages.
+type flood struct {
+	bucket  *tokenBucket
+	refused int // In a row
+}
+
+func newFlood() *flood {
+	return &flood{bucket: newTokenBucket(cfg.InboundRate, cfg.InboundBurst)}
+}
+
+// check admits or refuses a message arriving now. A refused one is answered
+// with a warning when it starts a run, and once the run reaches
+// cfg.FloodLimit the connection is closed after the warning.
+func (f *flood) check(p *Player, now time.Time) bool {
+	if f.bucket.Allow(now) {
+		f.refused = 0
+		return true
+	}
+	f.refused++
+	metrics.RateLimited.Add(1)
+	if f.refused == 1 {
+		p.send(localize(p.locale(), protocol.Failure("rate_limited", "")))
+	}
+	if f.refused == cfg.FloodLimit {
+		p.logger().Warn("flooding, closing connection", "refused", f.refused)
+		p.closeAfterFlush(protocol.CloseRateLimited, "rate limited")
+	}
+	return false
+}
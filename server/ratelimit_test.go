@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"tictactoe/config"
+	"tictactoe/protocol"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+	b := newTokenBucket(2, 3)
+	b.last = start
+	for i := 0; i < 3; i++ {
+		if !b.Allow(start) {
+			t.Fatalf("message %d of a burst of 3 refused", i+1)
+		}
+	}
+	if b.Allow(start) {
+		t.Fatal("a fourth message at once was allowed")
+	}
+	if b.Allow(start.Add(400 * time.Millisecond)) {
+		t.Error("allowed with 0.8 of a token refilled")
+	}
+	if !b.Allow(start.Add(500 * time.Millisecond)) {
+		t.Error("refused with a token refilled at 2 a second")
+	}
+	if b.Allow(start.Add(500 * time.Millisecond)) {
+		t.Error("the refilled token was taken twice")
+	}
+
+	// A long quiet spell refills only up to the burst
+	later := start.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !b.Allow(later) {
+			t.Fatalf("message %d after an hour refused", i+1)
+		}
+	}
+	if b.Allow(later) {
+		t.Error("an hour's quiet refilled past the burst")
+	}
+
+	// A clock read that goes backwards adds nothing
+	if b.Allow(later.Add(-time.Minute)) {
+		t.Error("a reading before the last one refilled the bucket")
+	}
+}
+
+// A refused run is warned about once, when it starts; a message let
+// through ends it; and one FloodLimit long closes the connection.
+func TestFloodCheck(t *testing.T) {
+	quickGames(t)
+	withConfig(t, func(c *config.Config) {
+		c.InboundRate = 1
+		c.InboundBurst = 1
+		c.FloodLimit = 3
+	})
+	p, c := joinFake(t, unusedGameID(), "")
+	warnings := func() (n int) {
+		for {
+			select {
+			case msg := <-c.msgs:
+				if msg.Code == "rate_limited" {
+					n++
+				}
+			case <-time.After(50 * time.Millisecond):
+				return n
+			}
+		}
+	}
+	warnings() // Whatever joining sent
+
+	f := newFlood()
+	now := f.bucket.last
+	if !f.check(p, now) {
+		t.Fatal("the first message was refused")
+	}
+	if f.check(p, now) || f.check(p, now) {
+		t.Fatal("allowed past the burst")
+	}
+	if n := warnings(); n != 1 {
+		t.Errorf("%d warnings for a run of 2, want 1", n)
+	}
+	now = now.Add(time.Second)
+	if !f.check(p, now) || f.refused != 0 {
+		t.Fatalf("refused %d in a row after a second's refill, want the run ended", f.refused)
+	}
+
+	for i := 0; i < 3; i++ {
+		f.check(p, now)
+	}
+	if n := warnings(); n != 1 {
+		t.Errorf("%d warnings for the second run, want 1", n)
+	}
+	select {
+	case <-c.closed:
+	case <-time.After(time.Second):
+		t.Fatal("not closed after FloodLimit refusals")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.frames) != 1 || binary.BigEndian.Uint16(c.frames[0]) != protocol.CloseRateLimited {
+		t.Errorf("close frames %q, want one CloseRateLimited", c.frames)
+	}
+}
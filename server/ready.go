@@ -0,0 +1,199 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// --- Ready Check ---
+
+// readyCheck holds back the start of a round until both players send ready.
+type readyCheck struct {
+	Event     protocol.Event  // start_game or new_game, sent once both are ready
+	Ready     map[string]bool // By symbol
+	Cancelled bool            // Timed out under -ready-timeout-policy=cancel; the next ready asks again
+}
+
+// roundMessage is the event announcing the round, with everything a client
+// needs to draw it. Runs on the game's loop.
+func (game *Game) roundMessage(event protocol.Event) OutboundMessage {
+	msg := protocol.BoardState(event, game.Board, game.CurrentPlayer, &game.Score)
+	msg.Spectators = game.spectatorCount()
+	msg.Names = game.playerNames()
+	msg.Ultimate = game.ultimateBoard()
+	msg.Clocks = game.clocks()
+	msg.LegalMoves = game.legalMoves()
+	msg.Fading = game.fading()
+	game.deadlines(&msg, false)
+	if event == protocol.EventStartGame || event == protocol.EventNewGame {
+		msg.StarterPolicy = game.starterPolicy()
+		msg.Settings = game.settings()
+		msg.Rounds = game.recentRounds()
+		game.roundLimit(&msg)
+	}
+	if event == protocol.EventStartGame {
+		msg.Participants = game.participants()
+		msg.Locale = game.Locale
+		msg.WinConditions = engine.ConditionNames(game.WinConditions)
+		msg.Size, msg.WinLength = game.Board.Size(), game.winLength()
+		msg.BestOf = game.bestOf()
+		if game.AI != "" {
+			msg.Difficulty = game.AIDifficulty
+		}
+		msg.Variant = game.variant()
+		msg.OpeningStats, _ = game.openingStats()
+		if game.ultimate() {
+			msg.WinLength = 0 // Won on the meta-board, not in a row
+		}
+	}
+	return game.withStakes(msg)
+}
+
+// startRound announces the round with event, first asking both players
+// whether they're ready if the game wants that. A round already under way,
+// or one against the computer, is never held back. Runs on the game's
+// loop.
+func (game *Game) startRound(event protocol.Event) {
+	if event == protocol.EventStartGame && game.awaitingSettings() {
+		game.offerSettings()
+		return
+	}
+	if game.ReadyCheck && game.AI == "" && len(game.Moves) == 0 && !game.roundOver() {
+		game.askReady(event)
+		return
+	}
+	game.beginRound(event)
+}
+
+// beginRound ends any ready check and lets play start, after the start
+// countdown if there is one. Runs on the game's loop.
+func (game *Game) beginRound(event protocol.Event) {
+	game.Ready = nil
+	game.stopReadyTimeout()
+	if event == protocol.EventStartGame {
+		game.flipCoin()
+	}
+	if game.countDown(event) {
+		return
+	}
+	game.openRound(event)
+}
+
+// openRound announces the round with event and starts its timers. Runs
+// on the game's loop.
+func (game *Game) openRound(event protocol.Event) {
+	if game.RoundStartedAt.IsZero() {
+		game.RoundStartedAt = time.Now()
+	}
+	if game.SeriesStartedAt.IsZero() {
+		game.SeriesStartedAt = game.RoundStartedAt
+	}
+	if event == protocol.EventStartGame {
+		game.seedHeadToHead()
+		game.stats.started = true
+		if game.StartedAt.IsZero() {
+			game.StartedAt = time.Now()
+		}
+	}
+	game.startDeadlines()
+	game.journal.state("round_started", strconv.Itoa(game.Round))
+	broadcast(game, game.roundMessage(event))
+	game.armReminder()
+	game.armTurnTimer()
+	game.runClock()
+	game.armAI()
+}
+
+// askReady broadcasts ready_check for the round event announces. Players
+// who already said ready to a check still pending stay ready, so a seat
+// that drops and returns doesn't cost the other player their answer.
+// Runs on the game's loop.
+func (game *Game) askReady(event protocol.Event) {
+	rc := game.Ready
+	if rc == nil || rc.Cancelled {
+		rc = &readyCheck{Ready: make(map[string]bool)}
+		game.Ready = rc
+	}
+	rc.Event = event
+	msg := protocol.Notice(protocol.EventReadyCheck, "ready_check")
+	if cfg.ReadyTimeout > 0 {
+		deadline := time.Now().Add(cfg.ReadyTimeout).UTC()
+		msg.Deadline = &deadline
+	}
+	broadcast(game, msg)
+	for _, p := range game.Players {
+		if rc.Ready[p.Symbol] {
+			broadcast(game, OutboundMessage{Event: protocol.EventOpponentReady, Player: p.Symbol, From: p.participant(), Code: "opponent_ready"})
+		}
+	}
+	game.armReadyTimeout()
+}
+
+// handleReady records p's answer and starts the round once both players
+// have given theirs. A ready after a cancelled check asks again. Runs
+// on the game's loop.
+func (game *Game) handleReady(p *Player) {
+	rc := game.Ready
+	if rc == nil {
+		return // Nothing to answer
+	}
+	if rc.Cancelled {
+		game.askReady(rc.Event)
+		rc = game.Ready
+	}
+	if rc.Ready[p.Symbol] {
+		return
+	}
+	rc.Ready[p.Symbol] = true
+	broadcast(game, OutboundMessage{Event: protocol.EventOpponentReady, Player: p.Symbol, From: p.participant(), Code: "opponent_ready"})
+	if len(rc.Ready) == game.seats() && len(game.Players) == game.seats() {
+		game.beginRound(rc.Event)
+	}
+}
+
+// leaveReadyCheck forgets a departing player's answer and stops the clock
+// until the seat is filled again, when the check is asked anew. Runs
+// on the game's loop.
+func (game *Game) leaveReadyCheck(p *Player) {
+	if game.Ready == nil {
+		return
+	}
+	delete(game.Ready.Ready, p.Symbol)
+	game.stopReadyTimeout()
+}
+
+func (game *Game) armReadyTimeout() {
+	game.stopReadyTimeout()
+	if cfg.ReadyTimeout <= 0 || len(game.Players) < 2 {
+		return
+	}
+	gen := game.readyGen
+	game.readyTimer = time.AfterFunc(cfg.ReadyTimeout, func() {
+		game.do(func() {
+			if game.readyGen != gen || game.Ready == nil || game.closed {
+				return
+			}
+			game.readyTimer = nil
+			game.journal.timer("ready_timeout")
+			if cfg.ReadyTimeoutPolicy == "start" {
+				game.beginRound(game.Ready.Event)
+				return
+			}
+			game.Ready.Cancelled = true
+			broadcast(game, protocol.Notice(protocol.EventReadyCancelled, "ready_check_cancelled"))
+		})
+	})
+}
+
+// stopReadyTimeout cancels a pending timeout, including one that already
+// fired and is waiting its turn on the loop. Runs on the game's loop.
+func (game *Game) stopReadyTimeout() {
+	if game.readyTimer != nil {
+		game.readyTimer.Stop()
+		game.readyTimer = nil
+	}
+	game.readyGen++
+}
@@ -0,0 +1,72 @@
+package server
+
+import "tictactoe/protocol"
+
+// --- Rematch ---
+
+// Once a round is won or drawn, each player sends rematch_request, and the
+// next round starts when every seat has. The first request is broadcast
+// as rematch_requested, so the others can be asked; a repeat from the same
+// player changes nothing and is let pass quietly. A request while the round
+// is still on is refused. Any other player may turn the offer down with
+// rematch_decline, which drops every pending request and tells the game
+// with rematch_declined. A player leaving drops them too, since the offer
+// was made to the ones at the table, except in correspondence games, where
+// coming and going is normal. The computer always accepts.
+
+// handleRematch runs p's rematch_request. Runs on the game's loop.
+func (game *Game) handleRematch(p *Player) {
+	if !game.roundOver() {
+		p.send(localize(p.locale(), protocol.Failure("round_in_progress", "")))
+		return
+	}
+	if game.RematchRequests[p.Symbol] {
+		return // Asked already
+	}
+	game.RematchRequests[p.Symbol] = true
+	if len(game.RematchRequests) == 1 {
+		game.stats.rematchOffers++
+		broadcast(game, OutboundMessage{Event: protocol.EventRematchRequested, Player: p.Symbol, From: p.participant()})
+	}
+	if game.AI != "" {
+		game.RematchRequests[game.AI] = true // The computer is always up for another
+	}
+
+	if len(game.RematchRequests) == game.seats() {
+		// --- Alternating Logic ---
+		game.stats.rematchesAccepted++
+		metrics.Rematches.Add(1)
+		nextStarter := game.nextStarter()
+		game.archiveRound()
+
+		game.StartingPlayerForRound = nextStarter
+		resetGameBoard(game, nextStarter)
+
+		game.startRound(protocol.EventNewGame)
+	}
+}
+
+// declineRematch runs p's rematch_decline, turning down the offer another
+// player made. Runs on the game's loop.
+func (game *Game) declineRematch(p *Player) {
+	offeredBy := ""
+	for symbol := range game.RematchRequests {
+		if symbol != p.Symbol {
+			offeredBy = symbol
+		}
+	}
+	if offeredBy == "" {
+		p.send(localize(p.locale(), protocol.Failure("no_rematch_offer", "")))
+		return
+	}
+	game.clearRematch()
+	broadcast(game, OutboundMessage{Event: protocol.EventRematchDeclined, Player: offeredBy, From: p.participant(), Code: "rematch_declined"})
+}
+
+// clearRematch drops every pending rematch request. Runs on the game's
+// loop.
+func (game *Game) clearRematch() {
+	if len(game.RematchRequests) > 0 {
+		game.RematchRequests = make(map[string]bool)
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"time"
+
+	"tictactoe/protocol"
+)
+
+// --- Turn Reminders ---
+
+// A player quiet on their turn is nudged with your_turn_reminder, sent to
+// them alone, after cfg.TurnReminder. After cfg.IdleNotice the others get
+// opponent_idle, once a turn, so they know what the wait is; when the idle
+// player then moves they get opponent_active to clear it. Neither forfeits
+// anything, unlike a turn timer. Both are re-armed on every turn and
+// cancelled whenever the round stops for any reason: a win or draw, a
+// rematch, a disconnect or a pause. They run on game.clock.
+
+// maxTurnReminders caps the nudges per turn: the first after
+// cfg.TurnReminder of quiet, then each after double the previous wait.
+const maxTurnReminders = 3
+
+// armReminder (re)starts the reminder and idle notice for the current
+// player's turn. It does nothing unless both players are seated and the
+// round is in play. Correspondence games are reminded against their
+// deadline by checkTurnDeadline instead. Runs on the game's loop.
+func (game *Game) armReminder() {
+	game.cancelReminder()
+	if len(game.Players) < 2 || game.paused() || game.Ready != nil || game.scheduled() || game.starting() || game.Correspondence || game.roundOver() {
+		return
+	}
+	if cfg.TurnReminder > 0 {
+		game.scheduleReminder(cfg.TurnReminder, 0)
+	}
+	if cfg.IdleNotice > 0 {
+		game.scheduleIdleNotice()
+	}
+}
+
+// cancelReminder stops any pending reminder and idle notice. Runs on
+// the game's loop.
+func (game *Game) cancelReminder() {
+	if game.reminder != nil {
+		game.reminder.Stop()
+		game.reminder = nil
+	}
+	if game.idleTimer != nil {
+		game.idleTimer.Stop()
+		game.idleTimer = nil
+	}
+	// A timer that already fired may be waiting its turn on the loop; the
+	// bumped generation tells it to stand down.
+	game.reminderGen++
+	game.idleSymbol = ""
+}
+
+func (game *Game) scheduleReminder(wait time.Duration, sent int) {
+	gen := game.reminderGen
+	game.reminder = game.clock.AfterFunc(wait, func() {
+		game.do(func() {
+			if game.reminderGen != gen {
+				return
+			}
+			game.journal.timer("turn_reminder")
+			for _, p := range game.Players {
+				if p.Symbol == game.CurrentPlayer {
+					p.send(localize(p.locale(), OutboundMessage{
+						Event:  protocol.EventTurnReminder,
+						Player: p.Symbol,
+						Code:   "your_turn_reminder",
+					}))
+				}
+			}
+			if sent+1 < maxTurnReminders {
+				game.scheduleReminder(2*wait, sent+1)
+			} else {
+				game.reminder = nil
+			}
+		})
+	})
+}
+
+func (game *Game) scheduleIdleNotice() {
+	gen := game.reminderGen
+	game.idleTimer = game.clock.AfterFunc(cfg.IdleNotice, func() {
+		game.do(func() {
+			if game.reminderGen != gen {
+				return
+			}
+			game.idleTimer = nil
+			game.journal.timer("idle_notice")
+			game.idleSymbol = game.CurrentPlayer
+			game.tellOthers(game.idleSymbol, protocol.EventOpponentIdle)
+		})
+	})
+}
+
+// playerActive tells the others that symbol, announced idle, has moved.
+// Runs on the game's loop.
+func (game *Game) playerActive(symbol string) {
+	if game.idleSymbol != symbol {
+		return
+	}
+	game.idleSymbol = ""
+	game.tellOthers(symbol, protocol.EventOpponentActive)
+}
+
+// tellOthers sends event about symbol to every other seated player.
+// Runs on the game's loop.
+func (game *Game) tellOthers(symbol string, event protocol.Event) {
+	for _, p := range game.Players {
+		if p.Symbol != symbol {
+			p.send(localize(p.locale(), OutboundMessage{Event: event, Player: symbol, Code: string(event)}))
+		}
+	}
+}
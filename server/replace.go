@@ -0,0 +1,39 @@
+package server
+
+import (
+	"tictactoe/protocol"
+)
+
+// --- Replacement Players ---
+
+// A seat whose player left mid-series opens once their grace period runs
+// out, and the next connection to the game takes it over. The newcomer
+// inherits the seat's score, but not a round they never saw: one under way
+// is replayed from a fresh board with the same starter. A departed player
+// who returns before anyone else takes the seat resumes where they left.
+
+// midSeries reports whether the game has been played in: a move made, a
+// round finished or a point scored. Runs on the game's loop.
+func (game *Game) midSeries() bool {
+	return len(game.Moves) > 0 || game.Round > 1 || game.Score != (Score{})
+}
+
+// takeOverSeat seats newcomer p in a game someone else left mid-series.
+// The waiting player hears opponent_joined, and the round in play starts
+// over. It reports whether p
+// replaced anyone. Runs on the game's loop.
+func (game *Game) takeOverSeat(p *Player) bool {
+	if game.Correspondence || !game.midSeries() {
+		return false
+	}
+	game.logger().Info("seat taken over", "seat", p.Symbol, "score_x", game.Score.X, "score_o", game.Score.O)
+	for _, other := range game.Players {
+		if other != p {
+			other.send(localize(other.locale(), OutboundMessage{Event: protocol.EventOpponentJoined, From: p.participant(), Code: "opponent_joined"}))
+		}
+	}
+	if len(game.Moves) > 0 && !game.roundOver() {
+		resetGameBoard(game, game.StartingPlayerForRound)
+	}
+	return true
+}
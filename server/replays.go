@@ -0,0 +1,230 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+	"tictactoe/replay"
+)
+
+// --- Round Replays ---
+
+// Every round keeps its moves with the time each was accepted, up to the
+// last maxHistoryRounds. GET /games/{game_id}/replays lists them with each
+// move's time into the round, and /replay/{game_id}/{round} plays one back
+// over a websocket as the events a live game sends, start_game, move and
+// the result, so the regular client draws it. Pauses keep their original
+// length up to maxReplayGap.
+
+const (
+	maxReplayGap     = 3 * time.Second
+	missingReplayGap = time.Second // Between moves recorded without a time
+)
+
+type replayMove struct {
+	Player    string `json:"player"`
+	Row       int    `json:"row"`
+	Col       int    `json:"col"`
+	Skipped   bool   `json:"skipped,omitempty"`
+	Mark      string `json:"mark,omitempty"`       // Wild games: the symbol marked, if not the player's own
+	ElapsedMS *int64 `json:"elapsed_ms,omitempty"` // Since the round began; absent if the move has no time
+}
+
+type replayRound struct {
+	Round       int          `json:"round"`
+	Starter     string       `json:"starter"`
+	Result      string       `json:"result,omitempty"`
+	Timeout     bool         `json:"timeout,omitempty"`
+	Conceded    bool         `json:"conceded,omitempty"`
+	Adjudicated bool         `json:"adjudicated,omitempty"`
+	StartedAt   *time.Time   `json:"started_at,omitempty"`
+	Moves       []replayMove `json:"moves"`
+}
+
+// roundStartedAt is when play began on the current board, or nil if it
+// hasn't. Runs on the game's loop.
+func (game *Game) roundStartedAt() *time.Time {
+	if game.RoundStartedAt.IsZero() {
+		return nil
+	}
+	t := game.RoundStartedAt.UTC()
+	return &t
+}
+
+// roundStart is the time round's moves are measured from: when it began,
+// or for rounds recorded before that was kept, its first move.
+func roundStart(round replay.Round) *time.Time {
+	if round.StartedAt != nil {
+		return round.StartedAt
+	}
+	if len(round.Moves) > 0 {
+		return round.Moves[0].At
+	}
+	return nil
+}
+
+func newReplayRound(n int, round replay.Round) replayRound {
+	out := replayRound{
+		Round:       n,
+		Starter:     round.Starter,
+		Result:      round.Result,
+		Timeout:     round.Timeout,
+		Conceded:    round.Conceded,
+		Adjudicated: round.Adjudicated,
+		StartedAt:   round.StartedAt,
+		Moves:       make([]replayMove, 0, len(round.Moves)),
+	}
+	start := roundStart(round)
+	for _, mv := range round.Moves {
+		m := replayMove{Player: mv.Player, Row: mv.Row, Col: mv.Col, Skipped: mv.Skipped, Mark: mv.Mark}
+		if start != nil && mv.At != nil {
+			ms := mv.At.Sub(*start).Milliseconds()
+			m.ElapsedMS = &ms
+		}
+		out.Moves = append(out.Moves, m)
+	}
+	return out
+}
+
+// getReplays serves every recorded round of a game, oldest first.
+func getReplays(w http.ResponseWriter, r *http.Request) {
+	key := requestGameKey(r)
+	g, ok := loadRecordedGame(w, r, key)
+	if !ok {
+		return
+	}
+	out := make([]replayRound, 0, len(g.rounds))
+	for i, round := range g.rounds {
+		out = append(out, newReplayRound(g.first+i, round))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"game_id": key.ID, "rounds": out})
+}
+
+// replaySocket plays one recorded round back and closes.
+func replaySocket(w http.ResponseWriter, r *http.Request) {
+	g, ok := loadRecordedGame(w, r, requestGameKey(r))
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(mux.Vars(r)["round"])
+	if err != nil || n < g.first || n >= g.first+len(g.rounds) {
+		writeErrorDetail(w, r, http.StatusNotFound, "round_not_found",
+			"recorded rounds are "+strconv.Itoa(g.first)+" to "+strconv.Itoa(g.first+len(g.rounds)-1))
+		return
+	}
+	round := g.rounds[n-g.first]
+	m, err := replay.Start(round, g.size, g.players, g.wins)
+	if err != nil {
+		writeErrorDetail(w, r, http.StatusUnprocessableEntity, "invalid_state", err.Error())
+		return
+	}
+
+	locale := declaredLocale(r)
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		metrics.UpgradeFailures.Add(1)
+		return
+	}
+	defer ws.Close()
+	// Nothing is read but the close, which ends the playback early
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	start := protocol.BoardState(protocol.EventStartGame, m.Board, round.Starter, nil)
+	start.Size = m.Board.Size()
+	if v := engine.Variant(m.Conditions); v != engine.Classic {
+		start.Variant = v
+	}
+	if engine.IsUltimate(m.Conditions) {
+		start.Ultimate = ultimateView(m.Board, nil, false)
+	}
+	if err := writeJSONDeadline(ws, start); err != nil {
+		return
+	}
+	last := roundStart(round)
+	for i, mv := range round.Moves {
+		gap := missingReplayGap
+		if last != nil && mv.At != nil {
+			gap = min(max(mv.At.Sub(*last), 0), maxReplayGap)
+		}
+		if mv.At != nil {
+			last = mv.At
+		}
+		select {
+		case <-gone:
+			return
+		case <-time.After(gap):
+		}
+		removed, cleared := engine.Fading(m.Placed[mv.Player], m.Conditions)
+		if _, err := replay.Apply(m, mv); err != nil {
+			writeJSONDeadline(ws, localize(locale, protocol.Failure("invalid_state", err.Error())))
+			return
+		}
+		var msg OutboundMessage
+		if mv.Skipped {
+			msg = protocol.BoardState(protocol.EventTurnSkipped, m.Board, m.CurrentPlayer, nil)
+			msg.Player, msg.Code = mv.Player, "turn_skipped"
+		} else {
+			msg = protocol.BoardState(protocol.EventMove, m.Board, m.CurrentPlayer, nil)
+			row, col := mv.Row, mv.Col
+			msg.Row, msg.Col, msg.Symbol = &row, &col, mv.Symbol()
+			if engine.IsWild(m.Conditions) {
+				msg.Player = mv.Player
+			}
+			if cleared {
+				msg.Removed = &protocol.Cell{Row: removed.Row, Col: removed.Col}
+			}
+		}
+		msg.MoveNumber = i + 1
+		if engine.IsUltimate(m.Conditions) {
+			msg.Ultimate = ultimateView(m.Board, m.Last, m.Over)
+		}
+		if err := writeJSONDeadline(ws, localize(locale, msg)); err != nil {
+			return
+		}
+	}
+	if end, ok := replayResult(round, m.Board, g.wins); ok {
+		writeJSONDeadline(ws, localize(locale, end))
+	}
+	ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(cfg.WriteTimeout))
+}
+
+// replayResult is the event that ended round, as the live game sent it,
+// or false if the round was never finished.
+func replayResult(round replay.Round, board engine.Board, wins []engine.WinCondition) (OutboundMessage, bool) {
+	msg := OutboundMessage{Player: round.Result, Board: protocol.NewBoard(board)}
+	switch {
+	case round.Result == "":
+		return msg, false
+	case round.Adjudicated:
+		msg.Event, msg.Code = protocol.EventRoundAdjudicated, "round_adjudicated_win"
+		if round.Result == "draw" {
+			msg.Player, msg.Code = "", "round_adjudicated_draw"
+		}
+	case round.Result == "draw":
+		msg.Event, msg.Player = protocol.EventDraw, ""
+	case round.Timeout:
+		msg.Event, msg.Code = protocol.EventTimeoutWin, "timeout_win"
+	case round.Conceded:
+		msg.Event = protocol.EventConcede
+	default:
+		msg.Event = protocol.EventWin
+		if _, win, ok := engine.Winner(board, wins); ok {
+			msg.Win = winMessage(win)
+		}
+	}
+	return msg, true
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// --- Abuse Reports ---
+
+const (
+	reportChatContext = 20  // Chat lines from the reported player kept with a report
+	reportMaxText     = 500 // Max runes of free text on a report
+	chatHistoryLimit  = 100 // Chat lines buffered per game
+)
+
+var reportReasons = map[string]bool{
+	"abusive_chat":   true,
+	"offensive_name": true,
+	"other":          true,
+}
+
+type ChatMessage struct {
+	Player string    `json:"player"`
+	Text   string    `json:"text"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+type Report struct {
+	ID             string        `json:"id"`
+	GameID         string        `json:"game_id"`
+	ReporterSymbol string        `json:"reporter_symbol"`
+	ReporterIP     string        `json:"reporter_ip"`
+	ReportedSymbol string        `json:"reported_symbol"`
+	ReportedIP     string        `json:"reported_ip"`
+	Reason         string        `json:"reason"`
+	Text           string        `json:"text,omitempty"`
+	Chat           []ChatMessage `json:"chat"`
+	Status         string        `json:"status"`
+	CreatedAt      time.Time     `json:"created_at"`
+}
+
+type reportRequest struct {
+	Token    string `json:"token"`
+	Reported string `json:"reported"` // Symbol of the player reported; may be left out when there is only one
+	Reason   string `json:"reason"`
+	Text     string `json:"text"`
+}
+
+// windowLimiter allows at most limit events per key within a sliding window.
+type windowLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	clock  clock // Where events are timed; see clock.go
+	hits   map[string][]time.Time
+}
+
+func newWindowLimiter(limit int, window time.Duration) *windowLimiter {
+	return &windowLimiter{limit: limit, window: window, clock: systemClock{}, hits: make(map[string][]time.Time)}
+}
+
+func (l *windowLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	recent := l.hits[key][:0]
+	for _, t := range l.hits[key] {
+		if now.Sub(t) < l.window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= l.limit {
+		l.hits[key] = recent
+		return false
+	}
+	l.hits[key] = append(recent, now)
+	return true
+}
+
+// Full reports whether key has used its allowance for the window, without
+// counting an event.
+func (l *windowLimiter) Full(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, now := 0, l.clock.Now()
+	for _, t := range l.hits[key] {
+		if now.Sub(t) < l.window {
+			n++
+		}
+	}
+	return n >= l.limit
+}
+
+// Forget drops key's history, for a key that won't be seen again.
+func (l *windowLimiter) Forget(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.hits, key)
+}
+
+// Prune forgets the keys with no event left in the window as of now, so
+// an IP seen once isn't kept for good. The sweeper calls it.
+func (l *windowLimiter) Prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, hits := range l.hits {
+		if len(hits) == 0 || now.Sub(hits[len(hits)-1]) >= l.window {
+			delete(l.hits, key)
+		}
+	}
+}
+
+var reportLimiter = newWindowLimiter(5, time.Hour)
+
+// recordChat appends a line to the game's chat buffer, dropping the oldest
+// lines past chatHistoryLimit. Runs on the game's loop.
+func (game *Game) recordChat(msg ChatMessage) {
+	game.Chat = append(game.Chat, msg)
+	if len(game.Chat) > chatHistoryLimit {
+		game.Chat = game.Chat[len(game.Chat)-chatHistoryLimit:]
+	}
+}
+
+// recentChatFrom returns up to n of the latest chat lines sent by symbol.
+// Runs on the game's loop.
+func (game *Game) recentChatFrom(symbol string, n int) []ChatMessage {
+	out := make([]ChatMessage, 0, n)
+	for i := len(game.Chat) - 1; i >= 0 && len(out) < n; i-- {
+		if game.Chat[i].Player == symbol {
+			out = append(out, game.Chat[i])
+		}
+	}
+	// Restore chronological order
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+func reportPlayer(w http.ResponseWriter, r *http.Request) {
+	key := requestGameKey(r)
+
+	var req reportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body")
+		return
+	}
+	if !reportReasons[req.Reason] {
+		writeError(w, r, http.StatusBadRequest, "unknown_reason")
+		return
+	}
+	if utf8.RuneCountInString(req.Text) > reportMaxText {
+		writeError(w, r, http.StatusBadRequest, "text_too_long")
+		return
+	}
+
+	gamesMutex.RLock()
+	game, exists := games[key]
+	gamesMutex.RUnlock()
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "game_not_found")
+		return
+	}
+
+	var reporter *Player
+	var report Report
+	status, code := 0, ""
+	game.do(func() {
+		if _, err := verifySeatToken(game, req.Token); req.Token != "" && err != nil {
+			status, code = http.StatusUnauthorized, err.Error()
+			return
+		}
+		for _, p := range game.Players {
+			if req.Token != "" && p.Token == req.Token {
+				reporter = p
+			}
+		}
+		if reporter == nil {
+			status, code = http.StatusForbidden, "not_participant"
+			return
+		}
+		reported, c := reportTarget(game, reporter, req.Reported)
+		if c != "" {
+			status, code = http.StatusBadRequest, c
+			if c == "no_opponent" {
+				status = http.StatusConflict
+			}
+			return
+		}
+		report = Report{
+			ID:             newID(),
+			GameID:         key.ID,
+			ReporterSymbol: reporter.Symbol,
+			ReporterIP:     reporter.IP,
+			ReportedSymbol: reported.Symbol,
+			ReportedIP:     reported.IP,
+			Reason:         req.Reason,
+			Text:           req.Text,
+			Chat:           game.recentChatFrom(reported.Symbol, reportChatContext),
+			Status:         "open",
+			CreatedAt:      time.Now().UTC(),
+		}
+	})
+	if code != "" {
+		writeError(w, r, status, code)
+		return
+	}
+
+	if !reportLimiter.Allow(reporter.IP) {
+		writeError(w, r, http.StatusTooManyRequests, "too_many_reports")
+		return
+	}
+	if err := store.SaveReport(report); err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"report_id": report.ID, "status": report.Status})
+}
+
+// reportTarget is the player reporter names by symbol, or with symbol
+// left out the only other player, else the error code to refuse with.
+// Runs on the game's loop.
+func reportTarget(game *Game, reporter *Player, symbol string) (*Player, string) {
+	if symbol != "" && !game.isSymbol(symbol) {
+		return nil, "unknown_report_target"
+	}
+	if symbol == reporter.Symbol {
+		return nil, "cannot_report_self"
+	}
+	var others []*Player
+	for _, p := range game.Players {
+		if p == reporter {
+			continue
+		}
+		if symbol == "" || p.Symbol == symbol {
+			others = append(others, p)
+		}
+	}
+	switch {
+	case len(others) == 0:
+		return nil, "no_opponent"
+	case len(others) > 1:
+		return nil, "report_target_required"
+	}
+	return others[0], ""
+}
+
+func listReports(w http.ResponseWriter, r *http.Request) {
+	reports, err := store.ListReports("open")
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
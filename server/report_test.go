@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tictactoe/config"
+
+	"github.com/gorilla/mux"
+)
+
+// postReport files body as a report against gameID, answering with the
+// status and, on success, the report saved.
+func postReport(t *testing.T, gameID string, body reportRequest) (int, string) {
+	t.Helper()
+	b, _ := json.Marshal(body)
+	r := httptest.NewRequest("POST", "/games/"+gameID+"/report", strings.NewReader(string(b)))
+	r = mux.SetURLVars(r, map[string]string{"game_id": gameID})
+	reportLimiter.Forget(clientIP(r)) // Every test player shares it
+	w := httptest.NewRecorder()
+	reportPlayer(w, r)
+	var resp struct {
+		ReportID string `json:"report_id"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	return w.Code, resp.ReportID
+}
+
+func TestReportTarget(t *testing.T) {
+	id := unusedGameID()
+	game := newGame(id)
+	game.ThreePlayer = true
+	gamesMutex.Lock()
+	games[gameKey{config.DefaultTenant, id}] = game
+	gamesMutex.Unlock()
+	x, _ := joinFake(t, id, "")
+	o, _ := joinFake(t, id, "")
+
+	tests := []struct {
+		name     string
+		token    string
+		reported string
+		status   int
+		want     string // Symbol reported
+	}{
+		{"only opponent", x.Token, "", http.StatusAccepted, "O"},
+		{"named opponent", o.Token, "X", http.StatusAccepted, "X"},
+		{"self", x.Token, "X", http.StatusBadRequest, ""},
+		{"unknown symbol", x.Token, "Z", http.StatusBadRequest, ""},
+		{"empty seat", x.Token, "Δ", http.StatusConflict, ""},
+		{"no token", "", "O", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		status, reportID := postReport(t, id, reportRequest{Token: tt.token, Reported: tt.reported, Reason: "other"})
+		if status != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, status, tt.status)
+			continue
+		}
+		if tt.want == "" {
+			continue
+		}
+		reports, err := store.ListReports("open")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, rep := range reports {
+			if rep.ID == reportID && rep.ReportedSymbol != tt.want {
+				t.Errorf("%s: reported %s, want %s", tt.name, rep.ReportedSymbol, tt.want)
+			}
+		}
+	}
+
+	// With two others seated, the report has to say which
+	joinFake(t, id, "")
+	status, _ := postReport(t, id, reportRequest{Token: x.Token, Reason: "other"})
+	if status != http.StatusBadRequest {
+		t.Errorf("unnamed target among two: status %d, want %d", status, http.StatusBadRequest)
+	}
+	for _, symbol := range []string{"O", "Δ"} {
+		if status, _ := postReport(t, id, reportRequest{Token: x.Token, Reported: symbol, Reason: "other"}); status != http.StatusAccepted {
+			t.Errorf("report of %s: status %d, want %d", symbol, status, http.StatusAccepted)
+		}
+	}
+}
+
+func TestWindowLimiterPrune(t *testing.T) {
+	l := newWindowLimiter(2, time.Minute)
+	l.Allow("old")
+	l.Allow("new")
+	l.Allow("new")
+	if l.Allow("new") {
+		t.Fatal("a third event within the window was allowed")
+	}
+
+	l.Prune(time.Now().Add(30 * time.Second))
+	if len(l.hits) != 2 {
+		t.Errorf("pruned mid-window: %d keys left, want both", len(l.hits))
+	}
+	l.Prune(time.Now().Add(time.Minute))
+	if len(l.hits) != 0 {
+		t.Errorf("%d keys left once every event is out of the window, want none", len(l.hits))
+	}
+	if !l.Allow("new") {
+		t.Error("a pruned key is still limited")
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+// --- Resend ---
+
+// A write that fails drops its connection, but a message can still go
+// missing on the way, so every broadcast is numbered: state_version, taken
+// from game.Seq in the command that makes the change it announces, goes
+// up by one with each. Replies to one connection alone aren't broadcasts
+// and carry none. A client that sees the versions jump, say from 7 to 9,
+// sends resend_from with the first one it is missing and gets the
+// broadcasts from there on again, to itself only and marked resent, in
+// order. The game keeps its latest cfg.ResendBuffer broadcasts for this,
+// and forgets them when a new series starts. When the ones asked for are
+// gone, or are too many to queue at once, the answer is a state_sync
+// instead, as if the client had sent sync.
+
+// remember keeps msg, a stamped broadcast, for resend_from. Runs on
+// the game's loop.
+func (game *Game) remember(msg OutboundMessage) {
+	if cfg.ResendBuffer <= 0 {
+		return
+	}
+	if len(game.sent) >= cfg.ResendBuffer {
+		game.sent = append(game.sent[:0], game.sent[len(game.sent)-cfg.ResendBuffer+1:]...)
+	}
+	game.sent = append(game.sent, msg)
+}
+
+// forgetSent drops the kept broadcasts, for a new series. Runs on the game's
+// loop.
+func (game *Game) forgetSent() {
+	game.sent = nil
+}
+
+// resendFrom answers p's resend_from: the kept broadcasts from state
+// version from on, or a state_sync if they aren't all kept. A version not
+// sent yet gets nothing. Runs on the game's loop.
+func (game *Game) resendFrom(p *Player, from uint64) {
+	if from > game.Seq {
+		return
+	}
+	if len(game.sent) == 0 || from < game.sent[0].StateVersion {
+		p.send(game.stateSync(p))
+		return
+	}
+	missed := game.sent[from-game.sent[0].StateVersion:]
+	if len(missed) > cfg.SendQueueDepth/2 {
+		p.send(game.stateSync(p)) // Cheaper, and can't overflow the queue
+		return
+	}
+	p.logger().Debug("resending broadcasts", "from", from, "count", len(missed))
+	metrics.Resent.Add(int64(len(missed)))
+	for _, msg := range missed {
+		msg.Resent = true
+		p.send(localize(p.locale(), msg))
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"tictactoe/config"
+	"tictactoe/protocol"
+)
+
+// A client that asks for broadcasts from a version still kept gets them
+// again, in order and marked resent; from one already forgotten, a
+// state_sync; and from one not sent yet, nothing.
+func TestResendFrom(t *testing.T) {
+	quickGames(t)
+	withConfig(t, func(c *config.Config) { c.ResendBuffer = 4 })
+	id := unusedGameID()
+	x, xc := joinFake(t, id, "")
+	o, oc := joinFake(t, id, "")
+	start := xc.expect(t, protocol.EventStartGame)
+	oc.expect(t, protocol.EventStartGame)
+	players := map[string]*Player{x.Symbol: x, o.Symbol: o}
+	other := map[string]string{"X": "O", "O": "X"}
+
+	// broadcasts is what has reached X once the server goes quiet
+	broadcasts := func() (got []OutboundMessage) {
+		for {
+			select {
+			case msg := <-xc.msgs:
+				if msg.StateVersion > 0 {
+					got = append(got, msg)
+				}
+			case <-time.After(50 * time.Millisecond):
+				return got
+			}
+		}
+	}
+	mover, played := start.CurrentPlayer, 0
+	play := func(moves int) {
+		for ; moves > 0; moves-- {
+			cell := drawnRound[played]
+			players[mover].receive([]byte(fmt.Sprintf(`{"event":"make_move","row":%d,"col":%d}`, cell[0], cell[1])), newFlood(), gameRequest(id, ""))
+			mover, played = other[mover], played+1
+		}
+	}
+	resend := func(from uint64) {
+		x.receive([]byte(fmt.Sprintf(`{"event":"resend_from","state_version":%d}`, from)), newFlood(), gameRequest(id, ""))
+	}
+
+	play(1)
+	sent := broadcasts()
+	resend(start.StateVersion + 1)
+	resent := broadcasts()
+	if len(resent) == 0 || len(resent) != len(sent) {
+		t.Fatalf("resent %d broadcasts after start_game, want the %d since", len(resent), len(sent))
+	}
+	for i, msg := range resent {
+		if !msg.Resent {
+			t.Errorf("resent %s not marked resent", msg.Event)
+		}
+		msg.Resent = false
+		if !reflect.DeepEqual(msg, sent[i]) {
+			t.Errorf("resent %+v, want %+v", msg, sent[i])
+		}
+	}
+
+	resend(resent[len(resent)-1].StateVersion + 1)
+	if got := broadcasts(); len(got) != 0 {
+		t.Errorf("asked from a version not sent yet, got %v", got)
+	}
+
+	play(3) // Pushes start_game out of the four kept
+	broadcasts()
+	resend(start.StateVersion)
+	xc.expect(t, protocol.EventStateSync)
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"sort"
+
+	"tictactoe/protocol"
+)
+
+// --- Resync ---
+
+// The server never resends state unasked, so a client that may have missed
+// messages, from a backgrounded tab or a dropped write, sends sync. The
+// state_sync that answers goes to it alone and carries what start_game
+// does, plus the round's status and the pending rematch requests: enough
+// to rebuild the UI from scratch. Every broadcast carries the game's
+// state_version, and state_sync the current one, so the client can drop
+// whatever was in flight before the snapshot. It is the version GET
+// /games/{game_id}/state reports too. Answering reads the game
+// and stores nothing, so clients can ask on every reconnect.
+
+// stateSync is the snapshot p asked for. Runs on the game's loop.
+func (game *Game) stateSync(p *Player) OutboundMessage {
+	msg := game.roundMessage(protocol.EventStartGame)
+	msg.Event = protocol.EventStateSync
+	msg.Player = p.Symbol
+	msg.Seq = game.BoardSeq
+	msg.StateVersion = game.Seq
+	msg.Status = game.roundStatus()
+	game.roundLimit(&msg)
+	game.deadlines(&msg, true)
+	game.syncCues(&msg) // See cues.go
+	if game.starting() {
+		startsAt := game.StartingAt
+		msg.StartsAt = &startsAt
+	}
+	for symbol := range game.RematchRequests {
+		msg.RematchRequests = append(msg.RematchRequests, symbol)
+	}
+	sort.Strings(msg.RematchRequests)
+	return msg
+}
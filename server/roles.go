@@ -0,0 +1,145 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"tictactoe/protocol"
+)
+
+// --- Roles & Permissions ---
+
+// Role is what a websocket participant is allowed to do. New kinds of
+// participant get a role here and rows in inboundPermissions rather than
+// checks inside handlers.
+type Role string
+
+const (
+	RolePlayer    Role = "player"
+	RoleSpectator Role = "spectator" // Watches with ?spectate=1 and may claim an open seat
+	RoleAI        Role = "ai"        // The computer opponent; has no connection and sends nothing
+)
+
+// inboundPermissions lists, for every inbound event, the roles that may
+// send it. Events not listed are refused for everyone.
+var inboundPermissions = map[protocol.Event][]Role{
+	protocol.EventMakeMove:       {RolePlayer},
+	protocol.EventRematchRequest: {RolePlayer},
+	protocol.EventRematchDecline: {RolePlayer},
+	protocol.EventAbortRequest:   {RolePlayer},
+	protocol.EventAbortAccept:    {RolePlayer},
+	protocol.EventTimeSync:       {RolePlayer, RoleSpectator},
+	protocol.EventReady:          {RolePlayer},
+	protocol.EventClaimSeat:      {RoleSpectator},
+	protocol.EventConfirmMove:    {RolePlayer},
+	protocol.EventCancelMove:     {RolePlayer},
+	protocol.EventChat:           {RolePlayer},
+	protocol.EventNewSeries:      {RolePlayer},
+	protocol.EventUndoRequest:    {RolePlayer},
+	protocol.EventUndoAccept:     {RolePlayer},
+	protocol.EventUndoDecline:    {RolePlayer},
+	protocol.EventSwapRequest:    {RolePlayer},
+	protocol.EventSwapAccept:     {RolePlayer},
+	protocol.EventSwapDecline:    {RolePlayer},
+	protocol.EventConcede:        {RolePlayer},
+	protocol.EventConfigure:      {RolePlayer},
+	protocol.EventAcceptSettings: {RolePlayer},
+	protocol.EventSyncRequest:    {RolePlayer, RoleSpectator},
+	protocol.EventHintRequest:    {RolePlayer},
+	protocol.EventResendFrom:     {RolePlayer, RoleSpectator},
+	protocol.EventPong:           {RolePlayer, RoleSpectator},
+	protocol.EventCursor:         {RolePlayer},
+	protocol.EventEmote:          {RolePlayer},
+	protocol.EventKick:           {RolePlayer},
+}
+
+// participant is how p is attributed in messages it originates.
+func (p *Player) participant() *protocol.Participant {
+	return &protocol.Participant{ID: p.ID, Role: string(p.Role), Symbol: p.Symbol, Name: p.Name, Host: p.Role == RolePlayer && p.game != nil && p.game.Host == p.Symbol}
+}
+
+// participants lists everyone connected, players first, then the computer
+// if it plays. Runs on the game's loop.
+func (game *Game) participants() []protocol.Participant {
+	out := make([]protocol.Participant, 0, len(game.Players)+len(game.Spectators))
+	for _, p := range game.connections() {
+		out = append(out, *p.participant())
+	}
+	if game.AI != "" {
+		out = append(out, game.aiParticipant())
+	}
+	return out
+}
+
+const maxNameLength = 24
+
+// displayName trims a client-chosen name to something safe to show others.
+func displayName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if runes := []rune(name); len(runes) > maxNameLength {
+		name = string(runes[:maxNameLength])
+	}
+	return name
+}
+
+// uniqueName tells name apart from taken, the other players' names, with a
+// " (2)" suffix when it matches one, or " (3)" if that does too.
+func uniqueName(name string, taken ...string) string {
+	base := name
+	for n := 2; name != "" && nameTaken(name, taken); n++ {
+		suffix := " (" + strconv.Itoa(n) + ")"
+		name = base
+		if runes := []rune(name); len(runes)+len(suffix) > maxNameLength {
+			name = string(runes[:maxNameLength-len(suffix)])
+		}
+		name += suffix
+	}
+	return name
+}
+
+func nameTaken(name string, taken []string) bool {
+	for _, t := range taken {
+		if strings.EqualFold(name, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// seatName is how symbol's player is shown: the name they chose, the
+// computer's, or "Player X" for one who gave none. Runs on the game's
+// loop.
+func (game *Game) seatName(symbol string) string {
+	if symbol == game.AI {
+		return game.aiParticipant().Name
+	}
+	if name := game.SeatNames[symbol]; name != "" {
+		return name
+	}
+	return "Player " + symbol
+}
+
+// playerNames is every seat's name, by symbol. Runs on the game's
+// loop.
+func (game *Game) playerNames() map[string]string {
+	names := make(map[string]string)
+	for _, symbol := range game.symbols() {
+		names[symbol] = game.seatName(symbol)
+	}
+	return names
+}
+
+func allowed(role Role, event protocol.Event) bool {
+	for _, r := range inboundPermissions[event] {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"testing"
+
+	"tictactoe/protocol"
+)
+
+// Every inbound event against every role: who may send it. An event added
+// to inboundPermissions fails here until it has a row.
+func TestPermissionMatrix(t *testing.T) {
+	tests := []struct {
+		event             protocol.Event
+		player, spectator bool
+	}{
+		{protocol.EventMakeMove, true, false},
+		{protocol.EventRematchRequest, true, false},
+		{protocol.EventRematchDecline, true, false},
+		{protocol.EventAbortRequest, true, false},
+		{protocol.EventAbortAccept, true, false},
+		{protocol.EventTimeSync, true, true},
+		{protocol.EventReady, true, false},
+		{protocol.EventClaimSeat, false, true},
+		{protocol.EventConfirmMove, true, false},
+		{protocol.EventCancelMove, true, false},
+		{protocol.EventChat, true, false},
+		{protocol.EventNewSeries, true, false},
+		{protocol.EventUndoRequest, true, false},
+		{protocol.EventUndoAccept, true, false},
+		{protocol.EventUndoDecline, true, false},
+		{protocol.EventSwapRequest, true, false},
+		{protocol.EventSwapAccept, true, false},
+		{protocol.EventSwapDecline, true, false},
+		{protocol.EventConcede, true, false},
+		{protocol.EventConfigure, true, false},
+		{protocol.EventAcceptSettings, true, false},
+		{protocol.EventSyncRequest, true, true},
+		{protocol.EventHintRequest, true, false},
+		{protocol.EventResendFrom, true, true},
+		{protocol.EventPong, true, true},
+		{protocol.EventCursor, true, false},
+		{protocol.EventEmote, true, false},
+		{protocol.EventKick, true, false},
+		{protocol.EventMove, false, false}, // Outbound only
+		{"no_such_event", false, false},
+	}
+	seen := map[protocol.Event]bool{}
+	for _, tt := range tests {
+		seen[tt.event] = true
+		for role, want := range map[Role]bool{RolePlayer: tt.player, RoleSpectator: tt.spectator, RoleAI: false} {
+			if got := allowed(role, tt.event); got != want {
+				t.Errorf("allowed(%s, %s) = %v, want %v", role, tt.event, got, want)
+			}
+		}
+	}
+	for event := range inboundPermissions {
+		if !seen[event] {
+			t.Errorf("%s is in inboundPermissions but not in the matrix", event)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// --- Round Statistics ---
+
+// RoundStats totals finished rounds for win-rate analysis: how often the
+// player who moved first wins, how long rounds run and where they open.
+// The store keeps a running total per tenant, added to in the same write
+// that saves each RoundResult, so the totals outlive the games and the
+// process. GET /stats serves the tenant's; GET /games/{game_id}/stats
+// works the same numbers out from one ID's stored results, so it too
+// answers for a game that is long gone. Results saved before this
+// version carry no starter, opening or duration and count only as rounds,
+// wins and draws.
+
+// RoundStats are the running totals. In a three-player game every winner
+// other than the starter counts as a second-player win.
+type RoundStats struct {
+	Rounds      int       `json:"rounds"`
+	StarterWins int       `json:"starter_wins"`
+	SecondWins  int       `json:"second_wins"`
+	Draws       int       `json:"draws"`
+	Moves       int       `json:"moves"`        // Summed over every round
+	DurationMS  int64     `json:"duration_ms"`  // Summed over TimedRounds
+	TimedRounds int       `json:"timed_rounds"` // Rounds with a known duration
+	FirstMoves  [3][3]int `json:"first_moves"`  // Opening marks by row and column, 3×3 boards only
+}
+
+// add counts res.
+func (st *RoundStats) add(res RoundResult) {
+	st.Rounds++
+	switch {
+	case res.Winner == "":
+		st.Draws++
+	case res.Starter == "":
+	case res.Winner == res.Starter:
+		st.StarterWins++
+	default:
+		st.SecondWins++
+	}
+	st.Moves += res.Moves
+	if res.DurationMS > 0 {
+		st.DurationMS += res.DurationMS
+		st.TimedRounds++
+	}
+	if m := res.FirstMove; m != nil && res.Board.Size() == 3 && m[0] >= 0 && m[0] < 3 && m[1] >= 0 && m[1] < 3 {
+		st.FirstMoves[m[0]][m[1]]++
+	}
+}
+
+// fields flattens st into counter names for a store that keeps them apart,
+// such as a Redis hash incremented field by field.
+func (st RoundStats) fields() map[string]int64 {
+	f := map[string]int64{
+		"rounds":       int64(st.Rounds),
+		"starter_wins": int64(st.StarterWins),
+		"second_wins":  int64(st.SecondWins),
+		"draws":        int64(st.Draws),
+		"moves":        int64(st.Moves),
+		"duration_ms":  st.DurationMS,
+		"timed_rounds": int64(st.TimedRounds),
+	}
+	for r, row := range st.FirstMoves {
+		for c, n := range row {
+			f["first_move:"+strconv.Itoa(r)+","+strconv.Itoa(c)] = int64(n)
+		}
+	}
+	return f
+}
+
+// setField sets the counter name, as fields gives it, to n. Unknown names
+// are ignored.
+func (st *RoundStats) setField(name string, n int64) {
+	switch name {
+	case "rounds":
+		st.Rounds = int(n)
+	case "starter_wins":
+		st.StarterWins = int(n)
+	case "second_wins":
+		st.SecondWins = int(n)
+	case "draws":
+		st.Draws = int(n)
+	case "moves":
+		st.Moves = int(n)
+	case "duration_ms":
+		st.DurationMS = n
+	case "timed_rounds":
+		st.TimedRounds = int(n)
+	default:
+		cell, ok := strings.CutPrefix(name, "first_move:")
+		rs, cs, comma := strings.Cut(cell, ",")
+		r, err1 := strconv.Atoi(rs)
+		c, err2 := strconv.Atoi(cs)
+		if ok && comma && err1 == nil && err2 == nil && r >= 0 && r < 3 && c >= 0 && c < 3 {
+			st.FirstMoves[r][c] = int(n)
+		}
+	}
+}
+
+type roundStatsSummary struct {
+	RoundStats
+	StarterWinRate      float64 `json:"starter_win_rate"`
+	SecondWinRate       float64 `json:"second_win_rate"`
+	DrawRate            float64 `json:"draw_rate"`
+	AvgMoves            float64 `json:"avg_moves"`
+	AvgDurationMS       float64 `json:"avg_duration_ms"`
+	MostCommonFirstMove *[2]int `json:"most_common_first_move"` // Row and column; null before any 3×3 opening, the first cell on a tie
+}
+
+func summarizeRounds(st RoundStats) roundStatsSummary {
+	s := roundStatsSummary{RoundStats: st}
+	if st.Rounds > 0 {
+		n := float64(st.Rounds)
+		s.StarterWinRate = float64(st.StarterWins) / n
+		s.SecondWinRate = float64(st.SecondWins) / n
+		s.DrawRate = float64(st.Draws) / n
+		s.AvgMoves = float64(st.Moves) / n
+	}
+	if st.TimedRounds > 0 {
+		s.AvgDurationMS = float64(st.DurationMS) / float64(st.TimedRounds)
+	}
+	best := 0
+	for r, row := range st.FirstMoves {
+		for c, n := range row {
+			if n > best {
+				best = n
+				s.MostCommonFirstMove = &[2]int{r, c}
+			}
+		}
+	}
+	return s
+}
+
+// getRoundStats serves GET /stats: the tenant's totals over every round
+// finished on any instance sharing the store.
+func getRoundStats(w http.ResponseWriter, r *http.Request) {
+	st, err := store.LoadRoundStats(requestTenant(r))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+	writeJSON(w, http.StatusOK, summarizeRounds(st))
+}
+
+// getGameStats serves GET /games/{game_id}/stats: the same totals over the
+// rounds stored under one game ID.
+func getGameStats(w http.ResponseWriter, r *http.Request) {
+	key := requestGameKey(r)
+	results, err := store.ListRoundResults(key.Tenant, key.ID)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+	gamesMutex.RLock()
+	_, live := games[key]
+	gamesMutex.RUnlock()
+	if len(results) == 0 && !live {
+		writeError(w, r, http.StatusNotFound, "game_not_found")
+		return
+	}
+	var st RoundStats
+	for _, res := range results {
+		st.add(res)
+	}
+	writeJSON(w, http.StatusOK, summarizeRounds(st))
+}
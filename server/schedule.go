@@ -0,0 +1,136 @@
+package server
+
+import (
+	"time"
+
+	"tictactoe/protocol"
+)
+
+// --- Scheduled Games ---
+
+// maxScheduleAhead bounds how far out a game may be scheduled.
+const maxScheduleAhead = 90 * 24 * time.Hour
+
+// countdownLeads are the times before the start, most distant first, at
+// which connected players get a countdown event.
+var countdownLeads = []time.Duration{time.Minute, 10 * time.Second, 3 * time.Second, 2 * time.Second, time.Second}
+
+// scheduled reports whether the game is still waiting for its start time,
+// or for a player to show up after it. Runs on the game's loop.
+func (game *Game) scheduled() bool {
+	return !game.StartsAt.IsZero()
+}
+
+// armSchedule sets the timer for a scheduled game's next countdown, start
+// or no-show check. Callers persist the game first so a restart or crash
+// doesn't lose it. Runs on the game's loop.
+func (game *Game) armSchedule() {
+	game.stopSchedule()
+	if !game.scheduled() || game.closed {
+		return
+	}
+	at := game.nextScheduleStep(time.Now())
+	gen := game.scheduleGen
+	game.scheduleTimer = time.AfterFunc(time.Until(at), func() {
+		game.do(func() {
+			if game.scheduleGen != gen || game.closed || !game.scheduled() {
+				return
+			}
+			game.scheduleTimer = nil
+			game.journal.timer("schedule")
+			game.scheduleStep(time.Now())
+		})
+	})
+}
+
+// stopSchedule cancels the pending schedule timer. Runs on the game's
+// loop.
+func (game *Game) stopSchedule() {
+	if game.scheduleTimer != nil {
+		game.scheduleTimer.Stop()
+		game.scheduleTimer = nil
+	}
+	game.scheduleGen++
+}
+
+// nextScheduleStep is when the schedule next needs attention: the next
+// countdown lead still ahead, the start, or the end of the no-show grace.
+func (game *Game) nextScheduleStep(now time.Time) time.Time {
+	for _, lead := range countdownLeads {
+		if at := game.StartsAt.Add(-lead); at.After(now) {
+			return at
+		}
+	}
+	if game.StartsAt.After(now) {
+		return game.StartsAt
+	}
+	return game.StartsAt.Add(game.NoShowGrace)
+}
+
+// scheduleStep counts down, starts the game once both players are in, or
+// forfeits it when the no-show grace has run out. Runs on the game's
+// loop.
+func (game *Game) scheduleStep(now time.Time) {
+	startsAt := game.StartsAt.UTC()
+	switch {
+	case now.Before(game.StartsAt):
+		broadcast(game, OutboundMessage{Event: protocol.EventCountdown, Deadline: &startsAt, Code: "countdown"})
+	case len(game.Players) == 2:
+		game.beginScheduled()
+		return
+	case !now.Before(game.StartsAt.Add(game.NoShowGrace)):
+		game.forfeitNoShow()
+		return
+	}
+	game.armSchedule()
+}
+
+// beginScheduled turns a scheduled game into a normal one and starts its
+// first round. Runs on the game's loop.
+func (game *Game) beginScheduled() {
+	game.stopSchedule()
+	game.StartsAt = time.Time{}
+	if !game.durable() {
+		key, log := game.key(), game.logger()
+		game.storeLater(func() {
+			if err := store.DeleteSnapshot(key.Tenant, key.ID); err != nil {
+				log.Error("deleting scheduled game snapshot", "err", err)
+			}
+		})
+	}
+	game.touch()
+	game.startRound(protocol.EventStartGame)
+}
+
+// forfeitNoShow ends a scheduled game nobody completed: a lone player wins
+// by forfeit, and an empty game is simply deleted. Runs on the game's
+// loop.
+func (game *Game) forfeitNoShow() {
+	winner := ""
+	if len(game.Players) == 1 {
+		winner = game.Players[0].Symbol
+	}
+	game.logger().Info("scheduled game forfeited", "showed_up", len(game.Players))
+	game.forfeit(winner, "no_show_forfeit", endNoShow)
+}
+
+// forfeit ends the game with a point for winner, if any, telling everyone
+// why with code, and deletes it as ended for reason. Runs on the game's
+// loop.
+func (game *Game) forfeit(winner, code, reason string) {
+	if winner != "" {
+		game.award(winner)
+		broadcast(game, OutboundMessage{Event: protocol.EventForfeit, Player: winner, Score: &game.Score, Code: code})
+	}
+	removeGame(game, reason)
+	for _, p := range game.connections() {
+		p.closeAfterFlush(protocol.CloseGameEnded, "forfeit")
+	}
+}
+
+// welcomeScheduled tells a player who joined early when the game starts.
+// Runs on the game's loop.
+func (game *Game) welcomeScheduled(p *Player) {
+	startsAt := game.StartsAt.UTC()
+	p.send(localize(p.locale(), OutboundMessage{Event: protocol.EventGameScheduled, Deadline: &startsAt, Code: "game_scheduled"}))
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+)
+
+// --- Security Headers & CSRF ---
+
+// Unless -security-headers=false, every response says not to sniff its
+// content type, not to be framed by any site and not to send a Referer
+// anywhere, since page URLs can carry seat tokens. The web UI's pages also
+// get -csp as their Content-Security-Policy.
+//
+// State-changing requests from a browser must carry the double-submit
+// CSRF token, unless -csrf=false: the page is served with a random token
+// in the xo_csrf cookie and in its body, and the script echoes it back in
+// the X-CSRF-Token header, which another site's page can neither read nor
+// set. A request counts as a browser's when it has an Origin, Cookie or
+// Sec-Fetch-Site header; bots, the Go client and curl send none of them
+// and pass, as do admin requests, whose Authorization header a page on
+// another site can't send without our say-so. Websocket handshakes are
+// GETs and so never need the token; the origin check already covers them.
+
+const (
+	csrfCookie = "xo_csrf"
+	csrfHeader = "X-CSRF-Token"
+)
+
+// securityHeaders is the router middleware that sets the headers.
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.SecurityHeaders {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "DENY")
+			h.Set("Referrer-Policy", "no-referrer")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setPagePolicy sets the Content-Security-Policy for an HTML page.
+func setPagePolicy(w http.ResponseWriter) {
+	if cfg.SecurityHeaders && cfg.ContentSecurityPolicy != "" {
+		w.Header().Set("Content-Security-Policy", cfg.ContentSecurityPolicy)
+	}
+}
+
+// csrfProtect is the router middleware that refuses browser requests that
+// change state without the token.
+func csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.CSRF && needsCSRFToken(r) && !validCSRFToken(r) {
+			writeError(w, r, http.StatusForbidden, "csrf_failed")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// needsCSRFToken reports whether r changes state and comes from a browser
+// that could have been tricked into sending it.
+func needsCSRFToken(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	if r.Header.Get("Authorization") != "" {
+		return false
+	}
+	return r.Header.Get("Origin") != "" || r.Header.Get("Cookie") != "" || r.Header.Get("Sec-Fetch-Site") != ""
+}
+
+// validCSRFToken reports whether r's header repeats its cookie's token.
+func validCSRFToken(r *http.Request) bool {
+	c, err := r.Cookie(csrfCookie)
+	if err != nil || c.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(r.Header.Get(csrfHeader))) == 1
+}
+
+// pageCSRFToken is the token for a page to embed: the one the browser
+// already has, or a new one set in its cookie.
+func pageCSRFToken(w http.ResponseWriter, r *http.Request) string {
+	if !cfg.CSRF {
+		return ""
+	}
+	if c, err := r.Cookie(csrfCookie); err == nil && len(c.Value) == base64.RawURLEncoding.EncodedLen(32) {
+		return c.Value
+	}
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   requestScheme(r) == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewRouter().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	for header, want := range map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"X-Frame-Options":        "DENY",
+		"Referrer-Policy":        "no-referrer",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("GET / %s: %q, want %q", header, got, want)
+		}
+	}
+}
+
+// A browser's POST needs the token in both the cookie and the header; one
+// with neither browser header nor cookie needs none.
+func TestCSRFToken(t *testing.T) {
+	router := NewRouter()
+	post := func(edit func(r *http.Request)) (int, string) {
+		r := httptest.NewRequest("POST", "/games", strings.NewReader(`{}`))
+		edit(r)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		var body map[string]string
+		json.NewDecoder(w.Body).Decode(&body)
+		return w.Code, body["error_code"]
+	}
+	for name, edit := range map[string]func(r *http.Request){
+		"no token": func(r *http.Request) { r.Header.Set("Origin", "http://example.com") },
+		"cookie only": func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: csrfCookie, Value: "secret"})
+		},
+		"wrong header": func(r *http.Request) {
+			r.AddCookie(&http.Cookie{Name: csrfCookie, Value: "secret"})
+			r.Header.Set(csrfHeader, "guess")
+		},
+	} {
+		if status, code := post(edit); status != http.StatusForbidden || code != "csrf_failed" {
+			t.Errorf("%s: %d %s, want 403 csrf_failed", name, status, code)
+		}
+	}
+	for name, edit := range map[string]func(r *http.Request){
+		"matching token": func(r *http.Request) {
+			r.Header.Set("Origin", "http://example.com")
+			r.AddCookie(&http.Cookie{Name: csrfCookie, Value: "secret"})
+			r.Header.Set(csrfHeader, "secret")
+		},
+		"not a browser": func(r *http.Request) {},
+	} {
+		if _, code := post(edit); code == "csrf_failed" {
+			t.Errorf("%s: refused with csrf_failed", name)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// --- Series History ---
+
+// Every finished round is written to the store as a RoundResult. A game
+// that is re-opened under the same ID after it was deleted, or after a
+// restart, picks its series score back up from the last one. The game also
+// keeps a summary of each round of the current series in RoundResults,
+// saved with its state, and round announcements, win and draw carry the
+// last roundsOnWire of them for a history strip. Rematches keep them; a
+// new series or a reset match starts them over.
+
+const (
+	recentResultsDefault = 20
+	recentResultsMax     = 100
+
+	maxRoundResults = maxMaxRounds // Round summaries kept per game, a whole max_rounds series; the oldest go first
+	roundsOnWire    = 10           // Round summaries sent with each message
+)
+
+// recordResult stores the round that just ended, won by winner ("" for a
+// draw). Runs on the game's loop.
+func (game *Game) recordResult(winner string) {
+	switch winner {
+	case "X":
+		metrics.WinsX.Add(1)
+	case "O":
+		metrics.WinsO.Add(1)
+	case engine.Third:
+		metrics.WinsThird.Add(1)
+	default:
+		metrics.Draws.Add(1)
+	}
+	game.journal.state("round_over", winner)
+	game.SeriesRounds++
+	res := RoundResult{
+		GameID:     game.ID,
+		Tenant:     game.Tenant,
+		Round:      game.Round,
+		Winner:     winner,
+		Timeout:    game.TimeoutWinner != "",
+		Board:      game.Board.Clone(),
+		Moves:      len(game.Moves),
+		Score:      game.Score,
+		FinishedAt: time.Now().UTC(),
+		Starter:    game.StartingPlayerForRound,
+	}
+	if len(game.Moves) > 0 && !game.Moves[0].Skipped {
+		res.FirstMove = &[2]int{game.Moves[0].Row, game.Moves[0].Col}
+	}
+	if !game.RoundStartedAt.IsZero() {
+		res.DurationMS = res.FinishedAt.Sub(game.RoundStartedAt).Milliseconds()
+	}
+	log := game.logger()
+	game.storeLater(func() {
+		if err := store.SaveRoundResult(res); err != nil {
+			log.Error("saving round result", "err", err)
+		}
+	})
+	game.noteOpening(res)
+	game.recordHeadToHead(winner, res.FinishedAt)
+
+	summary := protocol.RoundSummary{Round: game.Round, Result: winner, Moves: len(game.Moves), DurationMS: res.DurationMS}
+	if summary.Result == "" {
+		summary.Result = "draw"
+	}
+	game.RoundResults = append(game.RoundResults, summary)
+	if len(game.RoundResults) > maxRoundResults {
+		game.RoundResults = game.RoundResults[len(game.RoundResults)-maxRoundResults:]
+	}
+}
+
+// recentRounds is the last roundsOnWire round summaries, for a message.
+// Runs on the game's loop.
+func (game *Game) recentRounds() []protocol.RoundSummary {
+	rounds := game.RoundResults
+	if len(rounds) > roundsOnWire {
+		rounds = rounds[len(rounds)-roundsOnWire:]
+	}
+	return append([]protocol.RoundSummary(nil), rounds...)
+}
+
+// seriesHistory reads the rounds stored under key, for a game about to be
+// created on first connect, reporting false if it couldn't.
+func seriesHistory(key gameKey) ([]RoundResult, bool) {
+	results, err := store.ListRoundResults(key.Tenant, key.ID)
+	if err != nil {
+		slog.Error("loading series", "game_id", key.ID, "tenant", key.Tenant, "err", err)
+		return nil, false
+	}
+	return results, true
+}
+
+// resumeSeries picks the score of an earlier series under the game's ID
+// back up from history, as seriesHistory read it, and the ID's openings
+// with it. It is called before the game is registered.
+func (game *Game) resumeSeries(history []RoundResult) {
+	if len(history) > 0 {
+		game.Score = history[len(history)-1].Score
+	}
+	game.addStoredOpenings(history)
+}
+
+// getHistory serves GET /games/{game_id}/history: every stored round result
+// under the ID, oldest first.
+func getHistory(w http.ResponseWriter, r *http.Request) {
+	key := requestGameKey(r)
+	results, err := store.ListRoundResults(key.Tenant, key.ID)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+	gamesMutex.RLock()
+	_, live := games[key]
+	gamesMutex.RUnlock()
+	if len(results) == 0 && !live {
+		writeError(w, r, http.StatusNotFound, "game_not_found")
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// listRecentResults serves GET /games/recent?limit=N: the tenant's latest
+// round results across all games, newest first.
+func listRecentResults(w http.ResponseWriter, r *http.Request) {
+	limit := recentResultsDefault
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > recentResultsMax {
+			writeErrorDetail(w, r, http.StatusBadRequest, "invalid_limit", "limit must be 1 to "+strconv.Itoa(recentResultsMax))
+			return
+		}
+		limit = n
+	}
+	results, err := store.ListRecentResults(requestTenant(r), limit)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,1491 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tictactoe/buildinfo"
+	"tictactoe/config"
+	"tictactoe/discord"
+	"tictactoe/engine"
+	"tictactoe/i18n"
+	"tictactoe/protocol"
+	"tictactoe/replay"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// --- Structs & Types ---
+
+type Player struct {
+	Symbol   string `json:"symbol"`
+	Conn     conn   `json:"-"` // Ignore in JSON
+	Token    string `json:"-"` // Proves seat ownership on REST calls
+	IP       string `json:"-"`
+	Remote   string `json:"-"` // IP, or the client a proxy forwarded for; for logs
+	Identity string `json:"-"` // Client-supplied identity, used for bans
+	Locale   string `json:"-"` // Language the client asked for, if any; see locale
+	Role     Role   `json:"role"`
+	ID       string `json:"id"`   // Participant ID, fresh per connection
+	Name     string `json:"name"` // Display name the client chose, if any
+	Deltas   bool   `json:"-"`    // Opted in to cell-only move updates with ?deltas=1
+	Packed   bool   `json:"-"`    // Opted in to packed boards with ?board=packed
+
+	ConfirmMoves bool         `json:"-"` // Opted in to two-step moves with ?confirm_moves=1
+	pending      *engine.Cell // Provisional move awaiting confirm_move; owned by the game's loop
+	pendingMark  string       // The symbol pending marks
+
+	queue    *sendQueue
+	ctx      context.Context // Done once the connection is dropped; everything running for it stops with it
+	cancel   context.CancelFunc
+	dead     atomic.Bool // Set once the connection is dropped; no further writes are queued
+	dropOnce sync.Once
+	rtt      atomic.Int64 // Smoothed ping round trip in nanoseconds; 0 until the first pong
+	gameURL  string       // The game's websocket URL as the client reached it, for reconnect_url
+
+	game       *Game                    // The game this connection is seated in
+	seat       atomic.Pointer[seatCopy] // Symbol and Role as last set; see setSeat
+	health     atomic.Int32             // healthAlive or healthQuiet
+	unanswered atomic.Int32             // Pings sent since the last pong
+	pingSent   atomic.Int64             // Send time in Unix nanoseconds of the latest ping, until its first answer
+
+	mayPlay bool // Presented the game's password, or needed none; owned by the game's loop
+
+	record *PlayerRecord // Identity's standing in a rated game, kept up to date; nil if never read. Owned by the game's loop
+
+	hintSeq uint64 // BoardSeq of the turn the player last got a hint on; owned by the game's loop
+
+	cursor cursorRelay // Coalesces cursor events; see presence.go
+
+	superseded bool // Unseated for a newer connection of the same client; owned by the game's loop
+	departed   bool // leave has run for it; owned by the game's loop
+	kicked     bool // Removed by the host; its seat isn't held. Owned by the game's loop
+
+	// Move sanity checks, owned by the game's loop; see anticheat.go
+	rejections  map[string]int // Refused make_moves by code, over the connection's life
+	strikes     int            // Refusals counting towards a flag in strikeRound
+	strikeRound int
+	suspicious  bool      // Flagged at least once
+	lastMoveAt  time.Time // When its last make_move was accepted
+}
+
+// newPlayer makes the player for connection c, which lasts no longer than
+// ctx, normally the context of the request that opened it.
+func newPlayer(ctx context.Context, symbol, token string, c conn) *Player {
+	p := &Player{
+		Conn:  c,
+		Token: token,
+		ID:    newID()[:12],
+		queue: newSendQueue(cfg.SendQueueDepth),
+	}
+	p.setSeat(symbol, RolePlayer)
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	context.AfterFunc(p.ctx, p.drop)
+	return p
+}
+
+// seatCopy is a player's symbol and role as of one setSeat.
+type seatCopy struct {
+	Symbol string
+	Role   Role
+}
+
+// setSeat gives p symbol and role. Both belong to the game's loop, but
+// the write pump and read loop log the symbol, so a copy of the pair is
+// kept for them to read. Runs on the game's loop, or before p is shared.
+func (p *Player) setSeat(symbol string, role Role) {
+	p.Symbol, p.Role = symbol, role
+	p.seat.Store(&seatCopy{Symbol: symbol, Role: role})
+}
+
+// seatNow is p's symbol and role for whatever reads them off the loop.
+func (p *Player) seatNow() seatCopy {
+	return *p.seat.Load()
+}
+
+// drop closes the player's connection and cancels its context, which stops
+// its write pump and everything else running for it. Closing makes the
+// read loop's ReadMessage return, so the seat is released through the same
+// deferred cleanup as a normal disconnect, exactly once. Every way the
+// server ends a connection, whether shutdown, a kick, an idle timeout, a
+// takeover or the game's deletion, ends in drop, and so does the end of
+// the request the connection came in on.
+func (p *Player) drop() {
+	p.dropOnce.Do(func() {
+		p.dead.Store(true)
+		p.cancel()
+		p.Conn.Close()
+	})
+}
+
+// Game is one game's state, all of it owned by the game's loop (see
+// loop.go). Timers send the loop a command when they fire, which checks a
+// generation counter, such as turnTimerGen, so one cancelled while its
+// command waited its turn stands down.
+type Game struct {
+	ID                     string
+	Board                  engine.Board
+	Players                []*Player
+	CurrentPlayer          string
+	Score                  Score
+	RematchRequests        map[string]bool // Using map as set
+	StartingPlayerForRound string
+	FirstPlayer            string            // Who starts round 1; "X" unless the creator chose
+	Round                  int               // 1-based number of the current round
+	Moves                  []replay.Move     // Moves of the current round, in order
+	History                []replay.Round    // Completed rounds, oldest first, capped at maxHistoryRounds
+	Reserved               map[string]string // Seats held for a returning player: symbol -> token
+	Chat                   []ChatMessage     // Recent chat, kept for abuse reports
+	loop                   gameLoop          // Runs every command that reads or changes the rest
+
+	Watchers     map[*watcher]struct{} // Invisible admin subscribers
+	Seq          uint64                // Number of broadcasts so far; each carries it as state_version, and watchers get it too
+	sent         []OutboundMessage     // The latest broadcasts, oldest first, for resend_from
+	journal      journal               // Recent happenings, for support; see journal.go
+	ExpiresAt    time.Time             // Deleted by the sweeper once idle past this
+	LastActivity time.Time             // Last touch; zero for a game restored and not yet played
+	HeldUntil    map[string]time.Time  // Reserved seats awaiting a reconnect, by symbol
+	Nonce        string                // Identifies this game instance in seat tokens
+	WarningsSent int                   // Entries of expiryWarnings already sent since the last activity
+	Rated        bool                  // Results update the players' ratings
+	RatedRound   int                   // Last Round whose result was applied to ratings
+	AFK          map[string]bool       // Quiet players the game is paused for, by symbol
+	Abort        *abortRequest         // Pending proposal to void the match
+	EmptySince   time.Time             // When the last player left; zero while anyone is connected
+	Locale       string                // Language for participants who didn't choose one; "" for the server default
+	Tenant       string                // Namespace the ID is unique in
+
+	WinConditions []engine.WinCondition // Ways to win, lines first; nil for lines only
+	WinLength     int                   // Marks in a row that win, if fewer than the board's size; 0 for a full line
+
+	Spectators []*Player      // Watching with RoleSpectator; not counted as players
+	SeatEpochs map[string]int // Times each seat was taken over by a spectator; see issueSeatToken
+
+	StartsAt      time.Time     // Scheduled start; zero once the game has started, or if it was never scheduled
+	NoShowGrace   time.Duration // How long past StartsAt to wait for a missing player
+	scheduleTimer *time.Timer
+	scheduleGen   int // Bumped on stop so a timer that already fired stands down
+
+	Configured       string // Symbol of the player who sent configure; see settings.go
+	SettingsAccepted bool   // The second player accepted them, or the offer timed out
+	settingsTimer    *time.Timer
+	settingsGen      int // Bumped on stop so a timeout that already fired stands down
+
+	ReadyCheck bool        // Both players confirm they're ready before each round
+	Ready      *readyCheck // Pending ready check; the round hasn't started
+	readyTimer *time.Timer
+	readyGen   int // Bumped on stop so a timeout that already fired stands down
+
+	Host     string          // Symbol of the player who may kick; see kick.go
+	KickBans map[string]bool // "ip:" and "id:" keys the host banned for the game's life
+
+	StartingAt     time.Time // When the counted-down round begins; zero unless counting down. See countdown.go
+	countdownTimer clockTimer
+	countdownGen   int // Bumped on cancel so a timer that already fired stands down
+
+	BoardSeq    uint64     // Version of Board, bumped on every change; see OutboundMessage.Seq
+	reminder    clockTimer // Pending your_turn_reminder, if any
+	reminderGen int        // Bumped on cancel so a timer that already fired stands down
+	idleTimer   clockTimer // Pending opponent_idle, if any; cancelled and bumped with the reminder
+	idleSymbol  string     // Player the others were told is idle this turn; "" if none
+	closed      bool       // Removed from the registry; seats are no longer held
+	stats       matchStats // Engagement counters, tallied when the game is deleted
+
+	restored map[string]string // Tokens vouched for by a session restored at startup, by symbol
+	writes   *storeQueue       // Store writes yet to run, in order; see storewrites.go
+
+	ThreePlayer bool // Seats X, O and Δ; see threeplayer.go
+
+	Correspondence bool              // Played over days; seats stay reserved while their players are away
+	TurnWindow     time.Duration     // Time per move in a correspondence game
+	TurnDeadline   time.Time         // When the player on turn forfeits; zero while no turn is running
+	SeatOwners     map[string]string // Client ID that took each seat, by symbol; see GET /me/games
+	deadlineWarned bool              // The reminder for the current TurnDeadline was sent
+
+	DiscordWebhook string            // Where this game's result is posted; "" for -discord-webhook
+	StartedAt      time.Time         // When start_game was first sent; zero if it never was
+	SeatNames      map[string]string // Display name of whoever took each seat, by symbol
+
+	AI           string // Seat the computer plays, if anyone asked for it with ?mode=ai
+	AIDifficulty string // How well it plays: aiEasy, aiMedium or aiHard
+	aiGen        int    // Bumped when the computer's move is scheduled; older timers stand down
+
+	TurnTimer     time.Duration // Time per move; 0 for no limit. See turntimer.go
+	TurnTimeout   string        // What running out of time does: "forfeit" the round or "skip" the turn
+	TimeoutWinner string        // Winner of the current round on time; "" unless it ended that way
+	turnTimer     *time.Timer
+	turnTimerGen  int // Bumped on stop so a timer that already fired stands down
+
+	TimeControl time.Duration            // Each player's time for a round; 0 for none. See clock.go
+	clockLeft   map[string]time.Duration // Time left by symbol, as of clockSince for the clock running
+	clockOn     string                   // Whose clock is running; "" while both are stopped
+	clockSince  time.Time                // When clockOn's clock last started, read from clock
+	flagTimer   clockTimer
+	clockGen    int // Bumped on stop so a flag that already fell stands down
+	clock       clock
+
+	Conceded string // Symbol that gave up the current round; "" unless it ended that way. See concede.go
+
+	Public    bool      // Listed in the lobby while a player waits; see lobby.go
+	CreatedAt time.Time // When the game was first opened
+
+	TargetWins        int             // Round wins that take a best-of series; 0 for no series. See bestof.go
+	NewSeriesRequests map[string]bool // Players who asked for the next series, by symbol
+
+	MaxRounds       int       // Rounds a round-limited series plays; 0 for no limit. See maxrounds.go
+	SeriesRounds    int       // Rounds finished in the current series
+	SeriesStartedAt time.Time // When the current series' first round began; zero until it has
+
+	Undo *undoRequest // Pending proposal to take back a move; see undo.go
+
+	Swap      *swapRequest // Pending offer to trade symbols; see swap.go
+	swapTimer clockTimer
+	swapGen   int // Bumped on stop so a timeout that already fired stands down
+
+	StarterPolicy string // Who starts each round after the first; see starter.go
+
+	RoundStartedAt time.Time // When play began on the current board; zero until it has
+
+	RoundTimeLimit      time.Duration // Longest a round may take; 0 for no limit. See deadlines.go
+	SeriesTimeLimit     time.Duration // Longest a best-of series may take; 0 for no limit
+	RoundDeadline       time.Time     // When the current round is adjudicated; zero until it opens
+	SeriesDeadline      time.Time     // When the current series is adjudicated; zero until it opens
+	Adjudicated         string        // The current round's result by adjudication, a symbol or "draw"; "" unless it ended that way
+	SeriesAdjudicated   string        // The series' winner by adjudication, or "draw"; "" unless it ended that way
+	roundDeadlineTimer  clockTimer
+	seriesDeadlineTimer clockTimer
+	deadlineGen         int // Bumped on stop so a timer that already fired stands down
+
+	PasswordHash          string // Needed to take a seat; see private.go
+	SpectatorPasswordHash string // Needed to watch, if set
+
+	ShowLegalMoves bool // Turns come with the legal_moves; see hints.go
+
+	HideOpenings   bool      // Keep the opening book to itself; see openings.go
+	openings       []opening // The ID's latest finished rounds' openings, oldest first
+	openingsLoaded bool
+
+	CoinFlip    bool   // Round 1's starter is up to a coin; see coinflip.go
+	CoinFlipped bool   // The coin has been flipped
+	coinNonce   string // The coin, kept secret until the flip
+
+	HeadToHead     bool            // The score is the named pair's lifetime record; see headtohead.go
+	HeadToHeadPair [2]string       // The pair it was seeded for, sorted; empty until then
+	headToHeadSeed *headToHeadRead // The latest record join read for a pair, to seed it from
+
+	RoundResults []protocol.RoundSummary // Finished rounds of the current series, oldest first, capped at maxRoundResults
+}
+
+const maxHistoryRounds = 100
+
+// Wire types are shared with the Go client in package protocol.
+type (
+	Score           = protocol.Score
+	InboundMessage  = protocol.InboundMessage
+	OutboundMessage = protocol.OutboundMessage
+)
+
+// --- Global State ---
+
+var (
+	games      = make(map[gameKey]*Game)
+	gamesMutex sync.RWMutex // Lock for the games map
+	upgrader   = newUpgrader(config.Default())
+	cfg        = config.Default()
+)
+
+// newUpgrader builds the websocket upgrader from the configured buffer
+// sizes, handshake timeout and compression setting.
+func newUpgrader(c config.Config) websocket.Upgrader {
+	u := websocket.Upgrader{
+		ReadBufferSize:    c.ReadBufferSize,
+		WriteBufferSize:   c.WriteBufferSize,
+		HandshakeTimeout:  c.HandshakeTimeout,
+		EnableCompression: c.Compression,
+		CheckOrigin:       checkOrigin,
+	}
+	if c.WriteBufferPool {
+		// Connections share write buffers between writes instead of each
+		// holding one for its lifetime
+		u.WriteBufferPool = &sync.Pool{}
+	}
+	return u
+}
+
+// --- Game Logic Helpers ---
+
+func newGame(id string) *Game {
+	return &Game{
+		ID:                     id,
+		Tenant:                 config.DefaultTenant,
+		Board:                  engine.NewBoard(engine.DefaultSize),
+		Players:                make([]*Player, 0),
+		CurrentPlayer:          "X",
+		Score:                  Score{X: 0, O: 0},
+		RematchRequests:        make(map[string]bool),
+		StartingPlayerForRound: "X",
+		FirstPlayer:            "X",
+		Round:                  1,
+		Reserved:               make(map[string]string),
+		Watchers:               make(map[*watcher]struct{}),
+		ExpiresAt:              time.Now().Add(cfg.GameTTL),
+		HeldUntil:              make(map[string]time.Time),
+		Nonce:                  newID(),
+		AFK:                    make(map[string]bool),
+		BoardSeq:               1,
+		SeatEpochs:             make(map[string]int),
+		restored:               make(map[string]string),
+		writes:                 &storeQueue{},
+		SeatOwners:             make(map[string]string),
+		SeatNames:              make(map[string]string),
+		TurnTimer:              cfg.TurnTimer,
+		TurnTimeout:            cfg.TurnTimeout,
+		TimeControl:            cfg.TimeControl,
+		clockLeft:              make(map[string]time.Duration),
+		clock:                  systemClock{},
+		CreatedAt:              time.Now(),
+		NewSeriesRequests:      make(map[string]bool),
+	}
+}
+
+// claimSeat picks the symbol for a new connection: the seat token was
+// issued for, if it is free or reserved for that token (reclaimed is then
+// true), otherwise preferred, if it is neither occupied nor reserved, and
+// otherwise the first seat that is neither. Runs on the game's loop.
+func (game *Game) claimSeat(token, preferred string) (symbol string, reclaimed, ok bool) {
+	taken := map[string]bool{game.AI: game.AI != ""}
+	for _, p := range game.Players {
+		taken[p.Symbol] = true
+	}
+	if symbol, err := verifySeatToken(game, token); err == nil && !taken[symbol] {
+		if t := game.Reserved[symbol]; t == "" || t == token {
+			delete(game.Reserved, symbol)
+			delete(game.HeldUntil, symbol)
+			if t != "" {
+				game.revokeSession(t)
+			}
+			return symbol, true, true
+		}
+	}
+	if preferred != "" && !taken[preferred] && game.Reserved[preferred] == "" {
+		return preferred, false, true
+	}
+	for _, symbol := range game.symbols() {
+		if !taken[symbol] && game.Reserved[symbol] == "" {
+			return symbol, false, true
+		}
+	}
+	return "", false, false
+}
+
+// recordSeat remembers who took p's seat: the client ID for GET /me/games
+// and the name for result notifications. Runs on the game's loop.
+func (game *Game) recordSeat(p *Player) {
+	if p.Identity == "" {
+		delete(game.SeatOwners, p.Symbol)
+	} else {
+		game.SeatOwners[p.Symbol] = p.Identity
+	}
+	var others []string
+	for _, symbol := range game.symbols() {
+		if symbol != p.Symbol {
+			others = append(others, game.seatName(symbol))
+		}
+	}
+	p.Name = uniqueName(p.Name, others...)
+	if p.Name == "" {
+		delete(game.SeatNames, p.Symbol)
+	} else {
+		game.SeatNames[p.Symbol] = p.Name
+	}
+}
+
+// archiveRound moves the finished current round into History. Runs on
+// the game's loop.
+func (game *Game) archiveRound() {
+	game.History = append(game.History, game.currentRound())
+	if len(game.History) > maxHistoryRounds {
+		game.History = game.History[len(game.History)-maxHistoryRounds:]
+	}
+	game.Round++
+}
+
+// currentRound is the round in play, as it would be archived. Runs on
+// the game's loop.
+func (game *Game) currentRound() replay.Round {
+	return replay.Round{
+		Starter: game.StartingPlayerForRound,
+		Moves:   append([]replay.Move(nil), game.Moves...),
+		Result:  game.result(),
+		Timeout: game.TimeoutWinner != "",
+
+		Conceded: game.Conceded != "",
+
+		Adjudicated: game.Adjudicated != "",
+
+		StartedAt: game.roundStartedAt(),
+	}
+}
+
+// roundResult is "X" or "O" for a won board, "draw" for a full one, or ""
+// while the round is still open. mover is who made the board's latest
+// mark, which decides a misère or wild win.
+func roundResult(board engine.Board, wins []engine.WinCondition, mover string) string {
+	if symbol, _, ok := engine.Winner(board, wins); ok {
+		return engine.Victor(mover, symbol, wins)
+	}
+	if engine.RoundDrawn(board, wins) {
+		return "draw"
+	}
+	return ""
+}
+
+func winMessage(win engine.Win) *protocol.Win {
+	return &protocol.Win{Condition: win.Condition, Cells: cellPairs(win.Cells)}
+}
+
+// winningLines is every pattern the move at last completed: each line
+// under the line rule, or else the one pattern of win. Runs on the game's
+// loop.
+func (game *Game) winningLines(win engine.Win, last engine.Cell) [][][2]int {
+	if win.Condition != engine.Lines.Name {
+		return [][][2]int{cellPairs(win.Cells)}
+	}
+	var out [][][2]int
+	for _, line := range engine.WinningLines(game.Board, last, game.winLength()) {
+		out = append(out, cellPairs(line))
+	}
+	return out
+}
+
+func cellPairs(cells []engine.Cell) [][2]int {
+	out := make([][2]int, 0, len(cells))
+	for _, c := range cells {
+		out = append(out, [2]int{c.Row, c.Col})
+	}
+	return out
+}
+
+func resetGameBoard(game *Game, starter string) {
+	game.Board = engine.NewBoard(game.Board.Size())
+	game.CurrentPlayer = starter
+	game.RematchRequests = make(map[string]bool)
+	game.NewSeriesRequests = make(map[string]bool)
+	game.Moves = nil
+	game.Undo = nil
+	game.Abort = nil
+	game.TimeoutWinner = ""
+	game.Conceded = ""
+	game.RoundStartedAt = time.Time{}
+	game.clearRoundDeadline()
+	game.stopTurnTimer()
+	game.resetClocks()
+	game.BoardSeq++
+	for _, p := range game.Players {
+		p.pending = nil // Meant for the old board
+	}
+}
+
+// canMove reports whether symbol may mark the cell now. Runs on the game's
+// loop.
+func (game *Game) canMove(symbol string, row, col int) bool {
+	return game.moveError(symbol, row, col) == ""
+}
+
+// moveError is the invalid_move code saying why symbol may not mark the
+// cell now, or "" if it may. What the server adds to a round comes first:
+// countdowns, waiting for players, series and pauses. The move itself is
+// then the engine's to judge. Runs on the game's loop.
+func (game *Game) moveError(symbol string, row, col int) string {
+	status := game.roundStatus()
+	switch {
+	case !game.Board.InBounds(row, col):
+		return engine.ErrOutOfBounds.Error() // Inside protocol.MaxBoardSize but off this game's board
+	case game.starting():
+		return "too_early"
+	case status == statusWaiting:
+		return "game_not_started"
+	case game.seriesOver():
+		return "series_over"
+	case status == statusFinished:
+		return engine.ErrRoundOver.Error()
+	case game.paused():
+		return "game_paused"
+	}
+	if err := game.match().MoveError(symbol, row, col); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// match is the current round as the engine plays it, sharing the game's
+// board, so a move is judged, placed and scored by engine.Match alone and
+// the server only announces the result. Runs on the game's loop.
+func (game *Game) match() *engine.Match {
+	m := &engine.Match{
+		Board:          game.Board,
+		CurrentPlayer:  game.CurrentPlayer,
+		StartingPlayer: game.StartingPlayerForRound,
+		Score:          engine.Score(game.Score),
+		Over:           game.roundOver(),
+		Conditions:     game.WinConditions,
+		Last:           game.lastMark(),
+		Players:        game.seats(),
+		StarterPolicy:  game.starterPolicy(),
+	}
+	if game.blitz() {
+		m.Placed = make(map[string][]engine.Cell)
+		for _, symbol := range game.symbols() {
+			m.Placed[symbol] = placed(game.Moves, symbol)
+		}
+	}
+	return m
+}
+
+// award scores a round ended off the board for winner, or as a draw for
+// "", as engine.Match.Award does. Runs on the game's loop.
+func (game *Game) award(winner string) {
+	m := game.match()
+	m.Award(winner)
+	game.Score = Score(m.Score)
+}
+
+// checkMove is the symbol symbol would mark at row, col when asking for
+// mark, "" meaning their own, or the error code for why they can't. Every
+// transport checks a move with it. Runs on the game's loop.
+func (game *Game) checkMove(symbol, mark string, row, col int) (string, string) {
+	if code := game.moveError(symbol, row, col); code != "" {
+		return "", code
+	}
+	mark, err := engine.MarkFor(symbol, mark, game.WinConditions)
+	if err != nil {
+		return "", err.Error()
+	}
+	return mark, ""
+}
+
+// rejectMove tells p why its make_move didn't count.
+func rejectMove(p *Player, code string) {
+	msg := protocol.Failure(code, "")
+	msg.Event = protocol.EventInvalidMove
+	p.logger().Debug("move rejected", "code", code)
+	p.send(localize(p.locale(), msg))
+}
+
+// makeMove commits symbol's move marking mark at row, col and announces the
+// move, win or draw. Invalid moves are ignored. Runs on the game's
+// loop.
+func (game *Game) makeMove(symbol, mark string, row, col int) {
+	if !game.canMove(symbol, row, col) {
+		return
+	}
+	if game.outOfTime(symbol) {
+		game.flagFall() // Moved as the flag fell
+		return
+	}
+	game.playerActive(symbol)
+	m := game.match()
+	outcome, err := m.Play(symbol, mark, row, col)
+	if err != nil {
+		return // A mark checkMove would have refused
+	}
+	game.CurrentPlayer, game.Score = m.CurrentPlayer, Score(m.Score)
+	game.BoardSeq++
+	now := time.Now().UTC()
+	mv := replay.Move{Player: symbol, Row: row, Col: col, At: &now}
+	if mark != symbol {
+		mv.Mark = mark
+	}
+	game.Moves = append(game.Moves, mv)
+	game.Undo = nil // Asked about a position that is gone
+	if game.Swap != nil {
+		game.stopSwapTimeout()
+		game.Swap = nil // Too late to swap this round
+	}
+	metrics.Moves.Add(1)
+
+	switch outcome {
+	case engine.Won:
+		winner := m.Winner
+		game.recordResult(winner)
+		msg := OutboundMessage{
+			Event:  protocol.EventWin,
+			Player: winner,
+			Board:  protocol.NewBoard(game.Board),
+			Score:  &game.Score,
+			Names:  game.playerNames(),
+			Rounds: game.recentRounds(),
+
+			LastMove:   game.lastMove(),
+			RoundStats: game.roundStats(),
+		}
+		game.winCues(&msg, m.Win, engine.Cell{Row: row, Col: col})
+		broadcast(game, game.withRatingUpdate(msg, winner))
+		game.logger().Info("round won", "round", game.Round, "winner", winner)
+		game.stats.rounds++
+		game.cancelReminder()
+		game.stopTurnTimer()
+		game.stopClock()
+		game.checkSeries()
+	case engine.Drawn:
+		game.recordResult("")
+		broadcast(game, game.withRatingUpdate(OutboundMessage{
+			Event:  protocol.EventDraw,
+			Board:  protocol.NewBoard(game.Board),
+			Score:  &game.Score,
+			Names:  game.playerNames(),
+			Rounds: game.recentRounds(),
+
+			LastMove:   game.lastMove(),
+			RoundStats: game.roundStats(),
+		}, ""))
+		game.logger().Info("round drawn", "round", game.Round)
+		game.stats.rounds++
+		game.cancelReminder()
+		game.stopTurnTimer()
+		game.stopClock()
+		game.checkSeries()
+	default:
+		game.runClock()
+		move := protocol.BoardState(protocol.EventMove, game.Board, game.CurrentPlayer, nil)
+		move.Row, move.Col, move.Symbol = &row, &col, mark
+		if game.wild() {
+			move.Player = symbol
+		}
+		if m.Removed != nil {
+			move.Removed = &protocol.Cell{Row: m.Removed.Row, Col: m.Removed.Col}
+		}
+		move.Fading = game.fading()
+		move.MoveNumber = len(game.Moves)
+		move.LastMove = game.lastMove()
+		move.Clocks = game.clocks()
+		move.LegalMoves = game.legalMoves()
+		broadcast(game, move)
+		game.armReminder()
+		game.armTurnTimer()
+		game.armAI()
+	}
+}
+
+// localize fills in the human-readable text for a message carrying a
+// machine-readable code, in the recipient's locale.
+func localize(locale string, msg OutboundMessage) OutboundMessage {
+	if msg.Code != "" {
+		text := i18n.T(locale, msg.Code)
+		if msg.Error != "" {
+			msg.Error = text
+		} else {
+			msg.Message = text
+		}
+	}
+	return msg
+}
+
+// writeJSONDeadline bounds every outbound write so a client that stops
+// reading can't block the game; a deadline hit surfaces as a write error.
+// gorilla/websocket allows one writer at a time, so only a player's write
+// pump calls it, or the handler before the pump starts; everything else
+// goes through Player.send.
+func writeJSONDeadline(conn *websocket.Conn, msg OutboundMessage) error {
+	conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+	return conn.WriteJSON(msg)
+}
+
+func broadcast(game *Game, msg OutboundMessage) {
+	broadcastEach(game, func(*Player) OutboundMessage { return msg })
+}
+
+// broadcastEach sends every player the message built for them, so payloads
+// can be customized per recipient. Watchers get build(nil), the unfiltered
+// view, so build must accept a nil player.
+func broadcastEach(game *Game, build func(p *Player) OutboundMessage) {
+	game.Seq++
+	stamp := func(msg OutboundMessage) OutboundMessage {
+		msg.StateVersion = game.Seq
+		if msg.Board != nil {
+			msg.Seq = game.BoardSeq
+			msg.Spectators = game.spectatorCount()
+			msg.Ultimate = game.ultimateBoard()
+		}
+		return msg
+	}
+	for _, p := range game.connections() {
+		p.send(localize(p.locale(), stamp(build(p))))
+	}
+	msg := stamp(build(nil))
+	game.journal.add(journalEntry{Kind: journalBroadcast, What: string(msg.Event), Detail: msg.Code, StateVersion: msg.StateVersion})
+	game.remember(msg)
+	game.publish(msg)
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestLocale is the locale a websocket client declared with ?lang=,
+// falling back to its Accept-Language header.
+func requestLocale(r *http.Request) string {
+	return i18n.Resolve(declaredLocale(r), "")
+}
+
+// declaredLocale is requestLocale without the default: "" when the client
+// expressed no supported preference, so the game's locale can apply.
+func declaredLocale(r *http.Request) string {
+	if l := i18n.Match(r.URL.Query().Get("lang")); l != "" {
+		return l
+	}
+	return i18n.Preferred(r.Header.Get("Accept-Language"))
+}
+
+// locale is the language for system messages to p. The game's locale is
+// fixed at creation, so it can be read off the loop.
+func (p *Player) locale() string {
+	return i18n.Resolve(p.Locale, p.game.Locale)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// --- HTTP Handlers ---
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError sends the structured error envelope: a stable error_code for
+// programs plus a message localized from the request's Accept-Language.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string) {
+	locale := i18n.Negotiate(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Language", locale)
+	writeJSON(w, status, map[string]string{"error_code": code, "message": i18n.T(locale, code)})
+}
+
+// writeErrorDetail is writeError plus an untranslated technical detail.
+func writeErrorDetail(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	locale := i18n.Negotiate(r.Header.Get("Accept-Language"))
+	w.Header().Set("Content-Language", locale)
+	writeJSON(w, status, map[string]string{"error_code": code, "message": i18n.T(locale, code), "detail": detail})
+}
+
+func readRoot(w http.ResponseWriter, r *http.Request) {
+	setPagePolicy(w)
+	pages.Render(w, r, "index.html", struct {
+		Maintenance bool
+		BasePath    string // For the page's links and the URLs its script builds
+		CSRFToken   string // For the script to send with its POSTs; see security.go
+	}{maintenance.Load(), cfg.BasePath, pageCSRFToken(w, r)})
+}
+
+func serveVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, buildinfo.Get())
+}
+
+// --- WebSocket Handler ---
+
+// onGame finds the game under key, or creates it, and runs fn on its loop,
+// with created set if it was made for this call. A game removed between
+// the lookup and the command is closed by the time the command runs:
+// joining it would strand the newcomer outside the registry, so the lookup
+// starts over, unless the game was suspended for shutdown and is staying
+// put. A game it creates first has the ID's series history read, off the
+// loop. On failure it returns the error code instead, and fn never runs.
+func onGame(key gameKey, r *http.Request, fn func(game *Game, created bool)) (code string) {
+	passed := false
+	var history []RoundResult
+	read, loaded := false, false
+	for {
+		gamesMutex.Lock()
+		game, exists := games[key]
+		if !exists {
+			if cfg.StrictGames {
+				gamesMutex.Unlock()
+				return "game_not_found"
+			}
+			if !passed {
+				// A CAPTCHA is checked over the network, and a seat token
+				// on its game's loop: neither under gamesMutex
+				gamesMutex.Unlock()
+				if challengeRequired(r) {
+					pow, token := socketChallenge(r)
+					if !passChallenge(r, pow, token) {
+						return "challenge_failed"
+					}
+				}
+				passed = true
+				continue
+			}
+			if !read {
+				// Nor is the store read under it
+				gamesMutex.Unlock()
+				history, loaded = seriesHistory(key)
+				read = true
+				continue
+			}
+			if code := gameLimitCode(key.Tenant); code != "" {
+				gamesMutex.Unlock()
+				return code
+			}
+			if _, ok := allowIPGame(r, limitIP(r), time.Now()); !ok {
+				gamesMutex.Unlock()
+				return "rate_limited"
+			}
+			game = newGame(key.ID)
+			game.Tenant = key.Tenant
+			if loaded {
+				game.resumeSeries(history)
+			}
+			registerGame(game)
+		}
+		gamesMutex.Unlock()
+
+		if !exists {
+			game.logger().Info("game created", "via", "join")
+		}
+
+		ran := false
+		game.do(func() {
+			if !game.closed {
+				ran = true
+				fn(game, !exists)
+			}
+		})
+		if ran {
+			return ""
+		}
+		if draining.Load() {
+			return "server_shutting_down"
+		}
+	}
+}
+
+func websocketHandler(w http.ResponseWriter, r *http.Request) {
+	locale := declaredLocale(r)
+
+	// Upgrade HTTP to WebSocket
+	codec, subprotocol, refusal := requestCodec(r)
+	var header http.Header
+	if subprotocol != "" {
+		header = http.Header{"Sec-Websocket-Protocol": {subprotocol}}
+	}
+	ws, err := upgrader.Upgrade(w, r, header)
+	if err != nil {
+		slog.Warn("websocket upgrade failed", "path", r.URL.Path, "remote", logRemote(r), "err", err)
+		metrics.UpgradeFailures.Add(1)
+		return
+	}
+	wsHandlers.Add(1)
+	defer wsHandlers.Done()
+	metrics.Connections.Add(1)
+	defer metrics.Connections.Add(-1)
+	if refusal != "" {
+		refuse(wsConn{ws, protocol.JSON}, protocol.CloseRefused, localize(locale, protocol.Failure(refusal, "")))
+		return
+	}
+
+	if host, remote := routeGame(requestGameKey(r)); remote {
+		cluster.relay(ws, r, requestGameKey(r), host, codec)
+		return
+	}
+	player := join(wsConn{ws, codec}, r, locale)
+	if player == nil {
+		return
+	}
+	// Cleanup function for when socket closes
+	defer player.leave()
+	ws.SetReadLimit(maxInboundSize)
+	ws.SetReadDeadline(time.Now().Add(readTimeout()))
+	ws.SetPongHandler(player.handlePong)
+
+	// Read Loop: it ends when the client goes, or when the player's context
+	// is cancelled, since drop closes the connection under ReadMessage
+	flood := newFlood()
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			// WebSocketDisconnect equivalent
+			player.readFailed(err)
+			break
+		}
+		player.receive(data, flood, r)
+	}
+}
+
+// readFailed closes the player's websocket with the code for why its read
+// loop ended on err, when that was the server's doing.
+func (player *Player) readFailed(err error) {
+	if frame := readCloseFrame(err); frame != nil {
+		player.logger().Info("read failed, closing connection", "err", err)
+		player.Conn.WriteClose(frame)
+	}
+}
+
+// readCloseFrame is the close frame for a websocket read loop that ended
+// on err, or nil unless the server ended it: for an oversized message or a
+// client gone silent past the read deadline. Malformed frames get 1002
+// from the websocket library itself.
+func readCloseFrame(err error) []byte {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, websocket.ErrReadLimit):
+		return websocket.FormatCloseMessage(protocol.CloseProtocolError, "message too large")
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return websocket.FormatCloseMessage(protocol.CloseIdleTimeout, "idle timeout")
+	}
+	return nil
+}
+
+// join seats a new connection in the game r names, or has it watch, and
+// returns its player with the write pump running. A connection that can't
+// join is told why and closed, and join returns nil. c is written to
+// directly until the pump starts.
+func join(c conn, r *http.Request, locale string) *Player {
+	key := requestGameKey(r)
+
+	reads := readForJoin(key, r)
+	var player *Player
+	code := onGame(key, r, func(game *Game, created bool) {
+		player = game.join(c, r, locale, created, reads)
+	})
+	if code != "" {
+		closeCode := protocol.CloseRefused
+		switch code {
+		case "server_shutting_down":
+			closeCode = protocol.CloseShutdown
+		case "rate_limited":
+			closeCode = protocol.CloseRateLimited
+		}
+		refuse(c, closeCode, localize(i18n.Resolve(locale, ""), protocol.Failure(code, "")))
+		return nil
+	}
+	return player
+}
+
+// join is join's command, run on the game's loop: created is set if the
+// game was made for this connection, and reads holds what was read from
+// the store for it beforehand.
+func (game *Game) join(c conn, r *http.Request, locale string, created bool, reads joinReads) *Player {
+	if game.kickBanned(limitIP(r), requestIdentity(r)) {
+		refuse(c, protocol.CloseKicked, localize(i18n.Resolve(locale, game.Locale), protocol.Failure("banned_from_game", "")))
+		return nil
+	}
+
+	seatToken := r.URL.Query().Get("token")
+	spectating := r.URL.Query().Get("spectate") == "1"
+	if spectating && len(game.Spectators) >= maxSpectators {
+		refuse(c, protocol.CloseGameFull, localize(i18n.Resolve(locale, game.Locale), protocol.Failure("spectators_full", "")))
+		return nil
+	}
+	if !spectating && seatToken != "" {
+		// A token that doesn't check out is refused rather than ignored,
+		// so a client holding a stale one knows to drop it
+		if _, err := verifySeatToken(game, seatToken); err != nil {
+			slog.Info("seat token rejected", "game_id", game.ID, "remote", logRemote(r), "err", err)
+			refuse(c, protocol.CloseRefused, localize(i18n.Resolve(locale, game.Locale), protocol.Failure(err.Error(), "")))
+			return nil
+		}
+	}
+	preferred := r.URL.Query().Get("symbol") // See swap.go
+	if !spectating && preferred != "" && !game.isSymbol(preferred) {
+		refuse(c, protocol.CloseRefused, localize(i18n.Resolve(locale, game.Locale), protocol.Failure("invalid_symbol", "symbol must be "+symbolChoices(game.symbols()))))
+		return nil
+	}
+	if !spectating && r.URL.Query().Get("mode") == "ai" {
+		difficulty := r.URL.Query().Get("difficulty")
+		if !validDifficulty(difficulty) {
+			refuse(c, protocol.CloseRefused, localize(i18n.Resolve(locale, game.Locale), protocol.Failure("invalid_difficulty", "")))
+			return nil
+		}
+		game.playAI(difficulty)
+	}
+	var playerSymbol string
+	var superseded *Player
+	reclaimed, ok := false, true
+	if !spectating {
+		if superseded = game.seatedAs(seatToken, requestIdentity(r), limitIP(r)); superseded != nil {
+			playerSymbol, reclaimed = superseded.Symbol, true
+			game.supersede(superseded)
+		} else {
+			playerSymbol, reclaimed, ok = game.claimSeat(seatToken, preferred)
+		}
+		if !ok && len(game.Spectators) < maxSpectators {
+			spectating, ok = true, true // Both seats are taken; watch instead
+		}
+	}
+	if !ok {
+		full := protocol.Failure("game_full", "")
+		full.ServerInfo = buildinfo.Version
+		refuse(c, protocol.CloseGameFull, localize(i18n.Resolve(locale, game.Locale), full))
+		return nil
+	}
+
+	// Every seat gets a fresh token, so one that is used keeps clear of
+	// cfg.TokenTTL
+	password := r.URL.Query().Get("password")
+	if created && password != "" && validPassword(password) {
+		game.PasswordHash = hashPassword(password) // The creator's own connection sets it
+	}
+	if !reclaimed {
+		if code := game.admit(limitIP(r), password, spectating); code != "" {
+			refuse(c, protocol.CloseRefused, localize(i18n.Resolve(locale, game.Locale), protocol.Failure(code, "")))
+			return nil
+		}
+	}
+
+	token := ""
+	if !spectating {
+		if !reclaimed && game.midSeries() {
+			game.SeatEpochs[playerSymbol]++ // The previous holder's token no longer works
+		}
+		token = issueSeatToken(game, playerSymbol)
+	}
+	player := newPlayer(r.Context(), playerSymbol, token, c)
+	player.game = game
+	player.IP = limitIP(r)
+	player.Remote = logRemote(r)
+	player.gameURL = gameURL(r, game)
+	player.Identity = requestIdentity(r)
+	player.Locale = locale
+	player.Name = displayName(r.URL.Query().Get("name"))
+	player.Deltas = r.URL.Query().Get("deltas") == "1"
+	player.Packed = r.URL.Query().Get("board") == "packed"
+	player.ConfirmMoves = r.URL.Query().Get("confirm_moves") == "1"
+	player.mayPlay = reclaimed || !game.private() || checkPassword(game.PasswordHash, password)
+	player.record = reads.record
+	if reads.headToHead != nil {
+		game.headToHeadSeed = reads.headToHead
+	}
+	if superseded != nil {
+		player.inherit(superseded)
+	}
+	game.touch()
+	go player.writePump(cfg.PingInterval) // Read now, on the loop
+
+	if spectating {
+		player.logger().Info("spectator joined")
+		game.journal.add(journalEntry{Kind: journalJoin, What: "spectator", Who: player.ID})
+		game.addSpectator(player)
+	} else {
+		player.logger().Info("player joined", "reclaimed", reclaimed)
+		game.journal.add(journalEntry{Kind: journalJoin, What: "player", Who: player.Symbol})
+		game.Players = append(game.Players, player)
+		game.markOccupied()
+		game.recordSeat(player)
+		game.assignHost(player)
+
+		// Send assignment
+		player.send(OutboundMessage{
+			Event:          protocol.EventPlayerAssignment,
+			Player:         playerSymbol,
+			Token:          player.Token,
+			ReconnectURL:   reconnectURL(r, game, player.Token),
+			ReconnectGrace: int(cfg.ReconnectGrace / time.Second),
+			ServerInfo:     buildinfo.Version,
+			Score:          &game.Score,
+			CoinCommitment: game.coinPending(),
+		})
+		if !reclaimed {
+			game.takeOverSeat(player)
+		}
+
+		// Start game if full, unless it is scheduled for later
+		if superseded != nil {
+			// The game went on all along; the new connection only needs
+			// to catch up
+			player.send(game.stateSync(player))
+		} else if game.Correspondence {
+			game.welcomeCorrespondence(player)
+		} else if game.scheduled() {
+			game.welcomeScheduled(player)
+			if len(game.Players) == 2 && !time.Now().Before(game.StartsAt) {
+				game.beginScheduled()
+			}
+		} else if game.canPlay() {
+			game.startRound(protocol.EventStartGame)
+		} else if reclaimed {
+			// Back before the opponent: show where the game stands so the
+			// client can resume once they return
+			sync := game.roundMessage(protocol.EventSync)
+			sync.Participants = game.participants()
+			player.send(sync)
+		}
+		game.lobbyChanged()
+	}
+	return player
+}
+
+// refuse tells c why it can't join with msg, then closes it with closeCode
+// and msg's error code as the reason.
+func refuse(c conn, closeCode int, msg OutboundMessage) {
+	c.Write(msg)
+	c.WriteClose(websocket.FormatCloseMessage(closeCode, msg.Code))
+	c.Close()
+}
+
+// leave releases the player's seat or spot in the audience once its
+// connection has ended, telling the rest of the game as a disconnect
+// calls for. The read loop calls it as it ends, and the write pump does
+// when a write fails, so a connection whose read is stuck still goes;
+// whichever comes second does nothing.
+func (player *Player) leave() {
+	game := player.game
+	chatLimiter.Forget(player.ID)
+	emoteLimiter.Forget(player.ID)
+	game.do(func() { game.leave(player) })
+	player.drop()
+}
+
+// leave is leave's command. Runs on the game's loop.
+func (game *Game) leave(player *Player) {
+	if player.superseded || player.departed {
+		return
+	}
+	player.departed = true
+	if game.removeSpectator(player) {
+		player.logger().Info("spectator left")
+		game.journal.add(journalEntry{Kind: journalLeave, What: "spectator", Who: player.ID})
+		game.announceSpectators()
+		return
+	}
+	// Find and remove player
+	for i, p := range game.Players {
+		if p == player {
+			game.Players = append(game.Players[:i], game.Players[i+1:]...)
+			break
+		}
+	}
+	player.logger().Info("player left")
+	game.journal.add(journalEntry{Kind: journalLeave, What: "player", Who: player.Symbol})
+	game.passHost(player)
+
+	game.cancelReminder()
+	game.stopTurnTimer()
+	game.leaveClock(player)
+	game.leaveReadyCheck(player)
+	game.cancelCountdown()
+	if !game.Correspondence {
+		game.clearRematch() // Made to the ones at the table; correspondence players come and go
+	}
+	delete(game.AFK, player.Symbol)
+	if game.closed {
+		// Already torn down; everyone is being disconnected
+	} else if game.Correspondence && !player.kicked {
+		// Coming and going is normal here; the opponent isn't told
+		game.keepSeat(player)
+	} else if len(game.Players) > 0 {
+		if !player.kicked {
+			game.holdSeat(player)
+		}
+		broadcast(game, protocol.Notice(protocol.EventOpponentLeft, "opponent_left"))
+		game.announceOpenSeats()
+	} else {
+		// Last one out: the game goes dormant; see dormant.go
+		game.goDormant(player)
+		game.announceOpenSeats()
+	}
+	game.lobbyChanged()
+}
+
+// receive handles one inbound message from the player, which r carried or
+// opened the connection for. fl is the connection's flood control.
+func (player *Player) receive(data []byte, fl *flood, r *http.Request) {
+	game := player.game
+	player.heard()
+	msg, err := protocol.DecodeAs(player.Conn.Codec(), data)
+	if err == nil && (msg.Event == protocol.EventCursor || msg.Event == protocol.EventEmote) {
+		player.relayPresence(msg) // Limited on its own, not by the flood control
+		return
+	}
+	if err == nil && msg.Event == protocol.EventPong {
+		player.handlePong(msg.Nonce) // One per ping, so neither limited nor journaled
+		return
+	}
+	// Journaled as it is handled, ahead of any broadcast it causes
+	journal := func(outcome string) {
+		game.journal.add(journalEntry{Kind: journalInbound, What: string(msg.Event), Who: player.journalName(), Detail: outcome})
+	}
+	if !fl.check(player, time.Now()) {
+		journal("rate_limited")
+		return
+	}
+	if errors.Is(err, protocol.ErrUnknownEvent) {
+		journal("unknown_event")
+		player.send(localize(player.locale(), protocol.Failure("unknown_event", err.Error())))
+		return
+	}
+	if err != nil && !errors.Is(err, protocol.ErrOffBoard) {
+		journal("protocol_error")
+		player.send(localize(player.locale(), protocol.Failure("protocol_error", err.Error())))
+		return
+	}
+	if !allowed(player.Role, msg.Event) {
+		journal("forbidden")
+		player.send(localize(player.locale(), protocol.Failure("forbidden", "")))
+		return
+	}
+	if err != nil {
+		journal(engine.ErrOutOfBounds.Error())
+		rejectMove(player, engine.ErrOutOfBounds.Error())
+		metrics.MovesRejected.Add(1)
+		return
+	}
+
+	// Answered off the game's loop so the reply measures only the network,
+	// not the commands queued ahead of it
+	if msg.Event == protocol.EventTimeSync {
+		journal("ok")
+		player.send(OutboundMessage{Event: protocol.EventTimeSync, ClientTS: msg.ClientTS, ServerTS: time.Now().UnixMilli()})
+		return
+	}
+
+	game.do(func() { game.handle(player, msg, journal, r) })
+}
+
+// handle is receive's command for msg, which journal records the outcome
+// of. Runs on the game's loop.
+func (game *Game) handle(player *Player, msg protocol.InboundMessage, journal func(outcome string), r *http.Request) {
+	if player.superseded || player.kicked {
+		journal("ignored")
+		return // Its seat belongs to the newer connection, or it is on its way out
+	}
+	game.touch()
+	boardSeq := game.BoardSeq
+
+	tooSoon := game.scheduled() && (msg.Event == protocol.EventMakeMove || msg.Event == protocol.EventConfirmMove || msg.Event == protocol.EventRematchRequest)
+	switch {
+	case tooSoon:
+		journal("not_started_yet")
+	case msg.Event != protocol.EventMakeMove:
+		journal("ok") // A move is journaled once it is checked
+	}
+	if tooSoon {
+		player.send(localize(player.locale(), protocol.Failure("not_started_yet", "")))
+	} else if msg.Event == protocol.EventMakeMove {
+		mark, code := game.checkMove(player.Symbol, msg.Mark, *msg.Row, *msg.Col)
+		if code == "" {
+			code = game.moveThrottle(player)
+		}
+		if code != "" {
+			journal(code)
+			rejectMove(player, code)
+			game.moveRejected(player, code)
+		} else if player.ConfirmMoves {
+			journal("ok")
+			game.moveAccepted(player)
+			game.proposeMove(player, mark, *msg.Row, *msg.Col)
+		} else {
+			journal("ok")
+			game.moveAccepted(player)
+			game.makeMove(player.Symbol, mark, *msg.Row, *msg.Col)
+		}
+	} else if msg.Event == protocol.EventConfirmMove {
+		game.confirmMove(player)
+	} else if msg.Event == protocol.EventCancelMove {
+		game.cancelMove(player)
+	} else if msg.Event == protocol.EventChat {
+		game.handleChat(player, msg.Text)
+	} else if msg.Event == protocol.EventClaimSeat {
+		game.promote(player, r)
+	} else if msg.Event == protocol.EventReady {
+		game.handleReady(player)
+	} else if msg.Event == protocol.EventAbortRequest || msg.Event == protocol.EventAbortAccept {
+		game.handleAbort(player, msg)
+	} else if msg.Event == protocol.EventUndoRequest || msg.Event == protocol.EventUndoAccept || msg.Event == protocol.EventUndoDecline {
+		game.handleUndo(player, msg.Event)
+	} else if msg.Event == protocol.EventSwapRequest || msg.Event == protocol.EventSwapAccept || msg.Event == protocol.EventSwapDecline {
+		game.handleSwap(player, msg.Event)
+	} else if msg.Event == protocol.EventNewSeries {
+		game.handleNewSeries(player)
+	} else if msg.Event == protocol.EventConcede {
+		game.handleConcede(player)
+	} else if msg.Event == protocol.EventConfigure {
+		game.handleConfigure(player, msg.Settings)
+	} else if msg.Event == protocol.EventAcceptSettings {
+		game.handleAcceptSettings(player)
+	} else if msg.Event == protocol.EventSyncRequest {
+		player.send(game.stateSync(player))
+	} else if msg.Event == protocol.EventHintRequest {
+		game.handleHint(player)
+	} else if msg.Event == protocol.EventResendFrom {
+		game.resendFrom(player, msg.StateVersion)
+	} else if msg.Event == protocol.EventKick {
+		game.handleKick(player, msg.Target, msg.Ban)
+	} else if msg.Event == protocol.EventRematchRequest && game.seriesOver() {
+		player.send(localize(player.locale(), protocol.Failure("series_over", "")))
+	} else if msg.Event == protocol.EventRematchRequest {
+		game.handleRematch(player)
+	} else if msg.Event == protocol.EventRematchDecline {
+		game.declineRematch(player)
+	}
+
+	if game.Correspondence && game.BoardSeq != boardSeq {
+		game.turnTaken(time.Now())
+	} else if msg.Event == protocol.EventRematchRequest || msg.Event == protocol.EventRematchDecline || msg.Event == protocol.EventNewSeries {
+		game.persist()
+	}
+}
+
+// NewRouter wires every HTTP, REST and websocket route, mounted under
+// cfg.BasePath for a reverse proxy that passes its prefix through. Paths
+// outside it get a 404, as does anything else unrouted.
+func NewRouter() *mux.Router {
+	root := mux.NewRouter()
+	root.Use(securityHeaders, csrfProtect)
+	root.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusNotFound, "not_found")
+	})
+	r := root
+	if cfg.BasePath != "" {
+		root.Handle(cfg.BasePath, http.RedirectHandler(cfg.BasePath+"/", http.StatusMovedPermanently))
+		r = root.PathPrefix(cfg.BasePath).Subrouter()
+	}
+
+	// Static Files
+	if !headless {
+		r.PathPrefix("/static/").Handler(http.StripPrefix(cfg.BasePath+"/static/", http.FileServer(http.FS(staticFiles))))
+	}
+
+	// Routes
+	r.HandleFunc("/", readRoot).Methods("GET")
+	r.HandleFunc("/healthz", liveness).Methods("GET")
+	r.HandleFunc("/keep_job_alive", liveness).Methods("GET") // Older name for /healthz
+	r.HandleFunc("/version", serveVersion).Methods("GET")
+	r.HandleFunc("/readyz", readiness).Methods("GET")
+	r.HandleFunc("/metrics", serveMetrics).Methods("GET")
+	r.HandleFunc("/challenge", issueChallenge).Methods("GET")
+	r.HandleFunc("/admin/reports", requireAdmin(listReports)).Methods("GET")
+	r.HandleFunc("/admin/bans", requireAdmin(listBans)).Methods("GET")
+	r.HandleFunc("/admin/bans", requireAdmin(createBan)).Methods("POST")
+	r.HandleFunc("/admin/bans/{ban_id}", requireAdmin(deleteBan)).Methods("DELETE")
+	r.HandleFunc("/admin/ips", requireAdmin(listIPs)).Methods("GET")
+	r.HandleFunc("/admin/audit", requireAdmin(listAudit)).Methods("GET")
+	r.HandleFunc("/admin/maintenance", requireAdmin(getMaintenance)).Methods("GET")
+	r.HandleFunc("/admin/maintenance", requireAdmin(postMaintenance)).Methods("POST")
+
+	// Game routes, unprefixed for the default tenant and under /t/{tenant}
+	gameRoutes(r)
+	gameRoutes(r.PathPrefix("/t/{tenant}").Subrouter())
+	return root
+}
+
+func gameRoutes(r *mux.Router) {
+	handle := func(path string, h http.HandlerFunc) *mux.Route {
+		return r.HandleFunc(path, tenantScope(h))
+	}
+	handle("/ws/quickmatch", limitConnections(rejectDraining(rejectMaintenance(rejectBanned(quickMatchSocket)))))
+	handle("/ws/{game_id}", limitConnections(rejectDraining(rejectMaintenanceJoin(rejectBanned(websocketHandler)))))
+	handle("/games", rejectDraining(rejectMaintenance(rejectBanned(createGame)))).Methods("POST")
+	handle("/games/import", rejectDraining(rejectMaintenance(rejectBanned(importGame)))).Methods("POST")
+	handle("/games/{game_id}/board", getBoard).Methods("GET")
+	handle("/games/{game_id}/state", getGameState).Methods("GET")
+	handle("/games/{game_id}/report", reportPlayer).Methods("POST")
+	handle("/games/{game_id}/events", limitConnections(rejectDraining(rejectMaintenanceJoin(rejectBanned(eventStream))))).Methods("GET")
+	handle("/games/{game_id}/actions", postAction).Methods("POST")
+	handle("/games/{game_id}/move", postMove).Methods("POST")
+	handle("/games/{game_id}/replay", getReplay).Methods("GET")
+	handle("/games/{game_id}/replays", getReplays).Methods("GET")
+	handle("/games/{game_id}/export", exportResult).Methods("GET")
+	handle("/replay/{game_id}/{round}", limitConnections(rejectDraining(replaySocket)))
+	handle("/games/{game_id}/history", getHistory).Methods("GET")
+	handle("/games/{game_id}/moves", getMoves).Methods("GET")
+	handle("/games/{game_id}/stats", getGameStats).Methods("GET")
+	handle("/games/{game_id}/openings", getOpenings).Methods("GET")
+	handle("/games/recent", listRecentResults).Methods("GET")
+	handle("/leaderboard", getLeaderboard).Methods("GET")
+	handle("/head2head", getHeadToHead).Methods("GET")
+	handle("/players/{name}", getPlayer).Methods("GET")
+	handle("/lobby", listLobby).Methods("GET")
+	handle("/lobby/ws", limitConnections(rejectDraining(rejectBanned(lobbySocket))))
+	handle("/stats", getRoundStats).Methods("GET")
+	handle("/stats/engagement", getEngagement).Methods("GET")
+	handle("/puzzle", getPuzzle).Methods("GET")
+	handle("/ws/puzzle/{date}", limitConnections(rejectDraining(rejectBanned(puzzleSocket))))
+	handle("/me/games", listMyGames).Methods("GET")
+	handle("/admin/games", requireAdmin(listGames)).Methods("GET")
+	handle("/admin/games/import-state", requireAdmin(importState)).Methods("POST")
+	handle("/admin/games/{game_id}", requireAdmin(getGameSummary)).Methods("GET")
+	handle("/admin/games/{game_id}", requireAdmin(closeGame)).Methods("DELETE")
+	handle("/admin/games/{game_id}/reset", requireAdmin(resetGame)).Methods("POST")
+	handle("/admin/games/{game_id}/watch", requireAdmin(watchGame)).Methods("GET")
+	handle("/admin/games/{game_id}/export-state", requireAdmin(exportState)).Methods("GET")
+	handle("/admin/games/{game_id}/at", requireAdmin(gameAt)).Methods("GET")
+	handle("/admin/games/{game_id}/journal", requireAdmin(getJournal)).Methods("GET")
+	handle("/admin/discord/test", requireAdmin(testDiscord)).Methods("POST")
+}
+
+// Configure applies c to the package as Run does, opening its store, but
+// starts nothing: no cluster, sweeper or listener. Tests that serve
+// NewRouter themselves call it instead of Run.
+func Configure(c config.Config) error {
+	cfg = c
+	upgrader = newUpgrader(c)
+	if c.TokenSecret != "" {
+		tokenKey = []byte(c.TokenSecret)
+	} else {
+		slog.Warn("no -token-secret set: seat tokens are signed with a per-process key, so they stop working on restart and can't be handed to another server")
+	}
+	pages, staticFiles, headless = loadPages(c)
+	s, err := NewStore(c)
+	if err != nil {
+		return err
+	}
+	store = s
+	notifier = discord.NewNotifier(&http.Client{Timeout: 10 * time.Second})
+	return nil
+}
+
+// Run serves the game with c until the listener fails.
+func Run(c config.Config) error {
+	setupLogging(c)
+	if err := Configure(c); err != nil {
+		return err
+	}
+	if c.RedisAddr != "" {
+		if err := startCluster(c.RedisAddr); err != nil {
+			return err
+		}
+	}
+	loadBans()
+	restoreGames()
+	toggleMaintenanceOnSignal()
+	runSweeper()
+	runLatencyReporter()
+	runEngagementRollup()
+	runLobby()
+
+	slog.Info("server starting", "version", buildinfo.Version, "commit", buildinfo.Commit, "addr", cfg.Addr)
+	srv := &http.Server{Addr: cfg.Addr, Handler: NewRouter()}
+	return serveUntilSignal(srv, func() error {
+		if cfg.TLSCert != "" {
+			return srv.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		}
+		return srv.ListenAndServe()
+	})
+}
+
+// Main runs the serve subcommand with command-line args.
+func Main(args []string) error {
+	c, _, err := config.Load("serve", args)
+	if err != nil {
+		return err
+	}
+	return Run(c)
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"tictactoe/config"
+	"tictactoe/engine"
+	"tictactoe/i18n"
+	"tictactoe/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWinningLinesOfGame(t *testing.T) {
+	game := &Game{Board: engine.Board{
+		{"X", "X", "X"},
+		{"O", "X", "O"},
+		{"O", "X", "O"},
+	}}
+	last := engine.Cell{Row: 0, Col: 1}
+	win, ok := engine.FindWin(game.Board, last, nil)
+	if !ok {
+		t.Fatal("no win found")
+	}
+	want := [][][2]int{{{0, 0}, {0, 1}, {0, 2}}, {{0, 1}, {1, 1}, {2, 1}}}
+	if got := game.winningLines(win, last); !reflect.DeepEqual(got, want) {
+		t.Errorf("winningLines for a double line = %v, want %v", got, want)
+	}
+
+	corners := engine.Win{Condition: "corners", Cells: []engine.Cell{{Row: 0, Col: 0}, {Row: 0, Col: 2}, {Row: 2, Col: 0}, {Row: 2, Col: 2}}}
+	if got, want := game.winningLines(corners, engine.Cell{}), [][][2]int{{{0, 0}, {0, 2}, {2, 0}, {2, 2}}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("winningLines for corners = %v, want %v", got, want)
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	failure := localize("de", protocol.Failure("not_your_turn", "X to move"))
+	if failure.Code != "not_your_turn" || failure.Error != "Du bist nicht am Zug." || failure.Detail != "X to move" {
+		t.Errorf("localized failure %+v; want the code and detail kept and the text in German", failure)
+	}
+	notice := localize("de", protocol.Notice(protocol.EventOpponentLeft, "opponent_left"))
+	if notice.Code != "opponent_left" || notice.Message != "Dein Gegner hat das Spiel verlassen." || notice.Error != "" {
+		t.Errorf("localized notice %+v; want the text in Message, not Error", notice)
+	}
+	if plain := localize("de", OutboundMessage{Event: protocol.EventMove}); plain.Message != "" || plain.Error != "" {
+		t.Errorf("a message without a code got text: %+v", plain)
+	}
+}
+
+func TestRequestLocale(t *testing.T) {
+	tests := []struct {
+		query, header, want string
+	}{
+		{"", "", i18n.Default},
+		{"lang=de", "", "de"},
+		{"lang=de-AT", "en", "de"},
+		{"lang=en", "de", "en"}, // ?lang= beats the header
+		{"lang=xx", "de", "de"}, // An unknown one leaves the header to decide
+		{"lang=xx", "", i18n.Default},
+		{"", "fr, de;q=0.5", "de"},
+		{"", "fr", i18n.Default},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/ws/g?"+tt.query, nil)
+		if tt.header != "" {
+			r.Header.Set("Accept-Language", tt.header)
+		}
+		if got := requestLocale(r); got != tt.want {
+			t.Errorf("requestLocale(?%s, %q) = %q, want %q", tt.query, tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestWriteErrorLocalized(t *testing.T) {
+	tests := []struct {
+		header, language, message string
+	}{
+		{"de-DE", "de", "Spiel nicht gefunden."},
+		{"fr", "en", "Game not found."},
+		{"", "en", "Game not found."},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/games/nope/state", nil)
+		r.Header.Set("Accept-Language", tt.header)
+		w := httptest.NewRecorder()
+		writeError(w, r, 404, "game_not_found")
+		var body map[string]string
+		json.NewDecoder(w.Body).Decode(&body)
+		if body["error_code"] != "game_not_found" || body["message"] != tt.message {
+			t.Errorf("Accept-Language %q: body %v, want game_not_found with %q", tt.header, body, tt.message)
+		}
+		if got := w.Header().Get("Content-Language"); got != tt.language {
+			t.Errorf("Accept-Language %q: Content-Language %q, want %q", tt.header, got, tt.language)
+		}
+	}
+}
+
+// Each player hears the game in the language they connected with, and an
+// unknown one gets English, with the same codes either way.
+func TestPlayersLocalizedByLang(t *testing.T) {
+	quickGames(t)
+	id := unusedGameID()
+	_, xc := joinFake(t, id, "lang=de")
+	o, oc := joinFake(t, id, "lang=xx")
+	xc.expect(t, protocol.EventStartGame)
+	oc.expect(t, protocol.EventStartGame)
+
+	o.receive([]byte(`{"event":"make_move","row":1,"col":1}`), newFlood(), gameRequest(id, "lang=xx"))
+	refused := oc.expect(t, protocol.EventInvalidMove)
+	if refused.Code != "not_your_turn" || refused.Error != "It's not your turn." {
+		t.Errorf("O's refusal %+v, want not_your_turn in English", refused)
+	}
+
+	oc.Close()
+	left := xc.expect(t, protocol.EventOpponentLeft)
+	if left.Code != "opponent_left" || left.Message != "Dein Gegner hat das Spiel verlassen." {
+		t.Errorf("X's opponent_left %+v, want it in German", left)
+	}
+}
+
+// BenchmarkWriteBufferPool opens a batch of connections per op, each
+// written one message and then left idle, as most connections are between
+// moves, with and without -ws-buffer-pool. heap-bytes/conn is what the
+// open connections hold between them, server and client side, while idle.
+func BenchmarkWriteBufferPool(b *testing.B) {
+	const conns = 200
+	payload := bytes.Repeat([]byte("x"), 512)
+	for _, pool := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pool=%v", pool), func(b *testing.B) {
+			c := config.Default()
+			c.WriteBufferPool = pool
+			u := newUpgrader(c)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ws, err := u.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer ws.Close()
+				ws.WriteMessage(websocket.TextMessage, payload)
+				ws.ReadMessage() // Idle until the client goes
+			}))
+			defer srv.Close()
+			url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+			b.ReportAllocs()
+			var held uint64
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				var before runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				b.StartTimer()
+
+				open := make([]*websocket.Conn, 0, conns)
+				for j := 0; j < conns; j++ {
+					ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, _, err := ws.ReadMessage(); err != nil {
+						b.Fatal(err)
+					}
+					open = append(open, ws)
+				}
+
+				b.StopTimer()
+				var after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				if after.HeapInuse > before.HeapInuse {
+					held += after.HeapInuse - before.HeapInuse
+				}
+				b.StartTimer()
+				for _, ws := range open {
+					ws.Close()
+				}
+			}
+			b.ReportMetric(float64(held)/float64(b.N*conns), "heap-bytes/conn")
+		})
+	}
+}
+
+// A connection takes every goroutine it started with it when it goes:
+// after 100 clients in turn join a game and leave, the server runs no more
+// goroutines than it did before them.
+func TestConnectionsDontLeakGoroutines(t *testing.T) {
+	withConfig(t, func(c *config.Config) {
+		c.MaxConnsPerIP = 0
+		c.ReconnectGrace = 0
+	})
+	srv := httptest.NewServer(NewRouter())
+	t.Cleanup(srv.Close)
+	t.Cleanup(wsHandlers.Wait) // For the last departure, before cfg goes back
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws/" + unusedGameID()
+	cycle := func() {
+		ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg OutboundMessage
+		if err := ws.ReadJSON(&msg); err != nil {
+			t.Fatalf("no seat or audience spot: %v", err)
+		}
+		ws.Close()
+	}
+	// settled is the goroutine count once it stops falling, or at most
+	// limit, whichever comes first, giving up after two seconds.
+	settled := func(limit int) int {
+		n := runtime.NumGoroutine()
+		for deadline := time.Now().Add(2 * time.Second); n > limit && time.Now().Before(deadline); {
+			time.Sleep(20 * time.Millisecond)
+			next := runtime.NumGoroutine()
+			if next == n && limit == 0 {
+				break
+			}
+			n = next
+		}
+		return n
+	}
+
+	cycle() // Starts the game's loop, which stays until the game goes
+	before := settled(0)
+	for i := 0; i < 100; i++ {
+		cycle()
+	}
+	if after := settled(before); after > before {
+		t.Errorf("%d goroutines after 100 connections came and went, %d before", after, before)
+	}
+}
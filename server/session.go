@@ -0,0 +1,162 @@
+package server
+
+import (
+	"log/slog"
+	"time"
+)
+
+// --- Seat Sessions ---
+
+// Session is a seat token's binding to its game and seat, persisted for as
+// long as the seat is held so the token still works after a restart.
+type Session struct {
+	Token     string    `json:"token"`
+	Tenant    string    `json:"tenant"`
+	GameID    string    `json:"game_id"`
+	Symbol    string    `json:"symbol"`
+	Identity  string    `json:"identity,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// saveSession persists the hold on symbol's seat until until. Runs on
+// the game's loop.
+func (game *Game) saveSession(symbol, token, identity string, until time.Time) {
+	s := Session{
+		Token:     token,
+		Tenant:    game.Tenant,
+		GameID:    game.ID,
+		Symbol:    symbol,
+		Identity:  identity,
+		ExpiresAt: until.UTC(),
+	}
+	log := game.logger()
+	game.storeLater(func() {
+		if err := store.SaveSession(s); err != nil {
+			log.Error("saving session", "seat", symbol, "err", err)
+		}
+	})
+}
+
+// revokeSession deletes token's session after the game's earlier writes,
+// so it can't be saved again behind the delete. Runs on the game's
+// loop.
+func (game *Game) revokeSession(token string) {
+	game.storeLater(func() { revokeSession(token) })
+}
+
+func revokeSession(token string) {
+	if err := store.DeleteSession(token); err != nil {
+		slog.Error("revoking session", "err", err)
+	}
+}
+
+// releaseSeat frees a held seat for good and revokes its token's session.
+// Runs on the game's loop.
+func (game *Game) releaseSeat(symbol string) {
+	token := game.Reserved[symbol]
+	delete(game.HeldUntil, symbol)
+	delete(game.Reserved, symbol)
+	if token != "" {
+		delete(game.restored, symbol)
+		game.revokeSession(token)
+	}
+}
+
+// suspendGame snapshots a live game on shutdown and holds every seat for
+// cfg.ReconnectGrace, so restoreGames can bring it back with the same
+// tokens. Runs on the game's loop.
+func (game *Game) suspendGame(now time.Time) {
+	game.closed = true
+	var sessions []Session
+	if cfg.ReconnectGrace > 0 && !game.Correspondence { // A correspondence game keeps every seat regardless
+		until := now.Add(cfg.ReconnectGrace).UTC()
+		for _, p := range game.Players {
+			sessions = append(sessions, Session{Token: p.Token, Tenant: game.Tenant, GameID: game.ID, Symbol: p.Symbol, Identity: p.Identity, ExpiresAt: until})
+		}
+		for symbol, token := range game.Reserved {
+			if held, ok := game.HeldUntil[symbol]; ok && held.Before(until) {
+				continue // Already saved with its own, earlier deadline
+			}
+			sessions = append(sessions, Session{Token: token, Tenant: game.Tenant, GameID: game.ID, Symbol: symbol, ExpiresAt: until})
+		}
+	}
+	st, log := game.exportState(), game.logger()
+	game.storeLater(func() {
+		if err := store.SaveSnapshot(st); err != nil {
+			log.Error("saving snapshot", "err", err)
+			return // Without the snapshot the seats have nothing to come back to
+		}
+		for _, s := range sessions {
+			if err := store.SaveSession(s); err != nil {
+				log.Error("saving session", "seat", s.Symbol, "err", err)
+			}
+		}
+	})
+}
+
+// restoreGames recreates the games suspended by the last shutdown, and the
+// durable games kept in the store. A seat comes back reserved only if its
+// session is still unexpired; the rest are open to anyone. A correspondence
+// game gets every seat back.
+func restoreGames() {
+	states, err := store.ListSnapshots()
+	if err != nil {
+		slog.Error("listing snapshots", "err", err)
+		return
+	}
+	now := time.Now()
+	for _, st := range states {
+		tenant := storedTenant(st.Tenant)
+		if err := store.DeleteSnapshot(tenant, st.ID); err != nil {
+			slog.Error("deleting snapshot", "game_id", st.ID, "err", err)
+		}
+		if err := validateState(st); err != nil {
+			slog.Warn("discarding snapshot", "game_id", st.ID, "err", err)
+			continue
+		}
+		if _, ok := lookupTenant(tenant); !ok {
+			slog.Warn("discarding snapshot, tenant no longer exists", "game_id", st.ID, "tenant", tenant)
+			continue
+		}
+		game := gameFromState(st, tenant)
+		for _, seat := range st.Seats {
+			if game.Correspondence {
+				game.Reserved[seat.Symbol] = seat.Token
+				game.restored[seat.Symbol] = seat.Token
+				continue
+			}
+			s, ok, err := store.LoadSession(seat.Token)
+			if err != nil {
+				slog.Error("loading session", "game_id", st.ID, "seat", seat.Symbol, "err", err)
+				continue
+			}
+			if !ok || s.Tenant != tenant || s.GameID != st.ID || s.Symbol != seat.Symbol {
+				continue
+			}
+			if !now.Before(s.ExpiresAt) {
+				revokeSession(seat.Token)
+				continue
+			}
+			game.Reserved[seat.Symbol] = seat.Token
+			game.HeldUntil[seat.Symbol] = s.ExpiresAt
+			game.restored[seat.Symbol] = seat.Token
+			game.releaseAt(seat.Symbol, seat.Token, s.ExpiresAt)
+		}
+		game.EmptySince = now
+
+		gamesMutex.Lock()
+		if games[game.key()] != nil {
+			gamesMutex.Unlock()
+			slog.Warn("discarding snapshot, ID already in use", "game_id", st.ID)
+			continue
+		}
+		registerGame(game)
+		gamesMutex.Unlock()
+		game.do(func() {
+			game.persist()
+			game.armSchedule() // Catches up if the start passed while down
+			game.armDeadlines()
+		})
+		game.logger().Info("game restored", "seats_held", len(game.Reserved), "seats", len(st.Seats))
+	}
+}
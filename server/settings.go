@@ -0,0 +1,154 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// --- Game Settings ---
+
+// The first player may set the game's options with configure while they
+// wait: who starts, the turn timer, a best-of series and the board size.
+// Each change is echoed to them as settings. Once configured, the game
+// offers the settings to the second player on arrival and starts when they
+// send accept_settings, or when cfg.SettingsTimeout runs out. After the
+// second player has joined, the settings are fixed for the rest of the
+// game, rematches included, and go out on every start_game and new_game.
+
+// settings is the game's current options. Runs on the game's loop.
+func (game *Game) settings() *protocol.Settings {
+	timer, bestOf := int(game.TurnTimer/time.Second), game.bestOf()
+	return &protocol.Settings{First: game.FirstPlayer, TurnTimer: &timer, BestOf: &bestOf, Size: game.Board.Size()}
+}
+
+// handleConfigure applies p's settings if the game can still take them.
+// Runs on the game's loop.
+func (game *Game) handleConfigure(p *Player, s *protocol.Settings) {
+	if len(game.Players) > 1 || !game.StartedAt.IsZero() || game.Round > 1 || len(game.Moves) > 0 || game.Correspondence || game.scheduled() {
+		p.send(localize(p.locale(), protocol.Failure("settings_locked", "")))
+		return
+	}
+	size := game.Board.Size()
+	switch {
+	case s.First != "" && !game.isSymbol(s.First):
+		p.send(localize(p.locale(), protocol.Failure("invalid_settings", "first must be "+symbolChoices(game.symbols()))))
+		return
+	case s.First != "" && game.CoinFlip:
+		p.send(localize(p.locale(), protocol.Failure("invalid_settings", "a game with coin_flip can't have first")))
+		return
+	case s.TurnTimer != nil && *s.TurnTimer < 0:
+		p.send(localize(p.locale(), protocol.Failure("invalid_settings", "turn_timer can't be negative")))
+		return
+	case s.BestOf != nil && *s.BestOf != 0 && !validBestOf(*s.BestOf):
+		p.send(localize(p.locale(), protocol.Failure("invalid_settings", fmt.Sprintf("best_of must be 0 or odd, from 3 to %d", maxBestOf))))
+		return
+	case s.BestOf != nil && *s.BestOf != 0 && game.HeadToHead:
+		p.send(localize(p.locale(), protocol.Failure("invalid_settings", "a head_to_head game can't have best_of")))
+		return
+	case s.BestOf != nil && *s.BestOf != 0 && game.MaxRounds > 0:
+		p.send(localize(p.locale(), protocol.Failure("invalid_settings", "a game with max_rounds can't have best_of")))
+		return
+	case s.Size != 0 && game.ultimate() && s.Size != engine.UltimateSize:
+		p.send(localize(p.locale(), protocol.Failure("invalid_settings", "an ultimate game's board can't be resized")))
+		return
+	case s.Size != 0 && game.ThreePlayer && s.Size < threePlayerMinSize:
+		p.send(localize(p.locale(), protocol.Failure("invalid_settings", fmt.Sprintf("a three-player game needs a board of at least %dx%d", threePlayerMinSize, threePlayerMinSize))))
+		return
+	case s.Size != 0 && !game.ultimate():
+		var err error
+		if size, _, err = boardRules(s.Size, 0); err != nil {
+			p.send(localize(p.locale(), protocol.Failure("invalid_settings", err.Error())))
+			return
+		}
+	}
+
+	if s.First != "" {
+		game.FirstPlayer, game.StartingPlayerForRound, game.CurrentPlayer = s.First, s.First, s.First
+	}
+	if s.TurnTimer != nil {
+		game.TurnTimer = time.Duration(*s.TurnTimer) * time.Second
+	}
+	if s.BestOf != nil {
+		game.TargetWins = (*s.BestOf + 1) / 2
+	}
+	if size != game.Board.Size() {
+		game.Board = engine.NewBoard(size)
+		game.BoardSeq++
+		if game.blitz() {
+			// Still won by three, whatever the board
+			game.WinLength = 0
+			if size != engine.BlitzMarks {
+				game.WinLength = engine.BlitzMarks
+			}
+			wins, _ := engine.ParseWinConditions(engine.ConditionNames(game.WinConditions))
+			game.WinConditions = engine.WithWinLength(wins, game.WinLength)
+		} else if game.WinLength > size {
+			// Too long a run for the new board; back to full lines
+			game.WinLength = 0
+			game.WinConditions, _ = engine.ParseWinConditions(engine.ConditionNames(game.WinConditions))
+		}
+	}
+	game.Configured = p.Symbol
+	game.logger().Info("game configured", "first", game.FirstPlayer, "turn_timer", game.TurnTimer, "best_of", game.bestOf(), "size", size)
+	broadcast(game, OutboundMessage{Event: protocol.EventSettings, Player: p.Symbol, Settings: game.settings()})
+}
+
+// awaitingSettings reports whether the round is held until the second
+// player accepts the first one's settings. Runs on the game's loop.
+func (game *Game) awaitingSettings() bool {
+	return game.Configured != "" && !game.SettingsAccepted && len(game.Players) == game.seats()
+}
+
+// offerSettings asks the second player to accept the settings, starting
+// the game anyway once cfg.SettingsTimeout has passed. Runs on the game's
+// loop.
+func (game *Game) offerSettings() {
+	msg := OutboundMessage{Event: protocol.EventSettings, Player: game.Configured, Settings: game.settings(), Code: "settings_offered"}
+	game.stopSettingsTimeout()
+	if cfg.SettingsTimeout > 0 {
+		deadline := time.Now().Add(cfg.SettingsTimeout).UTC()
+		msg.Deadline = &deadline
+		gen := game.settingsGen
+		game.settingsTimer = time.AfterFunc(cfg.SettingsTimeout, func() {
+			game.do(func() {
+				if game.settingsGen != gen || game.closed || !game.awaitingSettings() {
+					return
+				}
+				game.settingsTimer = nil
+				game.journal.timer("settings_timeout")
+				game.acceptSettings()
+			})
+		})
+	}
+	broadcast(game, msg)
+}
+
+// handleAcceptSettings starts the game if p is the player the settings
+// were offered to. Runs on the game's loop.
+func (game *Game) handleAcceptSettings(p *Player) {
+	if !game.awaitingSettings() || p.Symbol == game.Configured {
+		return // Nothing to answer
+	}
+	game.acceptSettings()
+}
+
+// acceptSettings fixes the settings and starts the game. Runs on the game's
+// loop.
+func (game *Game) acceptSettings() {
+	game.SettingsAccepted = true
+	game.stopSettingsTimeout()
+	game.startRound(protocol.EventStartGame)
+}
+
+// stopSettingsTimeout cancels a pending timeout, including one that
+// already fired and is waiting its turn on the loop. Runs on the game's loop.
+func (game *Game) stopSettingsTimeout() {
+	if game.settingsTimer != nil {
+		game.settingsTimer.Stop()
+		game.settingsTimer = nil
+	}
+	game.settingsGen++
+}
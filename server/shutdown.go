@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"tictactoe/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// --- Shutdown ---
+
+// draining is set once shutdown begins. New games and connections are
+// refused, but moves on existing sockets keep applying until the grace
+// period ends.
+var draining atomic.Bool
+
+// wsHandlers counts running websocket handlers, so shutdown can wait for
+// their cleanup after closing the sockets. srv.Shutdown doesn't track
+// hijacked connections.
+var wsHandlers sync.WaitGroup
+
+// shutdownTimeout bounds the wait for handlers and HTTP requests once the
+// sockets are closed.
+const shutdownTimeout = 5 * time.Second
+
+// waitHandlers waits for every websocket handler to return, reporting
+// false if ctx ran out first.
+func waitHandlers(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		wsHandlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func rejectDraining(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if draining.Load() {
+			writeError(w, r, http.StatusServiceUnavailable, "server_shutting_down")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// broadcastAll sends msg to every player and watcher of every live game.
+func broadcastAll(msg OutboundMessage) {
+	for _, game := range liveGames() {
+		game.do(func() {
+			broadcast(game, msg)
+		})
+	}
+}
+
+// closeAll suspends every live game for restoreGames to pick up and
+// force-closes the remaining websockets, queued quick matches included,
+// with protocol.CloseShutdown.
+func closeAll() {
+	closeLobby()
+	quickMatch.close()
+	if cluster != nil {
+		cluster.closeRelayed()
+	}
+	now := time.Now()
+	for _, game := range liveGames() {
+		game.do(func() {
+			game.suspendGame(now)
+			for _, p := range game.connections() {
+				msg := websocket.FormatCloseMessage(protocol.CloseShutdown, "server shutdown")
+				p.Conn.WriteClose(msg)
+				p.drop()
+			}
+		})
+	}
+}
+
+// serveUntilSignal runs srv with listen until SIGINT or SIGTERM, then warns
+// every client, drains for cfg.ShutdownGrace and closes what is left.
+func serveUntilSignal(srv *http.Server, listen func() error) error {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	errc := make(chan error, 1)
+	go func() { errc <- listen() }()
+
+	select {
+	case err := <-errc:
+		return err
+	case sig := <-stop:
+		slog.Info("draining", "signal", sig.String(), "grace", cfg.ShutdownGrace)
+	}
+
+	draining.Store(true)
+	closesAt := time.Now().Add(cfg.ShutdownGrace).UTC()
+	broadcastAll(OutboundMessage{
+		Event:    protocol.EventServerShutdown,
+		Deadline: &closesAt,
+		Code:     "server_shutdown",
+	})
+
+	select {
+	case <-time.After(cfg.ShutdownGrace):
+	case <-stop:
+		slog.Warn("second signal, closing immediately")
+	}
+	closeAll()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if !waitHandlers(ctx) {
+		slog.Warn("websocket handlers still running at the shutdown deadline")
+	}
+	if !flushStore(ctx) {
+		slog.Warn("store writes still queued at the shutdown deadline")
+	}
+	rollupEngagement(time.Now())
+	return srv.Shutdown(ctx)
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"tictactoe/buildinfo"
+	"tictactoe/protocol"
+)
+
+// --- Spectators ---
+
+const maxSpectators = 50
+
+// connections lists players, then spectators: everyone with a socket on the
+// game. Runs on the game's loop.
+func (game *Game) connections() []*Player {
+	return append(append([]*Player(nil), game.Players...), game.Spectators...)
+}
+
+// addSpectator seats p in the audience and sends it the game as it stands,
+// plus any seat it could claim right away. Runs on the game's loop.
+func (game *Game) addSpectator(p *Player) {
+	p.setSeat(p.Symbol, RoleSpectator)
+	game.Spectators = append(game.Spectators, p)
+	p.send(OutboundMessage{Event: protocol.EventSpectatorAssignment, From: p.participant(), ServerInfo: buildinfo.Version})
+	sync := protocol.BoardState(protocol.EventSync, game.Board, game.CurrentPlayer, &game.Score)
+	sync.Participants = game.participants()
+	sync.Seq = game.BoardSeq
+	sync.Spectators = game.spectatorCount()
+	sync.Ultimate = game.ultimateBoard()
+	p.send(sync)
+	for _, symbol := range game.openSeats() {
+		p.send(localize(p.locale(), OutboundMessage{Event: protocol.EventSeatOpen, Player: symbol, Code: "seat_open"}))
+	}
+	game.announceSpectators()
+}
+
+// spectatorCount is the size of the audience, for Spectators on outbound
+// messages. Runs on the game's loop.
+func (game *Game) spectatorCount() *int {
+	n := len(game.Spectators)
+	return &n
+}
+
+// announceSpectators tells everyone how many are now watching. Runs on
+// the game's loop.
+func (game *Game) announceSpectators() {
+	broadcast(game, OutboundMessage{Event: protocol.EventSpectatorCount, Spectators: game.spectatorCount()})
+}
+
+// removeSpectator drops p from the audience, reporting whether it was
+// there. Runs on the game's loop.
+func (game *Game) removeSpectator(p *Player) bool {
+	for i, s := range game.Spectators {
+		if s == p {
+			game.Spectators = append(game.Spectators[:i], game.Spectators[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// openSeats lists the seats nobody holds: not occupied, and not reserved
+// for a dropped player still within their grace period. Runs on the game's
+// loop.
+func (game *Game) openSeats() []string {
+	var out []string
+	for _, symbol := range game.symbols() {
+		taken := game.Reserved[symbol] != "" || game.AI == symbol
+		for _, p := range game.Players {
+			taken = taken || p.Symbol == symbol
+		}
+		if !taken {
+			out = append(out, symbol)
+		}
+	}
+	return out
+}
+
+// announceOpenSeats tells every spectator about the seats they may claim.
+// Runs on the game's loop.
+func (game *Game) announceOpenSeats() {
+	for _, symbol := range game.openSeats() {
+		for _, s := range game.Spectators {
+			s.send(localize(s.locale(), OutboundMessage{Event: protocol.EventSeatOpen, Player: symbol, Code: "seat_open"}))
+		}
+	}
+}
+
+// promote answers claim_seat, turning spectator p into the player of the
+// first open seat. Claims are decided in the order they reach the loop:
+// the first wins and later ones find no open seat. A seat held for a
+// dropped player is never open, so they win any race during their grace
+// period. Runs on the game's loop.
+func (game *Game) promote(p *Player, r *http.Request) {
+	if _, banned := bans.Lookup(p.IP, p.Identity); banned {
+		p.send(localize(p.locale(), protocol.Failure("banned", "")))
+		return
+	}
+	if game.private() && !p.mayPlay {
+		p.send(localize(p.locale(), protocol.Failure("wrong_password", "")))
+		return
+	}
+	open := game.openSeats()
+	if len(open) == 0 {
+		p.send(localize(p.locale(), protocol.Failure("seat_not_open", "")))
+		return
+	}
+	symbol := open[0]
+	game.removeSpectator(p)
+	game.announceSpectators()
+	p.setSeat(symbol, RolePlayer)
+	game.SeatEpochs[symbol]++ // The previous holder's token no longer works
+	p.Token = issueSeatToken(game, symbol)
+	game.Players = append(game.Players, p)
+	game.markOccupied()
+	game.recordSeat(p)
+	game.assignHost(p)
+	game.lobbyChanged()
+
+	p.send(OutboundMessage{
+		Event:          protocol.EventPlayerAssignment,
+		Player:         symbol,
+		Token:          p.Token,
+		ReconnectURL:   reconnectURL(r, game, p.Token),
+		ReconnectGrace: int(cfg.ReconnectGrace / time.Second),
+		Score:          &game.Score,
+		CoinCommitment: game.coinPending(),
+	})
+	if !game.takeOverSeat(p) {
+		for _, other := range game.Players {
+			if other != p {
+				other.send(localize(other.locale(), OutboundMessage{Event: protocol.EventOpponentJoined, From: p.participant(), Code: "opponent_joined"}))
+			}
+		}
+	}
+	if game.Correspondence && len(game.openSeats()) == 0 {
+		game.welcomeCorrespondence(p)
+		return
+	}
+	if len(game.Players) == game.seats() {
+		game.startRound(protocol.EventStartGame)
+		return
+	}
+	sync := protocol.BoardState(protocol.EventSync, game.Board, game.CurrentPlayer, &game.Score)
+	sync.Participants = game.participants()
+	sync.Ultimate = game.ultimateBoard()
+	p.send(sync)
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"tictactoe/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// --- Event Streams ---
+
+// Some proxies strip the Upgrade header, so websockets never connect. GET
+// /games/{game_id}/events joins the game as /ws/{game_id} does, taking the
+// same query parameters, and streams what the websocket would carry as
+// Server-Sent Events, one OutboundMessage per data line. The client acts by
+// POSTing inbound messages to /games/{game_id}/actions with the token from
+// player_assignment as a bearer token. Keepalive pings go out as comments,
+// which also stops proxies from timing out an idle stream; a ping that
+// gets written counts as answered. The stream ends with a close event
+// carrying the code and reason a websocket would get in its close frame.
+// Spectators have no token, so their stream is watch-only.
+
+// sseConn is a conn over an event stream.
+type sseConn struct {
+	w     http.ResponseWriter
+	rc    *http.ResponseController
+	codec protocol.Codec // JSON in the wire version ?v= asked for
+
+	mu       sync.Mutex // Serializes writes and guards closed and answered
+	closed   bool
+	done     chan struct{} // Closed by Close; ends the stream's handler
+	answered func()        // Called for each ping written; see Ping
+
+	inbound sync.Mutex // Serializes the player's actions, as a websocket's read loop does
+	flood   *flood
+}
+
+func newSSEConn(w http.ResponseWriter, version int) *sseConn {
+	return &sseConn{w: w, rc: http.NewResponseController(w), codec: protocol.ForVersion(protocol.JSON, version), done: make(chan struct{}), flood: newFlood()}
+}
+
+// write sends one event-stream frame and flushes it, bounded by
+// cfg.WriteTimeout. Once the conn is closed the handler may have returned,
+// so nothing more is written.
+func (c *sseConn) write(frame string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	c.rc.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+	if _, err := io.WriteString(c.w, frame); err != nil {
+		return err
+	}
+	return c.rc.Flush()
+}
+
+func (c *sseConn) Write(msg OutboundMessage) error {
+	data, err := c.codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.write("data: " + string(data) + "\n\n")
+}
+
+// Codec is JSON: an event stream is text.
+func (c *sseConn) Codec() protocol.Codec {
+	return c.codec
+}
+
+func (c *sseConn) WriteClose(frame []byte) {
+	code, reason := websocket.CloseNormalClosure, ""
+	if len(frame) >= 2 {
+		code, reason = int(binary.BigEndian.Uint16(frame)), string(frame[2:])
+	}
+	data, _ := json.Marshal(map[string]interface{}{"code": code, "reason": reason})
+	c.write("event: close\ndata: " + string(data) + "\n\n")
+}
+
+// Ping writes a keepalive comment. There is no pong on a stream, but a
+// write to a vanished client fails sooner or later, so one that goes
+// through stands in for the answer.
+func (c *sseConn) Ping(string) error {
+	if err := c.write(": ping\n\n"); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	answered := c.answered
+	c.mu.Unlock()
+	if answered != nil {
+		answered()
+	}
+	return nil
+}
+
+// SetReadDeadline does nothing: actions arrive on requests of their own,
+// and a stream's liveness rests on its writes.
+func (c *sseConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func (c *sseConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+	}
+	return nil
+}
+
+// eventStream is the event-stream counterpart of websocketHandler.
+func eventStream(w http.ResponseWriter, r *http.Request) {
+	locale := declaredLocale(r)
+	if _, remote := routeGame(requestGameKey(r)); remote {
+		writeError(w, r, http.StatusMisdirectedRequest, "game_elsewhere")
+		return
+	}
+
+	version, ok := protocol.ParseVersion(r.URL.Query().Get("v"))
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, "unsupported_version")
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no") // Don't let nginx hold events back
+	w.WriteHeader(http.StatusOK)
+	c := newSSEConn(w, version)
+	if err := c.rc.Flush(); err != nil {
+		return
+	}
+	wsHandlers.Add(1)
+	defer wsHandlers.Done()
+	metrics.Connections.Add(1)
+	defer metrics.Connections.Add(-1)
+
+	player := join(c, r, locale)
+	if player == nil {
+		return
+	}
+	defer player.leave()
+	c.mu.Lock()
+	c.answered = player.heard
+	c.mu.Unlock()
+
+	select {
+	case <-player.ctx.Done(): // Dropped, or the client went away
+	case <-c.done:
+	}
+}
+
+// postAction takes one inbound message, as a websocket client would send
+// it, from the seated player whose event stream the bearer token names.
+// What comes of it, errors included, arrives on the stream.
+func postAction(w http.ResponseWriter, r *http.Request) {
+	key := requestGameKey(r)
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	gamesMutex.RLock()
+	game, exists := games[key]
+	gamesMutex.RUnlock()
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "game_not_found")
+		return
+	}
+	var player *Player
+	game.do(func() {
+		for _, p := range game.Players {
+			if token != "" && p.Token == token {
+				player = p
+			}
+		}
+	})
+	if player == nil {
+		writeError(w, r, http.StatusUnauthorized, "token_invalid")
+		return
+	}
+	c, ok := player.Conn.(*sseConn)
+	if !ok {
+		writeError(w, r, http.StatusConflict, "no_event_stream")
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxInboundSize+1))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_body")
+		return
+	}
+	if len(data) > maxInboundSize {
+		writeError(w, r, http.StatusRequestEntityTooLarge, "message_too_large")
+		return
+	}
+	c.inbound.Lock()
+	player.receive(data, c.flood, r)
+	c.inbound.Unlock()
+	w.WriteHeader(http.StatusAccepted)
+}
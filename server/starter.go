@@ -0,0 +1,45 @@
+package server
+
+import "tictactoe/engine"
+
+// --- Starting Player ---
+
+// Round 1 starts with the game's FirstPlayer. Who starts each round after
+// that is the game's StarterPolicy, fixed when it is created.
+
+// Starting player policies; the engine applies them.
+const (
+	starterAlternate = engine.StarterAlternate
+	starterLoser     = engine.StarterLoser
+	starterWinner    = engine.StarterWinner
+	starterAlwaysX   = engine.StarterAlwaysX
+)
+
+// validStarterPolicy reports whether policy is one StarterPolicy accepts.
+func validStarterPolicy(policy string) bool {
+	switch policy {
+	case starterAlternate, starterLoser, starterWinner, starterAlwaysX:
+		return true
+	}
+	return false
+}
+
+// starterPolicy is the game's StarterPolicy, alternate if it has none.
+// Runs on the game's loop.
+func (game *Game) starterPolicy() string {
+	if game.StarterPolicy == "" {
+		return starterAlternate
+	}
+	return game.StarterPolicy
+}
+
+// nextStarter is who starts the round after the one just finished, as
+// engine.NextStarter has it. Runs on the game's loop, before the round is
+// archived.
+func (game *Game) nextStarter() string {
+	result := game.result()
+	if !game.isSymbol(result) {
+		result = "" // A draw
+	}
+	return engine.NextStarter(game.starterPolicy(), game.StartingPlayerForRound, result, game.seats())
+}
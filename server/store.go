@@ -0,0 +1,426 @@
+package server
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"tictactoe/config"
+	"tictactoe/engine"
+	"tictactoe/replay"
+)
+
+// --- Persistence ---
+
+// Store is the persistence layer for everything that must outlive a
+// single process: moderation reports and bans, finished game records,
+// ratings, snapshots of live games and the sessions of their held seats,
+// and the result of every round played. Features build on this interface
+// only, so every backend behaves the same.
+type Store interface {
+	SaveReport(report Report) error
+	ListReports(status string) ([]Report, error)
+	SaveBan(ban Ban) error
+	DeleteBan(id string) error
+	ListBans() ([]Ban, error)
+	SaveGameRecord(rec GameRecord) error
+	LoadGameRecord(tenant, id string) (GameRecord, bool, error)
+	AppendAudit(entry AuditEntry) error
+	ListAudit() ([]AuditEntry, error)
+	LoadPlayer(tenant, identity string) (PlayerRecord, bool, error)
+	FindPlayer(tenant, name string) (PlayerRecord, bool, error)      // The latest player saved under name
+	SavePlayers(tenant string, records ...PlayerRecord) error        // All of them or none, so a result is never half applied
+	ListTopPlayers(tenant string, limit int) ([]PlayerRecord, error) // Highest rating first
+	SaveSnapshot(st GameState) error
+	DeleteSnapshot(tenant, id string) error
+	ListSnapshots() ([]GameState, error)
+	SaveEngagement(row EngagementDay) error
+	ListEngagement(since string) ([]EngagementDay, error)
+	SaveSession(s Session) error
+	LoadSession(token string) (Session, bool, error) // Expired sessions may still be returned
+	DeleteSession(token string) error
+	SaveRoundResult(res RoundResult) error                             // Adds it to the tenant's RoundStats in the same write
+	ListRoundResults(tenant, gameID string) ([]RoundResult, error)     // Oldest first
+	ListRecentResults(tenant string, limit int) ([]RoundResult, error) // Newest first
+	LoadRoundStats(tenant string) (RoundStats, error)                  // Totals over every result saved
+	AddHeadToHead(delta HeadToHead) error                              // Adds delta's rounds to the pair's record in one atomic update
+	LoadHeadToHead(tenant, a, b string) (HeadToHead, bool, error)      // The names in either order
+}
+
+// AuditEntry records one admin intervention.
+type AuditEntry struct {
+	At     time.Time `json:"at"`
+	Admin  string    `json:"admin"`
+	Action string    `json:"action"`
+	GameID string    `json:"game_id,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// PlayerRecord is a rated player's standing in one tenant, keyed by the
+// identity their client supplies. The identity also reclaims their seats,
+// so it stays in the store: see public. Tenants rate their players
+// separately; the players from before tenants are the default tenant's.
+type PlayerRecord struct {
+	Identity string `json:"identity,omitempty"`
+	Name     string `json:"name,omitempty"` // Display name in their latest rated round, if they gave one
+	Rating   int    `json:"rating"`
+	Games    int    `json:"games"` // Rated rounds played
+	Wins     int    `json:"wins"`
+	Losses   int    `json:"losses"`
+	Draws    int    `json:"draws"`
+}
+
+// GameRecord is a finished game kept for history and analysis.
+type GameRecord struct {
+	ID         string         `json:"id"`
+	Rounds     []replay.Round `json:"rounds"`
+	Score      Score          `json:"score"`
+	Imported   bool           `json:"imported"`
+	FinishedAt time.Time      `json:"finished_at"`
+
+	Tenant        string   `json:"tenant,omitempty"` // Empty for records from before tenants, which are the default tenant's
+	WinConditions []string `json:"win_conditions,omitempty"`
+
+	Size      int `json:"size,omitempty"`       // Board size; 0 for engine.DefaultSize
+	WinLength int `json:"win_length,omitempty"` // See Game.WinLength
+
+	Players int `json:"players,omitempty"` // 3 for a three-player game; 0 for X and O
+}
+
+// RoundResult is one finished round, kept so a game ID's series of rounds
+// survives the game itself; see series.go.
+type RoundResult struct {
+	GameID     string       `json:"game_id"`
+	Tenant     string       `json:"tenant"`
+	Round      int          `json:"round"`
+	Winner     string       `json:"winner,omitempty"`  // "" for a draw
+	Timeout    bool         `json:"timeout,omitempty"` // Won because the loser ran out of time
+	Board      engine.Board `json:"board"`
+	Moves      int          `json:"moves"`
+	Score      Score        `json:"score"` // The series score after this round
+	FinishedAt time.Time    `json:"finished_at"`
+
+	Starter    string  `json:"starter,omitempty"`     // Who moved first; absent in older results
+	FirstMove  *[2]int `json:"first_move,omitempty"`  // Row and column of the opening mark
+	DurationMS int64   `json:"duration_ms,omitempty"` // From the first move's turn to the end; 0 if unknown
+}
+
+var store Store = newMemoryStore()
+
+// storedTenant is the tenant a game record or snapshot is kept under. One
+// from before tenants has none and belongs to the default tenant, the only
+// one there was.
+func storedTenant(tenant string) string {
+	if tenant == "" {
+		return config.DefaultTenant
+	}
+	return tenant
+}
+
+// Migrator is implemented by stores that keep a schema which must be
+// brought up to date before serving.
+type Migrator interface {
+	Migrate() error
+}
+
+// Pinger is implemented by stores backed by a server or file that can
+// become unreachable, for the readiness probe.
+type Pinger interface {
+	Ping() error
+}
+
+// NewStore opens the store selected by c.
+func NewStore(c config.Config) (Store, error) {
+	switch c.Store {
+	case "sqlite":
+		return openSQLiteStore(c.StoreDSN)
+	case "redis":
+		return openRedisStore(c.StoreDSN)
+	}
+	return newMemoryStore(), nil
+}
+
+type memoryStore struct {
+	mu        sync.RWMutex
+	reports   map[string]Report
+	bans      map[string]Ban
+	records   map[[2]string]GameRecord // By tenant and game ID
+	audit     []AuditEntry
+	players   map[[2]string]PlayerRecord // By tenant and identity
+	snapshots map[[2]string]GameState    // By tenant and game ID
+
+	engagement map[[3]string]EngagementDay // By day, tenant and instance
+	sessions   map[string]Session          // By token
+	results    []RoundResult               // Oldest first
+	roundStats map[string]RoundStats       // By tenant
+	names      map[[2]string]string        // Tenant and player name to identity
+	headToHead map[[2]string]HeadToHead    // By tenant and headToHeadKey
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		reports:   make(map[string]Report),
+		bans:      make(map[string]Ban),
+		records:   make(map[[2]string]GameRecord),
+		players:   make(map[[2]string]PlayerRecord),
+		names:     make(map[[2]string]string),
+		snapshots: make(map[[2]string]GameState),
+
+		engagement: make(map[[3]string]EngagementDay),
+		sessions:   make(map[string]Session),
+		roundStats: make(map[string]RoundStats),
+		headToHead: make(map[[2]string]HeadToHead),
+	}
+}
+
+func (s *memoryStore) SaveReport(report Report) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reports[report.ID] = report
+	return nil
+}
+
+func (s *memoryStore) ListReports(status string) ([]Report, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Report, 0, len(s.reports))
+	for _, r := range s.reports {
+		if status == "" || r.Status == status {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (s *memoryStore) SaveBan(ban Ban) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bans[ban.ID] = ban
+	return nil
+}
+
+func (s *memoryStore) DeleteBan(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.bans, id)
+	return nil
+}
+
+func (s *memoryStore) ListBans() ([]Ban, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Ban, 0, len(s.bans))
+	for _, b := range s.bans {
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+func (s *memoryStore) SaveGameRecord(rec GameRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[[2]string{storedTenant(rec.Tenant), rec.ID}] = rec
+	return nil
+}
+
+func (s *memoryStore) LoadGameRecord(tenant, id string) (GameRecord, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.records[[2]string{tenant, id}]
+	return rec, ok, nil
+}
+
+func (s *memoryStore) AppendAudit(entry AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = append(s.audit, entry)
+	return nil
+}
+
+func (s *memoryStore) ListAudit() ([]AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]AuditEntry(nil), s.audit...), nil
+}
+
+func (s *memoryStore) LoadPlayer(tenant, identity string) (PlayerRecord, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec, ok := s.players[[2]string{tenant, identity}]
+	return rec, ok, nil
+}
+
+func (s *memoryStore) FindPlayer(tenant, name string) (PlayerRecord, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	identity, ok := s.names[[2]string{tenant, name}]
+	if !ok {
+		return PlayerRecord{}, false, nil
+	}
+	rec, ok := s.players[[2]string{tenant, identity}]
+	return rec, ok, nil
+}
+
+func (s *memoryStore) SavePlayers(tenant string, records ...PlayerRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rec := range records {
+		s.players[[2]string{tenant, rec.Identity}] = rec
+		if rec.Name != "" {
+			s.names[[2]string{tenant, rec.Name}] = rec.Identity
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) ListTopPlayers(tenant string, limit int) ([]PlayerRecord, error) {
+	s.mu.RLock()
+	out := []PlayerRecord{}
+	for key, rec := range s.players {
+		if key[0] == tenant {
+			out = append(out, rec)
+		}
+	}
+	s.mu.RUnlock()
+	sortLeaderboard(out)
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// sortLeaderboard orders records by rating, highest first, breaking ties
+// by identity so the order is stable.
+func sortLeaderboard(out []PlayerRecord) {
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Rating != out[j].Rating {
+			return out[i].Rating > out[j].Rating
+		}
+		return out[i].Identity < out[j].Identity
+	})
+}
+
+func (s *memoryStore) SaveSnapshot(st GameState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots[[2]string{storedTenant(st.Tenant), st.ID}] = st
+	return nil
+}
+
+func (s *memoryStore) DeleteSnapshot(tenant, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.snapshots, [2]string{tenant, id})
+	return nil
+}
+
+func (s *memoryStore) ListSnapshots() ([]GameState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]GameState, 0, len(s.snapshots))
+	for _, st := range s.snapshots {
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+func (s *memoryStore) SaveEngagement(row EngagementDay) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.engagement[[3]string{row.Day, row.Tenant, row.Instance}] = row
+	return nil
+}
+
+func (s *memoryStore) ListEngagement(since string) ([]EngagementDay, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []EngagementDay{}
+	for _, row := range s.engagement {
+		if row.Day >= since {
+			out = append(out, row)
+		}
+	}
+	return out, nil
+}
+
+func (s *memoryStore) SaveSession(sess Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sess.Token] = sess
+	return nil
+}
+
+func (s *memoryStore) LoadSession(token string) (Session, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sess, ok := s.sessions[token]
+	return sess, ok, nil
+}
+
+func (s *memoryStore) DeleteSession(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, token)
+	return nil
+}
+
+func (s *memoryStore) SaveRoundResult(res RoundResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, res)
+	st := s.roundStats[res.Tenant]
+	st.add(res)
+	s.roundStats[res.Tenant] = st
+	return nil
+}
+
+func (s *memoryStore) ListRoundResults(tenant, gameID string) ([]RoundResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []RoundResult{}
+	for _, res := range s.results {
+		if res.Tenant == tenant && res.GameID == gameID {
+			out = append(out, res)
+		}
+	}
+	return out, nil
+}
+
+func (s *memoryStore) ListRecentResults(tenant string, limit int) ([]RoundResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := []RoundResult{}
+	for i := len(s.results) - 1; i >= 0 && len(out) < limit; i-- {
+		if s.results[i].Tenant == tenant {
+			out = append(out, s.results[i])
+		}
+	}
+	return out, nil
+}
+
+func (s *memoryStore) LoadRoundStats(tenant string) (RoundStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.roundStats[tenant], nil
+}
+
+func (s *memoryStore) AddHeadToHead(delta HeadToHead) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]string{delta.Tenant, headToHeadKey(delta.A, delta.B)}
+	h, ok := s.headToHead[key]
+	if !ok {
+		h = HeadToHead{Tenant: delta.Tenant, A: delta.A, B: delta.B}
+	}
+	h.add(delta)
+	s.headToHead[key] = h
+	return nil
+}
+
+func (s *memoryStore) LoadHeadToHead(tenant, a, b string) (HeadToHead, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, ok := s.headToHead[[2]string{tenant, headToHeadKey(a, b)}]
+	return h, ok, nil
+}
@@ -0,0 +1,458 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"tictactoe/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --- Redis Store ---
+
+// Keys, one hash per record type (field = ID) plus lists for the audit log
+// and round results, all under the xo: prefix. Sessions are plain keys
+// under redisSessions so they can expire on their own. The player keys are
+// per tenant; see redisTenantKey.
+const (
+	redisReports    = "xo:reports"
+	redisBans       = "xo:bans"
+	redisRecords    = "xo:game_records" // Field tenant|game ID; a bare game ID from before tenants is the default tenant's
+	redisAudit      = "xo:audit"
+	redisRatings    = "xo:ratings" // Bare ratings from before player records; read as a fallback
+	redisPlayers    = "xo:players"
+	redisBoard      = "xo:leaderboard"  // Sorted set of identities by rating
+	redisNames      = "xo:player_names" // Player name to identity
+	redisSnapshots  = "xo:snapshots"    // Fields as in redisRecords
+	redisEngagement = "xo:engagement"   // Field day|tenant|instance
+	redisSessions   = "xo:session:"     // Followed by the token
+	redisResults    = "xo:results:"     // Followed by tenant|game ID; oldest first
+	redisRecent     = "xo:recent:"      // Followed by the tenant; newest first, capped at redisRecentCap
+	redisRoundStats = "xo:round_stats:" // Followed by the tenant; a hash of RoundStats counters
+	redisHeadToHead = "xo:h2h:"         // Followed by tenant|headToHeadKey; a hash of the names and counters
+)
+
+// redisRecentCap bounds each tenant's list of recent results.
+const redisRecentCap = 1000
+
+const redisTimeout = 5 * time.Second
+
+type redisStore struct {
+	rdb *redis.Client
+}
+
+// openRedisStore connects to the server at url, e.g. redis://host:6379/0,
+// and checks that it answers.
+func openRedisStore(url string) (*redisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	s := &redisStore{rdb: redis.NewClient(opts)}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := s.rdb.Ping(ctx).Err(); err != nil {
+		s.rdb.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *redisStore) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return s.rdb.Ping(ctx).Err()
+}
+
+func (s *redisStore) put(key, field string, doc interface{}) error {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return s.rdb.HSet(ctx, key, field, b).Err()
+}
+
+func (s *redisStore) del(key, field string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return s.rdb.HDel(ctx, key, field).Err()
+}
+
+// decodeAll unmarshals every value into a fresh T each.
+func decodeAll[T any](values []string) ([]T, error) {
+	out := make([]T, 0, len(values))
+	for _, doc := range values {
+		var v T
+		if err := json.Unmarshal([]byte(doc), &v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// all decodes every field of the hash at key.
+func all[T any](s *redisStore, key string) ([]T, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	values, err := s.rdb.HVals(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeAll[T](values)
+}
+
+func (s *redisStore) SaveReport(report Report) error {
+	return s.put(redisReports, report.ID, report)
+}
+
+func (s *redisStore) ListReports(status string) ([]Report, error) {
+	reports, err := all[Report](s, redisReports)
+	if err != nil {
+		return nil, err
+	}
+	out := reports[:0]
+	for _, r := range reports {
+		if status == "" || r.Status == status {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (s *redisStore) SaveBan(ban Ban) error {
+	return s.put(redisBans, ban.ID, ban)
+}
+
+func (s *redisStore) DeleteBan(id string) error {
+	return s.del(redisBans, id)
+}
+
+func (s *redisStore) ListBans() ([]Ban, error) {
+	return all[Ban](s, redisBans)
+}
+
+// redisGameField is the field a game's record or snapshot is kept under.
+func redisGameField(tenant, id string) string {
+	return storedTenant(tenant) + "|" + id
+}
+
+func (s *redisStore) SaveGameRecord(rec GameRecord) error {
+	return s.put(redisRecords, redisGameField(rec.Tenant, rec.ID), rec)
+}
+
+func (s *redisStore) LoadGameRecord(tenant, id string) (GameRecord, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	doc, err := s.rdb.HGet(ctx, redisRecords, redisGameField(tenant, id)).Result()
+	if err == redis.Nil && tenant == config.DefaultTenant {
+		doc, err = s.rdb.HGet(ctx, redisRecords, id).Result()
+	}
+	if err == redis.Nil {
+		return GameRecord{}, false, nil
+	}
+	if err != nil {
+		return GameRecord{}, false, err
+	}
+	var rec GameRecord
+	if err := json.Unmarshal([]byte(doc), &rec); err != nil {
+		return GameRecord{}, false, err
+	}
+	return rec, true, nil
+}
+
+func (s *redisStore) AppendAudit(entry AuditEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return s.rdb.RPush(ctx, redisAudit, b).Err()
+}
+
+func (s *redisStore) ListAudit() ([]AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	values, err := s.rdb.LRange(ctx, redisAudit, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeAll[AuditEntry](values)
+}
+
+// redisTenantKey is key for tenant's players. The default tenant keeps the
+// key from before tenants, so the players rated then stay its own.
+func redisTenantKey(key, tenant string) string {
+	if tenant == config.DefaultTenant {
+		return key
+	}
+	return key + ":" + tenant
+}
+
+func (s *redisStore) LoadPlayer(tenant, identity string) (PlayerRecord, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	var rec PlayerRecord
+	v, err := s.rdb.HGet(ctx, redisTenantKey(redisPlayers, tenant), identity).Result()
+	if err == nil {
+		err = json.Unmarshal([]byte(v), &rec)
+		return rec, err == nil, err
+	}
+	if err != redis.Nil || tenant != config.DefaultTenant {
+		return rec, false, err
+	}
+	v, err = s.rdb.HGet(ctx, redisRatings, identity).Result()
+	if err == redis.Nil {
+		return rec, false, nil
+	}
+	if err != nil {
+		return rec, false, err
+	}
+	rec.Identity = identity
+	rec.Rating, err = strconv.Atoi(v)
+	return rec, err == nil, err
+}
+
+func (s *redisStore) FindPlayer(tenant, name string) (PlayerRecord, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	identity, err := s.rdb.HGet(ctx, redisTenantKey(redisNames, tenant), name).Result()
+	if err == redis.Nil {
+		return PlayerRecord{}, false, nil
+	}
+	if err != nil {
+		return PlayerRecord{}, false, err
+	}
+	return s.LoadPlayer(tenant, identity)
+}
+
+func (s *redisStore) SavePlayers(tenant string, records ...PlayerRecord) error {
+	players, board, names := redisTenantKey(redisPlayers, tenant), redisTenantKey(redisBoard, tenant), redisTenantKey(redisNames, tenant)
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, rec := range records {
+			b, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			pipe.HSet(ctx, players, rec.Identity, b)
+			pipe.ZAdd(ctx, board, redis.Z{Score: float64(rec.Rating), Member: rec.Identity})
+			if rec.Name != "" {
+				pipe.HSet(ctx, names, rec.Name, rec.Identity)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *redisStore) ListTopPlayers(tenant string, limit int) ([]PlayerRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	ids, err := s.rdb.ZRevRange(ctx, redisTenantKey(redisBoard, tenant), 0, int64(limit)-1).Result()
+	if err != nil || len(ids) == 0 {
+		return []PlayerRecord{}, err
+	}
+	values, err := s.rdb.HMGet(ctx, redisTenantKey(redisPlayers, tenant), ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	var docs []string
+	for _, v := range values {
+		if doc, ok := v.(string); ok {
+			docs = append(docs, doc)
+		}
+	}
+	out, err := decodeAll[PlayerRecord](docs)
+	if err != nil {
+		return nil, err
+	}
+	sortLeaderboard(out) // Ties come back from the sorted set in reverse identity order
+	return out, nil
+}
+
+func (s *redisStore) SaveSnapshot(st GameState) error {
+	return s.put(redisSnapshots, redisGameField(st.Tenant, st.ID), st)
+}
+
+func (s *redisStore) DeleteSnapshot(tenant, id string) error {
+	if tenant == config.DefaultTenant {
+		if err := s.del(redisSnapshots, id); err != nil {
+			return err
+		}
+	}
+	return s.del(redisSnapshots, redisGameField(tenant, id))
+}
+
+func (s *redisStore) ListSnapshots() ([]GameState, error) {
+	return all[GameState](s, redisSnapshots)
+}
+
+func (s *redisStore) SaveEngagement(row EngagementDay) error {
+	return s.put(redisEngagement, row.Day+"|"+row.Tenant+"|"+row.Instance, row)
+}
+
+func (s *redisStore) ListEngagement(since string) ([]EngagementDay, error) {
+	rows, err := all[EngagementDay](s, redisEngagement)
+	if err != nil {
+		return nil, err
+	}
+	out := rows[:0]
+	for _, row := range rows {
+		if row.Day >= since {
+			out = append(out, row)
+		}
+	}
+	return out, nil
+}
+
+func (s *redisStore) SaveSession(sess Session) error {
+	ttl := time.Until(sess.ExpiresAt)
+	if ttl <= 0 {
+		return s.DeleteSession(sess.Token)
+	}
+	b, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return s.rdb.Set(ctx, redisSessions+sess.Token, b, ttl).Err()
+}
+
+func (s *redisStore) LoadSession(token string) (Session, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	doc, err := s.rdb.Get(ctx, redisSessions+token).Result()
+	if err == redis.Nil {
+		return Session{}, false, nil
+	}
+	if err != nil {
+		return Session{}, false, err
+	}
+	var sess Session
+	if err := json.Unmarshal([]byte(doc), &sess); err != nil {
+		return Session{}, false, err
+	}
+	return sess, true, nil
+}
+
+func (s *redisStore) DeleteSession(token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return s.rdb.Del(ctx, redisSessions+token).Err()
+}
+
+func (s *redisStore) SaveRoundResult(res RoundResult) error {
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	_, err = s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, redisResults+res.Tenant+"|"+res.GameID, b)
+		pipe.LPush(ctx, redisRecent+res.Tenant, b)
+		pipe.LTrim(ctx, redisRecent+res.Tenant, 0, redisRecentCap-1)
+		var delta RoundStats
+		delta.add(res)
+		for field, n := range delta.fields() {
+			if n != 0 {
+				pipe.HIncrBy(ctx, redisRoundStats+res.Tenant, field, n)
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *redisStore) ListRoundResults(tenant, gameID string) ([]RoundResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	values, err := s.rdb.LRange(ctx, redisResults+tenant+"|"+gameID, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeAll[RoundResult](values)
+}
+
+func (s *redisStore) ListRecentResults(tenant string, limit int) ([]RoundResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	values, err := s.rdb.LRange(ctx, redisRecent+tenant, 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeAll[RoundResult](values)
+}
+
+func (s *redisStore) LoadRoundStats(tenant string) (RoundStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	var st RoundStats
+	counters, err := s.rdb.HGetAll(ctx, redisRoundStats+tenant).Result()
+	if err != nil {
+		return st, err
+	}
+	for field, v := range counters {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return st, err
+		}
+		st.setField(field, n)
+	}
+	return st, nil
+}
+
+// AddHeadToHead increments the pair's counters, so concurrent rounds each
+// count. last_played is only ever moved forward.
+func (s *redisStore) AddHeadToHead(delta HeadToHead) error {
+	key := redisHeadToHead + delta.Tenant + "|" + headToHeadKey(delta.A, delta.B)
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "a", delta.A, "b", delta.B)
+		pipe.HIncrBy(ctx, key, "a_wins", int64(delta.AWins))
+		pipe.HIncrBy(ctx, key, "b_wins", int64(delta.BWins))
+		pipe.HIncrBy(ctx, key, "draws", int64(delta.Draws))
+		pipe.Eval(ctx, redisMaxField, []string{key}, "last_played", delta.LastPlayed.UnixMilli())
+		return nil
+	})
+	return err
+}
+
+// redisMaxField sets hash field ARGV[1] of KEYS[1] to ARGV[2] unless it
+// already holds more.
+const redisMaxField = `local v = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+if tonumber(ARGV[2]) > v then redis.call('HSET', KEYS[1], ARGV[1], ARGV[2]) end
+return 0`
+
+func (s *redisStore) LoadHeadToHead(tenant, a, b string) (HeadToHead, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	fields, err := s.rdb.HGetAll(ctx, redisHeadToHead+tenant+"|"+headToHeadKey(a, b)).Result()
+	if err != nil || len(fields) == 0 {
+		return HeadToHead{}, false, err
+	}
+	h := HeadToHead{Tenant: tenant, A: fields["a"], B: fields["b"]}
+	for name, n := range map[string]*int{"a_wins": &h.AWins, "b_wins": &h.BWins, "draws": &h.Draws} {
+		if *n, err = strconv.Atoi(fields[name]); err != nil {
+			return HeadToHead{}, false, err
+		}
+	}
+	ms, err := strconv.ParseInt(fields["last_played"], 10, 64)
+	if err != nil {
+		return HeadToHead{}, false, err
+	}
+	h.LastPlayed = time.UnixMilli(ms).UTC()
+	return h, true, nil
+}
@@ -0,0 +1,370 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// --- SQLite Store ---
+
+// sqliteMigrations are applied in order; the index of the last one applied
+// is kept in PRAGMA user_version. Append only.
+var sqliteMigrations = []string{
+	`CREATE TABLE reports (id TEXT PRIMARY KEY, status TEXT NOT NULL, doc TEXT NOT NULL);
+	 CREATE TABLE bans (id TEXT PRIMARY KEY, doc TEXT NOT NULL);
+	 CREATE TABLE game_records (id TEXT PRIMARY KEY, doc TEXT NOT NULL);
+	 CREATE TABLE audit (seq INTEGER PRIMARY KEY AUTOINCREMENT, doc TEXT NOT NULL);
+	 CREATE TABLE ratings (identity TEXT PRIMARY KEY, rating INTEGER NOT NULL);
+	 CREATE TABLE snapshots (id TEXT PRIMARY KEY, doc TEXT NOT NULL);`,
+	`CREATE TABLE engagement (day TEXT NOT NULL, tenant TEXT NOT NULL, instance TEXT NOT NULL, doc TEXT NOT NULL,
+	 PRIMARY KEY (day, tenant, instance));`,
+	`CREATE TABLE sessions (token TEXT PRIMARY KEY, expires_at INTEGER NOT NULL, doc TEXT NOT NULL);`,
+	`CREATE TABLE round_results (seq INTEGER PRIMARY KEY AUTOINCREMENT, tenant TEXT NOT NULL, game_id TEXT NOT NULL, doc TEXT NOT NULL);
+	 CREATE INDEX round_results_game ON round_results (tenant, game_id);`,
+	`CREATE TABLE players (identity TEXT PRIMARY KEY, rating INTEGER NOT NULL, doc TEXT NOT NULL);
+	 CREATE INDEX players_rating ON players (rating);
+	 CREATE TABLE player_names (name TEXT PRIMARY KEY, identity TEXT NOT NULL);
+	 INSERT INTO players SELECT identity, rating, json_object('identity', identity, 'rating', rating, 'games', 0, 'wins', 0, 'losses', 0, 'draws', 0) FROM ratings;
+	 DROP TABLE ratings;`,
+	`CREATE TABLE round_stats (tenant TEXT PRIMARY KEY, doc TEXT NOT NULL);`,
+	`CREATE TABLE head_to_head (tenant TEXT NOT NULL, pair TEXT NOT NULL, doc TEXT NOT NULL, PRIMARY KEY (tenant, pair));`,
+	// Game IDs are unique only within a tenant. Rows from before tenants
+	// are the default tenant's.
+	`CREATE TABLE tenant_game_records (tenant TEXT NOT NULL, id TEXT NOT NULL, doc TEXT NOT NULL, PRIMARY KEY (tenant, id));
+	 INSERT INTO tenant_game_records SELECT COALESCE(NULLIF(json_extract(doc, '$.tenant'), ''), 'default'), id, doc FROM game_records;
+	 DROP TABLE game_records;
+	 ALTER TABLE tenant_game_records RENAME TO game_records;
+	 CREATE TABLE tenant_snapshots (tenant TEXT NOT NULL, id TEXT NOT NULL, doc TEXT NOT NULL, PRIMARY KEY (tenant, id));
+	 INSERT INTO tenant_snapshots SELECT COALESCE(NULLIF(json_extract(doc, '$.tenant'), ''), 'default'), id, doc FROM snapshots;
+	 DROP TABLE snapshots;
+	 ALTER TABLE tenant_snapshots RENAME TO snapshots;`,
+	// Players are rated per tenant, and those from before are the default
+	// tenant's.
+	`CREATE TABLE tenant_players (tenant TEXT NOT NULL, identity TEXT NOT NULL, rating INTEGER NOT NULL, doc TEXT NOT NULL, PRIMARY KEY (tenant, identity));
+	 INSERT INTO tenant_players SELECT 'default', identity, rating, doc FROM players;
+	 DROP TABLE players;
+	 ALTER TABLE tenant_players RENAME TO players;
+	 CREATE INDEX players_rating ON players (tenant, rating);
+	 CREATE TABLE tenant_player_names (tenant TEXT NOT NULL, name TEXT NOT NULL, identity TEXT NOT NULL, PRIMARY KEY (tenant, name));
+	 INSERT INTO tenant_player_names SELECT 'default', name, identity FROM player_names;
+	 DROP TABLE player_names;
+	 ALTER TABLE tenant_player_names RENAME TO player_names;`,
+}
+
+// sqliteStore keeps each record as a JSON document, with only the columns
+// queries filter on broken out.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// openSQLiteStore opens the database file at path and brings its schema up
+// to date.
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// One connection serializes writers instead of failing with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	s := &sqliteStore{db: db}
+	if err := s.Migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *sqliteStore) Ping() error {
+	return s.db.Ping()
+}
+
+func (s *sqliteStore) Migrate() error {
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sqlite migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) put(query string, doc interface{}, args ...interface{}) error {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(query, append(args, string(b))...)
+	return err
+}
+
+// docs decodes the single doc column of every row query returns into a
+// fresh T each.
+func docs[T any](db *sql.DB, query string, args ...interface{}) ([]T, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []T{}
+	for rows.Next() {
+		var doc string
+		if err := rows.Scan(&doc); err != nil {
+			return nil, err
+		}
+		var v T
+		if err := json.Unmarshal([]byte(doc), &v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteStore) SaveReport(report Report) error {
+	return s.put(`INSERT OR REPLACE INTO reports (id, status, doc) VALUES (?, ?, ?)`, report, report.ID, report.Status)
+}
+
+func (s *sqliteStore) ListReports(status string) ([]Report, error) {
+	out, err := docs[Report](s.db, `SELECT doc FROM reports WHERE ? = '' OR status = ?`, status, status)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (s *sqliteStore) SaveBan(ban Ban) error {
+	return s.put(`INSERT OR REPLACE INTO bans (id, doc) VALUES (?, ?)`, ban, ban.ID)
+}
+
+func (s *sqliteStore) DeleteBan(id string) error {
+	_, err := s.db.Exec(`DELETE FROM bans WHERE id = ?`, id)
+	return err
+}
+
+func (s *sqliteStore) ListBans() ([]Ban, error) {
+	return docs[Ban](s.db, `SELECT doc FROM bans`)
+}
+
+func (s *sqliteStore) SaveGameRecord(rec GameRecord) error {
+	return s.put(`INSERT OR REPLACE INTO game_records (tenant, id, doc) VALUES (?, ?, ?)`, rec, storedTenant(rec.Tenant), rec.ID)
+}
+
+func (s *sqliteStore) LoadGameRecord(tenant, id string) (GameRecord, bool, error) {
+	recs, err := docs[GameRecord](s.db, `SELECT doc FROM game_records WHERE tenant = ? AND id = ?`, tenant, id)
+	if err != nil || len(recs) == 0 {
+		return GameRecord{}, false, err
+	}
+	return recs[0], true, nil
+}
+
+func (s *sqliteStore) AppendAudit(entry AuditEntry) error {
+	return s.put(`INSERT INTO audit (doc) VALUES (?)`, entry)
+}
+
+func (s *sqliteStore) ListAudit() ([]AuditEntry, error) {
+	return docs[AuditEntry](s.db, `SELECT doc FROM audit ORDER BY seq`)
+}
+
+func (s *sqliteStore) LoadPlayer(tenant, identity string) (PlayerRecord, bool, error) {
+	out, err := docs[PlayerRecord](s.db, `SELECT doc FROM players WHERE tenant = ? AND identity = ?`, tenant, identity)
+	if err != nil || len(out) == 0 {
+		return PlayerRecord{}, false, err
+	}
+	return out[0], true, nil
+}
+
+func (s *sqliteStore) FindPlayer(tenant, name string) (PlayerRecord, bool, error) {
+	out, err := docs[PlayerRecord](s.db, `SELECT doc FROM players WHERE tenant = ? AND identity = (SELECT identity FROM player_names WHERE tenant = ? AND name = ?)`, tenant, tenant, name)
+	if err != nil || len(out) == 0 {
+		return PlayerRecord{}, false, err
+	}
+	return out[0], true, nil
+}
+
+func (s *sqliteStore) SavePlayers(tenant string, records ...PlayerRecord) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		b, err := json.Marshal(rec)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO players (tenant, identity, rating, doc) VALUES (?, ?, ?, ?)`, tenant, rec.Identity, rec.Rating, string(b)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if rec.Name == "" {
+			continue
+		}
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO player_names (tenant, name, identity) VALUES (?, ?, ?)`, tenant, rec.Name, rec.Identity); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) ListTopPlayers(tenant string, limit int) ([]PlayerRecord, error) {
+	return docs[PlayerRecord](s.db, `SELECT doc FROM players WHERE tenant = ? ORDER BY rating DESC, identity LIMIT ?`, tenant, limit)
+}
+
+func (s *sqliteStore) SaveSnapshot(st GameState) error {
+	return s.put(`INSERT OR REPLACE INTO snapshots (tenant, id, doc) VALUES (?, ?, ?)`, st, storedTenant(st.Tenant), st.ID)
+}
+
+func (s *sqliteStore) DeleteSnapshot(tenant, id string) error {
+	_, err := s.db.Exec(`DELETE FROM snapshots WHERE tenant = ? AND id = ?`, tenant, id)
+	return err
+}
+
+func (s *sqliteStore) ListSnapshots() ([]GameState, error) {
+	return docs[GameState](s.db, `SELECT doc FROM snapshots`)
+}
+
+func (s *sqliteStore) SaveEngagement(row EngagementDay) error {
+	return s.put(`INSERT OR REPLACE INTO engagement (day, tenant, instance, doc) VALUES (?, ?, ?, ?)`, row, row.Day, row.Tenant, row.Instance)
+}
+
+func (s *sqliteStore) ListEngagement(since string) ([]EngagementDay, error) {
+	return docs[EngagementDay](s.db, `SELECT doc FROM engagement WHERE day >= ?`, since)
+}
+
+// SaveSession also prunes sessions that have expired, which nothing else
+// would look up again.
+func (s *sqliteStore) SaveSession(sess Session) error {
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE expires_at < ?`, time.Now().Unix()); err != nil {
+		return err
+	}
+	return s.put(`INSERT OR REPLACE INTO sessions (token, expires_at, doc) VALUES (?, ?, ?)`, sess, sess.Token, sess.ExpiresAt.Unix())
+}
+
+func (s *sqliteStore) LoadSession(token string) (Session, bool, error) {
+	sessions, err := docs[Session](s.db, `SELECT doc FROM sessions WHERE token = ?`, token)
+	if err != nil || len(sessions) == 0 {
+		return Session{}, false, err
+	}
+	return sessions[0], true, nil
+}
+
+func (s *sqliteStore) DeleteSession(token string) error {
+	_, err := s.db.Exec(`DELETE FROM sessions WHERE token = ?`, token)
+	return err
+}
+
+func (s *sqliteStore) SaveRoundResult(res RoundResult) error {
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO round_results (tenant, game_id, doc) VALUES (?, ?, ?)`, res.Tenant, res.GameID, string(b)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	var st RoundStats
+	var doc string
+	err = tx.QueryRow(`SELECT doc FROM round_stats WHERE tenant = ?`, res.Tenant).Scan(&doc)
+	if err == nil {
+		err = json.Unmarshal([]byte(doc), &st)
+	} else if err == sql.ErrNoRows {
+		err = nil
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	st.add(res)
+	if b, err = json.Marshal(st); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO round_stats (tenant, doc) VALUES (?, ?)`, res.Tenant, string(b)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) ListRoundResults(tenant, gameID string) ([]RoundResult, error) {
+	return docs[RoundResult](s.db, `SELECT doc FROM round_results WHERE tenant = ? AND game_id = ? ORDER BY seq`, tenant, gameID)
+}
+
+func (s *sqliteStore) ListRecentResults(tenant string, limit int) ([]RoundResult, error) {
+	return docs[RoundResult](s.db, `SELECT doc FROM round_results WHERE tenant = ? ORDER BY seq DESC LIMIT ?`, tenant, limit)
+}
+
+func (s *sqliteStore) LoadRoundStats(tenant string) (RoundStats, error) {
+	stats, err := docs[RoundStats](s.db, `SELECT doc FROM round_stats WHERE tenant = ?`, tenant)
+	if err != nil || len(stats) == 0 {
+		return RoundStats{}, err
+	}
+	return stats[0], nil
+}
+
+// AddHeadToHead reads and writes the record in one transaction; with the
+// store's single connection, nothing can come between the two.
+func (s *sqliteStore) AddHeadToHead(delta HeadToHead) error {
+	pair := headToHeadKey(delta.A, delta.B)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	h := HeadToHead{Tenant: delta.Tenant, A: delta.A, B: delta.B}
+	var doc string
+	err = tx.QueryRow(`SELECT doc FROM head_to_head WHERE tenant = ? AND pair = ?`, delta.Tenant, pair).Scan(&doc)
+	if err == nil {
+		err = json.Unmarshal([]byte(doc), &h)
+	} else if err == sql.ErrNoRows {
+		err = nil
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	h.add(delta)
+	b, err := json.Marshal(h)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO head_to_head (tenant, pair, doc) VALUES (?, ?, ?)`, delta.Tenant, pair, string(b)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) LoadHeadToHead(tenant, a, b string) (HeadToHead, bool, error) {
+	records, err := docs[HeadToHead](s.db, `SELECT doc FROM head_to_head WHERE tenant = ? AND pair = ?`, tenant, headToHeadKey(a, b))
+	if err != nil || len(records) == 0 {
+		return HeadToHead{}, false, err
+	}
+	return records[0], true, nil
+}
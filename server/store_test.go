@@ -0,0 +1,429 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"tictactoe/config"
+	"tictactoe/engine"
+)
+
+// Every Store must behave the same, so the same checks run against each:
+// memory always, SQLite on a temporary file, and Redis when
+// XO_TEST_REDIS_URL names a database the test may empty, e.g.
+// redis://localhost:6379/15.
+func TestStoreConformance(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testStore(t, newMemoryStore())
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		s, err := openSQLiteStore(filepath.Join(t.TempDir(), "xo.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.db.Close() })
+		testStore(t, s)
+	})
+	t.Run("redis", func(t *testing.T) {
+		url := os.Getenv("XO_TEST_REDIS_URL")
+		if url == "" {
+			t.Skip("XO_TEST_REDIS_URL not set")
+		}
+		s, err := openRedisStore(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.rdb.Close() })
+		if err := s.rdb.FlushDB(context.Background()).Err(); err != nil {
+			t.Fatal(err)
+		}
+		testStore(t, s)
+	})
+}
+
+// testStore runs the conformance checks against s, which starts empty.
+func testStore(t *testing.T, s Store) {
+	for _, tt := range []struct {
+		name string
+		test func(*testing.T, Store)
+	}{
+		{"reports", testStoreReports},
+		{"bans", testStoreBans},
+		{"game records", testStoreGameRecords},
+		{"audit", testStoreAudit},
+		{"players", testStorePlayers},
+		{"snapshots", testStoreSnapshots},
+		{"engagement", testStoreEngagement},
+		{"sessions", testStoreSessions},
+		{"round results", testStoreRoundResults},
+		{"head to head", testStoreHeadToHead},
+	} {
+		t.Run(tt.name, func(t *testing.T) { tt.test(t, s) })
+	}
+	if p, ok := s.(Pinger); ok {
+		if err := p.Ping(); err != nil {
+			t.Errorf("Ping: %v", err)
+		}
+	}
+}
+
+// at is a time that survives every store's encoding unchanged.
+func at(minute int) time.Time {
+	return time.Date(2026, 3, 1, 12, minute, 0, 0, time.UTC)
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testStoreReports(t *testing.T, s Store) {
+	must(t, s.SaveReport(Report{ID: "r2", GameID: "g", Reason: "spam", Status: "open", CreatedAt: at(2)}))
+	must(t, s.SaveReport(Report{ID: "r1", GameID: "g", Reason: "abuse", Status: "open", CreatedAt: at(1)}))
+	must(t, s.SaveReport(Report{ID: "r3", GameID: "g", Reason: "other", Status: "resolved", CreatedAt: at(3)}))
+	must(t, s.SaveReport(Report{ID: "r2", GameID: "g", Reason: "spam", Status: "resolved", CreatedAt: at(2)})) // Replaces
+
+	ids := func(status string) []string {
+		reports, err := s.ListReports(status)
+		must(t, err)
+		out := []string{}
+		for _, r := range reports {
+			out = append(out, r.ID)
+		}
+		return out
+	}
+	if got, want := ids(""), []string{"r1", "r2", "r3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListReports(\"\") = %v, want %v, oldest first", got, want)
+	}
+	if got, want := ids("open"), []string{"r1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListReports(open) = %v, want %v", got, want)
+	}
+	if got, want := ids("resolved"), []string{"r2", "r3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListReports(resolved) = %v, want %v", got, want)
+	}
+}
+
+func testStoreBans(t *testing.T, s Store) {
+	exp := at(30)
+	keep := Ban{ID: "b1", IP: "10.0.0.1", Reason: "flood", CreatedAt: at(0)}
+	drop := Ban{ID: "b2", Identity: "bob", CreatedAt: at(1), ExpiresAt: &exp}
+	must(t, s.SaveBan(keep))
+	must(t, s.SaveBan(drop))
+	must(t, s.DeleteBan(drop.ID))
+	must(t, s.DeleteBan("no-such-ban"))
+
+	got, err := s.ListBans()
+	must(t, err)
+	if !reflect.DeepEqual(got, []Ban{keep}) {
+		t.Errorf("ListBans = %+v, want only %+v", got, keep)
+	}
+}
+
+func testStoreGameRecords(t *testing.T, s Store) {
+	rec := GameRecord{ID: "g1", Score: Score{X: 2, O: 1}, FinishedAt: at(5), Tenant: "t", Size: 4, WinLength: 3}
+	must(t, s.SaveGameRecord(rec))
+	// The same ID in another tenant is another game
+	must(t, s.SaveGameRecord(GameRecord{ID: "g1", Score: Score{O: 3}, FinishedAt: at(6), Tenant: "u"}))
+	got, ok, err := s.LoadGameRecord("t", "g1")
+	must(t, err)
+	if !ok || got.ID != rec.ID || !reflect.DeepEqual(got.Score, rec.Score) || !got.FinishedAt.Equal(rec.FinishedAt) || got.Size != 4 || got.WinLength != 3 {
+		t.Errorf("LoadGameRecord = %+v, %v; want %+v", got, ok, rec)
+	}
+	if got, ok, err := s.LoadGameRecord("u", "g1"); err != nil || !ok || got.Score.O != 3 {
+		t.Errorf("LoadGameRecord(u, g1) = %+v, %v, %v; want u's own record", got, ok, err)
+	}
+	if _, ok, err := s.LoadGameRecord("t", "g2"); ok || err != nil {
+		t.Errorf("LoadGameRecord(unknown) = %v, %v; want not found", ok, err)
+	}
+	if _, ok, err := s.LoadGameRecord("v", "g1"); ok || err != nil {
+		t.Errorf("LoadGameRecord(other tenant) = %v, %v; want not found", ok, err)
+	}
+
+	// A record from before tenants is the default tenant's
+	must(t, s.SaveGameRecord(GameRecord{ID: "g3", FinishedAt: at(7)}))
+	if _, ok, err := s.LoadGameRecord(config.DefaultTenant, "g3"); !ok || err != nil {
+		t.Errorf("LoadGameRecord(default, untenanted) = %v, %v; want found", ok, err)
+	}
+	if _, ok, err := s.LoadGameRecord("t", "g3"); ok || err != nil {
+		t.Errorf("LoadGameRecord(t, untenanted) = %v, %v; want not found", ok, err)
+	}
+}
+
+func testStoreAudit(t *testing.T, s Store) {
+	entries := []AuditEntry{
+		{At: at(1), Admin: "a", Action: "close_game", GameID: "g"},
+		{At: at(0), Admin: "b", Action: "ban", Detail: "10.0.0.1"},
+	}
+	for _, e := range entries {
+		must(t, s.AppendAudit(e))
+	}
+	got, err := s.ListAudit()
+	must(t, err)
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("ListAudit = %+v, want %+v in the order appended", got, entries)
+	}
+}
+
+func testStorePlayers(t *testing.T, s Store) {
+	must(t, s.SavePlayers("t",
+		PlayerRecord{Identity: "id-a", Name: "ann", Rating: 1300, Games: 1, Wins: 1},
+		PlayerRecord{Identity: "id-b", Name: "ben", Rating: 1100, Games: 1, Losses: 1},
+	))
+	must(t, s.SavePlayers("t", PlayerRecord{Identity: "id-c", Rating: 1300, Games: 2, Draws: 2}))
+	// ann's name moves to a new identity
+	must(t, s.SavePlayers("t", PlayerRecord{Identity: "id-d", Name: "ann", Rating: 1200, Games: 1, Draws: 1}))
+	// Another tenant rates the same identity and name separately
+	must(t, s.SavePlayers("u", PlayerRecord{Identity: "id-a", Name: "ann", Rating: 1500, Games: 3, Wins: 3}))
+
+	got, ok, err := s.LoadPlayer("t", "id-a")
+	must(t, err)
+	if want := (PlayerRecord{Identity: "id-a", Name: "ann", Rating: 1300, Games: 1, Wins: 1}); !ok || got != want {
+		t.Errorf("LoadPlayer(t, id-a) = %+v, %v; want %+v", got, ok, want)
+	}
+	if got, ok, err := s.LoadPlayer("u", "id-a"); err != nil || !ok || got.Rating != 1500 {
+		t.Errorf("LoadPlayer(u, id-a) = %+v, %v, %v; want u's own record", got, ok, err)
+	}
+	if _, ok, err := s.LoadPlayer("t", "id-z"); ok || err != nil {
+		t.Errorf("LoadPlayer(unknown) = %v, %v; want not found", ok, err)
+	}
+	if _, ok, err := s.LoadPlayer("v", "id-a"); ok || err != nil {
+		t.Errorf("LoadPlayer(other tenant) = %v, %v; want not found", ok, err)
+	}
+	if got, ok, err := s.FindPlayer("t", "ann"); err != nil || !ok || got.Identity != "id-d" {
+		t.Errorf("FindPlayer(t, ann) = %+v, %v, %v; want the latest, id-d", got, ok, err)
+	}
+	if got, ok, err := s.FindPlayer("u", "ann"); err != nil || !ok || got.Identity != "id-a" || got.Rating != 1500 {
+		t.Errorf("FindPlayer(u, ann) = %+v, %v, %v; want u's id-a", got, ok, err)
+	}
+	if _, ok, err := s.FindPlayer("t", "nobody"); ok || err != nil {
+		t.Errorf("FindPlayer(unknown) = %v, %v; want not found", ok, err)
+	}
+	if _, ok, err := s.FindPlayer("v", "ann"); ok || err != nil {
+		t.Errorf("FindPlayer(other tenant) = %v, %v; want not found", ok, err)
+	}
+
+	top, err := s.ListTopPlayers("t", 3)
+	must(t, err)
+	var ids []string
+	for _, p := range top {
+		ids = append(ids, p.Identity)
+	}
+	if want := []string{"id-a", "id-c", "id-d"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ListTopPlayers(t, 3) = %v, want %v: highest rating first, ties by identity", ids, want)
+	}
+	if top, err := s.ListTopPlayers("u", 10); err != nil || len(top) != 1 || top[0].Rating != 1500 {
+		t.Errorf("ListTopPlayers(u, 10) = %+v, %v; want only u's player", top, err)
+	}
+	if top, err := s.ListTopPlayers("v", 10); err != nil || len(top) != 0 {
+		t.Errorf("ListTopPlayers(v, 10) = %+v, %v; want none", top, err)
+	}
+}
+
+func testStoreSnapshots(t *testing.T, s Store) {
+	must(t, s.SaveSnapshot(GameState{Version: 1, ID: "g1", Tenant: "t", CurrentPlayer: "X", Round: 1}))
+	must(t, s.SaveSnapshot(GameState{Version: 1, ID: "g2", Tenant: "t", CurrentPlayer: "O", Round: 3}))
+	must(t, s.SaveSnapshot(GameState{Version: 1, ID: "g1", Tenant: "t", CurrentPlayer: "O", Round: 2})) // Replaces
+	must(t, s.SaveSnapshot(GameState{Version: 1, ID: "g1", Tenant: "u", CurrentPlayer: "X", Round: 4}))
+	must(t, s.DeleteSnapshot("t", "g2"))
+	must(t, s.DeleteSnapshot("v", "g1")) // Another tenant's game of the same ID
+
+	got, err := s.ListSnapshots()
+	must(t, err)
+	sort.Slice(got, func(i, j int) bool { return got[i].Tenant < got[j].Tenant })
+	if len(got) != 2 || got[0].Tenant != "t" || got[0].ID != "g1" || got[0].Round != 2 || got[0].CurrentPlayer != "O" || got[1].Tenant != "u" || got[1].Round != 4 {
+		t.Errorf("ListSnapshots = %+v, want t's latest g1 and u's g1", got)
+	}
+}
+
+func testStoreEngagement(t *testing.T, s Store) {
+	rows := []EngagementDay{
+		{Day: "2026-03-01", Tenant: "t", Instance: "i1", Engagement: Engagement{Matches: 1}},
+		{Day: "2026-03-02", Tenant: "t", Instance: "i1", Engagement: Engagement{Matches: 2}},
+		{Day: "2026-03-02", Tenant: "t", Instance: "i2", Engagement: Engagement{Matches: 3}},
+	}
+	for _, row := range rows {
+		must(t, s.SaveEngagement(row))
+	}
+	rows[1].Matches = 5
+	must(t, s.SaveEngagement(rows[1])) // Replaces
+
+	got, err := s.ListEngagement("2026-03-02")
+	must(t, err)
+	games := map[string]int{}
+	for _, row := range got {
+		games[row.Instance] = row.Matches
+	}
+	if want := map[string]int{"i1": 5, "i2": 3}; len(got) != 2 || !reflect.DeepEqual(games, want) {
+		t.Errorf("ListEngagement = %+v, want matches by instance %v", got, want)
+	}
+}
+
+func testStoreSessions(t *testing.T, s Store) {
+	sess := Session{Token: "tok", Tenant: "t", GameID: "g", Symbol: "X", Identity: "id", ExpiresAt: time.Now().Add(time.Hour).UTC().Truncate(time.Second)}
+	must(t, s.SaveSession(sess))
+	got, ok, err := s.LoadSession("tok")
+	must(t, err)
+	if !ok || got.Token != sess.Token || got.GameID != sess.GameID || got.Symbol != sess.Symbol || got.Identity != sess.Identity || !got.ExpiresAt.Equal(sess.ExpiresAt) {
+		t.Errorf("LoadSession = %+v, %v; want %+v", got, ok, sess)
+	}
+	must(t, s.DeleteSession("tok"))
+	if _, ok, err := s.LoadSession("tok"); ok || err != nil {
+		t.Errorf("LoadSession after DeleteSession = %v, %v; want not found", ok, err)
+	}
+}
+
+func testStoreRoundResults(t *testing.T, s Store) {
+	board := engine.NewBoard(3)
+	results := []RoundResult{
+		{GameID: "g1", Tenant: "t", Round: 1, Winner: "X", Starter: "X", Board: board, Moves: 5, FirstMove: &[2]int{1, 1}, DurationMS: 1000, FinishedAt: at(1)},
+		{GameID: "g2", Tenant: "t", Round: 1, Winner: "", Starter: "X", Moves: 9, FinishedAt: at(2)},
+		{GameID: "g1", Tenant: "t", Round: 2, Winner: "X", Starter: "O", Board: board, Moves: 6, FirstMove: &[2]int{0, 0}, DurationMS: 500, FinishedAt: at(3)},
+		{GameID: "g1", Tenant: "other", Round: 1, Winner: "O", Starter: "X", Moves: 7, FinishedAt: at(4)},
+	}
+	for _, res := range results {
+		must(t, s.SaveRoundResult(res))
+	}
+	rounds := func(list []RoundResult) []int {
+		out := []int{}
+		for _, res := range list {
+			out = append(out, res.Round)
+		}
+		return out
+	}
+
+	series, err := s.ListRoundResults("t", "g1")
+	must(t, err)
+	if got, want := rounds(series), []int{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListRoundResults(t, g1) rounds = %v, want %v, oldest first", got, want)
+	}
+	if none, err := s.ListRoundResults("t", "g3"); err != nil || len(none) != 0 {
+		t.Errorf("ListRoundResults(unknown) = %v, %v; want none", none, err)
+	}
+
+	recent, err := s.ListRecentResults("t", 2)
+	must(t, err)
+	if len(recent) != 2 || recent[0].GameID != "g1" || recent[0].Round != 2 || recent[1].GameID != "g2" {
+		t.Errorf("ListRecentResults(t, 2) = %+v, want g1 round 2 then g2, newest first", recent)
+	}
+
+	st, err := s.LoadRoundStats("t")
+	must(t, err)
+	want := RoundStats{Rounds: 3, StarterWins: 1, SecondWins: 1, Draws: 1, Moves: 20, DurationMS: 1500, TimedRounds: 2}
+	want.FirstMoves[1][1] = 1
+	want.FirstMoves[0][0] = 1
+	if st != want {
+		t.Errorf("LoadRoundStats(t) = %+v, want %+v", st, want)
+	}
+	if st, err := s.LoadRoundStats("nobody"); err != nil || st != (RoundStats{}) {
+		t.Errorf("LoadRoundStats(unknown) = %+v, %v; want zero", st, err)
+	}
+}
+
+func testStoreHeadToHead(t *testing.T, s Store) {
+	must(t, s.AddHeadToHead(HeadToHead{Tenant: "t", A: "ann", B: "ben", AWins: 1, LastPlayed: at(2)}))
+	must(t, s.AddHeadToHead(HeadToHead{Tenant: "t", A: "ann", B: "ben", BWins: 2, Draws: 1, LastPlayed: at(1)}))
+	must(t, s.AddHeadToHead(HeadToHead{Tenant: "other", A: "ann", B: "ben", Draws: 4, LastPlayed: at(3)}))
+
+	want := HeadToHead{Tenant: "t", A: "ann", B: "ben", AWins: 1, BWins: 2, Draws: 1, LastPlayed: at(2)}
+	for _, names := range [][2]string{{"ann", "ben"}, {"ben", "ann"}} {
+		got, ok, err := s.LoadHeadToHead("t", names[0], names[1])
+		must(t, err)
+		if !ok || got.A != want.A || got.B != want.B || got.AWins != want.AWins || got.BWins != want.BWins || got.Draws != want.Draws || !got.LastPlayed.Equal(want.LastPlayed) {
+			t.Errorf("LoadHeadToHead(t, %s, %s) = %+v, %v; want %+v, keeping the latest last_played", names[0], names[1], got, ok, want)
+		}
+	}
+	if _, ok, err := s.LoadHeadToHead("t", "ann", "cat"); ok || err != nil {
+		t.Errorf("LoadHeadToHead(unknown pair) = %v, %v; want not found", ok, err)
+	}
+}
+
+// Game records and snapshots from before they were kept by tenant move to
+// the tenant their document names, or the default tenant.
+func TestSQLiteTenantGameMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xo.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const before = 7 // Up to and including the head-to-head table
+	for _, m := range sqliteMigrations[:before] {
+		if _, err := db.Exec(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, q := range []string{
+		fmt.Sprintf(`PRAGMA user_version = %d`, before),
+		`INSERT INTO game_records (id, doc) VALUES ('g1', '{"id":"g1","tenant":"acme"}'), ('g2', '{"id":"g2"}')`,
+		`INSERT INTO snapshots (id, doc) VALUES ('g3', '{"id":"g3","tenant":"acme","round":1}'), ('g4', '{"id":"g4","round":1}')`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	s, err := openSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.db.Close() })
+	for _, tt := range []struct{ tenant, id string }{{"acme", "g1"}, {config.DefaultTenant, "g2"}} {
+		if _, ok, err := s.LoadGameRecord(tt.tenant, tt.id); !ok || err != nil {
+			t.Errorf("LoadGameRecord(%s, %s) = %v, %v; want found", tt.tenant, tt.id, ok, err)
+		}
+	}
+	must(t, s.DeleteSnapshot("acme", "g3"))
+	must(t, s.DeleteSnapshot(config.DefaultTenant, "g4"))
+	if got, err := s.ListSnapshots(); err != nil || len(got) != 0 {
+		t.Errorf("ListSnapshots = %+v, %v; want both migrated snapshots deleted by tenant", got, err)
+	}
+}
+
+// Players rated before tenants are the default tenant's.
+func TestSQLiteTenantPlayerMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xo.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const before = 8 // Up to and including game records by tenant
+	for _, m := range sqliteMigrations[:before] {
+		if _, err := db.Exec(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, q := range []string{
+		fmt.Sprintf(`PRAGMA user_version = %d`, before),
+		`INSERT INTO players (identity, rating, doc) VALUES ('id-a', 1300, '{"identity":"id-a","name":"ann","rating":1300,"games":1,"wins":1}')`,
+		`INSERT INTO player_names (name, identity) VALUES ('ann', 'id-a')`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	s, err := openSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.db.Close() })
+	if got, ok, err := s.FindPlayer(config.DefaultTenant, "ann"); err != nil || !ok || got.Rating != 1300 {
+		t.Errorf("FindPlayer(default, ann) = %+v, %v, %v; want the migrated player", got, ok, err)
+	}
+	if top, err := s.ListTopPlayers(config.DefaultTenant, 10); err != nil || len(top) != 1 {
+		t.Errorf("ListTopPlayers(default) = %+v, %v; want the migrated player", top, err)
+	}
+	if _, ok, err := s.LoadPlayer("acme", "id-a"); ok || err != nil {
+		t.Errorf("LoadPlayer(acme, id-a) = %v, %v; want not found", ok, err)
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// --- Store Writes ---
+
+// A store on the far side of a network, Redis or a busy SQLite file, can
+// take as long as it likes, and a game's loop mustn't wait on it: every
+// move, timer and join in the game would queue up behind one slow write.
+// So whatever a command writes goes on the game's storeQueue instead,
+// taken as a closure over values copied on the loop, and one goroutine
+// per game runs the queue in order. A
+// write is never reordered behind a later one from the same game, so a
+// snapshot saved after a move can't be overwritten by the one before it,
+// and a session saved for a held seat is revoked only after it is
+// written. Reads a command needs are made before it is sent: onGame
+// reads an ID's series history before creating its game, join
+// reads the newcomer's rating and head-to-head record, and the opening
+// book is read once on the queue itself. Shutdown waits for every queue
+// to empty after suspending the games, before the store is closed.
+
+// storeQueue is one game's writes still to run, oldest first.
+type storeQueue struct {
+	mu      sync.Mutex
+	pending []func()
+	running bool // A goroutine is running the queue
+}
+
+// storeWrites counts the writes queued across every game, for flushStore.
+var storeWrites sync.WaitGroup
+
+// storeLater queues write to run after the game's earlier writes. It must
+// not touch the game except by sending it a command. Runs on the game's
+// loop, or while the game is being created.
+func (game *Game) storeLater(write func()) {
+	q := game.writes
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	storeWrites.Add(1)
+	q.pending = append(q.pending, write)
+	if !q.running {
+		q.running = true
+		go q.run()
+	}
+}
+
+// run runs the queued writes until none are left.
+func (q *storeQueue) run() {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		write := q.pending[0]
+		q.pending[0] = nil
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+
+		write()
+		storeWrites.Done()
+	}
+}
+
+// joinReads are what join reads from the store, before sending its
+// command, for the game it is joining.
+type joinReads struct {
+	record     *PlayerRecord   // The newcomer's standing, for a rated game
+	headToHead *headToHeadRead // The record of the pair the newcomer may complete
+}
+
+// readForJoin makes the reads join's connection may need in the existing
+// game under key, with a command that only looks at the game long enough
+// to see what they are. A game that doesn't exist yet needs none.
+func readForJoin(key gameKey, r *http.Request) joinReads {
+	gamesMutex.RLock()
+	game := games[key]
+	gamesMutex.RUnlock()
+	if game == nil {
+		return joinReads{}
+	}
+	identity, name := requestIdentity(r), displayName(r.URL.Query().Get("name"))
+	var rated bool
+	var a, b string
+	game.do(func() {
+		rated = game.Rated && identity != ""
+		a, b = game.headToHeadCandidate(name)
+	})
+
+	var reads joinReads
+	if rated {
+		rec := currentRecord(key.Tenant, identity)
+		reads.record = &rec
+	}
+	if a != "" {
+		reads.headToHead = readHeadToHead(key.Tenant, a, b)
+	}
+	return reads
+}
+
+// flushStore waits for every queued write to finish, reporting false if
+// ctx ran out first.
+func flushStore(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		storeWrites.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"tictactoe/config"
+	"tictactoe/engine"
+)
+
+// gatedStore is a fresh memory store whose round results wait for gate,
+// as a slow store's would.
+type gatedStore struct {
+	Store
+	gate chan struct{}
+	once sync.Once
+}
+
+// open lets the writes through.
+func (s *gatedStore) open() {
+	s.once.Do(func() { close(s.gate) })
+}
+
+func (s *gatedStore) SaveRoundResult(res RoundResult) error {
+	<-s.gate
+	return s.Store.SaveRoundResult(res)
+}
+
+func (s *gatedStore) ListRoundResults(tenant, gameID string) ([]RoundResult, error) {
+	<-s.gate
+	return s.Store.ListRoundResults(tenant, gameID)
+}
+
+// withGatedStore swaps in a gatedStore for the rest of the test, opening
+// its gate and waiting for the queued writes when the test ends.
+func withGatedStore(t *testing.T) *gatedStore {
+	t.Helper()
+	s := &gatedStore{Store: newMemoryStore(), gate: make(chan struct{})}
+	old := store
+	store = s
+	t.Cleanup(func() {
+		s.open()
+		flush(t)
+		store = old
+	})
+	return s
+}
+
+func flush(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if !flushStore(ctx) {
+		t.Fatal("store writes still queued")
+	}
+}
+
+func TestStoreWritesInOrder(t *testing.T) {
+	game := newGame(unusedGameID())
+	var mu sync.Mutex
+	var ran []int
+	game.do(func() {
+		for i := 0; i < 100; i++ {
+			i := i
+			game.storeLater(func() {
+				mu.Lock()
+				ran = append(ran, i)
+				mu.Unlock()
+			})
+		}
+	})
+	flush(t)
+	if len(ran) != 100 {
+		t.Fatalf("%d writes ran, want 100", len(ran))
+	}
+	for i, n := range ran {
+		if n != i {
+			t.Fatalf("write %d ran as number %d", n, i)
+		}
+	}
+}
+
+func TestSlowStoreDoesNotHoldLoop(t *testing.T) {
+	s := withGatedStore(t)
+	game := newGame(unusedGameID())
+	game.HideOpenings = true
+
+	done := make(chan struct{})
+	go func() {
+		game.do(func() {
+			game.Board = engine.NewBoard(3)
+			game.recordResult("X")
+		})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("recordResult waited on the store")
+	}
+	responsive(t, game) // While the store is blocked
+
+	s.open()
+	flush(t)
+	results, err := s.Store.ListRoundResults(game.Tenant, game.ID)
+	if err != nil || len(results) != 1 || results[0].Winner != "X" {
+		t.Errorf("stored %+v, %v; want the one round X won", results, err)
+	}
+}
+
+func TestOpeningsLoadedOffLoop(t *testing.T) {
+	s := withGatedStore(t)
+	id := unusedGameID()
+	first := [2]int{1, 1}
+	old := RoundResult{GameID: id, Tenant: config.DefaultTenant, Round: 1, Winner: "X", Board: engine.NewBoard(3), Starter: "X", FirstMove: &first}
+	if err := s.Store.SaveRoundResult(old); err != nil {
+		t.Fatal(err)
+	}
+
+	game := newGame(id)
+	gamesMutex.Lock()
+	registerGame(game) // Queues the read, which waits at the gate
+	gamesMutex.Unlock()
+	t.Cleanup(func() {
+		gamesMutex.Lock()
+		delete(games, game.key())
+		gamesMutex.Unlock()
+	})
+
+	// A round finished while the read waits comes after the stored one
+	corner := [2]int{0, 0}
+	game.do(func() {
+		game.noteOpening(RoundResult{Board: engine.NewBoard(3), Starter: "O", FirstMove: &corner})
+	})
+
+	s.open()
+	flush(t)
+	game.do(func() {
+		if len(game.openings) != 2 || game.openings[0].Cell != first || game.openings[1].Cell != corner {
+			t.Errorf("openings %+v, want the stored centre and then the corner", game.openings)
+		}
+	})
+}
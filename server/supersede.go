@@ -0,0 +1,68 @@
+package server
+
+import "tictactoe/protocol"
+
+// --- Duplicate Joins ---
+
+// A client joining a game it already holds a seat in, from a second tab
+// say, takes that seat over rather than getting the other one or a place
+// in the audience. It is known by the seat's token, or by its client ID
+// (?client_id= or X-Client-ID) from the same address as the seated
+// connection, since a client ID alone is only the client's word. The old
+// connection hears superseded and is closed with CloseSuperseded; the new
+// one gets the seat and a state_sync, and the game carries on where it
+// was, the others none the wiser.
+
+// seatedAs finds the seated player a join with token, or from identity at
+// ip, would be a second connection of, or nil. Runs on the game's
+// loop.
+func (game *Game) seatedAs(token, identity, ip string) *Player {
+	if token != "" {
+		if symbol, err := verifySeatToken(game, token); err == nil {
+			for _, p := range game.Players {
+				if p.Symbol == symbol {
+					return p
+				}
+			}
+			return nil // Its seat is free, so it isn't a second anything
+		}
+	}
+	if identity == "" {
+		return nil
+	}
+	for _, p := range game.Players {
+		if p.Identity == identity && p.IP == ip {
+			return p
+		}
+	}
+	return nil
+}
+
+// supersede unseats old for the connection taking its seat over, and
+// closes it once it has been told. Its leave then changes nothing. Runs
+// on the game's loop.
+func (game *Game) supersede(old *Player) {
+	for i, p := range game.Players {
+		if p == old {
+			game.Players = append(game.Players[:i], game.Players[i+1:]...)
+			break
+		}
+	}
+	old.superseded = true
+	old.logger().Info("connection superseded")
+	old.send(localize(old.locale(), protocol.Notice(protocol.EventSuperseded, "superseded")))
+	old.closeAfterFlush(protocol.CloseSuperseded, "superseded")
+}
+
+// inherit carries over what old, the connection p superseded, had going
+// in the turn. Runs on the game's loop.
+func (p *Player) inherit(old *Player) {
+	p.mayPlay = old.mayPlay
+	p.hintSeq = old.hintSeq
+	if old.record != nil {
+		p.record = old.record // Ahead of the store while the last rated round's save is queued
+	}
+	if p.ConfirmMoves {
+		p.pending, p.pendingMark = old.pending, old.pendingMark
+	}
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"net/url"
+	"time"
+
+	"tictactoe/protocol"
+)
+
+// --- Symbol Choice and Seat Swaps ---
+
+// A player joining with ?symbol=X or ?symbol=O takes that seat if it is
+// free, and otherwise whichever is. Once both are in, either may send
+// swap_request before the first move of a round or after its end. The
+// opponent answers with swap_accept or swap_decline, and an offer left
+// unanswered for swapTimeout lapses. On acceptance the two trade symbols
+// and everything that goes with the person rather than the letter: the
+// score, name, host, seat owner and any pending rematch or settings. Past
+// rounds keep their letters, and a move withdraws a pending offer. seats_swapped tells everyone, with the names
+// and score as they now stand, and each player gets a fresh
+// player_assignment, since the old seat tokens stop working. A declined or
+// lapsed offer changes nothing. Two-player games against a person only.
+
+const swapTimeout = 30 * time.Second
+
+// swapRequest is a pending offer to trade symbols.
+type swapRequest struct {
+	By *Player
+}
+
+// swapError is the error code saying why p can't swap now, or "" if it
+// can. Runs on the game's loop.
+func (game *Game) swapError(p *Player) string {
+	switch {
+	case game.ThreePlayer:
+		return "two_player_only"
+	case game.AI != "" || len(game.Players) != 2:
+		return "no_one_to_swap_with"
+	case len(game.Moves) > 0 && !game.roundOver():
+		return "round_in_progress"
+	}
+	for _, other := range game.Players {
+		if other == p {
+			return ""
+		}
+	}
+	return "no_one_to_swap_with" // No longer seated
+}
+
+// handleSwap runs swap_request, swap_accept and swap_decline. Runs on
+// the game's loop.
+func (game *Game) handleSwap(p *Player, event protocol.Event) {
+	pending := game.Swap
+	switch {
+	case event == protocol.EventSwapRequest:
+		if code := game.swapError(p); code != "" {
+			p.send(localize(p.locale(), protocol.Failure(code, "")))
+			return
+		}
+		game.Swap = &swapRequest{By: p}
+		game.armSwapTimeout()
+		broadcast(game, OutboundMessage{Event: protocol.EventSwapRequested, Player: p.Symbol, From: p.participant()})
+	case pending == nil || pending.By == p:
+		return // Nothing to answer
+	case event == protocol.EventSwapDecline:
+		game.endSwap(pending, "swap_declined")
+	default:
+		game.stopSwapTimeout()
+		game.Swap = nil
+		if code := game.swapError(pending.By); code != "" {
+			p.send(localize(p.locale(), protocol.Failure(code, ""))) // Overtaken by a move or a departure
+			return
+		}
+		game.swapSeats()
+	}
+}
+
+// endSwap withdraws pending, telling everyone why with code. Runs on
+// the game's loop.
+func (game *Game) endSwap(pending *swapRequest, code string) {
+	game.stopSwapTimeout()
+	game.Swap = nil
+	broadcast(game, OutboundMessage{Event: protocol.EventSwapDeclined, Player: pending.By.Symbol, Code: code})
+}
+
+func (game *Game) armSwapTimeout() {
+	game.stopSwapTimeout()
+	gen := game.swapGen
+	game.swapTimer = game.clock.AfterFunc(swapTimeout, func() {
+		game.do(func() {
+			if game.swapGen != gen || game.closed || game.Swap == nil {
+				return
+			}
+			game.journal.timer("swap_timeout")
+			game.endSwap(game.Swap, "swap_expired")
+		})
+	})
+}
+
+// stopSwapTimeout cancels the pending offer's timeout. Runs on the game's
+// loop.
+func (game *Game) stopSwapTimeout() {
+	if game.swapTimer != nil {
+		game.swapTimer.Stop()
+		game.swapTimer = nil
+	}
+	game.swapGen++
+}
+
+// swapSeats trades the two players' symbols and what goes with them.
+// Runs on the game's loop.
+func (game *Game) swapSeats() {
+	swap := func(s string) string {
+		switch s {
+		case "X":
+			return "O"
+		case "O":
+			return "X"
+		}
+		return s
+	}
+	for _, m := range []map[string]bool{game.RematchRequests, game.NewSeriesRequests, game.AFK} {
+		m["X"], m["O"] = m["O"], m["X"]
+		for _, s := range []string{"X", "O"} {
+			if !m[s] {
+				delete(m, s)
+			}
+		}
+	}
+	for _, m := range []map[string]string{game.SeatOwners, game.SeatNames} {
+		x, hasX := m["X"]
+		o, hasO := m["O"]
+		delete(m, "X")
+		delete(m, "O")
+		if hasO {
+			m["X"] = o
+		}
+		if hasX {
+			m["O"] = x
+		}
+	}
+	if left, ok := game.clockLeft["X"]; ok {
+		game.clockLeft["X"], game.clockLeft["O"] = game.clockLeft["O"], left
+	}
+	if game.Ready != nil {
+		game.Ready.Ready["X"], game.Ready.Ready["O"] = game.Ready.Ready["O"], game.Ready.Ready["X"]
+	}
+	game.Score.X, game.Score.O = game.Score.O, game.Score.X
+	game.Host = swap(game.Host)
+	game.Configured = swap(game.Configured)
+	for _, symbol := range []string{"X", "O"} {
+		game.SeatEpochs[symbol]++ // The old tokens name the wrong seat now
+		delete(game.restored, symbol)
+	}
+	for _, p := range game.Players {
+		p.setSeat(swap(p.Symbol), p.Role)
+		p.Token = issueSeatToken(game, p.Symbol)
+		p.pending = nil // Meant for the other seat
+	}
+	game.logger().Info("players swapped symbols", "score_x", game.Score.X, "score_o", game.Score.O)
+	game.journal.state("seats_swapped", "")
+
+	broadcast(game, OutboundMessage{
+		Event:        protocol.EventSeatsSwapped,
+		Score:        &game.Score,
+		Names:        game.playerNames(),
+		Participants: game.participants(),
+		Code:         "seats_swapped",
+	})
+	for _, p := range game.Players {
+		p.send(OutboundMessage{
+			Event:          protocol.EventPlayerAssignment,
+			Player:         p.Symbol,
+			Token:          p.Token,
+			ReconnectURL:   p.gameURL + "?token=" + url.QueryEscape(p.Token),
+			ReconnectGrace: int(cfg.ReconnectGrace / time.Second),
+			Score:          &game.Score,
+			CoinCommitment: game.coinPending(),
+		})
+	}
+	game.lobbyChanged()
+	game.persist()
+}
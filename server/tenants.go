@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+
+	"tictactoe/config"
+
+	"github.com/gorilla/mux"
+)
+
+// --- Tenants ---
+
+// gameKey identifies a game in the registry. Game IDs are only unique
+// within their tenant.
+type gameKey struct {
+	Tenant string
+	ID     string
+}
+
+func (game *Game) key() gameKey {
+	return gameKey{Tenant: game.Tenant, ID: game.ID}
+}
+
+var (
+	dynamicTenants   = make(map[string]config.Tenant)
+	dynamicTenantsMu sync.Mutex
+)
+
+// lookupTenant returns the tenant's limits, creating it first under
+// -dynamic-tenants if it isn't configured.
+func lookupTenant(name string) (config.Tenant, bool) {
+	if t, ok := cfg.Tenants[name]; ok {
+		return t, true
+	}
+	if !cfg.DynamicTenants || !config.ValidTenantName(name) {
+		return config.Tenant{}, false
+	}
+	dynamicTenantsMu.Lock()
+	defer dynamicTenantsMu.Unlock()
+	t, ok := dynamicTenants[name]
+	if !ok {
+		dynamicTenants[name] = t
+	}
+	return t, true
+}
+
+// requestTenant is the tenant named in the route, or DefaultTenant for the
+// legacy routes without /t/{tenant}.
+func requestTenant(r *http.Request) string {
+	if t := mux.Vars(r)["tenant"]; t != "" {
+		return t
+	}
+	return config.DefaultTenant
+}
+
+func requestGameKey(r *http.Request) gameKey {
+	return gameKey{Tenant: requestTenant(r), ID: mux.Vars(r)["game_id"]}
+}
+
+// tenantPrefix is the path segment routing to tenant.
+func tenantPrefix(tenant string) string {
+	if tenant == config.DefaultTenant {
+		return ""
+	}
+	return "/t/" + tenant
+}
+
+// tenantScope rejects requests for unknown tenants and browser requests
+// from origins the tenant doesn't allow.
+func tenantScope(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := lookupTenant(requestTenant(r))
+		if !ok {
+			writeError(w, r, http.StatusNotFound, "tenant_not_found")
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" && len(t.AllowedOrigins) > 0 && !originAllowed(t.AllowedOrigins, origin) {
+			writeError(w, r, http.StatusForbidden, "origin_not_allowed")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// tenantFull reports whether tenant is at its live game limit. Caller must
+// hold gamesMutex.
+func tenantFull(tenant string) bool {
+	t, _ := lookupTenant(tenant)
+	if t.MaxGames == 0 {
+		return false
+	}
+	n := 0
+	for key := range games {
+		if key.Tenant == tenant {
+			n++
+		}
+	}
+	return n >= t.MaxGames
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"tictactoe/engine"
+)
+
+// --- Three-Player Games ---
+
+// A game created with "players": 3 seats X, O and Δ (engine.Third), who
+// move in that order. It plays a 5x5 board won by 4 in a row unless the
+// creator asks for another size of at least 4, and starts once all three
+// seats are taken. Rematches, ready checks and accepting settings wait for
+// all three. Concessions, undos and aborts rest on one opponent's say, so
+// they are two-player only, as are rated, scheduled, correspondence and
+// ultimate games; a late player's turn is always skipped rather than
+// forfeited. Classic games seat two and their messages are unchanged; the
+// score only carries "Δ" once the third player has won a round.
+
+const (
+	threePlayerSize      = 5
+	threePlayerWinLength = 4
+	threePlayerMinSize   = 4 // Three players fill a smaller board before anyone can win
+)
+
+// playerRules checks req's player count against the other options sent
+// with it, and fills in the three-player board if req left it unset.
+func playerRules(req *createGameRequest) error {
+	switch {
+	case req.Players == 0 || req.Players == 2:
+		return nil
+	case req.Players != 3:
+		return fmt.Errorf("players must be 2 or 3")
+	case req.Rated || req.StartsAt != nil || req.Correspondence || (req.Variant != "" && req.Variant != engine.Classic):
+		return fmt.Errorf("rated, scheduled, correspondence and variant games are two-player only")
+	case req.TurnTimeout == timeoutForfeit:
+		return fmt.Errorf("a three-player game skips a late turn and can't forfeit it")
+	case req.Size != 0 && req.Size < threePlayerMinSize:
+		return fmt.Errorf("a three-player game needs a board of at least %dx%d", threePlayerMinSize, threePlayerMinSize)
+	}
+	if req.Size == 0 {
+		req.Size = threePlayerSize
+		if req.WinLength == 0 {
+			req.WinLength = threePlayerWinLength
+		}
+	}
+	return nil
+}
+
+// seats is how many players the game seats. Runs on the game's loop.
+func (game *Game) seats() int {
+	if game.ThreePlayer {
+		return 3
+	}
+	return 2
+}
+
+// recordedPlayers is the player count as kept in records and replays: 0
+// for a two-player game, so those stay as they were. Runs on the game's
+// loop.
+func (game *Game) recordedPlayers() int {
+	if game.ThreePlayer {
+		return 3
+	}
+	return 0
+}
+
+// symbols lists the game's seats in turn order. Runs on the game's
+// loop.
+func (game *Game) symbols() []string {
+	return engine.Symbols(game.seats())
+}
+
+// isSymbol reports whether s is one of the game's seats. Runs on the game's
+// loop.
+func (game *Game) isSymbol(s string) bool {
+	return engine.IsSymbol(s, game.seats())
+}
+
+// symbolChoices lists symbols for an error message: "X or O", or "X, O or
+// Δ".
+func symbolChoices(symbols []string) string {
+	last := len(symbols) - 1
+	return strings.Join(symbols[:last], ", ") + " or " + symbols[last]
+}
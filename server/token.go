@@ -0,0 +1,111 @@
+package server
+
+import (
+	"crypto/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"tictactoe/auth"
+)
+
+// --- Seat Tokens ---
+
+// tokenKey signs seat tokens. Servers that hand games to each other must
+// share it via -token-secret; otherwise each process picks its own.
+var tokenKey = randomKey()
+
+func randomKey() []byte {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return b
+}
+
+// issueSeatToken returns the token for a seat, signed by auth over
+// "<symbol>.<game nonce>.<epoch>" and valid for cfg.TokenTTL. It is bound to
+// this game instance rather than its ID, so it stops working once the game
+// expires even if the ID is reused, and to the seat's current holder, since
+// the epoch counts the times the seat has changed hands, so it stops working
+// once a spectator takes the seat over. Every transport that accepts a seat
+// token checks it with verifySeatToken.
+func issueSeatToken(game *Game, symbol string) string {
+	payload := symbol + "." + game.Nonce + "." + strconv.Itoa(game.SeatEpochs[symbol])
+	return auth.Sign(tokenKey, payload, time.Now().Add(cfg.TokenTTL))
+}
+
+// verifySeatToken returns the seat token was issued for, if it was issued by
+// this game for the seat's current holder and hasn't expired; otherwise
+// auth.ErrInvalid or auth.ErrExpired, whose text is the error code. Tokens
+// restored from a session are accepted as stored, since they may have been
+// signed with another process's key.
+func verifySeatToken(game *Game, token string) (symbol string, err error) {
+	for symbol, t := range game.restored {
+		if t == token {
+			return symbol, nil
+		}
+	}
+	payload, err := auth.Verify(tokenKey, token, time.Now())
+	if err != nil {
+		return "", err
+	}
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 || !game.isSymbol(parts[0]) || parts[1] != game.Nonce || parts[2] != strconv.Itoa(game.SeatEpochs[parts[0]]) {
+		return "", auth.ErrInvalid
+	}
+	return parts[0], nil
+}
+
+// gameURL is the canonical websocket URL of a game as the client reached
+// us, including any base path the app is served under.
+func gameURL(r *http.Request, game *Game) string {
+	scheme := "ws"
+	if requestScheme(r) == "https" {
+		scheme = "wss"
+	}
+	return scheme + "://" + r.Host + cfg.BasePath + tenantPrefix(game.Tenant) + "/ws/" + url.PathEscape(game.ID)
+}
+
+func reconnectURL(r *http.Request, game *Game, token string) string {
+	return gameURL(r, game) + "?token=" + url.QueryEscape(token)
+}
+
+// holdSeat keeps a departed player's seat for cfg.ReconnectGrace so they can
+// come back with their token. Runs on the game's loop.
+func (game *Game) holdSeat(p *Player) {
+	if cfg.ReconnectGrace <= 0 || game.closed {
+		return
+	}
+	game.holdSeatUntil(p.Symbol, p.Token, p.Identity, time.Now().Add(cfg.ReconnectGrace))
+}
+
+// holdSeatUntil reserves symbol's seat for token until, persisting the
+// hold so it survives a restart. Runs on the game's loop.
+func (game *Game) holdSeatUntil(symbol, token, identity string, until time.Time) {
+	game.Reserved[symbol] = token
+	game.HeldUntil[symbol] = until
+	game.saveSession(symbol, token, identity, until)
+	game.releaseAt(symbol, token, until)
+}
+
+// releaseAt arms the timer that frees a held seat at until. Runs on the
+// game's loop.
+func (game *Game) releaseAt(symbol, token string, until time.Time) {
+	time.AfterFunc(time.Until(until), func() {
+		game.do(func() {
+			// A reconnect and a second drop re-arm the hold; only the latest
+			// timer releases it.
+			if held, ok := game.HeldUntil[symbol]; !ok || held.After(until) || game.closed {
+				return
+			}
+			delete(game.HeldUntil, symbol)
+			game.journal.timer("seat_hold")
+			if game.Reserved[symbol] == token {
+				game.releaseSeat(symbol)
+				game.logger().Info("seat released", "seat", symbol)
+				game.announceOpenSeats()
+			}
+		})
+	})
+}
@@ -0,0 +1,516 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"tictactoe/discord"
+	"tictactoe/engine"
+	"tictactoe/i18n"
+	"tictactoe/protocol"
+	"tictactoe/replay"
+)
+
+// --- Game State Transfer ---
+
+// stateVersion is the newest exported game state format this build reads.
+const stateVersion = 1
+
+type SeatState struct {
+	Symbol   string `json:"symbol"`
+	Token    string `json:"token"`
+	Identity string `json:"identity,omitempty"` // Client ID that took the seat
+	Name     string `json:"name,omitempty"`
+}
+
+// GameState is everything needed to recreate a live game on another server,
+// minus the sockets. Seats come back as reservations for their tokens.
+type GameState struct {
+	Version                int                     `json:"version"`
+	ID                     string                  `json:"id"`
+	Tenant                 string                  `json:"tenant,omitempty"` // Informational on import; the route decides
+	Nonce                  string                  `json:"nonce,omitempty"`
+	Board                  engine.Board            `json:"board"`
+	CurrentPlayer          string                  `json:"current_player"`
+	StartingPlayerForRound string                  `json:"starting_player_for_round"`
+	FirstPlayer            string                  `json:"first_player,omitempty"`
+	Score                  Score                   `json:"score"`
+	Round                  int                     `json:"round"`
+	Rated                  bool                    `json:"rated,omitempty"`
+	Locale                 string                  `json:"locale,omitempty"`
+	WinConditions          []string                `json:"win_conditions,omitempty"`
+	Size                   int                     `json:"size,omitempty"`    // Absent for engine.DefaultSize
+	Players                int                     `json:"players,omitempty"` // 3 for a three-player game; absent for X and O
+	WinLength              int                     `json:"win_length,omitempty"`
+	ReadyCheck             bool                    `json:"ready_check,omitempty"`
+	SeatEpochs             map[string]int          `json:"seat_epochs,omitempty"`
+	StartsAt               *time.Time              `json:"starts_at,omitempty"`     // Scheduled games that haven't started yet
+	NoShowGrace            int                     `json:"no_show_grace,omitempty"` // Seconds
+	Correspondence         bool                    `json:"correspondence,omitempty"`
+	TurnWindow             int                     `json:"turn_window,omitempty"` // Seconds
+	TurnDeadline           *time.Time              `json:"turn_deadline,omitempty"`
+	DiscordWebhook         string                  `json:"discord_webhook,omitempty"`
+	StartedAt              *time.Time              `json:"started_at,omitempty"`
+	AI                     string                  `json:"ai,omitempty"` // Seat the computer plays
+	AIDifficulty           string                  `json:"ai_difficulty,omitempty"`
+	RoundResults           []protocol.RoundSummary `json:"round_results,omitempty"`
+	TurnTimer              *int                    `json:"turn_timer,omitempty"` // Seconds; absent for the server default
+	TurnTimeout            string                  `json:"turn_timeout,omitempty"`
+	TimeoutWinner          string                  `json:"timeout_winner,omitempty"`
+	TimeControl            *int                    `json:"time_control,omitempty"` // Seconds; absent for the server default
+	Clocks                 map[string]int64        `json:"clocks,omitempty"`       // Milliseconds left this round, by symbol
+	LegalMoves             bool                    `json:"legal_moves,omitempty"`
+	HideOpenings           bool                    `json:"hide_openings,omitempty"`
+	CoinFlip               bool                    `json:"coin_flip,omitempty"` // See coinflip.go
+	CoinFlipped            bool                    `json:"coin_flipped,omitempty"`
+	CoinNonce              string                  `json:"coin_nonce,omitempty"`
+	HeadToHead             bool                    `json:"head_to_head,omitempty"`      // See headtohead.go
+	HeadToHeadPair         []string                `json:"head_to_head_pair,omitempty"` // Once seeded
+	Conceded               string                  `json:"conceded,omitempty"`          // Seat that gave up the current round
+	Public                 bool                    `json:"public,omitempty"`
+	TargetWins             int                     `json:"target_wins,omitempty"`
+	MaxRounds              int                     `json:"max_rounds,omitempty"`    // See maxrounds.go
+	SeriesRounds           int                     `json:"series_rounds,omitempty"` // Rounds finished in the current series
+	SeriesStartedAt        *time.Time              `json:"series_started_at,omitempty"`
+	NewSeriesRequests      []string                `json:"new_series_requests,omitempty"`
+	StarterPolicy          string                  `json:"starter_policy,omitempty"`
+	RoundTimeLimit         int                     `json:"round_time_limit,omitempty"`  // Seconds; see deadlines.go
+	SeriesTimeLimit        int                     `json:"series_time_limit,omitempty"` // Seconds
+	RoundDeadline          *time.Time              `json:"round_deadline,omitempty"`
+	SeriesDeadline         *time.Time              `json:"series_deadline,omitempty"`
+	Adjudicated            string                  `json:"adjudicated,omitempty"`        // The current round's result by adjudication
+	SeriesAdjudicated      string                  `json:"series_adjudicated,omitempty"` // The series' winner by adjudication, or "draw"
+	PasswordHash           string                  `json:"password_hash,omitempty"`      // See private.go
+	SpectatorPasswordHash  string                  `json:"spectator_password_hash,omitempty"`
+	CreatedAt              *time.Time              `json:"created_at,omitempty"`
+	Moves                  []replay.Move           `json:"moves"`
+	History                []replay.Round          `json:"history"`
+	RematchRequests        []string                `json:"rematch_requests"`
+	Seats                  []SeatState             `json:"seats"`
+	ExpiresAt              time.Time               `json:"expires_at"`
+	ExportedAt             time.Time               `json:"exported_at"`
+}
+
+// exportState snapshots the game. Runs on the game's loop.
+func (game *Game) exportState() GameState {
+	st := GameState{
+		Version:                stateVersion,
+		ID:                     game.ID,
+		Tenant:                 game.Tenant,
+		Nonce:                  game.Nonce,
+		Board:                  game.Board.Clone(),
+		CurrentPlayer:          game.CurrentPlayer,
+		StartingPlayerForRound: game.StartingPlayerForRound,
+		FirstPlayer:            game.FirstPlayer,
+		Score:                  game.Score,
+		Round:                  game.Round,
+		Rated:                  game.Rated,
+		Locale:                 game.Locale,
+		WinConditions:          engine.ConditionNames(game.WinConditions),
+		WinLength:              game.WinLength,
+		ReadyCheck:             game.ReadyCheck,
+		SeatEpochs:             make(map[string]int),
+		Moves:                  append([]replay.Move(nil), game.Moves...),
+		History:                append([]replay.Round(nil), game.History...),
+		RematchRequests:        []string{},
+		Seats:                  []SeatState{},
+		ExpiresAt:              game.ExpiresAt.UTC(),
+		ExportedAt:             time.Now().UTC(),
+	}
+	for symbol, epoch := range game.SeatEpochs {
+		st.SeatEpochs[symbol] = epoch
+	}
+	st.Size = game.recordedSize()
+	st.Players = game.recordedPlayers()
+	if game.scheduled() {
+		startsAt := game.StartsAt.UTC()
+		st.StartsAt = &startsAt
+		st.NoShowGrace = int(game.NoShowGrace / time.Second)
+	}
+	if game.Correspondence {
+		st.Correspondence = true
+		st.TurnWindow = int(game.TurnWindow / time.Second)
+		if !game.TurnDeadline.IsZero() {
+			deadline := game.TurnDeadline.UTC()
+			st.TurnDeadline = &deadline
+		}
+	}
+	st.DiscordWebhook = game.DiscordWebhook
+	st.AI = game.AI
+	st.AIDifficulty = game.AIDifficulty
+	st.RoundResults = append([]protocol.RoundSummary(nil), game.RoundResults...)
+	timer := int(game.TurnTimer / time.Second)
+	st.TurnTimer = &timer
+	st.TurnTimeout = game.TurnTimeout
+	st.TimeoutWinner = game.TimeoutWinner
+	timeControl := int(game.TimeControl / time.Second)
+	st.TimeControl = &timeControl
+	st.Clocks = game.clocks()
+	st.LegalMoves = game.ShowLegalMoves
+	st.HideOpenings = game.HideOpenings
+	st.CoinFlip, st.CoinFlipped, st.CoinNonce = game.CoinFlip, game.CoinFlipped, game.coinNonce
+	st.HeadToHead = game.HeadToHead
+	if game.HeadToHeadPair[0] != "" {
+		st.HeadToHeadPair = game.HeadToHeadPair[:]
+	}
+	st.Conceded = game.Conceded
+	st.Public = game.Public
+	st.TargetWins = game.TargetWins
+	st.MaxRounds, st.SeriesRounds = game.MaxRounds, game.SeriesRounds
+	if !game.SeriesStartedAt.IsZero() {
+		started := game.SeriesStartedAt.UTC()
+		st.SeriesStartedAt = &started
+	}
+	st.StarterPolicy = game.StarterPolicy
+	st.RoundTimeLimit = int(game.RoundTimeLimit / time.Second)
+	st.SeriesTimeLimit = int(game.SeriesTimeLimit / time.Second)
+	if !game.RoundDeadline.IsZero() {
+		deadline := game.RoundDeadline.UTC()
+		st.RoundDeadline = &deadline
+	}
+	if !game.SeriesDeadline.IsZero() {
+		deadline := game.SeriesDeadline.UTC()
+		st.SeriesDeadline = &deadline
+	}
+	st.Adjudicated, st.SeriesAdjudicated = game.Adjudicated, game.SeriesAdjudicated
+	st.PasswordHash, st.SpectatorPasswordHash = game.PasswordHash, game.SpectatorPasswordHash
+	for symbol := range game.NewSeriesRequests {
+		st.NewSeriesRequests = append(st.NewSeriesRequests, symbol)
+	}
+	createdAt := game.CreatedAt.UTC()
+	st.CreatedAt = &createdAt
+	if !game.StartedAt.IsZero() {
+		startedAt := game.StartedAt.UTC()
+		st.StartedAt = &startedAt
+	}
+	for symbol := range game.RematchRequests {
+		st.RematchRequests = append(st.RematchRequests, symbol)
+	}
+	for _, p := range game.Players {
+		st.Seats = append(st.Seats, SeatState{Symbol: p.Symbol, Token: p.Token, Identity: game.SeatOwners[p.Symbol], Name: game.SeatNames[p.Symbol]})
+	}
+	for symbol, token := range game.Reserved {
+		st.Seats = append(st.Seats, SeatState{Symbol: symbol, Token: token, Identity: game.SeatOwners[symbol], Name: game.SeatNames[symbol]})
+	}
+	return st
+}
+
+// replayFile is the state's completed rounds as a replay, played by the
+// state's rules.
+func (st GameState) replayFile() *replay.File {
+	return &replay.File{Version: replay.Version, Rounds: st.History, WinConditions: st.WinConditions, Size: st.Size, WinLength: st.WinLength, Players: st.Players}
+}
+
+// validateState checks an imported state strictly: the history must replay
+// cleanly and the current round's moves must reproduce the exact board and
+// turn.
+func validateState(st GameState) error {
+	valid := func(s string) bool { return engine.IsSymbol(s, st.Players) }
+	switch {
+	case st.Version == 0:
+		return fmt.Errorf("missing version")
+	case st.Version > stateVersion:
+		return fmt.Errorf("state version %d is newer than the supported version %d", st.Version, stateVersion)
+	case st.ID == "":
+		return fmt.Errorf("missing id")
+	case !valid(st.StartingPlayerForRound) || !valid(st.CurrentPlayer) || (st.FirstPlayer != "" && !valid(st.FirstPlayer)):
+		return fmt.Errorf("invalid starting or current player")
+	case st.Players != 0 && st.Players != 3:
+		return fmt.Errorf("invalid players %d", st.Players)
+	case st.Round < 1 || st.Score.X < 0 || st.Score.O < 0 || st.Score.Third < 0 || st.Score.Draws < 0:
+		return fmt.Errorf("invalid round or score")
+	case st.Locale != "" && !i18n.Supported(st.Locale):
+		return fmt.Errorf("unsupported locale %q", st.Locale)
+	case st.StartsAt != nil && (len(st.Moves) > 0 || len(st.History) > 0):
+		return fmt.Errorf("a scheduled game can't have moves yet")
+	case st.NoShowGrace < 0:
+		return fmt.Errorf("negative no_show_grace")
+	case st.AI != "" && !valid(st.AI):
+		return fmt.Errorf("invalid ai seat %q", st.AI)
+	case !validDifficulty(st.AIDifficulty):
+		return fmt.Errorf("invalid ai difficulty %q", st.AIDifficulty)
+	case st.TurnWindow < 0:
+		return fmt.Errorf("negative turn_window")
+	case st.TurnTimer != nil && *st.TurnTimer < 0:
+		return fmt.Errorf("negative turn_timer")
+	case st.TimeControl != nil && *st.TimeControl < 0:
+		return fmt.Errorf("negative time_control")
+	case st.TurnTimeout != "" && !validTurnTimeout(st.TurnTimeout):
+		return fmt.Errorf("unknown turn_timeout %q", st.TurnTimeout)
+	case st.TimeoutWinner != "" && !valid(st.TimeoutWinner):
+		return fmt.Errorf("invalid timeout_winner %q", st.TimeoutWinner)
+	case st.Conceded != "" && !valid(st.Conceded):
+		return fmt.Errorf("invalid conceded %q", st.Conceded)
+	case st.Conceded != "" && st.TimeoutWinner != "":
+		return fmt.Errorf("conceded and timeout_winner both set")
+	case st.Adjudicated != "" && (st.Adjudicated != "draw" && !valid(st.Adjudicated) || st.Conceded != "" || st.TimeoutWinner != ""):
+		return fmt.Errorf("invalid adjudicated %q", st.Adjudicated)
+	case st.SeriesAdjudicated != "" && (st.SeriesAdjudicated != "draw" && !valid(st.SeriesAdjudicated) || st.TargetWins == 0):
+		return fmt.Errorf("invalid series_adjudicated %q", st.SeriesAdjudicated)
+	case st.RoundTimeLimit < 0 || st.SeriesTimeLimit < 0:
+		return fmt.Errorf("negative round_time_limit or series_time_limit")
+	case st.TargetWins != 0 && !validBestOf(2*st.TargetWins-1):
+		return fmt.Errorf("invalid target_wins %d", st.TargetWins)
+	case st.MaxRounds < 0 || st.MaxRounds > maxMaxRounds || st.MaxRounds > 0 && st.TargetWins != 0:
+		return fmt.Errorf("invalid max_rounds %d", st.MaxRounds)
+	case st.CoinFlip && protocol.CoinStarter(st.CoinNonce, engine.Symbols(st.Players)) == "":
+		return fmt.Errorf("invalid coin_nonce %q", st.CoinNonce)
+	case st.HeadToHeadPair != nil && (len(st.HeadToHeadPair) != 2 || st.HeadToHeadPair[0] == "" || st.HeadToHeadPair[0] >= st.HeadToHeadPair[1]):
+		return fmt.Errorf("invalid head_to_head_pair")
+	case st.SeriesRounds < 0 || st.MaxRounds > 0 && st.SeriesRounds > st.MaxRounds:
+		return fmt.Errorf("invalid series_rounds %d", st.SeriesRounds)
+	case st.StarterPolicy != "" && !validStarterPolicy(st.StarterPolicy):
+		return fmt.Errorf("unknown starter_policy %q", st.StarterPolicy)
+	case st.DiscordWebhook != "" && !discord.ValidWebhookURL(st.DiscordWebhook):
+		return fmt.Errorf("discord_webhook is not a Discord webhook URL")
+	}
+
+	history := st.replayFile()
+	size, wins, err := history.Rules()
+	if err != nil {
+		return err
+	}
+	if _, err := replay.Validate(history); err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+	current := replay.Round{Starter: st.StartingPlayerForRound, Moves: st.Moves}
+	m, err := replay.Start(current, size, st.Players, wins)
+	if err != nil {
+		return err
+	}
+	for i, mv := range st.Moves {
+		if _, err := replay.Apply(m, mv); err != nil {
+			return fmt.Errorf("current round, move %d: %w", i+1, err)
+		}
+	}
+	if st.TimeoutWinner != "" && m.Over {
+		return fmt.Errorf("timeout_winner set on a round decided on the board")
+	}
+	if st.Conceded != "" && m.Over {
+		return fmt.Errorf("conceded set on a round decided on the board")
+	}
+	if st.Adjudicated != "" && m.Over {
+		return fmt.Errorf("adjudicated set on a round decided on the board")
+	}
+	if !m.Board.Equal(st.Board) {
+		return fmt.Errorf("board does not match the current round's moves")
+	}
+	if !m.Over && m.CurrentPlayer != st.CurrentPlayer {
+		return fmt.Errorf("current player does not match the current round's moves")
+	}
+
+	seen := make(map[string]bool)
+	for _, seat := range st.Seats {
+		if !valid(seat.Symbol) || seat.Token == "" || seen[seat.Symbol] {
+			return fmt.Errorf("invalid seat %q", seat.Symbol)
+		}
+		seen[seat.Symbol] = true
+	}
+	for _, symbol := range st.RematchRequests {
+		if !valid(symbol) {
+			return fmt.Errorf("invalid rematch request %q", symbol)
+		}
+	}
+	for _, symbol := range st.NewSeriesRequests {
+		if !valid(symbol) {
+			return fmt.Errorf("invalid new series request %q", symbol)
+		}
+	}
+	for symbol, ms := range st.Clocks {
+		if !valid(symbol) || ms < 0 {
+			return fmt.Errorf("invalid clock %q", symbol)
+		}
+	}
+	if len(st.RoundResults) > maxRoundResults {
+		return fmt.Errorf("more than %d round_results", maxRoundResults)
+	}
+	for _, res := range st.RoundResults {
+		if (res.Result != "draw" && !valid(res.Result)) || res.Round < 1 || res.Moves < 0 || res.DurationMS < 0 {
+			return fmt.Errorf("invalid round result for round %d", res.Round)
+		}
+	}
+	return nil
+}
+
+func exportState(w http.ResponseWriter, r *http.Request) {
+	gamesMutex.RLock()
+	game, exists := games[requestGameKey(r)]
+	gamesMutex.RUnlock()
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "game_not_found")
+		return
+	}
+	var st GameState
+	game.do(func() { st = game.exportState() })
+	writeJSON(w, http.StatusOK, st)
+}
+
+// gameFromState rebuilds a game from validated state under tenant, with no
+// seats reserved yet.
+func gameFromState(st GameState, tenant string) *Game {
+	game := newGame(st.ID)
+	game.Tenant = tenant
+	game.Board = st.Board
+	game.CurrentPlayer = st.CurrentPlayer
+	game.StartingPlayerForRound = st.StartingPlayerForRound
+	if st.FirstPlayer != "" {
+		game.FirstPlayer = st.FirstPlayer
+	}
+	game.Score = st.Score
+	game.Round = st.Round
+	game.Rated = st.Rated
+	game.Locale = st.Locale
+	_, game.WinConditions, _ = st.replayFile().Rules() // Checked by validateState
+	game.WinLength = st.WinLength
+	game.ReadyCheck = st.ReadyCheck
+	for symbol, epoch := range st.SeatEpochs {
+		game.SeatEpochs[symbol] = epoch
+	}
+	if st.StartsAt != nil {
+		game.StartsAt = *st.StartsAt
+		game.NoShowGrace = time.Duration(st.NoShowGrace) * time.Second
+	}
+	if st.Correspondence {
+		game.Correspondence = true
+		game.TurnWindow = time.Duration(st.TurnWindow) * time.Second
+		if game.TurnWindow == 0 {
+			game.TurnWindow = cfg.CorrespondenceTurn
+		}
+		if st.TurnDeadline != nil {
+			game.TurnDeadline = *st.TurnDeadline
+		}
+	}
+	game.DiscordWebhook = st.DiscordWebhook
+	game.AI = st.AI
+	game.AIDifficulty = st.AIDifficulty
+	game.RoundResults = st.RoundResults
+	if game.AI != "" && game.AIDifficulty == "" {
+		game.AIDifficulty = aiHard // Saved before there was a choice
+	}
+	if st.TurnTimer != nil {
+		game.TurnTimer = time.Duration(*st.TurnTimer) * time.Second
+	}
+	if st.TurnTimeout != "" {
+		game.TurnTimeout = st.TurnTimeout
+	}
+	if st.TimeControl != nil {
+		game.TimeControl = time.Duration(*st.TimeControl) * time.Second
+	}
+	for symbol, ms := range st.Clocks {
+		game.clockLeft[symbol] = time.Duration(ms) * time.Millisecond
+	}
+	game.ShowLegalMoves = st.LegalMoves
+	game.HideOpenings = st.HideOpenings
+	game.CoinFlip, game.CoinFlipped, game.coinNonce = st.CoinFlip, st.CoinFlipped, st.CoinNonce
+	game.HeadToHead = st.HeadToHead
+	if len(st.HeadToHeadPair) == 2 {
+		game.HeadToHeadPair = [2]string{st.HeadToHeadPair[0], st.HeadToHeadPair[1]}
+	}
+	game.TimeoutWinner = st.TimeoutWinner
+	game.Conceded = st.Conceded
+	game.Public = st.Public
+	game.TargetWins = st.TargetWins
+	game.MaxRounds, game.SeriesRounds = st.MaxRounds, st.SeriesRounds
+	if st.SeriesStartedAt != nil {
+		game.SeriesStartedAt = *st.SeriesStartedAt
+	}
+	game.StarterPolicy = st.StarterPolicy
+	game.RoundTimeLimit = time.Duration(st.RoundTimeLimit) * time.Second
+	game.SeriesTimeLimit = time.Duration(st.SeriesTimeLimit) * time.Second
+	if st.RoundDeadline != nil {
+		game.RoundDeadline = *st.RoundDeadline
+	}
+	if st.SeriesDeadline != nil {
+		game.SeriesDeadline = *st.SeriesDeadline
+	}
+	game.Adjudicated, game.SeriesAdjudicated = st.Adjudicated, st.SeriesAdjudicated
+	game.ThreePlayer = st.Players == 3
+	game.PasswordHash, game.SpectatorPasswordHash = st.PasswordHash, st.SpectatorPasswordHash
+	for _, symbol := range st.NewSeriesRequests {
+		game.NewSeriesRequests[symbol] = true
+	}
+	if st.CreatedAt != nil {
+		game.CreatedAt = *st.CreatedAt
+	}
+	if st.StartedAt != nil {
+		game.StartedAt = *st.StartedAt
+	}
+	for _, seat := range st.Seats {
+		if seat.Identity != "" {
+			game.SeatOwners[seat.Symbol] = seat.Identity
+		}
+		if seat.Name != "" {
+			game.SeatNames[seat.Symbol] = displayName(seat.Name)
+		}
+	}
+	game.Moves = st.Moves
+	game.History = st.History
+	for _, symbol := range st.RematchRequests {
+		game.RematchRequests[symbol] = true
+	}
+	// Keep the instance nonce so seat tokens issued before the move still verify
+	if st.Nonce != "" {
+		game.Nonce = st.Nonce
+	}
+	// Keep the original deadline so a restart doesn't extend idle games
+	if !st.ExpiresAt.IsZero() {
+		game.ExpiresAt = st.ExpiresAt
+	}
+	return game
+}
+
+// importState recreates an exported game with every seat reserved, awaiting
+// its players' reconnection. ?on_conflict=remap assigns a fresh ID when the
+// original is taken; the default is to reject.
+func importState(w http.ResponseWriter, r *http.Request) {
+	var st GameState
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&st); err != nil {
+		writeErrorDetail(w, r, http.StatusBadRequest, "invalid_state", err.Error())
+		return
+	}
+	if err := validateState(st); err != nil {
+		writeErrorDetail(w, r, http.StatusUnprocessableEntity, "invalid_state", err.Error())
+		return
+	}
+	remap := r.URL.Query().Get("on_conflict") == "remap"
+
+	game := gameFromState(st, requestTenant(r))
+	for _, seat := range st.Seats {
+		if symbol, err := verifySeatToken(game, seat.Token); err != nil || symbol != seat.Symbol {
+			writeErrorDetail(w, r, http.StatusUnprocessableEntity, "invalid_state",
+				fmt.Sprintf("seat token for %s was not issued for this game; servers must share -token-secret", seat.Symbol))
+			return
+		}
+		game.Reserved[seat.Symbol] = seat.Token
+	}
+
+	gamesMutex.Lock()
+	if code := gameLimitCode(game.Tenant); code != "" {
+		gamesMutex.Unlock()
+		writeError(w, r, http.StatusServiceUnavailable, code)
+		return
+	}
+	if games[game.key()] != nil {
+		if !remap {
+			gamesMutex.Unlock()
+			writeError(w, r, http.StatusConflict, "game_exists")
+			return
+		}
+		for games[game.key()] != nil {
+			game.ID = newGameID()
+		}
+	}
+	registerGame(game)
+	gamesMutex.Unlock()
+	game.do(func() {
+		game.persist()
+		game.armSchedule()
+		game.armDeadlines()
+	})
+
+	writeJSON(w, http.StatusCreated, map[string]string{"game_id": game.ID, "status": "awaiting_reconnection"})
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"tictactoe/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// --- Transports ---
+
+// A player is reached over a conn: a websocket, or for clients behind
+// proxies that strip the Upgrade header, an event stream paired with POSTed
+// actions (see sse.go). Everything past the handshake goes through the
+// game the same way either way, so the two can share a game.
+//
+// A conn also carries the encoding its client chose: JSON, or on a game
+// websocket MessagePack, asked for with ?enc=msgpack or the "msgpack"
+// subprotocol, for clients short on bandwidth. The codec speaks the wire
+// version the client asked for too, with ?v= or a "v2.json" style
+// subprotocol (see protocol/version.go). Messages are encoded as they are
+// written, so a game can mix them all and broadcast never knows.
+
+type conn interface {
+	// Write sends one message in the conn's Codec, bounded by
+	// cfg.WriteTimeout.
+	Write(msg OutboundMessage) error
+	// Codec is the encoding the client chose, for its messages both ways.
+	Codec() protocol.Codec
+	// WriteClose sends a websocket close frame's payload as the goodbye
+	// before Close.
+	WriteClose(frame []byte)
+	// Ping sends a keepalive stamped with stamp; the peer's answer comes
+	// back through Player.handlePong.
+	Ping(stamp string) error
+	// SetReadDeadline bounds the wait for the peer's next message.
+	SetReadDeadline(t time.Time) error
+	Close() error
+}
+
+// wsConn is a conn over a websocket.
+type wsConn struct {
+	*websocket.Conn
+	codec protocol.Codec
+}
+
+func (c wsConn) Write(msg OutboundMessage) error {
+	data, err := c.codec.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout))
+	return c.WriteMessage(frameType(c.codec), data)
+}
+
+func (c wsConn) Codec() protocol.Codec {
+	return c.codec
+}
+
+func (c wsConn) WriteClose(frame []byte) {
+	c.WriteControl(websocket.CloseMessage, frame, time.Now().Add(time.Second))
+}
+
+func (c wsConn) Ping(stamp string) error {
+	return c.WriteControl(websocket.PingMessage, []byte(stamp), time.Now().Add(cfg.WriteTimeout))
+}
+
+// requestCodec is the encoding and wire version r asks for, by ?enc= and
+// ?v= or else by the first subprotocol naming them, and the subprotocol to
+// answer the upgrade with if the client offered one that fits. code is
+// invalid_encoding for an unknown ?enc= and unsupported_version for an
+// unknown ?v=, and "" otherwise.
+func requestCodec(r *http.Request) (codec protocol.Codec, subprotocol, code string) {
+	offered := websocket.Subprotocols(r)
+	version, enc := protocol.V1, ""
+	for _, p := range offered {
+		if v, name, ok := protocol.ParseSubprotocol(p); ok {
+			version, enc = v, name
+			break
+		}
+	}
+	if q := r.URL.Query().Get("enc"); q != "" {
+		enc = q
+	}
+	codec, ok := protocol.CodecNamed(enc)
+	if !ok {
+		return nil, "", "invalid_encoding"
+	}
+	if q := r.URL.Query().Get("v"); q != "" {
+		if version, ok = protocol.ParseVersion(q); !ok {
+			return nil, "", "unsupported_version"
+		}
+	}
+	for _, p := range offered {
+		// A bare encoding fits any version asked for with ?v=
+		if v, name, ok := protocol.ParseSubprotocol(p); ok && name == codec.Name() && (v == version || p == name) {
+			subprotocol = p
+			break
+		}
+	}
+	return protocol.ForVersion(codec, version), subprotocol, ""
+}
+
+// frameType is the websocket message type codec's frames go out as.
+func frameType(codec protocol.Codec) int {
+	if codec.Binary() {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"time"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+	"tictactoe/replay"
+)
+
+// --- Turn Timer ---
+
+// A game with a TurnTimer gives each player that long per move. Every turn
+// starts with a turn_timer carrying the deadline, and a player who lets it
+// pass either loses the round (timeout_win, a point to the opponent) or has
+// the turn passed to the opponent (turn_skipped), as TurnTimeout says.
+// Correspondence games keep their own, much longer, TurnDeadline instead.
+
+// Turn timeout policies.
+const (
+	timeoutForfeit = "forfeit"
+	timeoutSkip    = "skip"
+)
+
+// armTurnTimer (re)starts the clock for the current player's turn and
+// announces its deadline. Like armReminder, it does nothing unless the
+// round is in play; nor while the computer is on turn. Runs on the game's
+// loop.
+func (game *Game) armTurnTimer() {
+	game.stopTurnTimer()
+	if game.TurnTimer <= 0 || !game.canPlay() || game.paused() || game.Ready != nil || game.scheduled() || game.starting() || game.Correspondence || game.roundOver() || game.CurrentPlayer == game.AI {
+		return
+	}
+	gen := game.turnTimerGen
+	deadline := time.Now().Add(game.TurnTimer).UTC()
+	broadcast(game, OutboundMessage{Event: protocol.EventTurnTimer, Player: game.CurrentPlayer, Deadline: &deadline})
+	game.turnTimer = time.AfterFunc(game.TurnTimer, func() {
+		game.do(func() {
+			if game.turnTimerGen != gen || game.closed {
+				return
+			}
+			game.turnTimer = nil
+			game.journal.timer("turn_timer")
+			game.turnTimedOut()
+		})
+	})
+}
+
+// stopTurnTimer cancels the clock, including one that already fired and is
+// waiting its turn on the loop. Runs on the game's loop.
+func (game *Game) stopTurnTimer() {
+	if game.turnTimer != nil {
+		game.turnTimer.Stop()
+		game.turnTimer = nil
+	}
+	game.turnTimerGen++
+}
+
+// turnTimedOut applies TurnTimeout to the player on turn. Runs on the game's
+// loop.
+func (game *Game) turnTimedOut() {
+	late := game.CurrentPlayer
+	for _, p := range game.Players {
+		p.pending = nil // Too late to confirm
+	}
+	if game.TurnTimeout == timeoutSkip {
+		game.logger().Info("turn timed out, skipped", "player", late)
+		m := game.match()
+		m.Pass(late) // late is on turn in a round still on
+		game.CurrentPlayer = m.CurrentPlayer
+		now := time.Now().UTC()
+		game.Moves = append(game.Moves, replay.Move{Player: late, Skipped: true, At: &now})
+		game.BoardSeq++
+		game.runClock()
+		msg := protocol.BoardState(protocol.EventTurnSkipped, game.Board, game.CurrentPlayer, nil)
+		msg.Player, msg.Code = late, "turn_skipped"
+		msg.Clocks = game.clocks()
+		msg.LegalMoves = game.legalMoves()
+		broadcast(game, msg)
+		game.armReminder()
+		game.armTurnTimer()
+		game.armAI()
+		return
+	}
+
+	game.logger().Info("turn timed out, round forfeited", "player", late)
+	winner := engine.Other(late)
+	game.TimeoutWinner = winner
+	game.award(winner)
+	game.cancelReminder()
+	game.stopClock()
+	game.recordResult(winner)
+	broadcast(game, game.withRatingUpdate(OutboundMessage{
+		Event:  protocol.EventTimeoutWin,
+		Player: winner,
+		Board:  protocol.NewBoard(game.Board),
+		Score:  &game.Score,
+		Code:   "timeout_win",
+		Names:  game.playerNames(),
+
+		RoundStats: game.roundStats(),
+	}, winner))
+	game.stats.rounds++
+	game.checkSeries()
+}
+
+// result is the current round's outcome: "X" or "O" for a round won on the
+// board, on time, by concession or by adjudication, "draw", or "" while it
+// is still open.
+// Runs on the game's loop.
+func (game *Game) result() string {
+	if game.TimeoutWinner != "" {
+		return game.TimeoutWinner
+	}
+	if game.Conceded != "" {
+		return engine.Other(game.Conceded)
+	}
+	if game.Adjudicated != "" {
+		return game.Adjudicated
+	}
+	return roundResult(game.Board, game.WinConditions, lastMover(game.Moves))
+}
+
+// validTurnTimeout reports whether policy is one TurnTimeout accepts.
+func validTurnTimeout(policy string) bool {
+	return policy == timeoutForfeit || policy == timeoutSkip
+}
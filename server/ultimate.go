@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+// --- Ultimate ---
+
+// A game created with "variant": "ultimate" plays ultimate tic-tac-toe on a
+// 9x9 board; see engine/ultimate.go for the rules. The board goes out flat
+// as for any other size, and every message carrying it also carries the
+// sub-board states and the sub-board due next, so clients needn't work the
+// placement rule out themselves. Classic games' messages are unchanged.
+
+// variantRules checks req's variant against the board options sent with
+// it and returns the size and conditions to play with, given the ones
+// boardRules and ParseWinConditions chose for a classic game. Misère and
+// wild, see variants.go, take the classic options as they are; blitz, see
+// blitz.go, only those that still win with three marks.
+func variantRules(req createGameRequest, size int, wins []engine.WinCondition) (int, []engine.WinCondition, error) {
+	if v := engine.Variant(wins); v != engine.Classic {
+		return 0, nil, fmt.Errorf("%s is a variant, not a win condition", v)
+	}
+	switch req.Variant {
+	case "", engine.Classic:
+		return size, wins, nil
+	case engine.MisereName:
+		return size, append(wins, engine.Misere), nil
+	case engine.WildName:
+		return size, append(wins, engine.Wild), nil
+	case engine.BlitzName:
+		if len(req.WinConditions) > 0 || (req.WinLength == 0 && size != engine.BlitzMarks) || (req.WinLength != 0 && req.WinLength != engine.BlitzMarks) {
+			return 0, nil, fmt.Errorf("blitz is won by %d in a row only, with each player's last %d marks", engine.BlitzMarks, engine.BlitzMarks)
+		}
+		return size, append(wins, engine.Blitz), nil
+	case engine.UltimateName:
+		if (req.Size != 0 && req.Size != engine.UltimateSize) || req.WinLength != 0 || len(req.WinConditions) > 0 {
+			return 0, nil, fmt.Errorf("ultimate is played on a %dx%d board with its own win rule", engine.UltimateSize, engine.UltimateSize)
+		}
+		return engine.UltimateSize, []engine.WinCondition{engine.Ultimate}, nil
+	}
+	return 0, nil, fmt.Errorf("variant must be %s, %s, %s, %s or %s", engine.Classic, engine.UltimateName, engine.MisereName, engine.WildName, engine.BlitzName)
+}
+
+// ultimate reports whether the game plays ultimate. Runs on the game's
+// loop.
+func (game *Game) ultimate() bool {
+	return engine.IsUltimate(game.WinConditions)
+}
+
+// lastMark is the round's latest mark, skipping passed turns, or nil
+// before the first. Runs on the game's loop.
+func (game *Game) lastMark() *engine.Cell {
+	for i := len(game.Moves) - 1; i >= 0; i-- {
+		if mv := game.Moves[i]; !mv.Skipped {
+			return &engine.Cell{Row: mv.Row, Col: mv.Col}
+		}
+	}
+	return nil
+}
+
+// ultimateBoard is the sub-board view of the game's board, or nil in a
+// classic game. Runs on the game's loop.
+func (game *Game) ultimateBoard() *protocol.UltimateBoard {
+	if !game.ultimate() {
+		return nil
+	}
+	return ultimateView(game.Board, game.lastMark(), game.roundOver())
+}
+
+// ultimateView describes board b after the mark at last: every sub-board's
+// state, and the one the next move must go in unless the round is over or
+// any will do.
+func ultimateView(b engine.Board, last *engine.Cell, over bool) *protocol.UltimateBoard {
+	view := &protocol.UltimateBoard{SubBoards: engine.MetaBoard(b)}
+	if next, forced := engine.NextSubBoard(b, last); forced && !over {
+		view.Next = &[2]int{next.Row, next.Col}
+	}
+	return view
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"net/http"
+
+	"tictactoe/protocol"
+	"tictactoe/replay"
+)
+
+// --- Undo by Agreement ---
+
+// Either player may ask to take back their last move. The opponent accepts
+// or declines; on acceptance that move, and everything played after it,
+// comes off the board and the requester is on turn again. The computer
+// always accepts. A new move withdraws a pending request, and once the
+// round is won or drawn nothing can be undone.
+
+// undoRequest is a pending proposal to take back By's last move.
+type undoRequest struct {
+	By string // Symbol of the requester
+}
+
+// undoError is the error code saying why p can't ask for an undo now, or
+// "" if it can. Runs on the game's loop.
+func (game *Game) undoError(p *Player) string {
+	if game.ThreePlayer {
+		return "two_player_only"
+	}
+	switch game.roundStatus() {
+	case statusWaiting:
+		return "game_not_started"
+	case statusFinished:
+		return "round_over"
+	}
+	if game.lastMoveBy(p.Symbol) < 0 {
+		return "nothing_to_undo"
+	}
+	return ""
+}
+
+// lastMoveBy is the index in game.Moves of symbol's last mark this round,
+// or -1 if it has none. Runs on the game's loop.
+func (game *Game) lastMoveBy(symbol string) int {
+	for i := len(game.Moves) - 1; i >= 0; i-- {
+		if mv := game.Moves[i]; mv.Player == symbol && !mv.Skipped {
+			return i
+		}
+	}
+	return -1
+}
+
+// handleUndo runs undo_request, undo_accept and undo_decline. Runs on
+// the game's loop.
+func (game *Game) handleUndo(p *Player, event protocol.Event) {
+	pending := game.Undo
+	switch {
+	case event == protocol.EventUndoRequest:
+		if code := game.undoError(p); code != "" {
+			p.send(localize(p.locale(), protocol.Failure(code, "")))
+			return
+		}
+		game.Undo = &undoRequest{By: p.Symbol}
+		broadcast(game, OutboundMessage{Event: protocol.EventUndoRequested, Player: p.Symbol, From: p.participant()})
+		if game.AI != "" {
+			game.applyUndo(p.Symbol)
+		}
+	case pending == nil || pending.By == p.Symbol:
+		return // Nothing to answer
+	case event == protocol.EventUndoDecline:
+		game.Undo = nil
+		broadcast(game, OutboundMessage{Event: protocol.EventUndoDeclined, Player: pending.By, From: p.participant(), Code: "undo_declined"})
+	default:
+		game.applyUndo(pending.By)
+	}
+}
+
+// applyUndo takes back symbol's last move and whatever followed it, and
+// hands symbol the turn. Runs on the game's loop.
+func (game *Game) applyUndo(symbol string) {
+	game.Undo = nil
+	i := game.lastMoveBy(symbol)
+	if i < 0 || game.roundOver() {
+		return
+	}
+	n := len(game.Moves) - i
+	if game.blitz() {
+		game.Moves = game.Moves[:i]
+		game.replayBoard() // Marks the undone ones cleared come back
+	} else {
+		for _, mv := range game.Moves[i:] {
+			if !mv.Skipped {
+				game.Board[mv.Row][mv.Col] = ""
+			}
+		}
+		game.Moves = game.Moves[:i]
+	}
+	game.logger().Info("moves undone by agreement", "moves", n)
+	game.CurrentPlayer = symbol
+	game.BoardSeq++
+	for _, p := range game.Players {
+		p.pending = nil // Meant for the old board
+	}
+
+	msg := protocol.BoardState(protocol.EventUndoApplied, game.Board, game.CurrentPlayer, nil)
+	msg.Player = symbol
+	msg.MoveNumber = len(game.Moves)
+	msg.LegalMoves = game.legalMoves()
+	msg.Fading = game.fading()
+	broadcast(game, msg)
+	game.armReminder()
+	game.armTurnTimer()
+	game.runClock()
+	game.armAI()
+	game.persist()
+}
+
+// moveEntry is one line of the move log.
+type moveEntry struct {
+	Number int `json:"number"` // 1-based within the round
+	replay.Move
+}
+
+type moveLog struct {
+	GameID string      `json:"game_id"`
+	Round  int         `json:"round"`
+	Moves  []moveEntry `json:"moves"`
+}
+
+// getMoves serves the current round's moves of a live game, oldest first.
+func getMoves(w http.ResponseWriter, r *http.Request) {
+	gamesMutex.RLock()
+	game, exists := games[requestGameKey(r)]
+	gamesMutex.RUnlock()
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "game_not_found")
+		return
+	}
+
+	var out moveLog
+	game.do(func() {
+		out = moveLog{GameID: game.ID, Round: game.Round, Moves: make([]moveEntry, len(game.Moves))}
+		for i, mv := range game.Moves {
+			out.Moves[i] = moveEntry{Number: i + 1, Move: mv}
+		}
+	})
+	writeJSON(w, http.StatusOK, out)
+}
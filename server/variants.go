@@ -0,0 +1,41 @@
+package server
+
+import (
+	"tictactoe/engine"
+	"tictactoe/replay"
+)
+
+// --- Misère and Wild ---
+
+// A game created with "variant": "misere" or "wild" plays that variant of
+// the classic rules; see engine/variants.go. The board, size and win
+// length are as in a classic game, and the variant stays for every round
+// and series. In wild a make_move carries the symbol to mark as "mark",
+// and a move event's Symbol is the mark placed while Player says who
+// placed it. A win event's Player is always the round's winner, which in
+// misère is the player who didn't complete the line.
+
+// wild reports whether the game plays wild. Runs on the game's loop.
+func (game *Game) wild() bool {
+	return engine.IsWild(game.WinConditions)
+}
+
+// lastMover is the player who made the latest mark in moves, skipping
+// passed turns, or "" before the first.
+func lastMover(moves []replay.Move) string {
+	for i := len(moves) - 1; i >= 0; i-- {
+		if !moves[i].Skipped {
+			return moves[i].Player
+		}
+	}
+	return ""
+}
+
+// variant is the game's rule set, for start_game: "" for classic. Runs
+// on the game's loop.
+func (game *Game) variant() string {
+	if v := engine.Variant(game.WinConditions); v != engine.Classic {
+		return v
+	}
+	return ""
+}
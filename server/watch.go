@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// --- Admin Watch Stream ---
+
+// watcher is an invisible subscriber to a game's broadcasts. It never
+// appears in game.Players, so it is not counted or announced.
+type watcher struct {
+	events chan watchEvent
+}
+
+type watchEvent struct {
+	Seq uint64
+	Msg OutboundMessage
+}
+
+// watch attaches a new watcher. Runs on the game's loop.
+func (game *Game) watch() *watcher {
+	w := &watcher{events: make(chan watchEvent, cfg.SendQueueDepth)}
+	game.Watchers[w] = struct{}{}
+	return w
+}
+
+// unwatch detaches w and ends its stream. Runs on the game's loop.
+func (game *Game) unwatch(w *watcher) {
+	if _, ok := game.Watchers[w]; ok {
+		delete(game.Watchers, w)
+		close(w.events)
+	}
+}
+
+// publish hands msg to every watcher with the sequence number of the
+// broadcast that carried it. A watcher that falls behind is cut off rather
+// than shown a stream with gaps; it can reconnect for a fresh snapshot.
+// Runs on the game's loop.
+func (game *Game) publish(msg OutboundMessage) {
+	for w := range game.Watchers {
+		select {
+		case w.events <- watchEvent{Seq: game.Seq, Msg: msg}:
+		default:
+			game.logger().Warn("admin watcher fell behind, detaching")
+			game.unwatch(w)
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, seq uint64, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", seq, event, payload)
+	w.(http.Flusher).Flush()
+	return err
+}
+
+// watchGame streams a game to an admin over server-sent events: a snapshot
+// first, then every broadcast, each tagged with its sequence number.
+func watchGame(w http.ResponseWriter, r *http.Request) {
+	key := requestGameKey(r)
+	if _, ok := w.(http.Flusher); !ok {
+		writeError(w, r, http.StatusInternalServerError, "internal_error")
+		return
+	}
+
+	gamesMutex.RLock()
+	game, exists := games[key]
+	gamesMutex.RUnlock()
+	if !exists {
+		writeError(w, r, http.StatusNotFound, "game_not_found")
+		return
+	}
+
+	var sub *watcher
+	var snapshot GameState
+	var seq uint64
+	game.do(func() {
+		sub = game.watch()
+		snapshot, seq = game.exportState(), game.Seq
+	})
+	defer game.do(func() { game.unwatch(sub) })
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := writeSSE(w, seq, "snapshot", snapshot); err != nil {
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			if err := writeSSE(w, ev.Seq, string(ev.Msg.Event), localize(requestLocale(r), ev.Msg)); err != nil {
+				return
+			}
+		}
+	}
+}
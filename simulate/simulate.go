@@ -0,0 +1,322 @@
+// Package simulate load-tests a running server by playing many concurrent
+// games through real websocket clients. They all come from one IP, so a
+// server with per-IP limits set needs it in -trusted-ips for more than a
+// handful of pairs.
+package simulate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	mrand "math/rand"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tictactoe/client"
+	"tictactoe/engine"
+	"tictactoe/protocol"
+)
+
+type Options struct {
+	Server    string        // Base URL, e.g. ws://localhost:8000
+	Pairs     int           // Concurrent games, two clients each
+	ThinkTime time.Duration // Max random delay before each move
+	Rematch   bool          // Keep playing rounds in the same game instead of reconnecting
+	RampUp    time.Duration // Spread pair start times over this window
+	Duration  time.Duration // Total run time
+	Timeout   time.Duration // Max wait for any single server reply
+}
+
+type Result struct {
+	ConnectErrors int64
+	GameErrors    int64
+	Games         int64
+	Moves         int
+	P50, P90, P99 time.Duration
+	Max           time.Duration
+	Elapsed       time.Duration
+}
+
+func (r Result) GamesPerSecond() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Games) / r.Elapsed.Seconds()
+}
+
+func (r Result) Print(w io.Writer) {
+	fmt.Fprintf(w, "elapsed:         %s\n", r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "games:           %d (%.2f/s)\n", r.Games, r.GamesPerSecond())
+	fmt.Fprintf(w, "moves:           %d\n", r.Moves)
+	fmt.Fprintf(w, "connect errors:  %d\n", r.ConnectErrors)
+	fmt.Fprintf(w, "game errors:     %d\n", r.GameErrors)
+	fmt.Fprintf(w, "move rtt p50:    %s\n", r.P50)
+	fmt.Fprintf(w, "move rtt p90:    %s\n", r.P90)
+	fmt.Fprintf(w, "move rtt p99:    %s\n", r.P99)
+	fmt.Fprintf(w, "move rtt max:    %s\n", r.Max)
+}
+
+type recorder struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+
+	connectErrors atomic.Int64
+	gameErrors    atomic.Int64
+	rounds        atomic.Int64
+}
+
+func (rec *recorder) observe(d time.Duration) {
+	rec.mu.Lock()
+	rec.latencies = append(rec.latencies, d)
+	rec.mu.Unlock()
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p)
+	return sorted[i]
+}
+
+// Run plays games against opts.Server until opts.Duration elapses or ctx is
+// cancelled, then reports what it measured.
+func Run(ctx context.Context, opts Options) Result {
+	ctx, cancel := context.WithTimeout(ctx, opts.Duration)
+	defer cancel()
+
+	rec := &recorder{}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Pairs; i++ {
+		delay := time.Duration(0)
+		if opts.Pairs > 1 {
+			delay = opts.RampUp * time.Duration(i) / time.Duration(opts.Pairs)
+		}
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			runPair(ctx, opts, rec, mrand.New(mrand.NewSource(seed)))
+		}(time.Now().UnixNano() + int64(i))
+	}
+	wg.Wait()
+
+	sort.Slice(rec.latencies, func(i, j int) bool { return rec.latencies[i] < rec.latencies[j] })
+	res := Result{
+		ConnectErrors: rec.connectErrors.Load(),
+		GameErrors:    rec.gameErrors.Load(),
+		Games:         rec.rounds.Load(),
+		Moves:         len(rec.latencies),
+		P50:           percentile(rec.latencies, 0.50),
+		P90:           percentile(rec.latencies, 0.90),
+		P99:           percentile(rec.latencies, 0.99),
+		Elapsed:       time.Since(start),
+	}
+	if n := len(rec.latencies); n > 0 {
+		res.Max = rec.latencies[n-1]
+	}
+	return res
+}
+
+func randomGameID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return "sim-" + hex.EncodeToString(b)
+}
+
+// runPair repeatedly connects two clients to a fresh game and plays it.
+func runPair(ctx context.Context, opts Options, rec *recorder, rng *mrand.Rand) {
+	for ctx.Err() == nil {
+		err := playMatch(ctx, opts, rec, rng)
+		if err != nil && ctx.Err() == nil {
+			rec.gameErrors.Add(1)
+		}
+	}
+}
+
+type pair struct {
+	conns map[string]*client.Conn
+	opts  Options
+}
+
+func (p *pair) close() {
+	for _, c := range p.conns {
+		c.Close()
+	}
+}
+
+// await reads from c until one of events arrives.
+func (p *pair) await(c *client.Conn, events ...protocol.Event) (protocol.OutboundMessage, error) {
+	c.SetReadDeadline(time.Now().Add(p.opts.Timeout))
+	for {
+		msg, err := c.Receive()
+		if err != nil {
+			return msg, err
+		}
+		if msg.Error != "" {
+			return msg, errors.New(msg.Error)
+		}
+		if msg.Event == protocol.EventOpponentLeft {
+			return msg, errors.New("opponent left")
+		}
+		for _, e := range events {
+			if msg.Event == e {
+				return msg, nil
+			}
+		}
+	}
+}
+
+func playMatch(ctx context.Context, opts Options, rec *recorder, rng *mrand.Rand) error {
+	url := client.GameURL(opts.Server, randomGameID())
+	p := &pair{conns: make(map[string]*client.Conn), opts: opts}
+	defer p.close()
+
+	var first *client.Conn
+	for i := 0; i < 2; i++ {
+		c, err := client.Dial(ctx, url, nil)
+		if err != nil {
+			rec.connectErrors.Add(1)
+			return err
+		}
+		assign, err := p.await(c, protocol.EventPlayerAssignment)
+		if err != nil {
+			c.Close()
+			return err
+		}
+		p.conns[assign.Player] = c
+		if first == nil {
+			first = c
+		}
+	}
+	start, err := p.await(first, protocol.EventStartGame)
+	if err != nil {
+		return err
+	}
+	for _, c := range p.conns {
+		if c != first {
+			if _, err := p.await(c, protocol.EventStartGame); err != nil {
+				return err
+			}
+		}
+	}
+
+	turn, size := start.CurrentPlayer, engine.DefaultSize
+	if start.Board != nil {
+		size = len(*start.Board)
+	}
+	for {
+		if err := p.playRound(ctx, rec, rng, turn, size); err != nil {
+			return err
+		}
+		rec.rounds.Add(1)
+		if !opts.Rematch || ctx.Err() != nil {
+			return nil
+		}
+		for _, c := range p.conns {
+			if err := c.RequestRematch(); err != nil {
+				return err
+			}
+		}
+		for _, c := range p.conns {
+			msg, err := p.await(c, protocol.EventNewGame)
+			if err != nil {
+				return err
+			}
+			turn = msg.CurrentPlayer
+		}
+	}
+}
+
+// playRound plays random legal moves on a size×size board until the round
+// is won or drawn, timing each move from send until the mover sees the
+// broadcast.
+func (p *pair) playRound(ctx context.Context, rec *recorder, rng *mrand.Rand, turn string, size int) error {
+	board := make(protocol.Board, size)
+	for r := range board {
+		board[r] = make([]string, size)
+	}
+	for {
+		if p.opts.ThinkTime > 0 {
+			select {
+			case <-time.After(time.Duration(rng.Int63n(int64(p.opts.ThinkTime)))):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		var empty [][2]int
+		for r := range board {
+			for c := range board[r] {
+				if board[r][c] == "" {
+					empty = append(empty, [2]int{r, c})
+				}
+			}
+		}
+		cell := empty[rng.Intn(len(empty))]
+
+		mover := p.conns[turn]
+		sent := time.Now()
+		if err := mover.MakeMove(cell[0], cell[1]); err != nil {
+			return err
+		}
+		result, err := p.await(mover, protocol.EventMove, protocol.EventWin, protocol.EventDraw)
+		if err != nil {
+			return err
+		}
+		rec.observe(time.Since(sent))
+		for symbol, c := range p.conns {
+			if symbol != turn {
+				if _, err := p.await(c, protocol.EventMove, protocol.EventWin, protocol.EventDraw); err != nil {
+					return err
+				}
+			}
+		}
+
+		if result.Board != nil {
+			board = *result.Board
+		}
+		if result.Event != protocol.EventMove {
+			return nil
+		}
+		turn = result.CurrentPlayer
+	}
+}
+
+// Main runs the simulate subcommand with command-line args.
+func Main(args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	opts := Options{}
+	fs.StringVar(&opts.Server, "server", "ws://localhost:8000", "server base URL")
+	fs.IntVar(&opts.Pairs, "pairs", 10, "concurrent games (two clients each)")
+	fs.DurationVar(&opts.ThinkTime, "think", 100*time.Millisecond, "max random think time before each move")
+	fs.BoolVar(&opts.Rematch, "rematch", true, "request rematches instead of reconnecting after each round")
+	fs.DurationVar(&opts.RampUp, "ramp-up", 5*time.Second, "spread client start-up over this period")
+	fs.DurationVar(&opts.Duration, "duration", 30*time.Second, "total run time")
+	fs.DurationVar(&opts.Timeout, "timeout", 10*time.Second, "max wait for a server reply")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.Pairs < 1 {
+		return errors.New("-pairs must be at least 1")
+	}
+
+	res := Run(context.Background(), opts)
+	res.Print(os.Stdout)
+	if res.Games == 0 {
+		return errors.New("no games completed")
+	}
+	return nil
+}
@@ -1,234 +1,514 @@
-// --- Main View Elements ---
-const gameSetup = document.getElementById("game-setup");
-const waitingRoom = document.getElementById("waiting-room");
-const gameContainer = document.getElementById("game-container");
-
-// --- Buttons and Inputs ---
-const gameIdInput = document.getElementById("game-id-input");
-const joinGameBtn = document.getElementById("join-game-btn");
-const createGameBtn = document.getElementById("create-game-btn");
-const copyGameIdBtn = document.getElementById("copy-game-id-btn");
-
-// --- Display Elements ---
-const statusDiv = document.getElementById("status");
-const cells = document.querySelectorAll(".cell");
-const displayGameId = document.getElementById("display-game-id");
-const displayGameIdWaiting = document.getElementById("display-game-id-waiting");
-const displayPlayerSymbol = document.getElementById("display-player-symbol");
-const scoreXDiv = document.getElementById("score-x");
-const scoreODiv = document.getElementById("score-o");
-
-// --- Modal Elements ---
-const endGameModal = document.getElementById("end-game-modal");
-const modalTitle = document.getElementById("modal-title");
-const rematchBtn = document.getElementById("rematch-btn");
-const newGameBtn = document.getElementById("new-game-btn");
-
-let websocket;
-let gameId;
-let player;
-
-// --- View Management ---
-function showView(viewName) {
-    gameSetup.classList.add("hidden");
-    waitingRoom.classList.add("hidden");
-    gameContainer.classList.add("hidden");
-    const viewToShow = document.getElementById(viewName);
-    if (viewToShow) {
-        viewToShow.classList.remove("hidden");
-    }
-}
-
-// --- Modal Management ---
-function showEndGameModal(title) {
-    modalTitle.textContent = title;
-    endGameModal.classList.remove("hidden");
-    rematchBtn.disabled = false;
-    rematchBtn.textContent = "Request Rematch";
-}
-
-function hideEndGameModal() {
-    endGameModal.classList.add("hidden");
-}
-
-// --- Event Listeners ---
-createGameBtn.addEventListener("click", () => {
-    gameId = Math.random().toString(36).substring(2, 8);
-    displayGameIdWaiting.textContent = gameId;
-    showView('waiting-room');
-    connectWebSocket();
-});
-
-joinGameBtn.addEventListener("click", () => {
-    gameId = gameIdInput.value.trim();
-    if (gameId) {
-        showView('waiting-room');
-        connectWebSocket();
-    } else {
-        alert("Please enter a valid Game ID.");
-    }
-});
-
-copyGameIdBtn.addEventListener("click", () => {
-    navigator.clipboard.writeText(gameId).then(() => {
-        copyGameIdBtn.textContent = 'Copied!';
-        setTimeout(() => { copyGameIdBtn.textContent = 'Copy ID'; }, 2000);
-    });
-});
-
-rematchBtn.addEventListener("click", () => {
-    websocket.send(JSON.stringify({ event: "rematch_request" }));
-    rematchBtn.textContent = "Waiting for Opponent...";
-    rematchBtn.disabled = true;
-});
-
-newGameBtn.addEventListener("click", () => {
-    location.reload();
-});
-
-
-// --- WebSocket Logic ---
-function connectWebSocket() {
-    websocket = new WebSocket(`wss://${window.location.host}/ws/${gameId}`);
-
-    websocket.onopen = () => console.log("WebSocket connection established");
-
-    websocket.onmessage = (event) => {
-        const data = JSON.parse(event.data);
-
-        if (data.error) {
-            alert(data.error);
-            showView('game-setup');
-            return;
-        }
-
-        switch (data.event) {
-            case "player_assignment":
-                player = data.player;
-                displayPlayerSymbol.textContent = player;
-                break;
-            case "start_game":
-                updateScore(data.score);
-                displayGameId.textContent = gameId;
-                showView('game-container');
-                updateTurnIndicator(data.current_player);
-                statusDiv.textContent = `Game started! It's Player ${data.current_player}'s turn.`;
-                break;
-            case "move":
-                updateBoard(data.board);
-                updateTurnIndicator(data.current_player);
-                statusDiv.textContent = (data.current_player === player) ? "It's your turn." : `It's Player ${data.current_player}'s turn.`;
-                break;
-            case "win":
-                updateBoard(data.board);
-                updateScore(data.score);
-                disableBoard();
-                showEndGameModal((data.player === player) ? "You Win!" : `Player ${data.player} Wins!`);
-                break;
-            case "draw":
-                updateBoard(data.board);
-                disableBoard();
-                showEndGameModal("It's a Draw!");
-                break;
-            case "new_game":
-                hideEndGameModal();
-                resetBoard();
-                updateBoard(data.board);
-                updateScore(data.score);
-                updateTurnIndicator(data.current_player);
-                statusDiv.textContent = `Rematch! It's Player ${data.current_player}'s turn.`;
-                break;
-            case "opponent_left":
-                statusDiv.textContent = "Your opponent has left the game.";
-                disableBoard();
-                hideEndGameModal();
-                break;
-        }
-    };
-
-    websocket.onclose = () => {
-        console.log("WebSocket connection closed");
-        if (!statusDiv.textContent.includes("left")) {
-            statusDiv.textContent = "Connection lost. Please refresh.";
-        }
-        disableBoard();
-        hideEndGameModal();
-    };
-
-    websocket.onerror = (error) => {
-        console.error("WebSocket error:", error);
-        statusDiv.textContent = "An error occurred. Please refresh the page.";
-    };
-}
-
-// --- Game Board & UI Logic ---
-cells.forEach(cell => {
-    cell.addEventListener("click", () => {
-        // Check if the cell is empty by seeing if it has a child span
-        if (!cell.querySelector('span') && player && !cell.style.cursor.includes('not-allowed')) {
-            const row = cell.dataset.row;
-            const col = cell.dataset.col;
-            websocket.send(JSON.stringify({ event: "make_move", row: parseInt(row), col: parseInt(col) }));
-        }
-    });
-});
-
-function updateBoard(board) {
-    board.forEach((row, i) => {
-        row.forEach((value, j) => {
-            const cell = document.querySelector(`.cell[data-row='${i}'][data-col='${j}']`);
-            
-            // If there's a value but the cell is empty, create the span
-            if (value && !cell.querySelector('span')) {
-                const span = document.createElement('span');
-                span.textContent = value;
-                cell.appendChild(span);
-            } 
-            // If there's no value but the cell has a span, remove it
-            else if (!value && cell.querySelector('span')) {
-                cell.innerHTML = '';
-            }
-
-            // Update styling class
-            cell.classList.remove('X', 'O');
-            if (value) {
-                cell.classList.add(value);
-            }
-        });
-    });
-}
-
-function resetBoard() {
-    cells.forEach(cell => {
-        cell.innerHTML = ""; // This removes the inner span
-        cell.style.cursor = 'pointer';
-        cell.classList.remove('X', 'O');
-    });
-}
-
-function disableBoard() {
-    cells.forEach(cell => {
-        cell.style.cursor = 'not-allowed';
-    });
-}
-
-function updateScore(score) {
-    scoreXDiv.textContent = `Player X: ${score.X}`;
-    scoreODiv.textContent = `Player O: ${score.O}`;
-}
-
-function updateTurnIndicator(currentPlayer) {
-    scoreXDiv.classList.remove('current-player');
-    scoreODiv.classList.remove('current-player');
-    if (currentPlayer === 'X') {
-        scoreXDiv.classList.add('current-player');
-    } else {
-        scoreODiv.classList.add('current-player');
-    }
-}
-
-// --- Initial State ---
-document.addEventListener('DOMContentLoaded', () => {
-    showView('game-setup');
-});
-
+// --- Main View Elements ---
+const gameSetup = document.getElementById("game-setup");
+const waitingRoom = document.getElementById("waiting-room");
+const gameContainer = document.getElementById("game-container");
+
+// --- Buttons and Inputs ---
+const gameIdInput = document.getElementById("game-id-input");
+const joinGameBtn = document.getElementById("join-game-btn");
+const createGameBtn = document.getElementById("create-game-btn");
+const quickMatchBtn = document.getElementById("quick-match-btn");
+const copyGameIdBtn = document.getElementById("copy-game-id-btn");
+const symbolSelect = document.getElementById("symbol-select");
+const swapBtn = document.getElementById("swap-btn");
+
+// --- Display Elements ---
+const statusDiv = document.getElementById("status");
+const gameBoard = document.getElementById("game-board");
+let cells = document.querySelectorAll(".cell");
+const displayGameId = document.getElementById("display-game-id");
+const displayGameIdWaiting = document.getElementById("display-game-id-waiting");
+const displayPlayerSymbol = document.getElementById("display-player-symbol");
+const scoreXDiv = document.getElementById("score-x");
+const scoreODiv = document.getElementById("score-o");
+const scoreThirdDiv = document.getElementById("score-third");
+const scoreDrawsDiv = document.getElementById("score-draws");
+const latencyP = document.getElementById("latency");
+
+// --- Modal Elements ---
+const endGameModal = document.getElementById("end-game-modal");
+const modalTitle = document.getElementById("modal-title");
+const rematchBtn = document.getElementById("rematch-btn");
+const newGameBtn = document.getElementById("new-game-btn");
+
+let websocket;
+let gameId;
+let player;
+let seriesOver = false;
+let seatToken;
+let coinCommitment;
+let names = { X: "Player X", O: "Player O" };
+
+// --- Server URLs ---
+// The page may be served under a path prefix, which the server puts on the body.
+const basePath = document.body.dataset.basePath || "";
+const csrfToken = document.body.dataset.csrfToken || "";
+const wsBase = `${location.protocol === "https:" ? "wss" : "ws"}://${location.host}${basePath}`;
+
+// One ID for this browser, shared by its tabs, so a second tab takes over
+// our seat instead of taking the opponent's
+let clientId = localStorage.getItem("clientId");
+if (!clientId) {
+    // randomUUID needs a secure context, which plain http:// isn't
+    clientId = crypto.randomUUID ? crypto.randomUUID() : Math.random().toString(36).slice(2) + Date.now().toString(36);
+    localStorage.setItem("clientId", clientId);
+}
+
+// --- View Management ---
+function showView(viewName) {
+    gameSetup.classList.add("hidden");
+    waitingRoom.classList.add("hidden");
+    gameContainer.classList.add("hidden");
+    const viewToShow = document.getElementById(viewName);
+    if (viewToShow) {
+        viewToShow.classList.remove("hidden");
+    }
+}
+
+// --- Modal Management ---
+function showEndGameModal(title) {
+    modalTitle.textContent = title;
+    endGameModal.classList.remove("hidden");
+    rematchBtn.disabled = false;
+    rematchBtn.textContent = "Request Rematch";
+}
+
+function hideEndGameModal() {
+    endGameModal.classList.add("hidden");
+}
+
+// --- Event Listeners ---
+createGameBtn.addEventListener("click", async () => {
+    const response = await fetch(`${basePath}/games`, { method: "POST", headers: { "X-CSRF-Token": csrfToken } });
+    const data = await response.json();
+    if (!response.ok) {
+        alert(data.message);
+        return;
+    }
+    gameId = data.game_id;
+    displayGameIdWaiting.textContent = gameId;
+    showView('waiting-room');
+    connectWebSocket();
+});
+
+quickMatchBtn.addEventListener("click", () => {
+    const queue = new WebSocket(`${wsBase}/ws/quickmatch`);
+    displayGameIdWaiting.textContent = "Quick match";
+    showView('waiting-room');
+    queue.onmessage = (event) => {
+        const data = JSON.parse(event.data);
+        if (data.error) {
+            alert(data.error);
+            showView('game-setup');
+            return;
+        }
+        if (data.event === "match_found") {
+            gameId = data.game_id;
+            seatToken = data.token;
+            displayGameIdWaiting.textContent = gameId;
+            connectWebSocket();
+        }
+    };
+});
+
+joinGameBtn.addEventListener("click", () => {
+    gameId = gameIdInput.value.trim();
+    if (gameId) {
+        showView('waiting-room');
+        connectWebSocket();
+    } else {
+        alert("Please enter a valid Game ID.");
+    }
+});
+
+copyGameIdBtn.addEventListener("click", () => {
+    navigator.clipboard.writeText(gameId).then(() => {
+        copyGameIdBtn.textContent = 'Copied!';
+        setTimeout(() => { copyGameIdBtn.textContent = 'Copy ID'; }, 2000);
+    });
+});
+
+rematchBtn.addEventListener("click", () => {
+    websocket.send(JSON.stringify({ event: seriesOver ? "new_series" : "rematch_request" }));
+    rematchBtn.textContent = "Waiting for Opponent...";
+    rematchBtn.disabled = true;
+});
+
+// Trading symbols is only possible before a round's first move or after its end
+swapBtn.addEventListener("click", () => {
+    websocket.send(JSON.stringify({ event: "swap_request" }));
+    swapBtn.disabled = true;
+});
+
+newGameBtn.addEventListener("click", () => {
+    location.reload();
+});
+
+
+// --- WebSocket Logic ---
+function connectWebSocket() {
+    let query = `?client_id=${encodeURIComponent(clientId)}`;
+    if (seatToken) {
+        query += `&token=${encodeURIComponent(seatToken)}`;
+    }
+    if (symbolSelect.value) {
+        query += `&symbol=${symbolSelect.value}`;
+    }
+    websocket = new WebSocket(`${wsBase}/ws/${gameId}${query}`);
+
+    websocket.onopen = () => console.log("WebSocket connection established");
+
+    websocket.onmessage = (event) => {
+        const data = JSON.parse(event.data);
+
+        if (data.event === "invalid_move") {
+            statusDiv.textContent = data.error;
+            return;
+        }
+
+        if (data.error) {
+            alert(data.error);
+            showView('game-setup');
+            return;
+        }
+
+        if (data.names) {
+            names = data.names;
+            scoreThirdDiv.classList.toggle('hidden', !("Δ" in names));
+        }
+
+        if (data.board) {
+            sizeBoard(data.board.length);
+            markSubBoards(data.ultimate);
+        }
+
+        switch (data.event) {
+            case "player_assignment":
+                player = data.player;
+                displayPlayerSymbol.textContent = player;
+                if (data.score) {
+                    updateScore(data.score);
+                }
+                if (data.coin_commitment) {
+                    coinCommitment = data.coin_commitment;
+                }
+                break;
+            case "coin_flip":
+                checkCoinFlip(data.coin_nonce);
+                break;
+            case "start_game":
+                swapBtn.disabled = false;
+                updateBoard(data.board);
+                updateScore(data.score);
+                displayGameId.textContent = gameId;
+                showView('game-container');
+                updateTurnIndicator(data.current_player);
+                statusDiv.textContent = `Game started! It's Player ${data.current_player}'s turn.`;
+                if (data.best_of) {
+                    statusDiv.textContent += ` Best of ${data.best_of}.`;
+                }
+                break;
+            case "move":
+                swapBtn.disabled = true;
+                updateBoard(data.board);
+                updateTurnIndicator(data.current_player);
+                statusDiv.textContent = (data.current_player === player) ? "It's your turn." : `It's Player ${data.current_player}'s turn.`;
+                break;
+            case "undo_applied":
+                updateBoard(data.board);
+                updateTurnIndicator(data.current_player);
+                statusDiv.textContent = (data.current_player === player) ? "Move taken back. It's your turn." : `Move taken back. It's Player ${data.current_player}'s turn.`;
+                break;
+            case "win":
+                swapBtn.disabled = false;
+                updateBoard(data.board);
+                updateScore(data.score);
+                highlightLines(data.winning_line);
+                disableBoard();
+                showEndGameModal((data.player === player) ? "You Win!" : `${names[data.player]} beat ${Object.keys(names).filter(s => s !== data.player).map(s => names[s]).join(" and ")}!`);
+                break;
+            case "concede":
+                updateBoard(data.board);
+                updateScore(data.score);
+                disableBoard();
+                showEndGameModal((data.player === player) ? "Your opponent conceded. You Win!" : "You conceded the round.");
+                break;
+            case "draw":
+                swapBtn.disabled = false;
+                updateBoard(data.board);
+                updateScore(data.score);
+                disableBoard();
+                showEndGameModal("It's a Draw!");
+                break;
+            case "series_over":
+                seriesOver = true;
+                updateScore(data.score);
+                showEndGameModal((data.player === player) ? "You Win the Series!" : `${names[data.player]} Wins the Series!`);
+                rematchBtn.textContent = "Start New Series";
+                break;
+            case "series_summary":
+                seriesOver = true;
+                updateScore(data.score);
+                if (data.result === "tied") {
+                    showEndGameModal(`The Series Is Tied after ${data.max_rounds} Rounds!`);
+                } else {
+                    showEndGameModal((data.player === player) ? "You Win the Series!" : `${names[data.player]} Wins the Series!`);
+                }
+                rematchBtn.textContent = "Start New Series";
+                break;
+            case "new_game":
+                swapBtn.disabled = false;
+                seriesOver = false;
+                hideEndGameModal();
+                resetBoard();
+                updateBoard(data.board);
+                updateScore(data.score);
+                updateTurnIndicator(data.current_player);
+                statusDiv.textContent = `Rematch! It's Player ${data.current_player}'s turn.`;
+                break;
+            case "game_starting":
+                // start_game or new_game follows at starts_at; moves before then are refused
+                hideEndGameModal();
+                displayGameId.textContent = gameId;
+                showView('game-container');
+                showCountdown(Date.parse(data.starts_at));
+                break;
+            case "opponent_joined":
+                statusDiv.textContent = "A new opponent has joined. The score carries on.";
+                break;
+            case "settings":
+                // The first player set up the game; it starts once we agree
+                if (data.code === "settings_offered" && data.player !== player && confirm(data.message)) {
+                    websocket.send(JSON.stringify({ event: "accept_settings" }));
+                }
+                break;
+            case "ping":
+                websocket.send(JSON.stringify({ event: "pong", nonce: data.nonce }));
+                break;
+            case "latency":
+                showLatency(data.latency);
+                break;
+            case "swap_requested":
+                if (data.player !== player) {
+                    const answer = confirm(`${names[data.player]} wants to swap symbols. The score goes with you. Swap?`) ? "swap_accept" : "swap_decline";
+                    websocket.send(JSON.stringify({ event: answer }));
+                }
+                break;
+            case "swap_declined":
+                statusDiv.textContent = data.message;
+                swapBtn.disabled = false;
+                break;
+            case "seats_swapped":
+                // A player_assignment with our new symbol follows
+                updateScore(data.score);
+                statusDiv.textContent = data.message;
+                swapBtn.disabled = false;
+                break;
+            case "cursor":
+                // The server sends at most ten a second, only while the round is on
+                cells.forEach(c => c.classList.remove('opponent-cursor'));
+                document.querySelector(`.cell[data-row='${data.row}'][data-col='${data.col}']`)?.classList.add('opponent-cursor');
+                break;
+            case "opponent_left":
+                statusDiv.textContent = "Your opponent has left the game.";
+                disableBoard();
+                hideEndGameModal();
+                break;
+        }
+    };
+
+    websocket.onclose = (event) => {
+        console.log("WebSocket connection closed");
+        if (event.code === 4010) {
+            statusDiv.textContent = "This game is open in another tab now.";
+        } else if (event.code === 4011) {
+            statusDiv.textContent = "The game's host removed you from the game.";
+        } else if (!statusDiv.textContent.includes("left")) {
+            statusDiv.textContent = "Connection lost. Please refresh.";
+        }
+        disableBoard();
+        hideEndGameModal();
+    };
+
+    websocket.onerror = (error) => {
+        console.error("WebSocket error:", error);
+        statusDiv.textContent = "An error occurred. Please refresh the page.";
+    };
+}
+
+// --- Game Board & UI Logic ---
+gameBoard.addEventListener("click", (event) => {
+    const cell = event.target.closest(".cell");
+    // Check if the cell is empty by seeing if it has a child span
+    if (cell && !cell.querySelector('span') && player && !cell.style.cursor.includes('not-allowed')) {
+        const row = cell.dataset.row;
+        const col = cell.dataset.col;
+        websocket.send(JSON.stringify({ event: "make_move", row: parseInt(row), col: parseInt(col) }));
+    }
+});
+
+// Tell the opponent which cell we're hovering over, at most ten times a second
+let lastCursor = 0;
+gameBoard.addEventListener("mouseover", (event) => {
+    const cell = event.target.closest(".cell");
+    const now = Date.now();
+    if (cell && player && websocket?.readyState === WebSocket.OPEN && now - lastCursor >= 100) {
+        lastCursor = now;
+        websocket.send(JSON.stringify({ event: "cursor", row: parseInt(cell.dataset.row), col: parseInt(cell.dataset.col) }));
+    }
+});
+
+// Count down to startsAt in the status line, until the round's own message replaces it
+let countdownTimer = null;
+function showCountdown(startsAt) {
+    clearInterval(countdownTimer);
+    const tick = () => {
+        const left = Math.ceil((startsAt - Date.now()) / 1000);
+        if (left <= 0 || !statusDiv.textContent.startsWith("Starting in")) {
+            clearInterval(countdownTimer);
+            return;
+        }
+        statusDiv.textContent = `Starting in ${left}...`;
+    };
+    statusDiv.textContent = "Starting in";
+    tick();
+    countdownTimer = setInterval(tick, 250);
+}
+
+// Rebuild the grid when the game's board isn't the size on screen
+function sizeBoard(n) {
+    if (cells.length === n * n) {
+        return;
+    }
+    gameBoard.innerHTML = '';
+    for (let i = 0; i < n; i++) {
+        for (let j = 0; j < n; j++) {
+            const cell = document.createElement('div');
+            cell.className = 'cell';
+            cell.dataset.row = i;
+            cell.dataset.col = j;
+            cell.style.fontSize = `${9 / n}em`;
+            gameBoard.appendChild(cell);
+        }
+    }
+    gameBoard.style.gridTemplateColumns = `repeat(${n}, 1fr)`;
+    cells = gameBoard.querySelectorAll(".cell");
+}
+
+function updateBoard(board) {
+    sizeBoard(board.length);
+    board.forEach((row, i) => {
+        row.forEach((value, j) => {
+            const cell = document.querySelector(`.cell[data-row='${i}'][data-col='${j}']`);
+            
+            // If there's a value but the cell is empty, create the span
+            if (value && !cell.querySelector('span')) {
+                const span = document.createElement('span');
+                span.textContent = value;
+                cell.appendChild(span);
+            } 
+            // If there's no value but the cell has a span, remove it
+            else if (!value && cell.querySelector('span')) {
+                cell.innerHTML = '';
+            }
+
+            // Update styling class
+            cell.classList.remove('X', 'O', 'Δ');
+            if (value) {
+                cell.classList.add(value);
+            }
+        });
+    });
+}
+
+// Ultimate games: outline the sub-boards, dim the decided ones and light
+// up the one the next move must go in (every open one when any will do)
+function markSubBoards(ultimate) {
+    cells.forEach(cell => {
+        cell.classList.remove('sub-right', 'sub-bottom', 'decided', 'next');
+        if (!ultimate) {
+            return;
+        }
+        const row = parseInt(cell.dataset.row), col = parseInt(cell.dataset.col);
+        const sr = Math.floor(row / 3), sc = Math.floor(col / 3);
+        const next = ultimate.next_board;
+        cell.classList.toggle('sub-right', col % 3 === 2 && col < 8);
+        cell.classList.toggle('sub-bottom', row % 3 === 2 && row < 8);
+        if (ultimate.sub_boards[sr][sc]) {
+            cell.classList.add('decided');
+        } else if (!next || (next[0] === sr && next[1] === sc)) {
+            cell.classList.add('next');
+        }
+    });
+}
+
+function resetBoard() {
+    cells.forEach(cell => {
+        cell.innerHTML = ""; // This removes the inner span
+        cell.style.cursor = 'pointer';
+        cell.classList.remove('X', 'O', 'Δ', 'winning');
+    });
+}
+
+// Marks the cells of every line that won the round.
+function highlightLines(lines) {
+    (lines || []).forEach(line => {
+        line.forEach(([row, col]) => {
+            const cell = document.querySelector(`.cell[data-row='${row}'][data-col='${col}']`);
+            if (cell) {
+                cell.classList.add('winning');
+            }
+        });
+    });
+}
+
+function disableBoard() {
+    cells.forEach(cell => {
+        cell.style.cursor = 'not-allowed';
+    });
+}
+
+function updateScore(score) {
+    scoreXDiv.textContent = `Player X: ${score.X}`;
+    scoreODiv.textContent = `Player O: ${score.O}`;
+    scoreThirdDiv.textContent = `Player Δ: ${score["Δ"] || 0}`;
+    scoreDrawsDiv.textContent = `Draws: ${score.draws || 0}`;
+}
+
+// Each player's round trip to the server, coloured by how it will feel
+function showLatency(latency) {
+    latencyP.replaceChildren("Ping:");
+    for (const [symbol, ms] of Object.entries(latency)) {
+        const span = document.createElement("span");
+        span.className = ms < 100 ? "good" : ms < 250 ? "fair" : "poor";
+        span.textContent = ` ${symbol === player ? "you" : names[symbol] || symbol} ${ms} ms`;
+        latencyP.append(span);
+    }
+    latencyP.classList.remove("hidden");
+}
+
+// The coin is fair if it hashes to the commitment we got before the flip.
+// crypto.subtle needs a secure context, so over plain http:// we can't tell.
+async function checkCoinFlip(nonce) {
+    if (!coinCommitment || !crypto.subtle) {
+        return;
+    }
+    const bytes = new Uint8Array(nonce.match(/../g).map((h) => parseInt(h, 16)));
+    const digest = new Uint8Array(await crypto.subtle.digest("SHA-256", bytes));
+    const hex = Array.from(digest, (b) => b.toString(16).padStart(2, "0")).join("");
+    if (hex !== coinCommitment) {
+        console.warn("The coin flip doesn't match the coin the server committed to");
+    }
+}
+
+function updateTurnIndicator(currentPlayer) {
+    scoreXDiv.classList.toggle('current-player', currentPlayer === 'X');
+    scoreODiv.classList.toggle('current-player', currentPlayer === 'O');
+    scoreThirdDiv.classList.toggle('current-player', currentPlayer === 'Δ');
+}
+
+// --- Initial State ---
+document.addEventListener('DOMContentLoaded', () => {
+    showView('game-setup');
+});
+